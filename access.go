@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// routeGroup names a set of routes that share network exposure rules.
+type routeGroup string
+
+const (
+	groupAPI       routeGroup = "api"
+	groupAdmin     routeGroup = "admin"
+	groupCDP       routeGroup = "cdp"
+	groupWHIP      routeGroup = "whip"
+	groupDashboard routeGroup = "dashboard"
+	groupGallery   routeGroup = "gallery"
+)
+
+var routeGroups = []routeGroup{groupAPI, groupAdmin, groupCDP, groupWHIP, groupDashboard, groupGallery}
+
+var (
+	// allowedNetworks holds the networks allowed to reach each group. Groups
+	// without an entry are reachable from anywhere.
+	allowedNetworks = map[routeGroup][]*net.IPNet{}
+	// trustedProxies are the networks whose X-Forwarded-For header is
+	// believed when determining the client address.
+	trustedProxies []*net.IPNet
+)
+
+// loadAccessRules reads ALLOW_<GROUP>_FROM and TRUSTED_PROXIES, each a
+// comma-separated list of IP addresses or CIDR ranges.
+func loadAccessRules() error {
+	for _, g := range routeGroups {
+		env := "ALLOW_" + strings.ToUpper(string(g)) + "_FROM"
+		nets, err := parseNetworks(os.Getenv(env))
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		if len(nets) > 0 {
+			allowedNetworks[g] = nets
+			log.Printf("Access: %s routes restricted to %s", g, os.Getenv(env))
+		}
+	}
+	nets, err := parseNetworks(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// parseNetworks parses a comma-separated list of addresses and CIDR ranges.
+// The keywords "localhost" and "private" expand to the loopback and private
+// ranges.
+func parseNetworks(s string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, item := range splitList(s) {
+		switch item {
+		case "localhost":
+			out = append(out, mustCIDR("127.0.0.0/8"), mustCIDR("::1/128"))
+			continue
+		case "private":
+			out = append(out, mustCIDR("10.0.0.0/8"), mustCIDR("172.16.0.0/12"),
+				mustCIDR("192.168.0.0/16"), mustCIDR("fc00::/7"))
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client, following X-Forwarded-For
+// through trusted proxies. Unix socket peers are treated as loopback.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return net.IPv6loopback
+	}
+
+	if !containsIP(trustedProxies, ip) {
+		return ip
+	}
+	// Walk X-Forwarded-For from the nearest hop, skipping trusted proxies.
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// restrictNetwork rejects clients outside the networks allowed for a group.
+func restrictNetwork(group routeGroup, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nets, ok := allowedNetworks[group]; ok {
+			if ip := clientIP(r); !containsIP(nets, ip) {
+				log.Printf("Access: denied %s to %s route %s", ip, group, r.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
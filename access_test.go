@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	nets, err := parseNetworks("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustedProxies = nets
+	defer func() { trustedProxies = nil }()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+	if got := clientIP(r).String(); got != "5.6.7.8" {
+		t.Errorf("clientIP via trusted proxy = %s, want 5.6.7.8", got)
+	}
+
+	r.RemoteAddr = "9.9.9.9:5000"
+	if got := clientIP(r).String(); got != "9.9.9.9" {
+		t.Errorf("clientIP via untrusted peer = %s, want 9.9.9.9", got)
+	}
+}
+
+func TestRestrictNetwork(t *testing.T) {
+	nets, err := parseNetworks("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedNetworks[groupAdmin] = nets
+	defer delete(allowedNetworks, groupAdmin)
+
+	h := restrictNetwork(groupAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for addr, want := range map[string]int{
+		"127.0.0.1:1234": http.StatusOK,
+		"[::1]:1234":     http.StatusOK,
+		"8.8.8.8:1234":   http.StatusForbidden,
+	} {
+		r := httptest.NewRequest("POST", "/admin/cleanup", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", addr, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// drainHandler toggles draining mode.
+// POST /admin/drain - stop accepting new sessions
+// DELETE /admin/drain - resume accepting new sessions
+func drainHandler(w http.ResponseWriter, r *http.Request) {
+	draining := r.Method == http.MethodPost
+	requestSessions(r).SetDraining(draining)
+	log.Printf("Admin: draining set to %t by %s", draining, ownerName(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"draining": draining})
+}
+
+// cleanupHandler stops every session.
+// POST /admin/cleanup
+func cleanupHandler(w http.ResponseWriter, r *http.Request) {
+	n := requestSessions(r).StopAll()
+	log.Printf("Admin: cleanup stopped %d sessions (requested by %s)", n, ownerName(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"stopped": n})
+}
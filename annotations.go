@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// AnnotationRequest asks for an overlay to be drawn onto a session's
+// screencast.
+type AnnotationRequest struct {
+	session.Annotation
+	// DurationMS is how long the annotation shows, 5 seconds if zero and
+	// at most a minute.
+	DurationMS int64 `json:"duration_ms,omitempty"`
+}
+
+// annotationsHandler draws an overlay onto a session's screencast (POST),
+// lists those showing (GET) or takes them all off (DELETE). Overlays show
+// in previews, frame streams, WHIP, rewind and everything else fed by the
+// screencast, but never in the page, its screenshots or its artifacts.
+// POST, GET, DELETE /sessions/{id}/annotations
+func annotationsHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet && !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		annotations := sess.Annotations()
+		if annotations == nil {
+			annotations = []session.Annotation{}
+		}
+		writeJSONWithETag(w, r, annotations)
+
+	case http.MethodDelete:
+		sess.RemoveAnnotation("")
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPost:
+		var req AnnotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		a, err := sess.Annotate(req.Annotation, time.Duration(req.DurationMS)*time.Millisecond)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(a)
+	}
+}
+
+// deleteAnnotationHandler takes one overlay off a session's screencast
+// before it expires.
+// DELETE /sessions/{id}/annotations/{annotationId}
+func deleteAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sess, ok := requestSessions(r).GetSession(vars["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !sess.RemoveAnnotation(vars["annotationId"]) {
+		http.Error(w, "Annotation not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"browser-server/article"
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// pageDocument returns the URL and current DOM of the session's page, or
+// writes the error response and returns false.
+func pageDocument(w http.ResponseWriter, r *http.Request) (*url.URL, string, bool) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil, "", false
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, "", false
+	}
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	pageURL, doc, err := sess.PageHTML(ctx)
+	if errors.Is(err, session.ErrNoPage) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil, "", false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return nil, "", false
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		http.Error(w, "Invalid page URL", http.StatusBadGateway)
+		return nil, "", false
+	}
+	return u, doc, true
+}
+
+// articleHandler extracts the readable content of the session's page:
+// its title, byline, text and images.
+// GET /sessions/{id}/article
+func articleHandler(w http.ResponseWriter, r *http.Request) {
+	u, doc, ok := pageDocument(w, r)
+	if !ok {
+		return
+	}
+	a, err := article.Extract(strings.NewReader(doc), u)
+	if errors.Is(err, article.ErrNoContent) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// markdownHandler converts the session's page to Markdown, or only its
+// main content with ?main=true.
+// GET /sessions/{id}/markdown
+func markdownHandler(w http.ResponseWriter, r *http.Request) {
+	u, doc, ok := pageDocument(w, r)
+	if !ok {
+		return
+	}
+	md, err := article.Markdown(strings.NewReader(doc), u, r.URL.Query().Get("main") == "true")
+	if errors.Is(err, article.ErrNoContent) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("X-Page-URL", u.String())
+	w.Write([]byte(md))
+}
@@ -0,0 +1,428 @@
+// Package article extracts the main content of a web page the way reader
+// modes do: the block of the page with the most prose is kept, and
+// navigation, sidebars, comments and ads are dropped.
+package article
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoContent is returned for pages without enough prose to extract.
+var ErrNoContent = errors.New("no article content found")
+
+// Article is the readable content of a page.
+type Article struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Byline   string `json:"byline,omitempty"`
+	SiteName string `json:"site_name,omitempty"`
+	Excerpt  string `json:"excerpt,omitempty"`
+	Lang     string `json:"lang,omitempty"`
+	// Text is the content as plain text, one paragraph per line.
+	Text   string  `json:"text"`
+	Words  int     `json:"words"`
+	Images []Image `json:"images"`
+}
+
+// Image is an image in the content.
+type Image struct {
+	URL string `json:"url"`
+	Alt string `json:"alt,omitempty"`
+}
+
+var (
+	// unlikely and likely classify elements by their class and id.
+	unlikely = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|consent|cookie|disqus|extra|footer|gdpr|header|legends|menu|modal|nav|newsletter|pager|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tweet|twitter|ad-break|advert`)
+	likely   = regexp.MustCompile(`(?i)and|article|body|column|content|main|post|shadow|story|text|entry`)
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negative = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	byline   = regexp.MustCompile(`(?i)byline|author|dateline|writtenby|p-author`)
+	spaces   = regexp.MustCompile(`\s+`)
+)
+
+// dropped are elements that never hold article prose.
+var dropped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Form: true, atom.Nav: true, atom.Footer: true, atom.Aside: true,
+	atom.Svg: true, atom.Button: true, atom.Input: true, atom.Select: true,
+	atom.Textarea: true, atom.Template: true, atom.Object: true, atom.Embed: true,
+}
+
+// blocks are elements rendered on lines of their own.
+var blocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Li: true, atom.Blockquote: true, atom.Pre: true, atom.Figcaption: true,
+	atom.Tr: true, atom.Dt: true, atom.Dd: true, atom.Br: true, atom.Hr: true,
+}
+
+// Extract reads an HTML document loaded from pageURL and returns its
+// article. Relative image URLs are resolved against pageURL.
+func Extract(r io.Reader, pageURL *url.URL) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	a := &Article{URL: pageURL.String(), Images: []Image{}}
+	readMetadata(doc, a)
+
+	body := find(doc, atom.Body)
+	if body == nil {
+		return nil, ErrNoContent
+	}
+	if a.Byline == "" {
+		a.Byline = findByline(body)
+	}
+	clean(body)
+
+	var out strings.Builder
+	for _, n := range content(body) {
+		writeText(&out, n)
+		collectImages(n, pageURL, a)
+	}
+	a.Text = strings.TrimSpace(blankLines.ReplaceAllString(out.String(), "\n"))
+	a.Words = len(strings.Fields(a.Text))
+	if a.Words == 0 {
+		return nil, ErrNoContent
+	}
+	if a.Excerpt == "" {
+		first, _, _ := strings.Cut(a.Text, "\n")
+		a.Excerpt = first
+	}
+	return a, nil
+}
+
+var blankLines = regexp.MustCompile(`\n\s*\n+`)
+
+// readMetadata fills in the title, byline, site name, excerpt and
+// language from the document's head.
+func readMetadata(doc *html.Node, a *Article) {
+	meta := make(map[string]string)
+	var title string
+	walk(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Html:
+			a.Lang = attr(n, "lang")
+		case atom.Title:
+			if title == "" {
+				title = textOf(n)
+			}
+		case atom.Meta:
+			key := strings.ToLower(attr(n, "property"))
+			if key == "" {
+				key = strings.ToLower(attr(n, "name"))
+			}
+			if v := strings.TrimSpace(attr(n, "content")); key != "" && v != "" && meta[key] == "" {
+				meta[key] = v
+			}
+		case atom.Body:
+			return false
+		}
+		return true
+	})
+
+	a.Title = first(meta["og:title"], meta["twitter:title"], title)
+	if a.Title == "" {
+		if h1 := find(doc, atom.H1); h1 != nil {
+			a.Title = textOf(h1)
+		}
+	}
+	a.Byline = first(meta["author"], meta["article:author"])
+	if strings.HasPrefix(a.Byline, "http") {
+		a.Byline = ""
+	}
+	a.SiteName = meta["og:site_name"]
+	a.Excerpt = first(meta["og:description"], meta["twitter:description"], meta["description"])
+}
+
+// findByline returns the text of a short element marked as the author.
+func findByline(body *html.Node) string {
+	var by string
+	walk(body, func(n *html.Node) bool {
+		if by != "" {
+			return false
+		}
+		if n.Type == html.ElementNode && (attr(n, "rel") == "author" || attr(n, "itemprop") == "author" || byline.MatchString(attr(n, "class")+" "+attr(n, "id"))) {
+			if t := textOf(n); t != "" && len(t) < 100 {
+				by = t
+				return false
+			}
+		}
+		return true
+	})
+	return by
+}
+
+// clean removes the elements that are not content.
+func clean(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || c.Type == html.ElementNode && (dropped[c.DataAtom] || isUnlikely(c) || isHidden(c)) {
+			n.RemoveChild(c)
+		} else {
+			clean(c)
+		}
+		c = next
+	}
+}
+
+func isUnlikely(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.A {
+		return false
+	}
+	match := attr(n, "class") + " " + attr(n, "id") + " " + attr(n, "role")
+	return unlikely.MatchString(match) && !likely.MatchString(match) && find(n, atom.Article) == nil
+}
+
+func isHidden(n *html.Node) bool {
+	if _, ok := attrOK(n, "hidden"); ok || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(attr(n, "style"), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// content scores the blocks holding paragraphs by how much prose they
+// have and returns the best one together with its siblings that look
+// like part of the same article.
+func content(body *html.Node) []*html.Node {
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	add := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	walk(body, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+		default:
+			return true
+		}
+		text := textOf(n)
+		if len(text) < 25 {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		add(n.Parent, score)
+		if n.Parent != nil {
+			add(n.Parent.Parent, score/2)
+		}
+		return false
+	})
+
+	var top *html.Node
+	var topScore float64
+	for _, n := range candidates {
+		s := scores[n] * (1 - linkDensity(n))
+		scores[n] = s
+		if top == nil || s > topScore {
+			top, topScore = n, s
+		}
+	}
+	if top == nil {
+		return []*html.Node{body}
+	}
+	parent := top.Parent
+	if parent == nil {
+		return []*html.Node{top}
+	}
+
+	// Siblings scoring close to the top candidate, or holding a
+	// substantial paragraph, belong to the article too.
+	threshold := max(10, topScore*0.2)
+	var out []*html.Node
+	for c := parent.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch {
+		case c == top:
+			out = append(out, c)
+		case scores[c] >= threshold:
+			out = append(out, c)
+		case c.DataAtom == atom.P:
+			if text := textOf(c); len(text) > 80 && linkDensity(c) < 0.25 {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// initialScore weighs a candidate by its tag and its class and id.
+func initialScore(n *html.Node) float64 {
+	var s float64
+	switch n.DataAtom {
+	case atom.Div, atom.Article, atom.Main:
+		s = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		s = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		s = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		s = -5
+	}
+	for _, v := range []string{attr(n, "class"), attr(n, "id")} {
+		if v == "" {
+			continue
+		}
+		if negative.MatchString(v) {
+			s -= 25
+		}
+		if positive.MatchString(v) {
+			s += 25
+		}
+	}
+	return s
+}
+
+// linkDensity is the share of a node's text that is link text.
+func linkDensity(n *html.Node) float64 {
+	total := len(textOf(n))
+	if total == 0 {
+		return 0
+	}
+	var links int
+	walk(n, func(c *html.Node) bool {
+		if c.DataAtom == atom.A {
+			links += len(textOf(c))
+			return false
+		}
+		return true
+	})
+	return float64(links) / float64(total)
+}
+
+// writeText renders a node as plain text, putting blocks on lines of
+// their own and list items behind a dash.
+func writeText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(spaces.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if n.DataAtom == atom.Pre {
+		b.WriteString("\n\n" + rawText(n) + "\n\n")
+		return
+	}
+	block := blocks[n.DataAtom]
+	if block {
+		b.WriteString("\n\n")
+	}
+	if n.DataAtom == atom.Li {
+		b.WriteString("- ")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(b, c)
+	}
+	if block {
+		b.WriteString("\n\n")
+	}
+}
+
+// collectImages adds the images inside n to the article.
+func collectImages(n *html.Node, base *url.URL, a *Article) {
+	walk(n, func(c *html.Node) bool {
+		if c.DataAtom != atom.Img {
+			return true
+		}
+		src := first(attr(c, "src"), attr(c, "data-src"))
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return false
+		}
+		u, err := base.Parse(src)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return false
+		}
+		for _, img := range a.Images {
+			if img.URL == u.String() {
+				return false
+			}
+		}
+		a.Images = append(a.Images, Image{URL: u.String(), Alt: strings.TrimSpace(attr(c, "alt"))})
+		return false
+	})
+}
+
+// walk calls fn for n and its descendants in document order, skipping
+// the children of nodes fn returns false for.
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// find returns the first element of the given kind under n.
+func find(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// textOf returns the text of n with whitespace collapsed.
+func textOf(n *html.Node) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(rawText(n), " "))
+}
+
+func rawText(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		return true
+	})
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
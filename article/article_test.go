@@ -0,0 +1,69 @@
+package article
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<title>Rivers of the North | The Daily Example</title>
+<meta property="og:title" content="Rivers of the North">
+<meta property="og:site_name" content="The Daily Example">
+<meta name="author" content="Ada Writer">
+</head>
+<body>
+<nav class="menu"><a href="/">Home</a> <a href="/news">News</a> <a href="/sports">Sports</a></nav>
+<div id="cookie-banner">We use cookies, to improve your experience, and for analytics, ads and more.</div>
+<div class="layout">
+  <div class="sidebar"><p>Popular: ten tricks, five lists, and one weird recipe everyone, everywhere, loves.</p></div>
+  <article class="post">
+    <h1>Rivers of the North</h1>
+    <p>The northern rivers freeze every winter, and the towns along them have learned to live with the ice, the floods and the long dark months.</p>
+    <img src="/img/river.jpg" alt="A frozen river">
+    <p>Fishermen cut holes in the ice, while children skate between the boats that wait, frozen in place, for the spring thaw to come.</p>
+    <ul><li>Ice fishing</li><li>Skating</li></ul>
+    <p style="display:none">Hidden text that should never show up in the article body at all.</p>
+    <script>track("article view, with commas, and more commas")</script>
+  </article>
+  <div class="comments"><p>First! Great article, really, I loved it, thanks for writing, keep going.</p></div>
+</div>
+<footer><p>Copyright The Daily Example, all rights reserved, 2026, everywhere.</p></footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	u, _ := url.Parse("https://news.example.com/2026/rivers")
+	a, err := Extract(strings.NewReader(testPage), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Title != "Rivers of the North" || a.Byline != "Ada Writer" || a.SiteName != "The Daily Example" || a.Lang != "en" {
+		t.Errorf("metadata = %+v", a)
+	}
+	for _, want := range []string{"The northern rivers freeze", "Fishermen cut holes", "- Ice fishing"} {
+		if !strings.Contains(a.Text, want) {
+			t.Errorf("text lacks %q:\n%s", want, a.Text)
+		}
+	}
+	for _, unwanted := range []string{"Home", "cookies", "Popular", "First!", "Copyright", "Hidden text", "track("} {
+		if strings.Contains(a.Text, unwanted) {
+			t.Errorf("text contains %q:\n%s", unwanted, a.Text)
+		}
+	}
+	if len(a.Images) != 1 || a.Images[0].URL != "https://news.example.com/img/river.jpg" || a.Images[0].Alt != "A frozen river" {
+		t.Errorf("images = %+v", a.Images)
+	}
+	if a.Excerpt == "" || a.Words == 0 {
+		t.Errorf("excerpt %q, %d words", a.Excerpt, a.Words)
+	}
+}
+
+func TestExtractEmpty(t *testing.T) {
+	u, _ := url.Parse("https://example.com/")
+	if _, err := Extract(strings.NewReader(`<html><body><script>app()</script></body></html>`), u); err != ErrNoContent {
+		t.Errorf("err = %v, want ErrNoContent", err)
+	}
+}
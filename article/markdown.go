@@ -0,0 +1,323 @@
+package article
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// mdBlocks are the elements rendered as Markdown blocks rather than
+// inline text.
+var mdBlocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Header: true, atom.Figure: true, atom.Figcaption: true, atom.Address: true,
+	atom.Details: true, atom.Summary: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Blockquote: true, atom.Pre: true,
+	atom.Table: true, atom.Hr: true,
+}
+
+var (
+	runs      = regexp.MustCompile(`[ \t]+`)
+	manyLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// Markdown reads an HTML document loaded from pageURL and converts it to
+// Markdown, keeping headings, links, images, emphasis, lists, code and
+// tables. Like Extract it drops scripts, navigation, banners and hidden
+// elements; with mainOnly it converts only the article's content. Links
+// and images are made absolute.
+func Markdown(r io.Reader, pageURL *url.URL, mainOnly bool) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	body := find(doc, atom.Body)
+	if body == nil {
+		return "", ErrNoContent
+	}
+	clean(body)
+
+	w := mdWriter{base: pageURL}
+	nodes := []*html.Node{body}
+	if mainOnly {
+		nodes = content(body)
+	}
+	var parts []string
+	for _, n := range nodes {
+		if md := w.block(n); md != "" {
+			parts = append(parts, md)
+		}
+	}
+	md := strings.TrimSpace(manyLines.ReplaceAllString(strings.Join(parts, "\n\n"), "\n\n"))
+	if md == "" {
+		return "", ErrNoContent
+	}
+	return md + "\n", nil
+}
+
+// mdWriter renders nodes as Markdown.
+type mdWriter struct {
+	base *url.URL
+}
+
+// blocks renders the children of n, gathering runs of inline content
+// into paragraphs.
+func (w mdWriter) blocks(n *html.Node) string {
+	var out []string
+	var inline strings.Builder
+	flush := func() {
+		if t := tidy(inline.String()); t != "" {
+			out = append(out, t)
+		}
+		inline.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && mdBlocks[c.DataAtom] {
+			flush()
+			if b := w.block(c); b != "" {
+				out = append(out, b)
+			}
+			continue
+		}
+		inline.WriteString(w.inline(c))
+	}
+	flush()
+	return strings.Join(out, "\n\n")
+}
+
+// block renders a block element.
+func (w mdWriter) block(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := strings.ReplaceAll(tidy(w.children(n)), "\n", " ")
+		if text == "" {
+			return ""
+		}
+		level := int(n.Data[1] - '0')
+		return strings.Repeat("#", level) + " " + text
+	case atom.Ul, atom.Ol:
+		return w.list(n)
+	case atom.Blockquote:
+		inner := w.blocks(n)
+		if inner == "" {
+			return ""
+		}
+		return prefixLines(inner, "> ", "> ")
+	case atom.Pre:
+		code := strings.Trim(rawText(n), "\n")
+		if code == "" {
+			return ""
+		}
+		lang := ""
+		if c := find(n, atom.Code); c != nil {
+			for _, class := range strings.Fields(attr(c, "class")) {
+				if l, ok := strings.CutPrefix(class, "language-"); ok {
+					lang = l
+				}
+			}
+		}
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + lang + "\n" + code + "\n" + fence
+	case atom.Table:
+		return w.table(n)
+	case atom.Hr:
+		return "---"
+	case atom.Dt:
+		if t := tidy(w.children(n)); t != "" {
+			return "**" + t + "**"
+		}
+		return ""
+	}
+	return w.blocks(n)
+}
+
+// list renders a list, indenting the continuation lines and nested
+// lists of each item under its marker.
+func (w mdWriter) list(n *html.Node) string {
+	var items []string
+	i := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		i = start
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		content := strings.ReplaceAll(w.blocks(c), "\n\n", "\n")
+		if content == "" {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(i) + ". "
+			i++
+		}
+		items = append(items, prefixLines(content, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table renders a table as a GitHub-flavored Markdown table whose first
+// row is the header.
+func (w mdWriter) table(n *html.Node) string {
+	var rows [][]string
+	cols := 0
+	walk(n, func(c *html.Node) bool {
+		if c != n && c.DataAtom == atom.Table {
+			// Nested tables are flattened into their cell.
+			return false
+		}
+		if c.DataAtom != atom.Tr {
+			return true
+		}
+		var row []string
+		for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+				text := strings.ReplaceAll(tidy(w.children(cell)), "\n", " ")
+				row = append(row, strings.ReplaceAll(text, "|", `\|`))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+			cols = max(cols, len(row))
+		}
+		return false
+	})
+	if len(rows) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	line := func(cells []string) {
+		b.WriteString("|")
+		for i := 0; i < cols; i++ {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+	}
+	line(rows[0])
+	sep := make([]string, cols)
+	for i := range sep {
+		sep[i] = "---"
+	}
+	line(sep)
+	for _, row := range rows[1:] {
+		line(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// inline renders a node inside a paragraph.
+func (w mdWriter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return spaces.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.A:
+		text := strings.TrimSpace(strings.ReplaceAll(w.children(n), "\n", " "))
+		href := w.resolve(attr(n, "href"))
+		if text == "" || href == "" {
+			return text
+		}
+		return "[" + text + "](" + href + ")"
+	case atom.Img:
+		src := w.resolve(first(attr(n, "src"), attr(n, "data-src")))
+		if src == "" {
+			return ""
+		}
+		return "![" + strings.TrimSpace(attr(n, "alt")) + "](" + src + ")"
+	case atom.Strong, atom.B:
+		return wrap(w.children(n), "**")
+	case atom.Em, atom.I:
+		return wrap(w.children(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrap(w.children(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp:
+		return wrap(rawText(n), "`")
+	}
+	return w.children(n)
+}
+
+// children renders the children of n inline.
+func (w mdWriter) children(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(w.inline(c))
+	}
+	return b.String()
+}
+
+// resolve makes a link absolute; links that go nowhere, such as
+// javascript: URLs and data: images, resolve to "".
+func (w mdWriter) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	u, err := w.base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "http", "https", "mailto", "tel":
+		return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(u.String())
+	}
+	return ""
+}
+
+// wrap surrounds text with a Markdown marker, keeping the surrounding
+// spaces outside it.
+func wrap(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// tidy collapses the spaces in rendered inline text and trims its lines.
+func tidy(s string) string {
+	lines := strings.Split(runs.ReplaceAllString(s, " "), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// prefixLines puts head before the first line of s and rest before the
+// others.
+func prefixLines(s, head, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		p := rest
+		if i == 0 {
+			p = head
+		}
+		if l == "" {
+			lines[i] = strings.TrimRight(p, " ")
+		} else {
+			lines[i] = p + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
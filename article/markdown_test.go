@@ -0,0 +1,49 @@
+package article
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	page := `<html><body>
+<nav><a href="/">Home</a></nav>
+<h1>Release  notes</h1>
+<p>Version <strong>2.0</strong> is out, see the <a href="/changelog#v2">changelog</a>.<br>Upgrade   soon.</p>
+<img src="shot.png" alt="Screenshot">
+<ul><li>Faster <em>startup</em><ul><li>cold start</li></ul></li><li>Fewer bugs</li></ul>
+<ol start="3"><li>Third</li></ol>
+<blockquote><p>It just works.</p></blockquote>
+<pre><code class="language-go">fmt.Println("hi")</code></pre>
+<table><thead><tr><th>Name</th><th>Value</th></tr></thead>
+<tbody><tr><td>a|b</td><td>1</td></tr><tr><td>c</td></tr></tbody></table>
+<a href="javascript:void(0)">Nowhere</a>
+<script>alert("x")</script>
+</body></html>`
+	u, _ := url.Parse("https://example.com/docs/")
+	md, err := Markdown(strings.NewReader(page), u, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Release notes\n\n" +
+		"Version **2.0** is out, see the [changelog](https://example.com/changelog#v2).\nUpgrade soon.\n\n" +
+		"![Screenshot](https://example.com/docs/shot.png)\n\n" +
+		"- Faster *startup*\n  - cold start\n- Fewer bugs\n\n" +
+		"3. Third\n\n" +
+		"> It just works.\n\n" +
+		"```go\nfmt.Println(\"hi\")\n```\n\n" +
+		"| Name | Value |\n| --- | --- |\n| a\\|b | 1 |\n| c |  |\n\n" +
+		"Nowhere\n"
+	if md != want {
+		t.Errorf("Markdown =\n%s\nwant\n%s", md, want)
+	}
+
+	md, err = Markdown(strings.NewReader(testPage), u, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(md, "# Rivers of the North\n") || strings.Contains(md, "Popular") {
+		t.Errorf("main content =\n%s", md)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"browser-server/artifacts"
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// artifactStore keeps the artifact bundles of finished sessions.
+var artifactStore *artifacts.Store
+
+// setupArtifacts opens the bundle store (ARTIFACTS_DIR, ARTIFACT_RETENTION)
+// and bundles the artifacts of sessions that collected them when they stop.
+// It runs before setupEvents so bundles exist by the time session.stopped
+// is published.
+func setupArtifacts(sessions *session.Manager) error {
+	dir := os.Getenv("ARTIFACTS_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "browser-lab-artifacts")
+	}
+	retention := 24 * time.Hour
+	if v := os.Getenv("ARTIFACT_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		retention = d
+	}
+
+	store, err := artifacts.NewStore(dir, retention)
+	if err != nil {
+		return err
+	}
+	artifactStore = store
+	go artifactStore.RunJanitor(time.Minute, nil)
+
+	sessions.Observe(artifactsObserver{})
+	return nil
+}
+
+// artifactsObserver bundles the artifacts of every stopped session.
+type artifactsObserver struct{ session.NopObserver }
+
+func (artifactsObserver) SessionStopped(s *session.Session) {
+	src := s.ArtifactDir()
+	if src == "" {
+		return
+	}
+	if _, err := artifactStore.Save(s.ID, s.Owner, src); err != nil {
+		log.Printf("Artifacts: failed to bundle session %s: %v", s.ID, err)
+	}
+	os.RemoveAll(src)
+}
+
+// artifactsHandler downloads the artifact bundle of a finished session.
+// GET /sessions/{id}/artifacts
+func artifactsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, running := requestSessions(r).GetSession(id); running {
+		http.Error(w, "Session is still running", http.StatusConflict)
+		return
+	}
+
+	bundle, path, err := artifactStore.Get(id)
+	if err != nil {
+		http.Error(w, "Artifacts not found", http.StatusNotFound)
+		return
+	}
+	if !canControlOwner(r, bundle.Owner) && !signedFor(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-artifacts.zip"`, id))
+	w.Header().Set("X-Artifacts-Expires-At", bundle.ExpiresAt.UTC().Format(time.RFC3339))
+	// Bundles never change once written; ServeFile answers If-None-Match.
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d-%d"`, id, bundle.CreatedAt.UnixNano(), bundle.Size))
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,169 @@
+// Package artifacts keeps zipped bundles of what finished sessions left
+// behind for a retention window.
+package artifacts
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for bundles that never existed or have expired.
+var ErrNotFound = errors.New("artifacts not found")
+
+// Bundle describes a stored artifact zip.
+type Bundle struct {
+	SessionID string    `json:"session_id"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Size      int64     `json:"size"`
+}
+
+// Store keeps bundles as <id>.zip with <id>.json metadata in a directory.
+type Store struct {
+	dir       string
+	retention time.Duration
+}
+
+// NewStore creates the store directory if needed.
+func NewStore(dir string, retention time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, retention: retention}, nil
+}
+
+// Save zips the contents of src as the bundle for a session.
+func (st *Store) Save(sessionID, owner, src string) (Bundle, error) {
+	zipPath := st.path(sessionID, ".zip")
+	tmp := zipPath + ".tmp"
+	size, err := zipDir(tmp, src)
+	if err != nil {
+		os.Remove(tmp)
+		return Bundle{}, err
+	}
+	if err := os.Rename(tmp, zipPath); err != nil {
+		return Bundle{}, err
+	}
+
+	now := time.Now()
+	b := Bundle{
+		SessionID: sessionID,
+		Owner:     owner,
+		CreatedAt: now,
+		ExpiresAt: now.Add(st.retention),
+		Size:      size,
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return b, err
+	}
+	return b, os.WriteFile(st.path(sessionID, ".json"), data, 0644)
+}
+
+// Get returns a session's bundle and the path of its zip.
+func (st *Store) Get(sessionID string) (Bundle, string, error) {
+	var b Bundle
+	data, err := os.ReadFile(st.path(sessionID, ".json"))
+	if err != nil {
+		return b, "", ErrNotFound
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return b, "", err
+	}
+	if time.Now().After(b.ExpiresAt) {
+		return b, "", ErrNotFound
+	}
+	return b, st.path(sessionID, ".zip"), nil
+}
+
+// Sweep deletes bundles that expired before now and returns how many it
+// removed.
+func (st *Store) Sweep(now time.Time) int {
+	matches, _ := filepath.Glob(filepath.Join(st.dir, "*.json"))
+	removed := 0
+	for _, meta := range matches {
+		var b Bundle
+		data, err := os.ReadFile(meta)
+		if err != nil || json.Unmarshal(data, &b) != nil || !now.After(b.ExpiresAt) {
+			continue
+		}
+		os.Remove(strings.TrimSuffix(meta, ".json") + ".zip")
+		os.Remove(meta)
+		removed++
+	}
+	return removed
+}
+
+// RunJanitor sweeps expired bundles every interval until stop is closed.
+func (st *Store) RunJanitor(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if n := st.Sweep(now); n > 0 {
+				log.Printf("Artifacts: removed %d expired bundles", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (st *Store) path(sessionID, ext string) string {
+	return filepath.Join(st.dir, filepath.Base(sessionID)+ext)
+}
+
+// zipDir writes every regular file under src into a new zip at dst and
+// returns the zip's size.
+func zipDir(dst, src string) (int64, error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	zw := zip.NewWriter(f)
+
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(w, in)
+		return err
+	})
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,54 @@
+package artifacts
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreSaveGetSweep(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "downloads"), 0755)
+	os.WriteFile(filepath.Join(src, "console.log"), []byte("hello\n"), 0644)
+	os.WriteFile(filepath.Join(src, "downloads", "report.pdf"), []byte("%PDF"), 0644)
+
+	st, err := NewStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Save("abc", "team-a", src); err != nil {
+		t.Fatal(err)
+	}
+
+	b, path, err := st.Get("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Owner != "team-a" || b.Size == 0 {
+		t.Errorf("unexpected bundle %+v", b)
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	zr.Close()
+	if !names["console.log"] || !names["downloads/report.pdf"] {
+		t.Errorf("zip contents = %v", names)
+	}
+
+	if n := st.Sweep(time.Now()); n != 0 {
+		t.Errorf("swept %d fresh bundles", n)
+	}
+	if n := st.Sweep(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Errorf("swept %d bundles, want 1", n)
+	}
+	if _, _, err := st.Get("abc"); err != ErrNotFound {
+		t.Errorf("Get after sweep: %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Role is the level of access granted to a caller. Higher roles include
+// everything lower roles may do.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// ParseRole parses a role name.
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q", s)
+	}
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(b []byte) error {
+	parsed, err := ParseRole(string(b))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Identity is an authenticated caller, either an API key, a user signed
+// in through OIDC or the holder of a signed URL.
+type Identity struct {
+	Name string
+	Role Role
+	// Key is set when the caller authenticated with an API key.
+	Key *Key
+	// SignedPath is set when the caller holds a signed URL, which is only
+	// good for a GET of that path.
+	SignedPath string
+}
+
+type identityContextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the authenticated identity.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+// IdentityFromContext returns the authenticated identity, if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(*Identity)
+	return id, ok
+}
+
+// KeyFromContext returns the authenticated API key, if any.
+func KeyFromContext(ctx context.Context) (*Key, bool) {
+	id, ok := IdentityFromContext(ctx)
+	if !ok || id.Key == nil {
+		return nil, false
+	}
+	return id.Key, true
+}
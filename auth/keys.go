@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Template holds default session settings applied when a request body
+// leaves them unset.
+type Template struct {
+	DurationMinutes int      `json:"duration_minutes"`
+	Stealth         bool     `json:"stealth"`
+	AllowedDomains  []string `json:"allowed_domains"`
+}
+
+// Policy holds guardrails that a request body cannot override.
+type Policy struct {
+	// MaxTTLMinutes caps the session duration. Zero means no cap.
+	MaxTTLMinutes int `json:"max_ttl_minutes"`
+	// Stealth, when set, forces stealth mode on or off.
+	Stealth *bool `json:"stealth"`
+	// AllowedDomains, when non-empty, is the set of domains sessions
+	// created with this key may be restricted to. Sessions are always
+	// restricted to at least this set.
+	AllowedDomains []string `json:"allowed_domains"`
+	// MaxSessions caps the sessions the key runs at once, and
+	// SessionsPerMinute how often it creates them. Zero means no cap.
+	MaxSessions       int `json:"max_sessions"`
+	SessionsPerMinute int `json:"sessions_per_minute"`
+}
+
+// Key is an API key together with the template and policy bound to it.
+type Key struct {
+	Name     string `json:"name"`
+	Key      string `json:"key"`
+	Template string `json:"template"`
+	Policy   Policy `json:"policy"`
+	// Role defaults to operator when unset.
+	Role Role `json:"role"`
+}
+
+// EffectiveRole returns the key's role, defaulting to operator.
+func (k *Key) EffectiveRole() Role {
+	if k.Role == RoleNone {
+		return RoleOperator
+	}
+	return k.Role
+}
+
+// Store holds the configured API keys and named templates.
+type Store struct {
+	Keys      []*Key              `json:"keys"`
+	Templates map[string]Template `json:"templates"`
+}
+
+// LoadStore reads a JSON key file.
+func LoadStore(path string) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Store
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+	for _, k := range s.Keys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("key %q has no secret", k.Name)
+		}
+		if k.Template != "" {
+			if _, ok := s.Templates[k.Template]; !ok {
+				return nil, fmt.Errorf("key %q references unknown template %q", k.Name, k.Template)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// Lookup finds the key matching the given secret.
+func (s *Store) Lookup(secret string) (*Key, bool) {
+	if secret == "" {
+		return nil, false
+	}
+	for _, k := range s.Keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(secret)) == 1 {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// KeyByName returns the key with the given name, or nil.
+func (s *Store) KeyByName(name string) *Key {
+	for _, k := range s.Keys {
+		if k.Name == name {
+			return k
+		}
+	}
+	return nil
+}
+
+// TemplateFor returns the template bound to a key, if any.
+func (s *Store) TemplateFor(k *Key) (Template, bool) {
+	if k == nil || k.Template == "" {
+		return Template{}, false
+	}
+	t, ok := s.Templates[k.Template]
+	return t, ok
+}
+
+// SecretFromRequest extracts an API key from the Authorization bearer
+// token or the X-API-Key header.
+func SecretFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
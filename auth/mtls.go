@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CertIdentity maps a client certificate to an identity. A certificate
+// matches when its SHA-256 fingerprint or subject common name is equal to
+// the configured value.
+type CertIdentity struct {
+	Fingerprint string `json:"fingerprint"`
+	CommonName  string `json:"common_name"`
+	Name        string `json:"name"`
+	Role        Role   `json:"role"`
+	// KeyName applies the template and policy of the named API key.
+	KeyName string `json:"key"`
+}
+
+// CertMapper resolves verified client certificates to identities.
+type CertMapper struct {
+	Identities []CertIdentity `json:"identities"`
+	keys       *Store
+}
+
+// LoadCertMapper reads a JSON identity mapping file. An empty path yields a
+// mapper that identifies every verified certificate by its common name with
+// the operator role.
+func LoadCertMapper(path string, keys *Store) (*CertMapper, error) {
+	m := &CertMapper{keys: keys}
+	if path == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse certificate identity file: %w", err)
+	}
+	for i, ci := range m.Identities {
+		if ci.KeyName != "" {
+			if keys == nil || keys.KeyByName(ci.KeyName) == nil {
+				return nil, fmt.Errorf("certificate identity %q references unknown key %q", ci.Name, ci.KeyName)
+			}
+		}
+		m.Identities[i].Fingerprint = strings.ToLower(strings.ReplaceAll(ci.Fingerprint, ":", ""))
+	}
+	return m, nil
+}
+
+// Identify returns the identity for the leaf certificate of a verified
+// connection.
+func (m *CertMapper) Identify(state *tls.ConnectionState) (*Identity, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	cert := state.VerifiedChains[0][0]
+
+	if len(m.Identities) == 0 {
+		return &Identity{Name: cert.Subject.CommonName, Role: RoleOperator}, true
+	}
+
+	fp := Fingerprint(cert)
+	for _, ci := range m.Identities {
+		if (ci.Fingerprint != "" && ci.Fingerprint == fp) ||
+			(ci.CommonName != "" && ci.CommonName == cert.Subject.CommonName) {
+			id := &Identity{Name: ci.Name, Role: ci.Role}
+			if id.Name == "" {
+				id.Name = cert.Subject.CommonName
+			}
+			if ci.KeyName != "" {
+				id.Key = m.keys.KeyByName(ci.KeyName)
+			}
+			if id.Role == RoleNone {
+				id.Role = RoleOperator
+			}
+			return id, true
+		}
+	}
+	return nil, false
+}
+
+// Fingerprint returns the hex SHA-256 fingerprint of a certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadCertPool reads PEM-encoded CA certificates.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
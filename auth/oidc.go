@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookie = "browser_lab_session"
+	stateCookie   = "browser_lab_oidc_state"
+	sessionTTL    = 12 * time.Hour
+)
+
+// OIDCConfig configures dashboard sign-in through an OpenID Connect provider.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// GroupsClaim is the ID token claim holding the user's groups.
+	GroupsClaim string
+	// RoleGroups maps each role to the provider groups that grant it. If no
+	// viewer groups are configured, every signed-in user is a viewer.
+	RoleGroups map[Role][]string
+	// CookieSecret signs session cookies. A random secret is generated if
+	// empty, which signs everyone out on restart.
+	CookieSecret []byte
+}
+
+// OIDC handles the authorization code flow and session cookies.
+type OIDC struct {
+	cfg      OIDCConfig
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+}
+
+// NewOIDC discovers the provider configuration for the issuer.
+func NewOIDC(ctx context.Context, cfg OIDCConfig) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if len(cfg.CookieSecret) == 0 {
+		cfg.CookieSecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.CookieSecret); err != nil {
+			return nil, err
+		}
+	}
+	return &OIDC{
+		cfg:      cfg,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email", "groups"},
+		},
+	}, nil
+}
+
+// LoginHandler redirects the browser to the provider.
+func (o *OIDC) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	state := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, o.oauth.AuthCodeURL(state), http.StatusFound)
+}
+
+// CallbackHandler completes the code exchange and sets the session cookie.
+func (o *OIDC) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	state, err := r.Cookie(stateCookie)
+	if err != nil || state.Value == "" || state.Value != r.URL.Query().Get("state") {
+		http.Error(w, "Invalid OIDC state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/", MaxAge: -1})
+
+	token, err := o.oauth.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, "Failed to exchange code: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	rawID, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "Provider did not return an ID token", http.StatusBadGateway)
+		return
+	}
+	idToken, err := o.verifier.Verify(r.Context(), rawID)
+	if err != nil {
+		http.Error(w, "Invalid ID token: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, "Invalid ID token claims: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	role := o.roleFor(stringsClaim(claims[o.cfg.GroupsClaim]))
+	if role == RoleNone {
+		http.Error(w, "Your account is not a member of any permitted group", http.StatusForbidden)
+		return
+	}
+
+	name, _ := claims["email"].(string)
+	if name == "" {
+		name = idToken.Subject
+	}
+	o.setSession(w, r, cookiePayload{Name: name, Role: role, Expires: time.Now().Add(sessionTTL).Unix()})
+	log.Printf("OIDC: %s signed in as %s", name, role)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// LogoutHandler clears the session cookie.
+func (o *OIDC) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// IdentityFromRequest returns the signed-in user, if the request carries a
+// valid session cookie.
+func (o *OIDC) IdentityFromRequest(r *http.Request) (*Identity, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	p, err := o.verifyCookie(c.Value)
+	if err != nil {
+		return nil, false
+	}
+	return &Identity{Name: p.Name, Role: p.Role}, true
+}
+
+// roleFor returns the highest role granted by any of the groups.
+func (o *OIDC) roleFor(groups []string) Role {
+	best := RoleNone
+	if len(o.cfg.RoleGroups[RoleViewer]) == 0 {
+		best = RoleViewer
+	}
+	for role, allowed := range o.cfg.RoleGroups {
+		if role > best && intersects(groups, allowed) {
+			best = role
+		}
+	}
+	return best
+}
+
+type cookiePayload struct {
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Expires int64  `json:"exp"`
+}
+
+func (o *OIDC) setSession(w http.ResponseWriter, r *http.Request, p cookiePayload) {
+	body, _ := json.Marshal(p)
+	value := base64.RawURLEncoding.EncodeToString(body) + "." + o.sign(body)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (o *OIDC) verifyCookie(value string) (cookiePayload, error) {
+	var p cookiePayload
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return p, errors.New("malformed cookie")
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return p, err
+	}
+	if !hmac.Equal([]byte(sig), []byte(o.sign(body))) {
+		return p, errors.New("bad cookie signature")
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return p, err
+	}
+	if time.Now().Unix() > p.Expires {
+		return p, errors.New("session expired")
+	}
+	return p, nil
+}
+
+func (o *OIDC) sign(body []byte) string {
+	mac := hmac.New(sha256.New, o.cfg.CookieSecret)
+	mac.Write(body)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// stringsClaim converts a JSON claim that may be a string or a list of
+// strings into a slice.
+func stringsClaim(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
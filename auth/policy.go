@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"browser-server/session"
+)
+
+// Apply enforces the policy on the session options, clamping the duration,
+// forcing stealth mode and narrowing the allowed domains. It returns an
+// error if the options ask for something the policy forbids.
+func (p Policy) Apply(opts *session.Options) error {
+	if p.MaxTTLMinutes > 0 {
+		max := time.Duration(p.MaxTTLMinutes) * time.Minute
+		if opts.Duration > max {
+			opts.Duration = max
+		}
+	}
+
+	if p.Stealth != nil {
+		opts.Stealth = *p.Stealth
+	}
+
+	if len(p.AllowedDomains) > 0 {
+		if len(opts.AllowedDomains) == 0 {
+			opts.AllowedDomains = p.AllowedDomains
+			return nil
+		}
+		for _, d := range opts.AllowedDomains {
+			if !domainAllowed(d, p.AllowedDomains) {
+				return fmt.Errorf("domain %q is not permitted by this key", d)
+			}
+		}
+	}
+	return nil
+}
+
+// Quota is the share of the server's sessions the key's policy allows it.
+func (k *Key) Quota() session.Quota {
+	return session.Quota{Key: k.Name, MaxSessions: k.Policy.MaxSessions, SessionsPerMinute: k.Policy.SessionsPerMinute}
+}
+
+// domainAllowed reports whether d is one of the allowed domains or a
+// subdomain of one.
+func domainAllowed(d string, allowed []string) bool {
+	d = strings.TrimPrefix(strings.ToLower(d), "*.")
+	for _, a := range allowed {
+		a = strings.TrimPrefix(strings.ToLower(a), "*.")
+		if d == a || strings.HasSuffix(d, "."+a) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"browser-server/session"
+)
+
+func TestPolicyApply(t *testing.T) {
+	off := false
+	p := Policy{
+		MaxTTLMinutes:  10,
+		Stealth:        &off,
+		AllowedDomains: []string{"example.com"},
+	}
+
+	opts := session.Options{Duration: time.Hour, Stealth: true}
+	if err := p.Apply(&opts); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if opts.Duration != 10*time.Minute {
+		t.Errorf("duration = %v, want 10m", opts.Duration)
+	}
+	if opts.Stealth {
+		t.Error("stealth should be forced off")
+	}
+	if len(opts.AllowedDomains) != 1 || opts.AllowedDomains[0] != "example.com" {
+		t.Errorf("allowed domains = %v, want policy domains", opts.AllowedDomains)
+	}
+
+	opts = session.Options{AllowedDomains: []string{"api.example.com"}}
+	if err := p.Apply(&opts); err != nil {
+		t.Errorf("subdomain should be permitted: %v", err)
+	}
+
+	opts = session.Options{AllowedDomains: []string{"evil.com"}}
+	if err := p.Apply(&opts); err == nil {
+		t.Error("expected error for domain outside policy")
+	}
+}
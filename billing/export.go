@@ -0,0 +1,88 @@
+package billing
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// WriteCSV writes aggregated usage as CSV with a header row.
+func WriteCSV(w io.Writer, from, to time.Time, usage []TenantUsage) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"period_start", "period_end", "tenant", "sessions", "browser_minutes", "bandwidth_bytes", "storage_bytes"})
+	for _, u := range usage {
+		cw.Write([]string{
+			from.UTC().Format(time.RFC3339),
+			to.UTC().Format(time.RFC3339),
+			u.Tenant,
+			strconv.Itoa(u.Sessions),
+			strconv.FormatFloat(u.BrowserMinutes, 'f', 2, 64),
+			strconv.FormatInt(u.BandwidthBytes, 10),
+			strconv.FormatInt(u.StorageBytes, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Report is the JSON form of aggregated usage.
+type Report struct {
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+	Tenants []TenantUsage `json:"tenants"`
+}
+
+// WriteJSON writes aggregated usage as a JSON report.
+func WriteJSON(w io.Writer, from, to time.Time, usage []TenantUsage) error {
+	return json.NewEncoder(w).Encode(Report{From: from, To: to, Tenants: usage})
+}
+
+// RunExporter writes CSV and JSON exports for each completed period of the
+// given length into dir, until stop is closed. Periods are aligned to
+// multiples of the interval since the Unix epoch (midnight UTC for 24h).
+func RunExporter(l *Ledger, dir string, interval time.Duration, stop <-chan struct{}) {
+	for {
+		now := time.Now()
+		next := now.Truncate(interval).Add(interval)
+		select {
+		case <-time.After(next.Sub(now)):
+		case <-stop:
+			return
+		}
+
+		from, to := next.Add(-interval), next
+		if err := exportPeriod(l, dir, from, to); err != nil {
+			log.Printf("Billing: export for %s failed: %v", from.Format(time.RFC3339), err)
+		}
+	}
+}
+
+func exportPeriod(l *Ledger, dir string, from, to time.Time) error {
+	usage := Aggregate(l.Query(from, to, ""))
+	base := filepath.Join(dir, fmt.Sprintf("usage-%s", from.UTC().Format("20060102T150405Z")))
+
+	for ext, write := range map[string]func(io.Writer, time.Time, time.Time, []TenantUsage) error{
+		".csv":  WriteCSV,
+		".json": WriteJSON,
+	} {
+		f, err := os.Create(base + ext)
+		if err != nil {
+			return err
+		}
+		err = write(f, from, to, usage)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Billing: exported usage for %d tenants to %s.{csv,json}", len(usage), base)
+	return nil
+}
@@ -0,0 +1,146 @@
+package billing
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record is the usage of a single session.
+type Record struct {
+	Tenant         string    `json:"tenant"`
+	SessionID      string    `json:"session_id"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	BandwidthBytes int64     `json:"bandwidth_bytes"`
+	StorageBytes   int64     `json:"storage_bytes"`
+}
+
+// BrowserMinutes returns how long the browser ran.
+func (r Record) BrowserMinutes() float64 {
+	return r.End.Sub(r.Start).Minutes()
+}
+
+// Ledger stores usage records of finished sessions, optionally appending
+// them to a JSON lines file so they survive restarts.
+type Ledger struct {
+	mu      sync.RWMutex
+	records []Record
+	file    *os.File
+}
+
+// OpenLedger loads the records in path and appends new ones to it. An empty
+// path keeps records in memory only.
+func OpenLedger(path string) (*Ledger, error) {
+	l := &Ledger{}
+	if path == "" {
+		return l, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec Record
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil {
+			l.records = append(l.records, rec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.file = f
+	return l, nil
+}
+
+// Add appends a record.
+func (l *Ledger) Add(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, rec)
+	if l.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Query returns the records overlapping [from, to), clipped to that range.
+// An empty tenant matches all tenants.
+func (l *Ledger) Query(from, to time.Time, tenant string) []Record {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []Record
+	for _, rec := range l.records {
+		if tenant != "" && rec.Tenant != tenant {
+			continue
+		}
+		if clipped, ok := Clip(rec, from, to); ok {
+			out = append(out, clipped)
+		}
+	}
+	return out
+}
+
+// Clip restricts a record to [from, to), prorating its bandwidth by the
+// fraction of its runtime inside the range. Storage is attributed to the
+// period in which the session ended.
+func Clip(rec Record, from, to time.Time) (Record, bool) {
+	if !rec.End.After(from) || !rec.Start.Before(to) {
+		return rec, false
+	}
+	total := rec.End.Sub(rec.Start)
+	clipped := rec
+	if clipped.Start.Before(from) {
+		clipped.Start = from
+	}
+	if clipped.End.After(to) {
+		clipped.End = to
+		clipped.StorageBytes = 0
+	}
+	if total > 0 {
+		clipped.BandwidthBytes = int64(float64(rec.BandwidthBytes) * float64(clipped.End.Sub(clipped.Start)) / float64(total))
+	}
+	return clipped, true
+}
+
+// TenantUsage is the usage of one tenant over a period.
+type TenantUsage struct {
+	Tenant         string  `json:"tenant"`
+	Sessions       int     `json:"sessions"`
+	BrowserMinutes float64 `json:"browser_minutes"`
+	BandwidthBytes int64   `json:"bandwidth_bytes"`
+	StorageBytes   int64   `json:"storage_bytes"`
+}
+
+// Aggregate sums records per tenant, sorted by tenant name.
+func Aggregate(records []Record) []TenantUsage {
+	byTenant := map[string]*TenantUsage{}
+	for _, rec := range records {
+		u := byTenant[rec.Tenant]
+		if u == nil {
+			u = &TenantUsage{Tenant: rec.Tenant}
+			byTenant[rec.Tenant] = u
+		}
+		u.Sessions++
+		u.BrowserMinutes += rec.BrowserMinutes()
+		u.BandwidthBytes += rec.BandwidthBytes
+		u.StorageBytes += rec.StorageBytes
+	}
+
+	out := make([]TenantUsage, 0, len(byTenant))
+	for _, u := range byTenant {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tenant < out[j].Tenant })
+	return out
+}
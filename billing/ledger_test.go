@@ -0,0 +1,45 @@
+package billing
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedgerQueryAndAggregate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	l, err := OpenLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	l.Add(Record{Tenant: "a", SessionID: "1", Start: day.Add(-time.Hour), End: day.Add(time.Hour), BandwidthBytes: 200, StorageBytes: 10})
+	l.Add(Record{Tenant: "a", SessionID: "2", Start: day.Add(2 * time.Hour), End: day.Add(3 * time.Hour), BandwidthBytes: 50})
+	l.Add(Record{Tenant: "b", SessionID: "3", Start: day.Add(-3 * time.Hour), End: day.Add(-2 * time.Hour)})
+
+	// Reopening must load the persisted records.
+	l, err = OpenLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage := Aggregate(l.Query(day, day.Add(24*time.Hour), ""))
+	if len(usage) != 1 {
+		t.Fatalf("got %d tenants, want 1: %+v", len(usage), usage)
+	}
+	u := usage[0]
+	if u.Tenant != "a" || u.Sessions != 2 {
+		t.Errorf("unexpected usage %+v", u)
+	}
+	if u.BrowserMinutes != 120 {
+		t.Errorf("browser minutes = %v, want 120", u.BrowserMinutes)
+	}
+	// Half of session 1 falls inside the range.
+	if u.BandwidthBytes != 150 {
+		t.Errorf("bandwidth = %d, want 150", u.BandwidthBytes)
+	}
+	if u.StorageBytes != 10 {
+		t.Errorf("storage = %d, want 10", u.StorageBytes)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// ResponseBodiesResponse lists the capture patterns of a session and the
+// bodies captured so far.
+type ResponseBodiesResponse struct {
+	URLPatterns []string               `json:"url_patterns"`
+	Bodies      []session.CapturedBody `json:"bodies"`
+}
+
+// responseBodiesHandler lists the captured response bodies of a session
+// or, for PUT, replaces its URL patterns first.
+// GET, PUT /sessions/{id}/response-bodies
+func responseBodiesHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			URLPatterns []string `json:"url_patterns"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := sess.SetResponseBodyPatterns(req.URLPatterns); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ResponseBodiesResponse{
+		URLPatterns: sess.ResponseBodyPatterns(),
+		Bodies:      sess.CapturedBodies(),
+	})
+}
+
+// responseBodyHandler returns a captured response body as it was received.
+// It is served as a download so captured pages cannot run in the API's
+// origin.
+// GET /sessions/{id}/response-bodies/{requestId}
+func responseBodyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sess, ok := requestSessions(r).GetSession(vars["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	b, data, ok := sess.CapturedBody(vars["requestId"])
+	if !ok {
+		http.Error(w, "No captured body for this request", http.StatusNotFound)
+		return
+	}
+
+	if b.MimeType != "" {
+		w.Header().Set("Content-Type", b.MimeType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Response-URL", b.URL)
+	w.Header().Set("X-Response-Status", strconv.Itoa(b.Status))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -25,6 +25,56 @@ build_app() {
     fi
 }
 
+# Function to run the proxy and streaming benchmarks against a synthetic
+# browser, saving the results by commit and comparing them with a baseline
+run_benchmarks() {
+    BENCH_DIR="$RUNTIME_DIR/bench"
+    mkdir -p "$BENCH_DIR"
+    REV=$(git rev-parse --short HEAD 2>/dev/null || date +%Y%m%d%H%M%S)
+    OUT="$BENCH_DIR/$REV.txt"
+    echo "Running benchmarks (${BENCH_COUNT:-6} runs each), saving to $OUT..."
+    if ! go test -run '^$' -bench "${BENCH:-.}" -benchmem -count "${BENCH_COUNT:-6}" \
+        ./proxy ./session ./internal/... | tee "$OUT"; then
+        echo "Benchmarks failed"
+        return 1
+    fi
+    if [ -n "$1" ]; then
+        BASE="$1"
+        [ -f "$BASE" ] || BASE="$BENCH_DIR/$1.txt"
+        if command -v benchstat > /dev/null 2>&1; then
+            benchstat "$BASE" "$OUT"
+        else
+            echo "Install benchstat (go install golang.org/x/perf/cmd/benchstat@latest) to compare with $BASE"
+        fi
+    fi
+}
+
+# Function to fuzz the parsers of browser and client input, each target for
+# a while in turn, since Go fuzzes one target at a time
+run_fuzzing() {
+    FUZZTIME="${1:-${FUZZTIME:-30s}}"
+    for PKG in . ./session ./internal/cdp; do
+        for TARGET in $(go test -list '^Fuzz' "$PKG" | grep '^Fuzz'); do
+            echo "Fuzzing $TARGET in $PKG for $FUZZTIME..."
+            if ! go test -run '^$' -fuzz "^$TARGET\$" -fuzztime "$FUZZTIME" "$PKG"; then
+                echo "$TARGET failed; the failing input is saved in $PKG/testdata/fuzz/$TARGET"
+                return 1
+            fi
+        done
+    done
+}
+
+# Function to run the tests under the race detector, several times over so
+# that races between concurrent requests get a chance to show
+run_race_tests() {
+    COUNT="${1:-${RACE_COUNT:-3}}"
+    echo "Running the tests under the race detector ($COUNT runs each)..."
+    if ! go test -race -count "$COUNT" $(go list ./... | grep -v '/test$'); then
+        echo "Race tests failed"
+        return 1
+    fi
+}
+
 # Function to ensure runtime directories exist
 ensure_runtime_dirs() {
     if [ ! -d "$RUNTIME_DIR" ]; then
@@ -389,6 +439,15 @@ case "$1" in
     build)
         build_app
         ;;
+    bench)
+        run_benchmarks "$2"
+        ;;
+    fuzz)
+        run_fuzzing "$2"
+        ;;
+    race)
+        run_race_tests "$2"
+        ;;
     cleanup)
         echo "Cleaning up all browser-server processes and PID files..."
         stop_all
@@ -411,6 +470,9 @@ case "$1" in
         echo "  url           - Show current access URLs"
         echo "  logs {app|funnel} - Follow logs for app or funnel"
         echo "  build         - Build the application only"
+        echo "  bench [base]  - Run the benchmarks, comparing with a baseline commit or file"
+        echo "  fuzz [time]   - Fuzz the CDP, screencast and SDP parsers, each for time (30s)"
+        echo "  race [count]  - Run the tests under the race detector, count times (3)"
         echo "  cleanup       - Kill all processes and remove PID files"
         echo ""
         echo "Examples:"
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// browserLogsHandler returns the Chrome log of a running session, or its
+// last lines with ?tail=N. X-Crash-Dumps carries the number of crash dumps
+// written so far; they are added to the artifact bundle when the session
+// ends.
+// GET /sessions/{id}/browser-logs
+func browserLogsHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	tail := 0
+	if v := r.URL.Query().Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "tail must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		tail = n
+	}
+
+	text, err := sess.BrowserLog()
+	if err != nil {
+		http.Error(w, "Failed to read browser log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if tail > 0 {
+		lines := strings.SplitAfter(text, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) > tail {
+			lines = lines[len(lines)-tail:]
+		}
+		text = strings.Join(lines, "")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Crash-Dumps", strconv.Itoa(len(sess.CrashDumps())))
+	w.Write([]byte(text))
+}
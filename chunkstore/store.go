@@ -0,0 +1,305 @@
+// Package chunkstore keeps directory trees as content-addressed chunks, so
+// that files, and parts of files, that several trees share are stored
+// once. Session snapshots taken from the same starting point mostly share
+// their browser profile.
+package chunkstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ChunkSize is the size files are cut into. Databases such as SQLite
+// rewrite pages in place, so fixed-size chunks of a changed file still
+// mostly match the chunks of the original.
+const ChunkSize = 256 << 10
+
+// Manifest lists the files of a tree and the chunks they are made of.
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+// File is a regular file or directory of a tree.
+type File struct {
+	// Path is slash-separated and relative to the root of the tree.
+	Path string      `json:"path"`
+	Mode fs.FileMode `json:"mode"`
+	Size int64       `json:"size,omitempty"`
+	// Chunks are the hex SHA-256 of each ChunkSize part of the file.
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+// Size returns the total size of the tree's files.
+func (m *Manifest) Size() int64 {
+	var n int64
+	for _, f := range m.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// Stats describe what a store holds on disk.
+type Stats struct {
+	Chunks int   `json:"chunks"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// Store keeps chunks as files named by their hash in a directory. It
+// counts the manifests referencing each chunk, and removes chunks when
+// no manifest does any more.
+type Store struct {
+	dir string
+
+	mu    sync.Mutex
+	refs  map[string]int
+	sizes map[string]int64
+}
+
+// Open opens the store in dir, creating it if needed. Chunks on disk are
+// kept until Prune, so that Retain can be called for the manifests saved
+// elsewhere first.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, refs: make(map[string]int), sizes: make(map[string]int64)}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(path, ".tmp") {
+			return os.Remove(path)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.sizes[d.Name()] = info.Size()
+		return nil
+	})
+	return s, err
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Put stores the regular files and directories under root and returns
+// their manifest, and how many bytes of new chunks it took. The manifest
+// is retained until Release.
+func (s *Store) Put(root string) (*Manifest, int64, error) {
+	m := &Manifest{}
+	var added int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := File{Path: filepath.ToSlash(rel), Mode: info.Mode() & (fs.ModeDir | fs.ModePerm)}
+		if d.Type().IsRegular() {
+			f.Size = info.Size()
+			f.Chunks, err = s.putFile(path, &added)
+			if err != nil {
+				return err
+			}
+		} else if !d.IsDir() {
+			return nil
+		}
+		m.Files = append(m.Files, f)
+		return nil
+	})
+	if err != nil {
+		s.Release(m)
+		return nil, 0, err
+	}
+	return m, added, nil
+}
+
+// putFile stores the chunks of a file and retains them. On failure, the
+// chunks retained so far are released.
+func (s *Store) putFile(path string, added *int64) (hashes []string, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	defer func() {
+		if err != nil {
+			s.Release(&Manifest{Files: []File{{Chunks: hashes}}})
+		}
+	}()
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			hash := hex.EncodeToString(sum[:])
+			isNew, werr := s.retainChunk(hash, buf[:n])
+			if werr != nil {
+				return hashes, werr
+			}
+			if isNew {
+				*added += int64(n)
+			}
+			hashes = append(hashes, hash)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return hashes, err
+		}
+	}
+}
+
+// retainChunk counts a reference to a chunk, writing it if the store does
+// not have it yet, and reports whether it did.
+func (s *Store) retainChunk(hash string, data []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sizes[hash]; ok {
+		s.refs[hash]++
+		return false, nil
+	}
+	path := s.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return false, err
+	}
+	s.sizes[hash] = int64(len(data))
+	s.refs[hash]++
+	return true, nil
+}
+
+// Retain counts the references of a manifest saved before the store was
+// opened. It fails if a chunk is missing.
+func (s *Store) Retain(m *Manifest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range m.Files {
+		for _, hash := range f.Chunks {
+			if _, ok := s.sizes[hash]; !ok {
+				return fmt.Errorf("chunk %s of %s is missing", hash, f.Path)
+			}
+		}
+	}
+	for _, f := range m.Files {
+		for _, hash := range f.Chunks {
+			s.refs[hash]++
+		}
+	}
+	return nil
+}
+
+// Release drops the references of a manifest, removing the chunks no
+// other manifest uses.
+func (s *Store) Release(m *Manifest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range m.Files {
+		for _, hash := range f.Chunks {
+			if s.refs[hash]--; s.refs[hash] <= 0 {
+				delete(s.refs, hash)
+				delete(s.sizes, hash)
+				os.Remove(s.path(hash))
+			}
+		}
+	}
+}
+
+// Prune removes the chunks no retained manifest references, such as
+// those of manifests lost in a crash, and returns how many it removed.
+func (s *Store) Prune() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for hash := range s.sizes {
+		if s.refs[hash] == 0 {
+			delete(s.sizes, hash)
+			os.Remove(s.path(hash))
+			n++
+		}
+	}
+	return n
+}
+
+// Stats returns the number and total size of the stored chunks.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{Chunks: len(s.sizes)}
+	for _, n := range s.sizes {
+		st.Bytes += n
+	}
+	return st
+}
+
+// Restore writes the tree of a manifest into dst.
+func (s *Store) Restore(m *Manifest, dst string) error {
+	for _, f := range m.Files {
+		path := filepath.Join(dst, filepath.FromSlash(f.Path))
+		if !strings.HasPrefix(path, filepath.Clean(dst)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path %q", f.Path)
+		}
+		if f.Mode.IsDir() {
+			if err := os.MkdirAll(path, f.Mode.Perm()|0700); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.restoreFile(f, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) restoreFile(f File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, f.Mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	for _, hash := range f.Chunks {
+		in, err := os.Open(s.path(hash))
+		if errors.Is(err, fs.ErrNotExist) {
+			out.Close()
+			return fmt.Errorf("chunk %s of %s is missing", hash, f.Path)
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
@@ -0,0 +1,116 @@
+package chunkstore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestPutDeduplicates(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := bytes.Repeat([]byte("a"), ChunkSize)
+	big = append(big, bytes.Repeat([]byte("b"), ChunkSize)...)
+	m1, added, err := s.Put(writeTree(t, map[string][]byte{"Default/Cookies": big, "Local State": []byte("{}")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != int64(len(big))+2 || m1.Size() != added {
+		t.Errorf("first Put added %d bytes of %d", added, m1.Size())
+	}
+
+	// Only the changed chunk of the changed file is new.
+	changed := append([]byte{}, big...)
+	changed[len(changed)-1] = 'c'
+	m2, added, err := s.Put(writeTree(t, map[string][]byte{"Default/Cookies": changed, "Local State": []byte("{}")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != ChunkSize {
+		t.Errorf("second Put added %d bytes, want %d", added, ChunkSize)
+	}
+	if st := s.Stats(); st.Chunks != 4 || st.Bytes != 3*ChunkSize+2 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	s.Release(m1)
+	if st := s.Stats(); st.Chunks != 3 {
+		t.Errorf("after Release, stats = %+v", st)
+	}
+	dst := t.TempDir()
+	if err := s.Restore(m2, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "Default", "Cookies")); !bytes.Equal(data, changed) {
+		t.Errorf("restored %d bytes, want %d", len(data), len(changed))
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "Local State")); string(data) != "{}" {
+		t.Errorf("restored Local State = %q", data)
+	}
+}
+
+func TestOpenRetainPrune(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, _, err := s.Put(writeTree(t, map[string][]byte{"a": []byte("kept")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, _, err := s.Put(writeTree(t, map[string][]byte{"a": []byte("lost")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, kept.Files[0].Chunks[0][:2], "x.tmp"), nil, 0600)
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Retain(kept); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Prune(); n != 1 {
+		t.Errorf("Prune removed %d chunks, want 1", n)
+	}
+	if err := s.Retain(lost); err == nil {
+		t.Error("Retain succeeded with a pruned chunk")
+	}
+	if err := s.Restore(kept, t.TempDir()); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, kept.Files[0].Chunks[0][:2], "x.tmp")); !os.IsNotExist(err) {
+		t.Error("temporary file not removed")
+	}
+}
+
+func TestRestoreRejectsEscapingPaths(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{Files: []File{{Path: "../outside", Mode: 0600}}}
+	if err := s.Restore(m, t.TempDir()); err == nil {
+		t.Error("Restore wrote outside the destination")
+	}
+}
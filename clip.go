@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	defaultClipWidth = 640
+	maxClipWidth     = 1280
+	// maxClipFrames bounds the work a clip takes; longer histories are
+	// sampled evenly.
+	maxClipFrames = 300
+	// lastClipFrameDelay is how long the last frame of a clip shows.
+	lastClipFrameDelay = 500 * time.Millisecond
+)
+
+// ClipRequest asks for the last seconds of a session's rewind history as
+// a short animation.
+type ClipRequest struct {
+	// Seconds defaults to the whole rewind window.
+	Seconds int `json:"seconds,omitempty"`
+	// Format is "gif" (the default) or "mp4".
+	Format string `json:"format,omitempty"`
+	// Width in pixels, 640 by default; the height follows.
+	Width int `json:"width,omitempty"`
+}
+
+func (req *ClipRequest) validate() error {
+	if req.Seconds < 0 {
+		return fmt.Errorf("seconds must be positive")
+	}
+	if req.Width < 0 || req.Width > maxClipWidth {
+		return fmt.Errorf("width must be between 1 and %d", maxClipWidth)
+	}
+	switch req.Format {
+	case "", "gif", "mp4":
+		return nil
+	}
+	return fmt.Errorf("format must be gif or mp4")
+}
+
+// sampleFrames keeps at most n frames, evenly spread.
+func sampleFrames(frames []session.Frame, n int) []session.Frame {
+	if len(frames) <= n {
+		return frames
+	}
+	out := make([]session.Frame, n)
+	for i := range out {
+		out[i] = frames[i*len(frames)/n]
+	}
+	return out
+}
+
+// clipDelays returns how long each frame shows: until the next was taken.
+func clipDelays(frames []session.Frame) []time.Duration {
+	delays := make([]time.Duration, len(frames))
+	for i := range frames {
+		if i+1 < len(frames) {
+			delays[i] = frames[i+1].Time.Sub(frames[i].Time)
+		} else {
+			delays[i] = lastClipFrameDelay
+		}
+	}
+	return delays
+}
+
+// encodeGIF renders frames width pixels wide into a looping animated GIF.
+// Frames that cannot be decoded are skipped, the one before showing on.
+func encodeGIF(w io.Writer, frames []session.Frame, width int) error {
+	anim := &gif.GIF{}
+	delays := clipDelays(frames)
+	// GIF delays are in hundredths of a second.
+	hundredths := func(d time.Duration) int { return int(d / (10 * time.Millisecond)) }
+	for i, f := range frames {
+		src, err := jpeg.Decode(bytes.NewReader(f.Data))
+		if err != nil {
+			if n := len(anim.Delay); n > 0 {
+				anim.Delay[n-1] += hundredths(delays[i])
+			}
+			continue
+		}
+		b := src.Bounds()
+		height := max(1, b.Dy()*width/max(1, b.Dx()))
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		xdraw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), src, b, draw.Src, nil)
+		img := image.NewPaletted(scaled.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(img, img.Bounds(), scaled, image.Point{})
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, max(2, hundredths(delays[i])))
+	}
+	if len(anim.Image) == 0 {
+		return fmt.Errorf("no frame could be decoded")
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// encodeMP4 renders frames width pixels wide into an H.264 MP4 with ffmpeg,
+// at their average frame rate.
+func encodeMP4(ctx context.Context, w io.Writer, frames []session.Frame, width int) error {
+	tmp, err := os.CreateTemp("", "browser-lab-clip-*.mp4")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	fps := 1.0
+	if span := frames[len(frames)-1].Time.Sub(frames[0].Time); len(frames) > 1 && span > 0 {
+		fps = float64(len(frames)-1) / span.Seconds()
+	}
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-f", "mjpeg", "-framerate", strconv.FormatFloat(fps, 'f', 3, 64), "-i", "pipe:0",
+		"-vf", fmt.Sprintf("scale=%d:-2", width&^1),
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart",
+		"-f", "mp4", tmp.Name(),
+	)
+	var stdin bytes.Buffer
+	for _, f := range frames {
+		stdin.Write(f.Data)
+	}
+	cmd.Stdin = &stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// clipHandler renders the last seconds of a session's rewind history into
+// an animated GIF or a short MP4, for bug reports and chat.
+// POST /sessions/{id}/clip
+func clipHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	var req ClipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window := sess.RewindWindow()
+	if window == 0 {
+		http.Error(w, "Session keeps no rewind history; create it with rewind_seconds", http.StatusConflict)
+		return
+	}
+	d := window
+	if s := time.Duration(req.Seconds) * time.Second; s > 0 && s < window {
+		d = s
+	}
+	frames := sampleFrames(sess.Rewind(d), maxClipFrames)
+	if len(frames) == 0 {
+		http.Error(w, "No frames in the rewind history yet", http.StatusConflict)
+		return
+	}
+	width := req.Width
+	if width == 0 {
+		width = defaultClipWidth
+	}
+
+	// Render first, so failures can still be reported.
+	var out bytes.Buffer
+	var err error
+	contentType, ext := "image/gif", "gif"
+	if req.Format == "mp4" {
+		if _, lookErr := exec.LookPath(ffmpegPath); lookErr != nil {
+			http.Error(w, "MP4 clips need ffmpeg, which is not installed", http.StatusServiceUnavailable)
+			return
+		}
+		contentType, ext = "video/mp4", "mp4"
+		err = encodeMP4(r.Context(), &out, frames, width)
+	} else {
+		err = encodeGIF(&out, frames, width)
+	}
+	if err != nil {
+		http.Error(w, "Failed to render clip: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-clip.%s"`, sess.ID, ext))
+	w.Write(out.Bytes())
+}
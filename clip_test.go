@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"browser-server/session"
+)
+
+func testJPEG(t *testing.T, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeGIF(t *testing.T) {
+	start := time.Now()
+	frames := []session.Frame{
+		{Data: testJPEG(t, color.White), Time: start},
+		{Data: []byte("not a jpeg"), Time: start.Add(100 * time.Millisecond)},
+		{Data: testJPEG(t, color.Black), Time: start.Add(300 * time.Millisecond)},
+	}
+	var buf bytes.Buffer
+	if err := encodeGIF(&buf, frames, 64); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 2 {
+		t.Fatalf("%d frames, want 2", len(anim.Image))
+	}
+	if b := anim.Image[0].Bounds(); b.Dx() != 64 || b.Dy() != 32 {
+		t.Errorf("frame size %v, want 64x32", b.Size())
+	}
+	if anim.Delay[0] != 30 || anim.Delay[1] != 50 {
+		t.Errorf("delays = %v, want [30 50]", anim.Delay)
+	}
+}
+
+func TestSampleFrames(t *testing.T) {
+	frames := make([]session.Frame, 10)
+	for i := range frames {
+		frames[i].Seq = uint64(i)
+	}
+	got := sampleFrames(frames, 5)
+	if len(got) != 5 || got[0].Seq != 0 || got[4].Seq != 8 {
+		t.Errorf("sampled %v", got)
+	}
+	if len(sampleFrames(frames, 20)) != 10 {
+		t.Error("short history sampled")
+	}
+}
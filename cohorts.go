@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/auth"
+	"browser-server/session"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxCohortSize = 100
+	// cohortRetention is how long a cohort is kept after its sessions
+	// expired, so its final statuses can still be read.
+	cohortRetention = 24 * time.Hour
+)
+
+// Cohort is a group of identical sessions, one per member, e.g. one per
+// student of a class.
+type Cohort struct {
+	ID        string
+	Name      string
+	Owner     string
+	CreatedAt time.Time
+	// Control lets members drive their session through their share link.
+	Control bool
+	Members []CohortMember
+}
+
+// CohortMember is one member of a cohort and the session made for them.
+type CohortMember struct {
+	Name      string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+var (
+	cohortsMu sync.Mutex
+	cohorts   = map[string]*Cohort{}
+)
+
+// CreateCohortRequest is the body of POST /cohorts.
+type CreateCohortRequest struct {
+	Name string `json:"name"`
+	// Size is the number of sessions. It defaults to the number of
+	// Members; members left unnamed are called member-1, member-2, ...
+	Size    int      `json:"size"`
+	Members []string `json:"members"`
+	// Template names a template from API_KEYS_FILE that fills the fields
+	// Session leaves unset.
+	Template string               `json:"template"`
+	Session  CreateSessionRequest `json:"session"`
+	// StartURL, if set, is loaded in every session.
+	StartURL string `json:"start_url"`
+	// Control lets members drive their session through their share link;
+	// true by default.
+	Control *bool `json:"control"`
+}
+
+func (req *CreateCohortRequest) validate(sessions *session.Manager) error {
+	if req.Size == 0 {
+		req.Size = len(req.Members)
+	}
+	if req.Size < 1 || req.Size > maxCohortSize {
+		return fmt.Errorf("size must be between 1 and %d", maxCohortSize)
+	}
+	if len(req.Members) > req.Size {
+		return errors.New("more members than size")
+	}
+	seen := make(map[string]bool)
+	for _, m := range req.Members {
+		if m == "" || len(m) > 64 || strings.ContainsAny(m, ",=") {
+			return fmt.Errorf("invalid member name %q", m)
+		}
+		if seen[m] {
+			return fmt.Errorf("duplicate member name %q", m)
+		}
+		seen[m] = true
+	}
+	if req.StartURL != "" {
+		u, err := url.Parse(req.StartURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New("start_url must be an http(s) URL")
+		}
+	}
+	return req.Session.validate(sessions)
+}
+
+// memberNames returns the name of every member, numbering the unnamed.
+func (req *CreateCohortRequest) memberNames() []string {
+	names := append([]string(nil), req.Members...)
+	taken := make(map[string]bool)
+	for _, n := range names {
+		taken[n] = true
+	}
+	for i := 1; len(names) < req.Size; i++ {
+		if n := "member-" + strconv.Itoa(i); !taken[n] {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// applyTemplate fills the fields req leaves unset from t.
+func applyTemplate(req *CreateSessionRequest, t auth.Template) {
+	if req.DurationMinutes <= 0 {
+		req.DurationMinutes = t.DurationMinutes
+	}
+	if req.Stealth == nil {
+		stealth := t.Stealth
+		req.Stealth = &stealth
+	}
+	if len(req.AllowedDomains) == 0 {
+		req.AllowedDomains = t.AllowedDomains
+	}
+}
+
+// createCohortHandler creates one session per member from the same
+// settings and returns the cohort with a share link per member.
+// POST /cohorts
+func createCohortHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateCohortRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Template != "" {
+		store := requestKeyStore(r)
+		if store == nil {
+			http.Error(w, "unknown template "+strconv.Quote(req.Template), http.StatusBadRequest)
+			return
+		}
+		t, ok := store.Templates[req.Template]
+		if !ok {
+			http.Error(w, "unknown template "+strconv.Quote(req.Template), http.StatusBadRequest)
+			return
+		}
+		applyTemplate(&req.Session, t)
+	}
+	if err := req.validate(requestSessions(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, release, err := sessionOptions(r, req.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer release()
+
+	c := &Cohort{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		Owner:     opts.Owner,
+		CreatedAt: time.Now(),
+		Control:   req.Control == nil || *req.Control,
+	}
+	var sessions []*session.Session
+	stopAll := func() {
+		for _, s := range sessions {
+			requestSessions(r).DeleteSession(s.ID)
+		}
+	}
+	for _, name := range req.memberNames() {
+		o := opts
+		o.Labels = maps.Clone(opts.Labels)
+		if o.Labels == nil {
+			o.Labels = make(map[string]string)
+		}
+		o.Labels["cohort"] = c.ID
+		o.Labels["cohort_member"] = name
+		sess, err := requestSessions(r).CreateSession(o)
+		if refuseOverLimit(w, err) {
+			stopAll()
+			return
+		}
+		if err == session.ErrDraining || err == session.ErrMemoryPressure {
+			stopAll()
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			stopAll()
+			http.Error(w, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sessions = append(sessions, sess)
+		c.Members = append(c.Members, CohortMember{Name: name, SessionID: sess.ID, ExpiresAt: sess.ExpiresAt})
+	}
+
+	if req.StartURL != "" {
+		var wg sync.WaitGroup
+		for _, s := range sessions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.Navigate(req.StartURL); err != nil {
+					log.Printf("Cohort %s: session %s failed to load %s: %v", c.ID, s.ID, req.StartURL, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	cohortsMu.Lock()
+	pruneCohorts()
+	cohorts[c.ID] = c
+	cohortsMu.Unlock()
+	log.Printf("Cohort %s: created %d sessions for %s", c.ID, len(sessions), c.Owner)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiPrefix+"/cohorts/"+c.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newCohortResponse(r, c))
+}
+
+// pruneCohorts forgets cohorts whose sessions all expired more than
+// cohortRetention ago. cohortsMu must be held.
+func pruneCohorts() {
+	for id, c := range cohorts {
+		expired := true
+		for _, m := range c.Members {
+			if time.Since(m.ExpiresAt) < cohortRetention {
+				expired = false
+				break
+			}
+		}
+		if expired {
+			delete(cohorts, id)
+		}
+	}
+}
+
+// CohortResponse describes a cohort and the current state of its sessions.
+type CohortResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Control   bool      `json:"control"`
+	// States counts the members' sessions by state; sessions that are
+	// gone count as stopped.
+	States  map[string]int         `json:"states"`
+	Healthy int                    `json:"healthy"`
+	Members []CohortMemberResponse `json:"members"`
+}
+
+// CohortMemberResponse is a member's session and the link that opens it.
+// ShareURL is a signed link to the session's embed widget, valid until
+// the session expires.
+type CohortMemberResponse struct {
+	Name      string    `json:"name"`
+	SessionID string    `json:"session_id"`
+	State     string    `json:"state"`
+	Health    string    `json:"health,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ShareURL  string    `json:"share_url,omitempty"`
+}
+
+func newCohortResponse(r *http.Request, c *Cohort) CohortResponse {
+	resp := CohortResponse{
+		ID:        c.ID,
+		Name:      c.Name,
+		Owner:     c.Owner,
+		CreatedAt: c.CreatedAt,
+		Control:   c.Control,
+		States:    make(map[string]int),
+	}
+	for _, m := range c.Members {
+		mr := CohortMemberResponse{Name: m.Name, SessionID: m.SessionID, State: string(session.StateStopped), ExpiresAt: m.ExpiresAt}
+		if s, ok := requestSessions(r).GetSession(m.SessionID); ok {
+			mr.State = string(s.State())
+			mr.Health = s.Health().Status
+			mr.ExpiresAt = s.ExpiresAt
+			mr.ShareURL = embedURL(r, s.ID, c.Control, s.ExpiresAt)
+			if mr.Health == session.HealthHealthy {
+				resp.Healthy++
+			}
+		}
+		resp.States[mr.State]++
+		resp.Members = append(resp.Members, mr)
+	}
+	return resp
+}
+
+// cohortHandler reports the statuses of a cohort's sessions, or stops
+// them all for DELETE.
+// GET, DELETE /cohorts/{id}
+func cohortHandler(w http.ResponseWriter, r *http.Request) {
+	cohortsMu.Lock()
+	c, ok := cohorts[mux.Vars(r)["id"]]
+	cohortsMu.Unlock()
+	if !ok {
+		http.Error(w, "Cohort not found", http.StatusNotFound)
+		return
+	}
+	if !canControlOwner(r, c.Owner) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		for _, m := range c.Members {
+			requestSessions(r).DeleteSession(m.SessionID)
+		}
+		cohortsMu.Lock()
+		delete(cohorts, c.ID)
+		cohortsMu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONWithETag(w, r, newCohortResponse(r, c))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"browser-server/session"
+)
+
+func TestCohortMemberNames(t *testing.T) {
+	req := CreateCohortRequest{Size: 4, Members: []string{"member-2", "alice"}}
+	if err := req.validate(session.NewManager()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"member-2", "alice", "member-1", "member-3"}
+	if got := req.memberNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("memberNames() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []CreateCohortRequest{
+		{},
+		{Size: maxCohortSize + 1},
+		{Size: 1, Members: []string{"a", "b"}},
+		{Members: []string{"a", "a"}},
+		{Members: []string{"a=b"}},
+		{Size: 2, StartURL: "file:///etc/passwd"},
+	} {
+		if err := bad.validate(session.NewManager()); err == nil {
+			t.Errorf("validate(%+v) succeeded", bad)
+		}
+	}
+}
+
+func TestCohortResponseCountsStoppedSessions(t *testing.T) {
+	c := &Cohort{ID: "c", Members: []CohortMember{
+		{Name: "alice", SessionID: "gone-1", ExpiresAt: time.Now()},
+		{Name: "bob", SessionID: "gone-2", ExpiresAt: time.Now()},
+	}}
+	r := httptest.NewRequest("GET", "/v1/cohorts/c", nil)
+	r = r.WithContext(context.WithValue(r.Context(), servicesKey{}, newServices(session.NewManager(), nil)))
+	resp := newCohortResponse(r, c)
+	if resp.States["stopped"] != 2 || resp.Healthy != 0 || resp.Members[0].ShareURL != "" {
+		t.Errorf("response = %+v", resp)
+	}
+}
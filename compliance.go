@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/crawl"
+	"browser-server/events"
+	"browser-server/session"
+)
+
+// Compliance settings (COMPLIANCE_ENFORCE, DENY_DOMAINS_FILE,
+// DENY_DOMAINS_SCOPE, COMPLIANCE_AUDIT_LOG).
+var (
+	// enforceRobots and enforceNofollow turn respect_robots and
+	// respect_nofollow on for every crawl.
+	enforceRobots   bool
+	enforceNofollow bool
+	// denyDomains are never crawled and, with denyAllNavigations, never
+	// visited by any session.
+	denyDomains        []string
+	denyAllNavigations bool
+	complianceLog      *auditLog
+)
+
+// setupCompliance reads the compliance toggles, loads the do-not-visit
+// list and opens the audit log.
+func setupCompliance(sessions *session.Manager) error {
+	for _, v := range splitList(os.Getenv("COMPLIANCE_ENFORCE")) {
+		switch v {
+		case "robots":
+			enforceRobots = true
+		case "nofollow":
+			enforceNofollow = true
+		default:
+			return fmt.Errorf("unknown COMPLIANCE_ENFORCE value %q", v)
+		}
+	}
+	if path := os.Getenv("DENY_DOMAINS_FILE"); path != "" {
+		domains, err := loadDomainList(path)
+		if err != nil {
+			return err
+		}
+		denyDomains = domains
+		log.Printf("Loaded %d denied domains from %s", len(domains), path)
+	}
+	switch scope := os.Getenv("DENY_DOMAINS_SCOPE"); scope {
+	case "", "crawls":
+	case "all":
+		denyAllNavigations = true
+	default:
+		return fmt.Errorf("DENY_DOMAINS_SCOPE must be crawls or all, not %q", scope)
+	}
+	if path := os.Getenv("COMPLIANCE_AUDIT_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+		if err != nil {
+			return err
+		}
+		complianceLog = &auditLog{f: f}
+	}
+	sessions.Observe(complianceObserver{})
+	return nil
+}
+
+// loadDomainList reads one domain or host pattern per line, skipping
+// blank lines and # comments.
+func loadDomainList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var domains []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			domains = append(domains, strings.ToLower(line))
+		}
+	}
+	return domains, sc.Err()
+}
+
+// auditEntry records a URL that was not visited for compliance reasons.
+type auditEntry struct {
+	Time time.Time `json:"time"`
+	// Kind is why: robots, nofollow or denied_domain.
+	Kind      string `json:"kind"`
+	URL       string `json:"url"`
+	Rule      string `json:"rule,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	CrawlID   string `json:"crawl_id,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+}
+
+// auditLog appends entries to a JSON Lines file.
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (l *auditLog) write(e auditEntry) {
+	line, _ := json.Marshal(e)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write the compliance audit log: %v", err)
+	}
+}
+
+// audit records a skipped URL in the audit log, if there is one, and
+// publishes it as a compliance.blocked event.
+func audit(e auditEntry) {
+	e.Time = time.Now()
+	if complianceLog != nil {
+		complianceLog.write(e)
+	}
+	eventBus.Publish(events.Event{
+		Type:      "compliance.blocked",
+		SessionID: e.SessionID,
+		Time:      e.Time,
+		Owner:     e.Owner,
+		Data: map[string]interface{}{
+			"kind":     e.Kind,
+			"url":      e.URL,
+			"rule":     e.Rule,
+			"crawl_id": e.CrawlID,
+			"owner":    e.Owner,
+		},
+	})
+}
+
+// complianceObserver audits the navigations sessions' deny lists block.
+type complianceObserver struct{ session.NopObserver }
+
+func (complianceObserver) SessionBlocked(s *session.Session, b session.Blocked) {
+	audit(auditEntry{Kind: crawl.SkipDenied, URL: b.URL, Rule: b.Rule, SessionID: s.ID, Owner: s.Owner})
+}
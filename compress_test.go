@@ -0,0 +1,65 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                          "",
+		"gzip, deflate, br":         "gzip",
+		"deflate":                   "deflate",
+		"gzip;q=0.5, deflate;q=0.8": "deflate",
+		"gzip;q=0":                  "",
+		"identity":                  "",
+	} {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat(`{"id":"abc"},`, 200)
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, body)
+	}))
+
+	r := httptest.NewRequest("GET", "/?type=application/json", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("ETag") != `W/"v1"` {
+		t.Fatalf("headers = %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != body {
+		t.Errorf("decompressed body mismatch")
+	}
+
+	// Already-compressed content and WebSocket upgrades pass through.
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/?type=application/zip", nil),
+		httptest.NewRequest("GET", "/?type=application/json", nil),
+	} {
+		r.Header.Set("Accept-Encoding", "gzip")
+		if strings.Contains(r.URL.RawQuery, "json") {
+			r.Header.Set("Upgrade", "websocket")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+			t.Errorf("%s: response was compressed", r.URL)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"browser-server/session"
+)
+
+// consentRules extend the built-in consent banner rules.
+var consentRules []session.ConsentRule
+
+// setupConsent loads the consent banner rules in CONSENT_RULES_FILE.
+func setupConsent() error {
+	path := os.Getenv("CONSENT_RULES_FILE")
+	if path == "" {
+		return nil
+	}
+	rules, err := session.LoadConsentRules(path)
+	if err != nil {
+		return err
+	}
+	consentRules = rules
+	log.Printf("Loaded %d consent banner rules from %s", len(rules), path)
+	return nil
+}
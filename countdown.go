@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultCountdown is the countdown mode of sessions whose request does
+// not pick one (SESSION_COUNTDOWN).
+var defaultCountdown string
+
+// setupCountdown reads the default countdown mode.
+func setupCountdown() error {
+	mode := os.Getenv("SESSION_COUNTDOWN")
+	if mode == "" || mode == "off" {
+		return nil
+	}
+	if err := session.ValidateCountdown(mode); err != nil {
+		return err
+	}
+	defaultCountdown = mode
+	return nil
+}
+
+// TTLResponse is how long a session has left.
+type TTLResponse struct {
+	ExpiresAt        time.Time `json:"expires_at"`
+	RemainingSeconds int       `json:"remaining_seconds"`
+	// LeaseExpiresAt is when the session is reclaimed unless its client
+	// sends a heartbeat, for sessions with a lease.
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+}
+
+// ttlHandler reports how long the session has left, for UIs that count
+// down to its expiry.
+// GET /sessions/{id}/ttl
+func ttlHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	resp := TTLResponse{
+		ExpiresAt:        sess.ExpiresAt,
+		RemainingSeconds: int(math.Max(0, math.Round(time.Until(sess.ExpiresAt).Seconds()))),
+	}
+	if sess.HasLease() {
+		t := sess.LeaseExpiresAt()
+		resp.LeaseExpiresAt = &t
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"browser-server/session"
+)
+
+var (
+	// cpuSets are the sets of CPUs sessions may be pinned to, keyed by name
+	// (CPU_SETS).
+	cpuSets map[string]session.CPUSet
+	// defaultCPUSet names the set of sessions that ask for none
+	// (CPU_SET_DEFAULT); empty leaves them unpinned.
+	defaultCPUSet string
+)
+
+// setupCPUSets reads CPU_SETS, such as "interactive=0-3;batch=4-15", and
+// CPU_SET_DEFAULT. It must run after setupLauncher.
+func setupCPUSets() error {
+	v := os.Getenv("CPU_SETS")
+	if v == "" {
+		if os.Getenv("CPU_SET_DEFAULT") != "" {
+			return fmt.Errorf("CPU_SET_DEFAULT needs CPU_SETS")
+		}
+		return nil
+	}
+	sets := make(map[string]session.CPUSet)
+	for _, entry := range strings.Split(v, ";") {
+		name, cpus, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			return fmt.Errorf("CPU_SETS entries must look like name=0-3, not %q", entry)
+		}
+		if _, err := session.ParseCPUList(cpus); err != nil {
+			return err
+		}
+		sets[name] = session.CPUSet{Name: name, CPUs: cpus}
+	}
+	if browserLauncher == nil {
+		if _, err := exec.LookPath("taskset"); err != nil {
+			return fmt.Errorf("pinning local browsers to CPUs needs taskset: %w", err)
+		}
+	}
+	defaultCPUSet = os.Getenv("CPU_SET_DEFAULT")
+	if _, ok := sets[defaultCPUSet]; defaultCPUSet != "" && !ok {
+		return fmt.Errorf("CPU_SET_DEFAULT names unknown CPU set %q", defaultCPUSet)
+	}
+	cpuSets = sets
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Printf("CPU sets: %s", strings.Join(names, ", "))
+	return nil
+}
+
+// cpuSet looks up the set a request selected, or the default one; nil for
+// none.
+func cpuSet(name string) (*session.CPUSet, error) {
+	if name == "" {
+		name = defaultCPUSet
+	}
+	if name == "" {
+		return nil, nil
+	}
+	c, ok := cpuSets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown CPU set %q", name)
+	}
+	return &c, nil
+}
@@ -0,0 +1,593 @@
+// Package crawl crawls sites from a seed URL with a pool of browsers and
+// collects the title and content of every page it reaches.
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/article"
+	"browser-server/internal/wildcard"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Crawl statuses.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusCanceled  = "canceled"
+	StatusFailed    = "failed"
+)
+
+// Content formats.
+const (
+	ContentText     = "text"
+	ContentMarkdown = "markdown"
+	ContentNone     = "none"
+)
+
+// Reasons URLs are skipped.
+const (
+	SkipRobots   = "robots"
+	SkipNofollow = "nofollow"
+	SkipDenied   = "denied_domain"
+)
+
+// maxContentBytes caps the content kept per page.
+const maxContentBytes = 256 << 10
+
+// Page is a document a browser loaded.
+type Page struct {
+	// URL is where the browser ended up after redirects.
+	URL    string
+	Status int
+	HTML   string
+}
+
+// Browser loads pages, normally a session of the pool.
+type Browser interface {
+	Fetch(ctx context.Context, url string) (Page, error)
+}
+
+// Options describe what to crawl.
+type Options struct {
+	Seed string `json:"seed"`
+	// MaxDepth is how many links away from the seed pages are followed.
+	MaxDepth int `json:"max_depth"`
+	// MaxPages stops the crawl after that many pages.
+	MaxPages int `json:"max_pages"`
+	// Include, if set, restricts the crawl to URLs matching one of these
+	// patterns (* and ? wildcards); otherwise it stays on the seed's
+	// host.
+	Include []string `json:"include,omitempty"`
+	// Exclude skips URLs matching one of these patterns.
+	Exclude []string `json:"exclude,omitempty"`
+	// RespectRobots skips URLs robots.txt disallows for UserAgent.
+	RespectRobots bool `json:"respect_robots"`
+	// RespectNofollow does not follow rel="nofollow" links, nor any link
+	// of pages whose robots meta tag says nofollow.
+	RespectNofollow bool   `json:"respect_nofollow"`
+	UserAgent       string `json:"-"`
+	// Content is how each page's content is extracted: ContentText (the
+	// article's text), ContentMarkdown or ContentNone.
+	Content string `json:"content"`
+	// PageTimeout bounds the load of each page.
+	PageTimeout time.Duration `json:"-"`
+	// Delay is the least time between the loads of a host; a longer
+	// robots.txt Crawl-delay wins when RespectRobots is set.
+	Delay time.Duration `json:"-"`
+	// Scheduler, if set, paces the crawl's loads together with those of
+	// other crawls.
+	Scheduler *Scheduler `json:"-"`
+	// Deny skips URLs on these domains and their subdomains (or on hosts
+	// matching patterns with * and ?).
+	Deny []string `json:"-"`
+	// OnSkip, if set, is called for every URL skipped, with one of the
+	// Skip reasons.
+	OnSkip func(url, reason string) `json:"-"`
+}
+
+// Validate checks the seed and the content format.
+func (o Options) Validate() error {
+	u, err := url.Parse(o.Seed)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("seed must be an http(s) URL")
+	}
+	switch o.Content {
+	case "", ContentText, ContentMarkdown, ContentNone:
+	default:
+		return fmt.Errorf("invalid content format %q", o.Content)
+	}
+	for _, p := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if strings.TrimSpace(p) == "" {
+			return errors.New("empty URL pattern")
+		}
+	}
+	return nil
+}
+
+// Result is a crawled page.
+type Result struct {
+	URL string `json:"url"`
+	// FinalURL is set when the page redirected elsewhere.
+	FinalURL   string `json:"final_url,omitempty"`
+	Depth      int    `json:"depth"`
+	Status     int    `json:"status"`
+	Title      string `json:"title,omitempty"`
+	Content    string `json:"content,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	Links      int    `json:"links"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Crawl is a crawl job.
+type Crawl struct {
+	ID    string
+	Owner string
+	opts  Options
+
+	mu         sync.Mutex
+	status     string
+	startedAt  time.Time
+	finishedAt time.Time
+	results    []Result
+	skipped    int
+	err        string
+	cancel     context.CancelFunc
+}
+
+// Report is the JSON view of a crawl.
+type Report struct {
+	ID         string     `json:"id"`
+	Owner      string     `json:"owner,omitempty"`
+	Status     string     `json:"status"`
+	Options    Options    `json:"options"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Pages      int        `json:"pages"`
+	// Skipped counts the links not followed for robots.txt, nofollow or
+	// the deny list.
+	Skipped int      `json:"skipped"`
+	Results []Result `json:"results"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// New creates a crawl that has not started yet.
+func New(id, owner string, opts Options) *Crawl {
+	if opts.Content == "" {
+		opts.Content = ContentText
+	}
+	return &Crawl{ID: id, Owner: owner, opts: opts, status: StatusRunning, startedAt: time.Now()}
+}
+
+// Report returns a snapshot of the crawl's progress.
+func (c *Crawl) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rep := Report{
+		ID:        c.ID,
+		Owner:     c.Owner,
+		Status:    c.status,
+		Options:   c.opts,
+		StartedAt: c.startedAt,
+		Pages:     len(c.results),
+		Skipped:   c.skipped,
+		Results:   append([]Result{}, c.results...),
+		Error:     c.err,
+	}
+	if !c.finishedAt.IsZero() {
+		t := c.finishedAt
+		rep.FinishedAt = &t
+	}
+	return rep
+}
+
+// Cancel stops a running crawl; the pages crawled so far are kept.
+func (c *Crawl) Cancel() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Run crawls breadth-first with one worker per browser until the
+// frontier is exhausted, MaxPages is reached or ctx ends.
+func (c *Crawl) Run(ctx context.Context, browsers []Browser) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+
+	seed, _ := url.Parse(c.opts.Seed)
+	f := newFrontier(ctx, c.opts.MaxPages)
+	f.push([]string{normalize(seed)}, 0)
+	robots := newRobotsCache(c.opts.UserAgent)
+
+	var wg sync.WaitGroup
+	for _, b := range browsers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, ok := f.next()
+				if !ok {
+					return
+				}
+				if _, denied := wildcard.FindHost(c.opts.Deny, item.url); denied {
+					c.skip(item.url, SkipDenied)
+					f.done(nil, 0, false)
+					continue
+				}
+				if c.opts.RespectRobots && !robots.allowed(ctx, b, item.url) {
+					c.skip(item.url, SkipRobots)
+					f.done(nil, 0, false)
+					continue
+				}
+				release, err := c.acquire(ctx, robots, b, item.url)
+				if err != nil {
+					f.done(nil, 0, false)
+					continue
+				}
+				res, links, nofollow := c.visit(ctx, b, item)
+				release()
+				if ctx.Err() != nil && res.Error != "" {
+					// Interrupted, not a result.
+					f.done(nil, 0, false)
+					continue
+				}
+				c.mu.Lock()
+				c.results = append(c.results, res)
+				c.mu.Unlock()
+				if item.depth >= c.opts.MaxDepth {
+					links, nofollow = nil, nil
+				}
+				for _, l := range c.inScope(seed, nofollow) {
+					c.skip(l, SkipNofollow)
+				}
+				f.done(c.inScope(seed, links), item.depth+1, true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finishedAt = time.Now()
+	c.cancel = nil
+	switch {
+	case ctx.Err() != nil && !f.exhausted():
+		c.status = StatusCanceled
+	case len(c.results) > 0 && allFailed(c.results):
+		c.status = StatusFailed
+		c.err = c.results[0].Error
+	default:
+		c.status = StatusCompleted
+	}
+}
+
+// acquire waits for the scheduler to allow loading rawURL.
+func (c *Crawl) acquire(ctx context.Context, robots *robotsCache, b Browser, rawURL string) (func(), error) {
+	if c.opts.Scheduler == nil {
+		return func() {}, ctx.Err()
+	}
+	delay := c.opts.Delay
+	if c.opts.RespectRobots {
+		delay = max(delay, robots.delay(ctx, b, rawURL))
+	}
+	var host string
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+	return c.opts.Scheduler.Acquire(ctx, c.Owner, host, delay)
+}
+
+// skip counts a URL that is not crawled and reports it to OnSkip.
+func (c *Crawl) skip(url, reason string) {
+	c.mu.Lock()
+	c.skipped++
+	c.mu.Unlock()
+	if c.opts.OnSkip != nil {
+		c.opts.OnSkip(url, reason)
+	}
+}
+
+func allFailed(results []Result) bool {
+	for _, r := range results {
+		if r.Error == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// visit loads a page and extracts its title, content and links, setting
+// apart the links RespectNofollow keeps it from following.
+func (c *Crawl) visit(ctx context.Context, b Browser, item frontierItem) (Result, []string, []string) {
+	res := Result{URL: item.url, Depth: item.depth}
+	start := time.Now()
+	pageCtx, cancel := context.WithTimeout(ctx, c.opts.PageTimeout)
+	page, err := b.Fetch(pageCtx, item.url)
+	cancel()
+	res.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil, nil
+	}
+	res.Status = page.Status
+	if page.URL != "" && page.URL != item.url {
+		res.FinalURL = page.URL
+	}
+
+	base, _ := url.Parse(item.url)
+	if u, err := url.Parse(page.URL); err == nil && u.IsAbs() {
+		base = u
+	}
+	doc, err := html.Parse(strings.NewReader(page.HTML))
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil, nil
+	}
+	title, links, nofollow := titleAndLinks(doc, base)
+	res.Title, res.Links = title, len(links)+len(nofollow)
+	if !c.opts.RespectNofollow {
+		links, nofollow = append(links, nofollow...), nil
+	}
+
+	switch c.opts.Content {
+	case ContentText:
+		if a, err := article.Extract(strings.NewReader(page.HTML), base); err == nil {
+			res.Content = a.Text
+		}
+	case ContentMarkdown:
+		res.Content, _ = article.Markdown(strings.NewReader(page.HTML), base, true)
+	}
+	if len(res.Content) > maxContentBytes {
+		res.Content = strings.ToValidUTF8(res.Content[:maxContentBytes], "")
+		res.Truncated = true
+	}
+	return res, links, nofollow
+}
+
+// inScope keeps the links the crawl may follow.
+func (c *Crawl) inScope(seed *url.URL, links []string) []string {
+	var out []string
+	for _, l := range links {
+		u, err := url.Parse(l)
+		if err != nil {
+			continue
+		}
+		if len(c.opts.Include) > 0 {
+			if !matchAny(c.opts.Include, l) {
+				continue
+			}
+		} else if !strings.EqualFold(u.Host, seed.Host) {
+			continue
+		}
+		if matchAny(c.opts.Exclude, l) {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if wildcard.Match(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// titleAndLinks returns the document's title and the http(s) URLs it
+// links to, without fragments and duplicates. URLs only linked with
+// rel="nofollow", or all of them if a robots meta tag says nofollow, are
+// returned apart.
+func titleAndLinks(doc *html.Node, base *url.URL) (string, []string, []string) {
+	var title string
+	var order []string
+	follow := make(map[string]bool)
+	pageNofollow := false
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if title == "" && n.FirstChild != nil {
+					title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				}
+			case atom.Meta:
+				if strings.EqualFold(attrValue(n, "name"), "robots") && hasToken(attrValue(n, "content"), "nofollow", "none") {
+					pageNofollow = true
+				}
+			case atom.A:
+				href := strings.TrimSpace(attrValue(n, "href"))
+				if href == "" {
+					break
+				}
+				if u, err := base.Parse(href); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					l := normalize(u)
+					if _, seen := follow[l]; !seen {
+						order = append(order, l)
+					}
+					follow[l] = follow[l] || !hasToken(attrValue(n, "rel"), "nofollow")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var links, nofollow []string
+	for _, l := range order {
+		if follow[l] && !pageNofollow {
+			links = append(links, l)
+		} else {
+			nofollow = append(nofollow, l)
+		}
+	}
+	return title, links, nofollow
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether a space- or comma-separated list holds one of
+// tokens, ignoring case.
+func hasToken(list string, tokens ...string) bool {
+	for _, t := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		for _, want := range tokens {
+			if strings.EqualFold(t, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalize drops the fragment and lowercases the host, so the same page
+// is not crawled twice.
+func normalize(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	v.RawFragment = ""
+	v.Host = strings.ToLower(v.Host)
+	if v.Path == "" {
+		v.Path = "/"
+	}
+	return v.String()
+}
+
+type frontierItem struct {
+	url   string
+	depth int
+}
+
+// frontier is the breadth-first queue of URLs shared by the workers. It
+// ends once it is empty and no worker is visiting a page that could add
+// to it, or once limit pages were handed out.
+type frontier struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []frontierItem
+	seen    map[string]bool
+	active  int
+	visited int
+	limit   int
+	stopped bool
+}
+
+func newFrontier(ctx context.Context, limit int) *frontier {
+	f := &frontier{ctx: ctx, seen: make(map[string]bool), limit: limit}
+	f.cond = sync.NewCond(&f.mu)
+	context.AfterFunc(ctx, func() {
+		f.mu.Lock()
+		f.stopped = true
+		f.mu.Unlock()
+		f.cond.Broadcast()
+	})
+	return f
+}
+
+func (f *frontier) push(urls []string, depth int) {
+	for _, u := range urls {
+		if !f.seen[u] {
+			f.seen[u] = true
+			f.queue = append(f.queue, frontierItem{u, depth})
+		}
+	}
+}
+
+// next waits for a URL to visit.
+func (f *frontier) next() (frontierItem, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for !f.stopped && f.visited+f.active < f.limit && len(f.queue) == 0 && f.active > 0 {
+		f.cond.Wait()
+	}
+	if f.stopped || f.ctx.Err() != nil || f.visited+f.active >= f.limit || len(f.queue) == 0 {
+		return frontierItem{}, false
+	}
+	item := f.queue[0]
+	f.queue = f.queue[1:]
+	f.active++
+	return item, true
+}
+
+// done reports a finished item and queues its links. Items that were not
+// visited do not count towards the limit.
+func (f *frontier) done(links []string, depth int, visited bool) {
+	f.mu.Lock()
+	f.active--
+	if visited {
+		f.visited++
+	}
+	f.push(links, depth)
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// exhausted reports whether the crawl ran out of pages or hit its limit.
+func (f *frontier) exhausted() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active == 0 && (len(f.queue) == 0 || f.visited >= f.limit)
+}
+
+// Store keeps crawls in memory until retention after they finish.
+type Store struct {
+	retention time.Duration
+
+	mu     sync.Mutex
+	crawls map[string]*Crawl
+}
+
+// NewStore creates an empty store.
+func NewStore(retention time.Duration) *Store {
+	return &Store{retention: retention, crawls: make(map[string]*Crawl)}
+}
+
+// Add stores a crawl and forgets expired ones.
+func (st *Store) Add(c *Crawl) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	for id, old := range st.crawls {
+		old.mu.Lock()
+		finished := old.finishedAt
+		old.mu.Unlock()
+		if !finished.IsZero() && now.Sub(finished) > st.retention {
+			delete(st.crawls, id)
+		}
+	}
+	st.crawls[c.ID] = c
+}
+
+// Get returns a stored crawl.
+func (st *Store) Get(id string) (*Crawl, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	c, ok := st.crawls[id]
+	return c, ok
+}
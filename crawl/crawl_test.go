@@ -0,0 +1,336 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBrowser serves pages from a map.
+type fakeBrowser map[string]string
+
+func (b fakeBrowser) Fetch(ctx context.Context, u string) (Page, error) {
+	doc, ok := b[u]
+	if !ok {
+		return Page{URL: u, Status: 404, HTML: "<title>Not found</title>"}, nil
+	}
+	if doc == "error" {
+		return Page{}, errors.New("net::ERR_CONNECTION_REFUSED")
+	}
+	return Page{URL: u, Status: 200, HTML: doc}, nil
+}
+
+func crawledURLs(rep Report) []string {
+	var urls []string
+	for _, r := range rep.Results {
+		urls = append(urls, r.URL)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestCrawl(t *testing.T) {
+	site := fakeBrowser{
+		"https://example.com/":       `<title>Home</title><a href="/a">A</a> <a href="b#top">B</a> <a href="https://other.test/">Other</a> <a href="/private/x">X</a>`,
+		"https://example.com/a":      `<title>A</title><p>The first page, with enough prose to count as an article body.</p><a href="/a/deep">Deep</a>`,
+		"https://example.com/b":      `<title>B</title><a href="/">Home</a> <a href="/broken">Broken</a>`,
+		"https://example.com/a/deep": `<title>Deep</title>`,
+		"https://example.com/broken": "error",
+	}
+	c := New("c1", "alice", Options{
+		Seed:        "https://example.com",
+		MaxDepth:    1,
+		MaxPages:    100,
+		Exclude:     []string{"*/private/*"},
+		PageTimeout: time.Second,
+	})
+	c.Run(context.Background(), []Browser{site, site})
+
+	rep := c.Report()
+	if rep.Status != StatusCompleted || rep.FinishedAt == nil {
+		t.Fatalf("status = %s", rep.Status)
+	}
+	want := []string{"https://example.com/", "https://example.com/a", "https://example.com/b"}
+	if got := crawledURLs(rep); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+	for _, r := range rep.Results {
+		if r.URL == "https://example.com/a" {
+			if r.Title != "A" || r.Status != 200 || r.Depth != 1 || !strings.Contains(r.Content, "The first page") {
+				t.Errorf("result = %+v", r)
+			}
+		}
+	}
+
+	// Deeper, but capped at three pages.
+	c = New("c2", "alice", Options{Seed: "https://example.com/", MaxDepth: 5, MaxPages: 3, Content: ContentNone, PageTimeout: time.Second})
+	c.Run(context.Background(), []Browser{site})
+	if rep := c.Report(); rep.Pages != 3 || rep.Results[0].Content != "" {
+		t.Errorf("capped crawl = %+v", rep)
+	}
+
+	// Include patterns replace the same-host scope.
+	c = New("c3", "alice", Options{Seed: "https://example.com/", MaxDepth: 2, MaxPages: 10, Include: []string{"https://example.com/b*", "https://example.com/broken"}, PageTimeout: time.Second})
+	c.Run(context.Background(), []Browser{site})
+	rep = c.Report()
+	want = []string{"https://example.com/", "https://example.com/b", "https://example.com/broken"}
+	if got := crawledURLs(rep); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+	for _, r := range rep.Results {
+		if r.URL == "https://example.com/broken" && r.Error == "" {
+			t.Errorf("failed load not reported: %+v", r)
+		}
+	}
+}
+
+func TestCrawlCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := New("c", "", Options{Seed: "https://example.com/", MaxPages: 10, PageTimeout: time.Second})
+	c.Run(ctx, []Browser{fakeBrowser{}})
+	if rep := c.Report(); rep.Status != StatusCanceled || rep.Pages != 0 {
+		t.Errorf("canceled crawl = %+v", rep)
+	}
+}
+
+func TestCrawlCompliance(t *testing.T) {
+	site := fakeBrowser{
+		"https://example.com/":        `<title>Home</title><a href="/a">A</a> <a href="/b" rel="nofollow">B</a> <a href="/a" rel="nofollow">A again</a> <a href="https://shop.example.com/">Shop</a>`,
+		"https://example.com/a":       `<meta name="robots" content="noindex, nofollow"><title>A</title><a href="/c">C</a>`,
+		"https://example.com/b":       `<title>B</title>`,
+		"https://example.com/c":       `<title>C</title>`,
+		"https://shop.example.com/":   `<title>Shop</title>`,
+		"https://blocked.example.com": `<title>Blocked</title>`,
+	}
+	var mu sync.Mutex
+	skipped := make(map[string]string)
+	c := New("c", "alice", Options{
+		Seed:            "https://example.com/",
+		MaxDepth:        3,
+		MaxPages:        10,
+		Include:         []string{"https://*example.com/*"},
+		RespectNofollow: true,
+		Deny:            []string{"shop.example.com"},
+		PageTimeout:     time.Second,
+		OnSkip: func(url, reason string) {
+			mu.Lock()
+			skipped[url] = reason
+			mu.Unlock()
+		},
+	})
+	c.Run(context.Background(), []Browser{site})
+
+	rep := c.Report()
+	want := []string{"https://example.com/", "https://example.com/a"}
+	if got := crawledURLs(rep); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+	wantSkipped := map[string]string{
+		"https://example.com/b":     SkipNofollow,
+		"https://example.com/c":     SkipNofollow,
+		"https://shop.example.com/": SkipDenied,
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) || rep.Skipped != len(wantSkipped) {
+		t.Errorf("skipped %v (%d), want %v", skipped, rep.Skipped, wantSkipped)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	robots := parseRobots(strings.NewReader(`
+User-agent: *
+Disallow: /
+
+User-agent: browser-lab
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+`), "browser-lab")
+	for path, want := range map[string]bool{
+		"/":                 true,
+		"/private/x":        false,
+		"/private/open/doc": true,
+		"/files/a.pdf":      false,
+		"/files/a.pdf?x=1":  true,
+	} {
+		u, _ := url.Parse("https://example.com" + path)
+		if got := robots.allowed(u); got != want {
+			t.Errorf("allowed(%s) = %v, want %v", path, got, want)
+		}
+	}
+
+	// robots.txt is fetched in the browser, which shows it as text.
+	const origin = "https://site.test"
+	site := fakeBrowser{
+		origin + "/robots.txt": "<html><head></head><body><pre>User-agent: *\nDisallow: /admin\n</pre></body></html>",
+		origin + "/":           `<a href="/admin">Admin</a><a href="/about">About</a>`,
+		origin + "/about":      `<title>About</title>`,
+		origin + "/admin":      `<title>Admin</title>`,
+	}
+	c := New("c", "", Options{Seed: origin, MaxDepth: 1, MaxPages: 10, RespectRobots: true, UserAgent: "browser-lab", PageTimeout: time.Second})
+	c.Run(context.Background(), []Browser{site})
+	rep := c.Report()
+	if rep.Pages != 2 || rep.Skipped != 1 {
+		t.Errorf("crawled %v, skipped %d", crawledURLs(rep), rep.Skipped)
+	}
+}
+
+// countingBrowser counts the fetches of each URL, which take a while.
+type countingBrowser struct {
+	mu      sync.Mutex
+	fetches map[string]int
+}
+
+func (b *countingBrowser) Fetch(ctx context.Context, u string) (Page, error) {
+	b.mu.Lock()
+	b.fetches[u]++
+	b.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	return Page{URL: u, Status: 200, HTML: "User-agent: *\nDisallow: /admin\n"}, nil
+}
+
+func TestRobotsFetchedOncePerHost(t *testing.T) {
+	b := &countingBrowser{fetches: map[string]int{}}
+	cache := newRobotsCache("browser-lab")
+	var wg sync.WaitGroup
+	for i := range 8 {
+		host := []string{"https://a.test", "https://b.test"}[i%2]
+		wg.Go(func() {
+			if cache.allowed(context.Background(), b, host+"/admin") {
+				t.Errorf("%s/admin allowed", host)
+			}
+		})
+	}
+	wg.Wait()
+	for u, n := range b.fetches {
+		if n != 1 {
+			t.Errorf("%s fetched %d times", u, n)
+		}
+	}
+	if len(b.fetches) != 2 {
+		t.Errorf("fetched %v", b.fetches)
+	}
+}
+
+func TestParseRobotsCrawlDelay(t *testing.T) {
+	r := parseRobots(strings.NewReader("User-agent: *\nCrawl-delay: 2.5\nDisallow: /x\n\nUser-agent: other\nCrawl-delay: 9\n"), "browser-lab")
+	if r.delay != 2500*time.Millisecond {
+		t.Errorf("delay = %v, want 2.5s", r.delay)
+	}
+}
+
+func TestSchedulerHostDelay(t *testing.T) {
+	s := NewScheduler(4, 1, 50*time.Millisecond)
+	ctx := context.Background()
+	var starts []time.Time
+	for range 3 {
+		release, err := s.Acquire(ctx, "a", "example.com", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		starts = append(starts, time.Now())
+		release()
+	}
+	for i := 1; i < len(starts); i++ {
+		if gap := starts[i].Sub(starts[i-1]); gap < 45*time.Millisecond {
+			t.Errorf("loads %d and %d started %v apart", i-1, i, gap)
+		}
+	}
+	// Other hosts are not held back.
+	start := time.Now()
+	release, err := s.Acquire(ctx, "a", "other.example", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if time.Since(start) > 20*time.Millisecond {
+		t.Error("another host waited for example.com's delay")
+	}
+}
+
+func TestSchedulerFairness(t *testing.T) {
+	s := NewScheduler(1, 4, 0)
+	ctx := context.Background()
+	hold, err := s.Acquire(ctx, "a", "a.example", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tenant a queues many loads before b queues one; b must not wait
+	// for all of a's.
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	acquire := func(tenant string) {
+		defer wg.Done()
+		release, err := s.Acquire(ctx, tenant, tenant+".example", 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		order = append(order, tenant)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		release()
+	}
+	for range 5 {
+		wg.Add(1)
+		go acquire("a")
+	}
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.queues["a"]) == 5
+	})
+	wg.Add(1)
+	go acquire("b")
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.queues["b"]) == 1
+	})
+	hold()
+	wg.Wait()
+
+	if i := slices.Index(order, "b"); i < 0 || i > 1 {
+		t.Errorf("order = %v, want b among the first two", order)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s := NewScheduler(1, 1, 0)
+	hold, _ := s.Acquire(context.Background(), "a", "example.com", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "b", "example.com", 0); err == nil {
+		t.Fatal("Acquire succeeded while the only slot was held")
+	}
+	hold()
+	release, err := s.Acquire(context.Background(), "b", "example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if s.active != 0 || len(s.queues) != 0 {
+		t.Errorf("active = %d, queues = %v after all loads finished", s.active, s.queues)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
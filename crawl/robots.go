@@ -0,0 +1,221 @@
+package crawl
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// robotsTimeout bounds the fetch of a robots.txt.
+const robotsTimeout = 10 * time.Second
+
+// robotsRule allows or disallows the paths matching pattern, which re is
+// compiled from.
+type robotsRule struct {
+	pattern string
+	re      *regexp.Regexp
+	allow   bool
+}
+
+// robots are the rules of a robots.txt that apply to one user agent.
+type robots struct {
+	rules []robotsRule
+	// delay is the group's Crawl-delay.
+	delay time.Duration
+}
+
+// parseRobots reads the group of a robots.txt for agent, or the * group
+// if none names it.
+func parseRobots(r io.Reader, agent string) *robots {
+	agent = strings.ToLower(agent)
+	var named, wildcard []robotsRule
+	var namedDelay, wildcardDelay time.Duration
+	var haveNamed bool
+	var inNamed, inWildcard, inRules bool
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if inRules {
+				// A new group starts.
+				inNamed, inWildcard, inRules = false, false, false
+			}
+			v := strings.ToLower(value)
+			if v == "*" {
+				inWildcard = true
+			} else if v != "" && strings.Contains(agent, v) {
+				inNamed, haveNamed = true, true
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// An empty disallow allows everything.
+				continue
+			}
+			rule := robotsRule{pattern: value, re: compileRobotsPattern(value), allow: key == "allow"}
+			if inNamed {
+				named = append(named, rule)
+			}
+			if inWildcard {
+				wildcard = append(wildcard, rule)
+			}
+		case "crawl-delay":
+			inRules = true
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil || secs < 0 {
+				continue
+			}
+			d := time.Duration(secs * float64(time.Second))
+			if inNamed {
+				namedDelay = d
+			}
+			if inWildcard {
+				wildcardDelay = d
+			}
+		default:
+			inRules = inRules || inNamed || inWildcard
+		}
+	}
+	if haveNamed {
+		return &robots{rules: named, delay: namedDelay}
+	}
+	return &robots{rules: wildcard, delay: wildcardDelay}
+}
+
+// allowed applies the longest matching rule to the path and query of u;
+// on a tie, allow wins.
+func (r *robots) allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if n := len(rule.pattern); n > best || n == best && rule.allow {
+			best, allow = n, rule.allow
+		}
+	}
+	return allow
+}
+
+// compileRobotsPattern compiles a robots.txt path pattern, where *
+// matches any characters and a trailing $ anchors the end.
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(pattern, "$")), `\*`, ".*")
+	if strings.HasSuffix(pattern, "$") {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsCache fetches each host's robots.txt once.
+type robotsCache struct {
+	agent string
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+// robotsEntry is a host's robots.txt, available once ready is closed.
+type robotsEntry struct {
+	ready  chan struct{}
+	robots *robots
+}
+
+func newRobotsCache(agent string) *robotsCache {
+	return &robotsCache{agent: agent, hosts: make(map[string]*robotsEntry)}
+}
+
+// allowed reports whether the robots.txt of rawURL's host allows it. A
+// missing or unreachable robots.txt allows everything.
+func (c *robotsCache) allowed(ctx context.Context, b Browser, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return c.get(ctx, b, u).allowed(u)
+}
+
+// delay returns the Crawl-delay the robots.txt of rawURL's host asks for.
+func (c *robotsCache) delay(ctx context.Context, b Browser, rawURL string) time.Duration {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	return c.get(ctx, b, u).delay
+}
+
+// get returns the robots.txt of u's host, fetching it with b if no other
+// worker has. Workers wanting the same host wait for that one fetch;
+// other hosts are not held up by it.
+func (c *robotsCache) get(ctx context.Context, b Browser, u *url.URL) *robots {
+	origin := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	e, ok := c.hosts[origin]
+	if !ok {
+		e = &robotsEntry{ready: make(chan struct{})}
+		c.hosts[origin] = e
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		e.robots = fetchRobots(ctx, b, origin, c.agent)
+		close(e.ready)
+	}
+	select {
+	case <-e.ready:
+		return e.robots
+	case <-ctx.Done():
+		return &robots{}
+	}
+}
+
+// fetchRobots loads origin's robots.txt in b, so that it goes through the
+// session's network, its allowed domains, proxy or Tor, like the pages
+// do. The browser shows a text file as a document of its own, whose text
+// are the rules.
+func fetchRobots(ctx context.Context, b Browser, origin, agent string) *robots {
+	ctx, cancel := context.WithTimeout(ctx, robotsTimeout)
+	defer cancel()
+	page, err := b.Fetch(ctx, origin+"/robots.txt")
+	if err != nil || page.Status != http.StatusOK {
+		return &robots{}
+	}
+	doc, err := html.Parse(strings.NewReader(page.HTML))
+	if err != nil {
+		return &robots{}
+	}
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return parseRobots(io.LimitReader(strings.NewReader(text.String()), 512<<10), agent)
+}
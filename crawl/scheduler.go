@@ -0,0 +1,199 @@
+package crawl
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxCrawlDelay caps the Crawl-delay a robots.txt can ask for.
+const maxCrawlDelay = time.Minute
+
+// Scheduler paces the page loads of all crawls. At most maxActive loads
+// run at once, so crawls leave room for interactive sessions; at most
+// perHost of them hit the same host, and loads of a host start at least
+// its delay apart. When loads are waiting, tenants take turns, so one
+// large crawl cannot starve the crawls of others.
+type Scheduler struct {
+	maxActive int
+	perHost   int
+	minDelay  time.Duration
+
+	mu      sync.Mutex
+	active  int
+	hosts   map[string]*hostSlot
+	queues  map[string][]*waiter
+	tenants []string
+	turn    int
+	timer   *time.Timer
+}
+
+// hostSlot tracks the loads of one host.
+type hostSlot struct {
+	active int
+	// next is when the host's next load may start.
+	next time.Time
+}
+
+type waiter struct {
+	tenant string
+	host   string
+	delay  time.Duration
+	ready  chan struct{}
+}
+
+// NewScheduler creates a scheduler allowing maxActive loads at once,
+// perHost of them per host, started at least minDelay apart.
+func NewScheduler(maxActive, perHost int, minDelay time.Duration) *Scheduler {
+	return &Scheduler{
+		maxActive: max(maxActive, 1),
+		perHost:   max(perHost, 1),
+		minDelay:  minDelay,
+		hosts:     make(map[string]*hostSlot),
+		queues:    make(map[string][]*waiter),
+	}
+}
+
+// Acquire waits until tenant may load a page from host, whose loads must
+// start delay apart (or the scheduler's minimum delay if longer). The
+// returned function must be called once the load is done.
+func (s *Scheduler) Acquire(ctx context.Context, tenant, host string, delay time.Duration) (func(), error) {
+	w := &waiter{tenant: tenant, host: host, delay: min(max(delay, s.minDelay), maxCrawlDelay), ready: make(chan struct{})}
+	s.mu.Lock()
+	if _, ok := s.queues[tenant]; !ok {
+		s.tenants = append(s.tenants, tenant)
+	}
+	s.queues[tenant] = append(s.queues[tenant], w)
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	release := func() { s.release(host) }
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		removed := s.removeLocked(w)
+		s.mu.Unlock()
+		if !removed {
+			// It was granted as ctx ended.
+			release()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Scheduler) release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if h := s.hosts[host]; h != nil {
+		h.active--
+	}
+	s.dispatchLocked()
+}
+
+// dispatchLocked grants waiting loads, taking tenants in turn, and sets
+// a timer for the first host whose delay holds a load back.
+func (s *Scheduler) dispatchLocked() {
+	now := time.Now()
+	for s.active < s.maxActive && len(s.tenants) > 0 {
+		granted := false
+		for i := range len(s.tenants) {
+			idx := (s.turn + i) % len(s.tenants)
+			tenant := s.tenants[idx]
+			q := s.queues[tenant]
+			j := slices.IndexFunc(q, func(w *waiter) bool { return s.eligible(w.host, now) })
+			if j < 0 {
+				continue
+			}
+			w := q[j]
+			s.queues[tenant] = slices.Delete(q, j, j+1)
+			s.grantLocked(w, now)
+			s.turn = idx + 1
+			granted = true
+			break
+		}
+		s.pruneLocked(now)
+		if !granted {
+			break
+		}
+	}
+	s.scheduleLocked(now)
+}
+
+func (s *Scheduler) eligible(host string, now time.Time) bool {
+	h := s.hosts[host]
+	return h == nil || h.active < s.perHost && !now.Before(h.next)
+}
+
+func (s *Scheduler) grantLocked(w *waiter, now time.Time) {
+	h := s.hosts[w.host]
+	if h == nil {
+		h = &hostSlot{}
+		s.hosts[w.host] = h
+	}
+	h.active++
+	h.next = now.Add(w.delay)
+	s.active++
+	close(w.ready)
+}
+
+// pruneLocked forgets tenants with nothing waiting and hosts that are
+// idle and past their delay.
+func (s *Scheduler) pruneLocked(now time.Time) {
+	s.tenants = slices.DeleteFunc(s.tenants, func(t string) bool {
+		if len(s.queues[t]) == 0 {
+			delete(s.queues, t)
+			return true
+		}
+		return false
+	})
+	for host, h := range s.hosts {
+		if h.active == 0 && !now.Before(h.next) {
+			delete(s.hosts, host)
+		}
+	}
+}
+
+// scheduleLocked arranges for dispatch to run again when the earliest
+// delay holding back a waiting load has passed.
+func (s *Scheduler) scheduleLocked(now time.Time) {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.active >= s.maxActive {
+		return
+	}
+	var next time.Time
+	for _, q := range s.queues {
+		for _, w := range q {
+			if h := s.hosts[w.host]; h != nil && h.active < s.perHost && (next.IsZero() || h.next.Before(next)) {
+				next = h.next
+			}
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	s.timer = time.AfterFunc(next.Sub(now), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.dispatchLocked()
+	})
+}
+
+// removeLocked takes a waiter out of its queue, reporting false if it
+// was already granted.
+func (s *Scheduler) removeLocked(w *waiter) bool {
+	q := s.queues[w.tenant]
+	i := slices.Index(q, w)
+	if i < 0 {
+		return false
+	}
+	s.queues[w.tenant] = slices.Delete(q, i, i+1)
+	s.pruneLocked(time.Now())
+	return true
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"browser-server/crawl"
+	"browser-server/internal/wildcard"
+	"browser-server/session"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// crawlRetention is how long finished crawl results are kept.
+	crawlRetention = 24 * time.Hour
+	// crawlUserAgent is the agent robots.txt rules are looked up for.
+	crawlUserAgent   = "browser-lab"
+	maxCrawlDepth    = 10
+	maxCrawlPages    = 5000
+	maxCrawlSessions = 8
+)
+
+var crawlStore = crawl.NewStore(crawlRetention)
+
+// crawlScheduler paces the page loads of all crawls (CRAWL_MAX_LOADS,
+// CRAWL_HOST_CONCURRENCY, CRAWL_DELAY).
+var crawlScheduler = crawl.NewScheduler(4, 1, time.Second)
+
+// setupCrawls reads the crawl scheduler's limits.
+func setupCrawls() error {
+	maxLoads, perHost, delay := 4, 1, time.Second
+	for _, v := range []struct {
+		env string
+		n   *int
+	}{{"CRAWL_MAX_LOADS", &maxLoads}, {"CRAWL_HOST_CONCURRENCY", &perHost}} {
+		if s := os.Getenv(v.env); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return fmt.Errorf("%s must be a positive number", v.env)
+			}
+			*v.n = n
+		}
+	}
+	if s := os.Getenv("CRAWL_DELAY"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid CRAWL_DELAY %q", s)
+		}
+		delay = d
+	}
+	crawlScheduler = crawl.NewScheduler(maxLoads, perHost, delay)
+	return nil
+}
+
+// CreateCrawlRequest is the body of POST /crawls.
+type CreateCrawlRequest struct {
+	crawl.Options
+	// Concurrency is the number of sessions crawling in parallel.
+	Concurrency        int `json:"concurrency"`
+	PageTimeoutSeconds int `json:"page_timeout_seconds"`
+	// CrawlDelaySeconds raises the least time between the loads of a
+	// host above the server's CRAWL_DELAY.
+	CrawlDelaySeconds float64              `json:"crawl_delay_seconds"`
+	Session           CreateSessionRequest `json:"session"`
+	// Webhook, if set, receives the result when the crawl finishes.
+	Webhook *JobWebhook `json:"webhook"`
+}
+
+func (req *CreateCrawlRequest) validate(sessions *session.Manager) error {
+	if err := req.Options.Validate(); err != nil {
+		return err
+	}
+	if req.MaxDepth < 0 || req.MaxDepth > maxCrawlDepth {
+		return fmt.Errorf("max_depth must be between 0 and %d", maxCrawlDepth)
+	}
+	if req.MaxPages < 0 || req.MaxPages > maxCrawlPages {
+		return fmt.Errorf("max_pages must be between 1 and %d", maxCrawlPages)
+	}
+	if req.Concurrency < 0 || req.Concurrency > maxCrawlSessions {
+		return fmt.Errorf("concurrency must be between 1 and %d", maxCrawlSessions)
+	}
+	if req.PageTimeoutSeconds < 0 || req.PageTimeoutSeconds > 120 {
+		return errors.New("page_timeout_seconds must be between 1 and 120")
+	}
+	if req.CrawlDelaySeconds < 0 || req.CrawlDelaySeconds > 60 {
+		return errors.New("crawl_delay_seconds must be between 0 and 60")
+	}
+	if err := req.Webhook.validate(); err != nil {
+		return err
+	}
+	return req.Session.validate(sessions)
+}
+
+// sessionBrowser loads crawled pages in a session.
+type sessionBrowser struct {
+	sess *session.Session
+}
+
+func (b sessionBrowser) Fetch(ctx context.Context, url string) (crawl.Page, error) {
+	res, err := b.sess.Load(ctx, url)
+	if err != nil {
+		return crawl.Page{}, err
+	}
+	// The page may have used up ctx loading; reading it back is quick.
+	readCtx, cancel := context.WithTimeout(b.sess.Context(), 10*time.Second)
+	defer cancel()
+	finalURL, doc, err := b.sess.PageHTML(readCtx)
+	if err != nil {
+		return crawl.Page{}, err
+	}
+	return crawl.Page{URL: finalURL, Status: res.Status, HTML: doc}, nil
+}
+
+// createCrawlHandler starts crawling from a seed URL with a pool of fresh
+// sessions and returns the crawl to poll.
+// POST /crawls
+func createCrawlHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateCrawlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(requestSessions(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, release, err := sessionOptions(r, req.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer release()
+
+	crawlOpts := req.Options
+	if crawlOpts.MaxPages == 0 {
+		crawlOpts.MaxPages = 100
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = 2
+	}
+	crawlOpts.PageTimeout = 30 * time.Second
+	if req.PageTimeoutSeconds > 0 {
+		crawlOpts.PageTimeout = time.Duration(req.PageTimeoutSeconds) * time.Second
+	}
+	crawlOpts.UserAgent = crawlUserAgent
+	crawlOpts.Delay = time.Duration(req.CrawlDelaySeconds * float64(time.Second))
+	crawlOpts.Scheduler = crawlScheduler
+	crawlOpts.RespectRobots = crawlOpts.RespectRobots || enforceRobots
+	crawlOpts.RespectNofollow = crawlOpts.RespectNofollow || enforceNofollow
+	crawlOpts.Deny = denyDomains
+	id := uuid.New().String()
+	if rule, ok := wildcard.FindHost(denyDomains, crawlOpts.Seed); ok {
+		audit(auditEntry{Kind: crawl.SkipDenied, URL: crawlOpts.Seed, Rule: rule, CrawlID: id, Owner: opts.Owner})
+		http.Error(w, "seed is on the do-not-visit list", http.StatusForbidden)
+		return
+	}
+	crawlOpts.OnSkip = func(url, reason string) {
+		audit(auditEntry{Kind: reason, URL: url, CrawlID: id, Owner: opts.Owner})
+	}
+
+	// The pool: one session per worker, stopped when the crawl ends.
+	var sessions []*session.Session
+	stopAll := func() {
+		for _, s := range sessions {
+			requestSessions(r).DeleteSession(s.ID)
+		}
+	}
+	for range req.Concurrency {
+		sess, err := requestSessions(r).CreateSession(opts)
+		if refuseOverLimit(w, err) {
+			stopAll()
+			return
+		}
+		if err == session.ErrDraining || err == session.ErrMemoryPressure {
+			stopAll()
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			stopAll()
+			http.Error(w, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sessions = append(sessions, sess)
+	}
+
+	c := crawl.New(id, sessions[0].Owner, crawlOpts)
+	crawlStore.Add(c)
+	base := externalURL(r)
+	go func() {
+		browsers := make([]crawl.Browser, len(sessions))
+		for i, s := range sessions {
+			browsers[i] = sessionBrowser{s}
+		}
+		c.Run(serverCtx, browsers)
+		rep := c.Report()
+		log.Printf("Crawl %s of %s: %s (%d pages)", c.ID, crawlOpts.Seed, rep.Status, rep.Pages)
+		stopAll()
+
+		failed := 0
+		for _, res := range rep.Results {
+			if res.Error != "" {
+				failed++
+			}
+		}
+		ids := make([]string, len(sessions))
+		for i, s := range sessions {
+			ids[i] = s.ID
+		}
+		jobFinished(JobResult{
+			Type:       "crawl.finished",
+			ID:         c.ID,
+			Owner:      rep.Owner,
+			Status:     rep.Status,
+			StartedAt:  rep.StartedAt,
+			FinishedAt: rep.FinishedAt,
+			Metrics: map[string]interface{}{
+				"pages":       rep.Pages,
+				"failed":      failed,
+				"skipped":     rep.Skipped,
+				"duration_ms": jobDuration(rep.StartedAt, rep.FinishedAt),
+			},
+			Error: rep.Error,
+		}, req.Webhook, base, apiPrefix+"/crawls/"+c.ID, ids)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiPrefix+"/crawls/"+c.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(c.Report())
+}
+
+// crawlHandler reports the progress and results of a crawl, or cancels
+// it for DELETE.
+// GET, DELETE /crawls/{id}
+func crawlHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := crawlStore.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Crawl not found", http.StatusNotFound)
+		return
+	}
+	if !canControlOwner(r, c.Owner) && !signedFor(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		c.Cancel()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONWithETag(w, r, c.Report())
+}
@@ -1,7 +1,60 @@
 const peerConnections = {};
 
+// Server-provided branding and feature flags (see /config.json).
+let config = {
+    branding: {},
+    features: {},
+    default_duration_minutes: 10,
+    api_base_path: "v1",
+};
+
+async function loadConfig() {
+    try {
+        const res = await fetch("config.json");
+        if (res.ok) config = await res.json();
+    } catch (err) {
+        console.error("Failed to load dashboard config:", err);
+    }
+    const b = config.branding;
+    if (b.title) {
+        document.title = b.title;
+        document.getElementById("title").textContent = b.title;
+    }
+    if (b.logo_url) {
+        const logo = document.getElementById("logo");
+        logo.src = b.logo_url;
+        logo.hidden = false;
+    }
+    if (b.accent_color) {
+        document.documentElement.style.setProperty("--accent", b.accent_color);
+    }
+    if (b.footer) {
+        document.getElementById("footer").textContent = b.footer;
+    }
+    const durations = document.getElementById("duration");
+    const choices = [config.default_duration_minutes, ...(config.duration_choices || [])];
+    durations.innerHTML = "";
+    for (const d of [...new Set(choices)].sort((a, b) => a - b)) {
+        const opt = document.createElement("option");
+        opt.value = d;
+        opt.textContent = `${d} min`;
+        opt.selected = d === config.default_duration_minutes;
+        durations.appendChild(opt);
+    }
+    document.getElementById("create").hidden = !enabled("create_sessions");
+}
+
+// enabled reports whether a dashboard feature is on; unknown ones are.
+function enabled(feature) {
+    return config.features[feature] !== false;
+}
+
 async function loadSessions() {
-    const res = await fetch("/sessions");
+    const res = await fetch(`${config.api_base_path}/sessions`);
+    if (res.status === 401) {
+        window.location = "auth/login";
+        return;
+    }
     const sessions = await res.json();
     const tbody = document.querySelector("#sessionsTable tbody");
     tbody.innerHTML = "";
@@ -9,31 +62,35 @@ async function loadSessions() {
     sessions.forEach((s) => {
         const tr = document.createElement("tr");
         tr.innerHTML = `
-            <td>${s.id}</td>
+            <td>${s.id}<br><small title="${s.health.reason || ""}">${s.health.status}</small></td>
             <td>${new Date(s.created_at).toLocaleString()}</td>
             <td>${new Date(s.expires_at).toLocaleString()}</td>
             <td>
-                <button onclick="stopSession('${s.id}')">Stop</button>
-                <a href="${s.cdp_url}" target="_blank">CDP URL</a>
+                ${enabled("stop_sessions") ? `<button onclick="stopSession('${s.id}')">Stop</button>` : ""}
+                ${enabled("cdp_links") ? `<a href="${s.cdp_url}" target="_blank">CDP URL</a>` : ""}
+                <br>
+                ${enabled("navigate") ? `<input id="url-${s.id}" type="url" placeholder="https://example.com">
+                <button onclick="navigateSession('${s.id}')">Go</button>` : ""}
             </td>
             <td>
-                <canvas id="canvas-${s.id}" width="1280" height="720"></canvas>
+                ${enabled("live_preview") ? `<canvas id="canvas-${s.id}" width="1280" height="720"></canvas>
                 <br>
-                <button onclick="startWebRTC('${s.id}')">Start Stream</button>
+                <button onclick="startWebRTC('${s.id}')">Start Stream</button>` : ""}
             </td>
         `;
         tbody.appendChild(tr);
 
         // Auto-start WebRTC
-        startWebRTC(s.id);
+        if (enabled("live_preview")) startWebRTC(s.id);
     });
 }
 
 async function createSession() {
-    await fetch("/sessions", {
+    const duration = Number(document.getElementById("duration").value) || config.default_duration_minutes;
+    await fetch(`${config.api_base_path}/sessions`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ duration_minutes: 10 }),
+        body: JSON.stringify({ duration_minutes: duration }),
     });
     loadSessions();
 }
@@ -65,16 +122,119 @@ async function stopSession(id) {
     }
 
     // Delete browser session
-    await fetch(`/sessions/${id}`, { method: "DELETE" });
+    await fetch(`${config.api_base_path}/sessions/${id}`, { method: "DELETE" });
     loadSessions();
 }
 
+async function navigateSession(id) {
+    const url = document.getElementById(`url-${id}`).value;
+    const res = await fetch(`${config.api_base_path}/sessions/${id}/navigate`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ url }),
+    });
+    if (!res.ok) {
+        alert(await res.text());
+    }
+}
+
+// frameKey makes a key for end-to-end encrypted frames, or returns null
+// where WebCrypto is unavailable (it needs a secure context). The key
+// goes to the server with the offer, never over the WebRTC connection.
+async function frameKey() {
+    if (!window.crypto || !crypto.subtle) return null;
+    const raw = crypto.getRandomValues(new Uint8Array(32));
+    const key = await crypto.subtle.importKey("raw", raw, "AES-GCM", false, ["decrypt"]);
+    return { key, header: btoa(String.fromCharCode(...raw)) };
+}
+
+// openFrame decrypts a frame sealed as its 12-byte nonce and ciphertext.
+function openFrame(e2ee, buffer) {
+    return crypto.subtle.decrypt(
+        { name: "AES-GCM", iv: buffer.subarray(0, 12) },
+        e2ee.key,
+        buffer.subarray(12),
+    );
+}
+
+// remoteControl sends the mouse and keyboard events of a session's canvas
+// on a WHIP "input" data channel, so the preview drives the browser.
+function remoteControl(sessionId, dc, viewport) {
+    const canvas = document.getElementById(`canvas-${sessionId}`);
+    if (!canvas) return;
+    canvas.tabIndex = 0;
+    dc.onmessage = (e) => {
+        const msg = JSON.parse(e.data);
+        if (msg.error) console.error("WHIP: Input failed:", msg.error);
+    };
+
+    const send = (event) => {
+        if (dc.readyState === "open") dc.send(JSON.stringify(event));
+    };
+    // pagePoint maps a mouse event on the canvas to page pixels.
+    const pagePoint = (ev) => {
+        const r = canvas.getBoundingClientRect();
+        const v = viewport();
+        return {
+            x: (ev.clientX - r.left) / r.width * v.width,
+            y: (ev.clientY - r.top) / r.height * v.height,
+        };
+    };
+    const modifiers = (ev) =>
+        (ev.altKey ? 1 : 0) | (ev.ctrlKey ? 2 : 0) | (ev.metaKey ? 4 : 0) | (ev.shiftKey ? 8 : 0);
+    const buttons = ["left", "middle", "right"];
+    let lastMove = 0;
+
+    const mouse = (type, ev) => {
+        if (!viewport()) return;
+        const p = pagePoint(ev);
+        const event = { type, x: p.x, y: p.y, modifiers: modifiers(ev) };
+        if (type === "mouseMoved") {
+            event.button = ev.buttons & 1 ? "left" : "none";
+        } else {
+            event.button = buttons[ev.button] || "none";
+            event.click_count = ev.detail || 1;
+        }
+        send(event);
+    };
+    const key = (type, ev) => {
+        const event = { type, key: ev.key, code: ev.code, modifiers: modifiers(ev) };
+        if (type === "keyDown" && !ev.ctrlKey && !ev.metaKey) {
+            if (ev.key.length === 1) event.text = ev.key;
+            else if (ev.key === "Enter") event.text = "\r";
+        }
+        send(event);
+        ev.preventDefault();
+    };
+
+    canvas.addEventListener("mousedown", (ev) => { canvas.focus(); mouse("mousePressed", ev); ev.preventDefault(); });
+    canvas.addEventListener("mouseup", (ev) => mouse("mouseReleased", ev));
+    canvas.addEventListener("mousemove", (ev) => {
+        const now = performance.now();
+        if (now - lastMove < 50 && !ev.buttons) return;
+        lastMove = now;
+        mouse("mouseMoved", ev);
+    });
+    canvas.addEventListener("wheel", (ev) => {
+        if (!viewport()) return;
+        const p = pagePoint(ev);
+        send({ type: "mouseWheel", x: p.x, y: p.y, delta_x: ev.deltaX, delta_y: ev.deltaY, modifiers: modifiers(ev) });
+        ev.preventDefault();
+    }, { passive: false });
+    canvas.addEventListener("contextmenu", (ev) => ev.preventDefault());
+    canvas.addEventListener("keydown", (ev) => key("keyDown", ev));
+    canvas.addEventListener("keyup", (ev) => key("keyUp", ev));
+}
+
 async function startWebRTC(sessionId) {
     console.log("Starting WHIP session for:", sessionId);
     if (peerConnections[sessionId]) {
         console.log("Peer connection already exists");
         return;
     }
+    const e2ee = await frameKey();
+    // Frames are drawn in order even though decrypting them is async.
+    let drawn = Promise.resolve();
 
     const pc = new RTCPeerConnection({
         iceServers: [
@@ -86,12 +246,19 @@ async function startWebRTC(sessionId) {
 
     // Create Data Channel (Client initiates)
     const dc = pc.createDataChannel("screencast");
+    // The page area the last frame showed, to map input onto.
+    let viewport = null;
+    if (enabled("remote_control")) {
+        remoteControl(sessionId, pc.createDataChannel("input"), () => viewport);
+    }
     dc.onopen = () => console.log("WHIP: Data channel opened");
     dc.onmessage = (e) => {
         if (typeof e.data === "string") {
             const msg = JSON.parse(e.data);
             if (msg.type === "frame-start") {
+                viewport = msg.viewport || viewport;
                 window.currentFrame = {
+                    encrypted: msg.encrypted === true,
                     totalSize: msg.size,
                     receivedSize: 0,
                     buffer: new Uint8Array(msg.size),
@@ -114,30 +281,34 @@ async function startWebRTC(sessionId) {
                 window.currentFrame.totalSize
             ) {
                 // Frame complete
-                const blob = new Blob(
-                    [window.currentFrame.buffer],
-                    { type: "image/jpeg" },
-                );
-                const url = URL.createObjectURL(blob);
-                const img = new Image();
-                img.onload = () => {
-                    const canvas = document.getElementById(
-                        `canvas-${sessionId}`,
-                    );
-                    if (canvas) {
-                        const ctx = canvas.getContext("2d");
-                        ctx.drawImage(
-                            img,
-                            0,
-                            0,
-                            canvas.width,
-                            canvas.height,
-                        );
-                    }
-                    URL.revokeObjectURL(url);
-                };
-                img.src = url;
+                const frame = window.currentFrame;
                 window.currentFrame = null; // Reset
+                if (frame.encrypted && !e2ee) return;
+                const jpeg = frame.encrypted
+                    ? openFrame(e2ee, frame.buffer)
+                    : Promise.resolve(frame.buffer);
+                drawn = drawn.then(() => jpeg).then((data) => {
+                    const blob = new Blob([data], { type: "image/jpeg" });
+                    const url = URL.createObjectURL(blob);
+                    const img = new Image();
+                    img.onload = () => {
+                        const canvas = document.getElementById(
+                            `canvas-${sessionId}`,
+                        );
+                        if (canvas) {
+                            const ctx = canvas.getContext("2d");
+                            ctx.drawImage(
+                                img,
+                                0,
+                                0,
+                                canvas.width,
+                                canvas.height,
+                            );
+                        }
+                        URL.revokeObjectURL(url);
+                    };
+                    img.src = url;
+                }).catch((err) => console.error("WHIP: Failed to decrypt frame:", err));
             }
         }
     };
@@ -194,9 +365,11 @@ async function startWebRTC(sessionId) {
 
     // WHIP Protocol: POST SDP offer with Content-Type: application/sdp
     console.log("WHIP: Sending SDP offer to WHIP endpoint...");
-    const res = await fetch(`/sessions/${sessionId}/whip`, {
+    const headers = { "Content-Type": "application/sdp" };
+    if (e2ee) headers["X-E2EE-Key"] = e2ee.header;
+    const res = await fetch(`${config.api_base_path}/sessions/${sessionId}/whip`, {
         method: "POST",
-        headers: { "Content-Type": "application/sdp" },
+        headers,
         body: pc.localDescription.sdp,
     });
 
@@ -229,4 +402,4 @@ async function startWebRTC(sessionId) {
 
 // Auto-refresh every 10 seconds (less frequent to avoid resetting UI)
 // setInterval(loadSessions, 10000);
-loadSessions();
\ No newline at end of file
+loadConfig().then(loadSessions);
\ No newline at end of file
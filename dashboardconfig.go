@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// dashboardFeatures are the parts of the dashboard operators can turn
+// off. All are on unless the config says otherwise.
+var dashboardFeatures = []string{"create_sessions", "stop_sessions", "navigate", "live_preview", "remote_control", "cdp_links"}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// DashboardBranding is how the dashboard presents itself.
+type DashboardBranding struct {
+	Title string `json:"title,omitempty"`
+	// LogoURL is an http(s) URL or an absolute path on this server.
+	LogoURL string `json:"logo_url,omitempty"`
+	// AccentColor is a hex color such as "#0a84ff".
+	AccentColor string `json:"accent_color,omitempty"`
+	Footer      string `json:"footer,omitempty"`
+}
+
+// DashboardConfig is what the dashboard reads from /config.json to adapt
+// itself without rebuilding its assets.
+type DashboardConfig struct {
+	Branding DashboardBranding `json:"branding"`
+	// Features turns dashboard features on and off by name.
+	Features map[string]bool `json:"features"`
+	// DefaultDurationMinutes is the duration of sessions the dashboard
+	// creates, and DurationChoices the others it offers.
+	DefaultDurationMinutes int   `json:"default_duration_minutes"`
+	DurationChoices        []int `json:"duration_choices,omitempty"`
+	// APIBasePath is where the dashboard finds the API, including any
+	// reverse-proxy prefix. It is filled in per request.
+	APIBasePath string `json:"api_base_path"`
+}
+
+// dashboardConfig is loaded from DASHBOARD_CONFIG_FILE, with
+// DASHBOARD_TITLE overriding its title.
+var dashboardConfig = DashboardConfig{
+	Branding:               DashboardBranding{Title: "Browser Sessions"},
+	DefaultDurationMinutes: 10,
+}
+
+// setupDashboardConfig loads the dashboard's branding and feature flags.
+func setupDashboardConfig() error {
+	cfg := dashboardConfig
+	if path := os.Getenv("DASHBOARD_CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	if v := os.Getenv("DASHBOARD_TITLE"); v != "" {
+		cfg.Branding.Title = v
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	features := make(map[string]bool, len(dashboardFeatures))
+	for _, f := range dashboardFeatures {
+		on, set := cfg.Features[f]
+		features[f] = on || !set
+	}
+	cfg.Features = features
+	dashboardConfig = cfg
+	return nil
+}
+
+func (c DashboardConfig) validate() error {
+	for f := range c.Features {
+		if !slices.Contains(dashboardFeatures, f) {
+			return fmt.Errorf("unknown dashboard feature %q, known: %s", f, strings.Join(dashboardFeatures, ", "))
+		}
+	}
+	if b := c.Branding; b.AccentColor != "" && !hexColor.MatchString(b.AccentColor) {
+		return fmt.Errorf("accent_color must be a hex color like #0a84ff, not %q", b.AccentColor)
+	}
+	if logo := c.Branding.LogoURL; logo != "" {
+		u, err := url.Parse(logo)
+		if err != nil || !(u.Scheme == "https" || u.Scheme == "http" || (u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"))) {
+			return fmt.Errorf("logo_url must be an http(s) URL or an absolute path, not %q", logo)
+		}
+	}
+	if c.DefaultDurationMinutes < 1 {
+		return fmt.Errorf("default_duration_minutes must be positive")
+	}
+	for _, d := range c.DurationChoices {
+		if d < 1 {
+			return fmt.Errorf("duration_choices must be positive")
+		}
+	}
+	return nil
+}
+
+// dashboardConfigHandler serves the dashboard's configuration. It holds
+// nothing secret and is served without sign-in, so the dashboard can
+// brand itself before the user logs in.
+// GET /config.json
+func dashboardConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := dashboardConfig
+	cfg.APIBasePath = forwardedPrefix(r) + apiPrefix
+	w.Header().Add("Vary", "X-Forwarded-Prefix")
+	writeJSONWithETag(w, r, cfg)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDashboardConfig(t *testing.T) {
+	defer func(c DashboardConfig) { dashboardConfig = c }(dashboardConfig)
+
+	path := filepath.Join(t.TempDir(), "dashboard.json")
+	os.WriteFile(path, []byte(`{
+		"branding": {"title": "Acme Lab", "accent_color": "#0a84ff", "logo_url": "/logo.svg"},
+		"features": {"create_sessions": false},
+		"duration_choices": [30, 60]
+	}`), 0o644)
+	t.Setenv("DASHBOARD_CONFIG_FILE", path)
+	t.Setenv("DASHBOARD_TITLE", "")
+	if err := setupDashboardConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/config.json", nil)
+	r.Header.Set("X-Forwarded-Prefix", "/lab")
+	w := httptest.NewRecorder()
+	dashboardConfigHandler(w, r)
+	var got DashboardConfig
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Branding.Title != "Acme Lab" || got.DefaultDurationMinutes != 10 || got.APIBasePath != "/lab/v1" {
+		t.Errorf("config = %+v", got)
+	}
+	if got.Features["create_sessions"] || !got.Features["live_preview"] {
+		t.Errorf("features = %v", got.Features)
+	}
+
+	for _, bad := range []string{
+		`{"features": {"teleport": true}}`,
+		`{"branding": {"accent_color": "red; background: url(x)"}}`,
+		`{"branding": {"logo_url": "javascript:alert(1)"}}`,
+		`{"default_duration_minutes": -1}`,
+	} {
+		os.WriteFile(path, []byte(bad), 0o644)
+		if err := setupDashboardConfig(); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"browser-server/proxy"
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// devtoolsHandler opens the DevTools frontend on one of the session's
+// pages, the first unless ?target= names another. The frontend talks to
+// the page through pageCDPProxyHandler, so it is subject to the same
+// access checks as any other CDP client.
+// GET /sessions/{id}/devtools
+func devtoolsHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	http.Redirect(w, r, devtoolsInspectorURL(r, sess.ID, r.URL.Query().Get("target")), http.StatusFound)
+}
+
+// devtoolsInspectorURL returns the path of the frontend's inspector page
+// pointed at the session's page WebSocket. The frontend adds the scheme
+// itself, choosing it by the name of the parameter.
+func devtoolsInspectorURL(r *http.Request, id, target string) string {
+	wsQuery := url.Values{"token": {sessionToken(id, tokenScopeCDP)}}
+	if target != "" {
+		wsQuery.Set("target", target)
+	}
+	ws := resolveHost(r) + forwardedPrefix(r) + apiPrefix + "/sessions/" + id + "/cdp/page?" + wsQuery.Encode()
+	q := url.Values{resolveWSScheme(r): {ws}}
+	return apiPrefix + "/sessions/" + id + "/devtools/inspector.html?" + q.Encode()
+}
+
+// devtoolsFileHandler serves the DevTools frontend bundled with the
+// session's browser.
+// GET /sessions/{id}/devtools/{path}
+func devtoolsFileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sess, ok := requestSessions(r).GetSession(vars["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	target, err := sess.DevToolsURL()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.Out.URL.Path = "/devtools/" + vars["path"]
+			pr.Out.URL.RawPath = ""
+			// The browser has no use for the client's credentials.
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header.Del("Cookie")
+		},
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// pageCDPProxyHandler proxies a WebSocket to a single page of the session
+// rather than to the browser, as the DevTools frontend expects.
+// GET /sessions/{id}/cdp/page?target=ID
+func pageCDPProxyHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	wsURL, err := sess.PageWSURL(r.URL.Query().Get("target"))
+	if errors.Is(err, session.ErrUnknownPage) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	sess.MarkRunning()
+	proxy.ProxyCDP(ctx, w, r, wsURL, sess.CountCDPBytes)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDevtoolsInspectorURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/sessions/abc/devtools", nil)
+	r.Host = "lab.example.com"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Prefix", "/browser-lab")
+
+	got := devtoolsInspectorURL(r, "abc", "T1")
+	path, query, _ := strings.Cut(got, "?")
+	if path != "/v1/sessions/abc/devtools/inspector.html" {
+		t.Errorf("path = %q", path)
+	}
+	q, _ := url.ParseQuery(query)
+	want := "lab.example.com/browser-lab/v1/sessions/abc/cdp/page?target=T1&token=" + sessionToken("abc", tokenScopeCDP)
+	if ws := q.Get("wss"); ws != want {
+		t.Errorf("wss = %q", ws)
+	}
+	if q.Has("ws") {
+		t.Error("plain ws parameter set for an https request")
+	}
+}
+
+func TestPathParamPattern(t *testing.T) {
+	if got := pathParamRe.ReplaceAllString("/sessions/{id}/devtools/{path:.+}", "{$1}"); got != "/sessions/{id}/devtools/{path}" {
+		t.Errorf("OpenAPI path = %q", got)
+	}
+}
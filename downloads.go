@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// maxDownloadWaitSeconds caps how long a client may wait for a download.
+const maxDownloadWaitSeconds = 300
+
+// nextDownloadHandler waits for the session's page to start a download and
+// streams the file to the client as the browser receives it. It answers
+// 204 if no download starts within ?timeout= seconds (default 60).
+// GET /sessions/{id}/downloads/next
+func nextDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	wait := 60
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDownloadWaitSeconds {
+			http.Error(w, fmt.Sprintf("timeout must be between 1 and %d seconds", maxDownloadWaitSeconds), http.StatusBadRequest)
+			return
+		}
+		wait = n
+	}
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	waitCtx, cancelWait := context.WithTimeout(ctx, time.Duration(wait)*time.Second)
+	defer cancelWait()
+
+	d, err := sess.NextDownload(waitCtx)
+	switch {
+	case errors.Is(err, session.ErrDownloadsNotStreamed):
+		http.Error(w, "Session was not created with stream_downloads", http.StatusConflict)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer d.Close()
+	// Closing the download ends the browser side if the session stops.
+	stop := context.AfterFunc(ctx, func() { d.Close() })
+	defer stop()
+
+	w.Header().Set("Content-Type", d.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": d.Filename}))
+	w.Header().Set("X-Download-URL", d.URL)
+	if d.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(d.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	n, err := io.Copy(w, d)
+	sess.CountStreamBytes(int(n))
+	if err != nil {
+		log.Printf("Downloads: streaming %s of session %s stopped after %d bytes: %v", d.Filename, sess.ID, n, err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// e2eeKeyHeader carries a WHIP viewer's frame key with its offer.
+const e2eeKeyHeader = "X-E2EE-Key"
+
+// whipRequireE2EE rejects WHIP viewers that do not send a frame key
+// (WHIP_REQUIRE_E2EE).
+var whipRequireE2EE bool
+
+// setupE2EE reads WHIP_REQUIRE_E2EE.
+func setupE2EE() error {
+	if v := os.Getenv("WHIP_REQUIRE_E2EE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		whipRequireE2EE = b
+	}
+	return nil
+}
+
+// frameSealer encrypts the frames sent to one WHIP viewer with AES-GCM
+// under the key the viewer sent, so that they can only be read where that
+// key is, not by whatever carries the WebRTC traffic. Each frame becomes
+// its 12-byte nonce followed by the ciphertext; nonces are a random
+// prefix and a counter, so they never repeat under one key.
+type frameSealer struct {
+	aead   cipher.AEAD
+	prefix [4]byte
+
+	mu      sync.Mutex
+	counter uint64
+}
+
+// newFrameSealer returns a sealer for a base64 (standard or URL alphabet,
+// padded or not) 128- or 256-bit AES key.
+func newFrameSealer(encoded string) (*frameSealer, error) {
+	encoded = strings.TrimRight(strings.TrimSpace(encoded), "=")
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("frame key is not base64")
+	}
+	if len(key) != 16 && len(key) != 32 {
+		return nil, fmt.Errorf("frame key must be 128 or 256 bits, not %d", len(key)*8)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s := &frameSealer{aead: aead}
+	if _, err := rand.Read(s.prefix[:]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// seal encrypts a frame.
+func (s *frameSealer) seal(frame []byte) []byte {
+	s.mu.Lock()
+	s.counter++
+	n := s.counter
+	s.mu.Unlock()
+
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(frame)+s.aead.Overhead())
+	copy(nonce, s.prefix[:])
+	binary.BigEndian.PutUint64(nonce[4:], n)
+	return s.aead.Seal(nonce, nonce, frame, nil)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"testing"
+)
+
+func TestFrameSealer(t *testing.T) {
+	for _, key := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(make([]byte, 24))} {
+		if _, err := newFrameSealer(key); err == nil {
+			t.Errorf("key %q accepted", key)
+		}
+	}
+
+	key := bytes.Repeat([]byte{7}, 32)
+	s, err := newFrameSealer(base64.RawURLEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFrameSealer(base64.StdEncoding.EncodeToString(key)); err != nil {
+		t.Errorf("padded standard base64 rejected: %v", err)
+	}
+
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	frame := []byte("jpeg data")
+	first, second := s.seal(frame), s.seal(frame)
+	if bytes.Equal(first[:12], second[:12]) {
+		t.Error("nonce reused")
+	}
+	for _, sealed := range [][]byte{first, second} {
+		got, err := aead.Open(nil, sealed[:12], sealed[12:], nil)
+		if err != nil || !bytes.Equal(got, frame) {
+			t.Errorf("opened %q, %v", got, err)
+		}
+	}
+}
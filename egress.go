@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"browser-server/egress"
+	"browser-server/tunnel"
+)
+
+// egressProfiles are the WireGuard profiles sessions may exit through,
+// keyed by name.
+var egressProfiles map[string]egress.Profile
+
+// setupEgress loads the profiles named in EGRESS_PROFILES_FILE.
+func setupEgress() error {
+	path := os.Getenv("EGRESS_PROFILES_FILE")
+	if path == "" {
+		return nil
+	}
+	profiles, err := egress.LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	egressProfiles = profiles
+	log.Printf("Loaded %d egress profiles from %s", len(profiles), path)
+	return nil
+}
+
+// egressProfile looks up the profile a request selected; nil for none.
+func egressProfile(name string) (*egress.Profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := egressProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown egress profile %q", name)
+	}
+	return &p, nil
+}
+
+// torClient is the Tor client sessions created with "tor" go through, or
+// nil when Tor is not enabled.
+var torClient *tunnel.Tor
+
+// setupTor uses the Tor SOCKS endpoint in TOR_SOCKS_ADDR or, failing
+// that, starts the tor binary named in TOR_BINARY.
+func setupTor() error {
+	if addr := os.Getenv("TOR_SOCKS_ADDR"); addr != "" {
+		t, err := tunnel.ConnectTor(addr)
+		if err != nil {
+			return err
+		}
+		torClient = t
+		log.Printf("Tor sessions go through %s", addr)
+		return nil
+	}
+	if path := os.Getenv("TOR_BINARY"); path != "" {
+		t, err := tunnel.StartTor(serverCtx, path)
+		if err != nil {
+			return err
+		}
+		torClient = t
+		log.Printf("Started tor with its SOCKS port on %s", t.Addr())
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package egress
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// dialIn connects to addr from inside the named network namespace. The
+// socket keeps belonging to that namespace after the thread switches
+// back.
+func dialIn(ns, addr string, timeout time.Duration) (net.Conn, error) {
+	target, err := os.Open(filepath.Join("/run/netns", ns))
+	if err != nil {
+		return nil, err
+	}
+	defer target.Close()
+
+	runtime.LockOSThread()
+	self, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	defer self.Close()
+
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return nil, err
+	}
+	conn, dialErr := net.DialTimeout("tcp", addr, timeout)
+	if err := unix.Setns(int(self.Fd()), unix.CLONE_NEWNET); err != nil {
+		// Leave the thread locked so it exits with the goroutine instead
+		// of running other goroutines in the wrong namespace.
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+	runtime.UnlockOSThread()
+	return conn, dialErr
+}
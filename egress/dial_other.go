@@ -0,0 +1,13 @@
+//go:build !linux
+
+package egress
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+func dialIn(ns, addr string, timeout time.Duration) (net.Conn, error) {
+	return nil, errors.New("egress profiles need Linux network namespaces")
+}
@@ -0,0 +1,227 @@
+// Package egress runs session browsers in their own network namespace
+// whose only way out is a WireGuard tunnel, so different sessions can exit
+// through different VPN endpoints.
+package egress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile is a named WireGuard endpoint sessions can exit through.
+type Profile struct {
+	Name string `json:"-"`
+	// WireGuardConfig is the path of a wg(8) configuration file: the
+	// [Interface] private key and the [Peer] sections, without wg-quick's
+	// Address and DNS lines.
+	WireGuardConfig string `json:"wireguard_config"`
+	// Addresses are assigned to the tunnel interface, e.g. "10.64.0.2/32".
+	Addresses []string `json:"addresses"`
+	// DNS are the name servers used inside the namespace. Empty keeps the
+	// host's, reached through the tunnel.
+	DNS []string `json:"dns,omitempty"`
+}
+
+// validate checks the profile without touching the network.
+func (p Profile) validate() error {
+	if _, err := os.Stat(p.WireGuardConfig); err != nil {
+		return fmt.Errorf("egress profile %q: %w", p.Name, err)
+	}
+	if len(p.Addresses) == 0 {
+		return fmt.Errorf("egress profile %q has no addresses", p.Name)
+	}
+	for _, a := range p.Addresses {
+		if _, _, err := net.ParseCIDR(a); err != nil {
+			return fmt.Errorf("egress profile %q: invalid address %q", p.Name, a)
+		}
+	}
+	for _, d := range p.DNS {
+		if net.ParseIP(d) == nil {
+			return fmt.Errorf("egress profile %q: invalid DNS server %q", p.Name, d)
+		}
+	}
+	return nil
+}
+
+// LoadProfiles reads a JSON object of profiles keyed by name.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles map[string]Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for name, p := range profiles {
+		p.Name = name
+		if !filepath.IsAbs(p.WireGuardConfig) {
+			p.WireGuardConfig = filepath.Join(filepath.Dir(path), p.WireGuardConfig)
+		}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// Namespace is a network namespace routed through a profile's tunnel.
+// The browser's DevTools port inside it is forwarded to a loopback port
+// on the host.
+type Namespace struct {
+	Name    string
+	Profile string
+	link    string
+
+	mu     sync.Mutex
+	ln     net.Listener
+	target string
+}
+
+// Create sets up a namespace for the session id exiting through p. It
+// needs the ip and wg tools and CAP_NET_ADMIN.
+func Create(ctx context.Context, id string, p Profile) (*Namespace, error) {
+	short := strings.ReplaceAll(id, "-", "")
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	n := &Namespace{Name: "browser-lab-" + short, Profile: p.Name, link: "blwg" + short}
+
+	// The WireGuard interface is created on the host and then moved, so
+	// its encrypted traffic leaves through the host's network while
+	// everything inside the namespace goes through the tunnel.
+	steps := [][]string{
+		{"ip", "netns", "add", n.Name},
+		{"ip", "link", "add", n.link, "type", "wireguard"},
+		{"ip", "link", "set", n.link, "netns", n.Name},
+		{"ip", "netns", "exec", n.Name, "wg", "setconf", n.link, p.WireGuardConfig},
+	}
+	v6 := false
+	for _, a := range p.Addresses {
+		steps = append(steps, []string{"ip", "-n", n.Name, "addr", "add", a, "dev", n.link})
+		v6 = v6 || strings.Contains(a, ":")
+	}
+	steps = append(steps,
+		[]string{"ip", "-n", n.Name, "link", "set", "lo", "up"},
+		[]string{"ip", "-n", n.Name, "link", "set", n.link, "up"},
+		[]string{"ip", "-n", n.Name, "route", "add", "default", "dev", n.link},
+	)
+	if v6 {
+		steps = append(steps, []string{"ip", "-n", n.Name, "-6", "route", "add", "default", "dev", n.link})
+	}
+
+	for _, step := range steps {
+		if out, err := exec.CommandContext(ctx, step[0], step[1:]...).CombinedOutput(); err != nil {
+			n.Close()
+			return nil, fmt.Errorf("egress %q: %s: %v: %s", p.Name, strings.Join(step, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	// ip netns exec bind-mounts /etc/netns/<name>/resolv.conf.
+	if len(p.DNS) > 0 {
+		dir := filepath.Join("/etc/netns", n.Name)
+		var conf strings.Builder
+		for _, d := range p.DNS {
+			fmt.Fprintf(&conf, "nameserver %s\n", d)
+		}
+		err := os.MkdirAll(dir, 0755)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, "resolv.conf"), []byte(conf.String()), 0644)
+		}
+		if err != nil {
+			n.Close()
+			return nil, fmt.Errorf("egress %q: %w", p.Name, err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+	n.ln = ln
+	go n.forward(ln)
+	return n, nil
+}
+
+// Command returns the command line running path with args inside the
+// namespace.
+func (n *Namespace) Command(path string, args []string) (string, []string) {
+	return "ip", append([]string{"netns", "exec", n.Name, path}, args...)
+}
+
+// Expose forwards the host and port of the DevTools URL wsURL, which is
+// only reachable inside the namespace, to the host and returns the URL
+// to use there. Calling it again after a browser restart retargets the
+// same host port.
+func (n *Namespace) Expose(wsURL string) string {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return wsURL
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.target = u.Host
+	u.Host = n.ln.Addr().String()
+	return u.String()
+}
+
+func (n *Namespace) forward(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		n.mu.Lock()
+		target := n.target
+		n.mu.Unlock()
+
+		go func() {
+			defer conn.Close()
+			upstream, err := dialIn(n.Name, target, 5*time.Second)
+			if err != nil {
+				log.Printf("Egress: failed to reach DevTools in %s: %v", n.Name, err)
+				return
+			}
+			defer upstream.Close()
+			done := make(chan struct{}, 2)
+			go func() {
+				io.Copy(upstream, conn)
+				done <- struct{}{}
+			}()
+			go func() {
+				io.Copy(conn, upstream)
+				done <- struct{}{}
+			}()
+			<-done
+		}()
+	}
+}
+
+// Close stops forwarding and deletes the namespace, which also removes
+// its tunnel interface.
+func (n *Namespace) Close() error {
+	n.mu.Lock()
+	if n.ln != nil {
+		n.ln.Close()
+	}
+	n.mu.Unlock()
+
+	os.RemoveAll(filepath.Join("/etc/netns", n.Name))
+	// The link only exists on the host if moving it failed.
+	exec.Command("ip", "link", "del", n.link).Run()
+	return exec.Command("ip", "netns", "del", n.Name).Run()
+}
@@ -0,0 +1,66 @@
+package egress
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "fra.conf"), []byte("[Interface]\n"), 0600)
+	path := filepath.Join(dir, "profiles.json")
+	os.WriteFile(path, []byte(`{"fra": {"wireguard_config": "fra.conf", "addresses": ["10.64.0.2/32", "fc00::2/128"], "dns": ["10.64.0.1"]}}`), 0600)
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := profiles["fra"]
+	if p.Name != "fra" || p.WireGuardConfig != filepath.Join(dir, "fra.conf") {
+		t.Errorf("profile = %+v", p)
+	}
+
+	for name, body := range map[string]string{
+		"missing config": `{"x": {"wireguard_config": "nope.conf", "addresses": ["10.64.0.2/32"]}}`,
+		"no addresses":   `{"x": {"wireguard_config": "fra.conf"}}`,
+		"bad address":    `{"x": {"wireguard_config": "fra.conf", "addresses": ["10.64.0.2"]}}`,
+		"bad dns":        `{"x": {"wireguard_config": "fra.conf", "addresses": ["10.64.0.2/32"], "dns": ["resolver"]}}`,
+	} {
+		os.WriteFile(path, []byte(body), 0600)
+		if _, err := LoadProfiles(path); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	n := &Namespace{Name: "browser-lab-1234abcd"}
+	path, args := n.Command("/usr/bin/chromium", []string{"--headless"})
+	want := []string{"netns", "exec", "browser-lab-1234abcd", "/usr/bin/chromium", "--headless"}
+	if path != "ip" || !reflect.DeepEqual(args, want) {
+		t.Errorf("Command = %s %v", path, args)
+	}
+}
+
+func TestExpose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	n := &Namespace{Name: "browser-lab-1234abcd", ln: ln}
+
+	got := n.Expose("ws://127.0.0.1:9222/devtools/browser/abc")
+	if want := "ws://" + ln.Addr().String() + "/devtools/browser/abc"; got != want {
+		t.Errorf("Expose = %q, want %q", got, want)
+	}
+	// A restarted browser keeps the host port.
+	got = n.Expose("ws://127.0.0.1:9333/devtools/browser/def")
+	if !strings.HasPrefix(got, "ws://"+ln.Addr().String()+"/") || n.target != "127.0.0.1:9333" {
+		t.Errorf("Expose after restart = %q, target %q", got, n.target)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultEmbedTTL is how long an embed link stays valid by default.
+	defaultEmbedTTL = time.Hour
+	// maxEmbedTTL caps the lifetime of embed links.
+	maxEmbedTTL = 7 * 24 * time.Hour
+	// embedPage is the widget page, with a placeholder for its config.
+	embedPage = "./dashboard/embed.html"
+)
+
+// embedFrameAncestors are the sources allowed to frame the embed widget
+// (EMBED_FRAME_ANCESTORS), as CSP frame-ancestors sources. The widget
+// also only exchanges postMessages with parents from these origins.
+var embedFrameAncestors = []string{"'self'"}
+
+// setupEmbed reads the origins allowed to embed sessions.
+func setupEmbed() error {
+	v := os.Getenv("EMBED_FRAME_ANCESTORS")
+	if v == "" {
+		return nil
+	}
+	sources, err := parseFrameAncestors(v)
+	if err != nil {
+		return err
+	}
+	embedFrameAncestors = sources
+	return nil
+}
+
+// parseFrameAncestors parses a comma or space separated list of CSP
+// frame-ancestors sources: 'self', 'none', *, a scheme like https:, or an
+// origin whose host may start with a *. wildcard.
+func parseFrameAncestors(v string) ([]string, error) {
+	var sources []string
+	for _, s := range strings.Fields(strings.ReplaceAll(v, ",", " ")) {
+		switch {
+		case s == "'self'" || s == "'none'" || s == "*":
+		case strings.HasSuffix(s, ":") && !strings.Contains(s, "/"):
+		default:
+			u, err := url.Parse(strings.Replace(s, "://*.", "://wildcard.", 1))
+			if err != nil || strings.ContainsAny(s, ";'\"") || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+				return nil, fmt.Errorf("invalid frame ancestor %q: want 'self', 'none', *, a scheme or an origin", s)
+			}
+			s = strings.TrimSuffix(s, "/")
+		}
+		sources = append(sources, s)
+	}
+	if len(sources) > 1 && strings.Contains(strings.Join(sources, " "), "'none'") {
+		return nil, errors.New("frame ancestor 'none' cannot be combined with other sources")
+	}
+	return sources, nil
+}
+
+// CreateEmbedRequest asks for a link to a session's embed widget.
+type CreateEmbedRequest struct {
+	// Control lets the widget send input to the session.
+	Control bool `json:"control,omitempty"`
+	// TTLSeconds is how long the link stays valid; one hour by default.
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+}
+
+// EmbedResponse is a signed link to a session's embed widget, to be used
+// as an iframe's src.
+type EmbedResponse struct {
+	URL       string    `json:"url"`
+	Control   bool      `json:"control"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createEmbedHandler issues a signed link to the session's embed widget.
+// Anyone holding the link can watch the session until it expires, and
+// drive it if Control was asked for, without credentials of their own.
+// POST /sessions/{id}/embed
+func createEmbedHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	var req CreateEmbedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Control && !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	ttl := defaultEmbedTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if ttl < 0 || ttl > maxEmbedTTL {
+			http.Error(w, fmt.Sprintf("ttl_seconds must be between 1 and %d", int(maxEmbedTTL.Seconds())), http.StatusBadRequest)
+			return
+		}
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EmbedResponse{
+		URL:       embedURL(r, sess.ID, req.Control, expires),
+		Control:   req.Control,
+		ExpiresAt: expires,
+	})
+}
+
+// embedURL is a signed link to a session's embed widget that is valid
+// until expires.
+func embedURL(r *http.Request, id string, control bool, expires time.Time) string {
+	path := apiPrefix + "/sessions/" + id + "/embed"
+	if control {
+		path += "?control=1"
+	}
+	return externalURL(r) + signPath(path, expires)
+}
+
+// embedConfig is handed to the widget page. Its URLs are signed with the
+// page's own expiry, so the widget keeps working without credentials for
+// as long as the page link does.
+type embedConfig struct {
+	SessionID string   `json:"session_id"`
+	Control   bool     `json:"control"`
+	FramesURL string   `json:"frames_url"`
+	StatusURL string   `json:"status_url"`
+	InputURL  string   `json:"input_url,omitempty"`
+	Ancestors []string `json:"ancestors"`
+}
+
+// embedHandler serves the embed widget: a page meant for an iframe that
+// shows the session's frames and, with control=1 for callers allowed to
+// control the session or holding a link signed with it, on a listener
+// serving the CDP routes, forwards mouse and keyboard input to it. Only EMBED_FRAME_ANCESTORS may frame it. The
+// parent page talks to the widget with postMessage; see the README.
+// GET /sessions/{id}/embed?control=1
+func embedHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	page, err := os.ReadFile(embedPage)
+	if err != nil {
+		http.Error(w, "Embed page unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	// A signed link only asks for control if its signer was allowed it. As
+	// over WHIP, input is only forwarded from listeners that could reach
+	// the input socket anyway.
+	control := q.Get("control") == "1" && (canControl(r, sess) || signedFor(r)) && reachesGroup(r, groupCDP)
+	expires := time.Now().Add(defaultEmbedTTL)
+	if n, err := strconv.ParseInt(q.Get("expires"), 10, 64); err == nil && q.Get("signature") != "" {
+		// Signed links have been verified by now; their URLs expire with them.
+		expires = time.Unix(n, 0)
+		if limit := time.Now().Add(maxEmbedTTL); expires.After(limit) {
+			expires = limit
+		}
+	}
+
+	prefix := forwardedPrefix(r)
+	base := apiPrefix + "/sessions/" + sess.ID
+	cfg := embedConfig{
+		SessionID: sess.ID,
+		Control:   control,
+		FramesURL: prefix + signPath(base+"/frames", expires),
+		StatusURL: prefix + signPath(base, expires),
+		Ancestors: embedFrameAncestors,
+	}
+	if control {
+		cfg.InputURL = prefix + signPath(base+"/input", expires)
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page = bytes.Replace(page, []byte("/*config*/null"), data, 1)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors "+strings.Join(embedFrameAncestors, " ")+
+		"; default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'; img-src data:")
+	w.Write(page)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"browser-server/auth"
+)
+
+func TestParseFrameAncestors(t *testing.T) {
+	got, err := parseFrameAncestors("'self', https://app.example.com/ https://*.example.org:8443 https:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"'self'", "https://app.example.com", "https://*.example.org:8443", "https:"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{
+		"example.com",
+		"https://app.example.com/path",
+		"https://app.example.com; script-src *",
+		"https://app.example.com;",
+		"'none' https://app.example.com",
+		"self",
+	} {
+		if _, err := parseFrameAncestors(bad); err == nil {
+			t.Errorf("parseFrameAncestors(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestEmbedControlNeedsCDPGroup(t *testing.T) {
+	srv, svc := newTestServer(t)
+	id, err := createTestSession(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := httptest.NewServer(newRouter(svc, []routeGroup{groupWHIP}))
+	defer public.Close()
+
+	for base, want := range map[string]bool{srv.URL: true, public.URL: false} {
+		resp, err := http.Get(base + "/v1/sessions/" + id + "/embed?control=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if got := strings.Contains(string(page), `"control":true`); got != want || resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d, control %v, want %v", base, resp.StatusCode, got, want)
+		}
+	}
+}
+
+// embedStatusURLRe finds the status URL in an embed page's config.
+var embedStatusURLRe = regexp.MustCompile(`"status_url":("[^"]*")`)
+
+func TestSignedEmbedLinksDoNotGrantCDP(t *testing.T) {
+	defer func(keys *auth.Store) {
+		keyStore = keys
+		urlSigningKey = nil
+	}(keyStore)
+	urlSigningKey = []byte("test-key")
+	srv, _ := newTestServer(t)
+	id, err := createTestSession(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyStore = &auth.Store{Keys: []*auth.Key{
+		{Name: "viewer", Key: "viewer-key", Role: auth.RoleViewer},
+		{Name: "admin", Key: "admin-key", Role: auth.RoleAdmin},
+	}}
+
+	do := func(method, target, key, body string) *http.Response {
+		req, _ := http.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := do("POST", srv.URL+"/v1/sessions/"+id+"/embed", "viewer-key", `{"control": true}`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("viewer asked for control: %d", resp.StatusCode)
+	}
+
+	for key, body := range map[string]string{"viewer-key": `{}`, "admin-key": `{"control": true}`} {
+		var embed EmbedResponse
+		resp := do("POST", srv.URL+"/v1/sessions/"+id+"/embed", key, body)
+		json.NewDecoder(resp.Body).Decode(&embed)
+		resp.Body.Close()
+
+		resp = do("GET", embed.URL, "", "")
+		page, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if got := strings.Contains(string(page), `"control":true`); got != embed.Control {
+			t.Errorf("%s: widget control %v, link granted %v", key, got, embed.Control)
+		}
+		m := embedStatusURLRe.FindSubmatch(page)
+		if m == nil {
+			t.Fatalf("%s: no status URL in embed page (%d)", key, resp.StatusCode)
+		}
+		var statusURL string
+		json.Unmarshal(m[1], &statusURL)
+
+		// The widget's status link shows the session, but hands out
+		// nothing that controls it.
+		resp = do("GET", srv.URL+statusURL, "", "")
+		var status SessionResponse
+		json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || status.ID != id {
+			t.Fatalf("%s: status URL: %d", key, resp.StatusCode)
+		}
+		if strings.Contains(status.CDPURL, "token=") || status.Restream != nil || status.VideoRecording != nil {
+			t.Errorf("%s: signed status URL handed out control: CDP URL %s", key, status.CDPURL)
+		}
+	}
+}
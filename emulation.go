@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// emulationHandler returns the session's rendering emulation or, for PUT,
+// replaces it in every page first. A PUT body may start from named
+// presets, which its other fields override.
+// GET, PUT /sessions/{id}/emulation
+func emulationHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Presets []string `json:"presets"`
+			session.Emulation
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		e, err := req.Emulation.WithPresets(req.Presets...)
+		if err == nil {
+			err = e.Validate()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := sess.SetEmulation(r.Context(), e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess.Emulation())
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"browser-server/recording"
+	"browser-server/replay"
+)
+
+// Actions of an ephemeral request beyond the recorded step actions.
+const (
+	// actionEvaluate runs Expression in the page and returns its value.
+	actionEvaluate = "evaluate"
+	// actionScreenshot returns a PNG of the page.
+	actionScreenshot = "screenshot"
+)
+
+// maxEphemeralActions bounds the action list of an ephemeral request.
+const maxEphemeralActions = 100
+
+// EphemeralAction is one action of an ephemeral request: a job step, or
+// an evaluate or screenshot action whose output is returned.
+type EphemeralAction struct {
+	recording.Step
+	Expression string `json:"expression,omitempty"`
+}
+
+func (a EphemeralAction) validate() error {
+	switch a.Action {
+	case actionEvaluate:
+		if a.Expression == "" {
+			return errors.New("evaluate needs an expression")
+		}
+		return nil
+	case actionScreenshot:
+		return nil
+	}
+	return a.Step.Validate()
+}
+
+// EphemeralRequest is the body of POST /sessions?ephemeral=true: the
+// session to create and what to do with it.
+type EphemeralRequest struct {
+	CreateSessionRequest
+	Actions            []EphemeralAction `json:"actions"`
+	StepTimeoutSeconds int               `json:"step_timeout_seconds"`
+}
+
+func (req EphemeralRequest) validate() error {
+	if len(req.Actions) == 0 {
+		return errors.New("actions must not be empty")
+	}
+	if len(req.Actions) > maxEphemeralActions {
+		return fmt.Errorf("at most %d actions are allowed", maxEphemeralActions)
+	}
+	for i, a := range req.Actions {
+		if err := a.validate(); err != nil {
+			return fmt.Errorf("action %d: %w", i, err)
+		}
+	}
+	if req.StepTimeoutSeconds < 0 || req.StepTimeoutSeconds > 300 {
+		return errors.New("step_timeout_seconds must be between 0 and 300")
+	}
+	return nil
+}
+
+// ActionResult is the outcome of one action. Value holds what an evaluate
+// returned and Screenshot a screenshot's PNG (base64 in JSON).
+type ActionResult struct {
+	Index      int             `json:"index"`
+	Action     string          `json:"action"`
+	Status     string          `json:"status"`
+	Detail     string          `json:"detail,omitempty"`
+	Value      json.RawMessage `json:"value,omitempty"`
+	Screenshot []byte          `json:"screenshot,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+// EphemeralResponse reports an ephemeral request. Status is "passed",
+// "diverged" or "failed" as for replays; actions after the first that did
+// not succeed are skipped.
+type EphemeralResponse struct {
+	SessionID  string         `json:"session_id"`
+	Status     string         `json:"status"`
+	Results    []ActionResult `json:"results"`
+	DurationMS int64          `json:"duration_ms"`
+}
+
+// ephemeralHandler creates a session, runs the request's actions against
+// it and stops it again, whatever happens, before answering.
+// POST /sessions?ephemeral=true
+func ephemeralHandler(w http.ResponseWriter, r *http.Request) {
+	var req EphemeralRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, ok := createSession(w, r, req.CreateSessionRequest)
+	if !ok {
+		return
+	}
+	defer requestSessions(r).DeleteSession(sess.ID)
+
+	stepTimeout := 10 * time.Second
+	if req.StepTimeoutSeconds > 0 {
+		stepTimeout = time.Duration(req.StepTimeoutSeconds) * time.Second
+	}
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+
+	start := time.Now()
+	resp := EphemeralResponse{SessionID: sess.ID, Status: replay.StatusPassed}
+	for i, a := range req.Actions {
+		res := ActionResult{Index: i, Action: a.Action}
+		if resp.Status != replay.StatusPassed {
+			res.Status = replay.StepSkipped
+			resp.Results = append(resp.Results, res)
+			continue
+		}
+
+		actionStart := time.Now()
+		actx, acancel := context.WithTimeout(ctx, stepTimeout)
+		var err error
+		switch a.Action {
+		case actionEvaluate:
+			res.Value, err = sess.Evaluate(actx, a.Expression)
+		case actionScreenshot:
+			res.Screenshot, err = sess.Screenshot(actx)
+		default:
+			err = sess.RunStep(actx, a.Step)
+		}
+		acancel()
+		res.DurationMS = time.Since(actionStart).Milliseconds()
+
+		var div *recording.Divergence
+		switch {
+		case err == nil:
+			res.Status = replay.StepOK
+		case errors.As(err, &div):
+			res.Status = replay.StepDiverged
+			res.Detail = div.Reason
+			resp.Status = replay.StatusDiverged
+		default:
+			res.Status = replay.StepError
+			res.Detail = err.Error()
+			resp.Status = replay.StatusFailed
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	resp.DurationMS = time.Since(start).Milliseconds()
+	log.Printf("Ephemeral session %s: %s after %d actions", sess.ID, resp.Status, len(req.Actions))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
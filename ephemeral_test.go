@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEphemeralRequest(t *testing.T) {
+	var req EphemeralRequest
+	body := `{"duration_minutes": 2, "stealth": true, "actions": [
+		{"action": "navigate", "url": "https://example.com"},
+		{"action": "evaluate", "expression": "document.title"},
+		{"action": "screenshot"}
+	]}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.DurationMinutes != 2 || req.Stealth == nil || !*req.Stealth || len(req.Actions) != 3 {
+		t.Fatalf("decoded %+v", req)
+	}
+	if err := req.validate(); err != nil {
+		t.Errorf("valid request: %v", err)
+	}
+
+	for name, actions := range map[string]string{
+		"no actions":         `[]`,
+		"evaluate without":   `[{"action": "evaluate"}]`,
+		"unknown action":     `[{"action": "teleport"}]`,
+		"click without el":   `[{"action": "click"}]`,
+		"navigate without u": `[{"action": "navigate"}]`,
+	} {
+		var req EphemeralRequest
+		json.Unmarshal([]byte(`{"actions": `+actions+`}`), &req)
+		if err := req.validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	var many EphemeralRequest
+	many.Actions = make([]EphemeralAction, maxEphemeralActions+1)
+	for i := range many.Actions {
+		many.Actions[i].Action = actionScreenshot
+	}
+	if err := many.validate(); err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("too many actions: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONWithETag(t *testing.T) {
+	v := map[string]string{"id": "abc"}
+	w := httptest.NewRecorder()
+	writeJSONWithETag(w, httptest.NewRequest("GET", "/v1/sessions", nil), v)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status %d, ETag %q", w.Code, etag)
+	}
+
+	// The compressed form of the tag matches too.
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag} {
+		r := httptest.NewRequest("GET", "/v1/sessions", nil)
+		r.Header.Set("If-None-Match", header)
+		w := httptest.NewRecorder()
+		writeJSONWithETag(w, r, v)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: status %d", header, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/v1/sessions", nil)
+	r.Header.Set("If-None-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	writeJSONWithETag(w, r, v)
+	if w.Code != http.StatusOK {
+		t.Errorf("stale ETag: status %d", w.Code)
+	}
+}
+
+func TestCompressedETagRevalidates(t *testing.T) {
+	v := map[string]string{"id": "abc"}
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONWithETag(w, r, v)
+	}))
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/v1/sessions", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, "W/") {
+		t.Fatalf("status %d, ETag %q", w.Code, etag)
+	}
+	// The weak tag the client was given revalidates, and the 304 repeats it.
+	w = get(etag)
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != etag {
+		t.Errorf("status %d, ETag %q, want 304 with %q", w.Code, w.Header().Get("ETag"), etag)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"browser-server/events"
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	eventBus = events.NewBus()
+	// defaultWarnBefore is how long before expiry sessions warn by default
+	// (SESSION_WARN_BEFORE).
+	defaultWarnBefore = time.Minute
+)
+
+// setupEvents publishes session lifecycle events on the bus and starts the
+// webhook sender when WEBHOOK_URL is set.
+func setupEvents(sessions *session.Manager) error {
+	if v := os.Getenv("SESSION_WARN_BEFORE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		defaultWarnBefore = d
+	}
+
+	sessions.Observe(eventsObserver{})
+
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		wh := &events.Webhook{URL: url, Secret: os.Getenv("WEBHOOK_SECRET"), Retries: 3}
+		go wh.Run(eventBus)
+		log.Printf("Events: delivering webhooks to %s", url)
+	}
+	return setupEventStreams()
+}
+
+// setupEventStreams publishes events to NATS (NATS_URL) and Kafka
+// (KAFKA_REST_URL), serialized as EVENT_FORMAT, and session status to
+// MQTT (MQTT_BROKER).
+func setupEventStreams() error {
+	format := os.Getenv("EVENT_FORMAT")
+	if err := events.ValidateFormat(format); err != nil {
+		return err
+	}
+	source := os.Getenv("EVENT_SOURCE")
+	if source == "" {
+		source = "browser-lab"
+		if host, err := os.Hostname(); err == nil {
+			source += "/" + host
+		}
+	}
+
+	if url := os.Getenv("NATS_URL"); url != "" {
+		prefix := os.Getenv("NATS_SUBJECT_PREFIX")
+		if prefix == "" {
+			prefix = "browser-lab"
+		}
+		n, err := events.ConnectNATS(url, os.Getenv("NATS_CREDS"), prefix)
+		if err != nil {
+			return err
+		}
+		go (&events.Stream{Publisher: n, Format: format, Source: source}).Run(eventBus)
+		log.Printf("Events: publishing to NATS subjects %s.* on %s", prefix, url)
+	}
+	if url := os.Getenv("KAFKA_REST_URL"); url != "" {
+		topic := os.Getenv("KAFKA_TOPIC")
+		if topic == "" {
+			topic = "browser-lab-events"
+		}
+		k := &events.KafkaREST{URL: url, Topic: topic, Retries: 3}
+		go (&events.Stream{Publisher: k, Format: format, Source: source}).Run(eventBus)
+		log.Printf("Events: producing to Kafka topic %s through %s", topic, url)
+	}
+	if broker := os.Getenv("MQTT_BROKER"); broker != "" {
+		prefix := os.Getenv("MQTT_TOPIC_PREFIX")
+		if prefix == "" {
+			prefix = "browser-lab"
+		}
+		clientID := os.Getenv("MQTT_CLIENT_ID")
+		if clientID == "" {
+			clientID = strings.ReplaceAll(source, "/", "-")
+		}
+		m, err := events.ConnectMQTT(broker, clientID, os.Getenv("MQTT_USERNAME"), os.Getenv("MQTT_PASSWORD"), prefix)
+		if err != nil {
+			return err
+		}
+		go m.Run(eventBus)
+		log.Printf("Events: publishing session status to MQTT topics %s/# on %s", prefix, broker)
+	}
+	return nil
+}
+
+// eventsObserver publishes session lifecycle changes on the event bus.
+type eventsObserver struct{}
+
+func (eventsObserver) SessionCreated(s *session.Session) {
+	eventBus.Publish(events.Event{
+		Type:      "session.created",
+		SessionID: s.ID,
+		Owner:     s.Owner,
+		Data: map[string]interface{}{
+			"owner":      s.Owner,
+			"expires_at": s.ExpiresAt,
+		},
+	})
+}
+
+func (eventsObserver) SessionReady(s *session.Session) {
+	eventBus.Publish(events.Event{Type: "session.ready", SessionID: s.ID, Owner: s.Owner})
+}
+
+func (eventsObserver) SessionCrashed(s *session.Session) {
+	eventBus.Publish(events.Event{
+		Type:      "session.crashed",
+		SessionID: s.ID,
+		Owner:     s.Owner,
+		Data: map[string]interface{}{
+			"crash_dumps": len(s.CrashDumps()),
+		},
+	})
+}
+
+func (eventsObserver) SessionStopped(s *session.Session) {
+	eventBus.Publish(events.Event{
+		Type:      "session.stopped",
+		SessionID: s.ID,
+		Owner:     s.Owner,
+		Data: map[string]interface{}{
+			"state": s.State(),
+		},
+	})
+}
+
+func (eventsObserver) SessionWarning(s *session.Session, w session.Warning) {
+	eventBus.Publish(events.Event{
+		Type:      "session.warning",
+		SessionID: s.ID,
+		Owner:     s.Owner,
+		Data: map[string]interface{}{
+			"kind":       w.Kind,
+			"message":    w.Message,
+			"expires_at": s.ExpiresAt,
+			"usage":      s.Usage(),
+		},
+	})
+}
+
+// SessionHealth publishes health changes as session.healthy,
+// session.unhealthy and session.restarting events.
+func (eventsObserver) SessionHealth(s *session.Session, h session.Health) {
+	eventBus.Publish(events.Event{
+		Type:      "session." + h.Status,
+		SessionID: s.ID,
+		Owner:     s.Owner,
+		Data: map[string]interface{}{
+			"reason":   h.Reason,
+			"restarts": h.Restarts,
+		},
+	})
+}
+
+// SessionDialog publishes dialogs pages open as session.dialog events.
+func (eventsObserver) SessionDialog(s *session.Session, d session.Dialog) {
+	eventBus.Publish(events.Event{
+		Type:      "session.dialog",
+		SessionID: s.ID,
+		Owner:     s.Owner,
+		Data: map[string]interface{}{
+			"type":    d.Type,
+			"message": d.Message,
+			"url":     d.URL,
+			"action":  d.Action,
+		},
+	})
+}
+
+// SessionBlocked does nothing: blocked navigations are published as
+// compliance.blocked events by the compliance audit.
+func (eventsObserver) SessionBlocked(*session.Session, session.Blocked) {}
+
+// eventsHandler streams server events as Server-Sent Events, optionally
+// limited to one session. Callers only see the events of what they may
+// control; server events, which have no owner, are for admins.
+// GET /events?session={id}
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session")
+	events.ServeSSE(w, r, eventBus, func(e events.Event) bool {
+		return (sessionID == "" || e.SessionID == sessionID) && canControlOwner(r, e.Owner)
+	})
+}
+
+// cdpEventsHandler streams the session's CDP events of the requested
+// domains as Server-Sent Events named after their method. Unlike the CDP
+// proxy it gives no way to send commands.
+// GET /sessions/{id}/events/cdp?domains=Network,Page
+func cdpEventsHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	domains := splitList(r.URL.Query().Get("domains"))
+	if len(domains) == 0 {
+		http.Error(w, "domains is required, e.g. domains=Network,Page", http.StatusBadRequest)
+		return
+	}
+	for _, d := range domains {
+		if !slices.Contains(session.CDPEventDomains, d) {
+			http.Error(w, fmt.Sprintf("unsupported domain %q, use one of %v", d, session.CDPEventDomains), http.StatusBadRequest)
+			return
+		}
+	}
+	sub, err := sess.SubscribeCDP(domains)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			var n int
+			n, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Method, data)
+			sess.CountStreamBytes(n)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			if d := sub.Dropped(); d > 0 {
+				log.Printf("Events: CDP subscriber of session %s went away after dropping %d events", sess.ID, d)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is a notification about something that happened on the server.
+type Event struct {
+	Type      string                 `json:"type"`
+	SessionID string                 `json:"session_id,omitempty"`
+	Time      time.Time              `json:"time"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	// Owner is who owns the session, crawl or job the event is about, and
+	// decides who may watch it. Server events have none.
+	Owner string `json:"-"`
+}
+
+// Bus fans events out to subscribers. Slow subscribers miss events rather
+// than blocking publishers.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish delivers an event to every subscriber, stamping its time if unset.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving future events and a function that
+// cancels the subscription.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (b *Bus) hasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) > 0
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// KafkaREST produces events to a Kafka topic through a Kafka REST Proxy
+// (v2 API), keyed by Key so each session's events stay in one partition.
+type KafkaREST struct {
+	URL   string
+	Topic string
+	// Client defaults to one with a 10 second timeout. Basic auth
+	// credentials can be given in URL.
+	Client *http.Client
+	// Retries is the number of additional attempts after a failure.
+	Retries int
+}
+
+type kafkaRecord struct {
+	Key   *string         `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (k *KafkaREST) Publish(e Event, body []byte) error {
+	var key *string
+	if s := Key(e); s != "" {
+		key = &s
+	}
+	payload, err := json.Marshal(map[string][]kafkaRecord{"records": {{Key: key, Value: body}}})
+	if err != nil {
+		return err
+	}
+	client := k.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err = k.post(client, payload)
+		if err == nil || attempt >= k.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (k *KafkaREST) post(client *http.Client, payload []byte) error {
+	endpoint := strings.TrimSuffix(k.URL, "/") + "/topics/" + url.PathEscape(k.Topic)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	// The proxy reports per-record failures in a 200 response.
+	var res struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&res) == nil {
+		for _, o := range res.Offsets {
+			if o.ErrorCode != nil {
+				return fmt.Errorf("record rejected: %s", o.Error)
+			}
+		}
+	}
+	return nil
+}
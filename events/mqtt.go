@@ -0,0 +1,138 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttTimeout bounds each publish to the broker.
+const mqttTimeout = 10 * time.Second
+
+// SessionStatus is the message kept on a session's MQTT topic.
+type SessionStatus struct {
+	ID        string     `json:"id"`
+	State     string     `json:"state"`
+	Owner     string     `json:"owner,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// statusStates maps the session events that change what a dashboard
+// shows to a state.
+var statusStates = map[string]string{
+	"session.created":    "starting",
+	"session.ready":      "ready",
+	"session.healthy":    "ready",
+	"session.unhealthy":  "unhealthy",
+	"session.restarting": "restarting",
+	"session.crashed":    "crashed",
+	"session.stopped":    "stopped",
+}
+
+// MQTTStatus keeps a small retained status message per session on an
+// MQTT broker, for dashboards on kiosks and other constrained devices:
+//
+//	<prefix>/sessions/<id>  SessionStatus, cleared when the session stops
+//	<prefix>/summary        {"sessions": n}
+//	<prefix>/online         "true", or "false" once the server is gone
+type MQTTStatus struct {
+	client mqtt.Client
+	prefix string
+
+	mu       sync.Mutex
+	sessions map[string]*SessionStatus
+}
+
+type mqttMessage struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+// ConnectMQTT connects to broker (tcp://, ssl:// or ws:// URL). The
+// broker announces the server offline through a will if it goes away.
+func ConnectMQTT(broker, clientID, username, password, prefix string) (*MQTTStatus, error) {
+	m := &MQTTStatus{prefix: prefix, sessions: make(map[string]*SessionStatus)}
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(prefix+"/online", "false", 1, true).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			c.Publish(prefix+"/online", 1, true, "true")
+		})
+	m.client = mqtt.NewClient(opts)
+	tok := m.client.Connect()
+	// With ConnectRetry the token only fails for bad options; a broker
+	// that is down is retried in the background.
+	if tok.WaitTimeout(mqttTimeout) && tok.Error() != nil {
+		return nil, tok.Error()
+	}
+	return m, nil
+}
+
+// Run publishes status changes from the bus until the subscription ends.
+func (m *MQTTStatus) Run(b *Bus) {
+	ch, _ := b.Subscribe(256)
+	for e := range ch {
+		for _, msg := range m.handle(e) {
+			tok := m.client.Publish(msg.topic, 1, msg.retained, msg.payload)
+			if tok.WaitTimeout(mqttTimeout) && tok.Error() != nil {
+				log.Printf("MQTT: failed to publish to %s: %v", msg.topic, tok.Error())
+			}
+		}
+	}
+}
+
+// handle turns a bus event into the messages to publish.
+func (m *MQTTStatus) handle(e Event) []mqttMessage {
+	state, ok := statusStates[e.Type]
+	if !ok || e.SessionID == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.sessions[e.SessionID]
+	if st == nil {
+		if e.Type == "session.stopped" {
+			return nil
+		}
+		st = &SessionStatus{ID: e.SessionID}
+		m.sessions[e.SessionID] = st
+	}
+	st.State, st.UpdatedAt = state, e.Time
+	if owner, ok := e.Data["owner"].(string); ok {
+		st.Owner = owner
+	}
+	if t, ok := e.Data["expires_at"].(time.Time); ok {
+		st.ExpiresAt = &t
+	}
+	if s, ok := e.Data["state"]; ok && e.Type == "session.stopped" {
+		// Expired or stopped.
+		st.State = fmt.Sprint(s)
+	}
+
+	topic := m.prefix + "/sessions/" + e.SessionID
+	payload, _ := json.Marshal(st)
+	msgs := []mqttMessage{{topic: topic, payload: payload, retained: true}}
+	if e.Type == "session.stopped" {
+		// Subscribers see the final state once; the empty retained
+		// message then removes the topic.
+		delete(m.sessions, e.SessionID)
+		msgs = []mqttMessage{{topic: topic, payload: payload}, {topic: topic, payload: []byte{}, retained: true}}
+	}
+	if e.Type == "session.created" || e.Type == "session.stopped" {
+		summary, _ := json.Marshal(map[string]int{"sessions": len(m.sessions)})
+		msgs = append(msgs, mqttMessage{topic: m.prefix + "/summary", payload: summary, retained: true})
+	}
+	return msgs
+}
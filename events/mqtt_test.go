@@ -0,0 +1,36 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type stoppedState string
+
+func TestMQTTStatus(t *testing.T) {
+	m := &MQTTStatus{prefix: "lab", sessions: make(map[string]*SessionStatus)}
+	expires := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	msgs := m.handle(Event{Type: "session.created", SessionID: "s1", Data: map[string]interface{}{"owner": "kiosk", "expires_at": expires}})
+	if len(msgs) != 2 || msgs[0].topic != "lab/sessions/s1" || !msgs[0].retained || msgs[1].topic != "lab/summary" || string(msgs[1].payload) != `{"sessions":1}` {
+		t.Fatalf("created: %+v", msgs)
+	}
+
+	msgs = m.handle(Event{Type: "session.ready", SessionID: "s1"})
+	var st SessionStatus
+	json.Unmarshal(msgs[0].payload, &st)
+	if len(msgs) != 1 || st.State != "ready" || st.Owner != "kiosk" || st.ExpiresAt == nil || !st.ExpiresAt.Equal(expires) {
+		t.Errorf("ready: %s", msgs[0].payload)
+	}
+
+	if msgs := m.handle(Event{Type: "session.warning", SessionID: "s1"}); msgs != nil {
+		t.Errorf("warning published: %+v", msgs)
+	}
+
+	msgs = m.handle(Event{Type: "session.stopped", SessionID: "s1", Data: map[string]interface{}{"state": stoppedState("expired")}})
+	json.Unmarshal(msgs[0].payload, &st)
+	if len(msgs) != 3 || st.State != "expired" || msgs[0].retained || !msgs[1].retained || len(msgs[1].payload) != 0 || string(msgs[2].payload) != `{"sessions":0}` {
+		t.Errorf("stopped: %+v", msgs)
+	}
+}
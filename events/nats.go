@@ -0,0 +1,36 @@
+package events
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publishes events on subjects named prefix.<event type>, e.g.
+// browser-lab.session.created, so consumers can subscribe with wildcards.
+type NATS struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// ConnectNATS connects to the servers in url (comma-separated), with the
+// credentials file creds if set. The connection keeps trying, also when
+// the servers are down at startup, buffering events in the meantime.
+func ConnectNATS(url, creds, prefix string) (*NATS, error) {
+	opts := []nats.Option{nats.Name("browser-lab"), nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true)}
+	if creds != "" {
+		opts = append(opts, nats.UserCredentials(creds))
+	}
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &NATS{conn: conn, prefix: prefix}, nil
+}
+
+func (n *NATS) Publish(e Event, body []byte) error {
+	msg := nats.NewMsg(n.prefix + "." + e.Type)
+	msg.Data = body
+	if key := Key(e); key != "" {
+		msg.Header.Set("Browser-Lab-Key", key)
+	}
+	return n.conn.PublishMsg(msg)
+}
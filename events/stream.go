@@ -0,0 +1,96 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// Serialization formats of streamed events.
+const (
+	// FormatJSON sends events as they appear on GET /events and webhooks.
+	FormatJSON = "json"
+	// FormatCloudEvents wraps them in CloudEvents 1.0 structured JSON.
+	FormatCloudEvents = "cloudevents"
+)
+
+// Publisher sends encoded events to a message broker.
+type Publisher interface {
+	Publish(e Event, body []byte) error
+}
+
+// Stream publishes bus events to a message broker.
+type Stream struct {
+	Publisher Publisher
+	// Format is FormatJSON (the default) or FormatCloudEvents.
+	Format string
+	// Source is the CloudEvents source, identifying this server.
+	Source string
+}
+
+// Run publishes every event from the bus until the subscription ends.
+func (s *Stream) Run(b *Bus) {
+	ch, _ := b.Subscribe(1024)
+	for e := range ch {
+		body, err := Encode(e, s.Format, s.Source)
+		if err == nil {
+			err = s.Publisher.Publish(e, body)
+		}
+		if err != nil {
+			log.Printf("Event stream: failed to publish %s event: %v", e.Type, err)
+		}
+	}
+}
+
+// ValidateFormat checks a serialization format.
+func ValidateFormat(format string) error {
+	switch format {
+	case "", FormatJSON, FormatCloudEvents:
+		return nil
+	}
+	return fmt.Errorf("unknown event format %q", format)
+}
+
+// cloudEvent is the CloudEvents 1.0 JSON envelope.
+type cloudEvent struct {
+	SpecVersion     string                 `json:"specversion"`
+	ID              string                 `json:"id"`
+	Source          string                 `json:"source"`
+	Type            string                 `json:"type"`
+	Subject         string                 `json:"subject,omitempty"`
+	Time            string                 `json:"time"`
+	DataContentType string                 `json:"datacontenttype"`
+	Data            map[string]interface{} `json:"data,omitempty"`
+}
+
+// Encode serializes an event in format. CloudEvents get a browser-lab.
+// type prefix, the session as subject and source as source.
+func Encode(e Event, format, source string) ([]byte, error) {
+	if format != FormatCloudEvents {
+		return json.Marshal(e)
+	}
+	return json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.New().String(),
+		Source:          source,
+		Type:            "browser-lab." + e.Type,
+		Subject:         e.SessionID,
+		Time:            e.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		DataContentType: "application/json",
+		Data:            e.Data,
+	})
+}
+
+// Key is the partition key of an event: its session, or the job it is
+// about, so a consumer sees each one's events in order.
+func Key(e Event) string {
+	if e.SessionID != "" {
+		return e.SessionID
+	}
+	if id, ok := e.Data["id"].(string); ok {
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEncodeCloudEvents(t *testing.T) {
+	e := Event{Type: "session.created", SessionID: "s1", Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Data: map[string]interface{}{"owner": "ci"}}
+	body, err := Encode(e, FormatCloudEvents, "browser-lab/host1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ce map[string]interface{}
+	json.Unmarshal(body, &ce)
+	for k, want := range map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "browser-lab.session.created",
+		"source":      "browser-lab/host1",
+		"subject":     "s1",
+		"time":        "2026-01-02T03:04:05.000Z",
+	} {
+		if ce[k] != want {
+			t.Errorf("%s = %v, want %v", k, ce[k], want)
+		}
+	}
+	if ce["id"] == "" || ce["data"].(map[string]interface{})["owner"] != "ci" {
+		t.Errorf("event = %s", body)
+	}
+
+	body, _ = Encode(e, FormatJSON, "")
+	var plain Event
+	if json.Unmarshal(body, &plain) != nil || plain.SessionID != "s1" {
+		t.Errorf("JSON event = %s", body)
+	}
+}
+
+func TestKafkaRESTProduces(t *testing.T) {
+	var path, contentType string
+	var req struct {
+		Records []struct {
+			Key   *string         `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"records"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		io.WriteString(w, `{"offsets":[{"partition":0,"offset":7}]}`)
+	}))
+	defer srv.Close()
+
+	k := &KafkaREST{URL: srv.URL + "/", Topic: "lab-events"}
+	e := Event{Type: "crawl.finished", Data: map[string]interface{}{"id": "c1"}}
+	body, _ := Encode(e, FormatJSON, "")
+	if err := k.Publish(e, body); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/topics/lab-events" || contentType != "application/vnd.kafka.json.v2+json" {
+		t.Errorf("POST %s (%s)", path, contentType)
+	}
+	if len(req.Records) != 1 || req.Records[0].Key == nil || *req.Records[0].Key != "c1" || string(req.Records[0].Value) != string(body) {
+		t.Errorf("records = %+v", req.Records)
+	}
+
+	// Per-record errors come back in a 200 response.
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"offsets":[{"error_code":40403,"error":"Topic not found"}]}`)
+	})
+	if err := k.Publish(e, body); err == nil {
+		t.Error("rejected record not reported")
+	}
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed
+// with the webhook secret.
+const SignatureHeader = "X-Browser-Lab-Signature"
+
+// Webhook posts events as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+	// Retries is the number of additional attempts after a failure.
+	Retries int
+	// Queue is how many events wait while a delivery is retried (default
+	// 1024). Events beyond it are dropped and counted.
+	Queue int
+
+	dropped atomic.Int64
+}
+
+// Run delivers every event from the bus until the subscription ends.
+// Events are taken off the bus as they come, so that retries do not have
+// the bus drop them unnoticed, and wait in the queue for their delivery.
+func (wh *Webhook) Run(b *Bus) {
+	ch, _ := b.Subscribe(256)
+	size := wh.Queue
+	if size <= 0 {
+		size = 1024
+	}
+	queue := make(chan Event, size)
+	go func() {
+		defer close(queue)
+		for e := range ch {
+			select {
+			case queue <- e:
+			default:
+				wh.dropped.Add(1)
+			}
+		}
+	}()
+
+	var reported int64
+	for e := range queue {
+		if n := wh.dropped.Load(); n > reported {
+			log.Printf("Webhook: dropped %d events while deliveries were retried", n-reported)
+			reported = n
+		}
+		if err := wh.Send(e); err != nil {
+			log.Printf("Webhook: failed to deliver %s event: %v", e.Type, err)
+		}
+	}
+}
+
+// Dropped returns how many events Run dropped because its queue was full.
+func (wh *Webhook) Dropped() int64 {
+	return wh.dropped.Load()
+}
+
+// Send posts a payload, retrying with exponential backoff.
+func (wh *Webhook) Send(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err = wh.post(client, body)
+		if err == nil || attempt >= wh.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (wh *Webhook) post(client *http.Client, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wh.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(wh.Secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignsAndRetries(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(SignatureHeader), Sign("s3cret", body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	wh := &Webhook{URL: srv.URL, Secret: "s3cret", Retries: 1}
+	if err := wh.Send(Event{Type: "session.stopped", SessionID: "abc"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+}
+
+func TestBusDropsForSlowSubscribers(t *testing.T) {
+	b := NewBus()
+	ch, cancel := b.Subscribe(1)
+	defer cancel()
+
+	b.Publish(Event{Type: "a"})
+	b.Publish(Event{Type: "b"}) // dropped, buffer full
+
+	if e := <-ch; e.Type != "a" {
+		t.Errorf("got %q, want a", e.Type)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected event %q", e.Type)
+	default:
+	}
+}
+
+func TestWebhookCountsDroppedEvents(t *testing.T) {
+	release := make(chan struct{})
+	var delivered atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		delivered.Add(1)
+	}))
+	defer srv.Close()
+
+	b := NewBus()
+	wh := &Webhook{URL: srv.URL, Queue: 2}
+	go wh.Run(b)
+	for !b.hasSubscribers() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The first delivery hangs while more events come than the bus buffers
+	// and the queue holds.
+	for range 300 {
+		b.Publish(Event{Type: "session.ready"})
+		time.Sleep(100 * time.Microsecond)
+	}
+	close(release)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if delivered.Load()+wh.Dropped() == 300 {
+			break
+		}
+	}
+	if d := wh.Dropped(); d == 0 || delivered.Load()+d != 300 {
+		t.Errorf("delivered %d and dropped %d of 300 events", delivered.Load(), d)
+	}
+}
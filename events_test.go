@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-server/auth"
+	"browser-server/events"
+)
+
+func TestEventsOnlyForOwners(t *testing.T) {
+	for _, tc := range []struct {
+		id   *auth.Identity
+		want []string
+	}{
+		{&auth.Identity{Name: "alice", Role: auth.RoleOperator}, []string{"s-alice"}},
+		{&auth.Identity{Name: "bob", Role: auth.RoleViewer}, nil},
+		{&auth.Identity{Name: "root", Role: auth.RoleAdmin}, []string{"s-alice", "s-bob", "server"}},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			eventsHandler(w, r.WithContext(auth.WithIdentity(r.Context(), tc.id)))
+		}))
+		// Viewers see nothing to tell the stream has caught up, so it is
+		// read for a while.
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		eventBus.Publish(events.Event{Type: "session.ready", SessionID: "s-alice", Owner: "alice"})
+		eventBus.Publish(events.Event{Type: "session.ready", SessionID: "s-bob", Owner: "bob"})
+		eventBus.Publish(events.Event{Type: "server.memory_pressure", SessionID: "server"})
+
+		var got []string
+		for sc := bufio.NewScanner(resp.Body); sc.Scan(); {
+			if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				for _, id := range []string{"s-alice", "s-bob", "server"} {
+					if strings.Contains(data, `"session_id":"`+id+`"`) {
+						got = append(got, id)
+					}
+				}
+			}
+		}
+		cancel()
+		resp.Body.Close()
+		srv.Close()
+
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s (%v) got events of %v, want %v", tc.id.Name, tc.id.Role, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"browser-server/session"
+)
+
+// feedRepeat is how often feedScreencast repeats the last frame while the
+// page does not change, so encoders keep producing key frames for viewers
+// that join and ingests do not time out.
+const feedRepeat = 500 * time.Millisecond
+
+// ffmpegPath is the ffmpeg that encodes screencasts for WHIP video tracks,
+// SFU broadcasts and restreams (FFMPEG_PATH, default "ffmpeg" on the PATH).
+var ffmpegPath = "ffmpeg"
+
+// mjpegInput makes ffmpeg read the screencast's JPEG frames from stdin,
+// timed as they arrive.
+var mjpegInput = []string{
+	"-hide_banner", "-loglevel", "error",
+	"-f", "mjpeg", "-use_wallclock_as_timestamps", "1", "-i", "pipe:0",
+}
+
+// evenSize rounds frames down to even dimensions, which the encoders'
+// chroma subsampling needs.
+const evenSize = "scale=trunc(iw/2)*2:trunc(ih/2)*2"
+
+// setupFFmpeg reads FFMPEG_PATH.
+func setupFFmpeg() error {
+	v := os.Getenv("FFMPEG_PATH")
+	if v == "" {
+		return nil
+	}
+	if _, err := exec.LookPath(v); err != nil {
+		return fmt.Errorf("FFMPEG_PATH: %w", err)
+	}
+	ffmpegPath = v
+	return nil
+}
+
+// feedScreencast writes a session's frames to w, one more viewer of its
+// shared screencast, until ctx ends or w fails. The last frame is written
+// again every feedRepeat while no new one comes. It closes w when done.
+func feedScreencast(ctx context.Context, sess *session.Session, w io.WriteCloser) error {
+	viewer, err := sess.Watch(0)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	go func() {
+		defer w.Close()
+		defer viewer.Close()
+		repeat := time.NewTimer(feedRepeat)
+		defer repeat.Stop()
+		var last []byte
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case f, ok := <-viewer.C:
+				if !ok {
+					return
+				}
+				last = f.Data
+			case <-repeat.C:
+			}
+			repeat.Reset(feedRepeat)
+			if last == nil {
+				continue
+			}
+			if _, err := w.Write(last); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"browser-server/session"
+)
+
+// fontPacks are the font packs sessions may install, keyed by name.
+var fontPacks map[string]session.FontPack
+
+// setupFonts loads the font packs in FONT_PACKS_DIR, one per
+// subdirectory.
+func setupFonts() error {
+	dir := os.Getenv("FONT_PACKS_DIR")
+	if dir == "" {
+		return nil
+	}
+	packs, err := session.LoadFontPacks(dir)
+	if err != nil {
+		return err
+	}
+	fontPacks = packs
+	log.Printf("Loaded %d font packs from %s", len(packs), dir)
+	return nil
+}
+
+// selectFontPacks looks up the packs a request named.
+func selectFontPacks(names []string) ([]session.FontPack, error) {
+	var packs []session.FontPack
+	for _, name := range names {
+		p, ok := fontPacks[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown font pack %q", name)
+		}
+		packs = append(packs, p)
+	}
+	return packs, nil
+}
+
+// CapabilitiesResponse describes what pages on this worker can render.
+type CapabilitiesResponse struct {
+	FontPacks []session.FontPack `json:"font_packs"`
+	// SystemFonts are the font families every session has.
+	SystemFonts []string `json:"system_fonts"`
+	// Languages are the languages the system fonts cover; font packs add
+	// theirs.
+	Languages []string `json:"languages"`
+}
+
+// capabilitiesHandler reports the font packs, fonts and languages of this
+// worker, so clients know which fonts and locale to ask for.
+// GET /capabilities
+func capabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	resp := CapabilitiesResponse{
+		FontPacks:   []session.FontPack{},
+		SystemFonts: session.SystemFontFamilies(),
+		Languages:   session.SystemFontLanguages(),
+	}
+	for _, p := range fontPacks {
+		resp.FontPacks = append(resp.FontPacks, p)
+	}
+	slices.SortFunc(resp.FontPacks, func(a, b session.FontPack) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
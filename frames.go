@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+var framesUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// frameMessage is one frame pushed to a /frames client. Frame is the JPEG,
+// base64-encoded by encoding/json.
+type frameMessage struct {
+	Frame    []byte           `json:"frame"`
+	TS       int64            `json:"ts"`
+	Seq      uint64           `json:"seq"`
+	Viewport session.Viewport `json:"viewport"`
+}
+
+// frameCommand is sent by a /frames client to adjust its stream. Omitted
+// fields are left unchanged.
+type frameCommand struct {
+	FPS     *float64 `json:"fps"`
+	Quality *int     `json:"quality"`
+}
+
+// fps returns the frame rate the command asks for, zero for every frame,
+// and whether it asks for a valid one.
+func (c frameCommand) fps() (float64, bool) {
+	if c.FPS == nil || !(*c.FPS >= 0 && *c.FPS <= maxPreviewFPS) {
+		return 0, false
+	}
+	return *c.FPS, true
+}
+
+// quality returns the JPEG quality the command asks for and whether it
+// asks for a valid one.
+func (c frameCommand) quality() (int, bool) {
+	if c.Quality == nil || *c.Quality < 1 || *c.Quality > 100 {
+		return 0, false
+	}
+	return *c.Quality, true
+}
+
+// framesHandler streams the session's page over a WebSocket as JSON
+// messages, for viewers that cannot use WHIP but want less latency than
+// MJPEG. Clients send frameCommands to change frame rate and JPEG quality.
+// GET /sessions/{id}/frames?fps=N&quality=Q
+func framesHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	fps := 10.0
+	if v := q.Get("fps"); v != "" {
+		f, err := parseFPS(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fps = f
+	}
+	quality := session.ScreencastQuality
+	if v := q.Get("quality"); v != "" {
+		n, err := parseQuality(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		quality = n
+	}
+
+	viewer, err := sess.Watch(fps)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer viewer.Close()
+
+	conn, err := framesUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Frames: failed to upgrade connection:", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+
+	// Commands are read on their own goroutine; quality is handed to the
+	// writer through a channel so only it touches the current value.
+	qualities := make(chan int, 1)
+	go func() {
+		defer cancel()
+		for {
+			var cmd frameCommand
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			if fps, ok := cmd.fps(); ok {
+				viewer.SetMaxFPS(fps)
+			}
+			if quality, ok := cmd.quality(); ok {
+				select {
+				case <-qualities:
+				default:
+				}
+				qualities <- quality
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "stream ended"), time.Now().Add(time.Second))
+			return
+		case quality = <-qualities:
+		case frame, ok := <-viewer.C:
+			if !ok {
+				return
+			}
+			data := frame.Data
+			if quality < session.ScreencastQuality {
+				if d, err := reencodeJPEG(data, quality); err == nil {
+					data = d
+				}
+			}
+			msg := frameMessage{
+				Frame:    data,
+				TS:       frame.Time.UnixMilli(),
+				Seq:      frame.Seq,
+				Viewport: frame.Viewport,
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+			sess.CountStreamBytes(len(data))
+		}
+	}
+}
+
+// reencodeJPEG lowers the quality of a JPEG frame.
+func reencodeJPEG(data []byte, quality int) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseQuality parses a JPEG quality between 1 and 100.
+func parseQuality(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > 100 {
+		return 0, fmt.Errorf("quality must be between 1 and 100")
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestReencodeJPEG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8(x ^ y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := reencodeJPEG(buf.Bytes(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) >= buf.Len() {
+		t.Errorf("quality 10 frame is %d bytes, not smaller than the %d byte original", len(out), buf.Len())
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("re-encoded frame does not decode: %v", err)
+	}
+}
+
+func TestParseQuality(t *testing.T) {
+	for v, ok := range map[string]bool{"1": true, "100": true, "0": false, "101": false, "high": false} {
+		if _, err := parseQuality(v); (err == nil) != ok {
+			t.Errorf("parseQuality(%q) error = %v", v, err)
+		}
+	}
+}
+
+// FuzzScreencastParams checks that the frame rate and quality viewers ask
+// for, in query strings or frame commands, are either refused or in range.
+func FuzzScreencastParams(f *testing.F) {
+	f.Add("10", "80", []byte(`{"fps":5,"quality":40}`))
+	f.Add("0.5", "1", []byte(`{"fps":0}`))
+	f.Add("NaN", "100", []byte(`{"quality":101}`))
+	f.Add("+Inf", "0x10", []byte(`{"fps":1e308,"quality":-1}`))
+	f.Add("1e-400", " 50", []byte(`{"fps":"10"}`))
+	f.Fuzz(func(t *testing.T, fps, quality string, command []byte) {
+		if v, err := parseFPS(fps); err == nil && !(v > 0 && v <= maxPreviewFPS) {
+			t.Errorf("parseFPS(%q) = %v", fps, v)
+		}
+		if v, err := parseQuality(quality); err == nil && (v < 1 || v > 100) {
+			t.Errorf("parseQuality(%q) = %d", quality, v)
+		}
+		var cmd frameCommand
+		if json.Unmarshal(command, &cmd) != nil {
+			return
+		}
+		if v, ok := cmd.fps(); ok && !(v >= 0 && v <= maxPreviewFPS) {
+			t.Errorf("fps of %s = %v", command, v)
+		}
+		if v, ok := cmd.quality(); ok && (v < 1 || v > 100) {
+			t.Errorf("quality of %s = %d", command, v)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+
+	"browser-server/session"
+)
+
+// setupFrameScheduler reads SCREENCAST_WORKERS and SCREENCAST_FPS_BUDGET
+// and starts the workers that redact, watermark and annotate the
+// screencast frames of all sessions, taking turns between sessions.
+func setupFrameScheduler(sessions *session.Manager) error {
+	workers := runtime.NumCPU()
+	if v := os.Getenv("SCREENCAST_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("SCREENCAST_WORKERS must be a positive number")
+		}
+		workers = n
+	}
+	var budget float64
+	if v := os.Getenv("SCREENCAST_FPS_BUDGET"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("SCREENCAST_FPS_BUDGET must be a number of frames per second")
+		}
+		budget = f
+	}
+	sessions.SetFrameScheduler(session.NewFrameScheduler(workers, budget))
+	return nil
+}
+
+// frameSchedulerStatsHandler reports how busy the screencast workers are
+// and how many frames they skipped to keep up.
+// GET /admin/screencast
+func frameSchedulerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	sched := requestSessions(r).FrameScheduler()
+	if sched == nil {
+		http.Error(w, "No frame scheduler is running", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sched.Stats())
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxGalleryTitle and maxGalleryDescription bound what a listing shows.
+	maxGalleryTitle       = 100
+	maxGalleryDescription = 500
+	// galleryPage is the public gallery page.
+	galleryPage = "./dashboard/gallery.html"
+)
+
+var (
+	// galleryEnabled turns on the public gallery (GALLERY_ENABLED).
+	galleryEnabled bool
+	// galleryFPS caps the frame rate of gallery previews (GALLERY_FPS).
+	galleryFPS = 5.0
+
+	galleryMu sync.Mutex
+	// galleryListings are the sessions opted in to the gallery, by ID.
+	galleryListings = map[string]GalleryListing{}
+)
+
+// GalleryListing is how a session opted in to the public gallery is shown
+// there.
+type GalleryListing struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (l GalleryListing) validate() error {
+	if len(l.Title) > maxGalleryTitle {
+		return fmt.Errorf("gallery title longer than %d bytes", maxGalleryTitle)
+	}
+	if len(l.Description) > maxGalleryDescription {
+		return fmt.Errorf("gallery description longer than %d bytes", maxGalleryDescription)
+	}
+	return nil
+}
+
+// setupGallery reads GALLERY_ENABLED and GALLERY_FPS.
+func setupGallery(sessions *session.Manager) error {
+	if v := os.Getenv("GALLERY_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("GALLERY_ENABLED: %w", err)
+		}
+		galleryEnabled = b
+	}
+	if v := os.Getenv("GALLERY_FPS"); v != "" {
+		f, err := parseFPS(v)
+		if err != nil {
+			return fmt.Errorf("GALLERY_FPS: %w", err)
+		}
+		galleryFPS = f
+	}
+	if galleryEnabled {
+		sessions.Observe(galleryObserver{})
+		log.Printf("Gallery: public gallery enabled at /gallery")
+	}
+	return nil
+}
+
+// galleryObserver takes stopped sessions out of the gallery.
+type galleryObserver struct{ session.NopObserver }
+
+func (galleryObserver) SessionStopped(s *session.Session) {
+	unlistSession(s.ID)
+}
+
+// listSession adds a session to the gallery or updates its listing.
+func listSession(id string, l GalleryListing) {
+	galleryMu.Lock()
+	defer galleryMu.Unlock()
+	galleryListings[id] = l
+}
+
+func unlistSession(id string) {
+	galleryMu.Lock()
+	defer galleryMu.Unlock()
+	delete(galleryListings, id)
+}
+
+// galleryListing returns the listing of a session, if it is in the gallery.
+func galleryListing(id string) (GalleryListing, bool) {
+	galleryMu.Lock()
+	defer galleryMu.Unlock()
+	l, ok := galleryListings[id]
+	return l, ok
+}
+
+// galleryHandler puts the session in the public gallery, or updates its
+// listing (PUT), or takes it out again (DELETE).
+// PUT /sessions/{id}/gallery {"title": "...", "description": "..."}
+// DELETE /sessions/{id}/gallery
+func galleryHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		unlistSession(sess.ID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !galleryEnabled {
+		http.Error(w, "The gallery is disabled", http.StatusConflict)
+		return
+	}
+	var l GalleryListing
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := l.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	listSession(sess.ID, l)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+// GalleryEntry is a session as the public gallery lists it. It leaves out
+// everything that would let a viewer reach the session other than through
+// its view-only preview.
+type GalleryEntry struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title,omitempty"`
+	Description string        `json:"description,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	State       session.State `json:"state"`
+	PreviewURL  string        `json:"preview_url"`
+}
+
+// registerGallery mounts the public gallery, which needs no credentials:
+// the page, the list of opted-in sessions and their previews.
+func registerGallery(r *mux.Router) {
+	r.Handle("/gallery", restrictNetwork(groupGallery, http.HandlerFunc(galleryPageHandler))).Methods("GET")
+	r.Handle(apiPrefix+"/gallery/sessions", restrictNetwork(groupGallery, http.HandlerFunc(gallerySessionsHandler))).Methods("GET")
+	r.Handle(apiPrefix+"/gallery/sessions/{id}/preview", restrictNetwork(groupGallery, http.HandlerFunc(galleryPreviewHandler))).Methods("GET")
+}
+
+// galleryPageHandler serves the gallery page.
+// GET /gallery
+func galleryPageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, galleryPage)
+}
+
+// gallerySessionsHandler lists the sessions in the gallery, oldest first.
+// GET /v1/gallery/sessions
+func gallerySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	entries := []GalleryEntry{}
+	for _, s := range requestSessions(r).ListSessions() {
+		l, ok := galleryListing(s.ID)
+		if !ok {
+			continue
+		}
+		entries = append(entries, GalleryEntry{
+			ID:          s.ID,
+			Title:       l.Title,
+			Description: l.Description,
+			CreatedAt:   s.CreatedAt,
+			State:       s.State(),
+			PreviewURL:  forwardedPrefix(r) + apiPrefix + "/gallery/sessions/" + s.ID + "/preview",
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	writeJSONWithETag(w, r, entries)
+}
+
+// galleryPreviewHandler streams a gallery session's page as MJPEG at up to
+// GALLERY_FPS. Sessions not in the gallery are reported as not found.
+// GET /v1/gallery/sessions/{id}/preview?fps=N
+func galleryPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sess, ok := requestSessions(r).GetSession(id)
+	if _, listed := galleryListing(id); !ok || !listed {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	fps := galleryFPS
+	if v := r.URL.Query().Get("fps"); v != "" {
+		f, err := parseFPS(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fps = min(f, galleryFPS)
+	}
+	streamPreview(w, r, sess, fps)
+}
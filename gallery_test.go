@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"browser-server/auth"
+	"browser-server/session"
+)
+
+func TestGalleryIsPublic(t *testing.T) {
+	defer func(enabled bool, keys *auth.Store) {
+		galleryEnabled, keyStore = enabled, keys
+	}(galleryEnabled, keyStore)
+	galleryEnabled = true
+	keyStore = &auth.Store{}
+
+	r := newRouter(newServices(session.NewManager(), nil), []routeGroup{groupGallery})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/gallery/sessions", nil))
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("gallery list: %d %q", w.Code, w.Body.String())
+	}
+
+	// Sessions that did not opt in cannot be watched through the gallery.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/gallery/sessions/abc/preview", nil))
+	if w.Code != 404 {
+		t.Errorf("preview of an unlisted session: %d", w.Code)
+	}
+
+	// Nothing else is served alongside it.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/sessions/abc/preview", nil))
+	if w.Code != 404 {
+		t.Errorf("session preview on a gallery-only router: %d", w.Code)
+	}
+}
+
+func TestGalleryListingValidate(t *testing.T) {
+	if err := (GalleryListing{Title: "Demo", Description: "An agent booking a flight"}).validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (GalleryListing{Title: strings.Repeat("x", maxGalleryTitle+1)}).validate(); err == nil {
+		t.Error("overlong title accepted")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Watchdog defaults for new sessions (HEALTH_CHECK_INTERVAL,
+// HEALTH_CHECK_TIMEOUT, AUTO_RESTART_UNHEALTHY).
+var (
+	healthCheckInterval = 15 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+	autoRestart         = false
+)
+
+// setupHealth reads the watchdog settings for new sessions.
+func setupHealth() error {
+	if v := os.Getenv("HEALTH_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		healthCheckInterval = d
+	}
+	if v := os.Getenv("HEALTH_CHECK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		healthCheckTimeout = d
+	}
+	if v := os.Getenv("AUTO_RESTART_UNHEALTHY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		autoRestart = b
+	}
+	return nil
+}
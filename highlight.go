@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// HighlightRequest asks for an element to be highlighted in a session's
+// page.
+type HighlightRequest struct {
+	Selector string `json:"selector"`
+	// DurationMS is how long the highlight shows, 3 seconds if zero and
+	// at most a minute.
+	DurationMS int64 `json:"duration_ms,omitempty"`
+}
+
+// highlightHandler highlights the first element matching a CSS selector
+// with DevTools' inspect overlay, so operators can find it in the live
+// preview while debugging selectors (POST), or takes the highlight away
+// (DELETE).
+// POST, DELETE /sessions/{id}/highlight
+func highlightHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := sess.HideHighlight(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req HighlightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Selector == "" {
+		http.Error(w, "selector is required", http.StatusBadRequest)
+		return
+	}
+	if d := time.Duration(req.DurationMS) * time.Millisecond; d < 0 || d > session.MaxHighlightDuration {
+		http.Error(w, "duration_ms must be between 0 and 60000", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	h, err := sess.Highlight(ctx, req.Selector, time.Duration(req.DurationMS)*time.Millisecond)
+	switch {
+	case errors.Is(err, session.ErrNoMatch):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, session.ErrInvalidSelector):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, session.ErrNoPage):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"browser-server/auth"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Listener serves a listener's routes over HTTP/3 on a UDP port.
+// WebSocket routes (CDP and frames) need HTTP/1.1 and stay on TCP.
+type http3Listener struct {
+	srv  *http3.Server
+	conn net.PacketConn
+}
+
+// listenHTTP3 opens an HTTP/3 server on the UDP address addr serving
+// handler with the certificate in certFile and keyFile. base holds the
+// listener's TLS settings, such as client certificate verification, and
+// keys, if not nil, overrides the API keys as on the public listener.
+func listenHTTP3(addr string, handler http.Handler, base *tls.Config, certFile, keyFile string, keys *auth.Store) (*http3Listener, error) {
+	if certFile == "" {
+		return nil, errors.New("HTTP/3 needs a TLS certificate")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+	if base != nil {
+		tlsConfig = base.Clone()
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+	}
+	if keys != nil {
+		srv.ConnContext = func(ctx context.Context, _ *quic.Conn) context.Context {
+			return context.WithValue(ctx, listenerKeysKey{}, keys)
+		}
+	}
+	return &http3Listener{srv: srv, conn: conn}, nil
+}
+
+func (l *http3Listener) serve() {
+	log.Printf("HTTP/3 listening on %s", l.conn.LocalAddr())
+	if err := l.srv.Serve(l.conn); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, quic.ErrServerClosed) {
+		log.Fatalf("HTTP/3: %v", err)
+	}
+}
+
+// shutdown lets open requests finish until ctx is done.
+func (l *http3Listener) shutdown(ctx context.Context) {
+	l.srv.Shutdown(ctx)
+	l.srv.Close()
+	l.conn.Close()
+}
+
+// advertiseHTTP3 announces the HTTP/3 port in Alt-Svc on responses sent
+// over TCP, so browsers switch to it for later requests.
+func advertiseHTTP3(h3 *http3Listener, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			h3.srv.SetQUICHeaders(w.Header())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
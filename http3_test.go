@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// selfSignedCert writes a certificate for 127.0.0.1 and its key to dir.
+func selfSignedCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestHTTP3(t *testing.T) {
+	if _, err := listenHTTP3("127.0.0.1:0", http.NotFoundHandler(), nil, "", "", nil); err == nil {
+		t.Error("HTTP/3 without a certificate accepted")
+	}
+
+	certFile, keyFile := selfSignedCert(t, t.TempDir())
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+	h3, err := listenHTTP3("127.0.0.1:0", handler, nil, certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go h3.serve()
+	defer h3.shutdown(context.Background())
+
+	client := &http.Client{Transport: &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, Timeout: 5 * time.Second}
+	res, err := client.Get("https://" + h3.conn.LocalAddr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "HTTP/3.0" {
+		t.Errorf("served over %q", body)
+	}
+
+	// TCP responses announce the HTTP/3 port.
+	rec := httptest.NewRecorder()
+	advertiseHTTP3(h3, handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if alt := rec.Header().Get("Alt-Svc"); !strings.HasPrefix(alt, `h3=":`) {
+		t.Errorf("Alt-Svc = %q", alt)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// iceServer is a STUN or TURN server WHIP peer connections use, as listed
+// in ICE_SERVERS_FILE.
+type iceServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+	// Secret, instead of a fixed username and credential, is shared with
+	// the TURN server (coturn's use-auth-secret): every WHIP resource gets
+	// its own credentials, valid for TTL (an hour by default).
+	Secret string `json:"secret,omitempty"`
+	TTL    string `json:"ttl,omitempty"`
+
+	ttl time.Duration
+}
+
+// defaultTURNCredentialTTL is how long time-limited TURN credentials are
+// valid by default.
+const defaultTURNCredentialTTL = time.Hour
+
+// iceServers are the servers WHIP peer connections use and advertise to
+// viewers, public STUN servers unless ICE_SERVERS or ICE_SERVERS_FILE
+// say otherwise.
+var iceServers = []iceServer{
+	{URLs: []string{"stun:stun.l.google.com:19302"}},
+	{URLs: []string{"stun:stun.cloudflare.com:3478"}},
+}
+
+// setupICEServers reads ICE_SERVERS, a comma-separated list of STUN URLs,
+// and ICE_SERVERS_FILE, a JSON list of servers with credentials, whose
+// servers follow those of ICE_SERVERS.
+func setupICEServers() error {
+	var servers []iceServer
+	configured := false
+	if v := os.Getenv("ICE_SERVERS"); v != "" {
+		configured = true
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				servers = append(servers, iceServer{URLs: []string{u}})
+			}
+		}
+	}
+	if path := os.Getenv("ICE_SERVERS_FILE"); path != "" {
+		configured = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var fromFile []iceServer
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		servers = append(servers, fromFile...)
+	}
+	if !configured {
+		return nil
+	}
+	for i := range servers {
+		if err := servers[i].validate(); err != nil {
+			return err
+		}
+	}
+	iceServers = servers
+	log.Printf("Using %d ICE servers for WHIP", len(servers))
+	return nil
+}
+
+func (s *iceServer) validate() error {
+	if len(s.URLs) == 0 {
+		return fmt.Errorf("ICE server has no URLs")
+	}
+	turn := false
+	for _, u := range s.URLs {
+		scheme, _, _ := strings.Cut(u, ":")
+		switch scheme {
+		case "stun", "stuns":
+		case "turn", "turns":
+			turn = true
+		default:
+			return fmt.Errorf("ICE server URL %q must be stun:, stuns:, turn: or turns:", u)
+		}
+	}
+	if s.Secret != "" && s.Credential != "" {
+		return fmt.Errorf("ICE server %s has both a secret and a credential", s.URLs[0])
+	}
+	if turn && s.Secret == "" && (s.Username == "" || s.Credential == "") {
+		return fmt.Errorf("TURN server %s needs a username and credential, or a secret", s.URLs[0])
+	}
+	s.ttl = defaultTURNCredentialTTL
+	if s.TTL != "" {
+		d, err := time.ParseDuration(s.TTL)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("ICE server %s has an invalid ttl %q", s.URLs[0], s.TTL)
+		}
+		s.ttl = d
+	}
+	return nil
+}
+
+// whipICEServers returns the ICE servers for a WHIP resource, with TURN
+// credentials for user that expire after each server's TTL from now.
+func whipICEServers(user string, now time.Time) []webrtc.ICEServer {
+	servers := make([]webrtc.ICEServer, 0, len(iceServers))
+	for _, s := range iceServers {
+		server := webrtc.ICEServer{URLs: s.URLs}
+		switch {
+		case s.Secret != "":
+			server.Username, server.Credential = turnCredentials(s.Secret, user, now.Add(s.ttl))
+		case s.Username != "":
+			server.Username, server.Credential = s.Username, s.Credential
+		}
+		if server.Username != "" {
+			server.CredentialType = webrtc.ICECredentialTypePassword
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// turnCredentials returns the time-limited credentials of the TURN REST
+// API: the username is the expiry time and user, and the password its
+// HMAC-SHA1 under the secret shared with the TURN server.
+func turnCredentials(secret, user string, expires time.Time) (username, credential string) {
+	username = strconv.FormatInt(expires.Unix(), 10) + ":" + user
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// addICEServerLinks advertises ICE servers to a WHIP client in Link
+// headers, one per URL.
+func addICEServerLinks(h http.Header, servers []webrtc.ICEServer) {
+	for _, s := range servers {
+		for _, u := range s.URLs {
+			link := "<" + u + `>; rel="ice-server"`
+			if s.Username != "" {
+				if cred, ok := s.Credential.(string); ok {
+					link += fmt.Sprintf(`; username=%q; credential=%q; credential-type="password"`, s.Username, cred)
+				}
+			}
+			h.Add("Link", link)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSetupICEServers(t *testing.T) {
+	defer func(saved []iceServer) { iceServers = saved }(iceServers)
+	path := filepath.Join(t.TempDir(), "ice.json")
+	os.WriteFile(path, []byte(`[
+		{"urls": ["turn:turn.example.com:3478?transport=udp", "turns:turn.example.com:5349"], "username": "u", "credential": "p"},
+		{"urls": ["turn:turn2.example.com:3478"], "secret": "shared", "ttl": "10m"}
+	]`), 0600)
+	t.Setenv("ICE_SERVERS", "stun:stun.example.com:3478")
+	t.Setenv("ICE_SERVERS_FILE", path)
+	if err := setupICEServers(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	servers := whipICEServers("session-1", now)
+	if len(servers) != 3 || servers[0].Username != "" || servers[1].Username != "u" || servers[1].Credential != "p" {
+		t.Fatalf("servers = %+v", servers)
+	}
+	if servers[2].Username != "1700000600:session-1" {
+		t.Errorf("time-limited username = %q", servers[2].Username)
+	}
+	mac := hmac.New(sha1.New, []byte("shared"))
+	mac.Write([]byte(servers[2].Username))
+	if servers[2].Credential != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("time-limited credential = %v", servers[2].Credential)
+	}
+
+	h := http.Header{}
+	addICEServerLinks(h, servers[:2])
+	want := []string{
+		`<stun:stun.example.com:3478>; rel="ice-server"`,
+		`<turn:turn.example.com:3478?transport=udp>; rel="ice-server"; username="u"; credential="p"; credential-type="password"`,
+		`<turns:turn.example.com:5349>; rel="ice-server"; username="u"; credential="p"; credential-type="password"`,
+	}
+	if links := h.Values("Link"); len(links) != len(want) {
+		t.Fatalf("links = %q", links)
+	} else {
+		for i := range want {
+			if links[i] != want[i] {
+				t.Errorf("link %d = %s, want %s", i, links[i], want[i])
+			}
+		}
+	}
+}
+
+func TestSetupICEServersRejects(t *testing.T) {
+	defer func(saved []iceServer) { iceServers = saved }(iceServers)
+	for _, v := range []string{"http://stun.example.com", "turn:turn.example.com:3478"} {
+		t.Setenv("ICE_SERVERS", v)
+		if err := setupICEServers(); err == nil {
+			t.Errorf("ICE_SERVERS=%s accepted", v)
+		}
+	}
+}
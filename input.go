@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
+)
+
+// inputTimeout bounds how long one input event may take to dispatch.
+const inputTimeout = 5 * time.Second
+
+// errForbiddenInput is sent to viewers who may watch a session but not
+// drive it.
+var errForbiddenInput = errors.New("this viewer may not send input to the session")
+
+// inputError is sent back on the input socket for an event that failed.
+type inputError struct {
+	Error string `json:"error"`
+}
+
+// inputHandler drives the session's page with mouse and keyboard input
+// read from a WebSocket as JSON session.InputEvents, one per message.
+// Events that fail are answered with an inputError; the socket stays open.
+// GET /sessions/{id}/input
+func inputHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	// Signed input URLs are only handed to embeds granted control.
+	if !canControl(r, sess) && !signedFor(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	conn, err := framesUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Input: failed to upgrade connection:", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var e session.InputEvent
+		if err := conn.ReadJSON(&e); err != nil {
+			return
+		}
+		ectx, ecancel := context.WithTimeout(ctx, inputTimeout)
+		err := sess.DispatchInput(ectx, e)
+		ecancel()
+		if err != nil {
+			if err := conn.WriteJSON(inputError{Error: err.Error()}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleInputChannel drives the session's page with the JSON
+// session.InputEvents received on a WHIP viewer's "input" data channel,
+// like inputHandler does for WebSockets. Viewers without control are told
+// so and the channel is closed.
+func handleInputChannel(ctx context.Context, sess *session.Session, d *webrtc.DataChannel, control bool) {
+	reply := func(err error) {
+		msg, _ := json.Marshal(inputError{Error: err.Error()})
+		d.SendText(string(msg))
+	}
+	if !control {
+		d.OnOpen(func() {
+			reply(errForbiddenInput)
+			d.Close()
+		})
+		return
+	}
+	// Messages are handled one at a time, in order.
+	d.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var e session.InputEvent
+		if err := json.Unmarshal(msg.Data, &e); err != nil {
+			reply(err)
+			return
+		}
+		ectx, cancel := context.WithTimeout(ctx, inputTimeout)
+		defer cancel()
+		if err := sess.DispatchInput(ectx, e); err != nil {
+			reply(err)
+		}
+	})
+}
@@ -0,0 +1,261 @@
+// Package cdp is a minimal Chrome DevTools Protocol client for the
+// server's own connections to the browser. It allocates command IDs per
+// connection, matches responses to their commands and surfaces protocol
+// errors.
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrClosed is returned for commands on a closed connection.
+var ErrClosed = errors.New("cdp: connection closed")
+
+// Message is a command response or an event.
+type Message struct {
+	ID        int64           `json:"id,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *Error          `json:"error,omitempty"`
+}
+
+// Error is an error returned by the browser for a command.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Data != "" {
+		return fmt.Sprintf("cdp: %s (%d): %s", e.Message, e.Code, e.Data)
+	}
+	return fmt.Sprintf("cdp: %s (%d)", e.Message, e.Code)
+}
+
+// DefaultTimeout bounds calls whose context has no deadline.
+const DefaultTimeout = 10 * time.Second
+
+// Client is a CDP connection. It is safe for concurrent use.
+type Client struct {
+	// Timeout bounds calls whose context has no deadline.
+	Timeout time.Duration
+
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan Message
+	events  chan Message
+	closed  bool
+	done    chan struct{}
+}
+
+// Dial connects to a DevTools WebSocket URL.
+func Dial(ctx context.Context, url string) (*Client, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient wraps an established DevTools WebSocket connection.
+func NewClient(conn *websocket.Conn) *Client {
+	c := &Client{
+		Timeout: DefaultTimeout,
+		conn:    conn,
+		pending: make(map[int64]chan Message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Events returns the channel on which events are delivered. Events
+// received before the first call are discarded. The channel is closed when
+// the connection ends. Delivery blocks the connection while the channel is
+// full, so event handlers must not wait on Call; use Send instead.
+func (c *Client) Events() <-chan Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.events == nil {
+		c.events = make(chan Message, 64)
+		if c.closed {
+			close(c.events)
+		}
+	}
+	return c.events
+}
+
+// Done is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Call sends a command and waits for its result, returning the browser's
+// error if the command failed.
+func (c *Client) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	return c.CallSession(ctx, "", method, params)
+}
+
+// CallSession is Call for a target attached with flatten=true.
+func (c *Client) CallSession(ctx context.Context, sessionID, method string, params interface{}) (json.RawMessage, error) {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	ch := make(chan Message, 1)
+	id, err := c.send(sessionID, method, params, ch)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, ErrClosed
+		}
+		if msg.Error != nil {
+			return nil, fmt.Errorf("%s: %w", method, msg.Error)
+		}
+		return msg.Result, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+// Send issues a command without waiting for its result.
+func (c *Client) Send(method string, params interface{}) error {
+	_, err := c.send("", method, params, nil)
+	return err
+}
+
+// SendSession is Send for a target attached with flatten=true.
+func (c *Client) SendSession(sessionID, method string, params interface{}) error {
+	_, err := c.send(sessionID, method, params, nil)
+	return err
+}
+
+func (c *Client) send(sessionID, method string, params interface{}, ch chan Message) (int64, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, ErrClosed
+	}
+	c.nextID++
+	id := c.nextID
+	if ch != nil {
+		c.pending[id] = ch
+	}
+	c.mu.Unlock()
+
+	if params == nil {
+		params = struct{}{}
+	}
+	msg := struct {
+		ID        int64       `json:"id"`
+		SessionID string      `json:"sessionId,omitempty"`
+		Method    string      `json:"method"`
+		Params    interface{} `json:"params"`
+	}{id, sessionID, method, params}
+
+	c.writeMu.Lock()
+	err := c.conn.WriteJSON(msg)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return 0, fmt.Errorf("%s: %w", method, err)
+	}
+	return id, nil
+}
+
+// Session returns a handle for sending commands to an attached target.
+func (c *Client) Session(sessionID string) *Session {
+	return &Session{c: c, ID: sessionID}
+}
+
+// Session is a target attached to a Client with flatten=true.
+type Session struct {
+	c  *Client
+	ID string
+}
+
+// Call sends a command to the target and waits for its result.
+func (s *Session) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	return s.c.CallSession(ctx, s.ID, method, params)
+}
+
+// Send sends a command to the target without waiting for its result.
+func (s *Session) Send(method string, params interface{}) error {
+	return s.c.SendSession(s.ID, method, params)
+}
+
+// Decode unmarshals an event's parameters into v.
+func (m Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Params, v)
+}
+
+// Close closes the connection. Pending calls fail with ErrClosed.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) readLoop() {
+	defer func() {
+		c.mu.Lock()
+		c.closed = true
+		for id, ch := range c.pending {
+			close(ch)
+			delete(c.pending, id)
+		}
+		if c.events != nil {
+			close(c.events)
+		}
+		c.mu.Unlock()
+		close(c.done)
+	}()
+
+	for {
+		var msg Message
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		if msg.ID != 0 {
+			c.mu.Lock()
+			ch, ok := c.pending[msg.ID]
+			delete(c.pending, msg.ID)
+			c.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		events := c.events
+		c.mu.Unlock()
+		if events != nil {
+			events <- msg
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeBrowser answers every command with its own ID, fails "Bad.method"
+// and emits an event before answering "Page.enable".
+func fakeBrowser(t *testing.T) string {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var cmd struct {
+				ID     int64  `json:"id"`
+				Method string `json:"method"`
+			}
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			switch cmd.Method {
+			case "Bad.method":
+				conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "error": map[string]interface{}{"code": -32601, "message": "'Bad.method' wasn't found"}})
+			case "Page.enable":
+				conn.WriteJSON(map[string]interface{}{"method": "Page.loadEventFired", "params": map[string]interface{}{"timestamp": 1}})
+				fallthrough
+			default:
+				conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "result": map[string]interface{}{"echo": cmd.ID}})
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestClientCallsAndEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := Dial(ctx, fakeBrowser(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	events := c.Events()
+
+	// IDs are allocated per connection and responses matched to callers.
+	for want := 1; want <= 3; want++ {
+		res, err := c.Call(ctx, "Browser.getVersion", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res) != fmt.Sprintf(`{"echo":%d}`, want) {
+			t.Errorf("call %d result = %s", want, res)
+		}
+	}
+
+	var cdpErr *Error
+	if _, err := c.Call(ctx, "Bad.method", nil); !errors.As(err, &cdpErr) || cdpErr.Code != -32601 {
+		t.Errorf("Bad.method error = %v", err)
+	}
+
+	if _, err := c.Call(ctx, "Page.enable", nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if e.Method != "Page.loadEventFired" {
+			t.Errorf("event = %s", e.Method)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event delivered")
+	}
+
+	c.Close()
+	<-c.Done()
+	if _, err := c.Call(ctx, "Browser.getVersion", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("call after close = %v, want ErrClosed", err)
+	}
+}
+
+// FuzzMessage decodes messages as the client reads them from a browser,
+// and their parameters as the server's event handlers do.
+func FuzzMessage(f *testing.F) {
+	f.Add([]byte(`{"id":1,"result":{"product":"Chrome/126"}}`))
+	f.Add([]byte(`{"id":2,"error":{"code":-32601,"message":"'Bad.method' wasn't found","data":"x"}}`))
+	f.Add([]byte(`{"method":"Target.attachedToTarget","params":{"sessionId":"s1","targetInfo":{"targetId":"t1","type":"page","url":"about:blank"},"waitingForDebugger":true}}`))
+	f.Add([]byte(`{"method":"Page.screencastFrame","sessionId":"s1","params":{"data":"/9j/4AAQ","sessionId":3,"metadata":{"timestamp":1.5}}}`))
+	f.Add([]byte(`{"method":"Fetch.requestPaused","params":{"requestId":"r1","request":{"url":"https://example.com","method":"GET","headers":{"A":"b"}},"responseHeaders":[{"name":"a","value":"b"}]}}`))
+	f.Add([]byte(`{"id":-1,"method":7,"params":[]}`))
+	f.Add([]byte(`{"error":null,"result":"x"}`))
+
+	events := []func() any{
+		func() any { return new(TargetCreated) },
+		func() any { return new(TargetCrashed) },
+		func() any { return new(AttachedToTarget) },
+		func() any { return new(DetachedFromTarget) },
+		func() any { return new(ScreencastFrame) },
+		func() any { return new(FrameNavigated) },
+		func() any { return new(JavascriptDialogOpening) },
+		func() any { return new(BindingCalled) },
+		func() any { return new(LoadingFinished) },
+		func() any { return new(ResponseReceived) },
+		func() any { return new(LoadingFailed) },
+		func() any { return new(RequestPaused) },
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var msg Message
+		if json.Unmarshal(data, &msg) != nil {
+			return
+		}
+		if msg.Error != nil && msg.Error.Error() == "" {
+			t.Error("empty error message")
+		}
+		for _, event := range events {
+			msg.Decode(event())
+		}
+
+		// What the client decoded survives being sent on, as the proxy
+		// and event feeds do.
+		out, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatalf("re-encoding %q: %v", data, err)
+		}
+		var again Message
+		if err := json.Unmarshal(out, &again); err != nil {
+			t.Fatalf("decoding re-encoded %q: %v", out, err)
+		}
+		if again.ID != msg.ID || again.Method != msg.Method || again.SessionID != msg.SessionID {
+			t.Errorf("round trip of %q changed the message: %+v, want %+v", data, again, msg)
+		}
+	})
+}
@@ -0,0 +1,657 @@
+package cdp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Caller is a Client or an attached Session.
+type Caller interface {
+	Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+	Send(method string, params interface{}) error
+}
+
+func call(ctx context.Context, c Caller, method string, params, result interface{}) error {
+	res, err := c.Call(ctx, method, params)
+	if err != nil || result == nil {
+		return err
+	}
+	return json.Unmarshal(res, result)
+}
+
+// Browser domain.
+type Browser struct{ Caller }
+
+// Version is the result of Browser.getVersion.
+type Version struct {
+	Product         string `json:"product"`
+	ProtocolVersion string `json:"protocolVersion"`
+	UserAgent       string `json:"userAgent"`
+}
+
+func (d Browser) GetVersion(ctx context.Context) (Version, error) {
+	var v Version
+	err := call(ctx, d, "Browser.getVersion", nil, &v)
+	return v, err
+}
+
+// SetDownloadBehavior saves downloads into dir and reports their progress.
+func (d Browser) SetDownloadBehavior(ctx context.Context, dir string) error {
+	return call(ctx, d, "Browser.setDownloadBehavior", map[string]interface{}{
+		"behavior":      "allow",
+		"downloadPath":  dir,
+		"eventsEnabled": true,
+	}, nil)
+}
+
+// Target domain.
+type Target struct{ Caller }
+
+// TargetInfo describes a browser target.
+type TargetInfo struct {
+	TargetID string `json:"targetId"`
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+}
+
+// TargetCreated is the Target.targetCreated event.
+type TargetCreated struct {
+	TargetInfo TargetInfo `json:"targetInfo"`
+}
+
+// TargetCrashed is the Target.targetCrashed event, raised when a page's
+// renderer crashes.
+type TargetCrashed struct {
+	TargetID  string `json:"targetId"`
+	Status    string `json:"status"`
+	ErrorCode int    `json:"errorCode"`
+}
+
+// AttachedToTarget is the Target.attachedToTarget event.
+type AttachedToTarget struct {
+	SessionID          string     `json:"sessionId"`
+	TargetInfo         TargetInfo `json:"targetInfo"`
+	WaitingForDebugger bool       `json:"waitingForDebugger"`
+}
+
+// DetachedFromTarget is the Target.detachedFromTarget event.
+type DetachedFromTarget struct {
+	SessionID string `json:"sessionId"`
+}
+
+func (d Target) SetDiscoverTargets(ctx context.Context, discover bool) error {
+	return call(ctx, d, "Target.setDiscoverTargets", map[string]interface{}{"discover": discover}, nil)
+}
+
+// SetAutoAttach attaches in flat mode to every target the caller's target
+// creates, such as out-of-process iframes and workers. With
+// waitForDebugger they are paused until Runtime.runIfWaitingForDebugger.
+func (d Target) SetAutoAttach(ctx context.Context, waitForDebugger bool) error {
+	return call(ctx, d, "Target.setAutoAttach", map[string]interface{}{
+		"autoAttach":             true,
+		"waitForDebuggerOnStart": waitForDebugger,
+		"flatten":                true,
+	}, nil)
+}
+
+// AttachToTarget attaches in flat mode and returns the session ID.
+func (d Target) AttachToTarget(ctx context.Context, targetID string) (string, error) {
+	var r struct {
+		SessionID string `json:"sessionId"`
+	}
+	err := call(ctx, d, "Target.attachToTarget", map[string]interface{}{"targetId": targetID, "flatten": true}, &r)
+	return r.SessionID, err
+}
+
+// CreateTarget opens a new page at url and returns its target ID.
+func (d Target) CreateTarget(ctx context.Context, url string) (string, error) {
+	var r struct {
+		TargetID string `json:"targetId"`
+	}
+	err := call(ctx, d, "Target.createTarget", map[string]string{"url": url}, &r)
+	return r.TargetID, err
+}
+
+// DetachFromTarget ends a session made by AttachToTarget, dropping what it
+// set up in the target, such as scripts to evaluate on new documents.
+func (d Target) DetachFromTarget(ctx context.Context, sessionID string) error {
+	return call(ctx, d, "Target.detachFromTarget", map[string]string{"sessionId": sessionID}, nil)
+}
+
+// Page domain.
+type Page struct{ Caller }
+
+// ScreencastOptions are the parameters of Page.startScreencast.
+type ScreencastOptions struct {
+	Format        string `json:"format,omitempty"`
+	Quality       int    `json:"quality,omitempty"`
+	MaxWidth      int    `json:"maxWidth,omitempty"`
+	MaxHeight     int    `json:"maxHeight,omitempty"`
+	EveryNthFrame int    `json:"everyNthFrame,omitempty"`
+}
+
+// ScreencastFrame is the Page.screencastFrame event.
+type ScreencastFrame struct {
+	Data      []byte `json:"data"`
+	SessionID int    `json:"sessionId"`
+	Metadata  struct {
+		Timestamp float64 `json:"timestamp"`
+	} `json:"metadata"`
+}
+
+// FrameNavigated is the Page.frameNavigated event.
+type FrameNavigated struct {
+	Frame struct {
+		ID       string `json:"id"`
+		ParentID string `json:"parentId"`
+		URL      string `json:"url"`
+	} `json:"frame"`
+}
+
+// NavigateResult is the result of Page.navigate.
+type NavigateResult struct {
+	FrameID   string `json:"frameId"`
+	LoaderID  string `json:"loaderId"`
+	ErrorText string `json:"errorText"`
+}
+
+func (d Page) Enable(ctx context.Context) error {
+	return call(ctx, d, "Page.enable", nil, nil)
+}
+
+func (d Page) BringToFront(ctx context.Context) error {
+	return call(ctx, d, "Page.bringToFront", nil, nil)
+}
+
+func (d Page) Navigate(ctx context.Context, url string) (NavigateResult, error) {
+	var r NavigateResult
+	err := call(ctx, d, "Page.navigate", map[string]interface{}{"url": url}, &r)
+	return r, err
+}
+
+func (d Page) StartScreencast(ctx context.Context, opts ScreencastOptions) error {
+	return call(ctx, d, "Page.startScreencast", opts, nil)
+}
+
+// ScreencastFrameAck acknowledges a frame without waiting for the reply,
+// so it can be sent from an event loop.
+func (d Page) ScreencastFrameAck(sessionID int) error {
+	return d.Send("Page.screencastFrameAck", map[string]interface{}{"sessionId": sessionID})
+}
+
+// AddScriptToEvaluateOnNewDocument runs source in every document the page
+// loads from now on, before the document's own scripts.
+func (d Page) AddScriptToEvaluateOnNewDocument(ctx context.Context, source string) error {
+	return call(ctx, d, "Page.addScriptToEvaluateOnNewDocument", map[string]interface{}{"source": source}, nil)
+}
+
+// JavascriptDialogOpening is the Page.javascriptDialogOpening event.
+type JavascriptDialogOpening struct {
+	URL           string `json:"url"`
+	Message       string `json:"message"`
+	Type          string `json:"type"`
+	DefaultPrompt string `json:"defaultPrompt"`
+}
+
+// HandleJavaScriptDialog accepts or dismisses the open dialog. It does
+// not wait for the reply, so it can be sent from an event loop.
+func (d Page) HandleJavaScriptDialog(accept bool, promptText string) error {
+	params := map[string]interface{}{"accept": accept}
+	if promptText != "" {
+		params["promptText"] = promptText
+	}
+	return d.Send("Page.handleJavaScriptDialog", params)
+}
+
+// CaptureScreenshot returns a PNG of the page.
+func (d Page) CaptureScreenshot(ctx context.Context) ([]byte, error) {
+	var r struct {
+		Data []byte `json:"data"`
+	}
+	err := call(ctx, d, "Page.captureScreenshot", map[string]interface{}{"format": "png"}, &r)
+	return r.Data, err
+}
+
+// Runtime domain.
+type Runtime struct{ Caller }
+
+func (d Runtime) Enable(ctx context.Context) error {
+	return call(ctx, d, "Runtime.enable", nil, nil)
+}
+
+// RunIfWaitingForDebugger resumes a target paused by SetAutoAttach. It
+// does not wait for the reply, so it can be sent from an event loop.
+func (d Runtime) RunIfWaitingForDebugger() error {
+	return d.Send("Runtime.runIfWaitingForDebugger", nil)
+}
+
+// BindingCalled is the Runtime.bindingCalled event.
+type BindingCalled struct {
+	Name    string `json:"name"`
+	Payload string `json:"payload"`
+}
+
+// AddBinding exposes a global function to the page's scripts that raises
+// Runtime.bindingCalled with its string argument.
+func (d Runtime) AddBinding(ctx context.Context, name string) error {
+	return call(ctx, d, "Runtime.addBinding", map[string]interface{}{"name": name}, nil)
+}
+
+// Evaluate runs expression and fails if it throws, with an Error of code
+// zero carrying what was thrown.
+func (d Runtime) Evaluate(ctx context.Context, expression string) (json.RawMessage, error) {
+	var r struct {
+		Result           json.RawMessage `json:"result"`
+		ExceptionDetails *struct {
+			Text      string `json:"text"`
+			Exception *struct {
+				Description string `json:"description"`
+			} `json:"exception"`
+		} `json:"exceptionDetails"`
+	}
+	if err := call(ctx, d, "Runtime.evaluate", map[string]interface{}{"expression": expression, "returnByValue": true}, &r); err != nil {
+		return nil, err
+	}
+	if e := r.ExceptionDetails; e != nil {
+		if e.Exception != nil && e.Exception.Description != "" {
+			return nil, &Error{Message: e.Text, Data: e.Exception.Description}
+		}
+		return nil, &Error{Message: e.Text}
+	}
+	return r.Result, nil
+}
+
+// Log domain.
+type Log struct{ Caller }
+
+func (d Log) Enable(ctx context.Context) error {
+	return call(ctx, d, "Log.enable", nil, nil)
+}
+
+// Network domain.
+type Network struct{ Caller }
+
+// NetworkConditions are the parameters of Network.emulateNetworkConditions.
+// Throughputs are in bytes per second; -1 disables throttling.
+type NetworkConditions struct {
+	Offline            bool    `json:"offline"`
+	Latency            float64 `json:"latency"`
+	DownloadThroughput float64 `json:"downloadThroughput"`
+	UploadThroughput   float64 `json:"uploadThroughput"`
+}
+
+// LoadingFinished is the Network.loadingFinished event.
+type LoadingFinished struct {
+	RequestID         string  `json:"requestId"`
+	EncodedDataLength float64 `json:"encodedDataLength"`
+}
+
+// ResponseReceived is the Network.responseReceived event.
+type ResponseReceived struct {
+	RequestID string `json:"requestId"`
+	Response  struct {
+		URL      string `json:"url"`
+		Status   int    `json:"status"`
+		MimeType string `json:"mimeType"`
+	} `json:"response"`
+}
+
+// LoadingFailed is the Network.loadingFailed event.
+type LoadingFailed struct {
+	RequestID string `json:"requestId"`
+	ErrorText string `json:"errorText"`
+}
+
+func (d Network) Enable(ctx context.Context) error {
+	return call(ctx, d, "Network.enable", nil, nil)
+}
+
+// EnableBuffers enables the domain keeping response bodies of up to
+// resource bytes, and at most total bytes of them, for GetResponseBody.
+func (d Network) EnableBuffers(ctx context.Context, resource, total int64) error {
+	return call(ctx, d, "Network.enable", map[string]int64{
+		"maxResourceBufferSize": resource,
+		"maxTotalBufferSize":    total,
+	}, nil)
+}
+
+// GetResponseBody returns the body of a finished response.
+func (d Network) GetResponseBody(ctx context.Context, requestID string) ([]byte, error) {
+	var r struct {
+		Body          string `json:"body"`
+		Base64Encoded bool   `json:"base64Encoded"`
+	}
+	if err := call(ctx, d, "Network.getResponseBody", map[string]string{"requestId": requestID}, &r); err != nil {
+		return nil, err
+	}
+	if r.Base64Encoded {
+		return base64.StdEncoding.DecodeString(r.Body)
+	}
+	return []byte(r.Body), nil
+}
+
+func (d Network) EmulateNetworkConditions(ctx context.Context, c NetworkConditions) error {
+	return call(ctx, d, "Network.emulateNetworkConditions", c, nil)
+}
+
+// Storage domain.
+type Storage struct{ Caller }
+
+// Cookie is a cookie as Storage.getCookies returns it and Storage.setCookies
+// takes it. Expires is in seconds since the epoch, zero for session
+// cookies.
+type Cookie struct {
+	Name         string          `json:"name"`
+	Value        string          `json:"value"`
+	Domain       string          `json:"domain"`
+	Path         string          `json:"path"`
+	Expires      float64         `json:"expires,omitempty"`
+	HTTPOnly     bool            `json:"httpOnly"`
+	Secure       bool            `json:"secure"`
+	SameSite     string          `json:"sameSite,omitempty"`
+	Priority     string          `json:"priority,omitempty"`
+	SourceScheme string          `json:"sourceScheme,omitempty"`
+	SourcePort   int             `json:"sourcePort,omitempty"`
+	PartitionKey json.RawMessage `json:"partitionKey,omitempty"`
+}
+
+// GetCookies returns every cookie of the browser.
+func (d Storage) GetCookies(ctx context.Context) ([]Cookie, error) {
+	var r struct {
+		Cookies []Cookie `json:"cookies"`
+	}
+	if err := call(ctx, d, "Storage.getCookies", nil, &r); err != nil {
+		return nil, err
+	}
+	for i := range r.Cookies {
+		// Session cookies expire at -1, which setCookies takes as expired.
+		if r.Cookies[i].Expires < 0 {
+			r.Cookies[i].Expires = 0
+		}
+	}
+	return r.Cookies, nil
+}
+
+func (d Storage) SetCookies(ctx context.Context, cookies []Cookie) error {
+	return call(ctx, d, "Storage.setCookies", map[string]interface{}{"cookies": cookies}, nil)
+}
+
+// Input domain.
+type Input struct{ Caller }
+
+// KeyEvent are the parameters of Input.dispatchKeyEvent.
+type KeyEvent struct {
+	Type                  string `json:"type"`
+	Modifiers             int    `json:"modifiers,omitempty"`
+	Key                   string `json:"key,omitempty"`
+	Code                  string `json:"code,omitempty"`
+	Text                  string `json:"text,omitempty"`
+	WindowsVirtualKeyCode int    `json:"windowsVirtualKeyCode,omitempty"`
+}
+
+func (d Input) DispatchKeyEvent(ctx context.Context, e KeyEvent) error {
+	return call(ctx, d, "Input.dispatchKeyEvent", e, nil)
+}
+
+// MouseEvent are the parameters of Input.dispatchMouseEvent.
+type MouseEvent struct {
+	Type       string  `json:"type"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Modifiers  int     `json:"modifiers,omitempty"`
+	Button     string  `json:"button,omitempty"`
+	ClickCount int     `json:"clickCount,omitempty"`
+	DeltaX     float64 `json:"deltaX,omitempty"`
+	DeltaY     float64 `json:"deltaY,omitempty"`
+}
+
+func (d Input) DispatchMouseEvent(ctx context.Context, e MouseEvent) error {
+	return call(ctx, d, "Input.dispatchMouseEvent", e, nil)
+}
+
+func (d Input) InsertText(ctx context.Context, text string) error {
+	return call(ctx, d, "Input.insertText", map[string]string{"text": text}, nil)
+}
+
+// Emulation domain.
+type Emulation struct{ Caller }
+
+// UserAgentBrand is a brand reported through User-Agent client hints.
+type UserAgentBrand struct {
+	Brand   string `json:"brand"`
+	Version string `json:"version"`
+}
+
+// UserAgentMetadata is what pages see through User-Agent client hints.
+type UserAgentMetadata struct {
+	Brands          []UserAgentBrand `json:"brands"`
+	FullVersionList []UserAgentBrand `json:"fullVersionList,omitempty"`
+	Platform        string           `json:"platform"`
+	PlatformVersion string           `json:"platformVersion"`
+	Architecture    string           `json:"architecture"`
+	Model           string           `json:"model"`
+	Mobile          bool             `json:"mobile"`
+}
+
+// UserAgentOverride are the parameters of Emulation.setUserAgentOverride.
+type UserAgentOverride struct {
+	UserAgent         string             `json:"userAgent"`
+	AcceptLanguage    string             `json:"acceptLanguage,omitempty"`
+	Platform          string             `json:"platform,omitempty"`
+	UserAgentMetadata *UserAgentMetadata `json:"userAgentMetadata,omitempty"`
+}
+
+func (d Emulation) SetUserAgentOverride(ctx context.Context, o UserAgentOverride) error {
+	return call(ctx, d, "Emulation.setUserAgentOverride", o, nil)
+}
+
+// MediaFeature overrides a CSS media feature such as
+// prefers-color-scheme. An empty value clears the override.
+type MediaFeature struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SetEmulatedVisionDeficiency simulates a vision deficiency such as
+// "deuteranopia"; "none" turns it off.
+func (d Emulation) SetEmulatedVisionDeficiency(ctx context.Context, kind string) error {
+	return call(ctx, d, "Emulation.setEmulatedVisionDeficiency", map[string]string{"type": kind}, nil)
+}
+
+// SetTimezoneOverride makes pages use an IANA time zone such as
+// "Asia/Tokyo"; "" restores the host's.
+func (d Emulation) SetTimezoneOverride(ctx context.Context, timezoneID string) error {
+	return call(ctx, d, "Emulation.setTimezoneOverride", map[string]string{"timezoneId": timezoneID}, nil)
+}
+
+// SetEmulatedMedia sets the CSS media type ("screen", "print" or "" for
+// the default) and media feature overrides.
+func (d Emulation) SetEmulatedMedia(ctx context.Context, media string, features []MediaFeature) error {
+	return call(ctx, d, "Emulation.setEmulatedMedia", map[string]interface{}{
+		"media":    media,
+		"features": features,
+	}, nil)
+}
+
+// Fetch domain.
+type Fetch struct{ Caller }
+
+// RequestPattern selects the requests Fetch pauses. URLPattern accepts
+// the wildcards * and ?.
+type RequestPattern struct {
+	URLPattern   string `json:"urlPattern"`
+	ResourceType string `json:"resourceType,omitempty"`
+	RequestStage string `json:"requestStage,omitempty"`
+}
+
+// RequestPaused is the Fetch.requestPaused event. The response fields are
+// only set for requests paused at the Response stage.
+type RequestPaused struct {
+	RequestID string `json:"requestId"`
+	Request   struct {
+		URL     string            `json:"url"`
+		Method  string            `json:"method"`
+		Headers map[string]string `json:"headers"`
+	} `json:"request"`
+	ResourceType       string        `json:"resourceType"`
+	ResponseStatusCode int           `json:"responseStatusCode"`
+	ResponseHeaders    []HeaderEntry `json:"responseHeaders"`
+}
+
+// HeaderEntry is a header of Fetch.continueRequest or a paused response.
+type HeaderEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (d Fetch) Enable(ctx context.Context, patterns []RequestPattern) error {
+	return call(ctx, d, "Fetch.enable", map[string]interface{}{"patterns": patterns}, nil)
+}
+
+// ContinueRequest resumes a paused request, replacing its headers unless
+// headers is nil. It does not wait for the reply, so it can be sent from
+// an event loop.
+func (d Fetch) ContinueRequest(requestID string, headers []HeaderEntry) error {
+	params := map[string]interface{}{"requestId": requestID}
+	if headers != nil {
+		params["headers"] = headers
+	}
+	return d.Send("Fetch.continueRequest", params)
+}
+
+// FailRequest makes a paused request fail with reason, e.g. "Aborted".
+// Like ContinueRequest it does not wait for the reply.
+func (d Fetch) FailRequest(requestID, reason string) error {
+	return d.Send("Fetch.failRequest", map[string]string{"requestId": requestID, "errorReason": reason})
+}
+
+// FulfillRequest answers a paused request with a response of its own
+// instead of sending it. Like ContinueRequest it does not wait for the
+// reply.
+func (d Fetch) FulfillRequest(requestID string, status int, headers []HeaderEntry, body []byte) error {
+	return d.Send("Fetch.fulfillRequest", map[string]interface{}{
+		"requestId":       requestID,
+		"responseCode":    status,
+		"responseHeaders": headers,
+		"body":            base64.StdEncoding.EncodeToString(body),
+	})
+}
+
+// TakeResponseBodyAsStream returns an IO stream handle for the body of a
+// request paused at the Response stage. The request must then be
+// fulfilled or failed.
+func (d Fetch) TakeResponseBodyAsStream(ctx context.Context, requestID string) (string, error) {
+	var r struct {
+		Stream string `json:"stream"`
+	}
+	err := call(ctx, d, "Fetch.takeResponseBodyAsStream", map[string]string{"requestId": requestID}, &r)
+	return r.Stream, err
+}
+
+// IO domain.
+type IO struct{ Caller }
+
+// Read returns up to size bytes of a stream and whether it has ended.
+func (d IO) Read(ctx context.Context, handle string, size int) ([]byte, bool, error) {
+	var r struct {
+		Data          string `json:"data"`
+		Base64Encoded bool   `json:"base64Encoded"`
+		EOF           bool   `json:"eof"`
+	}
+	if err := call(ctx, d, "IO.read", map[string]interface{}{"handle": handle, "size": size}, &r); err != nil {
+		return nil, false, err
+	}
+	if r.Base64Encoded {
+		data, err := base64.StdEncoding.DecodeString(r.Data)
+		return data, r.EOF, err
+	}
+	return []byte(r.Data), r.EOF, nil
+}
+
+func (d IO) Close(ctx context.Context, handle string) error {
+	return call(ctx, d, "IO.close", map[string]string{"handle": handle}, nil)
+}
+
+// DOM domain.
+type DOM struct{ Caller }
+
+func (d DOM) Enable(ctx context.Context) error {
+	return call(ctx, d, "DOM.enable", nil, nil)
+}
+
+func (d DOM) Disable(ctx context.Context) error {
+	return call(ctx, d, "DOM.disable", nil, nil)
+}
+
+// GetDocument returns the node ID of the document's root.
+func (d DOM) GetDocument(ctx context.Context) (int, error) {
+	var r struct {
+		Root struct {
+			NodeID int `json:"nodeId"`
+		} `json:"root"`
+	}
+	err := call(ctx, d, "DOM.getDocument", map[string]int{"depth": 0}, &r)
+	return r.Root.NodeID, err
+}
+
+// QuerySelectorAll returns the IDs of the nodes under nodeID matching
+// selector, in document order.
+func (d DOM) QuerySelectorAll(ctx context.Context, nodeID int, selector string) ([]int, error) {
+	var r struct {
+		NodeIDs []int `json:"nodeIds"`
+	}
+	err := call(ctx, d, "DOM.querySelectorAll", map[string]interface{}{"nodeId": nodeID, "selector": selector}, &r)
+	return r.NodeIDs, err
+}
+
+// GetBorderQuad returns the corners of a node's border box in CSS pixels
+// of the viewport, as x1, y1 ... x4, y4.
+func (d DOM) GetBorderQuad(ctx context.Context, nodeID int) ([]float64, error) {
+	var r struct {
+		Model struct {
+			Border []float64 `json:"border"`
+		} `json:"model"`
+	}
+	err := call(ctx, d, "DOM.getBoxModel", map[string]int{"nodeId": nodeID}, &r)
+	return r.Model.Border, err
+}
+
+// Overlay domain. It needs the DOM domain enabled.
+type Overlay struct{ Caller }
+
+// RGBA is a color in the Overlay domain, with A from 0 to 1.
+type RGBA struct {
+	R int     `json:"r"`
+	G int     `json:"g"`
+	B int     `json:"b"`
+	A float64 `json:"a"`
+}
+
+// HighlightConfig is how Overlay.highlightNode draws a node.
+type HighlightConfig struct {
+	ShowInfo     bool  `json:"showInfo"`
+	ShowRulers   bool  `json:"showRulers"`
+	ContentColor *RGBA `json:"contentColor,omitempty"`
+	PaddingColor *RGBA `json:"paddingColor,omitempty"`
+	BorderColor  *RGBA `json:"borderColor,omitempty"`
+	MarginColor  *RGBA `json:"marginColor,omitempty"`
+}
+
+func (d Overlay) Enable(ctx context.Context) error {
+	return call(ctx, d, "Overlay.enable", nil, nil)
+}
+
+func (d Overlay) Disable(ctx context.Context) error {
+	return call(ctx, d, "Overlay.disable", nil, nil)
+}
+
+// HighlightNode draws DevTools' inspect highlight over a node, replacing
+// any other highlight.
+func (d Overlay) HighlightNode(ctx context.Context, nodeID int, config HighlightConfig) error {
+	return call(ctx, d, "Overlay.highlightNode", map[string]interface{}{"nodeId": nodeID, "highlightConfig": config}, nil)
+}
+
+func (d Overlay) HideHighlight(ctx context.Context) error {
+	return call(ctx, d, "Overlay.hideHighlight", nil, nil)
+}
@@ -0,0 +1,160 @@
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// scriptedBrowser answers each method with a canned result and records
+// the commands it received.
+func scriptedBrowser(t *testing.T, results map[string]string, got chan<- map[string]json.RawMessage) string {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var cmd map[string]json.RawMessage
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			got <- cmd
+			var method string
+			json.Unmarshal(cmd["method"], &method)
+			result := results[method]
+			if result == "" {
+				result = "{}"
+			}
+			conn.WriteJSON(map[string]json.RawMessage{"id": cmd["id"], "result": json.RawMessage(result)})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestTypedDomains(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan map[string]json.RawMessage, 10)
+	c, err := Dial(ctx, scriptedBrowser(t, map[string]string{
+		"Page.navigate":          `{"frameId":"F","errorText":"net::ERR_NAME_NOT_RESOLVED"}`,
+		"Target.attachToTarget":  `{"sessionId":"S1"}`,
+		"Page.captureScreenshot": `{"data":"iVBORw=="}`,
+		"Runtime.evaluate":       `{"result":{},"exceptionDetails":{"text":"Uncaught","exception":{"description":"TypeError: x is undefined"}}}`,
+	}, got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	id, err := Target{c}.AttachToTarget(ctx, "T1")
+	if err != nil || id != "S1" {
+		t.Fatalf("AttachToTarget = %q, %v", id, err)
+	}
+	<-got
+
+	// Commands for an attached page carry its session ID.
+	res, err := Page{c.Session(id)}.Navigate(ctx, "https://nowhere.invalid")
+	if err != nil || res.ErrorText != "net::ERR_NAME_NOT_RESOLVED" {
+		t.Fatalf("Navigate = %+v, %v", res, err)
+	}
+	cmd := <-got
+	if string(cmd["sessionId"]) != `"S1"` || !strings.Contains(string(cmd["params"]), "nowhere.invalid") {
+		t.Errorf("navigate command = %s %s", cmd["sessionId"], cmd["params"])
+	}
+
+	png, err := Page{c}.CaptureScreenshot(ctx)
+	if err != nil || string(png[:4]) != "\x89PNG" {
+		t.Errorf("CaptureScreenshot = %q, %v", png, err)
+	}
+	<-got
+
+	// What an expression throws is the error's data.
+	_, err = Runtime{c}.Evaluate(ctx, "x.y")
+	if e, ok := err.(*Error); !ok || e.Code != 0 || e.Data != "TypeError: x is undefined" {
+		t.Errorf("Evaluate error = %#v", err)
+	}
+}
+
+func TestDOMAndOverlay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan map[string]json.RawMessage, 10)
+	c, err := Dial(ctx, scriptedBrowser(t, map[string]string{
+		"DOM.getDocument":      `{"root":{"nodeId":1}}`,
+		"DOM.querySelectorAll": `{"nodeIds":[7,9]}`,
+		"DOM.getBoxModel":      `{"model":{"border":[10,20,110,20,110,60,10,60]}}`,
+	}, got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	root, err := DOM{c}.GetDocument(ctx)
+	if err != nil || root != 1 {
+		t.Fatalf("GetDocument = %d, %v", root, err)
+	}
+	<-got
+	nodes, err := DOM{c}.QuerySelectorAll(ctx, root, "a.next")
+	if err != nil || len(nodes) != 2 || nodes[0] != 7 {
+		t.Fatalf("QuerySelectorAll = %v, %v", nodes, err)
+	}
+	if cmd := <-got; string(cmd["params"]) != `{"nodeId":1,"selector":"a.next"}` {
+		t.Errorf("querySelectorAll params = %s", cmd["params"])
+	}
+	quad, err := DOM{c}.GetBorderQuad(ctx, 7)
+	if err != nil || len(quad) != 8 || quad[2] != 110 {
+		t.Fatalf("GetBorderQuad = %v, %v", quad, err)
+	}
+	<-got
+
+	if err := (Overlay{c}).HighlightNode(ctx, 7, HighlightConfig{ShowInfo: true, BorderColor: &RGBA{R: 255, A: 0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	cmd := <-got
+	if !strings.Contains(string(cmd["params"]), `"nodeId":7`) || !strings.Contains(string(cmd["params"]), `"borderColor":{"r":255,"g":0,"b":0,"a":0.5}`) {
+		t.Errorf("highlightNode params = %s", cmd["params"])
+	}
+}
+
+func TestCookies(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan map[string]json.RawMessage, 10)
+	c, err := Dial(ctx, scriptedBrowser(t, map[string]string{
+		"Storage.getCookies": `{"cookies":[{"name":"sid","value":"1","domain":"example.com","path":"/","expires":-1,"session":true},{"name":"pref","value":"dark","domain":".example.com","path":"/","expires":1900000000}]}`,
+	}, got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cookies, err := Storage{c}.GetCookies(ctx)
+	if err != nil || len(cookies) != 2 {
+		t.Fatalf("GetCookies = %v, %v", cookies, err)
+	}
+	<-got
+	if cookies[0].Expires != 0 || cookies[1].Expires != 1900000000 {
+		t.Errorf("expires = %v, %v", cookies[0].Expires, cookies[1].Expires)
+	}
+
+	// Session cookies are set without an expiry, which would delete them.
+	if err := (Storage{c}).SetCookies(ctx, cookies[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-got; strings.Contains(string(cmd["params"]), "expires") {
+		t.Errorf("setCookies params = %s", cmd["params"])
+	}
+}
@@ -0,0 +1,261 @@
+// Package cdptest is a synthetic DevTools endpoint for tests and
+// benchmarks. It answers most commands by echoing their parameters and casts
+// JPEG frames of a chosen size at a chosen rate, like a browser showing a
+// busy page, so the proxy and streaming paths can be measured without
+// Chrome. Like a browser with a single tab, it reports a page target, Page,
+// to clients discovering targets and lets them attach to it.
+package cdptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Page is the target ID of the server's page.
+const Page = "page-1"
+
+// Options shape the frames a Server casts.
+type Options struct {
+	// FPS is how many frames a second each screencast sends at most. As in
+	// Chrome, a frame is only sent once the previous one was acknowledged,
+	// so zero sends frames as fast as the client acknowledges them.
+	FPS float64
+	// Width and Height are the frames' size in pixels, 1280x720 by
+	// default.
+	Width, Height int
+	// Quality is the frames' JPEG quality, 80 by default.
+	Quality int
+}
+
+// Server is a DevTools WebSocket endpoint at URL.
+type Server struct {
+	URL string
+
+	opts   Options
+	frame  string // base64 JPEG sent in every frame
+	srv    *httptest.Server
+	frames atomic.Uint64
+}
+
+// NewServer starts a server casting frames as opts says.
+func NewServer(opts Options) *Server {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		opts.Width, opts.Height = 1280, 720
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = 80
+	}
+	s := &Server{
+		opts:  opts,
+		frame: base64.StdEncoding.EncodeToString(Frame(opts.Width, opts.Height, opts.Quality)),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+	return s
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() {
+	s.srv.CloseClientConnections()
+	s.srv.Close()
+}
+
+// Frames returns how many frames the server has sent.
+func (s *Server) Frames() uint64 {
+	return s.frames.Load()
+}
+
+// Frame returns a JPEG of noise and gradients, which compresses worse than
+// most pages do and so errs on the side of large frames.
+func Frame(width, height, quality int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	seed := uint32(1)
+	for y := range height {
+		for x := range width {
+			seed = seed*1664525 + 1013904223
+			noise := uint8(seed >> 28)
+			img.Set(x, y, color.RGBA{uint8(x) + noise, uint8(y) + noise, uint8(x + y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	return buf.Bytes()
+}
+
+// message is a command from the client.
+type message struct {
+	ID        int64           `json:"id"`
+	Method    string          `json:"method"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+}
+
+// conn is a client connection and the screencasts running on it.
+type conn struct {
+	s  *Server
+	ws *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu    sync.Mutex
+	casts map[string]*cast // by CDP session ID
+
+	attached atomic.Int64 // sessions attached to the page
+}
+
+// cast is one target's screencast.
+type cast struct {
+	acks chan struct{}
+	stop chan struct{}
+}
+
+var upgrader = websocket.Upgrader{}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{s: s, ws: ws, casts: make(map[string]*cast)}
+	defer c.close()
+	var reply bytes.Buffer
+	for {
+		var msg message
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+		result := msg.Params
+		if len(result) == 0 {
+			result = json.RawMessage("{}")
+		}
+		if msg.Method == "Target.attachToTarget" {
+			result = fmt.Appendf(nil, `{"sessionId":"session-%d"}`, c.attached.Add(1))
+		}
+		reply.Reset()
+		fmt.Fprintf(&reply, `{"id":%d,"sessionId":%q,"result":`, msg.ID, msg.SessionID)
+		reply.Write(result)
+		reply.WriteByte('}')
+		c.write(reply.Bytes())
+		// Frames follow the reply to Page.startScreencast, as in Chrome.
+		switch msg.Method {
+		case "Target.setDiscoverTargets":
+			c.write(fmt.Appendf(nil, `{"method":"Target.targetCreated","params":{"targetInfo":{"targetId":%q,"type":"page","url":"about:blank"}}}`, Page))
+		case "Page.startScreencast":
+			c.startCast(msg.SessionID)
+		case "Page.stopScreencast":
+			c.stopCast(msg.SessionID)
+		case "Page.screencastFrameAck":
+			c.ack(msg.SessionID)
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.mu.Lock()
+	for id := range c.casts {
+		c.stopCastLocked(id)
+	}
+	c.mu.Unlock()
+	c.ws.Close()
+}
+
+// write sends one text message.
+func (c *conn) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *conn) startCast(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.casts[sessionID]; ok {
+		return
+	}
+	k := &cast{acks: make(chan struct{}, 1), stop: make(chan struct{})}
+	c.casts[sessionID] = k
+	go c.run(sessionID, k)
+}
+
+func (c *conn) stopCast(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopCastLocked(sessionID)
+}
+
+func (c *conn) stopCastLocked(sessionID string) {
+	if k, ok := c.casts[sessionID]; ok {
+		close(k.stop)
+		delete(c.casts, sessionID)
+	}
+}
+
+func (c *conn) ack(sessionID string) {
+	c.mu.Lock()
+	k := c.casts[sessionID]
+	c.mu.Unlock()
+	if k == nil {
+		return
+	}
+	select {
+	case k.acks <- struct{}{}:
+	default:
+	}
+}
+
+// run sends a target's frames, each after the previous one was
+// acknowledged and no faster than the frame rate.
+func (c *conn) run(sessionID string, k *cast) {
+	var interval time.Duration
+	if c.s.opts.FPS > 0 {
+		interval = time.Duration(float64(time.Second) / c.s.opts.FPS)
+	}
+	prefix := fmt.Sprintf(`{"method":"Page.screencastFrame","sessionId":%q,"params":{"data":"`, sessionID)
+	// The buffer is reused so that the server's allocations do not weigh
+	// on the benchmarks it runs in.
+	var buf bytes.Buffer
+	next := time.Now()
+	for n := 1; ; n++ {
+		if wait := time.Until(next); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-k.stop:
+				t.Stop()
+				return
+			}
+		}
+		next = time.Now().Add(interval)
+		now := float64(time.Now().UnixNano()) / 1e9
+		buf.Reset()
+		buf.WriteString(prefix)
+		buf.WriteString(c.s.frame)
+		buf.WriteString(`","sessionId":`)
+		buf.WriteString(strconv.Itoa(n))
+		fmt.Fprintf(&buf, `,"metadata":{"deviceWidth":%d,"deviceHeight":%d,"pageScaleFactor":1,"scrollOffsetX":0,"scrollOffsetY":0,"timestamp":%f}}}`,
+			c.s.opts.Width, c.s.opts.Height, now)
+		if err := c.write(buf.Bytes()); err != nil {
+			return
+		}
+		c.s.frames.Add(1)
+		select {
+		case <-k.acks:
+		case <-k.stop:
+			return
+		}
+	}
+}
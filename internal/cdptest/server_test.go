@@ -0,0 +1,96 @@
+package cdptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+func TestServerCastsAcknowledgedFrames(t *testing.T) {
+	srv := NewServer(Options{Width: 320, Height: 200})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := cdp.Dial(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	result, err := client.Call(ctx, "Test.echo", map[string]int{"n": 1})
+	if err != nil || string(result) != `{"n":1}` {
+		t.Fatalf("echo = %s, %v", result, err)
+	}
+
+	events := client.Events()
+	page := cdp.Page{Caller: client.Session("page-1")}
+	if err := page.StartScreencast(ctx, cdp.ScreencastOptions{Format: "jpeg"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		var f cdp.ScreencastFrame
+		select {
+		case msg := <-events:
+			if msg.Method != "Page.screencastFrame" || msg.SessionID != "page-1" {
+				t.Fatalf("event %s on %q", msg.Method, msg.SessionID)
+			}
+			if err := json.Unmarshal(msg.Params, &f); err != nil {
+				t.Fatal(err)
+			}
+		case <-ctx.Done():
+			t.Fatalf("frame %d not sent", i)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(f.Data))
+		if err != nil || img.Bounds().Dx() != 320 || img.Bounds().Dy() != 200 {
+			t.Fatalf("frame is not a 320x200 JPEG: %v", err)
+		}
+		// The next frame waits for this one's acknowledgement.
+		select {
+		case msg := <-events:
+			t.Fatalf("%s sent before the acknowledgement", msg.Method)
+		case <-time.After(50 * time.Millisecond):
+		}
+		page.ScreencastFrameAck(f.SessionID)
+	}
+	if n := srv.Frames(); n < 3 {
+		t.Errorf("Frames() = %d", n)
+	}
+}
+
+func TestServerReportsItsPage(t *testing.T) {
+	srv := NewServer(Options{})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := cdp.Dial(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	events := client.Events()
+	if err := (cdp.Target{Caller: client}).SetDiscoverTargets(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	var e cdp.TargetCreated
+	select {
+	case msg := <-events:
+		if msg.Method != "Target.targetCreated" || msg.Decode(&e) != nil || e.TargetInfo.TargetID != Page || e.TargetInfo.Type != "page" {
+			t.Fatalf("event %s %s", msg.Method, msg.Params)
+		}
+	case <-ctx.Done():
+		t.Fatal("page not reported")
+	}
+	first, err := (cdp.Target{Caller: client}).AttachToTarget(ctx, Page)
+	if err != nil || first == "" {
+		t.Fatalf("AttachToTarget = %q, %v", first, err)
+	}
+	if second, _ := (cdp.Target{Caller: client}).AttachToTarget(ctx, Page); second == first {
+		t.Errorf("attached twice as %q", first)
+	}
+}
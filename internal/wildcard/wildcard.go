@@ -0,0 +1,61 @@
+// Package wildcard matches strings such as URLs against patterns with the
+// wildcards * and ?.
+package wildcard
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Match reports whether s matches pattern, where * matches any run
+// of characters and ? any single one.
+func Match(pattern, s string) bool {
+	p, i := 0, 0
+	star, mark := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// MatchHost reports whether host is the domain pattern or one of its
+// subdomains, ignoring case. Patterns with wildcards must match the
+// whole host instead.
+func MatchHost(pattern, host string) bool {
+	pattern, host = strings.ToLower(strings.TrimSuffix(pattern, ".")), strings.ToLower(strings.TrimSuffix(host, "."))
+	if strings.ContainsAny(pattern, "*?") {
+		return Match(pattern, host)
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+// FindHost returns the first of patterns the host of rawURL matches with
+// MatchHost.
+func FindHost(patterns []string, rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	for _, p := range patterns {
+		if MatchHost(p, u.Hostname()) {
+			return p, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,45 @@
+package wildcard
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"https://staging.example.com/*", "https://staging.example.com/login", true},
+		{"https://staging.example.com/*", "https://staging.example.com.evil.test/", false},
+		{"*://*.example.com/*", "http://a.b.example.com/x?y", true},
+		{"*://*.example.com/*", "https://example.com/", false},
+		{"https://host?/*", "https://host1/", true},
+		{"https://host?/*", "https://host/", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "WWW.Example.com", true},
+		{"example.com", "badexample.com", false},
+		{"example.com", "example.com.evil.test", false},
+		{"*.gov", "irs.gov", true},
+		{"*.gov", "gov", false},
+		{"ads?.example.net", "ads1.example.net", true},
+	}
+	for _, tt := range tests {
+		if got := MatchHost(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("MatchHost(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+	if rule, ok := FindHost([]string{"other.org", "example.com"}, "https://a.example.com:8443/x"); !ok || rule != "example.com" {
+		t.Errorf("FindHost = %q, %v", rule, ok)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"browser-server/events"
+)
+
+// jobLinkTTL is how long the links in job webhooks stay valid, as long
+// as finished jobs are kept.
+const jobLinkTTL = 24 * time.Hour
+
+// JobWebhook is where a job posts its result when it finishes.
+type JobWebhook struct {
+	URL string `json:"url"`
+	// Secret signs the body in the X-Browser-Lab-Signature header;
+	// WEBHOOK_SECRET is used without it.
+	Secret string `json:"secret,omitempty"`
+}
+
+func (wh *JobWebhook) validate() error {
+	if wh == nil {
+		return nil
+	}
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook.url must be an http(s) URL")
+	}
+	return nil
+}
+
+// JobResult is the body of a job webhook.
+type JobResult struct {
+	// Type is replay.finished or crawl.finished.
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Owner      string                 `json:"owner,omitempty"`
+	Status     string                 `json:"status"`
+	StartedAt  time.Time              `json:"started_at"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+	Metrics    map[string]interface{} `json:"metrics"`
+	Error      string                 `json:"error,omitempty"`
+	// ReportURL is a signed link to the job's full report.
+	ReportURL string `json:"report_url,omitempty"`
+	// Artifacts are signed links to the artifact bundles of the job's
+	// sessions.
+	Artifacts []ArtifactLink `json:"artifacts,omitempty"`
+}
+
+// ArtifactLink is a signed download link for a session's artifacts.
+type ArtifactLink struct {
+	SessionID string    `json:"session_id"`
+	URL       string    `json:"url"`
+	Size      int64     `json:"size"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// jobDuration is how long a job ran, in milliseconds.
+func jobDuration(started time.Time, finished *time.Time) int64 {
+	if finished == nil {
+		return time.Since(started).Milliseconds()
+	}
+	return finished.Sub(started).Milliseconds()
+}
+
+// jobFinished publishes a finished job on the event bus and, if the job
+// asked for it, posts its result with signed links to its report and to
+// the artifacts of its stopped sessions. base is the server's external
+// URL and reportPath the API path of the job.
+func jobFinished(res JobResult, hook *JobWebhook, base, reportPath string, sessionIDs []string) {
+	eventBus.Publish(events.Event{
+		Type:  res.Type,
+		Owner: res.Owner,
+		Data: map[string]interface{}{
+			"id":      res.ID,
+			"owner":   res.Owner,
+			"status":  res.Status,
+			"metrics": res.Metrics,
+		},
+	})
+	if hook == nil {
+		return
+	}
+
+	expires := time.Now().Add(jobLinkTTL)
+	res.ReportURL = base + signPath(reportPath, expires)
+	for _, id := range sessionIDs {
+		if artifactStore == nil {
+			break
+		}
+		bundle, _, err := artifactStore.Get(id)
+		if err != nil {
+			continue
+		}
+		linkExpires := expires
+		if bundle.ExpiresAt.Before(linkExpires) {
+			linkExpires = bundle.ExpiresAt
+		}
+		res.Artifacts = append(res.Artifacts, ArtifactLink{
+			SessionID: id,
+			URL:       base + signPath(apiPrefix+"/sessions/"+id+"/artifacts", linkExpires),
+			Size:      bundle.Size,
+			ExpiresAt: linkExpires,
+		})
+	}
+
+	secret := hook.Secret
+	if secret == "" {
+		secret = os.Getenv("WEBHOOK_SECRET")
+	}
+	wh := &events.Webhook{URL: hook.URL, Secret: secret, Retries: 5}
+	if err := wh.Send(res); err != nil {
+		log.Printf("Job %s: failed to deliver the result webhook: %v", res.ID, err)
+	}
+}
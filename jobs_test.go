@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-server/events"
+)
+
+func TestJobFinishedWebhook(t *testing.T) {
+	urlSigningKey = []byte("test-key")
+	defer func() { urlSigningKey = nil }()
+
+	var got JobResult
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(events.SignatureHeader) != events.Sign("s3cret", body) {
+			t.Error("bad signature")
+		}
+		signature = r.Header.Get(events.SignatureHeader)
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	finished := time.Now()
+	jobFinished(JobResult{
+		Type:       "crawl.finished",
+		ID:         "c1",
+		Status:     "completed",
+		StartedAt:  finished.Add(-time.Second),
+		FinishedAt: &finished,
+		Metrics:    map[string]interface{}{"pages": 3},
+	}, &JobWebhook{URL: srv.URL, Secret: "s3cret"}, "https://lab.example.com", "/v1/crawls/c1", nil)
+
+	if signature == "" || got.ID != "c1" || got.Metrics["pages"] != 3.0 {
+		t.Fatalf("webhook got %+v", got)
+	}
+	link, ok := strings.CutPrefix(got.ReportURL, "https://lab.example.com")
+	if !ok {
+		t.Fatalf("report_url = %q", got.ReportURL)
+	}
+	if _, ok := signedIdentity(httptest.NewRequest("GET", link, nil)); !ok {
+		t.Errorf("report_url %q is not signed", got.ReportURL)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"browser-server/session"
+)
+
+// setupJournal records running browsers in SESSION_JOURNAL, and kills the
+// browsers and removes the profiles an earlier run of the server left in
+// it, e.g. when it crashed. Sessions are not carried over: clients of the
+// old sessions get 404s and must create new ones. Servers sharing a host
+// need journals of their own.
+func setupJournal(sessions *session.Manager) error {
+	path := os.Getenv("SESSION_JOURNAL")
+	if path == "" {
+		return nil
+	}
+	journal, stale, err := session.OpenJournal(path)
+	if err != nil {
+		return err
+	}
+	killed := 0
+	for _, e := range stale {
+		if journal.Reap(e) {
+			killed++
+		}
+	}
+	if len(stale) > 0 {
+		log.Printf("Journal: cleaned up %d sessions left by an earlier run, killing %d browsers", len(stale), killed)
+	}
+	sessions.SetJournal(journal)
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/session"
+)
+
+// maxLabels bounds the labels of one session.
+const maxLabels = 32
+
+// labelTTL overrides the duration of sessions carrying a label.
+type labelTTL struct {
+	selector labelSelector
+	ttl      time.Duration
+}
+
+// labelTTLs are the overrides from LABEL_TTLS, e.g. "job=30m,env:ci=1h".
+var labelTTLs []labelTTL
+
+// setupLabels reads the duration overrides for labelled sessions from
+// LABEL_TTLS, a comma-separated list of label=duration.
+func setupLabels() error {
+	ttls, err := parseLabelTTLs(os.Getenv("LABEL_TTLS"))
+	if err != nil {
+		return err
+	}
+	labelTTLs = ttls
+	return nil
+}
+
+func parseLabelTTLs(v string) ([]labelTTL, error) {
+	var ttls []labelTTL
+	for _, item := range splitList(v) {
+		label, dur, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label TTL %q: want label=duration", item)
+		}
+		sel, err := parseLabelSelector([]string{label})
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(dur)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid label TTL %q: bad duration", item)
+		}
+		ttls = append(ttls, labelTTL{selector: sel, ttl: d})
+	}
+	return ttls, nil
+}
+
+// ttlForLabels returns the shortest TTL override matching labels.
+func ttlForLabels(labels map[string]string) (time.Duration, bool) {
+	var ttl time.Duration
+	for _, o := range labelTTLs {
+		if o.selector.matches(labels) && (ttl == 0 || o.ttl < ttl) {
+			ttl = o.ttl
+		}
+	}
+	return ttl, ttl > 0
+}
+
+// validateLabels checks label keys and values for characters that would
+// make them impossible to select.
+func validateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("at most %d labels are allowed", maxLabels)
+	}
+	for k, v := range labels {
+		if k == "" || strings.ContainsAny(k, ":,=") {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if strings.ContainsAny(v, ",=") {
+			return fmt.Errorf("invalid value for label %q", k)
+		}
+	}
+	return nil
+}
+
+// labelSelector matches sessions by label. A key mapped to "" matches any
+// value.
+type labelSelector map[string]string
+
+// parseLabelSelector parses label query parameters of the form key:value
+// or key. All of them must match.
+func parseLabelSelector(params []string) (labelSelector, error) {
+	sel := labelSelector{}
+	for _, p := range params {
+		k, v, _ := strings.Cut(p, ":")
+		if k == "" {
+			return nil, fmt.Errorf("invalid label selector %q", p)
+		}
+		sel[k] = v
+	}
+	return sel, nil
+}
+
+func (sel labelSelector) matches(labels map[string]string) bool {
+	for k, want := range sel {
+		got, ok := labels[k]
+		if !ok || (want != "" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteSessionsHandler stops every session carrying the given labels that
+// the caller may control, so a cancelled CI job can clean up after itself.
+// At least one label is required.
+// DELETE /sessions?label=job:1234
+func deleteSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()["label"]
+	if len(params) == 0 {
+		http.Error(w, "At least one label is required", http.StatusBadRequest)
+		return
+	}
+	sel, err := parseLabelSelector(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var matched []*session.Session
+	for _, s := range requestSessions(r).ListSessions() {
+		if sel.matches(s.Labels) && canControl(r, s) {
+			matched = append(matched, s)
+		}
+	}
+
+	// Stopping waits for each browser to exit, so stop them together.
+	var wg sync.WaitGroup
+	ids := make([]string, 0, len(matched))
+	for _, s := range matched {
+		ids = append(ids, s.ID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Stop()
+		}()
+	}
+	wg.Wait()
+	log.Printf("Stopped %d sessions labelled %v (requested by %s)", len(ids), params, ownerName(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"stopped": ids})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLabelSelector(t *testing.T) {
+	labels := map[string]string{"job": "1234", "env": "ci"}
+
+	tests := []struct {
+		params []string
+		want   bool
+	}{
+		{[]string{"job:1234"}, true},
+		{[]string{"job"}, true},
+		{[]string{"job:1234", "env:ci"}, true},
+		{[]string{"job:99"}, false},
+		{[]string{"job:1234", "branch"}, false},
+		{nil, true},
+	}
+	for _, tt := range tests {
+		sel, err := parseLabelSelector(tt.params)
+		if err != nil {
+			t.Fatalf("parseLabelSelector(%v): %v", tt.params, err)
+		}
+		if got := sel.matches(labels); got != tt.want {
+			t.Errorf("%v matches = %v, want %v", tt.params, got, tt.want)
+		}
+	}
+
+	if _, err := parseLabelSelector([]string{":1234"}); err == nil {
+		t.Error("selector without key accepted")
+	}
+}
+
+func TestLabelTTLs(t *testing.T) {
+	ttls, err := parseLabelTTLs("job=30m, env:ci=10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	labelTTLs = ttls
+	defer func() { labelTTLs = nil }()
+
+	if ttl, ok := ttlForLabels(map[string]string{"job": "1"}); !ok || ttl != 30*time.Minute {
+		t.Errorf("job TTL = %v, %v", ttl, ok)
+	}
+	if ttl, ok := ttlForLabels(map[string]string{"job": "1", "env": "ci"}); !ok || ttl != 10*time.Minute {
+		t.Errorf("shortest TTL = %v, %v", ttl, ok)
+	}
+	if _, ok := ttlForLabels(map[string]string{"env": "prod"}); ok {
+		t.Error("unmatched labels got a TTL")
+	}
+
+	for _, bad := range []string{"job", "job=soon", "=1h"} {
+		if _, err := parseLabelTTLs(bad); err == nil {
+			t.Errorf("parseLabelTTLs(%q) accepted", bad)
+		}
+	}
+}
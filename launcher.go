@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"browser-server/session"
+)
+
+// browserLauncher starts the browsers of all sessions; nil runs a local
+// Chrome (BROWSER_LAUNCHER).
+var browserLauncher session.Launcher
+
+// setupLauncher reads BROWSER_LAUNCHER, "local" (the default) or
+// "docker", and the DOCKER_* settings of the docker launcher.
+func setupLauncher() error {
+	switch v := os.Getenv("BROWSER_LAUNCHER"); v {
+	case "", "local":
+		return nil
+	case "docker":
+	default:
+		return fmt.Errorf("unknown launcher %q, use local or docker", v)
+	}
+
+	d := &session.DockerLauncher{
+		Image:   os.Getenv("DOCKER_IMAGE"),
+		Command: os.Getenv("DOCKER_BROWSER_COMMAND"),
+		Memory:  os.Getenv("DOCKER_MEMORY"),
+		CPUs:    os.Getenv("DOCKER_CPUS"),
+		ShmSize: os.Getenv("DOCKER_SHM_SIZE"),
+		Network: os.Getenv("DOCKER_NETWORK"),
+	}
+	if d.Image == "" {
+		d.Image = "chromedp/headless-shell:latest"
+	}
+	if d.CPUs != "" {
+		if f, err := strconv.ParseFloat(d.CPUs, 64); err != nil || f <= 0 {
+			return fmt.Errorf("DOCKER_CPUS must be a positive number, not %q", d.CPUs)
+		}
+	}
+	n, err := d.Cleanup()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Launcher: removed %d session containers left by an earlier run", n)
+	}
+	log.Printf("Launcher: running browsers in %s containers", d.Image)
+	browserLauncher = d
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Bounds of a session lease: short enough leases would be lost to a
+// network hiccup, and longer ones hardly differ from the duration.
+const (
+	minLeaseSeconds = 5
+	maxLeaseSeconds = 3600
+)
+
+// LeaseResponse tells a heartbeating client how long it has until the next
+// heartbeat is due.
+type LeaseResponse struct {
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// heartbeatHandler renews the lease of a session created with
+// lease_seconds.
+// PUT /sessions/{id}/heartbeat
+func heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !sess.HasLease() {
+		http.Error(w, "Session was not created with a lease", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LeaseResponse{LeaseExpiresAt: sess.Heartbeat()})
+}
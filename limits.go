@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"browser-server/session"
+)
+
+// setupLimits reads MAX_SESSIONS and SESSIONS_PER_MINUTE, the limits on
+// the sessions of all callers together.
+func setupLimits(sessions *session.Manager) error {
+	var l session.Limits
+	for name, dst := range map[string]*int{
+		"MAX_SESSIONS":        &l.MaxSessions,
+		"SESSIONS_PER_MINUTE": &l.SessionsPerMinute,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s must be a positive number", name)
+			}
+			*dst = n
+		}
+	}
+	sessions.SetLimits(l)
+	return nil
+}
+
+// refuseOverLimit answers 429 Too Many Requests, with a Retry-After
+// header, if err is a session limit, and reports whether it did.
+func refuseOverLimit(w http.ResponseWriter, err error) bool {
+	var limitErr *session.LimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+// limitStatsHandler reports the session limits and the sessions counted
+// against them, in total and per API key with a quota.
+// GET /admin/limits
+func limitStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requestSessions(r).LimitStats())
+}
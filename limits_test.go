@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"browser-server/session"
+)
+
+func TestRefuseOverLimit(t *testing.T) {
+	w := httptest.NewRecorder()
+	if refuseOverLimit(w, errors.New("launch failed")) || refuseOverLimit(w, nil) {
+		t.Fatal("refused a session for an error that is not a limit")
+	}
+	err := &session.LimitError{Limit: "sessions_per_minute", RetryAfter: 1500 * time.Millisecond}
+	if !refuseOverLimit(w, err) {
+		t.Fatal("limit not refused")
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("got %d with Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
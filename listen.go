@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// listen returns the server listener. Sockets passed by systemd take
+// precedence; otherwise addr is either a TCP address such as ":8080" or a
+// unix socket path prefixed with "unix:".
+func listen(addr string) (net.Listener, error) {
+	if ln, ok, err := activationListener(); ok || err != nil {
+		return ln, err
+	}
+	return listenAddr(addr)
+}
+
+// listenAddr listens on a TCP address or a "unix:" socket path.
+func listenAddr(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, "unix:")
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+
+	// Remove a stale socket left behind by a previous run.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// activationListener returns the first socket passed by systemd socket
+// activation, if any.
+func activationListener() (net.Listener, bool, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, false, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, false, nil
+	}
+	// Keep the variables from leaking into Chrome child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFDsStart), "systemd-socket")
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to use systemd socket: %w", err)
+	}
+	return ln, true, nil
+}
+
+// sdNotify sends a state update such as "READY=1" to systemd. It is a no-op
+// when the server is not run by systemd with Type=notify.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading '@' denotes an abstract socket.
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+
+	"browser-server/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultPublicGroups are served on the public listener unless
+// PUBLIC_ROUTE_GROUPS names others: watching sessions, but not creating,
+// driving or administering them.
+var defaultPublicGroups = []routeGroup{groupWHIP, groupGallery}
+
+// newRouter builds the routes of groups, or of every group when groups is
+// empty, whose handlers work with svc.
+func newRouter(svc *services, groups []routeGroup) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(func(next http.Handler) http.Handler { return withServices(svc, next) })
+
+	// API, proxy and WHIP endpoints (see routes.go)
+	registerRoutes(r, groups...)
+
+	if len(groups) > 0 && !slices.Contains(groups, groupDashboard) {
+		return r
+	}
+
+	// OIDC sign-in for the dashboard
+	if oidcAuth != nil {
+		r.Handle("/auth/login", restrictNetwork(groupDashboard, http.HandlerFunc(oidcAuth.LoginHandler))).Methods("GET")
+		r.Handle("/auth/callback", restrictNetwork(groupDashboard, http.HandlerFunc(oidcAuth.CallbackHandler))).Methods("GET")
+		r.Handle("/auth/logout", restrictNetwork(groupDashboard, http.HandlerFunc(oidcAuth.LogoutHandler))).Methods("GET", "POST")
+	}
+
+	// Branding and feature flags the dashboard reads
+	r.Handle("/config.json", restrictNetwork(groupDashboard, http.HandlerFunc(dashboardConfigHandler))).Methods("GET")
+
+	// Static files for dashboard
+	r.PathPrefix("/").Handler(restrictNetwork(groupDashboard, requireLogin(dashboard("./dashboard"))))
+	return r
+}
+
+// publicListener is a second listener exposing only some route groups,
+// with its own certificate and, optionally, its own API keys.
+type publicListener struct {
+	ln                net.Listener
+	srv               *http.Server
+	certFile, keyFile string
+	h3                *http3Listener
+}
+
+// listenerKeysKey carries the API keys of the listener a request arrived
+// on, when they differ from keyStore.
+type listenerKeysKey struct{}
+
+// requestKeyStore returns the API keys accepted for r.
+func requestKeyStore(r *http.Request) *auth.Store {
+	if keys, ok := r.Context().Value(listenerKeysKey{}).(*auth.Store); ok {
+		return keys
+	}
+	return keyStore
+}
+
+// listenerGroupsKey carries the route groups of the router a request
+// arrived on, when it does not serve every group.
+type listenerGroupsKey struct{}
+
+// withListenerGroups records the route groups its router serves.
+func withListenerGroups(groups []routeGroup, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), listenerGroupsKey{}, groups)))
+	})
+}
+
+// reachesGroup reports whether the client of r could call the routes of
+// group: the listener it came in on serves them and its address is
+// allowed to. Endpoints of one group that grant what another group's
+// routes do check it.
+func reachesGroup(r *http.Request, group routeGroup) bool {
+	if groups, ok := r.Context().Value(listenerGroupsKey{}).([]routeGroup); ok && !slices.Contains(groups, group) {
+		return false
+	}
+	if nets, ok := allowedNetworks[group]; ok {
+		return containsIP(nets, clientIP(r))
+	}
+	return true
+}
+
+// setupPublicListener opens the listener on PUBLIC_LISTEN_ADDR, if set. It
+// serves PUBLIC_ROUTE_GROUPS (default "whip,gallery"), over TLS with
+// PUBLIC_TLS_CERT_FILE and PUBLIC_TLS_KEY_FILE (and HTTP/3 on
+// PUBLIC_HTTP3_ADDR), and accepts the keys in PUBLIC_API_KEYS_FILE
+// instead of API_KEYS_FILE when that is set. Its handlers share svc with
+// the main listener.
+func setupPublicListener(svc *services) (*publicListener, error) {
+	addr := os.Getenv("PUBLIC_LISTEN_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	groups := defaultPublicGroups
+	if v := os.Getenv("PUBLIC_ROUTE_GROUPS"); v != "" {
+		groups = nil
+		for _, name := range splitList(v) {
+			g := routeGroup(name)
+			if !slices.Contains(routeGroups, g) {
+				return nil, fmt.Errorf("PUBLIC_ROUTE_GROUPS: unknown group %q", name)
+			}
+			groups = append(groups, g)
+		}
+	}
+
+	baseCtx := serverCtx
+	var keys *auth.Store
+	if path := os.Getenv("PUBLIC_API_KEYS_FILE"); path != "" {
+		var err error
+		if keys, err = auth.LoadStore(path); err != nil {
+			return nil, fmt.Errorf("load API keys from %s: %w", path, err)
+		}
+		baseCtx = context.WithValue(serverCtx, listenerKeysKey{}, keys)
+	}
+
+	l := &publicListener{
+		certFile: os.Getenv("PUBLIC_TLS_CERT_FILE"),
+		keyFile:  os.Getenv("PUBLIC_TLS_KEY_FILE"),
+	}
+	if (l.certFile == "") != (l.keyFile == "") {
+		return nil, fmt.Errorf("PUBLIC_TLS_CERT_FILE and PUBLIC_TLS_KEY_FILE must be set together")
+	}
+	handler := compress(withPrefix(newRouter(svc, groups)))
+	l.srv = &http.Server{
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	if l.certFile != "" {
+		l.srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if addr := os.Getenv("PUBLIC_HTTP3_ADDR"); addr != "" {
+		h3, err := listenHTTP3(addr, handler, nil, l.certFile, l.keyFile, keys)
+		if err != nil {
+			return nil, err
+		}
+		l.h3 = h3
+		l.srv.Handler = advertiseHTTP3(h3, handler)
+	}
+
+	ln, err := listenAddr(addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	l.ln = ln
+	log.Printf("Public listener on %s serving %v", ln.Addr(), groups)
+	return l, nil
+}
+
+func (l *publicListener) serve() error {
+	if l.h3 != nil {
+		go l.h3.serve()
+	}
+	if l.certFile != "" {
+		return l.srv.ServeTLS(l.ln, l.certFile, l.keyFile)
+	}
+	return l.srv.Serve(l.ln)
+}
+
+func (l *publicListener) shutdown(ctx context.Context) {
+	if l.h3 != nil {
+		go l.h3.shutdown(ctx)
+	}
+	l.srv.Shutdown(ctx)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"browser-server/auth"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPublicRouter(t *testing.T) {
+	r := newRouter(nil, []routeGroup{groupWHIP})
+	for path, want := range map[string]bool{
+		"/v1/sessions/abc/preview": true,
+		"/sessions/abc/frames":     true,
+		"/v1/sessions":             false,
+		"/v1/sessions/abc/cdp":     false,
+		"/v1/openapi.json":         false,
+		"/":                        false,
+	} {
+		var m mux.RouteMatch
+		if got := r.Match(httptest.NewRequest("GET", path, nil), &m); got != want {
+			t.Errorf("public listener serves %s: %v, want %v", path, got, want)
+		}
+	}
+
+	var m mux.RouteMatch
+	if !newRouter(nil, nil).Match(httptest.NewRequest("GET", "/v1/sessions", nil), &m) {
+		t.Error("internal listener does not serve /v1/sessions")
+	}
+}
+
+func TestRequestKeyStore(t *testing.T) {
+	public := &auth.Store{}
+	r := httptest.NewRequest("GET", "/", nil)
+	if requestKeyStore(r) != keyStore {
+		t.Error("request without listener keys does not use keyStore")
+	}
+	r = r.WithContext(context.WithValue(r.Context(), listenerKeysKey{}, public))
+	if requestKeyStore(r) != public {
+		t.Error("listener keys ignored")
+	}
+}
+
+func TestReachesGroup(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if !reachesGroup(r, groupCDP) {
+		t.Error("internal listener does not reach the CDP group")
+	}
+	var got *bool
+	withListenerGroups([]routeGroup{groupWHIP}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdp, whip := reachesGroup(r, groupCDP), reachesGroup(r, groupWHIP)
+		if !whip {
+			t.Error("public listener does not reach the WHIP group")
+		}
+		got = &cdp
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if got == nil || *got {
+		t.Error("public listener reaches the CDP group")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxListLimit caps the page size a client may request.
+const maxListLimit = 1000
+
+// listParams are the paging, sorting and field selection options shared by
+// list endpoints:
+//
+//	?limit=50&offset=100&sort=-created_at&fields=id,cdp_url
+type listParams struct {
+	Limit  int // zero means no limit
+	Offset int
+	Sort   string // empty for the endpoint's default order
+	Desc   bool
+	Fields []string // empty selects every field
+}
+
+// parseListParams reads list options from q, accepting only the given sort
+// keys.
+func parseListParams(q url.Values, sortKeys ...string) (listParams, error) {
+	var p listParams
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if p.Limit, err = strconv.Atoi(v); err != nil || p.Limit < 1 || p.Limit > maxListLimit {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if p.Offset, err = strconv.Atoi(v); err != nil || p.Offset < 0 {
+			return p, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if v := q.Get("sort"); v != "" {
+		p.Desc = strings.HasPrefix(v, "-")
+		p.Sort = strings.TrimPrefix(v, "-")
+		if !slices.Contains(sortKeys, p.Sort) {
+			return p, fmt.Errorf("cannot sort by %q (use one of %s)", p.Sort, strings.Join(sortKeys, ", "))
+		}
+	}
+	p.Fields = splitList(q.Get("fields"))
+	return p, nil
+}
+
+// page returns the [start, end) bounds of the requested page of n items
+// and sets X-Total-Count and, when more items follow, a Link to the next
+// page.
+func (p listParams) page(w http.ResponseWriter, r *http.Request, n int) (int, int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(n))
+	start := min(p.Offset, n)
+	if p.Limit == 0 {
+		return start, n
+	}
+	end := min(start+p.Limit, n)
+	if end < n {
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(end))
+		w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+	}
+	return start, end
+}
+
+// selectFields reduces each item to the requested JSON fields. Items are
+// returned unchanged when no fields were requested.
+func (p listParams) selectFields(items interface{}) (interface{}, error) {
+	if len(p.Fields) == 0 {
+		return items, nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var full []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &full); err != nil {
+		return nil, err
+	}
+	out := make([]map[string]json.RawMessage, len(full))
+	for i, item := range full {
+		out[i] = make(map[string]json.RawMessage, len(p.Fields))
+		for _, f := range p.Fields {
+			if v, ok := item[f]; ok {
+				out[i][f] = v
+			}
+		}
+	}
+	return out, nil
+}
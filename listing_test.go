@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseListParams(t *testing.T) {
+	q, _ := url.ParseQuery("limit=2&offset=1&sort=-expires_at&fields=id,%20cdp_url")
+	p, err := parseListParams(q, "created_at", "expires_at")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Limit != 2 || p.Offset != 1 || p.Sort != "expires_at" || !p.Desc || len(p.Fields) != 2 {
+		t.Errorf("unexpected params %+v", p)
+	}
+
+	for _, bad := range []string{"limit=0", "limit=x", "offset=-1", "sort=owner"} {
+		q, _ := url.ParseQuery(bad)
+		if _, err := parseListParams(q, "created_at"); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestListParamsPage(t *testing.T) {
+	p := listParams{Limit: 2, Offset: 1}
+	w := httptest.NewRecorder()
+	start, end := p.page(w, httptest.NewRequest("GET", "/v1/sessions?limit=2&offset=1", nil), 5)
+	if start != 1 || end != 3 {
+		t.Errorf("page = [%d, %d), want [1, 3)", start, end)
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %q", got)
+	}
+	if got, want := w.Header().Get("Link"), `</v1/sessions?limit=2&offset=3>; rel="next"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	start, end = p.page(w, httptest.NewRequest("GET", "/v1/sessions", nil), 0)
+	if start != 0 || end != 0 || w.Header().Get("Link") != "" {
+		t.Errorf("empty page = [%d, %d), Link %q", start, end, w.Header().Get("Link"))
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	p := listParams{Fields: []string{"id"}}
+	out, err := p.selectFields([]SessionResponse{{ID: "a", CDPURL: "ws://x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := out.([]map[string]json.RawMessage)
+	if len(items[0]) != 1 || string(items[0]["id"]) != `"a"` {
+		t.Errorf("selected %v", items[0])
+	}
+}
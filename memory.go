@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"browser-server/events"
+	"browser-server/session"
+)
+
+// Memory kill policies (MEMORY_KILL_POLICY).
+const (
+	memoryKillNone     = "none"
+	memoryKillHeaviest = "heaviest"
+	memoryKillOldest   = "oldest"
+)
+
+// memoryGuard watches host memory and browser RSS. Above the high
+// watermark new sessions are refused; above the critical watermark, and
+// for sessions over their own limit, sessions are stopped according to
+// the kill policy before the kernel OOM killer has to act.
+type memoryGuard struct {
+	sessions     *session.Manager
+	interval     time.Duration
+	highPercent  float64
+	critPercent  float64
+	policy       string
+	sessionLimit int64
+	meminfo      string
+
+	warned map[string]bool
+}
+
+// setupMemory reads MEMORY_CHECK_INTERVAL, MEMORY_HIGH_PERCENT,
+// MEMORY_CRITICAL_PERCENT, MEMORY_KILL_POLICY and SESSION_MEMORY_LIMIT_MB
+// and starts the guard.
+func setupMemory(sessions *session.Manager) error {
+	g := &memoryGuard{
+		sessions:    sessions,
+		interval:    10 * time.Second,
+		highPercent: 85,
+		critPercent: 95,
+		policy:      memoryKillNone,
+		meminfo:     "/proc/meminfo",
+		warned:      make(map[string]bool),
+	}
+	if v := os.Getenv("MEMORY_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		g.interval = d
+	}
+	for name, dst := range map[string]*float64{
+		"MEMORY_HIGH_PERCENT":     &g.highPercent,
+		"MEMORY_CRITICAL_PERCENT": &g.critPercent,
+	} {
+		if v := os.Getenv(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f <= 0 || f > 100 {
+				return fmt.Errorf("%s must be a percentage", name)
+			}
+			*dst = f
+		}
+	}
+	if v := os.Getenv("MEMORY_KILL_POLICY"); v != "" {
+		switch v {
+		case memoryKillNone, memoryKillHeaviest, memoryKillOldest:
+			g.policy = v
+		default:
+			return fmt.Errorf("MEMORY_KILL_POLICY must be none, heaviest or oldest")
+		}
+	}
+	if v := os.Getenv("SESSION_MEMORY_LIMIT_MB"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("SESSION_MEMORY_LIMIT_MB must be a positive number")
+		}
+		g.sessionLimit = n * 1024 * 1024
+	}
+
+	if g.interval <= 0 {
+		return nil
+	}
+	if _, _, err := g.hostMemory(); err != nil {
+		log.Printf("Memory: host memory unavailable, only watching sessions: %v", err)
+	}
+	go g.run(serverCtx)
+	return nil
+}
+
+func (g *memoryGuard) run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.check()
+		}
+	}
+}
+
+// check runs one round of the guard.
+func (g *memoryGuard) check() {
+	running := g.sessions.ListSessions()
+	rss := make(map[*session.Session]int64, len(running))
+	for _, s := range running {
+		rss[s] = s.MemoryRSS()
+	}
+	g.checkSessions(running, rss)
+
+	total, available, err := g.hostMemory()
+	if err != nil {
+		return
+	}
+	used := 100 * float64(total-available) / float64(total)
+
+	low := used >= g.highPercent
+	if low != g.sessions.IsLowOnMemory() {
+		g.sessions.SetLowOnMemory(low)
+		typ := "server.memory_recovered"
+		if low {
+			typ = "server.memory_pressure"
+			log.Printf("Memory: host at %.1f%% used, refusing new sessions", used)
+		} else {
+			log.Printf("Memory: host at %.1f%% used, accepting sessions again", used)
+		}
+		eventBus.Publish(events.Event{
+			Type: typ,
+			Data: map[string]interface{}{
+				"used_percent":    used,
+				"available_bytes": available,
+			},
+		})
+	}
+
+	if used >= g.critPercent && g.policy != memoryKillNone {
+		if victim := pickMemoryVictim(running, rss, g.policy); victim != nil {
+			msg := fmt.Sprintf("Host memory is %.1f%% used; stopping this session (%d MB resident) to protect the server", used, rss[victim]>>20)
+			victim.WarnMemory(msg)
+			victim.Stop()
+		}
+	}
+}
+
+// checkSessions warns about, and by policy stops, sessions over the
+// per-session limit.
+func (g *memoryGuard) checkSessions(sessions []*session.Session, rss map[*session.Session]int64) {
+	live := make(map[string]bool, len(sessions))
+	for _, s := range sessions {
+		live[s.ID] = true
+		if g.sessionLimit <= 0 || rss[s] <= g.sessionLimit {
+			continue
+		}
+		if g.policy != memoryKillNone {
+			s.WarnMemory(fmt.Sprintf("Session uses %d MB, over the %d MB limit, and is being stopped", rss[s]>>20, g.sessionLimit>>20))
+			s.Stop()
+		} else if !g.warned[s.ID] {
+			g.warned[s.ID] = true
+			s.WarnMemory(fmt.Sprintf("Session uses %d MB, over the %d MB limit", rss[s]>>20, g.sessionLimit>>20))
+		}
+	}
+	for id := range g.warned {
+		if !live[id] {
+			delete(g.warned, id)
+		}
+	}
+}
+
+// pickMemoryVictim chooses the session to stop under memory pressure: one
+// of the lowest priority class, chosen among them by policy.
+func pickMemoryVictim(sessions []*session.Session, rss map[*session.Session]int64, policy string) *session.Session {
+	if len(sessions) == 0 {
+		return nil
+	}
+	sorted := append([]*session.Session(nil), sessions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Priority.Rank() != b.Priority.Rank() {
+			return a.Priority.Rank() < b.Priority.Rank()
+		}
+		if policy == memoryKillHeaviest && rss[a] != rss[b] {
+			return rss[a] > rss[b]
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return sorted[0]
+}
+
+func (g *memoryGuard) hostMemory() (total, available int64, err error) {
+	f, err := os.Open(g.meminfo)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return parseMeminfo(f)
+}
+
+// parseMeminfo reads MemTotal and MemAvailable, in bytes, from
+// /proc/meminfo.
+func parseMeminfo(r io.Reader) (total, available int64, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+	if total == 0 {
+		return 0, 0, fmt.Errorf("no MemTotal in meminfo")
+	}
+	return total, available, scanner.Err()
+}
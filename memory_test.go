@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"browser-server/session"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	total, available, err := parseMeminfo(strings.NewReader(`MemTotal:       16384000 kB
+MemFree:          512000 kB
+MemAvailable:    4096000 kB
+Buffers:          100000 kB
+`))
+	if err != nil || total != 16384000*1024 || available != 4096000*1024 {
+		t.Errorf("parseMeminfo = %d, %d, %v", total, available, err)
+	}
+	if _, _, err := parseMeminfo(strings.NewReader("")); err == nil {
+		t.Error("empty meminfo accepted")
+	}
+}
+
+func TestPickMemoryVictim(t *testing.T) {
+	now := time.Now()
+	old := &session.Session{ID: "old", CreatedAt: now.Add(-time.Hour)}
+	heavy := &session.Session{ID: "heavy", CreatedAt: now}
+	light := &session.Session{ID: "light", CreatedAt: now.Add(-time.Minute)}
+	sessions := []*session.Session{light, heavy, old}
+	rss := map[*session.Session]int64{old: 100, heavy: 900, light: 50}
+
+	if v := pickMemoryVictim(sessions, rss, memoryKillHeaviest); v != heavy {
+		t.Errorf("heaviest picked %s", v.ID)
+	}
+	if v := pickMemoryVictim(sessions, rss, memoryKillOldest); v != old {
+		t.Errorf("oldest picked %s", v.ID)
+	}
+	// The lowest class goes first, whatever the policy.
+	batch := &session.Session{ID: "batch", CreatedAt: now, Priority: session.PriorityBatch}
+	rss[batch] = 10
+	if v := pickMemoryVictim(append(sessions, batch), rss, memoryKillHeaviest); v != batch {
+		t.Errorf("heaviest picked %s over a batch session", v.ID)
+	}
+	if v := pickMemoryVictim(nil, rss, memoryKillOldest); v != nil {
+		t.Errorf("picked %s from no sessions", v.ID)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+
+	"browser-server/auth"
+	"browser-server/session"
+)
+
+// authEnabled reports whether any authentication method is configured for
+// the listener r arrived on.
+func authEnabled(r *http.Request) bool {
+	return requestKeyStore(r) != nil || oidcAuth != nil || certMapper != nil
+}
+
+// identify resolves the caller from a signed URL, a client certificate, an
+// API key or an OIDC session cookie.
+func identify(r *http.Request) (*auth.Identity, bool) {
+	if id, ok := signedIdentity(r); ok {
+		return id, true
+	}
+	if certMapper != nil {
+		if id, ok := certMapper.Identify(r.TLS); ok {
+			return id, true
+		}
+	}
+	if keys := requestKeyStore(r); keys != nil {
+		if key, ok := keys.Lookup(auth.SecretFromRequest(r)); ok {
+			return &auth.Identity{Name: key.Name, Role: key.EffectiveRole(), Key: key}, true
+		}
+	}
+	if oidcAuth != nil {
+		return oidcAuth.IdentityFromRequest(r)
+	}
+	return nil, false
+}
+
+// authenticate rejects unauthenticated requests when any authentication
+// method is configured, and records the caller on the request context.
+func authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authEnabled(r) {
+			next(w, r)
+			return
+		}
+		id, ok := identify(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="browser-lab"`)
+			http.Error(w, "Invalid or missing credentials", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	}
+}
+
+// authorize rejects callers whose role is below the required one, unless
+// they hold a signed URL for the request. It is a no-op when
+// authentication is disabled.
+func authorize(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := auth.IdentityFromContext(r.Context())
+		if ok && id.Role < role && !signedFor(r) {
+			http.Error(w, "Forbidden: requires "+role.String()+" role", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// canControl reports whether the caller may drive or stop a session.
+// Operators may only control their own sessions; admins control all.
+func canControl(r *http.Request, sess *session.Session) bool {
+	return canControlOwner(r, sess.Owner)
+}
+
+// canControlOwner is canControl for a session known only by its owner.
+func canControlOwner(r *http.Request, owner string) bool {
+	id, ok := auth.IdentityFromContext(r.Context())
+	if !ok {
+		return true
+	}
+	if id.Role >= auth.RoleAdmin {
+		return true
+	}
+	return id.Role >= auth.RoleOperator && owner == id.Name
+}
+
+// ownerName is the name recorded as the owner of sessions the caller creates.
+func ownerName(r *http.Request) string {
+	if id, ok := auth.IdentityFromContext(r.Context()); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// requireLogin sends browsers without an OIDC session to the login page.
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if oidcAuth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := oidcAuth.IdentityFromRequest(r); !ok {
+			http.Redirect(w, r, "/auth/login", http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
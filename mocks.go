@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"browser-server/session"
+)
+
+// maxHARBytes caps the HAR files converted into mocks. Bodies are base64
+// in HARs, so this leaves room for session.MaxMockBytes of them.
+const maxHARBytes = 2 * session.MaxMockBytes
+
+// HARMocksResponse is a HAR converted into mocks.
+type HARMocksResponse struct {
+	// Mocks can be passed as "mocks" to POST /sessions.
+	Mocks *session.Mocks `json:"mocks"`
+	// Skipped counts the entries without a usable response.
+	Skipped int `json:"skipped"`
+}
+
+// harMocksHandler converts a HAR into mocks that answer a new session's
+// requests with the recorded responses, for hermetic test runs of pages
+// that depend on third-party sites. ?unmatched=fail makes sessions fail
+// the requests the HAR has no response for.
+// POST /mocks/har
+func harMocksHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHARBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "HAR is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	mocks, skipped, err := session.MocksFromHAR(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mocks.Unmatched = r.URL.Query().Get("unmatched")
+	if err := mocks.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSONWithETag(w, r, HARMocksResponse{Mocks: mocks, Skipped: skipped})
+}
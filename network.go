@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net"
+	"os"
+
+	"browser-server/session"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// ipFamily is the address family from IP_FAMILY used for DevTools
+// connections and WHIP candidates.
+var ipFamily session.IPFamily
+
+// whipAPI creates the WHIP peer connections with candidates of ipFamily.
+var whipAPI *webrtc.API
+
+// setupNetwork reads IP_FAMILY ("ipv4", "ipv6" or "dual", the default).
+func setupNetwork() error {
+	f, err := session.ParseIPFamily(os.Getenv("IP_FAMILY"))
+	if err != nil {
+		return err
+	}
+	ipFamily = f
+	whipAPI, err = newWHIPAPI(f)
+	return err
+}
+
+func newWHIPAPI(f session.IPFamily) (*webrtc.API, error) {
+	var s webrtc.SettingEngine
+	switch f {
+	case session.IPv4:
+		s.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	case session.IPv6:
+		s.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP6})
+	default:
+		s.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6})
+	}
+	// Link-local addresses are useless to a remote viewer and, for IPv6,
+	// cannot even be dialed without the interface's zone.
+	s.SetIPFilter(func(ip net.IP) bool {
+		return !ip.IsLinkLocalUnicast()
+	})
+
+	var m webrtc.MediaEngine
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	return webrtc.NewAPI(webrtc.WithSettingEngine(s), webrtc.WithMediaEngine(&m)), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// pathParamRe matches a mux path variable and its optional pattern, which
+// OpenAPI paths leave out.
+var pathParamRe = regexp.MustCompile(`\{([^}:]+)(?::[^}]+)?\}`)
+
+// openAPIHandler serves an OpenAPI 3.1 description generated from
+// apiRoutes; 3.1 is the first version with the mutualTLS security scheme,
+// which is only published when client certificates are verified. The
+// minimum role of each operation is published as x-required-role.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	schemes := map[string]interface{}{
+		"apiKey": map[string]string{"type": "http", "scheme": "bearer"},
+		"cookie": map[string]string{"type": "apiKey", "in": "cookie", "name": "browser_lab_session"},
+	}
+	security := []map[string][]string{{"apiKey": {}}, {"cookie": {}}}
+	if certMapper != nil {
+		schemes["mutualTLS"] = map[string]string{"type": "mutualTLS"}
+		security = append(security, map[string][]string{"mutualTLS": {}})
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, rt := range apiRoutes {
+		path := pathParamRe.ReplaceAllString(rt.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+
+		var params []map[string]interface{}
+		for _, m := range pathParamRe.FindAllStringSubmatch(rt.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]string{"type": "string"},
+			})
+		}
+
+		op := map[string]interface{}{
+			"summary":         rt.Summary,
+			"x-required-role": rt.Role.String(),
+			"responses": map[string]interface{}{
+				"default": map[string]string{"description": "See the README for response formats"},
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if authEnabled(r) {
+			op["security"] = security
+		}
+		paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	spec := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]string{
+			"title":   "Browser Server API",
+			"version": "1.0.0",
+		},
+		"servers": []map[string]string{{"url": forwardedPrefix(r) + apiPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"securitySchemes": schemes,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spec)
+}
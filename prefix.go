@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// forwardedPrefix returns the path prefix a reverse proxy serves the
+// server under, from X-Forwarded-Prefix (e.g. "/browser-lab"), or "".
+// Values that are not a plain absolute path are ignored.
+func forwardedPrefix(r *http.Request) string {
+	p := strings.TrimRight(strings.TrimSpace(r.Header.Get("X-Forwarded-Prefix")), "/")
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.ContainsAny(p, "\"'<>\\?#; \t,") {
+		return ""
+	}
+	return p
+}
+
+// withPrefix prefixes the absolute paths in Location and Link headers with
+// the request's forwarded prefix, so redirects, created resources and
+// pagination links point back through the reverse proxy.
+func withPrefix(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := forwardedPrefix(r)
+		if prefix == "" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&prefixWriter{ResponseWriter: w, prefix: prefix}, r)
+	})
+}
+
+type prefixWriter struct {
+	http.ResponseWriter
+	prefix      string
+	wroteHeader bool
+}
+
+func (pw *prefixWriter) WriteHeader(code int) {
+	if !pw.wroteHeader {
+		pw.wroteHeader = true
+		h := pw.Header()
+		if loc := h.Get("Location"); isServerPath(loc) {
+			h.Set("Location", pw.prefix+loc)
+		}
+		for i, link := range h.Values("Link") {
+			if rest, ok := strings.CutPrefix(link, "<"); ok && isServerPath(rest) {
+				h["Link"][i] = "<" + pw.prefix + rest
+			}
+		}
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(p)
+}
+
+func (pw *prefixWriter) Flush() {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (pw *prefixWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// isServerPath reports whether s is an absolute path on this server, as
+// opposed to a full or protocol-relative URL.
+func isServerPath(s string) bool {
+	return strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//")
+}
+
+// dashboard serves the dashboard from dir. Its links are relative, so
+// behind a path-prefixing proxy the page gets a <base> pointing at the
+// prefix; that also covers the prefix being requested without its
+// trailing slash.
+func dashboard(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := forwardedPrefix(r)
+		if prefix == "" || r.URL.Path != "/" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		page, err := os.ReadFile(filepath.Join(dir, "index.html"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		page = bytes.Replace(page, []byte("<head>"), []byte(`<head><base href="`+prefix+`/">`), 1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Add("Vary", "X-Forwarded-Prefix")
+		w.Write(page)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestForwardedPrefix(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                   "",
+		"/browser-lab/":      "/browser-lab",
+		"/a/b":               "/a/b",
+		"browser-lab":        "",
+		"//evil.example.com": "",
+		`/x"><script>`:       "",
+		"/a, /b":             "",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Forwarded-Prefix", header)
+		if got := forwardedPrefix(r); got != want {
+			t.Errorf("forwardedPrefix(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	h := withPrefix(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/v1/replays/1")
+		w.Header().Add("Link", `</v1/sessions?offset=10>; rel="next"`)
+		w.Header().Add("Link", `<https://example.com/docs>; rel="help"`)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	r := httptest.NewRequest("POST", "/v1/replays", nil)
+	r.Header.Set("X-Forwarded-Prefix", "/browser-lab")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if got := rec.Header().Get("Location"); got != "/browser-lab/v1/replays/1" {
+		t.Errorf("Location = %q", got)
+	}
+	links := rec.Header().Values("Link")
+	if len(links) != 2 || links[0] != `</browser-lab/v1/sessions?offset=10>; rel="next"` || links[1] != `<https://example.com/docs>; rel="help"` {
+		t.Errorf("Link = %q", links)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/replays", nil))
+	if got := rec.Header().Get("Location"); got != "/v1/replays/1" {
+		t.Errorf("Location without prefix = %q", got)
+	}
+}
+
+func TestDashboardBase(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><head><title>x</title></head></html>"), 0644)
+	h := dashboard(dir)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Forwarded-Prefix", "/browser-lab")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if !strings.Contains(rec.Body.String(), `<base href="/browser-lab/">`) {
+		t.Errorf("page = %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(rec.Body.String(), "<base") {
+		t.Errorf("page without prefix = %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// maxPreviewFPS caps the frame rate a preview viewer may ask for.
+const maxPreviewFPS = 30
+
+// previewHandler streams the session's page as MJPEG. Every viewer is fed
+// from the session's single shared screencast; a viewer that cannot keep
+// up skips frames instead of slowing the others down.
+// GET /sessions/{id}/preview?fps=N
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	fps := 10.0
+	if v := r.URL.Query().Get("fps"); v != "" {
+		f, err := parseFPS(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fps = f
+	}
+
+	streamPreview(w, r, sess, fps)
+}
+
+// streamPreview writes sess's screencast to w as MJPEG at up to fps frames
+// per second until the viewer or the session goes away.
+func streamPreview(w http.ResponseWriter, r *http.Request, sess *session.Session, fps float64) {
+	viewer, err := sess.Watch(fps)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer viewer.Close()
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-viewer.C:
+			if !ok {
+				return
+			}
+			n, err := fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame.Data))
+			if err == nil {
+				_, err = w.Write(frame.Data)
+			}
+			if err == nil {
+				_, err = w.Write([]byte("\r\n"))
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				log.Printf("Preview: viewer of session %s went away after dropping %d frames", sess.ID, viewer.Dropped())
+				return
+			}
+			sess.CountStreamBytes(n + len(frame.Data) + 2)
+		}
+	}
+}
+
+// parseFPS parses a viewer frame rate, which must be positive and at most
+// maxPreviewFPS.
+func parseFPS(v string) (float64, error) {
+	f, err := strconv.ParseFloat(v, 64)
+	// Written so that NaN, which compares false with everything, fails.
+	if err != nil || !(f > 0 && f <= maxPreviewFPS) {
+		return 0, fmt.Errorf("fps must be between 0 and %d", maxPreviewFPS)
+	}
+	return f, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"browser-server/session"
+	"browser-server/tunnel"
+)
+
+// setupProxyPool loads the upstream proxies in PROXY_POOL_FILE, one URL
+// per line, which sessions created with "rotate_proxy" take turns on.
+func setupProxyPool(sessions *session.Manager) error {
+	path := os.Getenv("PROXY_POOL_FILE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var proxies []tunnel.Upstream
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := tunnel.ParseUpstream(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		proxies = append(proxies, u)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	pool, err := session.NewProxyPool(proxies)
+	if err != nil {
+		return err
+	}
+	sessions.SetProxyPool(pool)
+	log.Printf("Loaded %d upstream proxies from %s", len(proxies), path)
+	return nil
+}
+
+// proxyStatsHandler lists the proxies of the proxy pool and how many
+// sessions each was handed to.
+// GET /admin/proxies
+func proxyStatsHandler(w http.ResponseWriter, r *http.Request) {
+	pool := requestSessions(r).ProxyPool()
+	if pool == nil {
+		http.Error(w, "No proxy pool is configured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pool.Stats())
+}
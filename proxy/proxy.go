@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -11,9 +13,12 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-func ProxyCDP(w http.ResponseWriter, r *http.Request, targetURL string) {
+// ProxyCDP relays a client WebSocket to the browser's CDP endpoint until
+// either side disconnects or ctx is cancelled. If count is non-nil it is
+// called with the size of every relayed message.
+func ProxyCDP(ctx context.Context, w http.ResponseWriter, r *http.Request, targetURL string, count func(n int)) {
 	// Connect to the target Chrome CDP WebSocket
-	targetWS, _, err := websocket.DefaultDialer.Dial(targetURL, nil)
+	targetWS, _, err := websocket.DefaultDialer.DialContext(ctx, targetURL, nil)
 	if err != nil {
 		http.Error(w, "Failed to connect to browser CDP: "+err.Error(), http.StatusBadGateway)
 		return
@@ -38,6 +43,9 @@ func ProxyCDP(w http.ResponseWriter, r *http.Request, targetURL string) {
 				errChan <- err
 				return
 			}
+			if count != nil {
+				count(len(msg))
+			}
 			if err := clientWS.WriteMessage(msgType, msg); err != nil {
 				errChan <- err
 				return
@@ -52,6 +60,9 @@ func ProxyCDP(w http.ResponseWriter, r *http.Request, targetURL string) {
 				errChan <- err
 				return
 			}
+			if count != nil {
+				count(len(msg))
+			}
 			if err := targetWS.WriteMessage(msgType, msg); err != nil {
 				errChan <- err
 				return
@@ -59,5 +70,10 @@ func ProxyCDP(w http.ResponseWriter, r *http.Request, targetURL string) {
 		}
 	}()
 
-	<-errChan
+	select {
+	case <-errChan:
+	case <-ctx.Done():
+		clientWS.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "session ended"), time.Now().Add(time.Second))
+	}
 }
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"browser-server/internal/cdptest"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialProxy starts a proxy to a synthetic browser and connects to it.
+func dialProxy(b *testing.B, opts cdptest.Options) (*websocket.Conn, *atomic.Int64) {
+	b.Helper()
+	browser := cdptest.NewServer(opts)
+	b.Cleanup(browser.Close)
+	var relayed atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ProxyCDP(r.Context(), w, r, browser.URL, func(n int) { relayed.Add(int64(n)) })
+	}))
+	b.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	return conn, &relayed
+}
+
+// BenchmarkProxyCDP measures the round trip of commands through the proxy,
+// whose replies are as large as the commands.
+func BenchmarkProxyCDP(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("size=%dKB", size>>10), func(b *testing.B) {
+			conn, _ := dialProxy(b, cdptest.Options{})
+			payload := strings.Repeat("x", size)
+			b.SetBytes(2 * int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				msg := fmt.Sprintf(`{"id":%d,"method":"Bench.echo","params":{"data":"%s"}}`, i+1, payload)
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+					b.Fatal(err)
+				}
+				if _, _, err := conn.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkProxyCDPFrames measures how fast screencast frames from the
+// browser get through the proxy to a client that acknowledges each one.
+func BenchmarkProxyCDPFrames(b *testing.B) {
+	for _, size := range []struct {
+		name          string
+		width, height int
+	}{{"720p", 1280, 720}, {"1080p", 1920, 1080}} {
+		b.Run(size.name, func(b *testing.B) {
+			conn, relayed := dialProxy(b, cdptest.Options{Width: size.width, Height: size.height})
+			start := `{"id":1,"sessionId":"page-1","method":"Page.startScreencast","params":{"format":"jpeg"}}`
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(start)); err != nil {
+				b.Fatal(err)
+			}
+			if _, _, err := conn.ReadMessage(); err != nil {
+				b.Fatal(err)
+			}
+			ack := []byte(`{"id":2,"sessionId":"page-1","method":"Page.screencastFrameAck","params":{"sessionId":0}}`)
+			b.ReportAllocs()
+			b.ResetTimer()
+			relayed.Store(0)
+			for frames := 0; frames < b.N; {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !strings.Contains(string(msg[:min(len(msg), 64)]), "Page.screencastFrame") {
+					continue
+				}
+				frames++
+				if err := conn.WriteMessage(websocket.TextMessage, ack); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(relayed.Load())/float64(b.N), "relayed-B/frame")
+		})
+	}
+}
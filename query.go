@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// QueryRequest asks which elements of a session's page match a CSS
+// selector or an XPath expression.
+type QueryRequest struct {
+	session.Query
+	// Screenshots can be set to false to leave out the screenshots of the
+	// matches.
+	Screenshots *bool `json:"screenshots,omitempty"`
+}
+
+// queryHandler is a selector playground: it counts the elements matching
+// a CSS selector or XPath in the session's first page and returns the
+// tag, attributes, text, box and a screenshot of the first 20, without
+// changing or scrolling the page.
+// POST /sessions/{id}/query {"selector": "a.next"} or {"xpath": "//a[text()='Next']"}
+func queryHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if (req.Selector == "") == (req.XPath == "") {
+		http.Error(w, "One of selector or xpath is required", http.StatusBadRequest)
+		return
+	}
+	req.Query.Screenshots = req.Screenshots == nil || *req.Screenshots
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	res, err := sess.Query(ctx, req.Query)
+	switch {
+	case errors.Is(err, session.ErrInvalidSelector):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, session.ErrNoPage):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
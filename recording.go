@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"browser-server/recording"
+
+	"github.com/gorilla/mux"
+)
+
+// recordingFormats maps export formats to their content type and, for
+// scripts, the extension they are downloaded with.
+var recordingFormats = map[string]struct{ contentType, ext string }{
+	recording.FormatJob:        {"application/json", ""},
+	recording.FormatChromedp:   {"text/x-go; charset=utf-8", "go"},
+	recording.FormatPlaywright: {"text/javascript; charset=utf-8", "js"},
+}
+
+// recordingHandler exports the interactions recorded in a session as a
+// browser-lab job definition, a chromedp program or a Playwright script,
+// or downloads its video recording.
+// GET /sessions/{id}/recording?format=job|chromedp|playwright|webm|mp4
+func recordingHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == videoFormatWebM || format == videoFormatMP4 {
+		serveVideoRecording(w, r, mux.Vars(r)["id"], format)
+		return
+	}
+
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !sess.RecordsInteractions() {
+		http.Error(w, "Session was not created with record_interactions", http.StatusConflict)
+		return
+	}
+
+	if format == "" {
+		format = recording.FormatJob
+	}
+	f, ok := recordingFormats[format]
+	if !ok {
+		http.Error(w, "format must be job, chromedp, playwright, webm or mp4", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", f.contentType)
+	if f.ext != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, sess.ID, f.ext))
+	}
+	recording.Export(w, format, sess.Interactions())
+}
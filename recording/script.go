@@ -0,0 +1,189 @@
+// Package recording describes recorded browser interactions and exports
+// them as scripts that reproduce them.
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Step actions.
+const (
+	ActionNavigate = "navigate"
+	ActionClick    = "click"
+	ActionFill     = "fill"
+	ActionPress    = "press"
+	// ActionAssert is a checkpoint added to a job by hand: the page URL
+	// must start with URL, or the element matching Selector must exist
+	// and contain Text.
+	ActionAssert = "assert"
+)
+
+// Step is one recorded interaction. AtMS is its offset from the start of
+// the recording.
+type Step struct {
+	Action   string `json:"action"`
+	URL      string `json:"url,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	Value    string `json:"value,omitempty"`
+	// Secret marks a fill of a password field; its value is not recorded.
+	Secret bool   `json:"secret,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Text   string `json:"text,omitempty"`
+	AtMS   int64  `json:"at_ms"`
+}
+
+// Validate reports whether a step has what its action needs.
+func (s Step) Validate() error {
+	switch s.Action {
+	case ActionNavigate:
+		if s.URL == "" {
+			return errors.New("navigate needs a url")
+		}
+	case ActionClick, ActionFill:
+		if s.Selector == "" {
+			return fmt.Errorf("%s needs a selector", s.Action)
+		}
+	case ActionPress:
+		if s.Selector == "" || s.Key == "" {
+			return errors.New("press needs a selector and a key")
+		}
+	case ActionAssert:
+		if s.URL == "" && s.Selector == "" {
+			return errors.New("assert needs a url or a selector")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", s.Action)
+	}
+	return nil
+}
+
+// Divergence is returned when a replayed step does not match the page,
+// for example because its element is missing or an assertion failed.
+type Divergence struct {
+	Reason string
+}
+
+func (d *Divergence) Error() string { return d.Reason }
+
+// Job is a browser-lab job definition: the steps to run against a fresh
+// session.
+type Job struct {
+	Version int    `json:"version"`
+	Steps   []Step `json:"steps"`
+}
+
+// Formats accepted by Export.
+const (
+	FormatJob        = "job"
+	FormatChromedp   = "chromedp"
+	FormatPlaywright = "playwright"
+)
+
+// Export writes steps in the given format.
+func Export(w io.Writer, format string, steps []Step) error {
+	switch format {
+	case FormatJob:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(Job{Version: 1, Steps: steps})
+	case FormatChromedp:
+		return writeChromedp(w, steps)
+	case FormatPlaywright:
+		return writePlaywright(w, steps)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// chromedpKeys maps recorded key names to chromedp's kb values.
+var chromedpKeys = map[string]string{
+	"Enter":  "kb.Enter",
+	"Tab":    "kb.Tab",
+	"Escape": "kb.Escape",
+}
+
+func writeChromedp(w io.Writer, steps []Step) error {
+	var actions []string
+	usesKB := false
+	for _, s := range steps {
+		switch s.Action {
+		case ActionNavigate:
+			actions = append(actions, fmt.Sprintf("chromedp.Navigate(%s)", strconv.Quote(s.URL)))
+		case ActionClick:
+			actions = append(actions, fmt.Sprintf("chromedp.Click(%s, chromedp.ByQuery)", strconv.Quote(s.Selector)))
+		case ActionFill:
+			actions = append(actions, fmt.Sprintf("chromedp.SetValue(%s, %s, chromedp.ByQuery)", strconv.Quote(s.Selector), strconv.Quote(s.Value)))
+		case ActionPress:
+			key, ok := chromedpKeys[s.Key]
+			if !ok {
+				key = strconv.Quote(s.Key)
+			} else {
+				usesKB = true
+			}
+			actions = append(actions, fmt.Sprintf("chromedp.SendKeys(%s, %s, chromedp.ByQuery)", strconv.Quote(s.Selector), key))
+		case ActionAssert:
+			actions = append(actions, fmt.Sprintf("chromedp.Poll(%s, nil)", strconv.Quote(AssertExpression(s))))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("package main\n\nimport (\n\t\"context\"\n\t\"log\"\n\n\t\"github.com/chromedp/chromedp\"\n")
+	if usesKB {
+		b.WriteString("\t\"github.com/chromedp/chromedp/kb\"\n")
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+	b.WriteString("\tctx, cancel := chromedp.NewContext(context.Background())\n\tdefer cancel()\n\n")
+	b.WriteString("\terr := chromedp.Run(ctx,\n")
+	for _, a := range actions {
+		b.WriteString("\t\t" + a + ",\n")
+	}
+	b.WriteString("\t)\n\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writePlaywright(w io.Writer, steps []Step) error {
+	var b strings.Builder
+	b.WriteString("const { chromium } = require('playwright');\n\n(async () => {\n")
+	b.WriteString("  const browser = await chromium.launch();\n  const page = await browser.newPage();\n")
+	for _, s := range steps {
+		switch s.Action {
+		case ActionNavigate:
+			fmt.Fprintf(&b, "  await page.goto(%s);\n", jsString(s.URL))
+		case ActionClick:
+			fmt.Fprintf(&b, "  await page.click(%s);\n", jsString(s.Selector))
+		case ActionFill:
+			fmt.Fprintf(&b, "  await page.fill(%s, %s);\n", jsString(s.Selector), jsString(s.Value))
+		case ActionPress:
+			fmt.Fprintf(&b, "  await page.press(%s, %s);\n", jsString(s.Selector), jsString(s.Key))
+		case ActionAssert:
+			fmt.Fprintf(&b, "  await page.waitForFunction(() => %s);\n", AssertExpression(s))
+		}
+	}
+	b.WriteString("  await browser.close();\n})();\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// AssertExpression returns a JavaScript expression that is true once the
+// page satisfies an assert step.
+func AssertExpression(s Step) string {
+	var conds []string
+	if s.URL != "" {
+		conds = append(conds, fmt.Sprintf("location.href.startsWith(%s)", jsString(s.URL)))
+	}
+	if s.Selector != "" {
+		conds = append(conds, fmt.Sprintf("(document.querySelector(%s)?.textContent ?? null)?.includes(%s) === true", jsString(s.Selector), jsString(s.Text)))
+	}
+	return strings.Join(conds, " && ")
+}
+
+// jsString quotes s as a JavaScript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,61 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var testSteps = []Step{
+	{Action: ActionNavigate, URL: "https://example.com/"},
+	{Action: ActionClick, Selector: "#login", AtMS: 1200},
+	{Action: ActionFill, Selector: "input[name=\"user\"]", Value: "alice", AtMS: 2500},
+	{Action: ActionPress, Selector: "input[name=\"user\"]", Key: "Enter", AtMS: 3000},
+}
+
+func TestExportJob(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, FormatJob, testSteps); err != nil {
+		t.Fatal(err)
+	}
+	var job Job
+	if err := json.Unmarshal(buf.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Version != 1 || len(job.Steps) != 4 || job.Steps[2] != testSteps[2] {
+		t.Errorf("job round trip = %+v", job)
+	}
+}
+
+func TestExportScripts(t *testing.T) {
+	for format, want := range map[string][]string{
+		FormatChromedp: {
+			`chromedp.Navigate("https://example.com/")`,
+			`chromedp.Click("#login", chromedp.ByQuery)`,
+			`chromedp.SetValue("input[name=\"user\"]", "alice", chromedp.ByQuery)`,
+			`chromedp.SendKeys("input[name=\"user\"]", kb.Enter, chromedp.ByQuery)`,
+			`"github.com/chromedp/chromedp/kb"`,
+		},
+		FormatPlaywright: {
+			`await page.goto("https://example.com/");`,
+			`await page.click("#login");`,
+			`await page.fill("input[name=\"user\"]", "alice");`,
+			`await page.press("input[name=\"user\"]", "Enter");`,
+		},
+	} {
+		var buf bytes.Buffer
+		if err := Export(&buf, format, testSteps); err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !strings.Contains(buf.String(), w) {
+				t.Errorf("%s export lacks %s:\n%s", format, w, buf.String())
+			}
+		}
+	}
+
+	if err := Export(&bytes.Buffer{}, "selenium", testSteps); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"browser-server/session"
+)
+
+// globalRedaction is applied to every session on top of what its request
+// asks for (REDACTION_FILE).
+var globalRedaction *session.Redaction
+
+// setupRedaction loads the redaction rules every session gets from
+// REDACTION_FILE, a JSON object like the "redact" field of a request.
+func setupRedaction() error {
+	path := os.Getenv("REDACTION_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var r session.Redaction
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	globalRedaction = &r
+	log.Printf("Redaction: %d selectors and %d regions hidden in every session", len(r.Selectors), len(r.Regions))
+	return nil
+}
@@ -0,0 +1,213 @@
+// Package replay runs recorded interaction jobs against browser sessions
+// and reports where the pages diverged from the recording.
+package replay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"browser-server/recording"
+)
+
+// Target performs steps, normally a *session.Session.
+type Target interface {
+	RunStep(ctx context.Context, step recording.Step) error
+}
+
+// Replay statuses.
+const (
+	StatusRunning  = "running"
+	StatusPassed   = "passed"
+	StatusDiverged = "diverged"
+	StatusFailed   = "failed"
+)
+
+// Step result statuses.
+const (
+	StepOK       = "ok"
+	StepDiverged = "diverged"
+	StepError    = "error"
+	StepSkipped  = "skipped"
+)
+
+// maxStepDelay caps the pause between steps, so idle time in a recording
+// does not stall its replay.
+const maxStepDelay = 10 * time.Second
+
+// StepResult is the outcome of one replayed step.
+type StepResult struct {
+	Index      int            `json:"index"`
+	Step       recording.Step `json:"step"`
+	Status     string         `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	DurationMS int64          `json:"duration_ms"`
+}
+
+// Options control how a job is replayed.
+type Options struct {
+	// Speed scales the recorded pauses between steps: 2 replays twice as
+	// fast, 0 runs steps back to back.
+	Speed float64
+	// StepTimeout bounds how long a step waits for its element.
+	StepTimeout time.Duration
+}
+
+// Replay is a job run against a session.
+type Replay struct {
+	ID        string
+	SessionID string
+	Owner     string
+
+	mu          sync.Mutex
+	status      string
+	startedAt   time.Time
+	finishedAt  time.Time
+	steps       []StepResult
+	divergences int
+	err         string
+}
+
+// Report is the JSON view of a replay.
+type Report struct {
+	ID          string       `json:"id"`
+	SessionID   string       `json:"session_id"`
+	Owner       string       `json:"owner,omitempty"`
+	Status      string       `json:"status"`
+	StartedAt   time.Time    `json:"started_at"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	Divergences int          `json:"divergences"`
+	Steps       []StepResult `json:"steps"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// New creates a replay that has not started yet.
+func New(id, sessionID, owner string) *Replay {
+	return &Replay{ID: id, SessionID: sessionID, Owner: owner, status: StatusRunning, startedAt: time.Now()}
+}
+
+// Report returns a snapshot of the replay's progress.
+func (r *Replay) Report() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := Report{
+		ID:          r.ID,
+		SessionID:   r.SessionID,
+		Owner:       r.Owner,
+		Status:      r.status,
+		StartedAt:   r.startedAt,
+		Divergences: r.divergences,
+		Steps:       append([]StepResult{}, r.steps...),
+		Error:       r.err,
+	}
+	if !r.finishedAt.IsZero() {
+		t := r.finishedAt
+		rep.FinishedAt = &t
+	}
+	return rep
+}
+
+// Run replays steps against t, pacing them by their recorded offsets. A
+// step that diverges is reported and the replay goes on; any other error
+// fails the replay and skips the remaining steps.
+func (r *Replay) Run(ctx context.Context, t Target, steps []recording.Step, opts Options) {
+	var failed error
+	for i, step := range steps {
+		if failed == nil && i > 0 && opts.Speed > 0 {
+			delay := time.Duration(float64(step.AtMS-steps[i-1].AtMS) * float64(time.Millisecond) / opts.Speed)
+			if delay > maxStepDelay {
+				delay = maxStepDelay
+			}
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					failed = ctx.Err()
+				case <-time.After(delay):
+				}
+			}
+		}
+
+		res := StepResult{Index: i, Step: step, Status: StepOK}
+		if failed != nil {
+			res.Status = StepSkipped
+			r.add(res)
+			continue
+		}
+
+		start := time.Now()
+		stepCtx, cancel := context.WithTimeout(ctx, opts.StepTimeout)
+		err := t.RunStep(stepCtx, step)
+		cancel()
+		res.DurationMS = time.Since(start).Milliseconds()
+
+		var div *recording.Divergence
+		switch {
+		case err == nil:
+		case errors.As(err, &div) && ctx.Err() == nil:
+			res.Status = StepDiverged
+			res.Detail = div.Reason
+		default:
+			res.Status = StepError
+			res.Detail = err.Error()
+			failed = err
+		}
+		r.add(res)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finishedAt = time.Now()
+	switch {
+	case failed != nil:
+		r.status = StatusFailed
+		r.err = failed.Error()
+	case r.divergences > 0:
+		r.status = StatusDiverged
+	default:
+		r.status = StatusPassed
+	}
+}
+
+func (r *Replay) add(res StepResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, res)
+	if res.Status == StepDiverged {
+		r.divergences++
+	}
+}
+
+// Store keeps replays in memory until retention after they finish.
+type Store struct {
+	retention time.Duration
+
+	mu      sync.Mutex
+	replays map[string]*Replay
+}
+
+// NewStore creates an empty store.
+func NewStore(retention time.Duration) *Store {
+	return &Store{retention: retention, replays: make(map[string]*Replay)}
+}
+
+// Add stores a replay and forgets expired ones.
+func (st *Store) Add(r *Replay) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	for id, old := range st.replays {
+		if rep := old.Report(); rep.FinishedAt != nil && now.Sub(*rep.FinishedAt) > st.retention {
+			delete(st.replays, id)
+		}
+	}
+	st.replays[r.ID] = r
+}
+
+// Get returns a stored replay.
+func (st *Store) Get(id string) (*Replay, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	r, ok := st.replays[id]
+	return r, ok
+}
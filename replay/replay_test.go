@@ -0,0 +1,98 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"browser-server/recording"
+)
+
+// fakeTarget fails steps by selector.
+type fakeTarget struct {
+	diverge map[string]bool
+	fail    map[string]bool
+	ran     []string
+}
+
+func (f *fakeTarget) RunStep(ctx context.Context, step recording.Step) error {
+	f.ran = append(f.ran, step.Selector)
+	switch {
+	case f.diverge[step.Selector]:
+		return &recording.Divergence{Reason: "no element matches " + step.Selector}
+	case f.fail[step.Selector]:
+		return errors.New("browser went away")
+	}
+	return nil
+}
+
+func steps(selectors ...string) []recording.Step {
+	var out []recording.Step
+	for i, sel := range selectors {
+		out = append(out, recording.Step{Action: recording.ActionClick, Selector: sel, AtMS: int64(i) * 1000})
+	}
+	return out
+}
+
+func TestRunReportsDivergencesAndContinues(t *testing.T) {
+	target := &fakeTarget{diverge: map[string]bool{"#b": true}}
+	r := New("r1", "s1", "alice")
+	r.Run(context.Background(), target, steps("#a", "#b", "#c"), Options{StepTimeout: time.Second})
+
+	rep := r.Report()
+	if rep.Status != StatusDiverged || rep.Divergences != 1 || rep.FinishedAt == nil {
+		t.Fatalf("report = %+v", rep)
+	}
+	if len(target.ran) != 3 {
+		t.Errorf("ran %v, want all three steps", target.ran)
+	}
+	if rep.Steps[1].Status != StepDiverged || rep.Steps[1].Detail != "no element matches #b" {
+		t.Errorf("step 1 = %+v", rep.Steps[1])
+	}
+}
+
+func TestRunStopsOnError(t *testing.T) {
+	target := &fakeTarget{fail: map[string]bool{"#a": true}}
+	r := New("r1", "s1", "")
+	r.Run(context.Background(), target, steps("#a", "#b"), Options{StepTimeout: time.Second})
+
+	rep := r.Report()
+	if rep.Status != StatusFailed || rep.Error != "browser went away" {
+		t.Fatalf("report = %+v", rep)
+	}
+	if len(target.ran) != 1 || rep.Steps[1].Status != StepSkipped {
+		t.Errorf("ran %v, steps %+v", target.ran, rep.Steps)
+	}
+}
+
+func TestRunSpeed(t *testing.T) {
+	// Recorded one second apart; at 20x they should take about 100ms.
+	start := time.Now()
+	r := New("r1", "s1", "")
+	r.Run(context.Background(), &fakeTarget{}, steps("#a", "#b", "#c"), Options{Speed: 20, StepTimeout: time.Second})
+	if d := time.Since(start); d < 90*time.Millisecond || d > time.Second {
+		t.Errorf("replay at 20x took %v", d)
+	}
+	if r.Report().Status != StatusPassed {
+		t.Errorf("status = %s", r.Report().Status)
+	}
+}
+
+func TestStoreForgetsExpiredReplays(t *testing.T) {
+	st := NewStore(time.Millisecond)
+	old := New("old", "s1", "")
+	old.Run(context.Background(), &fakeTarget{}, nil, Options{})
+	st.Add(old)
+	time.Sleep(5 * time.Millisecond)
+
+	running := New("running", "s2", "")
+	st.Add(running)
+	st.Add(New("new", "s3", ""))
+	if _, ok := st.Get("old"); ok {
+		t.Error("expired replay kept")
+	}
+	if _, ok := st.Get("running"); !ok {
+		t.Error("running replay forgotten")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"browser-server/recording"
+	"browser-server/replay"
+	"browser-server/session"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// replayRetention is how long finished replay reports are kept.
+const replayRetention = 24 * time.Hour
+
+var replayStore = replay.NewStore(replayRetention)
+
+// CreateReplayRequest is the body of POST /replays.
+type CreateReplayRequest struct {
+	Job recording.Job `json:"job"`
+	// Speed scales the recorded pauses; nil means 1, 0 means no pauses.
+	Speed              *float64             `json:"speed"`
+	StepTimeoutSeconds int                  `json:"step_timeout_seconds"`
+	KeepSession        bool                 `json:"keep_session"`
+	Session            CreateSessionRequest `json:"session"`
+	// Webhook, if set, receives the result when the replay finishes.
+	Webhook *JobWebhook `json:"webhook"`
+}
+
+func (req CreateReplayRequest) validate(sessions *session.Manager) error {
+	if req.Job.Version != 1 {
+		return errors.New("job.version must be 1")
+	}
+	if len(req.Job.Steps) == 0 {
+		return errors.New("job has no steps")
+	}
+	for i, step := range req.Job.Steps {
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+	}
+	if req.Speed != nil && *req.Speed < 0 {
+		return errors.New("speed must not be negative")
+	}
+	if req.StepTimeoutSeconds < 0 || req.StepTimeoutSeconds > 300 {
+		return errors.New("step_timeout_seconds must be between 0 and 300")
+	}
+	if err := req.Webhook.validate(); err != nil {
+		return err
+	}
+	return req.Session.validate(sessions)
+}
+
+// createReplayHandler starts replaying a job definition against a fresh
+// session and returns the replay to poll.
+// POST /replays
+func createReplayHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(requestSessions(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts, release, err := sessionOptions(r, req.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer release()
+	sess, err := requestSessions(r).CreateSession(opts)
+	if refuseOverLimit(w, err) {
+		return
+	}
+	if err == session.ErrDraining || err == session.ErrMemoryPressure {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	runOpts := replay.Options{Speed: 1, StepTimeout: 10 * time.Second}
+	if req.Speed != nil {
+		runOpts.Speed = *req.Speed
+	}
+	if req.StepTimeoutSeconds > 0 {
+		runOpts.StepTimeout = time.Duration(req.StepTimeoutSeconds) * time.Second
+	}
+
+	rp := replay.New(uuid.New().String(), sess.ID, sess.Owner)
+	replayStore.Add(rp)
+	base := externalURL(r)
+	go func() {
+		ctx, cancel := sessionContext(serverCtx, sess)
+		defer cancel()
+		rp.Run(ctx, sess, req.Job.Steps, runOpts)
+		rep := rp.Report()
+		log.Printf("Replay %s on session %s: %s (%d divergences)", rp.ID, sess.ID, rep.Status, rep.Divergences)
+		var stopped []string
+		if !req.KeepSession {
+			requestSessions(r).DeleteSession(sess.ID)
+			stopped = append(stopped, sess.ID)
+		}
+		jobFinished(JobResult{
+			Type:       "replay.finished",
+			ID:         rp.ID,
+			Owner:      rep.Owner,
+			Status:     rep.Status,
+			StartedAt:  rep.StartedAt,
+			FinishedAt: rep.FinishedAt,
+			Metrics: map[string]interface{}{
+				"steps":       len(rep.Steps),
+				"divergences": rep.Divergences,
+				"duration_ms": jobDuration(rep.StartedAt, rep.FinishedAt),
+			},
+			Error: rep.Error,
+		}, req.Webhook, base, apiPrefix+"/replays/"+rp.ID, stopped)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", apiPrefix+"/replays/"+rp.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(rp.Report())
+}
+
+// getReplayHandler reports the progress or outcome of a replay.
+// GET /replays/{id}
+func getReplayHandler(w http.ResponseWriter, r *http.Request) {
+	rp, ok := replayStore.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+	if !canControlOwner(r, rp.Owner) && !signedFor(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	writeJSONWithETag(w, r, rp.Report())
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"browser-server/recording"
+	"browser-server/session"
+)
+
+func TestCreateReplayRequestValidate(t *testing.T) {
+	navigate := recording.Step{Action: recording.ActionNavigate, URL: "https://example.com/"}
+	negative := -1.0
+	for name, tc := range map[string]struct {
+		req CreateReplayRequest
+		ok  bool
+	}{
+		"valid":        {CreateReplayRequest{Job: recording.Job{Version: 1, Steps: []recording.Step{navigate}}}, true},
+		"version":      {CreateReplayRequest{Job: recording.Job{Version: 2, Steps: []recording.Step{navigate}}}, false},
+		"no steps":     {CreateReplayRequest{Job: recording.Job{Version: 1}}, false},
+		"bad step":     {CreateReplayRequest{Job: recording.Job{Version: 1, Steps: []recording.Step{{Action: "hover"}}}}, false},
+		"empty assert": {CreateReplayRequest{Job: recording.Job{Version: 1, Steps: []recording.Step{{Action: recording.ActionAssert}}}}, false},
+		"speed":        {CreateReplayRequest{Job: recording.Job{Version: 1, Steps: []recording.Step{navigate}}, Speed: &negative}, false},
+		"webhook":      {CreateReplayRequest{Job: recording.Job{Version: 1, Steps: []recording.Step{navigate}}, Webhook: &JobWebhook{URL: "ftp://example.com/"}}, false},
+	} {
+		if err := tc.req.validate(session.NewManager()); (err == nil) != tc.ok {
+			t.Errorf("%s: validate() = %v", name, err)
+		}
+	}
+}
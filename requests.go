@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultRequestsLimit is the page size of request searches that do not
+// ask for one.
+const defaultRequestsLimit = 100
+
+// parseRequestFilter reads the url, method, status and mime query
+// parameters. status is a code (404), a class (4xx) or "failed".
+func parseRequestFilter(r *http.Request) (session.RequestFilter, error) {
+	q := r.URL.Query()
+	f := session.RequestFilter{URL: q.Get("url"), Method: q.Get("method"), MimeType: q.Get("mime")}
+	switch status := strings.ToLower(q.Get("status")); {
+	case status == "":
+	case status == "failed":
+		f.Failed = true
+	case len(status) == 3 && status[1:] == "xx" && status[0] >= '1' && status[0] <= '5':
+		f.StatusClass = int(status[0] - '0')
+	default:
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 || code > 599 {
+			return f, fmt.Errorf("status must be a status code, a class such as 4xx, or failed")
+		}
+		f.Status = code
+	}
+	return f, nil
+}
+
+// requestsHandler searches the requests a session's pages made, so that
+// traffic can be queried instead of downloading the whole HAR. Only
+// sessions collecting artifacts record their requests.
+// GET /sessions/{id}/requests?url=/api/&status=4xx&mime=application/json&limit=50&offset=0
+func requestsHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	params, err := parseListParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultRequestsLimit
+	}
+	filter, err := parseRequestFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requests, ok := sess.NetworkRequests()
+	if !ok {
+		http.Error(w, "Session does not record its requests; create it with \"artifacts\": true", http.StatusConflict)
+		return
+	}
+	matching := requests[:0]
+	for _, req := range requests {
+		if filter.Match(req) {
+			matching = append(matching, req)
+		}
+	}
+	start, end := params.page(w, r, len(matching))
+	out, err := params.selectFields(matching[start:end])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONWithETag(w, r, out)
+}
+
+// requestBodyHandler returns the response body of a request found with
+// GET /sessions/{id}/requests, as a download like captured response
+// bodies.
+// GET /sessions/{id}/requests/{requestId}/body
+func requestBodyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sess, ok := requestSessions(r).GetSession(vars["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	requests, ok := sess.NetworkRequests()
+	if !ok {
+		http.Error(w, "Session does not record its requests; create it with \"artifacts\": true", http.StatusConflict)
+		return
+	}
+	// The last hop of a redirect has the body.
+	var req *session.NetworkRequest
+	for i := range requests {
+		if requests[i].RequestID == vars["requestId"] {
+			req = &requests[i]
+		}
+	}
+	if req == nil {
+		http.Error(w, "Request not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	data, err := sess.ResponseBody(ctx, req.RequestID)
+	if errors.Is(err, session.ErrNoBody) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if req.MimeType != "" {
+		w.Header().Set("Content-Type", req.MimeType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Response-URL", req.URL)
+	w.Header().Set("X-Response-Status", strconv.Itoa(req.Status))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
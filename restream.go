@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultRestreamBitrate = 2500 // kbit/s
+	minRestreamBitrate     = 300
+	maxRestreamBitrate     = 20000
+)
+
+// RestreamRequest asks for a session to be streamed live to an RTMP
+// ingest such as YouTube's or Twitch's.
+type RestreamRequest struct {
+	// URL is the rtmp:// or rtmps:// ingest URL, stream key included.
+	URL string `json:"url"`
+	// BitrateKbps is the video bitrate, 2500 if zero.
+	BitrateKbps int `json:"bitrate_kbps,omitempty"`
+}
+
+func (req *RestreamRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "rtmp" && u.Scheme != "rtmps") || u.Host == "" {
+		return errors.New("url must be an rtmp:// or rtmps:// URL")
+	}
+	if req.BitrateKbps != 0 && (req.BitrateKbps < minRestreamBitrate || req.BitrateKbps > maxRestreamBitrate) {
+		return fmt.Errorf("bitrate_kbps must be between %d and %d", minRestreamBitrate, maxRestreamBitrate)
+	}
+	return nil
+}
+
+// RestreamStatus describes a session's restream.
+type RestreamStatus struct {
+	// Target is the ingest URL with its stream key hidden.
+	Target      string    `json:"target"`
+	BitrateKbps int       `json:"bitrate_kbps"`
+	StartedAt   time.Time `json:"started_at"`
+	Running     bool      `json:"running"`
+	// Error is why a restream that is no longer running stopped.
+	Error string `json:"error,omitempty"`
+}
+
+// restream is a session being streamed to an RTMP ingest by ffmpeg. It is
+// kept after it stops, so its error can be read, until it is deleted or
+// replaced.
+type restream struct {
+	status RestreamStatus
+	cancel context.CancelFunc
+}
+
+var (
+	restreams   = make(map[string]*restream)
+	restreamsMu sync.Mutex
+)
+
+// streamTarget hides the stream key of an ingest URL, which ends its path
+// or is in its query, so that it can be shown and logged.
+func streamTarget(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	if u.RawQuery != "" {
+		u.RawQuery = ""
+		return u.String()
+	}
+	if i := strings.LastIndex(u.Path, "/"); i >= 0 && i < len(u.Path)-1 {
+		u.Path = u.Path[:i+1] + "***"
+		u.RawPath = u.Path
+	}
+	return u.String()
+}
+
+// restreamArgs makes ffmpeg encode the screencast to H.264 with a silent
+// audio track, which YouTube requires, and send it to ingest as FLV.
+func restreamArgs(ingest string, kbps int) []string {
+	rate := strconv.Itoa(kbps) + "k"
+	return append(append([]string{}, mjpegInput...),
+		"-f", "lavfi", "-i", "anullsrc=channel_layout=stereo:sample_rate=44100",
+		"-map", "0:v", "-map", "1:a",
+		"-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-pix_fmt", "yuv420p",
+		"-vf", evenSize, "-r", "30", "-g", "60",
+		"-b:v", rate, "-maxrate", rate, "-bufsize", strconv.Itoa(2*kbps)+"k",
+		"-c:a", "aac", "-b:a", "128k",
+		"-f", "flv", ingest,
+	)
+}
+
+// sessionRestream describes a session's restream, if it has one.
+func sessionRestream(id string) (*RestreamStatus, bool) {
+	restreamsMu.Lock()
+	defer restreamsMu.Unlock()
+	rs, ok := restreams[id]
+	if !ok {
+		return nil, false
+	}
+	status := rs.status
+	return &status, true
+}
+
+// startRestream streams a session to ingest until the session ends, the
+// restream is deleted or ffmpeg fails. It returns false if the session is
+// already being restreamed.
+func startRestream(sess *session.Session, ingest string, kbps int) (RestreamStatus, bool) {
+	restreamsMu.Lock()
+	defer restreamsMu.Unlock()
+	if old, ok := restreams[sess.ID]; ok && old.status.Running {
+		return old.status, false
+	}
+	ctx, cancel := sessionContext(serverCtx, sess)
+	rs := &restream{
+		status: RestreamStatus{Target: streamTarget(ingest), BitrateKbps: kbps, StartedAt: time.Now(), Running: true},
+		cancel: cancel,
+	}
+	restreams[sess.ID] = rs
+	go func() {
+		defer cancel()
+		log.Printf("Restream: Streaming session %s to %s", sess.ID, rs.status.Target)
+		err := runRestream(ctx, sess, ingest, kbps)
+		if err != nil && ctx.Err() == nil {
+			// ffmpeg's errors may quote the URL, stream key and all.
+			msg := strings.ReplaceAll(err.Error(), ingest, rs.status.Target)
+			log.Printf("Restream: Streaming session %s failed: %s", sess.ID, msg)
+			restreamsMu.Lock()
+			rs.status.Error = msg
+			restreamsMu.Unlock()
+		}
+		restreamsMu.Lock()
+		rs.status.Running = false
+		// Nobody can read the error of a session that is gone.
+		if sess.Context().Err() != nil && restreams[sess.ID] == rs {
+			delete(restreams, sess.ID)
+		}
+		restreamsMu.Unlock()
+		log.Printf("Restream: Stopped streaming session %s", sess.ID)
+	}()
+	return rs.status, true
+}
+
+// runRestream runs ffmpeg on the session's screencast until ctx ends or
+// ffmpeg exits.
+func runRestream(ctx context.Context, sess *session.Session, ingest string, kbps int) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath, restreamArgs(ingest, kbps)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start ffmpeg: %w", err)
+	}
+	if err := feedScreencast(ctx, sess, stdin); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		out := strings.TrimSpace(stderr.String())
+		if len(out) > 500 {
+			out = out[len(out)-500:]
+		}
+		return fmt.Errorf("ffmpeg: %v: %s", err, out)
+	}
+	return errors.New("ffmpeg exited")
+}
+
+// restreamHandler starts streaming a session to an RTMP ingest (POST),
+// describes its restream (GET) or stops it (DELETE).
+// POST, GET, DELETE /sessions/{id}/restream
+func restreamHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		status, ok := sessionRestream(sess.ID)
+		if !ok {
+			http.Error(w, "Session is not being restreamed", http.StatusNotFound)
+			return
+		}
+		writeJSONWithETag(w, r, status)
+
+	case http.MethodDelete:
+		restreamsMu.Lock()
+		rs, ok := restreams[sess.ID]
+		delete(restreams, sess.ID)
+		restreamsMu.Unlock()
+		if !ok {
+			http.Error(w, "Session is not being restreamed", http.StatusNotFound)
+			return
+		}
+		rs.cancel()
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPost:
+		var req RestreamRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := req.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := exec.LookPath(ffmpegPath); err != nil {
+			http.Error(w, "Restreaming needs ffmpeg, which is not installed", http.StatusServiceUnavailable)
+			return
+		}
+		kbps := req.BitrateKbps
+		if kbps == 0 {
+			kbps = defaultRestreamBitrate
+		}
+		status, ok := startRestream(sess, req.URL, kbps)
+		if !ok {
+			http.Error(w, "Session is already being restreamed", http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(status)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// maxRewindSeconds caps the rewind window a session may keep.
+const maxRewindSeconds = 300
+
+// Rewind defaults for new sessions (REWIND_SECONDS, REWIND_FPS).
+var (
+	rewindWindow time.Duration
+	rewindFPS    = 2.0
+)
+
+// setupRewind reads the rewind buffer settings. Sessions keep no rewind
+// history unless REWIND_SECONDS is set or they ask for rewind_seconds.
+func setupRewind() error {
+	if v := os.Getenv("REWIND_SECONDS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxRewindSeconds {
+			return fmt.Errorf("REWIND_SECONDS must be between 0 and %d", maxRewindSeconds)
+		}
+		rewindWindow = time.Duration(n) * time.Second
+	}
+	if v := os.Getenv("REWIND_FPS"); v != "" {
+		f, err := parseFPS(v)
+		if err != nil {
+			return fmt.Errorf("REWIND_FPS: %w", err)
+		}
+		rewindFPS = f
+	}
+	return nil
+}
+
+// rewindIndexEntry describes one frame of a rewind zip.
+type rewindIndexEntry struct {
+	File     string           `json:"file"`
+	TS       int64            `json:"ts"`
+	Seq      uint64           `json:"seq"`
+	Viewport session.Viewport `json:"viewport"`
+}
+
+// rewindHandler returns the session's recent screencast frames as a zip of
+// JPEGs with an index.json, or as JSON frames like /frames sends.
+// GET /sessions/{id}/rewind?seconds=30&format=zip|json
+func rewindHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	window := sess.RewindWindow()
+	if window == 0 {
+		http.Error(w, "Session keeps no rewind history; create it with rewind_seconds", http.StatusConflict)
+		return
+	}
+
+	d := window
+	if v := r.URL.Query().Get("seconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "seconds must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if s := time.Duration(n) * time.Second; s < window {
+			d = s
+		}
+	}
+	frames := sess.Rewind(d)
+
+	switch r.URL.Query().Get("format") {
+	case "json":
+		msgs := make([]frameMessage, 0, len(frames))
+		for _, f := range frames {
+			msgs = append(msgs, frameMessage{Frame: f.Data, TS: f.Time.UnixMilli(), Seq: f.Seq, Viewport: f.Viewport})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(msgs)
+
+	case "", "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-rewind.zip"`, sess.ID))
+		zw := zip.NewWriter(w)
+		index := make([]rewindIndexEntry, 0, len(frames))
+		for i, f := range frames {
+			name := fmt.Sprintf("frames/%06d.jpg", i+1)
+			// JPEGs do not compress further.
+			fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: f.Time})
+			if err != nil {
+				return
+			}
+			fw.Write(f.Data)
+			index = append(index, rewindIndexEntry{File: name, TS: f.Time.UnixMilli(), Seq: f.Seq, Viewport: f.Viewport})
+		}
+		if fw, err := zw.Create("index.json"); err == nil {
+			json.NewEncoder(fw).Encode(index)
+		}
+		zw.Close()
+
+	default:
+		http.Error(w, "format must be zip or json", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"browser-server/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// route describes an API endpoint, the network exposure group it belongs
+// to, the minimum role needed to call it and the summary published in the
+// OpenAPI spec.
+type route struct {
+	Group   routeGroup
+	Method  string
+	Path    string
+	Role    auth.Role
+	Summary string
+	Handler http.HandlerFunc
+}
+
+// apiRoutes is the single source of truth for the API surface. Handlers are
+// registered from it and /openapi.json is generated from it.
+var apiRoutes = []route{
+	// Session Management
+	{groupAPI, "POST", "/sessions", auth.RoleOperator, "Create a new browser session", createSessionHandler},
+	{groupAPI, "GET", "/sessions", auth.RoleViewer, "List all active sessions", listSessionsHandler},
+	{groupAPI, "DELETE", "/sessions", auth.RoleOperator, "Stop all sessions with the given labels", deleteSessionsHandler},
+	{groupAPI, "GET", "/sessions/{id}", auth.RoleViewer, "Get a browser session", getSessionHandler},
+	{groupAPI, "DELETE", "/sessions/{id}", auth.RoleOperator, "Stop a browser session", stopSessionHandler},
+	{groupAPI, "PUT", "/sessions/{id}/heartbeat", auth.RoleOperator, "Renew the lease of a session", heartbeatHandler},
+	{groupAPI, "POST", "/sessions/{id}/navigate", auth.RoleOperator, "Load a URL in the session's page", navigateHandler},
+	{groupAPI, "POST", "/sessions/{id}/evaluate", auth.RoleOperator, "Evaluate a JavaScript expression in the session's page", evaluateHandler},
+	{groupAPI, "GET", "/sessions/{id}/emulation", auth.RoleOperator, "Get the rendering emulation of a session", emulationHandler},
+	{groupAPI, "PUT", "/sessions/{id}/emulation", auth.RoleOperator, "Emulate print media, color schemes, forced colors or vision deficiencies", emulationHandler},
+	{groupAPI, "GET", "/sessions/{id}/article", auth.RoleOperator, "Extract the readable article of the session's page", articleHandler},
+	{groupAPI, "GET", "/sessions/{id}/markdown", auth.RoleOperator, "Convert the session's page to Markdown", markdownHandler},
+	{groupAPI, "GET", "/sessions/{id}/ttl", auth.RoleViewer, "Get how long a session has left", ttlHandler},
+	{groupAPI, "GET", "/sessions/{id}/stats", auth.RoleViewer, "Get bandwidth usage of a session", sessionStatsHandler},
+	{groupAPI, "GET", "/sessions/{id}/artifacts", auth.RoleOperator, "Download the artifact bundle of a finished session", artifactsHandler},
+	{groupAPI, "GET", "/sessions/{id}/browser-logs", auth.RoleOperator, "Get the Chrome log of a session", browserLogsHandler},
+	{groupAPI, "GET", "/sessions/{id}/rewind", auth.RoleViewer, "Get the last seconds of a session's screencast", rewindHandler},
+	{groupAPI, "POST", "/sessions/{id}/clip", auth.RoleViewer, "Render the last seconds of a session's screencast as a GIF or MP4", clipHandler},
+	{groupAPI, "POST", "/sessions/{id}/annotations", auth.RoleOperator, "Draw a box, label or arrow onto the session's screencast", annotationsHandler},
+	{groupAPI, "GET", "/sessions/{id}/annotations", auth.RoleViewer, "List the annotations showing on the session's screencast", annotationsHandler},
+	{groupAPI, "DELETE", "/sessions/{id}/annotations", auth.RoleOperator, "Remove all annotations from the session's screencast", annotationsHandler},
+	{groupAPI, "DELETE", "/sessions/{id}/annotations/{annotationId}", auth.RoleOperator, "Remove an annotation from the session's screencast", deleteAnnotationHandler},
+	{groupAPI, "POST", "/sessions/{id}/highlight", auth.RoleOperator, "Highlight the first element matching a CSS selector in the session's page", highlightHandler},
+	{groupAPI, "DELETE", "/sessions/{id}/highlight", auth.RoleOperator, "Take the highlight off the session's page", highlightHandler},
+	{groupAPI, "POST", "/sessions/{id}/query", auth.RoleOperator, "Describe the elements matching a CSS selector or XPath in the session's page", queryHandler},
+	{groupAPI, "GET", "/sessions/{id}/response-bodies", auth.RoleOperator, "List the captured response bodies of a session", responseBodiesHandler},
+	{groupAPI, "PUT", "/sessions/{id}/response-bodies", auth.RoleOperator, "Set the URL patterns whose response bodies are captured", responseBodiesHandler},
+	{groupAPI, "GET", "/sessions/{id}/response-bodies/{requestId}", auth.RoleOperator, "Download a captured response body", responseBodyHandler},
+	{groupAPI, "GET", "/sessions/{id}/requests", auth.RoleOperator, "Search the requests made by a session's pages", requestsHandler},
+	{groupAPI, "GET", "/sessions/{id}/requests/{requestId}/body", auth.RoleOperator, "Download the response body of a request", requestBodyHandler},
+	{groupAPI, "GET", "/sessions/{id}/downloads/next", auth.RoleOperator, "Wait for the next download of a session and stream it", nextDownloadHandler},
+	{groupAPI, "GET", "/sessions/{id}/recording", auth.RoleOperator, "Export the recorded interactions of a session as a script, or download its video recording", recordingHandler},
+	{groupAPI, "POST", "/sessions/{id}/recording/start", auth.RoleOperator, "Start recording the session's screencast to WebM or MP4", startVideoRecordingHandler},
+	{groupAPI, "POST", "/sessions/{id}/recording/stop", auth.RoleOperator, "Stop recording the session's screencast", stopVideoRecordingHandler},
+	{groupAPI, "PUT", "/sessions/{id}/gallery", auth.RoleOperator, "List the session in the public gallery", galleryHandler},
+	{groupAPI, "DELETE", "/sessions/{id}/gallery", auth.RoleOperator, "Take the session out of the public gallery", galleryHandler},
+	{groupAPI, "POST", "/sessions/{id}/embed", auth.RoleViewer, "Create a signed link to the session's embed widget", createEmbedHandler},
+	{groupAPI, "POST", "/sessions/{id}/snapshot", auth.RoleOperator, "Save the session's profile, tabs, cookies and storage as a named snapshot", createSnapshotHandler},
+
+	{groupAPI, "POST", "/replays", auth.RoleOperator, "Replay a recorded job against a fresh session", createReplayHandler},
+	{groupAPI, "GET", "/replays/{id}", auth.RoleOperator, "Get the progress and divergences of a replay", getReplayHandler},
+	{groupAPI, "POST", "/crawls", auth.RoleOperator, "Crawl a site from a seed URL with a pool of sessions", createCrawlHandler},
+	{groupAPI, "GET", "/crawls/{id}", auth.RoleOperator, "Get the progress and results of a crawl", crawlHandler},
+	{groupAPI, "DELETE", "/crawls/{id}", auth.RoleOperator, "Cancel a crawl", crawlHandler},
+	{groupAPI, "POST", "/cohorts", auth.RoleOperator, "Create identical sessions for a group of users with a share link each", createCohortHandler},
+	{groupAPI, "GET", "/cohorts/{id}", auth.RoleOperator, "Get the statuses and share links of a cohort's sessions", cohortHandler},
+	{groupAPI, "DELETE", "/cohorts/{id}", auth.RoleOperator, "Stop all sessions of a cohort", cohortHandler},
+	{groupAPI, "GET", "/snapshots", auth.RoleOperator, "List the snapshots new sessions can start from", listSnapshotsHandler},
+	{groupAPI, "GET", "/snapshots/{name}", auth.RoleOperator, "Get a snapshot", snapshotHandler},
+	{groupAPI, "DELETE", "/snapshots/{name}", auth.RoleOperator, "Delete a snapshot", snapshotHandler},
+	{groupAPI, "POST", "/mocks/har", auth.RoleOperator, "Convert a HAR into mocks that answer a new session's requests", harMocksHandler},
+
+	{groupAPI, "GET", "/sessions/{id}/events/cdp", auth.RoleOperator, "Stream CDP events of selected domains (Server-Sent Events)", cdpEventsHandler},
+	{groupAPI, "GET", "/events", auth.RoleViewer, "Stream server events (Server-Sent Events)", eventsHandler},
+	{groupAPI, "GET", "/capabilities", auth.RoleViewer, "List the font packs, fonts and languages this worker can render", capabilitiesHandler},
+	{groupAPI, "GET", "/usage", auth.RoleOperator, "Get aggregated usage per tenant for a date range", usageHandler},
+
+	// Proxy & Preview
+	{groupCDP, "GET", "/sessions/{id}/cdp", auth.RoleOperator, "WebSocket proxy to Chrome DevTools Protocol", cdpProxyHandler},
+	{groupCDP, "GET", "/sessions/{id}/cdp/page", auth.RoleOperator, "WebSocket proxy to a single page of the session", pageCDPProxyHandler},
+	{groupCDP, "GET", "/sessions/{id}/input", auth.RoleOperator, "Send mouse and keyboard input over a WebSocket", inputHandler},
+	{groupCDP, "GET", "/sessions/{id}/devtools", auth.RoleOperator, "Open the DevTools frontend on the session's page", devtoolsHandler},
+	{groupCDP, "GET", "/sessions/{id}/devtools/{path:.+}", auth.RoleOperator, "DevTools frontend files bundled with the session's browser", devtoolsFileHandler},
+	{groupWHIP, "GET", "/sessions/{id}/preview", auth.RoleViewer, "Watch the session as an MJPEG stream", previewHandler},
+	{groupWHIP, "GET", "/sessions/{id}/frames", auth.RoleViewer, "Watch the session as a WebSocket stream of JSON frames", framesHandler},
+
+	{groupAPI, "POST", "/sessions/{id}/broadcast", auth.RoleOperator, "Republish the session to the SFU", startBroadcastHandler},
+	{groupAPI, "DELETE", "/sessions/{id}/broadcast", auth.RoleOperator, "Stop republishing the session to the SFU", stopBroadcastHandler},
+	{groupAPI, "POST", "/sessions/{id}/restream", auth.RoleOperator, "Stream the session live to an RTMP ingest", restreamHandler},
+	{groupAPI, "GET", "/sessions/{id}/restream", auth.RoleOperator, "Get the status of the session's restream", restreamHandler},
+	{groupAPI, "DELETE", "/sessions/{id}/restream", auth.RoleOperator, "Stop the session's restream", restreamHandler},
+
+	// WHIP (WebRTC-HTTP Ingestion Protocol)
+	{groupWHIP, "GET", "/sessions/{id}/embed", auth.RoleViewer, "Embeddable session widget for iframes", embedHandler},
+	{groupWHIP, "POST", "/sessions/{id}/whip", auth.RoleViewer, "Create a WHIP resource", whipHandler},
+	{groupWHIP, "PATCH", "/sessions/{id}/whip/{resourceId}", auth.RoleViewer, "Trickle ICE candidates to a WHIP resource or restart its ICE", whipResourceHandler},
+	{groupWHIP, "DELETE", "/sessions/{id}/whip/{resourceId}", auth.RoleViewer, "Terminate a WHIP resource", whipResourceHandler},
+
+	// Administration
+	{groupAdmin, "POST", "/admin/drain", auth.RoleAdmin, "Stop accepting new sessions", drainHandler},
+	{groupAdmin, "DELETE", "/admin/drain", auth.RoleAdmin, "Resume accepting new sessions", drainHandler},
+	{groupAdmin, "POST", "/admin/cleanup", auth.RoleAdmin, "Stop all sessions", cleanupHandler},
+	{groupAdmin, "GET", "/admin/pool", auth.RoleAdmin, "Get the state of the warm browser pool", poolStatsHandler},
+	{groupAdmin, "GET", "/admin/proxies", auth.RoleAdmin, "List the proxy pool and how often each proxy was used", proxyStatsHandler},
+	{groupAdmin, "GET", "/admin/screencast", auth.RoleAdmin, "Get how busy the screencast frame workers are", frameSchedulerStatsHandler},
+	{groupAdmin, "GET", "/admin/limits", auth.RoleAdmin, "Get the session limits and how many sessions count against them", limitStatsHandler},
+}
+
+// apiPrefix is the version prefix the API is mounted under. The routes are
+// also served unprefixed for clients written before versioning, with
+// deprecation headers pointing at the /v1 path.
+const apiPrefix = "/v1"
+
+// legacyDeprecatedAt is when the unprefixed routes were deprecated.
+var legacyDeprecatedAt = time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+
+// legacySunset is when the unprefixed routes will be removed
+// (LEGACY_API_SUNSET). Zero means no date has been announced.
+var legacySunset time.Time
+
+// registerRoutes mounts the API routes of groups (every route when none
+// are given) behind authentication and their role check, under apiPrefix
+// and as a deprecated unprefixed alias. The public gallery, when enabled,
+// is mounted without authentication.
+func registerRoutes(r *mux.Router, groups ...routeGroup) {
+	for _, rt := range apiRoutes {
+		if len(groups) > 0 && !slices.Contains(groups, rt.Group) {
+			continue
+		}
+		handler := authenticate(authorize(rt.Role, rt.Handler))
+		if scope, ok := sessionTokenRoutes[rt.Path]; ok {
+			handler = sessionTokenAuth(scope, authorize(rt.Role, rt.Handler))
+		}
+		h := restrictNetwork(rt.Group, handler)
+		if len(groups) > 0 {
+			h = withListenerGroups(groups, h)
+		}
+		r.Handle(apiPrefix+rt.Path, h).Methods(rt.Method)
+		r.Handle(rt.Path, deprecated(h)).Methods(rt.Method)
+	}
+	if galleryEnabled && (len(groups) == 0 || slices.Contains(groups, groupGallery)) {
+		registerGallery(r)
+	}
+	if len(groups) > 0 && !slices.Contains(groups, groupAPI) {
+		return
+	}
+	spec := restrictNetwork(groupAPI, http.HandlerFunc(openAPIHandler))
+	r.Handle(apiPrefix+"/openapi.json", spec).Methods("GET")
+	r.Handle("/openapi.json", deprecated(spec)).Methods("GET")
+}
+
+// deprecated marks responses from an unprefixed legacy route with
+// Deprecation (RFC 9745), Sunset (RFC 8594) and a successor-version link.
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()))
+		if !legacySunset.IsZero() {
+			w.Header().Set("Sunset", legacySunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, apiPrefix, r.URL.Path))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"browser-server/auth"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	r := mux.NewRouter()
+	registerRoutes(r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/openapi.json", nil))
+	if w.Code != 200 || w.Header().Get("Deprecation") != "" {
+		t.Errorf("/v1/openapi.json: status %d, Deprecation %q", w.Code, w.Header().Get("Deprecation"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != 200 || w.Header().Get("Deprecation") == "" {
+		t.Errorf("/openapi.json: status %d, Deprecation %q", w.Code, w.Header().Get("Deprecation"))
+	}
+	if got, want := w.Header().Get("Link"), `</v1/openapi.json>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+}
+
+func TestOpenAPIMutualTLSOnlyWhenConfigured(t *testing.T) {
+	oldMapper, oldKeys := certMapper, keyStore
+	t.Cleanup(func() { certMapper, keyStore = oldMapper, oldKeys })
+	// API keys alone enable authentication.
+	keyStore = &auth.Store{}
+
+	for _, mapper := range []*auth.CertMapper{nil, {}} {
+		certMapper = mapper
+		w := httptest.NewRecorder()
+		openAPIHandler(w, httptest.NewRequest("GET", "/v1/openapi.json", nil))
+		var spec struct {
+			OpenAPI string `json:"openapi"`
+			Paths   map[string]map[string]struct {
+				Security []map[string][]string `json:"security"`
+			} `json:"paths"`
+			Components struct {
+				SecuritySchemes map[string]struct {
+					Type string `json:"type"`
+				} `json:"securitySchemes"`
+			} `json:"components"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&spec); err != nil {
+			t.Fatal(err)
+		}
+
+		scheme, published := spec.Components.SecuritySchemes["mutualTLS"]
+		if configured := mapper != nil; published != configured {
+			t.Errorf("mTLS configured %v: mutualTLS scheme published %v", configured, published)
+		}
+		// The mutualTLS scheme type is only defined from OpenAPI 3.1 on.
+		if published && (scheme.Type != "mutualTLS" || !strings.HasPrefix(spec.OpenAPI, "3.1")) {
+			t.Errorf("openapi %q declares a %q mutualTLS security scheme", spec.OpenAPI, scheme.Type)
+		}
+		for path, ops := range spec.Paths {
+			for method, op := range ops {
+				for _, req := range op.Security {
+					if _, ok := req["mutualTLS"]; ok && !published {
+						t.Errorf("%s %s requires the unpublished mutualTLS scheme", method, path)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"browser-server/session"
+)
+
+// services are what handlers share across requests: the sessions, the
+// launcher of their browsers and the WHIP resources watching them. main
+// builds them once and hands them to every router it serves; tests build
+// their own, so that nothing a handler uses is swapped underneath it.
+type services struct {
+	sessions *session.Manager
+	// launcher starts the browsers of new sessions; nil runs a local
+	// Chrome.
+	launcher session.Launcher
+	whip     *whipResources
+}
+
+func newServices(sessions *session.Manager, launcher session.Launcher) *services {
+	return &services{sessions: sessions, launcher: launcher, whip: newWHIPResources()}
+}
+
+// servicesKey carries the services of the router a request arrived on.
+type servicesKey struct{}
+
+// withServices has the handlers behind it work with svc.
+func withServices(svc *services, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), servicesKey{}, svc)))
+	})
+}
+
+// requestServices returns the services of the router r arrived on.
+func requestServices(r *http.Request) *services {
+	return r.Context().Value(servicesKey{}).(*services)
+}
+
+// requestSessions returns the session manager of the router r arrived on.
+func requestSessions(r *http.Request) *session.Manager {
+	return requestServices(r).sessions
+}
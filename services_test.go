@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"browser-server/internal/cdptest"
+	"browser-server/session"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+)
+
+// fakeLauncher "starts" browsers that are all the same synthetic
+// DevTools endpoint.
+type fakeLauncher struct {
+	url string
+}
+
+func (l fakeLauncher) Start(ctx context.Context, spec session.LaunchSpec) (session.Browser, string, error) {
+	return fakeBrowser{ctx}, l.url, nil
+}
+
+// fakeBrowser runs until it is killed.
+type fakeBrowser struct {
+	ctx context.Context
+}
+
+func (b fakeBrowser) Wait() error {
+	<-b.ctx.Done()
+	return nil
+}
+
+func (fakeBrowser) PID() int { return 0 }
+
+// newTestServer serves the whole API with services of its own, whose
+// sessions run on a synthetic browser.
+func newTestServer(t *testing.T) (*httptest.Server, *services) {
+	if len(urlSigningKey) == 0 {
+		// Session tokens are derived from the key.
+		urlSigningKey = []byte("test-key")
+		t.Cleanup(func() { urlSigningKey = nil })
+	}
+	browser := cdptest.NewServer(cdptest.Options{FPS: 30, Width: 64, Height: 48})
+	t.Cleanup(browser.Close)
+	svc := newServices(session.NewManager(), fakeLauncher{browser.URL})
+	t.Cleanup(func() { svc.sessions.StopAll() })
+	srv := httptest.NewServer(newRouter(svc, nil))
+	t.Cleanup(srv.Close)
+	return srv, svc
+}
+
+// createTestSession creates a session through the API and returns its ID.
+func createTestSession(srv *httptest.Server) (string, error) {
+	resp, err := http.Post(srv.URL+"/v1/sessions", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var s struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil || resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("create session: %d %v", resp.StatusCode, err)
+	}
+	return s.ID, nil
+}
+
+func deleteTestSession(srv *httptest.Server, id string) error {
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/v1/sessions/"+id, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("delete session: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// readPreviewFrame reads the first frame of a session's MJPEG preview. The
+// preview is unavailable until the session's page is attached, so it is
+// retried until then.
+func readPreviewFrame(srv *httptest.Server, id string) error {
+	url := withSessionToken(srv.URL+"/v1/sessions/"+id+"/preview", id, tokenScopePreview)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusServiceUnavailable && time.Now().Before(deadline) {
+			resp.Body.Close()
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("preview: %d", resp.StatusCode)
+		}
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil || strings.TrimSpace(line) != "--frame" {
+			return fmt.Errorf("preview: %q, %v", line, err)
+		}
+		return nil
+	}
+}
+
+// readFramesMessage reads the first message of a session's /frames stream.
+func readFramesMessage(srv *httptest.Server, id string) error {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/sessions/" + id + "/frames"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg frameMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return err
+	}
+	if len(msg.Frame) == 0 {
+		return fmt.Errorf("frames: empty frame")
+	}
+	return nil
+}
+
+func TestConcurrentSessionLifecycle(t *testing.T) {
+	srv, svc := newTestServer(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for range 8 {
+		wg.Go(func() {
+			id, err := createTestSession(srv)
+			if err != nil {
+				errs <- err
+				return
+			}
+			// The session is deleted while its streams start, which may or
+			// may not get a frame first.
+			var streams sync.WaitGroup
+			streams.Go(func() { readPreviewFrame(srv, id) })
+			streams.Go(func() { readFramesMessage(srv, id) })
+			streams.Go(func() {
+				time.Sleep(50 * time.Millisecond)
+				if err := deleteTestSession(srv, id); err != nil {
+					errs <- err
+				}
+			})
+			streams.Wait()
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := len(svc.sessions.ListSessions()); n != 0 {
+		t.Errorf("%d sessions still running", n)
+	}
+}
+
+func TestSessionStreams(t *testing.T) {
+	srv, _ := newTestServer(t)
+	id, err := createTestSession(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := readPreviewFrame(srv, id); err != nil {
+		t.Error(err)
+	}
+	if err := readFramesMessage(srv, id); err != nil {
+		t.Error(err)
+	}
+}
+
+// whipOffer returns the offer of a viewer wanting the screencast over a
+// data channel.
+func whipOffer(t *testing.T, api *webrtc.API) string {
+	client, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.CreateDataChannel("screencast", nil); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	return offer.SDP
+}
+
+// createWHIPResource posts offer to a session's WHIP endpoint and returns
+// the resource's URL.
+func createWHIPResource(srv *httptest.Server, id, offer string) (string, error) {
+	resp, err := http.Post(srv.URL+"/v1/sessions/"+id+"/whip", "application/sdp", strings.NewReader(offer))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("WHIP: %d %s", resp.StatusCode, body)
+	}
+	return srv.URL + resp.Header.Get("Location"), nil
+}
+
+// useWHIPAPI has WHIP peer connections use local candidates only for the
+// rest of the test, and returns the API they are made with.
+func useWHIPAPI(t *testing.T) *webrtc.API {
+	api, err := newWHIPAPI(session.IPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldAPI, oldServers := whipAPI, iceServers
+	t.Cleanup(func() { whipAPI, iceServers = oldAPI, oldServers })
+	whipAPI, iceServers = api, nil
+	return api
+}
+
+func TestWHIPDeleteRacesDisconnect(t *testing.T) {
+	api := useWHIPAPI(t)
+	srv, svc := newTestServer(t)
+	id, err := createTestSession(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		location, err := createWHIPResource(srv, id, whipOffer(t, api))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resource, ok := svc.whip.get(location[strings.LastIndex(location, "/")+1:])
+		if !ok {
+			t.Fatalf("resource %s not stored", location)
+		}
+
+		// The viewer deletes the resource just as its peer connection
+		// closes; only one of them may tear it down.
+		var wg sync.WaitGroup
+		var status int
+		wg.Go(func() {
+			req, _ := http.NewRequest(http.MethodDelete, location, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			status = resp.StatusCode
+		})
+		wg.Go(func() { resource.PeerConnection.Close() })
+		wg.Wait()
+
+		if status != http.StatusOK && status != http.StatusNotFound {
+			t.Errorf("DELETE: %d", status)
+		}
+		if _, ok := svc.whip.get(resource.ID); ok {
+			t.Errorf("resource %s still stored", resource.ID)
+		}
+		if resource.ctx.Err() == nil {
+			t.Errorf("resource %s still running", resource.ID)
+		}
+	}
+}
+
+func TestWHIPResourceOfAnotherSession(t *testing.T) {
+	api := useWHIPAPI(t)
+	srv, svc := newTestServer(t)
+	mine, err := createTestSession(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := createTestSession(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := createWHIPResource(srv, theirs, whipOffer(t, api))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resourceID := location[strings.LastIndex(location, "/")+1:]
+
+	// Access to mine does not reach their resource.
+	target := srv.URL + "/v1/sessions/" + mine + "/whip/" + resourceID
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		req, _ := http.NewRequest(method, target, strings.NewReader("a=end-of-candidates\r\n"))
+		req.Header.Set("Content-Type", trickleICEContentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s through another session: %d", method, resp.StatusCode)
+		}
+	}
+	if _, ok := svc.whip.get(resourceID); !ok {
+		t.Error("resource deleted through another session")
+	}
+}
+
+func TestWHIPResourcesRefuseEnded(t *testing.T) {
+	rs := newWHIPResources()
+	ctx, cancel := context.WithCancel(context.Background())
+	res := &WHIPResource{ID: "r1", ctx: ctx, cancel: cancel}
+
+	// The peer disconnected before the resource was stored.
+	cancel()
+	if rs.remove(res) {
+		t.Error("removed a resource that was never stored")
+	}
+	if rs.add(res) {
+		t.Error("stored an ended resource")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	res = &WHIPResource{ID: "r2", ctx: ctx, cancel: cancel}
+	if !rs.add(res) {
+		t.Fatal("resource not stored")
+	}
+	if !rs.remove(res) || rs.remove(res) {
+		t.Error("resource not removed exactly once")
+	}
+}
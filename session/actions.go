@@ -0,0 +1,86 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// firstPage returns the session's first page.
+func (s *Session) firstPage() (*cdp.Session, error) {
+	m := s.mon.Load()
+	if m == nil {
+		return nil, errors.New("page control unavailable")
+	}
+	pages := m.pages()
+	if len(pages) == 0 {
+		return nil, ErrNoPage
+	}
+	return pages[0], nil
+}
+
+// ErrScriptException is returned when an evaluated expression throws.
+var ErrScriptException = errors.New("script threw an exception")
+
+// Evaluate runs expression in the session's first page and returns its
+// value as JSON, or null for values that cannot be serialized.
+func (s *Session) Evaluate(ctx context.Context, expression string) (json.RawMessage, error) {
+	s.MarkRunning()
+	page, err := s.firstPage()
+	if err != nil {
+		return nil, err
+	}
+	res, err := cdp.Runtime{Caller: page}.Evaluate(ctx, expression)
+	var cdpErr *cdp.Error
+	if errors.As(err, &cdpErr) && cdpErr.Code == 0 {
+		thrown := cdpErr.Message
+		if cdpErr.Data != "" {
+			thrown = cdpErr.Data
+		}
+		return nil, fmt.Errorf("%w: %s", ErrScriptException, thrown)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(res, &v); err != nil || len(v.Value) == 0 {
+		return json.RawMessage("null"), err
+	}
+	return v.Value, nil
+}
+
+// Screenshot returns a PNG of the session's first page.
+func (s *Session) Screenshot(ctx context.Context) ([]byte, error) {
+	page, err := s.firstPage()
+	if err != nil {
+		return nil, err
+	}
+	data, err := cdp.Page{Caller: page}.CaptureScreenshot(ctx)
+	if err != nil || !s.composites() {
+		return data, err
+	}
+	return s.compositePNG(data, page.ID, time.Now())
+}
+
+// PageHTML returns the URL and the current DOM, serialized as HTML, of
+// the session's first page.
+func (s *Session) PageHTML(ctx context.Context) (string, string, error) {
+	v, err := s.Evaluate(ctx, `({url: location.href, html: document.documentElement.outerHTML})`)
+	if err != nil {
+		return "", "", err
+	}
+	var page struct {
+		URL  string `json:"url"`
+		HTML string `json:"html"`
+	}
+	if err := json.Unmarshal(v, &page); err != nil {
+		return "", "", err
+	}
+	return page.URL, page.HTML, nil
+}
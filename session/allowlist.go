@@ -0,0 +1,143 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// allowPattern pauses every request of sessions with allowed domains, so
+// that the addresses they go to can be checked: the resolver rules only
+// keep Chrome from resolving other names, not from connecting to IP
+// literals or to what an allowed name resolves to.
+var allowPattern = cdp.RequestPattern{URLPattern: "*", RequestStage: "Request"}
+
+// addressCheckTTL is how long the check of a host name's addresses is
+// reused for the session's further requests to it.
+const addressCheckTTL = time.Minute
+
+// lookupIPAddr resolves host names for the address checks.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// addressCheck is the outcome of checking a host name's addresses.
+type addressCheck struct {
+	allowed bool
+	at      time.Time
+}
+
+// internalAddress reports whether ip is on this host or its private
+// networks, which allowed domains must not lead to.
+func internalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// explicitAddress reports whether the allowed domains or the DNS
+// overrides name ip itself.
+func (o Options) explicitAddress(ip net.IP) bool {
+	for _, d := range o.AllowedDomains {
+		if a := net.ParseIP(strings.Trim(d, "[]")); a != nil && a.Equal(ip) {
+			return true
+		}
+	}
+	for _, addr := range o.HostOverrides {
+		if a := net.ParseIP(addr); a != nil && a.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// overridden reports whether a DNS override gives host its address.
+func (o Options) overridden(host string) bool {
+	for h := range o.HostOverrides {
+		h = strings.ToLower(h)
+		if h == host || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvesLocally reports whether the browser resolves host names on this
+// host rather than through a proxy, whose answers a local lookup would
+// not match and which should not see the names leak past it.
+func (o Options) resolvesLocally() bool {
+	return o.SSHTunnel == nil && o.Tor == nil && o.Proxy == nil && !o.RotateProxy && o.Egress == nil
+}
+
+// addressAllowed reports whether a session with allowed domains may send
+// a request to host. IP literals must be listed themselves, or be the
+// address of a DNS override. Names are resolved, unless a proxy resolves
+// them, and may not lead to internal addresses other than listed ones.
+func (o Options) addressAllowed(ctx context.Context, host string) bool {
+	if host == "" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return o.explicitAddress(ip)
+	}
+	host = strings.ToLower(host)
+	if o.overridden(host) {
+		return true
+	}
+	// Other names Chrome only resolves for DevTools, such as localhost.
+	if !domainAllowed(host, o.AllowedDomains) {
+		return false
+	}
+	if !o.resolvesLocally() {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		// Chrome will not get an address either.
+		return true
+	}
+	for _, a := range addrs {
+		if internalAddress(a.IP) && !o.explicitAddress(a.IP) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestAllowed checks the address of a paused request against the
+// session's allowed domains, reusing recent checks of the same host.
+func (m *monitor) requestAllowed(ctx context.Context, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	m.mu.Lock()
+	c, ok := m.addresses[host]
+	m.mu.Unlock()
+	if ok && time.Since(c.at) < addressCheckTTL {
+		return c.allowed
+	}
+	allowed := m.s.opts.addressAllowed(ctx, host)
+	m.mu.Lock()
+	m.addresses[host] = addressCheck{allowed: allowed, at: time.Now()}
+	m.mu.Unlock()
+	return allowed
+}
+
+// continueAllowed continues a paused request if its address is allowed,
+// and fails it otherwise. It may wait for name resolution, so it runs
+// beside the event loop.
+func (m *monitor) continueAllowed(ctx context.Context, page cdp.Fetch, e cdp.RequestPaused) {
+	if !m.requestAllowed(ctx, e.Request.URL) {
+		page.FailRequest(e.RequestID, "AddressUnreachable")
+		if e.ResourceType == "Document" {
+			m.s.addTimeline("navigation_blocked", e.Request.URL)
+		}
+		return
+	}
+	page.ContinueRequest(e.RequestID, requestHeaders(m.s.opts.ExtraHeaders, e.Request.URL, e.Request.Headers))
+}
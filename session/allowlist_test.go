@@ -0,0 +1,56 @@
+package session
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"browser-server/tunnel"
+)
+
+func TestAddressAllowed(t *testing.T) {
+	old := lookupIPAddr
+	t.Cleanup(func() { lookupIPAddr = old })
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		addrs := map[string]string{
+			"www.example.com":      "93.184.216.34",
+			"internal.example.com": "10.1.2.3",
+			"db.example.com":       "10.9.9.9",
+		}
+		return []net.IPAddr{{IP: net.ParseIP(addrs[host])}}, nil
+	}
+
+	opts := Options{
+		AllowedDomains: []string{"example.com", "192.0.2.7", "10.9.9.9"},
+		HostOverrides:  map[string]string{"staging.example.com": "10.0.0.5"},
+	}
+	for host, want := range map[string]bool{
+		"":                     true,
+		"www.example.com":      true,
+		"WWW.Example.com":      true,
+		"internal.example.com": false,
+		"db.example.com":       true,
+		"staging.example.com":  true,
+		"evil.test":            false,
+		"localhost":            false,
+		"192.0.2.7":            true,
+		"10.0.0.5":             true,
+		"93.184.216.34":        false,
+		"127.0.0.1":            false,
+		"169.254.169.254":      false,
+		"::1":                  false,
+	} {
+		if got := opts.addressAllowed(context.Background(), host); got != want {
+			t.Errorf("addressAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	// Through a proxy, names are left to the proxy to resolve.
+	opts.Tor = &tunnel.Tor{}
+	if !opts.addressAllowed(context.Background(), "internal.example.com") {
+		t.Error("name resolved locally for a session behind Tor")
+	}
+	if opts.addressAllowed(context.Background(), "10.1.2.3") {
+		t.Error("IP literal allowed for a session behind Tor")
+	}
+}
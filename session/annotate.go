@@ -0,0 +1,288 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Annotation types.
+const (
+	// AnnotateBox outlines a rectangle, with its text above it.
+	AnnotateBox = "box"
+	// AnnotateLabel shows text with its top-left corner at a point.
+	AnnotateLabel = "label"
+	// AnnotateArrow points from a point to another, with its text at the
+	// start.
+	AnnotateArrow = "arrow"
+)
+
+const (
+	// DefaultAnnotationTTL is how long an annotation shows unless asked
+	// otherwise, and MaxAnnotationTTL the longest it may.
+	DefaultAnnotationTTL = 5 * time.Second
+	MaxAnnotationTTL     = time.Minute
+	maxAnnotations       = 50
+	maxAnnotationText    = 200
+	// defaultAnnotationColor is a red that stands out on most pages.
+	defaultAnnotationColor = "#ff3b30"
+)
+
+// Annotation is an overlay drawn onto a session's screencast, such as the
+// element an agent is about to click, for the humans watching. It is never
+// part of the page, its screenshots or its artifacts. Coordinates are CSS
+// pixels of the viewport.
+type Annotation struct {
+	ID     string  `json:"id"`
+	Type   string  `json:"type"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+	// ToX and ToY are where an arrow points.
+	ToX  float64 `json:"to_x,omitempty"`
+	ToY  float64 `json:"to_y,omitempty"`
+	Text string  `json:"text,omitempty"`
+	// Color is "#rrggbb", red by default.
+	Color     string    `json:"color,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Validate checks an annotation.
+func (a *Annotation) Validate() error {
+	switch a.Type {
+	case AnnotateBox:
+		if a.Width <= 0 || a.Height <= 0 {
+			return errors.New("a box needs a positive width and height")
+		}
+	case AnnotateLabel:
+		if a.Text == "" {
+			return errors.New("a label needs text")
+		}
+	case AnnotateArrow:
+		if a.X == a.ToX && a.Y == a.ToY {
+			return errors.New("an arrow needs to_x and to_y away from x and y")
+		}
+	default:
+		return fmt.Errorf("invalid annotation type %q, use %q, %q or %q", a.Type, AnnotateBox, AnnotateLabel, AnnotateArrow)
+	}
+	if a.X < 0 || a.Y < 0 || a.ToX < 0 || a.ToY < 0 {
+		return errors.New("annotation coordinates cannot be negative")
+	}
+	if len(a.Text) > maxAnnotationText {
+		return fmt.Errorf("annotation text is longer than %d bytes", maxAnnotationText)
+	}
+	if a.Color != "" {
+		if _, err := parseColor(a.Color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseColor parses a "#rrggbb" color.
+func parseColor(s string) (color.RGBA, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(s) != 7 || s[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, use #rrggbb", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
+
+// annotations are the overlays currently drawn onto a session's frames.
+type annotations struct {
+	mu    sync.Mutex
+	items map[string]Annotation
+}
+
+// live returns the annotations that have not expired at t, oldest first.
+func (as *annotations) live(t time.Time) []Annotation {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	var out []Annotation
+	for _, a := range as.items {
+		if t.Before(a.ExpiresAt) {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ExpiresAt.Before(out[j].ExpiresAt) })
+	return out
+}
+
+// Annotate draws a onto the session's screencast for ttl, or
+// DefaultAnnotationTTL if zero. The annotation is returned with its ID
+// and expiry.
+func (s *Session) Annotate(a Annotation, ttl time.Duration) (Annotation, error) {
+	if err := a.Validate(); err != nil {
+		return Annotation{}, err
+	}
+	if ttl <= 0 {
+		ttl = DefaultAnnotationTTL
+	}
+	if ttl > MaxAnnotationTTL {
+		return Annotation{}, fmt.Errorf("annotations show for at most %s", MaxAnnotationTTL)
+	}
+	now := time.Now()
+	a.ID = uuid.New().String()
+	a.ExpiresAt = now.Add(ttl)
+
+	as := &s.annotations
+	as.mu.Lock()
+	for id, old := range as.items {
+		if !now.Before(old.ExpiresAt) {
+			delete(as.items, id)
+		}
+	}
+	if len(as.items) >= maxAnnotations {
+		as.mu.Unlock()
+		return Annotation{}, fmt.Errorf("a session shows at most %d annotations at once", maxAnnotations)
+	}
+	if as.items == nil {
+		as.items = make(map[string]Annotation)
+	}
+	as.items[a.ID] = a
+	as.mu.Unlock()
+
+	// Show it now, and take it away when it expires, even on a page that
+	// does not change.
+	s.cast.refresh()
+	time.AfterFunc(ttl, s.cast.refresh)
+	return a, nil
+}
+
+// Annotations returns the annotations showing on the session's screencast.
+func (s *Session) Annotations() []Annotation {
+	return s.annotations.live(time.Now())
+}
+
+// RemoveAnnotation takes an annotation off the screencast before it
+// expires, or all of them if id is empty. It reports whether there was
+// anything to remove.
+func (s *Session) RemoveAnnotation(id string) bool {
+	as := &s.annotations
+	as.mu.Lock()
+	removed := false
+	if id == "" {
+		removed = len(as.items) > 0
+		as.items = nil
+	} else if _, ok := as.items[id]; ok {
+		delete(as.items, id)
+		removed = true
+	}
+	as.mu.Unlock()
+	if removed {
+		s.cast.refresh()
+	}
+	return removed
+}
+
+// drawAnnotations draws annotations onto a frame showing a viewport
+// cssWidth CSS pixels wide. Lines and text are doubled in size on frames
+// wider than 800 pixels, like the watermark.
+func drawAnnotations(img draw.Image, list []Annotation, cssWidth float64) {
+	b := img.Bounds()
+	scale := 1.0
+	if cssWidth > 0 {
+		scale = float64(b.Dx()) / cssWidth
+	}
+	thickness := 2
+	if b.Dx() > 800 {
+		thickness = 4
+	}
+	pt := func(x, y float64) image.Point {
+		return image.Pt(b.Min.X+int(x*scale), b.Min.Y+int(y*scale))
+	}
+	for _, a := range list {
+		if a.Color == "" {
+			a.Color = defaultAnnotationColor
+		}
+		c, _ := parseColor(a.Color)
+		src := image.NewUniform(c)
+		switch a.Type {
+		case AnnotateBox:
+			r := image.Rectangle{Min: pt(a.X, a.Y), Max: pt(a.X+a.Width, a.Y+a.Height)}
+			for _, edge := range []image.Rectangle{
+				{r.Min, image.Pt(r.Max.X, r.Min.Y+thickness)},
+				{image.Pt(r.Min.X, r.Max.Y-thickness), r.Max},
+				{r.Min, image.Pt(r.Min.X+thickness, r.Max.Y)},
+				{image.Pt(r.Max.X-thickness, r.Min.Y), r.Max},
+			} {
+				draw.Draw(img, edge.Intersect(b), src, image.Point{}, draw.Over)
+			}
+			if a.Text != "" {
+				drawAnnotationText(img, a.Text, c, r.Min, thickness/2, true)
+			}
+		case AnnotateLabel:
+			drawAnnotationText(img, a.Text, c, pt(a.X, a.Y), thickness/2, false)
+		case AnnotateArrow:
+			from, to := pt(a.X, a.Y), pt(a.ToX, a.ToY)
+			drawLine(img, from, to, thickness, src)
+			// Two barbs at 30 degrees either side of the shaft.
+			angle := math.Atan2(float64(from.Y-to.Y), float64(from.X-to.X))
+			barb := float64(6 * thickness)
+			for _, d := range []float64{-math.Pi / 6, math.Pi / 6} {
+				end := to.Add(image.Pt(int(barb*math.Cos(angle+d)), int(barb*math.Sin(angle+d))))
+				drawLine(img, to, end, thickness, src)
+			}
+			if a.Text != "" {
+				drawAnnotationText(img, a.Text, c, from, thickness/2, false)
+			}
+		}
+	}
+}
+
+// drawLine draws a line thickness pixels wide from p to q.
+func drawLine(img draw.Image, p, q image.Point, thickness int, src image.Image) {
+	steps := max(abs(q.X-p.X), abs(q.Y-p.Y), 1)
+	half := thickness / 2
+	for i := 0; i <= steps; i++ {
+		x := p.X + (q.X-p.X)*i/steps
+		y := p.Y + (q.Y-p.Y)*i/steps
+		dot := image.Rect(x-half, y-half, x-half+thickness, y-half+thickness)
+		draw.Draw(img, dot.Intersect(img.Bounds()), src, image.Point{}, draw.Over)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// drawAnnotationText writes text in white on a background of c, scaled by
+// scale, with its top-left corner at at, or its bottom-left corner if
+// above is set and there is room. basicfont only has ASCII, so anything else is replaced.
+func drawAnnotationText(img draw.Image, text string, c color.RGBA, at image.Point, scale int, above bool) {
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, text)
+	face := basicfont.Face7x13
+	label := image.NewRGBA(image.Rect(0, 0, font.MeasureString(face, text).Ceil()+8, face.Height+4))
+	draw.Draw(label, label.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	d := font.Drawer{Dst: label, Src: image.White, Face: face, Dot: fixed.P(4, face.Ascent+2)}
+	d.DrawString(text)
+
+	size := label.Bounds().Size().Mul(max(1, scale))
+	if above && at.Y-size.Y >= img.Bounds().Min.Y {
+		at.Y -= size.Y
+	}
+	xdraw.NearestNeighbor.Scale(img, image.Rectangle{Min: at, Max: at.Add(size)}, label, label.Bounds(), draw.Over, nil)
+}
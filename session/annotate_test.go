@@ -0,0 +1,95 @@
+package session
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+func TestAnnotationValidate(t *testing.T) {
+	for _, a := range []Annotation{
+		{Type: AnnotateBox, X: 10, Y: 10, Width: 100, Height: 40, Text: "Sign in"},
+		{Type: AnnotateLabel, X: 0, Y: 0, Text: "Next", Color: "#00ff00"},
+		{Type: AnnotateArrow, X: 10, Y: 10, ToX: 200, ToY: 150},
+	} {
+		if err := a.Validate(); err != nil {
+			t.Errorf("%+v: %v", a, err)
+		}
+	}
+	for _, a := range []Annotation{
+		{},
+		{Type: "circle", Width: 10, Height: 10},
+		{Type: AnnotateBox, Width: 100},
+		{Type: AnnotateLabel},
+		{Type: AnnotateArrow, X: 5, Y: 5, ToX: 5, ToY: 5},
+		{Type: AnnotateBox, X: -1, Width: 10, Height: 10},
+		{Type: AnnotateBox, Width: 10, Height: 10, Color: "red"},
+	} {
+		if err := a.Validate(); err == nil {
+			t.Errorf("%+v accepted", a)
+		}
+	}
+}
+
+func whiteJPEG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xc000 && g < 0x8000 && b < 0x8000
+}
+
+func TestAnnotateRefreshesFrame(t *testing.T) {
+	s := &Session{}
+	s.cast.s = s
+	v := s.cast.addViewerLocked(0)
+	// A 400x300 frame of a viewport 200 CSS pixels wide.
+	s.cast.last = &rawFrame{data: whiteJPEG(t, 400, 300), viewport: Viewport{Width: 200, Height: 150}}
+
+	a, err := s.Annotate(Annotation{Type: AnnotateBox, X: 50, Y: 50, Width: 50, Height: 25}, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == "" || len(s.Annotations()) != 1 {
+		t.Fatalf("annotation %+v not listed: %+v", a, s.Annotations())
+	}
+
+	frame := <-v.C
+	img, err := jpeg.Decode(bytes.NewReader(frame.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The box's left edge is at x=100 in frame pixels; its middle is not
+	// drawn on.
+	if !isRed(img.At(101, 120)) {
+		t.Errorf("box edge is %v, want red", img.At(101, 120))
+	}
+	if isRed(img.At(150, 125)) {
+		t.Error("inside of the box was drawn on")
+	}
+
+	// Once it expires, the frame is sent again without it.
+	select {
+	case frame = <-v.C:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame after the annotation expired")
+	}
+	img, _ = jpeg.Decode(bytes.NewReader(frame.Data))
+	if isRed(img.At(101, 120)) {
+		t.Error("expired annotation still drawn")
+	}
+	if len(s.Annotations()) != 0 {
+		t.Errorf("expired annotation still listed")
+	}
+}
@@ -0,0 +1,184 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/internal/cdp"
+	"browser-server/internal/wildcard"
+)
+
+const (
+	// maxResponseBodyBytes caps a single captured body. Chrome does not
+	// keep larger bodies for Network.getResponseBody.
+	maxResponseBodyBytes = 32 << 20
+	// maxCapturedBytes caps the bodies kept per session; the oldest are
+	// evicted first.
+	maxCapturedBytes = 128 << 20
+	// MaxResponseBodyPatterns caps the URL patterns of a session.
+	MaxResponseBodyPatterns = 20
+)
+
+// CapturedBody describes a response body kept for retrieval.
+type CapturedBody struct {
+	RequestID  string    `json:"request_id"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status"`
+	MimeType   string    `json:"mime_type"`
+	Size       int       `json:"size"`
+	CapturedAt time.Time `json:"captured_at"`
+
+	data []byte
+}
+
+// bodyCapture keeps the bodies of responses whose URL matches one of its
+// patterns.
+type bodyCapture struct {
+	mu       sync.Mutex
+	patterns []string
+	pending  map[string]CapturedBody // responses seen, body not yet loaded
+	bodies   []*CapturedBody
+	total    int
+}
+
+// ValidateURLPatterns checks response body patterns, which match whole
+// URLs with the wildcards * (any characters) and ? (one character).
+func ValidateURLPatterns(patterns []string) error {
+	if len(patterns) > MaxResponseBodyPatterns {
+		return fmt.Errorf("at most %d URL patterns are allowed", MaxResponseBodyPatterns)
+	}
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("empty URL pattern")
+		}
+	}
+	return nil
+}
+
+// SetResponseBodyPatterns replaces the URL patterns whose response bodies
+// are captured. Bodies captured so far are kept; no patterns stops
+// capturing.
+func (s *Session) SetResponseBodyPatterns(patterns []string) error {
+	if err := ValidateURLPatterns(patterns); err != nil {
+		return err
+	}
+	s.bodies.setPatterns(patterns)
+	if m := s.mon.Load(); m != nil && len(patterns) > 0 {
+		for _, page := range append(m.pages(), m.iframes()...) {
+			enableBodyBuffers(s.ctx, page)
+		}
+	}
+	return nil
+}
+
+// ResponseBodyPatterns returns the URL patterns being captured.
+func (s *Session) ResponseBodyPatterns() []string {
+	s.bodies.mu.Lock()
+	defer s.bodies.mu.Unlock()
+	return append([]string{}, s.bodies.patterns...)
+}
+
+// CapturedBodies lists the captured response bodies, oldest first.
+func (s *Session) CapturedBodies() []CapturedBody {
+	s.bodies.mu.Lock()
+	defer s.bodies.mu.Unlock()
+	out := make([]CapturedBody, len(s.bodies.bodies))
+	for i, b := range s.bodies.bodies {
+		out[i] = *b
+		out[i].data = nil
+	}
+	return out
+}
+
+// CapturedBody returns the captured response of a request and its body.
+func (s *Session) CapturedBody(requestID string) (CapturedBody, []byte, bool) {
+	s.bodies.mu.Lock()
+	defer s.bodies.mu.Unlock()
+	for _, b := range s.bodies.bodies {
+		if b.RequestID == requestID {
+			return *b, b.data, true
+		}
+	}
+	return CapturedBody{}, nil, false
+}
+
+// capturedBodyData returns the captured body of a request, or nil.
+func (s *Session) capturedBodyData(requestID string) []byte {
+	_, data, _ := s.CapturedBody(requestID)
+	return data
+}
+
+func (c *bodyCapture) setPatterns(patterns []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.patterns = append([]string{}, patterns...)
+}
+
+func (c *bodyCapture) active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.patterns) > 0
+}
+
+// responseReceived remembers a response whose URL matches.
+func (c *bodyCapture) responseReceived(e cdp.ResponseReceived) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.patterns {
+		if wildcard.Match(p, e.Response.URL) {
+			if c.pending == nil {
+				c.pending = make(map[string]CapturedBody)
+			}
+			c.pending[e.RequestID] = CapturedBody{
+				RequestID: e.RequestID,
+				URL:       e.Response.URL,
+				Status:    e.Response.Status,
+				MimeType:  e.Response.MimeType,
+			}
+			return
+		}
+	}
+}
+
+// finished removes and returns the pending response of a request.
+func (c *bodyCapture) finished(requestID string) (CapturedBody, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.pending[requestID]
+	delete(c.pending, requestID)
+	return b, ok
+}
+
+func (c *bodyCapture) add(b CapturedBody) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bodies = append(c.bodies, &b)
+	c.total += b.Size
+	for c.total > maxCapturedBytes && len(c.bodies) > 1 {
+		c.total -= c.bodies[0].Size
+		c.bodies = c.bodies[1:]
+	}
+}
+
+// captureBody loads the body of a finished response from its page.
+func (m *monitor) captureBody(ctx context.Context, page *cdp.Session, b CapturedBody) {
+	data, err := cdp.Network{Caller: page}.GetResponseBody(ctx, b.RequestID)
+	if err != nil {
+		log.Printf("Session %s: failed to capture response body of %s: %v", m.s.ID, b.URL, err)
+		return
+	}
+	b.data = data
+	b.Size = len(data)
+	b.CapturedAt = time.Now()
+	m.s.bodies.add(b)
+}
+
+// enableBodyBuffers lets the page keep bodies as large as the capture
+// allows.
+func enableBodyBuffers(ctx context.Context, page *cdp.Session) {
+	cdp.Network{Caller: page}.EnableBuffers(ctx, maxResponseBodyBytes, maxCapturedBytes)
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"strings"
+	"testing"
+
+	"browser-server/internal/cdp"
+)
+
+func TestBodyCapture(t *testing.T) {
+	var c bodyCapture
+	c.setPatterns([]string{"*/api/*"})
+
+	var e cdp.ResponseReceived
+	e.RequestID = "1"
+	e.Response.URL = "https://example.com/api/items"
+	e.Response.Status = 200
+	c.responseReceived(e)
+	e.RequestID = "2"
+	e.Response.URL = "https://example.com/index.html"
+	c.responseReceived(e)
+
+	if _, ok := c.finished("2"); ok {
+		t.Error("non-matching response was kept")
+	}
+	b, ok := c.finished("1")
+	if !ok || b.URL != "https://example.com/api/items" || b.Status != 200 {
+		t.Fatalf("finished = %+v, %v", b, ok)
+	}
+	if _, ok := c.finished("1"); ok {
+		t.Error("response finished twice")
+	}
+
+	big := strings.Repeat("x", maxCapturedBytes/2)
+	for _, id := range []string{"a", "b", "c"} {
+		c.add(CapturedBody{RequestID: id, Size: len(big), data: []byte(big)})
+	}
+	if len(c.bodies) != 2 || c.bodies[0].RequestID != "b" || c.total != 2*len(big) {
+		t.Errorf("after eviction: %d bodies, total %d", len(c.bodies), c.total)
+	}
+
+	if err := ValidateURLPatterns(make([]string, MaxResponseBodyPatterns+1)); err == nil {
+		t.Error("too many patterns accepted")
+	}
+	if err := ValidateURLPatterns([]string{" "}); err == nil {
+		t.Error("empty pattern accepted")
+	}
+}
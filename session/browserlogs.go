@@ -0,0 +1,211 @@
+package session
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxBrowserLogBytes caps chrome.log; later output is dropped.
+const maxBrowserLogBytes = 10 << 20
+
+// browserLogs holds Chrome's log and crash dumps for a session.
+type browserLogs struct {
+	dir string
+
+	mu      sync.Mutex
+	file    *os.File
+	written int64
+}
+
+func newBrowserLogs(dir string) (*browserLogs, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "crashes"), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "chrome.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &browserLogs{dir: dir, file: f}, nil
+}
+
+// flags makes Chrome log to stderr, which is copied into chrome.log, and
+// write crashpad dumps into the crashes directory.
+func (l *browserLogs) flags() []string {
+	return []string{
+		"--enable-logging=stderr",
+		"--log-level=1",
+		"--enable-crash-reporter",
+		"--crash-dumps-dir=" + filepath.Join(l.dir, "crashes"),
+	}
+}
+
+// Write appends to chrome.log until it reaches maxBrowserLogBytes. It
+// never fails, so a full log cannot stall the browser's stderr.
+func (l *browserLogs) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil || l.written >= maxBrowserLogBytes {
+		return len(p), nil
+	}
+	n := int64(len(p))
+	if l.written+n > maxBrowserLogBytes {
+		n = maxBrowserLogBytes - l.written
+	}
+	l.file.Write(p[:n])
+	l.written += n
+	return len(p), nil
+}
+
+func (l *browserLogs) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// crashDumps lists the crash dump files, relative to the crashes directory.
+func (l *browserLogs) crashDumps() []string {
+	var dumps []string
+	root := filepath.Join(l.dir, "crashes")
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), ".dmp") {
+			rel, _ := filepath.Rel(root, path)
+			dumps = append(dumps, rel)
+		}
+		return nil
+	})
+	return dumps
+}
+
+// copyTo copies chrome.log and the crash dumps into dst.
+func (l *browserLogs) copyTo(dst string) error {
+	return filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(l.dir, path)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// BrowserLog returns the session's Chrome log, or "" if it has none.
+func (s *Session) BrowserLog() (string, error) {
+	if s.logs == nil {
+		return "", nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.logs.dir, "chrome.log"))
+	return string(data), err
+}
+
+// CrashDumps lists the crash dumps Chrome wrote for the session.
+func (s *Session) CrashDumps() []string {
+	if s.logs == nil {
+		return nil
+	}
+	return s.logs.crashDumps()
+}
+
+// Crashed reports whether the browser or one of its pages crashed.
+func (s *Session) Crashed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.crashed
+}
+
+// browserCrashed records that the browser exited unexpectedly or a page's
+// renderer crashed.
+func (s *Session) browserCrashed(kind, detail string) {
+	s.mu.Lock()
+	s.crashed = true
+	s.mu.Unlock()
+	s.addTimeline(kind, detail)
+}
+
+// stderrLog returns where the browser's stderr goes, or nil without logs.
+func stderrLog(l *browserLogs) io.Writer {
+	if l == nil {
+		return nil
+	}
+	return l
+}
+
+// watchBrowser reaps the browser process and records it as crashed if it
+// exits before ctx is cancelled. The returned channel closes on exit.
+func (s *Session) watchBrowser(ctx context.Context, b Browser) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		err := b.Wait()
+		close(done)
+		if ctx.Err() != nil {
+			return
+		}
+		detail := "exited"
+		if err != nil {
+			detail = err.Error()
+		}
+		log.Printf("Session %s: browser %s", s.ID, detail)
+		s.browserCrashed("browser_exited", detail)
+		s.setState(StateCrashed)
+	}()
+	return done
+}
+
+// finishBrowserLogs closes the log once the session has stopped. After a
+// crash the log and dumps are added to the artifacts, in a bundle of their
+// own if the session did not collect artifacts.
+func (s *Session) finishBrowserLogs() {
+	if s.logs == nil {
+		return
+	}
+	s.logs.close()
+	defer os.RemoveAll(s.logs.dir)
+	if !s.Crashed() {
+		return
+	}
+
+	dir := s.ArtifactDir()
+	if dir == "" {
+		dir = "/tmp/browser-lab-artifacts-" + s.ID
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Session %s: failed to keep browser logs: %v", s.ID, err)
+			return
+		}
+		writeJSONFile(filepath.Join(dir, "timeline.json"), s.Timeline())
+		s.crashArtifactDir = dir
+	}
+	if err := s.logs.copyTo(filepath.Join(dir, "browser")); err != nil {
+		log.Printf("Session %s: failed to keep browser logs: %v", s.ID, err)
+	}
+}
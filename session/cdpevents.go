@@ -0,0 +1,156 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"browser-server/internal/cdp"
+)
+
+// CDPEventDomains are the domains whose events can be subscribed to.
+// Network, Page and Target events are always collected; Runtime and Log
+// are enabled on the session's pages once someone subscribes to them.
+var CDPEventDomains = []string{"Network", "Page", "Runtime", "Log", "Target"}
+
+// CDPEvent is an event from the session's browser.
+type CDPEvent struct {
+	Method string `json:"method"`
+	// TargetID is the page the event came from, empty for browser-level
+	// events.
+	TargetID string          `json:"target_id,omitempty"`
+	Params   json.RawMessage `json:"params,omitempty"`
+}
+
+// Domain returns the CDP domain of the event.
+func (e CDPEvent) Domain() string {
+	domain, _, _ := strings.Cut(e.Method, ".")
+	return domain
+}
+
+// CDPSubscription receives the events of a set of domains.
+type CDPSubscription struct {
+	// C delivers events. It is closed when the subscription is closed.
+	C <-chan CDPEvent
+
+	c       chan CDPEvent
+	feed    *cdpFeed
+	domains []string
+	dropped int
+}
+
+// Dropped returns how many events were skipped because the subscriber
+// did not keep up.
+func (sub *CDPSubscription) Dropped() int {
+	sub.feed.mu.Lock()
+	defer sub.feed.mu.Unlock()
+	return sub.dropped
+}
+
+// Close ends the subscription.
+func (sub *CDPSubscription) Close() {
+	f := sub.feed
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[sub]; ok {
+		delete(f.subs, sub)
+		close(sub.c)
+	}
+}
+
+// cdpFeed fans browser events out to read-only subscribers.
+type cdpFeed struct {
+	mu   sync.Mutex
+	subs map[*CDPSubscription]struct{}
+}
+
+// SubscribeCDP starts delivering the session's events of the given
+// domains. Subscribers only ever read; a subscriber that falls behind
+// misses events rather than slowing the session down.
+func (s *Session) SubscribeCDP(domains []string) (*CDPSubscription, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains given")
+	}
+	for _, d := range domains {
+		if !slices.Contains(CDPEventDomains, d) {
+			return nil, fmt.Errorf("unsupported domain %q", d)
+		}
+	}
+	m := s.mon.Load()
+	if m == nil {
+		return nil, fmt.Errorf("page control unavailable")
+	}
+
+	f := &s.feed
+	sub := &CDPSubscription{c: make(chan CDPEvent, 256), feed: f, domains: domains}
+	sub.C = sub.c
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[*CDPSubscription]struct{})
+	}
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+
+	for _, page := range append(m.pages(), m.iframes()...) {
+		enableFeedDomains(s.ctx, page, domains)
+	}
+	return sub, nil
+}
+
+// wants reports whether any subscriber wants events of domain.
+func (f *cdpFeed) wants(domain string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subs {
+		if slices.Contains(sub.domains, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// internalBindingPrefix starts the names of the bindings the server's own
+// page scripts report through. Their calls carry what those scripts saw,
+// such as the fields a user filled in, and are not published.
+const internalBindingPrefix = "__browserLab"
+
+// internal reports whether e is a call of one of the server's bindings.
+func (e CDPEvent) internal() bool {
+	if e.Method != "Runtime.bindingCalled" {
+		return false
+	}
+	var b cdp.BindingCalled
+	return json.Unmarshal(e.Params, &b) != nil || strings.HasPrefix(b.Name, internalBindingPrefix)
+}
+
+func (f *cdpFeed) publish(e CDPEvent) {
+	if e.internal() {
+		return
+	}
+	domain := e.Domain()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subs {
+		if !slices.Contains(sub.domains, domain) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// enableFeedDomains enables the domains that are not always on.
+func enableFeedDomains(ctx context.Context, page *cdp.Session, domains []string) {
+	if slices.Contains(domains, "Runtime") {
+		cdp.Runtime{Caller: page}.Enable(ctx)
+	}
+	if slices.Contains(domains, "Log") {
+		cdp.Log{Caller: page}.Enable(ctx)
+	}
+}
@@ -0,0 +1,46 @@
+package session
+
+import "testing"
+
+func TestCDPFeed(t *testing.T) {
+	s := &Session{ID: "feed-test"}
+	if _, err := s.SubscribeCDP([]string{"Network"}); err == nil {
+		t.Error("subscribed without a browser connection")
+	}
+	s.mon.Store(&monitor{s: s, sessions: map[string]int{}, targets: map[string]string{}})
+	if _, err := s.SubscribeCDP([]string{"Fetch"}); err == nil {
+		t.Error("subscribed to an unsupported domain")
+	}
+
+	sub, err := s.SubscribeCDP([]string{"Network", "Runtime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.feed.wants("Network") || s.feed.wants("Log") {
+		t.Error("wants does not match the subscribed domains")
+	}
+	s.feed.publish(CDPEvent{Method: "Page.loadEventFired"})
+	s.feed.publish(CDPEvent{Method: "Runtime.bindingCalled", Params: []byte(`{"name":"__browserLabRecord","payload":"{}"}`)})
+	s.feed.publish(CDPEvent{Method: "Network.requestWillBeSent", TargetID: "T1"})
+	if e := <-sub.C; e.Method != "Network.requestWillBeSent" || e.TargetID != "T1" {
+		t.Errorf("got %+v", e)
+	}
+	select {
+	case e := <-sub.C:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+
+	for i := 0; i < cap(sub.c)+3; i++ {
+		s.feed.publish(CDPEvent{Method: "Network.dataReceived"})
+	}
+	if d := sub.Dropped(); d != 3 {
+		t.Errorf("dropped = %d, want 3", d)
+	}
+
+	sub.Close()
+	sub.Close()
+	if s.feed.wants("Network") {
+		t.Error("closed subscription still registered")
+	}
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// Clock overrides the time the session's pages see, so countdowns,
+// expiring offers and other time-dependent UIs can be tested
+// deterministically.
+type Clock struct {
+	// Time is what Date reports when the session starts. Nil keeps the
+	// real time.
+	Time *time.Time `json:"time,omitempty"`
+	// Frozen stops the clock at Time instead of letting it run on.
+	Frozen bool `json:"frozen,omitempty"`
+	// Timezone is an IANA time zone such as "America/New_York" the pages
+	// run in instead of the host's.
+	Timezone string `json:"timezone,omitempty"`
+
+	// startedAt is the real time Time corresponds to.
+	startedAt time.Time
+}
+
+// Validate checks that the time zone exists and that a frozen clock has a
+// time to stop at.
+func (c Clock) Validate() error {
+	if c.Frozen && c.Time == nil {
+		return errors.New("a frozen clock needs a time")
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("unknown time zone %q", c.Timezone)
+		}
+	}
+	return nil
+}
+
+// clockScript replaces Date so it reports the clock's time, running or
+// frozen, while dates built from explicit values are unaffected.
+func (c Clock) clockScript() string {
+	return fmt.Sprintf(`(() => {
+	if (window.__browserLabClock) return;
+	window.__browserLabClock = true;
+	const RealDate = Date, realNow = Date.now.bind(Date);
+	const start = %d, startedAt = %d, frozen = %t;
+	const now = () => frozen ? start : start + (realNow() - startedAt);
+	function FakeDate(...args) {
+		if (!new.target) return new RealDate(now()).toString();
+		return Reflect.construct(RealDate, args.length ? args : [now()], new.target);
+	}
+	Object.setPrototypeOf(FakeDate, RealDate);
+	Object.defineProperty(FakeDate, "name", {value: "Date"});
+	FakeDate.prototype = RealDate.prototype;
+	FakeDate.now = now;
+	FakeDate.toString = () => RealDate.toString();
+	Object.defineProperty(RealDate.prototype, "constructor", {value: FakeDate, writable: true, configurable: true});
+	globalThis.Date = FakeDate;
+})()`, c.Time.UnixMilli(), c.startedAt.UnixMilli(), c.Frozen)
+}
+
+// apply sets the clock in a page.
+func (c Clock) apply(ctx context.Context, page *cdp.Session) error {
+	if c.Timezone != "" {
+		if err := (cdp.Emulation{Caller: page}).SetTimezoneOverride(ctx, c.Timezone); err != nil {
+			return err
+		}
+	}
+	if c.Time == nil {
+		return nil
+	}
+	script := c.clockScript()
+	return installScript(ctx, page, script)
+}
@@ -0,0 +1,30 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	for _, c := range []Clock{
+		{Frozen: true},
+		{Timezone: "Mars/Olympus_Mons"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v accepted", c)
+		}
+	}
+	if err := (Clock{Timezone: "UTC"}).Validate(); err != nil {
+		t.Error(err)
+	}
+
+	at := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := Clock{Time: &at, Frozen: true, startedAt: at.Add(-time.Hour)}
+	script := c.clockScript()
+	for _, want := range []string{"start = 1893456000000", "startedAt = 1893452400000", "frozen = true"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("clock script lacks %q", want)
+		}
+	}
+}
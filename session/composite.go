@@ -0,0 +1,94 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"time"
+)
+
+// composites reports whether the session's frames and screenshots are
+// redacted or watermarked before anyone sees them.
+func (s *Session) composites() bool {
+	return s.redactor != nil || s.watermark != nil
+}
+
+// composite redacts and watermarks an image of the page with the given
+// CDP session ID, taken at t.
+func (s *Session) composite(img draw.Image, pageID string, t time.Time) {
+	if s.redactor != nil {
+		s.redactor.draw(img, pageID)
+	}
+	if s.watermark != nil {
+		s.watermark.draw(img, t)
+	}
+}
+
+// compositeJPEG composites a JPEG frame, re-encoding it at
+// ScreencastQuality.
+func (s *Session) compositeJPEG(data []byte, pageID string, t time.Time) ([]byte, error) {
+	return s.compositeFrame(data, pageID, t, nil, 0)
+}
+
+// maxFrameSide bounds the width and height of the frames composited, well
+// above those of screencastOptions.
+const maxFrameSide = 4096
+
+// compositeFrame composites a JPEG frame of a viewport cssWidth CSS pixels
+// wide and draws annotations on top, re-encoding it at ScreencastQuality.
+func (s *Session) compositeFrame(data []byte, pageID string, t time.Time, annotations []Annotation, cssWidth float64) ([]byte, error) {
+	// The size is checked before decoding, so that a frame claiming to be
+	// huge cannot have the server allocate memory for it.
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width > maxFrameSide || cfg.Height > maxFrameSide {
+		return nil, fmt.Errorf("frame is %dx%d, larger than %dx%d", cfg.Width, cfg.Height, maxFrameSide, maxFrameSide)
+	}
+	img, err := decodeDrawable(jpeg.Decode, data)
+	if err != nil {
+		return nil, err
+	}
+	s.composite(img, pageID, t)
+	if len(annotations) > 0 {
+		drawAnnotations(img, annotations, cssWidth)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: ScreencastQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compositePNG composites a PNG screenshot.
+func (s *Session) compositePNG(data []byte, pageID string, t time.Time) ([]byte, error) {
+	img, err := decodeDrawable(png.Decode, data)
+	if err != nil {
+		return nil, err
+	}
+	s.composite(img, pageID, t)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDrawable decodes an image into one that can be drawn on.
+func decodeDrawable(decode func(r io.Reader) (image.Image, error), data []byte) (draw.Image, error) {
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if img, ok := src.(draw.Image); ok {
+		return img, nil
+	}
+	img := image.NewRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	return img, nil
+}
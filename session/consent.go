@@ -0,0 +1,174 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"browser-server/internal/cdp"
+)
+
+// Consent preferences.
+const (
+	ConsentReject = "reject"
+	ConsentAccept = "accept"
+)
+
+// ConsentRule dismisses the cookie banner of one consent platform. The
+// selectors are CSS selectors; the preferred button is clicked, falling
+// back to the other one, and Hide is hidden if neither is there.
+type ConsentRule struct {
+	Name   string `json:"name"`
+	Reject string `json:"reject,omitempty"`
+	Accept string `json:"accept,omitempty"`
+	Hide   string `json:"hide,omitempty"`
+}
+
+// consentRules cover the consent platforms seen most often.
+var consentRules = []ConsentRule{
+	{Name: "onetrust", Reject: "#onetrust-reject-all-handler", Accept: "#onetrust-accept-btn-handler", Hide: "#onetrust-consent-sdk"},
+	{Name: "cookiebot", Reject: "#CybotCookiebotDialogBodyButtonDecline", Accept: "#CybotCookiebotDialogBodyLevelButtonLevelOptinAllowAll, #CybotCookiebotDialogBodyButtonAccept", Hide: "#CybotCookiebotDialog"},
+	{Name: "didomi", Reject: "#didomi-notice-disagree-button", Accept: "#didomi-notice-agree-button", Hide: "#didomi-host"},
+	{Name: "quantcast", Reject: ".qc-cmp2-summary-buttons button[mode=secondary]", Accept: ".qc-cmp2-summary-buttons button[mode=primary]", Hide: ".qc-cmp2-container"},
+	{Name: "sourcepoint", Reject: "button.sp_choice_type_REJECT_ALL", Accept: "button.sp_choice_type_11"},
+	{Name: "trustarc", Reject: "#truste-consent-required", Accept: "#truste-consent-button", Hide: "#truste-consent-track"},
+	{Name: "google", Reject: `button[aria-label^="Reject all"]`, Accept: `button[aria-label^="Accept all"]`},
+	{Name: "cookieyes", Reject: ".cky-btn-reject", Accept: ".cky-btn-accept", Hide: ".cky-consent-container, #cookie-law-info-bar"},
+	{Name: "complianz", Reject: ".cmplz-btn.cmplz-deny", Accept: ".cmplz-btn.cmplz-accept", Hide: "#cmplz-cookiebanner-container"},
+	{Name: "osano", Reject: ".osano-cm-denyAll", Accept: ".osano-cm-accept-all", Hide: ".osano-cm-window"},
+	{Name: "cookieconsent", Reject: ".cc-window .cc-deny", Accept: ".cc-window .cc-allow, .cc-window .cc-dismiss", Hide: ".cc-window"},
+	{Name: "iubenda", Reject: ".iubenda-cs-reject-btn", Accept: ".iubenda-cs-accept-btn", Hide: "#iubenda-cs-banner"},
+	{Name: "borlabs", Reject: "a._brlbs-refuse-btn", Accept: "a._brlbs-btn-accept-all", Hide: "#BorlabsCookieBox"},
+	{Name: "cookie-notice", Reject: "#cn-refuse-cookie", Accept: "#cn-accept-cookie", Hide: "#cookie-notice"},
+	{Name: "klaro", Reject: ".klaro .cn-decline", Accept: ".klaro .cm-btn-success", Hide: ".klaro .cookie-notice"},
+}
+
+// ValidateConsent checks a consent preference.
+func ValidateConsent(prefer string) error {
+	switch prefer {
+	case ConsentReject, ConsentAccept:
+		return nil
+	}
+	return fmt.Errorf("invalid consent preference %q, use %q or %q", prefer, ConsentReject, ConsentAccept)
+}
+
+// LoadConsentRules reads additional consent rules from a JSON file
+// holding a list of rules.
+func LoadConsentRules(path string) ([]ConsentRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ConsentRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, r := range rules {
+		if r.Name == "" || r.Reject == "" && r.Accept == "" && r.Hide == "" {
+			return nil, fmt.Errorf("%s: rule %d needs a name and a selector", path, i)
+		}
+	}
+	return rules, nil
+}
+
+// consentBinding is the page function the consent script reports through.
+const consentBinding = "__browserLabConsent"
+
+// consentScript clicks away cookie banners once they appear, using the
+// rules first and then buttons whose text matches the preference inside
+// elements that look like a banner. A banner a rule recognizes but offers
+// no button for is hidden after a grace period. The script gives up 15
+// seconds after the document loads.
+func consentScript(prefer string, rules []ConsentRule) string {
+	encoded, _ := json.Marshal(rules)
+	return fmt.Sprintf(`(() => {
+	if (window.__browserLabConsentWrapped) return;
+	window.__browserLabConsentWrapped = true;
+	const rules = %[1]s, reject = %[2]t;
+	const words = reject
+		? /^(reject|decline|refuse|deny|disagree)( all)?|only (necessary|essential)|necessary only|ablehnen|refuser|rifiuta|rechazar/i
+		: /^(accept|agree|allow|ok|got it|i agree)( all)?|akzeptieren|accepter|accetta|aceptar/i;
+	const report = (name) => { if (typeof %[3]s === "function") %[3]s(name); };
+	const visible = (el) => el && el.getClientRects().length > 0;
+	let done = false;
+	const hide = (r) => {
+		if (done) return;
+		const el = document.querySelector(r.hide);
+		if (!visible(el)) return;
+		el.style.setProperty("display", "none", "important");
+		// Banners often lock scrolling while they are shown.
+		document.documentElement.style.overflow = "";
+		if (document.body) document.body.style.overflow = "";
+		done = true;
+		report(r.name + " (hidden)");
+	};
+	const hiding = new Set();
+	const dismiss = () => {
+		if (done) return;
+		for (const r of rules) {
+			const sel = reject ? [r.reject, r.accept] : [r.accept, r.reject];
+			for (const s of sel) {
+				const el = s && document.querySelector(s);
+				if (visible(el)) {
+					el.click();
+					done = true;
+					return report(r.name);
+				}
+			}
+			if (r.hide && !hiding.has(r) && visible(document.querySelector(r.hide))) {
+				// Give its buttons a moment to render first.
+				hiding.add(r);
+				setTimeout(() => { dismiss(); hide(r); }, 1500);
+			}
+		}
+		const banners = document.querySelectorAll('[id*=cookie i],[class*=cookie i],[id*=consent i],[class*=consent i],[id*=gdpr i],[class*=gdpr i],[aria-label*=cookie i],[aria-label*=consent i]');
+		for (const b of banners) {
+			for (const el of b.querySelectorAll('button,[role=button],a,input[type=button],input[type=submit]')) {
+				const text = (el.innerText || el.value || "").trim();
+				if (text.length < 40 && words.test(text) && visible(el)) {
+					el.click();
+					done = true;
+					return report("heuristic");
+				}
+			}
+		}
+	};
+	let pending = false;
+	const observer = new MutationObserver(() => {
+		if (done) return observer.disconnect();
+		if (pending) return;
+		pending = true;
+		setTimeout(() => { pending = false; dismiss(); }, 250);
+	});
+	const start = () => {
+		dismiss();
+		if (done) return;
+		observer.observe(document.documentElement, {childList: true, subtree: true});
+		setTimeout(() => observer.disconnect(), 15000);
+	};
+	if (document.readyState === "loading") document.addEventListener("DOMContentLoaded", start);
+	else start();
+})()`, encoded, prefer == ConsentReject, consentBinding)
+}
+
+// enableConsentDismissal installs the consent script in a page.
+func enableConsentDismissal(ctx context.Context, page *cdp.Session, prefer string, rules []ConsentRule) error {
+	if err := (cdp.Runtime{Caller: page}).Enable(ctx); err != nil {
+		return err
+	}
+	if err := (cdp.Runtime{Caller: page}).AddBinding(ctx, consentBinding); err != nil {
+		return err
+	}
+	script := consentScript(prefer, append(append([]ConsentRule{}, consentRules...), rules...))
+	return installScript(ctx, page, script)
+}
+
+// handleConsentBinding records a banner the consent script dismissed.
+func (s *Session) handleConsentBinding(msg cdp.Message) {
+	var e cdp.BindingCalled
+	if msg.Decode(&e) != nil || e.Name != consentBinding {
+		return
+	}
+	s.addTimeline("consent_dismissed", e.Payload)
+}
@@ -0,0 +1,41 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConsentRules(t *testing.T) {
+	if err := ValidateConsent("ignore"); err == nil {
+		t.Error("unknown preference accepted")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	os.WriteFile(path, []byte(`[{"name": "acme", "reject": "#acme-no", "hide": "#acme-banner"}]`), 0644)
+	rules, err := LoadConsentRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Reject != "#acme-no" {
+		t.Fatalf("rules = %+v", rules)
+	}
+	os.WriteFile(path, []byte(`[{"name": "empty"}]`), 0644)
+	if _, err := LoadConsentRules(path); err == nil {
+		t.Error("rule without selectors accepted")
+	}
+
+	script := consentScript(ConsentReject, append(consentRules, rules...))
+	for _, want := range []string{`"#onetrust-reject-all-handler"`, `"#acme-no"`, "reject = true", consentBinding} {
+		if !strings.Contains(script, want) {
+			t.Errorf("consent script lacks %s", want)
+		}
+	}
+	for _, r := range consentRules {
+		if r.Name == "" || r.Reject == "" && r.Accept == "" {
+			t.Errorf("built-in rule %+v has no button", r)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// Countdown modes: how pages are told the session is running out.
+const (
+	// CountdownOverlay shows the remaining time in a corner of the page
+	// and logs console notices.
+	CountdownOverlay = "overlay"
+	// CountdownConsole only logs console notices.
+	CountdownConsole = "console"
+)
+
+// ValidateCountdown checks a countdown mode.
+func ValidateCountdown(mode string) error {
+	switch mode {
+	case CountdownOverlay, CountdownConsole:
+		return nil
+	}
+	return fmt.Errorf("invalid countdown %q, use %q or %q", mode, CountdownOverlay, CountdownConsole)
+}
+
+// countdownScript tells a top-level page how long the session has left.
+// It logs a console notice 10, 5 and 1 minutes and 30 seconds before
+// expires, shows an overlay unless consoleOnly, and lets scripts ask with
+// window.browserLabSession.remainingSeconds(). It reads the time from
+// performance rather than Date, which an overridden clock may fake.
+func countdownScript(expires time.Time, consoleOnly bool) string {
+	return fmt.Sprintf(`(() => {
+	if (window !== window.top || window.browserLabSession) return;
+	const expiresAt = %d;
+	const now = () => performance.timeOrigin + performance.now();
+	const remainingSeconds = () => Math.max(0, Math.round((expiresAt - now()) / 1000));
+	Object.defineProperty(window, "browserLabSession", {
+		value: Object.freeze({expiresAt: new Date(expiresAt).toISOString(), remainingSeconds}),
+	});
+	const format = (s) => Math.floor(s / 60) + ":" + String(s %% 60).padStart(2, "0");
+	const notices = [600, 300, 60, 30].filter((s) => s < remainingSeconds());
+	let label = null;
+	if (!%t) {
+		const host = document.createElement("div");
+		host.style.cssText = "position:fixed;right:8px;bottom:8px;z-index:2147483647;pointer-events:none";
+		const root = host.attachShadow({mode: "closed"});
+		label = document.createElement("div");
+		label.style.cssText = "font:12px/1.4 system-ui,sans-serif;padding:3px 8px;border-radius:4px;color:#fff;background:rgba(0,0,0,.6)";
+		root.append(label);
+		const mount = () => document.documentElement.append(host);
+		if (document.documentElement) mount();
+		else document.addEventListener("DOMContentLoaded", mount);
+	}
+	const tick = () => {
+		const left = remainingSeconds();
+		while (notices.length && left <= notices[0]) {
+			notices.shift();
+			console.info("[browser-lab] This session ends in " + format(left) + ".");
+		}
+		if (label) {
+			label.textContent = left > 0 ? "Session ends in " + format(left) : "Session ended";
+			label.style.background = left <= 60 ? "rgba(200,0,0,.8)" : "rgba(0,0,0,.6)";
+		}
+		if (left > 0) setTimeout(tick, 1000);
+	};
+	tick();
+})()`, expires.UnixMilli(), consoleOnly)
+}
+
+// enableCountdown installs the countdown script in a page.
+func enableCountdown(ctx context.Context, page *cdp.Session, expires time.Time, mode string) error {
+	script := countdownScript(expires, mode == CountdownConsole)
+	return installScript(ctx, page, script)
+}
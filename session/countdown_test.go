@@ -0,0 +1,24 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountdown(t *testing.T) {
+	if err := ValidateCountdown("banner"); err == nil {
+		t.Error("unknown countdown mode accepted")
+	}
+
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	script := countdownScript(expires, true)
+	for _, want := range []string{"expiresAt = 1893456000000", "if (!true)", "performance.timeOrigin"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("countdown script lacks %q", want)
+		}
+	}
+	if strings.Contains(script, "%!") {
+		t.Error("countdown script has a formatting error")
+	}
+}
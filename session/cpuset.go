@@ -0,0 +1,52 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CPUSet is a named set of the host's CPUs a session's browser is pinned
+// to, keeping latency-sensitive sessions off the CPUs batch sessions use.
+type CPUSet struct {
+	Name string
+	// CPUs is a CPU list as taskset and Docker take it, e.g. "0-3,8".
+	CPUs string
+}
+
+// ParseCPUList checks a CPU list such as "0-3,8,10-11" and returns the
+// CPUs in it.
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid CPU %q in %q", part, list)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return nil, fmt.Errorf("invalid CPU range %q in %q", part, list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+func cpuSetName(c *CPUSet) string {
+	if c == nil {
+		return ""
+	}
+	return c.Name
+}
+
+func cpuList(c *CPUSet) string {
+	if c == nil {
+		return ""
+	}
+	return c.CPUs
+}
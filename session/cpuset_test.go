@@ -0,0 +1,18 @@
+package session
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("0-2, 8,10-11")
+	if err != nil || !slices.Equal(cpus, []int{0, 1, 2, 8, 10, 11}) {
+		t.Errorf("ParseCPUList = %v, %v", cpus, err)
+	}
+	for _, bad := range []string{"", "a", "3-1", "-1", "1-", "1,,2"} {
+		if _, err := ParseCPUList(bad); err == nil {
+			t.Errorf("ParseCPUList(%q) succeeded", bad)
+		}
+	}
+}
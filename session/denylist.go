@@ -0,0 +1,39 @@
+package session
+
+import (
+	"log"
+
+	"browser-server/internal/cdp"
+)
+
+// denyPattern pauses every document request, of pages and frames, so the
+// deny list can be checked before it leaves the browser.
+var denyPattern = cdp.RequestPattern{URLPattern: "*", ResourceType: "Document", RequestStage: "Request"}
+
+// Blocked is a navigation the session's deny list stopped.
+type Blocked struct {
+	URL string `json:"url"`
+	// Rule is the DenyHosts entry the URL's host matched.
+	Rule string `json:"rule"`
+}
+
+// navigationBlocked records a blocked navigation on the timeline and
+// notifies the manager.
+func (s *Session) navigationBlocked(b Blocked) {
+	s.addTimeline("navigation_blocked", b.URL)
+	log.Printf("Session %s: blocked navigation to %s (%s)", s.ID, b.URL, b.Rule)
+
+	s.mu.Lock()
+	onBlocked := s.onBlocked
+	s.mu.Unlock()
+	if onBlocked != nil {
+		onBlocked(s, b)
+	}
+}
+
+// setOnBlocked registers the callback run when a navigation is blocked.
+func (s *Session) setOnBlocked(fn func(*Session, Blocked)) {
+	s.mu.Lock()
+	s.onBlocked = fn
+	s.mu.Unlock()
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+)
+
+// ErrUnknownPage is returned for a target ID that is not one of the
+// session's pages.
+var ErrUnknownPage = errors.New("no such page in this session")
+
+// PageWSURL returns the DevTools WebSocket URL of the page with the given
+// target ID, or of the first page when targetID is empty. Unlike GetWSURL,
+// which connects to the whole browser, it attaches to a single page the
+// way the DevTools frontend expects.
+func (s *Session) PageWSURL(targetID string) (string, error) {
+	m := s.mon.Load()
+	if m == nil {
+		return "", errors.New("page control unavailable")
+	}
+	targets := m.pageTargets()
+	if len(targets) == 0 {
+		return "", ErrNoPage
+	}
+	if targetID == "" {
+		targetID = targets[0]
+	} else if !slices.Contains(targets, targetID) {
+		return "", ErrUnknownPage
+	}
+
+	u, err := url.Parse(s.GetWSURL())
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/devtools/page/" + targetID
+	return u.String(), nil
+}
+
+// DevToolsURL returns the browser's DevTools HTTP endpoint, which also
+// serves the DevTools frontend bundled with Chrome under /devtools/.
+func (s *Session) DevToolsURL() (*url.URL, error) {
+	u, err := url.Parse(s.GetWSURL())
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Scheme: "http", Host: u.Host}, nil
+}
@@ -0,0 +1,158 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"browser-server/internal/cdp"
+)
+
+// Dialog actions.
+const (
+	DialogAccept  = "accept"
+	DialogDismiss = "dismiss"
+)
+
+// DialogPolicy answers the dialogs pages open, which would otherwise
+// block the page until a CDP client handles them. An empty action leaves
+// that kind of dialog to the client.
+type DialogPolicy struct {
+	Alert        string `json:"alert,omitempty"`
+	Confirm      string `json:"confirm,omitempty"`
+	Prompt       string `json:"prompt,omitempty"`
+	BeforeUnload string `json:"beforeunload,omitempty"`
+	// PromptText is entered into accepted prompts instead of their
+	// default value.
+	PromptText string `json:"prompt_text,omitempty"`
+	// Print decides whether window.print() reaches the browser (accept)
+	// or returns at once (dismiss).
+	Print string `json:"print,omitempty"`
+}
+
+// Validate checks that every action is accept, dismiss or empty.
+func (p DialogPolicy) Validate() error {
+	for kind, action := range map[string]string{
+		"alert":        p.Alert,
+		"confirm":      p.Confirm,
+		"prompt":       p.Prompt,
+		"beforeunload": p.BeforeUnload,
+		"print":        p.Print,
+	} {
+		switch action {
+		case "", DialogAccept, DialogDismiss:
+		default:
+			return fmt.Errorf("invalid %s dialog action %q", kind, action)
+		}
+	}
+	return nil
+}
+
+// action returns what to do with a dialog of the given type.
+func (p DialogPolicy) action(dialogType string) string {
+	switch dialogType {
+	case "alert":
+		return p.Alert
+	case "confirm":
+		return p.Confirm
+	case "prompt":
+		return p.Prompt
+	case "beforeunload":
+		return p.BeforeUnload
+	case "print":
+		return p.Print
+	}
+	return ""
+}
+
+// Dialog is a dialog a page opened and what the session's policy did
+// with it. Action is empty if the dialog was left open.
+type Dialog struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+	URL     string `json:"url"`
+	Action  string `json:"action,omitempty"`
+}
+
+// printBinding is the page function the print script reports through.
+const printBinding = "__browserLabPrint"
+
+// printScript replaces window.print so calls are reported, and only
+// reach the browser when the policy accepts them.
+func printScript(accept bool) string {
+	return fmt.Sprintf(`(() => {
+	if (window.__browserLabPrintWrapped || typeof %[1]s !== "function") return;
+	window.__browserLabPrintWrapped = true;
+	const original = window.print.bind(window);
+	window.print = () => {
+		%[1]s(location.href);
+		if (%[2]t) original();
+	};
+})()`, printBinding, accept)
+}
+
+// enablePrintPolicy installs the print script in a page.
+func enablePrintPolicy(ctx context.Context, page *cdp.Session, action string) error {
+	if err := (cdp.Runtime{Caller: page}).Enable(ctx); err != nil {
+		return err
+	}
+	if err := (cdp.Runtime{Caller: page}).AddBinding(ctx, printBinding); err != nil {
+		return err
+	}
+	script := printScript(action == DialogAccept)
+	return installScript(ctx, page, script)
+}
+
+// handleDialog answers a JavaScript dialog according to the policy.
+func (m *monitor) handleDialog(msg cdp.Message) {
+	var e cdp.JavascriptDialogOpening
+	if msg.Decode(&e) != nil {
+		return
+	}
+	d := Dialog{Type: e.Type, Message: e.Message, URL: e.URL}
+	if p := m.s.opts.Dialogs; p != nil {
+		d.Action = p.action(e.Type)
+	}
+	if d.Action != "" {
+		text := e.DefaultPrompt
+		if m.s.opts.Dialogs.PromptText != "" {
+			text = m.s.opts.Dialogs.PromptText
+		}
+		cdp.Page{Caller: m.client.Session(msg.SessionID)}.HandleJavaScriptDialog(d.Action == DialogAccept, text)
+	}
+	m.s.dialogOpened(d)
+}
+
+// handlePrintBinding reports a window.print() call seen by the print
+// script.
+func (s *Session) handlePrintBinding(msg cdp.Message) {
+	var e cdp.BindingCalled
+	if msg.Decode(&e) != nil || e.Name != printBinding || s.opts.Dialogs == nil {
+		return
+	}
+	s.dialogOpened(Dialog{Type: "print", URL: e.Payload, Action: s.opts.Dialogs.Print})
+}
+
+// dialogOpened records a dialog on the timeline and notifies the manager.
+func (s *Session) dialogOpened(d Dialog) {
+	detail, _ := json.Marshal(d)
+	s.addTimeline("dialog", string(detail))
+	if d.Action == "" {
+		log.Printf("Session %s: %s dialog left open on %s", s.ID, d.Type, d.URL)
+	}
+
+	s.mu.Lock()
+	onDialog := s.onDialog
+	s.mu.Unlock()
+	if onDialog != nil {
+		onDialog(s, d)
+	}
+}
+
+// setOnDialog registers the callback run when a page opens a dialog.
+func (s *Session) setOnDialog(fn func(*Session, Dialog)) {
+	s.mu.Lock()
+	s.onDialog = fn
+	s.mu.Unlock()
+}
@@ -0,0 +1,47 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+
+	"browser-server/internal/cdp"
+)
+
+func TestDialogPolicy(t *testing.T) {
+	if err := (DialogPolicy{Confirm: "maybe"}).Validate(); err == nil {
+		t.Error("invalid action accepted")
+	}
+	p := DialogPolicy{Alert: DialogAccept, BeforeUnload: DialogDismiss, Print: DialogDismiss}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for typ, want := range map[string]string{
+		"alert":        DialogAccept,
+		"confirm":      "",
+		"beforeunload": DialogDismiss,
+		"print":        DialogDismiss,
+		"unknown":      "",
+	} {
+		if got := p.action(typ); got != want {
+			t.Errorf("action(%q) = %q, want %q", typ, got, want)
+		}
+	}
+}
+
+func TestPrintBinding(t *testing.T) {
+	s := &Session{ID: "dialog-test", opts: Options{Dialogs: &DialogPolicy{Print: DialogDismiss}}}
+	var got []Dialog
+	s.setOnDialog(func(_ *Session, d Dialog) { got = append(got, d) })
+
+	params, _ := json.Marshal(cdp.BindingCalled{Name: printBinding, Payload: "https://example.com/invoice"})
+	s.handlePrintBinding(cdp.Message{Method: "Runtime.bindingCalled", Params: params})
+	params, _ = json.Marshal(cdp.BindingCalled{Name: interactionBinding, Payload: "{}"})
+	s.handlePrintBinding(cdp.Message{Method: "Runtime.bindingCalled", Params: params})
+
+	if len(got) != 1 || got[0] != (Dialog{Type: "print", URL: "https://example.com/invoice", Action: DialogDismiss}) {
+		t.Errorf("dialogs = %+v", got)
+	}
+	if tl := s.Timeline(); len(tl) != 1 || tl[0].Kind != "dialog" {
+		t.Errorf("timeline = %+v", tl)
+	}
+}
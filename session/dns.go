@@ -0,0 +1,114 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"browser-server/egress"
+	"browser-server/tunnel"
+)
+
+// ValidateHostOverrides checks that every override maps a host name (or a
+// *.domain pattern) to an IP address.
+func ValidateHostOverrides(overrides map[string]string) error {
+	for host, ip := range overrides {
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "*?/:, ") {
+			return fmt.Errorf("invalid host %q in DNS overrides", host)
+		}
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("DNS override for %q is not an IP address: %q", host, ip)
+		}
+	}
+	return nil
+}
+
+// CheckHostOverrides refuses overrides for hosts outside AllowedDomains,
+// which would otherwise let a session reach addresses its allowlist
+// forbids.
+func (o Options) CheckHostOverrides() error {
+	if len(o.AllowedDomains) == 0 {
+		return nil
+	}
+	for host := range o.HostOverrides {
+		if !domainAllowed(strings.TrimPrefix(strings.ToLower(host), "*."), o.AllowedDomains) {
+			return fmt.Errorf("DNS override for %q is outside the allowed domains", host)
+		}
+	}
+	return nil
+}
+
+// tunnelAllow returns the hosts an SSH tunnel may connect to: with a SOCKS
+// proxy the browser leaves name resolution, and so the allowlist, to the
+// proxy. Overridden addresses stay reachable.
+func tunnelAllow(o Options) func(host string) bool {
+	if len(o.AllowedDomains) == 0 {
+		return nil
+	}
+	return func(host string) bool {
+		for _, ip := range o.HostOverrides {
+			if host == ip {
+				return true
+			}
+		}
+		return domainAllowed(strings.ToLower(host), o.AllowedDomains)
+	}
+}
+
+func domainAllowed(host string, allowed []string) bool {
+	for _, d := range allowed {
+		d = strings.TrimPrefix(strings.ToLower(d), "*.")
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostRules returns the --host-rules value mapping overridden hosts to
+// their addresses, or "". Unlike --host-resolver-rules, these rules are
+// not subject to the allowlist's exclusions, and the page keeps the host
+// name for TLS and the Host header.
+func hostRules(overrides map[string]string) string {
+	hosts := make([]string, 0, len(overrides))
+	for host := range overrides {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	rules := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		rules = append(rules, "MAP "+strings.ToLower(host)+" "+hostRuleAddress(overrides[host]))
+	}
+	return strings.Join(rules, ", ")
+}
+
+func hostRuleAddress(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]"
+	}
+	return ip
+}
+
+func tunnelName(c *tunnel.Config) string {
+	if c == nil {
+		return ""
+	}
+	return c.User + "@" + c.Host
+}
+
+func proxyName(u *tunnel.Upstream) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+func egressName(p *egress.Profile) string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHostRules(t *testing.T) {
+	overrides := map[string]string{
+		"www.example.com":   "10.0.0.5",
+		"*.api.example.com": "fd00::1",
+	}
+	want := "MAP *.api.example.com [fd00::1], MAP www.example.com 10.0.0.5"
+	if got := hostRules(overrides); got != want {
+		t.Errorf("hostRules = %q, want %q", got, want)
+	}
+	if got := hostRules(nil); got != "" {
+		t.Errorf("hostRules(nil) = %q", got)
+	}
+
+	// The allowlist must not block the overridden addresses.
+	rules := hostResolverRules([]string{"example.com"}, overrides)
+	for _, want := range []string{"EXCLUDE 10.0.0.5", "EXCLUDE [fd00::1]"} {
+		if !strings.Contains(rules, want) {
+			t.Errorf("resolver rules %q lack %q", rules, want)
+		}
+	}
+}
+
+func TestHostOverridesValidation(t *testing.T) {
+	if err := ValidateHostOverrides(map[string]string{"*.example.com": "10.0.0.5"}); err != nil {
+		t.Errorf("valid overrides: %v", err)
+	}
+	for _, bad := range []map[string]string{
+		{"www.example.com": "staging"},
+		{"": "10.0.0.5"},
+		{"www.example.com, MAP *": "10.0.0.5"},
+	} {
+		if ValidateHostOverrides(bad) == nil {
+			t.Errorf("overrides %v accepted", bad)
+		}
+	}
+
+	opts := Options{
+		AllowedDomains: []string{"example.com"},
+		HostOverrides:  map[string]string{"www.example.com": "10.0.0.5"},
+	}
+	if err := opts.CheckHostOverrides(); err != nil {
+		t.Errorf("allowed override refused: %v", err)
+	}
+	opts.HostOverrides["evil.test"] = "10.0.0.6"
+	if opts.CheckHostOverrides() == nil {
+		t.Error("override outside the allowed domains accepted")
+	}
+}
@@ -0,0 +1,280 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// dockerSessionLabel marks the containers of sessions so that ones left
+	// behind by a crashed server can be found.
+	dockerSessionLabel = "browser-lab.session"
+	// dockerDevToolsPort is the port Chrome listens on in its container.
+	dockerDevToolsPort = "9222"
+)
+
+// DockerLauncher runs each session's browser in a container of its own,
+// through the docker CLI. The session's profile, logs and artifacts are
+// bind-mounted at their host paths, and the container is removed with the
+// browser.
+type DockerLauncher struct {
+	// Image is the container image. Its entrypoint must run Chrome or
+	// Chromium with the arguments it is given, unless Command is set.
+	Image string
+	// Command, if set, is the browser executable in the image, run
+	// instead of its entrypoint.
+	Command string
+	// Memory and CPUs limit each container, in docker's notation (e.g.
+	// "2g" and "1.5"); empty means no limit.
+	Memory string
+	CPUs   string
+	// ShmSize is the size of the container's /dev/shm, "1g" if empty.
+	ShmSize string
+	// Network is the docker network containers join. If empty, each
+	// container gets a bridge network of its own, so that no other
+	// container can reach its DevTools port. Containers on a named network
+	// can reach each other's. Only with "host" can browsers reach proxies
+	// on this host's loopback, as SSH tunnels, Tor and upstream proxies
+	// use.
+	Network string
+	// Docker is the docker CLI, "docker" if empty.
+	Docker string
+}
+
+func (d *DockerLauncher) docker() string {
+	if d.Docker == "" {
+		return "docker"
+	}
+	return d.Docker
+}
+
+// Check rejects sessions that need the browser to run on this host.
+func (d *DockerLauncher) Check(opts Options) error {
+	if opts.Egress != nil {
+		return errors.New("egress profiles need the local browser launcher")
+	}
+	if len(opts.Fonts) > 0 {
+		return errors.New("font packs need the local browser launcher")
+	}
+	if (opts.SSHTunnel != nil || opts.Tor != nil || opts.Proxy != nil || opts.RotateProxy) && d.Network != "host" {
+		return errors.New("SSH tunnels, Tor and upstream proxies need the docker launcher's host network")
+	}
+	return nil
+}
+
+// containerName returns the name of a session's container, and of its
+// network unless DockerLauncher.Network is set.
+func containerName(sessionID string) string {
+	return "browser-lab-" + sessionID
+}
+
+// network returns the network of a session's container.
+func (d *DockerLauncher) network(sessionID string) string {
+	if d.Network == "" {
+		return containerName(sessionID)
+	}
+	return d.Network
+}
+
+// runArgs returns the docker run command line for spec.
+func (d *DockerLauncher) runArgs(spec LaunchSpec) []string {
+	args := []string{
+		"run", "--rm", "--init",
+		"--name", containerName(spec.SessionID),
+		"--label", dockerSessionLabel + "=" + spec.SessionID,
+		// Files in the mounted directories stay the server's own.
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--env", "HOME=/tmp",
+		"--oom-score-adj", browserOOMScoreAdj,
+	}
+	shm := d.ShmSize
+	if shm == "" {
+		shm = "1g"
+	}
+	args = append(args, "--shm-size", shm)
+	if d.Memory != "" {
+		args = append(args, "--memory", d.Memory, "--memory-swap", d.Memory)
+	}
+	if d.CPUs != "" {
+		args = append(args, "--cpus", d.CPUs)
+	}
+	if spec.CPUs != "" {
+		args = append(args, "--cpuset-cpus", spec.CPUs)
+	}
+	args = append(args, "--network", d.network(spec.SessionID))
+	if d.Network != "host" {
+		args = append(args, "--publish", "127.0.0.1::"+dockerDevToolsPort)
+	}
+	for _, dir := range spec.Dirs {
+		args = append(args, "--volume", dir+":"+dir)
+	}
+	for _, e := range spec.Env {
+		args = append(args, "--env", e)
+	}
+	if d.Command != "" {
+		args = append(args, "--entrypoint", d.Command)
+	}
+	args = append(args, d.Image)
+	return append(args, d.browserArgs(spec.Args)...)
+}
+
+// browserArgs makes Chrome listen where the DevTools port is published,
+// on every address of the container since its address on the network is
+// only known once it runs. On the host network it keeps listening on the
+// host's loopback.
+func (d *DockerLauncher) browserArgs(args []string) []string {
+	if d.Network == "host" {
+		return args
+	}
+	out := make([]string, 0, len(args))
+	for _, a := range args {
+		switch {
+		case strings.HasPrefix(a, "--remote-debugging-port="):
+			a = "--remote-debugging-port=" + dockerDevToolsPort
+		case strings.HasPrefix(a, "--remote-debugging-address="):
+			a = "--remote-debugging-address=0.0.0.0"
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// dockerBrowser is a browser in a container, followed through the docker
+// CLI attached to it.
+type dockerBrowser struct{ cmd *exec.Cmd }
+
+func (b dockerBrowser) Wait() error { return b.cmd.Wait() }
+
+// PID is 0: the container's processes are not children of the CLI, and
+// its memory is bounded by DockerLauncher.Memory instead.
+func (b dockerBrowser) PID() int { return 0 }
+
+// Start runs the browser's container and waits for it to report its
+// DevTools URL. The container is removed when ctx ends.
+func (d *DockerLauncher) Start(ctx context.Context, spec LaunchSpec) (Browser, string, error) {
+	name := containerName(spec.SessionID)
+	// A failed earlier attempt may have left its container behind.
+	d.remove(name)
+	for _, dir := range spec.Dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, "", err
+		}
+	}
+	if d.Network == "" {
+		if err := d.createNetwork(name, spec.SessionID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	cmd := exec.Command(d.docker(), d.runArgs(spec)...)
+	pipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	var stderr io.Reader = pipe
+	if spec.Stderr != nil {
+		stderr = io.TeeReader(pipe, spec.Stderr)
+	}
+	if err := cmd.Start(); err != nil {
+		d.remove(name)
+		return nil, "", err
+	}
+	stop := context.AfterFunc(ctx, func() { d.remove(name) })
+	fail := func(err error) (Browser, string, error) {
+		stop()
+		d.remove(name)
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, "", err
+	}
+
+	// Pulling the image counts against the timeout too.
+	wsURL, err := parseDevToolsURL(stderr, spec.Timeout)
+	if err != nil {
+		return fail(fmt.Errorf("failed to parse devtools url: %w", err))
+	}
+	if d.Network == "host" {
+		return dockerBrowser{cmd}, loopbackURL(wsURL, remoteDebuggingAddress(spec.Args)), nil
+	}
+	hostPort, err := d.publishedPort(name)
+	if err != nil {
+		return fail(err)
+	}
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return fail(err)
+	}
+	u.Host = hostPort
+	return dockerBrowser{cmd}, u.String(), nil
+}
+
+// publishedPort returns the host address Chrome's DevTools port is
+// published on.
+func (d *DockerLauncher) publishedPort(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, d.docker(), "port", name, dockerDevToolsPort+"/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("docker port: %w", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+	}
+	return "", errors.New("docker port: DevTools port not published")
+}
+
+// createNetwork creates the bridge network of a session's container.
+func (d *DockerLauncher) createNetwork(name, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, d.docker(), "network", "create", "--label", dockerSessionLabel+"="+sessionID, name)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker network create: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// remove force-removes a container, and its own network, if they exist.
+func (d *DockerLauncher) remove(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	exec.CommandContext(ctx, d.docker(), "rm", "--force", name).Run()
+	if d.Network == "" {
+		exec.CommandContext(ctx, d.docker(), "network", "rm", name).Run()
+	}
+}
+
+// Cleanup removes the session containers and networks left behind by an
+// earlier run of the server, e.g. after it crashed, and returns how many
+// containers there were.
+func (d *DockerLauncher) Cleanup() (int, error) {
+	out, err := exec.Command(d.docker(), "ps", "--all", "--quiet", "--filter", "label="+dockerSessionLabel).Output()
+	if err != nil {
+		return 0, fmt.Errorf("docker ps: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) > 0 {
+		var stderr bytes.Buffer
+		cmd := exec.Command(d.docker(), append([]string{"rm", "--force"}, ids...)...)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return 0, fmt.Errorf("docker rm: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	if err := exec.Command(d.docker(), "network", "prune", "--force", "--filter", "label="+dockerSessionLabel).Run(); err != nil {
+		return len(ids), fmt.Errorf("docker network prune: %w", err)
+	}
+	return len(ids), nil
+}
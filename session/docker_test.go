@@ -0,0 +1,114 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDocker writes a docker CLI that logs its command lines, and whose
+// containers report a DevTools URL and have it published on port 49153.
+func fakeDocker(t *testing.T) (path, logPath string) {
+	dir := t.TempDir()
+	path, logPath = filepath.Join(dir, "docker"), filepath.Join(dir, "log")
+	script := `#!/bin/sh
+echo "$@" >> ` + logPath + `
+case "$1" in
+run)
+	echo "DevTools listening on ws://0.0.0.0:9222/devtools/browser/x" >&2
+	exec sleep 5;;
+port)
+	echo "127.0.0.1:49153";;
+esac
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, logPath
+}
+
+func TestDockerLauncher(t *testing.T) {
+	docker, logPath := fakeDocker(t)
+	d := &DockerLauncher{Image: "chrome:test", Memory: "2g", CPUs: "1.5", Docker: docker}
+
+	if err := d.Check(Options{Fonts: []FontPack{{Name: "cjk"}}}); err == nil {
+		t.Error("font packs accepted")
+	}
+	if err := d.Check(Options{}); err != nil {
+		t.Error(err)
+	}
+
+	profile := filepath.Join(t.TempDir(), "profile")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b, wsURL, err := d.Start(ctx, LaunchSpec{
+		SessionID: "s1",
+		Args:      []string{"--remote-debugging-port=0", "--remote-debugging-address=127.0.0.1", "--headless=new"},
+		Env:       []string{"LANG=de_DE.UTF-8"},
+		Dirs:      []string{profile},
+		CPUs:      "0-3",
+		Timeout:   5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wsURL != "ws://127.0.0.1:49153/devtools/browser/x" {
+		t.Errorf("wsURL = %q", wsURL)
+	}
+	if b.PID() != 0 {
+		t.Errorf("PID = %d, want 0", b.PID())
+	}
+	if _, err := os.Stat(profile); err != nil {
+		t.Errorf("profile directory not created: %v", err)
+	}
+
+	data, _ := os.ReadFile(logPath)
+	var run []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "run ") {
+			run = strings.Fields(line)
+		}
+	}
+	for _, want := range [][]string{
+		{"--name", "browser-lab-s1"},
+		{"--memory", "2g"},
+		{"--cpus", "1.5"},
+		{"--cpuset-cpus", "0-3"},
+		{"--network", "browser-lab-s1"},
+		{"--publish", "127.0.0.1::9222"},
+		{"--volume", profile + ":" + profile},
+		{"--env", "LANG=de_DE.UTF-8"},
+		{"chrome:test", "--remote-debugging-port=9222", "--remote-debugging-address=0.0.0.0", "--headless=new"},
+	} {
+		found := false
+		for i := 0; i+len(want) <= len(run); i++ {
+			found = found || slices.Equal(run[i:i+len(want)], want)
+		}
+		if !found {
+			t.Errorf("docker run lacks %q: %q", want, run)
+		}
+	}
+
+	// The container's DevTools port is only reachable on its own network.
+	if !strings.Contains(string(data), "network create --label browser-lab.session=s1 browser-lab-s1\nrun ") {
+		t.Errorf("network not created before the container: %s", data)
+	}
+
+	// Ending the session removes its container and network.
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(logPath)
+		if strings.Count(string(data), "rm --force browser-lab-s1") >= 2 && strings.Count(string(data), "network rm browser-lab-s1") >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("container not removed: %s", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+const (
+	// downloadClaimTimeout is how long a download waits for a client to
+	// claim it before it is dropped.
+	downloadClaimTimeout = 30 * time.Second
+	// downloadChunkSize is how much is read from the browser at a time.
+	downloadChunkSize = 1 << 20
+)
+
+// ErrDownloadsNotStreamed is returned by NextDownload for a session that
+// was not created with StreamDownloads.
+var ErrDownloadsNotStreamed = errors.New("session does not stream downloads")
+
+// Download is a file the page started downloading. Reading it streams the
+// file from the browser as it arrives; nothing is written to disk.
+// Closing it early cancels the download.
+type Download struct {
+	URL      string
+	Filename string
+	MimeType string
+	// Size is the length announced by the server, or -1.
+	Size int64
+
+	r *io.PipeReader
+}
+
+func (d *Download) Read(p []byte) (int, error) { return d.r.Read(p) }
+
+func (d *Download) Close() error { return d.r.Close() }
+
+// NextDownload waits until the page starts a download or ctx ends. The
+// caller must read and close the download.
+func (s *Session) NextDownload(ctx context.Context) (*Download, error) {
+	if s.downloads == nil {
+		return nil, ErrDownloadsNotStreamed
+	}
+	select {
+	case d := <-s.downloads:
+		return d, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		return nil, errors.New("session stopped")
+	}
+}
+
+// downloadPatterns pause the responses of navigations, which is where
+// downloads come from, so they can be taken over before Chrome saves them.
+func downloadPatterns() []cdp.RequestPattern {
+	return []cdp.RequestPattern{
+		{URLPattern: "*", ResourceType: "Document", RequestStage: "Response"},
+		{URLPattern: "*", ResourceType: "Other", RequestStage: "Response"},
+	}
+}
+
+// isDownload reports whether Chrome would save a response instead of
+// rendering it.
+func isDownload(status int, headers []cdp.HeaderEntry) bool {
+	if status < 200 || status > 299 {
+		return false
+	}
+	var contentType string
+	for _, h := range headers {
+		switch strings.ToLower(h.Name) {
+		case "content-disposition":
+			if disposition, _, _ := mime.ParseMediaType(h.Value); disposition == "attachment" {
+				return true
+			}
+		case "content-type":
+			contentType, _, _ = mime.ParseMediaType(h.Value)
+		}
+	}
+	if contentType == "" {
+		return false
+	}
+	major, _, _ := strings.Cut(contentType, "/")
+	switch major {
+	case "text", "image", "audio", "video", "multipart":
+		return false
+	}
+	switch contentType {
+	case "application/json", "application/javascript", "application/xml", "application/xhtml+xml", "application/pdf":
+		return false
+	}
+	return !strings.HasSuffix(contentType, "+xml") && !strings.HasSuffix(contentType, "+json")
+}
+
+// newDownload describes a paused download response.
+func newDownload(e cdp.RequestPaused) *Download {
+	d := &Download{URL: e.Request.URL, MimeType: "application/octet-stream", Size: -1}
+	for _, h := range e.ResponseHeaders {
+		switch strings.ToLower(h.Name) {
+		case "content-disposition":
+			if _, params, err := mime.ParseMediaType(h.Value); err == nil {
+				d.Filename = path.Base(params["filename"])
+			}
+		case "content-type":
+			if t, _, err := mime.ParseMediaType(h.Value); err == nil {
+				d.MimeType = t
+			}
+		case "content-length":
+			if n, err := strconv.ParseInt(h.Value, 10, 64); err == nil {
+				d.Size = n
+			}
+		}
+	}
+	if d.Filename == "" || d.Filename == "." || d.Filename == "/" {
+		d.Filename = "download"
+		if u, err := url.Parse(d.URL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			d.Filename = path.Base(u.Path)
+		}
+	}
+	return d
+}
+
+// streamDownload hands a paused download response to the next client
+// waiting in NextDownload and relays its body. The browser's own request
+// is aborted either way, so the file never lands on disk.
+func (m *monitor) streamDownload(ctx context.Context, page *cdp.Session, e cdp.RequestPaused) {
+	fetch := cdp.Fetch{Caller: page}
+	defer fetch.FailRequest(e.RequestID, "Aborted")
+
+	pr, pw := io.Pipe()
+	d := newDownload(e)
+	d.r = pr
+
+	timer := time.NewTimer(downloadClaimTimeout)
+	defer timer.Stop()
+	select {
+	case m.s.downloads <- d:
+	case <-timer.C:
+		log.Printf("Session %s: dropped download of %s, nobody claimed it", m.s.ID, d.URL)
+		m.s.addTimeline("download_dropped", d.Filename)
+		return
+	case <-ctx.Done():
+		return
+	}
+	m.s.addTimeline("download_streamed", d.Filename)
+
+	handle, err := fetch.TakeResponseBodyAsStream(ctx, e.RequestID)
+	if err != nil {
+		pw.CloseWithError(err)
+		return
+	}
+	stream := cdp.IO{Caller: page}
+	defer stream.Close(ctx, handle)
+	for {
+		data, eof, err := stream.Read(ctx, handle, downloadChunkSize)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		m.s.countNetworkBytes(int64(len(data)))
+		if _, err := pw.Write(data); err != nil {
+			// The client went away.
+			return
+		}
+		if eof {
+			pw.Close()
+			return
+		}
+	}
+}
+
+// handleResponse resumes a response paused by downloadPatterns, taking it
+// over if it is a download.
+func (m *monitor) handleResponse(ctx context.Context, msg cdp.Message, e cdp.RequestPaused) {
+	page := m.client.Session(msg.SessionID)
+	if !isDownload(e.ResponseStatusCode, e.ResponseHeaders) {
+		cdp.Fetch{Caller: page}.ContinueRequest(e.RequestID, nil)
+		return
+	}
+	go m.streamDownload(ctx, page, e)
+}
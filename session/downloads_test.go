@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+func TestIsDownload(t *testing.T) {
+	for _, tc := range []struct {
+		status  int
+		headers []cdp.HeaderEntry
+		want    bool
+	}{
+		{200, []cdp.HeaderEntry{{Name: "Content-Type", Value: "text/html; charset=utf-8"}}, false},
+		{200, []cdp.HeaderEntry{{Name: "Content-Type", Value: "text/csv"}, {Name: "Content-Disposition", Value: `attachment; filename="export.csv"`}}, true},
+		{200, []cdp.HeaderEntry{{Name: "content-type", Value: "application/zip"}}, true},
+		{200, []cdp.HeaderEntry{{Name: "Content-Type", Value: "application/pdf"}}, false},
+		{200, []cdp.HeaderEntry{{Name: "Content-Type", Value: "image/svg+xml"}}, false},
+		{302, []cdp.HeaderEntry{{Name: "Content-Disposition", Value: "attachment"}}, false},
+		{200, nil, false},
+	} {
+		if got := isDownload(tc.status, tc.headers); got != tc.want {
+			t.Errorf("isDownload(%d, %v) = %v, want %v", tc.status, tc.headers, got, tc.want)
+		}
+	}
+}
+
+func TestNewDownload(t *testing.T) {
+	var e cdp.RequestPaused
+	e.Request.URL = "https://example.com/reports/q3.zip?token=1"
+	e.ResponseHeaders = []cdp.HeaderEntry{
+		{Name: "Content-Type", Value: "application/zip"},
+		{Name: "Content-Length", Value: "1234"},
+	}
+	d := newDownload(e)
+	if d.Filename != "q3.zip" || d.MimeType != "application/zip" || d.Size != 1234 {
+		t.Errorf("got %+v", d)
+	}
+
+	e.ResponseHeaders = []cdp.HeaderEntry{{Name: "Content-Disposition", Value: `attachment; filename="../../etc/passwd"`}}
+	if d := newDownload(e); d.Filename != "passwd" || d.Size != -1 || d.MimeType != "application/octet-stream" {
+		t.Errorf("got %+v", d)
+	}
+}
+
+func TestNextDownload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := (&Session{ctx: ctx}).NextDownload(ctx); !errors.Is(err, ErrDownloadsNotStreamed) {
+		t.Errorf("err = %v, want ErrDownloadsNotStreamed", err)
+	}
+
+	s := &Session{ctx: ctx, downloads: make(chan *Download)}
+	waitCtx, cancelWait := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelWait()
+	if _, err := s.NextDownload(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+
+	go func() { s.downloads <- &Download{Filename: "a.bin"} }()
+	d, err := s.NextDownload(ctx)
+	if err != nil || d.Filename != "a.bin" {
+		t.Errorf("NextDownload = %+v, %v", d, err)
+	}
+}
@@ -0,0 +1,152 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"browser-server/internal/cdp"
+)
+
+// Emulation overrides how the session's pages are rendered, e.g. to test
+// print stylesheets or dark mode. Empty fields keep the browser's
+// default.
+type Emulation struct {
+	// Media is the CSS media type: "screen" or "print".
+	Media string `json:"media,omitempty"`
+	// ColorScheme is prefers-color-scheme: "light" or "dark".
+	ColorScheme string `json:"color_scheme,omitempty"`
+	// ReducedMotion is prefers-reduced-motion: "reduce" or
+	// "no-preference".
+	ReducedMotion string `json:"reduced_motion,omitempty"`
+	// ForcedColors is forced-colors: "active" renders the pages as in a
+	// high-contrast mode, "none" turns it off.
+	ForcedColors string `json:"forced_colors,omitempty"`
+	// VisionDeficiency simulates how people with a vision deficiency see
+	// the pages, e.g. "deuteranopia".
+	VisionDeficiency string `json:"vision_deficiency,omitempty"`
+}
+
+// visionDeficiencies are the deficiencies Chrome can simulate.
+var visionDeficiencies = []string{"blurredVision", "reducedContrast", "achromatopsia", "deuteranopia", "protanopia", "tritanopia"}
+
+// emulationPresets name common combinations for accessibility testing.
+var emulationPresets = map[string]Emulation{
+	"dark":           {ColorScheme: "dark"},
+	"light":          {ColorScheme: "light"},
+	"print":          {Media: "print"},
+	"reduced-motion": {ReducedMotion: "reduce"},
+	"forced-colors":  {ForcedColors: "active"},
+	"high-contrast":  {ForcedColors: "active", ColorScheme: "dark"},
+	"blurred-vision": {VisionDeficiency: "blurredVision"},
+	"low-contrast":   {VisionDeficiency: "reducedContrast"},
+	"achromatopsia":  {VisionDeficiency: "achromatopsia"},
+	"deuteranopia":   {VisionDeficiency: "deuteranopia"},
+	"protanopia":     {VisionDeficiency: "protanopia"},
+	"tritanopia":     {VisionDeficiency: "tritanopia"},
+}
+
+// EmulationPresets returns the names of the emulation presets, sorted.
+func EmulationPresets() []string {
+	return slices.Sorted(maps.Keys(emulationPresets))
+}
+
+// WithPresets returns the settings of the named presets, applied in
+// order, overridden by the fields set in e.
+func (e Emulation) WithPresets(names ...string) (Emulation, error) {
+	var out Emulation
+	for _, name := range names {
+		p, ok := emulationPresets[name]
+		if !ok {
+			return Emulation{}, fmt.Errorf("unknown emulation preset %q, use one of %v", name, EmulationPresets())
+		}
+		out = out.merge(p)
+	}
+	return out.merge(e), nil
+}
+
+// merge returns e with the fields set in o replacing its own.
+func (e Emulation) merge(o Emulation) Emulation {
+	for _, f := range []struct{ dst, src *string }{
+		{&e.Media, &o.Media},
+		{&e.ColorScheme, &o.ColorScheme},
+		{&e.ReducedMotion, &o.ReducedMotion},
+		{&e.ForcedColors, &o.ForcedColors},
+		{&e.VisionDeficiency, &o.VisionDeficiency},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	return e
+}
+
+// Validate checks every field against the values CSS allows.
+func (e Emulation) Validate() error {
+	for _, f := range []struct {
+		name, value string
+		allowed     []string
+	}{
+		{"media", e.Media, []string{"screen", "print"}},
+		{"color_scheme", e.ColorScheme, []string{"light", "dark"}},
+		{"reduced_motion", e.ReducedMotion, []string{"reduce", "no-preference"}},
+		{"forced_colors", e.ForcedColors, []string{"active", "none"}},
+		{"vision_deficiency", e.VisionDeficiency, visionDeficiencies},
+	} {
+		if f.value != "" && !slices.Contains(f.allowed, f.value) {
+			return fmt.Errorf("invalid %s %q, use one of %v", f.name, f.value, f.allowed)
+		}
+	}
+	return nil
+}
+
+// features returns the media feature overrides, clearing those not set.
+func (e Emulation) features() []cdp.MediaFeature {
+	return []cdp.MediaFeature{
+		{Name: "prefers-color-scheme", Value: e.ColorScheme},
+		{Name: "prefers-reduced-motion", Value: e.ReducedMotion},
+		{Name: "forced-colors", Value: e.ForcedColors},
+	}
+}
+
+// apply sets the emulation in a page or iframe.
+func (e Emulation) apply(ctx context.Context, page *cdp.Session) error {
+	if err := (cdp.Emulation{Caller: page}).SetEmulatedMedia(ctx, e.Media, e.features()); err != nil {
+		return err
+	}
+	deficiency := e.VisionDeficiency
+	if deficiency == "" {
+		deficiency = "none"
+	}
+	return cdp.Emulation{Caller: page}.SetEmulatedVisionDeficiency(ctx, deficiency)
+}
+
+// SetEmulation replaces the session's emulation settings in every page,
+// including pages opened later.
+func (s *Session) SetEmulation(ctx context.Context, e Emulation) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.emulation = e
+	s.mu.Unlock()
+
+	m := s.mon.Load()
+	if m == nil {
+		return nil
+	}
+	for _, page := range append(m.pages(), m.iframes()...) {
+		if err := e.apply(ctx, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Emulation returns the session's emulation settings.
+func (s *Session) Emulation() Emulation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.emulation
+}
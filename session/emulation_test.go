@@ -0,0 +1,57 @@
+package session
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEmulation(t *testing.T) {
+	for _, e := range []Emulation{
+		{Media: "tv"},
+		{ColorScheme: "sepia"},
+		{ReducedMotion: "yes"},
+		{ForcedColors: "on"},
+		{VisionDeficiency: "colorblind"},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("%+v accepted", e)
+		}
+	}
+
+	s := &Session{ID: "emulation-test"}
+	want := Emulation{Media: "print", ColorScheme: "dark", ReducedMotion: "reduce"}
+	if err := s.SetEmulation(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Emulation(); got != want {
+		t.Errorf("Emulation() = %+v, want %+v", got, want)
+	}
+
+	// Unset features are sent empty so earlier overrides are cleared.
+	f := Emulation{ColorScheme: "light"}.features()
+	if len(f) != 3 || f[0].Value != "light" || f[1].Name != "prefers-reduced-motion" || f[1].Value != "" {
+		t.Errorf("features = %+v", f)
+	}
+}
+
+func TestEmulationPresets(t *testing.T) {
+	got, err := Emulation{ColorScheme: "light"}.WithPresets("high-contrast", "deuteranopia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Emulation{ColorScheme: "light", ForcedColors: "active", VisionDeficiency: "deuteranopia"}
+	if got != want {
+		t.Errorf("WithPresets = %+v, want %+v", got, want)
+	}
+	if _, err := (Emulation{}).WithPresets("sepia"); err == nil {
+		t.Error("unknown preset accepted")
+	}
+	for _, name := range EmulationPresets() {
+		if err := emulationPresets[name].Validate(); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+	if err := (Emulation{VisionDeficiency: "none"}).Validate(); err == nil {
+		t.Error(`vision_deficiency "none" accepted; omit the field instead`)
+	}
+}
@@ -0,0 +1,250 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"browser-server/internal/cdp"
+)
+
+// Fingerprint is what a session's pages report about the browser and the
+// machine it runs on. All parts are drawn from one curated profile so they
+// agree with each other.
+type Fingerprint struct {
+	Profile   string `json:"profile"`
+	UserAgent string `json:"user_agent"`
+	// Platform is navigator.platform.
+	Platform            string   `json:"platform"`
+	Languages           []string `json:"languages"`
+	ScreenWidth         int      `json:"screen_width"`
+	ScreenHeight        int      `json:"screen_height"`
+	HardwareConcurrency int      `json:"hardware_concurrency"`
+	// DeviceMemory is navigator.deviceMemory in GiB.
+	DeviceMemory int `json:"device_memory"`
+	// Fonts are reported as installed by document.fonts.check.
+	Fonts []string `json:"fonts"`
+	// CanvasNoise perturbs canvas reads so canvas hashes differ between
+	// sessions.
+	CanvasNoise bool `json:"canvas_noise"`
+
+	chromeVersion string
+	hints         fingerprintHints
+	noiseSeed     uint32
+}
+
+// fingerprintHints are the User-Agent client hints of a profile.
+type fingerprintHints struct {
+	platform        string
+	platformVersion string
+	architecture    string
+}
+
+// fingerprintProfile is a family of real-world machines.
+type fingerprintProfile struct {
+	platform  string
+	uaOS      string
+	hints     fingerprintHints
+	screens   [][2]int
+	cores     []int
+	memory    []int
+	languages [][]string
+	fonts     []string
+}
+
+// chromeVersions are recent stable releases the user agent can claim.
+var chromeVersions = []string{"128.0.6613.137", "129.0.6668.100", "130.0.6723.117", "131.0.6778.86"}
+
+var commonLanguages = [][]string{
+	{"en-US", "en"},
+	{"en-GB", "en"},
+	{"de-DE", "de", "en"},
+	{"fr-FR", "fr", "en"},
+	{"es-ES", "es"},
+	{"nl-NL", "nl", "en"},
+}
+
+var fingerprintProfiles = map[string]fingerprintProfile{
+	"windows": {
+		platform:  "Win32",
+		uaOS:      "Windows NT 10.0; Win64; x64",
+		hints:     fingerprintHints{"Windows", "15.0.0", "x86"},
+		screens:   [][2]int{{1920, 1080}, {1366, 768}, {1536, 864}, {2560, 1440}},
+		cores:     []int{4, 8, 12, 16},
+		memory:    []int{4, 8},
+		languages: commonLanguages,
+		fonts:     []string{"Arial", "Calibri", "Cambria", "Consolas", "Courier New", "Segoe UI", "Tahoma", "Times New Roman", "Verdana"},
+	},
+	"macos": {
+		platform:  "MacIntel",
+		uaOS:      "Macintosh; Intel Mac OS X 10_15_7",
+		hints:     fingerprintHints{"macOS", "14.5.0", "arm"},
+		screens:   [][2]int{{1440, 900}, {1512, 982}, {1728, 1117}, {2560, 1440}},
+		cores:     []int{8, 10, 12},
+		memory:    []int{8},
+		languages: commonLanguages,
+		fonts:     []string{"Arial", "Avenir", "Courier New", "Geneva", "Helvetica", "Helvetica Neue", "Menlo", "Monaco", "Times"},
+	},
+	"linux": {
+		platform:  "Linux x86_64",
+		uaOS:      "X11; Linux x86_64",
+		hints:     fingerprintHints{"Linux", "6.5.0", "x86"},
+		screens:   [][2]int{{1920, 1080}, {1600, 900}, {2560, 1440}},
+		cores:     []int{4, 8, 16},
+		memory:    []int{8},
+		languages: commonLanguages,
+		fonts:     []string{"DejaVu Sans", "DejaVu Serif", "Liberation Mono", "Liberation Sans", "Noto Sans", "Ubuntu"},
+	},
+}
+
+// FingerprintProfiles lists the profiles NewFingerprint accepts.
+func FingerprintProfiles() []string {
+	names := make([]string, 0, len(fingerprintProfiles))
+	for name := range fingerprintProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewFingerprint draws a random fingerprint from the named profile, or
+// from any profile if name is "" or "random".
+func NewFingerprint(name string, canvasNoise bool) (*Fingerprint, error) {
+	if name == "" || name == "random" {
+		names := FingerprintProfiles()
+		name = names[rand.IntN(len(names))]
+	}
+	p, ok := fingerprintProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fingerprint profile %q (want one of %s)", name, strings.Join(FingerprintProfiles(), ", "))
+	}
+
+	version := pick(chromeVersions)
+	major, _, _ := strings.Cut(version, ".")
+	screen := pick(p.screens)
+	return &Fingerprint{
+		Profile:             name,
+		UserAgent:           fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%s.0.0.0 Safari/537.36", p.uaOS, major),
+		Platform:            p.platform,
+		Languages:           pick(p.languages),
+		ScreenWidth:         screen[0],
+		ScreenHeight:        screen[1],
+		HardwareConcurrency: pick(p.cores),
+		DeviceMemory:        pick(p.memory),
+		Fonts:               p.fonts,
+		CanvasNoise:         canvasNoise,
+		chromeVersion:       version,
+		hints:               p.hints,
+		noiseSeed:           rand.Uint32(),
+	}, nil
+}
+
+func pick[T any](options []T) T {
+	return options[rand.IntN(len(options))]
+}
+
+// flags returns the launch flags that make the browser itself, including
+// workers and request headers, match the fingerprint.
+func (f *Fingerprint) flags() []string {
+	return []string{
+		"--user-agent=" + f.UserAgent,
+		"--lang=" + f.Languages[0],
+		"--accept-lang=" + strings.Join(f.Languages, ","),
+		fmt.Sprintf("--window-size=%d,%d", f.ScreenWidth, f.ScreenHeight),
+	}
+}
+
+// userAgentOverride also covers navigator.platform and client hints,
+// which have no launch flags.
+func (f *Fingerprint) userAgentOverride() cdp.UserAgentOverride {
+	major, _, _ := strings.Cut(f.chromeVersion, ".")
+	return cdp.UserAgentOverride{
+		UserAgent:      f.UserAgent,
+		AcceptLanguage: strings.Join(f.Languages, ","),
+		Platform:       f.Platform,
+		UserAgentMetadata: &cdp.UserAgentMetadata{
+			Brands: []cdp.UserAgentBrand{
+				{Brand: "Google Chrome", Version: major},
+				{Brand: "Chromium", Version: major},
+				{Brand: "Not_A Brand", Version: "24"},
+			},
+			FullVersionList: []cdp.UserAgentBrand{
+				{Brand: "Google Chrome", Version: f.chromeVersion},
+				{Brand: "Chromium", Version: f.chromeVersion},
+				{Brand: "Not_A Brand", Version: "24.0.0.0"},
+			},
+			Platform:        f.hints.platform,
+			PlatformVersion: f.hints.platformVersion,
+			Architecture:    f.hints.architecture,
+		},
+	}
+}
+
+// fingerprintScript overrides the navigator, screen and font properties
+// that have no CDP override, and adds canvas noise when enabled. It is
+// prefixed with the fingerprint as the constant fp.
+const fingerprintScript = `
+	const define = (obj, prop, value) => Object.defineProperty(obj, prop, {get: () => value, configurable: true});
+	define(Navigator.prototype, "hardwareConcurrency", fp.cores);
+	define(Navigator.prototype, "deviceMemory", fp.memory);
+	define(Navigator.prototype, "languages", Object.freeze(fp.languages.slice()));
+	define(Screen.prototype, "width", fp.width);
+	define(Screen.prototype, "height", fp.height);
+	define(Screen.prototype, "availWidth", fp.width);
+	define(Screen.prototype, "availHeight", fp.height - 40);
+	if (document.fonts) {
+		const check = document.fonts.check.bind(document.fonts);
+		document.fonts.check = (font, text) => fp.fonts.some((f) => font.includes(f)) || check(font, text);
+	}
+	if (!fp.noise) return;
+	// The noise depends only on the seed and the pixel, so repeated reads
+	// of the same canvas agree.
+	const noisy = (data) => {
+		for (let i = 0; i < data.length; i += 4) data[i] ^= ((Math.imul(i, 2654435761) ^ fp.seed) >>> 16) & 1;
+		return data;
+	};
+	const getImageData = CanvasRenderingContext2D.prototype.getImageData;
+	CanvasRenderingContext2D.prototype.getImageData = function (...args) {
+		const img = getImageData.apply(this, args);
+		noisy(img.data);
+		return img;
+	};
+	const toDataURL = HTMLCanvasElement.prototype.toDataURL;
+	HTMLCanvasElement.prototype.toDataURL = function (...args) {
+		const ctx = this.width && this.height && this.getContext("2d");
+		if (!ctx) return toDataURL.apply(this, args);
+		const copy = document.createElement("canvas");
+		copy.width = this.width;
+		copy.height = this.height;
+		const img = getImageData.call(ctx, 0, 0, this.width, this.height);
+		copy.getContext("2d").putImageData(new ImageData(noisy(img.data), this.width, this.height), 0, 0);
+		return toDataURL.apply(copy, args);
+	};
+`
+
+// script returns fingerprintScript bound to f.
+func (f *Fingerprint) script() string {
+	fp, _ := json.Marshal(map[string]interface{}{
+		"cores":     f.HardwareConcurrency,
+		"memory":    f.DeviceMemory,
+		"languages": f.Languages,
+		"width":     f.ScreenWidth,
+		"height":    f.ScreenHeight,
+		"fonts":     f.Fonts,
+		"noise":     f.CanvasNoise,
+		"seed":      f.noiseSeed,
+	})
+	return "(() => {\n\tconst fp = " + string(fp) + ";" + fingerprintScript + "})()"
+}
+
+// applyFingerprint makes a page report the session's fingerprint.
+func applyFingerprint(ctx context.Context, page *cdp.Session, f *Fingerprint) error {
+	if err := (cdp.Emulation{Caller: page}).SetUserAgentOverride(ctx, f.userAgentOverride()); err != nil {
+		return err
+	}
+	script := f.script()
+	return installScript(ctx, page, script)
+}
@@ -0,0 +1,48 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewFingerprintIsCoherent(t *testing.T) {
+	for _, name := range FingerprintProfiles() {
+		p := fingerprintProfiles[name]
+		for i := 0; i < 20; i++ {
+			f, err := NewFingerprint(name, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(f.UserAgent, p.uaOS) {
+				t.Errorf("%s: user agent %q does not match the OS", name, f.UserAgent)
+			}
+			major, _, _ := strings.Cut(f.chromeVersion, ".")
+			if !strings.Contains(f.UserAgent, "Chrome/"+major+".") {
+				t.Errorf("%s: user agent %q does not claim Chrome %s", name, f.UserAgent, major)
+			}
+			if ua := f.userAgentOverride(); ua.Platform != p.platform || ua.UserAgentMetadata.Platform != p.hints.platform {
+				t.Errorf("%s: platform %q / %q", name, ua.Platform, ua.UserAgentMetadata.Platform)
+			}
+			if f.DeviceMemory > 8 {
+				t.Errorf("%s: deviceMemory %d above what Chrome reports", name, f.DeviceMemory)
+			}
+		}
+	}
+}
+
+func TestNewFingerprintProfiles(t *testing.T) {
+	f, err := NewFingerprint("random", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fingerprintProfiles[f.Profile]; !ok {
+		t.Errorf("random picked unknown profile %q", f.Profile)
+	}
+	if strings.Contains(f.script(), `"noise":true`) {
+		t.Error("canvas noise enabled without being asked for")
+	}
+
+	if _, err := NewFingerprint("amiga", false); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
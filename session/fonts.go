@@ -0,0 +1,172 @@
+package session
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// FontPack is a directory of font files, such as a set of CJK or Arabic
+// fonts, that sessions can add to the host's fonts.
+type FontPack struct {
+	Name string `json:"name"`
+	Dir  string `json:"-"`
+	// Files is the number of font files in the pack.
+	Files int `json:"files"`
+	// Languages are the languages the pack's fonts cover, as reported by
+	// fontconfig.
+	Languages []string `json:"languages,omitempty"`
+}
+
+// LoadFontPacks reads the packs in dir, one per subdirectory, keyed by
+// the subdirectory's name.
+func LoadFontPacks(dir string) (map[string]FontPack, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	packs := make(map[string]FontPack)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p := FontPack{Name: e.Name(), Dir: filepath.Join(dir, e.Name())}
+		filepath.WalkDir(p.Dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && isFontFile(path) {
+				p.Files++
+			}
+			return nil
+		})
+		if p.Files == 0 {
+			continue
+		}
+		p.Languages = fontLanguages("fc-scan", "--format", "%{lang}\n", p.Dir)
+		packs[p.Name] = p
+	}
+	return packs, nil
+}
+
+// isFontFile reports whether fontconfig would load path as a font.
+func isFontFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ttf", ".otf", ".ttc", ".otc", ".woff", ".woff2", ".pfb", ".pcf":
+		return true
+	}
+	return false
+}
+
+func fontPackNames(packs []FontPack) []string {
+	var names []string
+	for _, p := range packs {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// localeRe matches BCP 47 tags such as "ja", "zh-Hant-TW" or "pt-BR".
+var localeRe = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// ValidateLocale checks that locale looks like a BCP 47 language tag.
+func ValidateLocale(locale string) error {
+	if !localeRe.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q, use a language tag such as ja-JP", locale)
+	}
+	return nil
+}
+
+// posixLocale turns a language tag into the LANG value fontconfig and
+// Chrome read, e.g. "ja-JP" into "ja_JP.UTF-8".
+func posixLocale(locale string) string {
+	lang, region, _ := strings.Cut(locale, "-")
+	if i := strings.LastIndex(region, "-"); i >= 0 {
+		region = region[i+1:]
+	}
+	if len(region) == 2 {
+		return strings.ToLower(lang) + "_" + strings.ToUpper(region) + ".UTF-8"
+	}
+	return strings.ToLower(lang) + ".UTF-8"
+}
+
+// fontConfig writes a fontconfig configuration into dir that adds the
+// packs to the system's fonts, and returns its path.
+func fontConfig(dir string, packs []FontPack) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\"?>\n<!DOCTYPE fontconfig SYSTEM \"fonts.dtd\">\n<fontconfig>\n")
+	b.WriteString("  <include ignore_missing=\"yes\">/etc/fonts/fonts.conf</include>\n")
+	for _, p := range packs {
+		fmt.Fprintf(&b, "  <dir>%s</dir>\n", html.EscapeString(p.Dir))
+	}
+	fmt.Fprintf(&b, "  <cachedir>%s</cachedir>\n</fontconfig>\n", html.EscapeString(filepath.Join(dir, "cache")))
+
+	path := filepath.Join(dir, "fonts.conf")
+	return path, os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// browserEnv returns the environment variables giving the browser the
+// font packs and locale of opts, writing its font configuration into
+// dir.
+func browserEnv(dir string, opts Options) ([]string, error) {
+	var env []string
+	if len(opts.Fonts) > 0 {
+		path, err := fontConfig(dir, opts.Fonts)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, "FONTCONFIG_FILE="+path)
+	}
+	if opts.Locale != "" {
+		env = append(env, "LANG="+posixLocale(opts.Locale), "LANGUAGE="+strings.ReplaceAll(opts.Locale, "-", "_"))
+	}
+	return env, nil
+}
+
+// SystemFontLanguages lists the languages the host's fonts cover, or nil
+// if fontconfig's fc-list is not available.
+func SystemFontLanguages() []string {
+	return fontLanguages("fc-list", "--format", "%{lang}\n")
+}
+
+// fontLanguages runs a fontconfig tool that prints the "|"-separated
+// languages of one font per line and returns their union.
+func fontLanguages(name string, args ...string) []string {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return nil
+	}
+	var langs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		for _, l := range strings.Split(line, "|") {
+			if l = strings.TrimSpace(l); l != "" {
+				langs = append(langs, l)
+			}
+		}
+	}
+	slices.Sort(langs)
+	return slices.Compact(langs)
+}
+
+// SystemFontFamilies lists the font families installed on the host, or
+// nil if fontconfig's fc-list is not available.
+func SystemFontFamilies() []string {
+	out, err := exec.Command("fc-list", "--format", "%{family[0]}\n").Output()
+	if err != nil {
+		return nil
+	}
+	var families []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			families = append(families, line)
+		}
+	}
+	slices.Sort(families)
+	return slices.Compact(families)
+}
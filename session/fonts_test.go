@@ -0,0 +1,67 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFontPacks(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "cjk", "noto"), 0755)
+	os.WriteFile(filepath.Join(dir, "cjk", "noto", "NotoSansCJK.ttc"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "cjk", "LICENSE"), nil, 0644)
+	// Directories without fonts are not packs.
+	os.MkdirAll(filepath.Join(dir, "empty"), 0755)
+
+	packs, err := LoadFontPacks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) != 1 || packs["cjk"].Files != 1 || packs["cjk"].Dir != filepath.Join(dir, "cjk") {
+		t.Fatalf("packs = %+v", packs)
+	}
+
+	env, err := browserEnv(filepath.Join(dir, "session"), Options{Fonts: []FontPack{packs["cjk"]}, Locale: "ja-JP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 3 || env[1] != "LANG=ja_JP.UTF-8" || env[2] != "LANGUAGE=ja_JP" {
+		t.Fatalf("env = %q", env)
+	}
+	path, ok := strings.CutPrefix(env[0], "FONTCONFIG_FILE=")
+	if !ok {
+		t.Fatalf("env = %q", env)
+	}
+	conf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/etc/fonts/fonts.conf", "<dir>" + filepath.Join(dir, "cjk") + "</dir>"} {
+		if !strings.Contains(string(conf), want) {
+			t.Errorf("fonts.conf lacks %q:\n%s", want, conf)
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	for _, tag := range []string{"", "japanese", "ja_JP", "ja-JP;rm -rf"} {
+		if ValidateLocale(tag) == nil {
+			t.Errorf("%q accepted", tag)
+		}
+	}
+	for tag, want := range map[string]string{
+		"ja":         "ja.UTF-8",
+		"pt-br":      "pt_BR.UTF-8",
+		"zh-Hant-TW": "zh_TW.UTF-8",
+		"sr-Latn":    "sr.UTF-8",
+	} {
+		if err := ValidateLocale(tag); err != nil {
+			t.Errorf("%q rejected: %v", tag, err)
+		}
+		if got := posixLocale(tag); got != want {
+			t.Errorf("posixLocale(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package session
+
+import (
+	"context"
+	"log"
+
+	"browser-server/internal/cdp"
+)
+
+// attachChild sets up a target the browser attached to a page through
+// Target.setAutoAttach. Out-of-process iframes, which cross-origin
+// iframes such as payment forms usually are, get the same metering,
+// request rules and emulation as their page, so they load and render in
+// the screencast like same-origin frames. Every child is paused until it
+// is resumed here.
+func (m *monitor) attachChild(ctx context.Context, e cdp.AttachedToTarget) {
+	child := m.client.Session(e.SessionID)
+	if e.TargetInfo.Type == "iframe" {
+		m.mu.Lock()
+		m.frames[e.SessionID] = struct{}{}
+		m.targets[e.SessionID] = e.TargetInfo.TargetID
+		m.mu.Unlock()
+
+		m.enableTarget(ctx, child)
+		// Nested iframes can live in yet another process.
+		if err := (cdp.Target{Caller: child}).SetAutoAttach(ctx, true); err != nil {
+			log.Printf("Session %s: failed to attach to nested iframes: %v", m.s.ID, err)
+		}
+	}
+	if e.WaitingForDebugger {
+		cdp.Runtime{Caller: child}.RunIfWaitingForDebugger()
+	}
+}
+
+// isPage reports whether a CDP session ID belongs to a page rather than
+// an iframe or worker.
+func (m *monitor) isPage(sessionID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.sessions[sessionID]
+	return ok
+}
+
+// iframes returns the attached out-of-process iframes.
+func (m *monitor) iframes() []*cdp.Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*cdp.Session, 0, len(m.frames))
+	for id := range m.frames {
+		out = append(out, m.client.Session(id))
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"browser-server/internal/cdp"
+
+	"github.com/gorilla/websocket"
+)
+
+// commandLog is a fake browser that answers every command and records
+// the methods sent to each CDP session.
+type commandLog struct {
+	mu   sync.Mutex
+	sent map[string][]string
+}
+
+func (l *commandLog) serve(t *testing.T) string {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var cmd cdp.Message
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			l.mu.Lock()
+			l.sent[cmd.SessionID] = append(l.sent[cmd.SessionID], cmd.Method)
+			l.mu.Unlock()
+			conn.WriteJSON(map[string]interface{}{"id": cmd.ID, "sessionId": cmd.SessionID, "result": map[string]interface{}{}})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func (l *commandLog) methods(sessionID string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.sent[sessionID]...)
+}
+
+func TestAttachChild(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fake := &commandLog{sent: map[string][]string{}}
+	client, err := cdp.Dial(ctx, fake.serve(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	s := &Session{ID: "frames-test", ctx: ctx}
+	m := &monitor{s: s, client: client, sessions: map[string]int{"page": 1}, frames: map[string]struct{}{}, targets: map[string]string{}}
+
+	var frame cdp.AttachedToTarget
+	frame.SessionID = "frame"
+	frame.TargetInfo = cdp.TargetInfo{TargetID: "F1", Type: "iframe"}
+	frame.WaitingForDebugger = true
+	m.attachChild(ctx, frame)
+
+	var worker cdp.AttachedToTarget
+	worker.SessionID = "worker"
+	worker.TargetInfo = cdp.TargetInfo{TargetID: "W1", Type: "worker"}
+	worker.WaitingForDebugger = true
+	m.attachChild(ctx, worker)
+
+	// The resume is sent without waiting for a reply.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(fake.methods("worker")) == 0 || !strings.HasSuffix(strings.Join(fake.methods("frame"), ","), "Runtime.runIfWaitingForDebugger") {
+		if time.Now().After(deadline) {
+			t.Fatalf("frame got %v, worker got %v", fake.methods("frame"), fake.methods("worker"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got := strings.Join(fake.methods("frame"), ",")
+	for _, want := range []string{"Network.enable", "Page.enable", "Target.setAutoAttach"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("iframe was not sent %s: %s", want, got)
+		}
+	}
+	if got := fake.methods("worker"); len(got) != 1 || got[0] != "Runtime.runIfWaitingForDebugger" {
+		t.Errorf("worker got %v, want only the resume", got)
+	}
+
+	if m.isPage("frame") || !m.isPage("page") {
+		t.Error("isPage does not tell pages from iframes")
+	}
+	if len(m.iframes()) != 1 || len(m.pages()) != 1 || m.targets["frame"] != "F1" {
+		t.Errorf("iframes = %d, pages = %d, targets = %v", len(m.iframes()), len(m.pages()), m.targets)
+	}
+}
@@ -0,0 +1,212 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// FrameScheduler composites and broadcasts the screencast frames of all
+// sessions on a fixed number of workers. Sessions with a frame waiting take
+// turns, and a session that sends frames faster than they are processed
+// only ever has its newest one waiting, so one busy session cannot starve
+// the previews of the others.
+type FrameScheduler struct {
+	workers  int
+	interval time.Duration // between frames across sessions, 0 for no limit
+
+	mu    sync.Mutex
+	casts map[*screencast]*castState
+	// ready lists the casts with a frame waiting, in the order they get
+	// their turn.
+	ready     []*screencast
+	busy      int
+	processed uint64
+	skipped   uint64
+
+	wake chan struct{}
+	jobs chan *screencast
+	done chan struct{}
+}
+
+// castState is where a screencast is in the scheduler.
+type castState struct {
+	// waiting is whether the cast has a frame no worker has taken yet.
+	waiting bool
+	// running is whether a worker is publishing one of the cast's frames.
+	running bool
+}
+
+// FrameSchedulerStats describes the frame workers and how far behind they
+// are.
+type FrameSchedulerStats struct {
+	Workers int `json:"workers"`
+	// FPSBudget is the most frames processed per second across all
+	// sessions; zero means no limit.
+	FPSBudget float64 `json:"fps_budget"`
+	Busy      int     `json:"busy"`
+	// Waiting counts the sessions with a frame waiting for a worker.
+	Waiting   int    `json:"waiting"`
+	Processed uint64 `json:"processed"`
+	// Skipped counts the frames replaced by a newer one of the same
+	// session before a worker took them.
+	Skipped uint64 `json:"skipped"`
+}
+
+// NewFrameScheduler starts workers that process at most fpsBudget frames a
+// second between them; zero means no limit.
+func NewFrameScheduler(workers int, fpsBudget float64) *FrameScheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	f := &FrameScheduler{
+		workers: workers,
+		casts:   make(map[*screencast]*castState),
+		wake:    make(chan struct{}, 1),
+		jobs:    make(chan *screencast),
+		done:    make(chan struct{}),
+	}
+	if fpsBudget > 0 {
+		f.interval = time.Duration(float64(time.Second) / fpsBudget)
+	}
+	go f.dispatch()
+	for range workers {
+		go f.work()
+	}
+	return f
+}
+
+// Close stops the workers. Frames still waiting are not published.
+func (f *FrameScheduler) Close() {
+	close(f.done)
+}
+
+// Stats describes the scheduler.
+func (f *FrameScheduler) Stats() FrameSchedulerStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := FrameSchedulerStats{
+		Workers:   f.workers,
+		Busy:      f.busy,
+		Waiting:   len(f.ready),
+		Processed: f.processed,
+		Skipped:   f.skipped,
+	}
+	if f.interval > 0 {
+		st.FPSBudget = float64(time.Second) / float64(f.interval)
+	}
+	return st
+}
+
+// submit asks for the cast's newest frame to be published. It reports
+// false if the cast already had a frame waiting, which the new one
+// replaces.
+func (f *FrameScheduler) submit(c *screencast) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := f.casts[c]
+	if st == nil {
+		st = &castState{}
+		f.casts[c] = st
+	}
+	if st.waiting {
+		return false
+	}
+	st.waiting = true
+	// A cast being published gets its next turn when the worker is done,
+	// so that its frames stay in order.
+	if !st.running {
+		f.readyLocked(c)
+	}
+	return true
+}
+
+// skip counts a frame replaced before a worker took it.
+func (f *FrameScheduler) skip() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.skipped++
+}
+
+func (f *FrameScheduler) readyLocked(c *screencast) {
+	f.ready = append(f.ready, c)
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands the waiting casts to the workers in turn, no faster than
+// the budget allows.
+func (f *FrameScheduler) dispatch() {
+	next := time.Now()
+	for {
+		if wait := time.Until(next); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-f.done:
+				t.Stop()
+				return
+			}
+		}
+		c := f.take()
+		for c == nil {
+			select {
+			case <-f.wake:
+			case <-f.done:
+				return
+			}
+			c = f.take()
+		}
+		select {
+		case f.jobs <- c:
+		case <-f.done:
+			return
+		}
+		if f.interval > 0 {
+			next = time.Now().Add(f.interval)
+		}
+	}
+}
+
+// take removes the cast whose turn it is from the ready list.
+func (f *FrameScheduler) take() *screencast {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.ready) == 0 {
+		return nil
+	}
+	c := f.ready[0]
+	f.ready = f.ready[1:]
+	st := f.casts[c]
+	st.waiting = false
+	st.running = true
+	return c
+}
+
+func (f *FrameScheduler) work() {
+	for {
+		select {
+		case c := <-f.jobs:
+			f.mu.Lock()
+			f.busy++
+			f.mu.Unlock()
+
+			c.publish()
+
+			f.mu.Lock()
+			f.busy--
+			f.processed++
+			st := f.casts[c]
+			st.running = false
+			if st.waiting {
+				f.readyLocked(c)
+			} else {
+				delete(f.casts, c)
+			}
+			f.mu.Unlock()
+		case <-f.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+// castingSession returns a session with one viewer and a frame from
+// Chrome waiting to be published.
+func castingSession(f *FrameScheduler, data string) (*Session, *Viewer) {
+	s := &Session{opts: Options{frames: f}}
+	s.cast.s = s
+	v := s.cast.addViewerLocked(0)
+	s.cast.last = &rawFrame{data: []byte(data)}
+	return s, v
+}
+
+func receive(t *testing.T, v *Viewer) Frame {
+	t.Helper()
+	select {
+	case f := <-v.C:
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame published")
+		return Frame{}
+	}
+}
+
+func TestFrameSchedulerTakesTurns(t *testing.T) {
+	f := NewFrameScheduler(1, 10) // one frame per 100ms
+	defer f.Close()
+	busy, busyViewer := castingSession(f, "busy")
+	quiet, quietViewer := castingSession(f, "quiet")
+
+	// The busy session's second frame replaces its first instead of
+	// going before the quiet session's.
+	if !f.submit(&busy.cast) || f.submit(&busy.cast) {
+		t.Fatal("a second frame of the same session was queued")
+	}
+	f.submit(&quiet.cast)
+	start := time.Now()
+	if got := receive(t, busyViewer); string(got.Data) != "busy" {
+		t.Errorf("busy session published %q", got.Data)
+	}
+	if got := receive(t, quietViewer); string(got.Data) != "quiet" {
+		t.Errorf("quiet session published %q", got.Data)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("two frames published in %s with a 10fps budget", elapsed)
+	}
+	select {
+	case <-busyViewer.C:
+		t.Error("busy session published the replaced frame too")
+	case <-time.After(150 * time.Millisecond):
+	}
+	if st := f.Stats(); st.Processed != 2 || st.Waiting != 0 || st.FPSBudget != 10 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestFrameSchedulerKeepsSessionFramesInOrder(t *testing.T) {
+	f := NewFrameScheduler(4, 0)
+	defer f.Close()
+	s, v := castingSession(f, "0")
+	for i := range 50 {
+		s.cast.publishMu.Lock()
+		s.cast.last = &rawFrame{data: []byte{byte(i)}}
+		f.submit(&s.cast)
+		s.cast.publishMu.Unlock()
+	}
+	var last uint64
+	for {
+		got := receive(t, v)
+		if got.Seq <= last {
+			t.Fatalf("frame %d published after frame %d", got.Seq, last)
+		}
+		last = got.Seq
+		if got.Data[0] == 49 {
+			break
+		}
+	}
+}
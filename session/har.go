@@ -0,0 +1,181 @@
+package session
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// harEntry accumulates what CDP reports about one request.
+type harEntry struct {
+	requestID  string
+	started    time.Time
+	monoStart  float64
+	monoEnd    float64
+	method     string
+	url        string
+	reqHeaders map[string]string
+	status     int
+	statusText string
+	protocol   string
+	mimeType   string
+	resHeaders map[string]string
+	size       int64
+	failed     string
+}
+
+type cdpRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+}
+
+type cdpResponse struct {
+	Status     int               `json:"status"`
+	StatusText string            `json:"statusText"`
+	MimeType   string            `json:"mimeType"`
+	Protocol   string            `json:"protocol"`
+	Headers    map[string]string `json:"headers"`
+}
+
+func (e *harEntry) setResponse(res cdpResponse) {
+	e.status = res.Status
+	e.statusText = res.StatusText
+	e.mimeType = res.MimeType
+	e.protocol = res.Protocol
+	e.resHeaders = res.Headers
+}
+
+func (r *recorder) handleNetwork(method string, params json.RawMessage) {
+	var p struct {
+		RequestID         string       `json:"requestId"`
+		Request           cdpRequest   `json:"request"`
+		Response          cdpResponse  `json:"response"`
+		RedirectResponse  *cdpResponse `json:"redirectResponse"`
+		WallTime          float64      `json:"wallTime"`
+		Timestamp         float64      `json:"timestamp"`
+		EncodedDataLength float64      `json:"encodedDataLength"`
+		ErrorText         string       `json:"errorText"`
+	}
+	if json.Unmarshal(params, &p) != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.requests[p.RequestID]
+
+	switch method {
+	case "Network.requestWillBeSent":
+		// A redirect reuses the request ID; complete the previous hop.
+		if e != nil && p.RedirectResponse != nil {
+			e.setResponse(*p.RedirectResponse)
+			e.monoEnd = p.Timestamp
+		}
+		sec, frac := math.Modf(p.WallTime)
+		e = &harEntry{
+			requestID:  p.RequestID,
+			started:    time.Unix(int64(sec), int64(frac*1e9)),
+			monoStart:  p.Timestamp,
+			method:     p.Request.Method,
+			url:        p.Request.URL,
+			reqHeaders: p.Request.Headers,
+		}
+		r.requests[p.RequestID] = e
+		r.order = append(r.order, e)
+	case "Network.responseReceived":
+		if e != nil {
+			e.setResponse(p.Response)
+		}
+	case "Network.loadingFinished":
+		if e != nil {
+			e.size = int64(p.EncodedDataLength)
+			e.monoEnd = p.Timestamp
+			delete(r.requests, p.RequestID)
+		}
+	case "Network.loadingFailed":
+		if e != nil {
+			e.failed = p.ErrorText
+			e.monoEnd = p.Timestamp
+			delete(r.requests, p.RequestID)
+		}
+	}
+}
+
+// har renders the recorded requests as a HAR 1.2 log, with the response
+// bodies body returns. r.mu must be held.
+func (r *recorder) har(body func(requestID string) []byte) map[string]interface{} {
+	entries := make([]map[string]interface{}, 0, len(r.order))
+	for _, e := range r.order {
+		elapsed := 0.0
+		if e.monoEnd > e.monoStart {
+			elapsed = (e.monoEnd - e.monoStart) * 1000
+		}
+		httpVersion := e.protocol
+		if httpVersion == "" {
+			httpVersion = "HTTP/1.1"
+		}
+		content := map[string]interface{}{"size": e.size, "mimeType": e.mimeType}
+		// A redirect hop shares the request ID of the response with the
+		// body.
+		if data := body(e.requestID); data != nil && !isRedirect(e.status) {
+			content["size"] = len(data)
+			content["text"] = base64.StdEncoding.EncodeToString(data)
+			content["encoding"] = "base64"
+		}
+		response := map[string]interface{}{
+			"status":      e.status,
+			"statusText":  e.statusText,
+			"httpVersion": httpVersion,
+			"headers":     harHeaders(e.resHeaders),
+			"cookies":     []interface{}{},
+			"content":     content,
+			"redirectURL": e.resHeaders["location"],
+			"headersSize": -1,
+			"bodySize":    e.size,
+		}
+		entry := map[string]interface{}{
+			"startedDateTime": e.started.UTC().Format(time.RFC3339Nano),
+			"time":            elapsed,
+			"request": map[string]interface{}{
+				"method":      e.method,
+				"url":         e.url,
+				"httpVersion": httpVersion,
+				"headers":     harHeaders(e.reqHeaders),
+				"queryString": []interface{}{},
+				"cookies":     []interface{}{},
+				"headersSize": -1,
+				"bodySize":    -1,
+			},
+			"response": response,
+			"cache":    map[string]interface{}{},
+			"timings":  map[string]interface{}{"send": 0, "wait": elapsed, "receive": 0},
+		}
+		if e.failed != "" {
+			entry["_error"] = e.failed
+		}
+		entries = append(entries, entry)
+	}
+	return map[string]interface{}{
+		"log": map[string]interface{}{
+			"version": "1.2",
+			"creator": map[string]string{"name": "browser-lab", "version": "1.0"},
+			"entries": entries,
+		},
+	}
+}
+
+// isRedirect reports whether status redirects to another URL.
+func isRedirect(status int) bool {
+	return status >= 300 && status < 400 && status != 304
+}
+
+func harHeaders(h map[string]string) []map[string]string {
+	out := make([]map[string]string, 0, len(h))
+	for name, value := range h {
+		out = append(out, map[string]string{"name": name, "value": fmt.Sprint(value)})
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"browser-server/internal/cdp"
+	"browser-server/internal/wildcard"
+)
+
+// HeaderRule adds request headers to a session's requests for matching
+// origins, e.g. to reach a header-gated staging environment.
+type HeaderRule struct {
+	// Origin is an origin such as "https://staging.example.com" or a host
+	// pattern such as "*.example.com", which matches any scheme. * and ?
+	// are wildcards.
+	Origin  string            `json:"origin"`
+	Headers map[string]string `json:"headers"`
+}
+
+// Validate checks the rule for an origin and well-formed header names.
+func (r HeaderRule) Validate() error {
+	if strings.TrimSpace(r.Origin) == "" {
+		return fmt.Errorf("header rule without origin")
+	}
+	host := r.Origin
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	if strings.Contains(strings.TrimSuffix(host, "/"), "/") {
+		return fmt.Errorf("header rule origin %q must not contain a path", r.Origin)
+	}
+	if len(r.Headers) == 0 {
+		return fmt.Errorf("header rule for %q has no headers", r.Origin)
+	}
+	for name, value := range r.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for header %q", name)
+		}
+	}
+	return nil
+}
+
+// urlPattern is the Fetch pattern for the URLs of the rule's origin.
+func (r HeaderRule) urlPattern() string {
+	o := strings.TrimSuffix(r.Origin, "/")
+	if !strings.Contains(o, "://") {
+		o = "*://" + o
+	}
+	return o + "/*"
+}
+
+// requestHeaders returns headers with the headers of every rule matching
+// url added. Later rules win over earlier ones, and both over the
+// request's own headers.
+func requestHeaders(rules []HeaderRule, url string, headers map[string]string) []cdp.HeaderEntry {
+	merged := make(map[string]string, len(headers))
+	names := make(map[string]string, len(headers)) // lower case -> name
+	set := func(name, value string) {
+		if prev, ok := names[strings.ToLower(name)]; ok {
+			delete(merged, prev)
+		}
+		names[strings.ToLower(name)] = name
+		merged[name] = value
+	}
+	for name, value := range headers {
+		set(name, value)
+	}
+	for _, r := range rules {
+		if !wildcard.Match(r.urlPattern(), url) {
+			continue
+		}
+		for name, value := range r.Headers {
+			set(name, value)
+		}
+	}
+
+	out := make([]cdp.HeaderEntry, 0, len(merged))
+	for name, value := range merged {
+		out = append(out, cdp.HeaderEntry{Name: name, Value: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// headerPatterns pause the page's requests to the rules' origins so their
+// headers can be added.
+func headerPatterns(rules []HeaderRule) []cdp.RequestPattern {
+	patterns := make([]cdp.RequestPattern, len(rules))
+	for i, r := range rules {
+		patterns[i] = cdp.RequestPattern{URLPattern: r.urlPattern(), RequestStage: "Request"}
+	}
+	return patterns
+}
+
+// enableFetch pauses the requests the session needs to modify or take
+// over. Fetch.enable replaces earlier patterns, so they are set at once.
+func enableFetch(ctx context.Context, page *cdp.Session, opts Options) error {
+	patterns := headerPatterns(opts.ExtraHeaders)
+	if opts.StreamDownloads {
+		patterns = append(patterns, downloadPatterns()...)
+	}
+	if len(opts.DenyHosts) > 0 {
+		patterns = append(patterns, denyPattern)
+	}
+	if opts.Mocks != nil {
+		patterns = append(patterns, mockPattern)
+	}
+	if len(opts.AllowedDomains) > 0 {
+		patterns = append(patterns, allowPattern)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	return cdp.Fetch{Caller: page}.Enable(ctx, patterns)
+}
+
+// continueRequest resumes a request paused for the header rules, with
+// their headers added, unless the mocks answer it or the allowed domains
+// forbid its address, or hands a paused response to handleResponse. A paused request must always be continued,
+// or the page hangs.
+func (m *monitor) continueRequest(ctx context.Context, msg cdp.Message) {
+	var e cdp.RequestPaused
+	if msg.Decode(&e) != nil {
+		return
+	}
+	if e.ResponseStatusCode != 0 {
+		m.handleResponse(ctx, msg, e)
+		return
+	}
+	page := cdp.Fetch{Caller: m.client.Session(msg.SessionID)}
+	if e.ResourceType == "Document" {
+		if rule, ok := wildcard.FindHost(m.s.opts.DenyHosts, e.Request.URL); ok {
+			page.FailRequest(e.RequestID, "BlockedByClient")
+			m.s.navigationBlocked(Blocked{URL: e.Request.URL, Rule: rule})
+			return
+		}
+	}
+	if m.answerFromMocks(page, e) {
+		return
+	}
+	if len(m.s.opts.AllowedDomains) > 0 {
+		go m.continueAllowed(ctx, page, e)
+		return
+	}
+	page.ContinueRequest(e.RequestID, requestHeaders(m.s.opts.ExtraHeaders, e.Request.URL, e.Request.Headers))
+}
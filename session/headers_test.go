@@ -0,0 +1,48 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"browser-server/internal/cdp"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	rules := []HeaderRule{
+		{Origin: "https://staging.example.com", Headers: map[string]string{"X-Debug": "token", "Authorization": "Bearer staging"}},
+		{Origin: "*.internal.test", Headers: map[string]string{"X-Internal": "1"}},
+	}
+
+	got := requestHeaders(rules, "https://staging.example.com/app", map[string]string{"authorization": "Basic x", "Accept": "*/*"})
+	want := []cdp.HeaderEntry{
+		{Name: "Accept", Value: "*/*"},
+		{Name: "Authorization", Value: "Bearer staging"},
+		{Name: "X-Debug", Value: "token"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("staging headers = %v, want %v", got, want)
+	}
+
+	got = requestHeaders(rules, "https://www.example.com/", map[string]string{"Accept": "*/*"})
+	if len(got) != 1 {
+		t.Errorf("headers leaked to another origin: %v", got)
+	}
+}
+
+func TestHeaderRuleValidate(t *testing.T) {
+	valid := HeaderRule{Origin: "https://staging.example.com/", Headers: map[string]string{"X-Debug": "1"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("valid rule: %v", err)
+	}
+	for _, r := range []HeaderRule{
+		{Origin: "", Headers: map[string]string{"X-Debug": "1"}},
+		{Origin: "https://example.com/path", Headers: map[string]string{"X-Debug": "1"}},
+		{Origin: "example.com"},
+		{Origin: "example.com", Headers: map[string]string{"Bad Name": "1"}},
+		{Origin: "example.com", Headers: map[string]string{"X-Debug": "a\r\nHost: evil"}},
+	} {
+		if r.Validate() == nil {
+			t.Errorf("rule %+v accepted", r)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// Health statuses.
+const (
+	HealthHealthy    = "healthy"
+	HealthUnhealthy  = "unhealthy"
+	HealthRestarting = "restarting"
+)
+
+// unhealthyAfter is how many probes in a row must fail before a session is
+// marked unhealthy, so one slow page does not flap the status.
+const unhealthyAfter = 2
+
+// Health is the result of the watchdog probes. It only changes when the
+// status does, so polling clients can rely on ETags.
+type Health struct {
+	Status   string    `json:"status"`
+	Reason   string    `json:"reason,omitempty"`
+	Since    time.Time `json:"since"`
+	Restarts int       `json:"restarts,omitempty"`
+}
+
+// Health returns the session's current health.
+func (s *Session) Health() Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+// watchdog probes the browser every HealthCheckInterval until ctx ends.
+func (s *Session) watchdog(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.probe()
+		if err == nil {
+			failures = 0
+			s.setHealth(HealthHealthy, "")
+			continue
+		}
+		failures++
+		if failures < unhealthyAfter {
+			continue
+		}
+		s.setHealth(HealthUnhealthy, err.Error())
+		if !s.opts.AutoRestart {
+			continue
+		}
+
+		s.setHealth(HealthRestarting, err.Error())
+		if err := s.restart(); err != nil {
+			log.Printf("Session %s: restart failed: %v", s.ID, err)
+			s.setHealth(HealthUnhealthy, "restart failed: "+err.Error())
+			continue
+		}
+		failures = 0
+	}
+}
+
+// probe checks that DevTools answers and every page can run script.
+func (s *Session) probe() error {
+	m := s.mon.Load()
+	if m == nil {
+		return fmt.Errorf("DevTools connection unavailable")
+	}
+	timeout := s.opts.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	if _, err := (cdp.Browser{Caller: m.client}).GetVersion(ctx); err != nil {
+		return fmt.Errorf("DevTools unresponsive: %w", err)
+	}
+	for _, page := range m.pages() {
+		if _, err := (cdp.Runtime{Caller: page}).Evaluate(ctx, "1"); err != nil {
+			return fmt.Errorf("page unresponsive: %w", err)
+		}
+	}
+	return nil
+}
+
+// setHealth records a change of status and notifies the manager. It
+// reports whether the status changed.
+func (s *Session) setHealth(status, reason string) bool {
+	s.mu.Lock()
+	if s.state.closed() || s.health.Status == status {
+		s.mu.Unlock()
+		return false
+	}
+	s.health.Status = status
+	s.health.Reason = reason
+	s.health.Since = time.Now()
+	h := s.health
+	onHealth := s.onHealth
+	s.mu.Unlock()
+
+	log.Printf("Session %s is %s %s", s.ID, status, reason)
+	s.addTimeline(status, reason)
+	if onHealth != nil {
+		onHealth(s, h)
+	}
+	return true
+}
+
+// restart kills the browser and launches a new one on the same profile, so
+// cookies and storage survive. CDP clients must reconnect.
+func (s *Session) restart() error {
+	s.mu.Lock()
+	if s.state.closed() {
+		s.mu.Unlock()
+		return nil
+	}
+	oldCancel, oldDone := s.browserCancel, s.browserDone
+	s.mu.Unlock()
+
+	oldCancel()
+	<-oldDone
+
+	browserCtx, browserCancel := context.WithCancel(s.ctx)
+	b, wsURL, _, err := launchBrowser(browserCtx, s.launcher, s.spec, s.profileDir, nil)
+	if err != nil {
+		browserCancel()
+		return err
+	}
+
+	s.mu.Lock()
+	if s.state.closed() {
+		// Stopped while relaunching; the session context already killed
+		// the new browser.
+		s.mu.Unlock()
+		browserCancel()
+		go b.Wait()
+		return nil
+	}
+	s.browser, s.wsURL, s.browserCancel = b, wsURL, browserCancel
+	s.browserDone = s.watchBrowser(browserCtx, b)
+	s.health.Restarts++
+	s.mu.Unlock()
+	s.recordJournal(false)
+
+	if m, err := startMonitor(browserCtx, s, wsURL); err != nil {
+		log.Printf("Session %s: page monitoring unavailable: %v", s.ID, err)
+		s.mon.Store(nil)
+	} else {
+		s.mon.Store(m)
+	}
+	s.cast.restart()
+	s.setState(StateReady)
+	s.setHealth(HealthHealthy, "")
+	return nil
+}
+
+// setOnHealth registers the callback run when the session's health status
+// changes.
+func (s *Session) setOnHealth(fn func(*Session, Health)) {
+	s.mu.Lock()
+	s.onHealth = fn
+	s.mu.Unlock()
+}
@@ -0,0 +1,155 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+const (
+	// DefaultHighlightDuration is how long a highlight shows unless asked
+	// otherwise, and MaxHighlightDuration the longest it may.
+	DefaultHighlightDuration = 3 * time.Second
+	MaxHighlightDuration     = time.Minute
+)
+
+var (
+	// ErrNoMatch is returned when no element matches a selector.
+	ErrNoMatch = errors.New("no element matches the selector")
+	// ErrInvalidSelector is returned for selectors the page cannot parse.
+	ErrInvalidSelector = errors.New("invalid selector")
+)
+
+// highlightConfig colors a highlighted element like DevTools does when
+// inspecting it, with its tooltip of tag, size and classes.
+var highlightConfig = cdp.HighlightConfig{
+	ShowInfo:     true,
+	ContentColor: &cdp.RGBA{R: 111, G: 168, B: 220, A: 0.66},
+	PaddingColor: &cdp.RGBA{R: 147, G: 196, B: 125, A: 0.55},
+	BorderColor:  &cdp.RGBA{R: 255, G: 229, B: 153, A: 0.66},
+	MarginColor:  &cdp.RGBA{R: 246, G: 178, B: 107, A: 0.66},
+}
+
+// Highlighted is the element a highlight landed on.
+type Highlighted struct {
+	// Matches is how many elements match the selector; the first is
+	// highlighted.
+	Matches int `json:"matches"`
+	// X, Y, Width and Height are the element's border box in CSS pixels
+	// of the viewport. It may be outside of it: the page is not scrolled.
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// highlighter hides a session's highlight once it has shown long enough.
+type highlighter struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	gen   int
+}
+
+// Highlight draws DevTools' inspect highlight over the first element
+// matching selector in the session's first page for d, or
+// DefaultHighlightDuration if zero, replacing any earlier highlight. It
+// shows in everything fed by the screencast, so operators can find
+// elements while debugging selectors. The page is not changed or
+// scrolled.
+func (s *Session) Highlight(ctx context.Context, selector string, d time.Duration) (Highlighted, error) {
+	if d <= 0 {
+		d = DefaultHighlightDuration
+	}
+	if d > MaxHighlightDuration {
+		return Highlighted{}, fmt.Errorf("highlights show for at most %s", MaxHighlightDuration)
+	}
+	page, err := s.firstPage()
+	if err != nil {
+		return Highlighted{}, err
+	}
+	dom, overlay := cdp.DOM{Caller: page}, cdp.Overlay{Caller: page}
+	if err := dom.Enable(ctx); err != nil {
+		return Highlighted{}, err
+	}
+	root, err := dom.GetDocument(ctx)
+	if err != nil {
+		return Highlighted{}, err
+	}
+	nodes, err := dom.QuerySelectorAll(ctx, root, selector)
+	if err != nil {
+		var cdpErr *cdp.Error
+		if errors.As(err, &cdpErr) {
+			return Highlighted{}, fmt.Errorf("%w: %s", ErrInvalidSelector, cdpErr.Message)
+		}
+		return Highlighted{}, err
+	}
+	if len(nodes) == 0 {
+		return Highlighted{}, ErrNoMatch
+	}
+	if err := overlay.Enable(ctx); err != nil {
+		return Highlighted{}, err
+	}
+	if err := overlay.HighlightNode(ctx, nodes[0], highlightConfig); err != nil {
+		return Highlighted{}, err
+	}
+
+	h := Highlighted{Matches: len(nodes)}
+	// Elements that are not rendered have no box.
+	if quad, err := dom.GetBorderQuad(ctx, nodes[0]); err == nil && len(quad) == 8 {
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for i := 0; i < 8; i += 2 {
+			minX, maxX = math.Min(minX, quad[i]), math.Max(maxX, quad[i])
+			minY, maxY = math.Min(minY, quad[i+1]), math.Max(maxY, quad[i+1])
+		}
+		h.X, h.Y, h.Width, h.Height = minX, minY, maxX-minX, maxY-minY
+	}
+
+	s.highlight.mu.Lock()
+	if s.highlight.timer != nil {
+		s.highlight.timer.Stop()
+	}
+	s.highlight.gen++
+	gen := s.highlight.gen
+	s.highlight.timer = time.AfterFunc(d, func() {
+		// A later highlight has its own timer.
+		s.highlight.mu.Lock()
+		current := s.highlight.gen == gen
+		s.highlight.mu.Unlock()
+		if current {
+			s.HideHighlight()
+		}
+	})
+	s.highlight.mu.Unlock()
+	return h, nil
+}
+
+// HideHighlight takes the session's highlight away before it expires. The
+// DOM and Overlay domains are disabled again, so that pages that are not
+// being debugged send no DOM events.
+func (s *Session) HideHighlight() error {
+	s.highlight.mu.Lock()
+	if s.highlight.timer != nil {
+		s.highlight.timer.Stop()
+		s.highlight.timer = nil
+	}
+	s.highlight.mu.Unlock()
+
+	page, err := s.firstPage()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	defer cancel()
+	overlay := cdp.Overlay{Caller: page}
+	if err := overlay.HideHighlight(ctx); err != nil {
+		return err
+	}
+	overlay.Disable(ctx)
+	return cdp.DOM{Caller: page}.Disable(ctx)
+}
@@ -0,0 +1,107 @@
+package session
+
+import (
+	"context"
+	"fmt"
+
+	"browser-server/internal/cdp"
+)
+
+// maxInputText caps the text of a single text input event.
+const maxInputText = 10000
+
+// InputEvent is mouse or keyboard input for the session's page, named
+// after the CDP Input events. Coordinates are CSS pixels in the viewport.
+type InputEvent struct {
+	// Type is mouseMoved, mousePressed, mouseReleased or mouseWheel;
+	// keyDown, keyUp or char; or text, which types Text at once.
+	Type string  `json:"type"`
+	X    float64 `json:"x,omitempty"`
+	Y    float64 `json:"y,omitempty"`
+	// Button is left, middle, right or none.
+	Button     string  `json:"button,omitempty"`
+	ClickCount int     `json:"click_count,omitempty"`
+	DeltaX     float64 `json:"delta_x,omitempty"`
+	DeltaY     float64 `json:"delta_y,omitempty"`
+	// Modifiers is a bit field: Alt 1, Ctrl 2, Meta 4, Shift 8.
+	Modifiers int    `json:"modifiers,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Text      string `json:"text,omitempty"`
+}
+
+// inputKeyCodes are the Windows virtual key codes of the keys that edit
+// or move rather than type; Chrome needs them to act on those keys.
+var inputKeyCodes = map[string]int{
+	"Backspace": 8, "Tab": 9, "Enter": 13, "Escape": 27, "PageUp": 33, "PageDown": 34,
+	"End": 35, "Home": 36, "ArrowLeft": 37, "ArrowUp": 38, "ArrowRight": 39, "ArrowDown": 40,
+	"Delete": 46,
+}
+
+// Validate checks the event's type and button.
+func (e InputEvent) Validate() error {
+	switch e.Type {
+	case "mouseMoved", "mousePressed", "mouseReleased", "mouseWheel":
+		switch e.Button {
+		case "", "none", "left", "middle", "right":
+		default:
+			return fmt.Errorf("invalid button %q", e.Button)
+		}
+	case "keyDown", "keyUp", "char":
+		if e.Key == "" && e.Text == "" {
+			return fmt.Errorf("%s event without key or text", e.Type)
+		}
+	case "text":
+		if len(e.Text) > maxInputText {
+			return fmt.Errorf("text longer than %d bytes", maxInputText)
+		}
+	default:
+		return fmt.Errorf("invalid input event type %q", e.Type)
+	}
+	return nil
+}
+
+// DispatchInput sends an input event to the session's first page.
+func (s *Session) DispatchInput(ctx context.Context, e InputEvent) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	page, err := s.firstPage()
+	if err != nil {
+		return err
+	}
+	s.MarkRunning()
+	input := cdp.Input{Caller: page}
+	switch e.Type {
+	case "keyDown", "keyUp", "char":
+		typ := e.Type
+		if typ == "keyDown" && e.Text == "" {
+			// Keys without text, like arrows, only go down.
+			typ = "rawKeyDown"
+		}
+		return input.DispatchKeyEvent(ctx, cdp.KeyEvent{
+			Type:                  typ,
+			Modifiers:             e.Modifiers,
+			Key:                   e.Key,
+			Code:                  e.Code,
+			Text:                  e.Text,
+			WindowsVirtualKeyCode: inputKeyCodes[e.Key],
+		})
+	case "text":
+		return input.InsertText(ctx, e.Text)
+	}
+	button := e.Button
+	if button == "" {
+		button = "none"
+	}
+	return input.DispatchMouseEvent(ctx, cdp.MouseEvent{
+		Type:       e.Type,
+		X:          e.X,
+		Y:          e.Y,
+		Modifiers:  e.Modifiers,
+		Button:     button,
+		ClickCount: e.ClickCount,
+		DeltaX:     e.DeltaX,
+		DeltaY:     e.DeltaY,
+	})
+}
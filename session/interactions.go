@@ -0,0 +1,133 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"browser-server/internal/cdp"
+	"browser-server/recording"
+)
+
+// interactionBinding is the page function the interaction script reports
+// through.
+const interactionBinding = "__browserLabRecord"
+
+// interactionScript reports clicks, changed form fields and special key
+// presses with a CSS selector for their target. Fields that are or were
+// password fields, or that take a password or one-time code, are
+// recorded as secret and without their value; a field stays secret when a
+// "show password" toggle turns it into a text field.
+const interactionScript = `(() => {
+	if (window.__browserLabRecording || typeof ` + interactionBinding + ` !== "function") return;
+	window.__browserLabRecording = true;
+	const report = (step) => ` + interactionBinding + `(JSON.stringify(step));
+	const selector = (el) => {
+		if (!(el instanceof Element)) return "";
+		if (el.id) return "#" + CSS.escape(el.id);
+		for (const attr of ["data-testid", "name", "aria-label"]) {
+			const v = el.getAttribute(attr);
+			if (v) return el.localName + "[" + attr + "=" + JSON.stringify(v) + "]";
+		}
+		const parts = [];
+		for (; el && el.nodeType === 1 && el !== document.documentElement; el = el.parentElement) {
+			if (el.id) { parts.unshift("#" + CSS.escape(el.id)); break; }
+			let i = 1;
+			for (let s = el.previousElementSibling; s; s = s.previousElementSibling) {
+				if (s.localName === el.localName) i++;
+			}
+			parts.unshift(el.localName + ":nth-of-type(" + i + ")");
+		}
+		return parts.join(" > ");
+	};
+	const secrets = new WeakSet();
+	const secret = (el) => {
+		if (!(el instanceof Element)) return false;
+		const autocomplete = el.getAttribute("autocomplete") || "";
+		if (el.type === "password" || /\b(current-password|new-password|one-time-code)\b/.test(autocomplete)) secrets.add(el);
+		return secrets.has(el);
+	};
+	document.addEventListener("focusin", (e) => secret(e.target), true);
+	document.addEventListener("click", (e) => report({action: "click", selector: selector(e.target)}), true);
+	document.addEventListener("change", (e) => {
+		const t = e.target;
+		if (!("value" in t) || t.type === "checkbox" || t.type === "radio") return;
+		if (secret(t)) report({action: "fill", selector: selector(t), secret: true});
+		else report({action: "fill", selector: selector(t), value: String(t.value)});
+	}, true);
+	document.addEventListener("keydown", (e) => {
+		if (["Enter", "Tab", "Escape"].includes(e.key)) report({action: "press", selector: selector(e.target), key: e.key});
+	}, true);
+})()`
+
+// navigationGrace is how long after an input a main-frame navigation is
+// treated as caused by it and not recorded as a step of its own.
+const navigationGrace = 2 * time.Second
+
+// enableInteractionRecording installs the interaction script in a page.
+func enableInteractionRecording(ctx context.Context, page *cdp.Session) error {
+	if err := (cdp.Runtime{Caller: page}).Enable(ctx); err != nil {
+		return err
+	}
+	if err := (cdp.Runtime{Caller: page}).AddBinding(ctx, interactionBinding); err != nil {
+		return err
+	}
+	return installScript(ctx, page, interactionScript)
+}
+
+// handleBinding records a step reported by the interaction script.
+func (s *Session) handleBinding(msg cdp.Message) {
+	var e cdp.BindingCalled
+	if msg.Decode(&e) != nil || e.Name != interactionBinding {
+		return
+	}
+	var step recording.Step
+	if json.Unmarshal([]byte(e.Payload), &step) != nil {
+		return
+	}
+	if step.Secret {
+		step.Value = ""
+	}
+	switch step.Action {
+	case recording.ActionClick, recording.ActionFill, recording.ActionPress:
+		s.recordStep(step)
+	}
+}
+
+// recordNavigation records a main-frame navigation unless it followed an
+// input that caused it. The blank page a browser starts on is skipped.
+func (s *Session) recordNavigation(url string) {
+	s.stepsMu.Lock()
+	last, first := s.lastInput, len(s.steps) == 0
+	s.stepsMu.Unlock()
+	if first && url == "about:blank" {
+		return
+	}
+	if !last.IsZero() && time.Since(last) < navigationGrace {
+		return
+	}
+	s.recordStep(recording.Step{Action: recording.ActionNavigate, URL: url})
+}
+
+func (s *Session) recordStep(step recording.Step) {
+	s.stepsMu.Lock()
+	defer s.stepsMu.Unlock()
+	now := time.Now()
+	step.AtMS = now.Sub(s.CreatedAt).Milliseconds()
+	if step.Action != recording.ActionNavigate {
+		s.lastInput = now
+	}
+	s.steps = append(s.steps, step)
+}
+
+// RecordsInteractions reports whether the session records interactions.
+func (s *Session) RecordsInteractions() bool {
+	return s.opts.RecordInteractions
+}
+
+// Interactions returns the recorded interaction steps.
+func (s *Session) Interactions() []recording.Step {
+	s.stepsMu.Lock()
+	defer s.stepsMu.Unlock()
+	return append([]recording.Step(nil), s.steps...)
+}
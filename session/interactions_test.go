@@ -0,0 +1,39 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"browser-server/internal/cdp"
+	"browser-server/recording"
+)
+
+func TestRecordInteractions(t *testing.T) {
+	s := &Session{CreatedAt: time.Now()}
+
+	s.recordNavigation("about:blank")
+	s.recordNavigation("https://example.com/")
+	s.handleBinding(cdp.Message{Params: []byte(`{"name":"__browserLabRecord","payload":"{\"action\":\"click\",\"selector\":\"#next\"}"}`)})
+	// Caused by the click, so not a step of its own.
+	s.recordNavigation("https://example.com/next")
+	s.handleBinding(cdp.Message{Params: []byte(`{"name":"other","payload":"{\"action\":\"click\"}"}`)})
+	s.handleBinding(cdp.Message{Params: []byte(`{"name":"__browserLabRecord","payload":"{\"action\":\"navigate\",\"url\":\"x\"}"}`)})
+	// A secret fill never keeps a value, even if one was reported.
+	s.handleBinding(cdp.Message{Params: []byte(`{"name":"__browserLabRecord","payload":"{\"action\":\"fill\",\"selector\":\"#pw\",\"secret\":true,\"value\":\"hunter2\"}"}`)})
+
+	steps := s.Interactions()
+	want := []recording.Step{
+		{Action: recording.ActionNavigate, URL: "https://example.com/"},
+		{Action: recording.ActionClick, Selector: "#next"},
+		{Action: recording.ActionFill, Selector: "#pw", Secret: true},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("recorded %+v, want %+v", steps, want)
+	}
+	for i := range want {
+		steps[i].AtMS = 0
+		if steps[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i, steps[i], want[i])
+		}
+	}
+}
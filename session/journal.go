@@ -0,0 +1,134 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JournalEntry is a running browser as recorded in the journal.
+type JournalEntry struct {
+	ID         string    `json:"id"`
+	Port       int       `json:"port"`
+	PID        int       `json:"pid,omitempty"`
+	ProfileDir string    `json:"profile_dir"`
+	StartedAt  time.Time `json:"started_at"`
+	// ExpiresAt is unset for warm browsers not yet claimed.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Journal records the browsers the server runs in a JSON file, so that a
+// server restarted after a crash can kill the browsers its predecessor
+// left behind and remove their profiles.
+type Journal struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]JournalEntry
+}
+
+// OpenJournal opens the journal at path and returns the entries an
+// earlier run of the server left in it. They stay in the journal until
+// they are reaped, so that a server crashing again before reaping them
+// does not lose track of their browsers.
+func OpenJournal(path string) (*Journal, []JournalEntry, error) {
+	var old []JournalEntry
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &old); err != nil {
+			log.Printf("Journal: ignoring unreadable %s: %v", path, err)
+			old = nil
+		}
+	}
+	j := &Journal{path: path, entries: make(map[string]JournalEntry)}
+	for _, e := range old {
+		j.entries[e.ID] = e
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.writeLocked(); err != nil {
+		return nil, nil, err
+	}
+	return j, old, nil
+}
+
+// Reap kills the browser of an entry left by an earlier run, if it is
+// still running, removes its profile and then the entry. It reports
+// whether a browser was killed.
+func (j *Journal) Reap(e JournalEntry) bool {
+	killed := reap(e)
+	j.forget(e.ID)
+	return killed
+}
+
+func reap(e JournalEntry) bool {
+	killed := e.PID > 0 && killStaleBrowser(e.PID, e.ProfileDir)
+	if e.ProfileDir != "" {
+		os.RemoveAll(e.ProfileDir)
+	}
+	return killed
+}
+
+// record adds or updates the entry of a session's browser, keeping the
+// expiry recorded before if e has none.
+func (j *Journal) record(e JournalEntry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if old, ok := j.entries[e.ID]; ok && e.ExpiresAt == nil {
+		e.ExpiresAt = old.ExpiresAt
+	}
+	j.entries[e.ID] = e
+	if err := j.writeLocked(); err != nil {
+		log.Printf("Journal: failed to record session %s: %v", e.ID, err)
+	}
+}
+
+// forget removes the entry of a session whose browser has exited.
+func (j *Journal) forget(id string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.entries[id]; !ok {
+		return
+	}
+	delete(j.entries, id)
+	if err := j.writeLocked(); err != nil {
+		log.Printf("Journal: failed to forget session %s: %v", id, err)
+	}
+}
+
+// writeLocked replaces the file, through a temporary file so that a crash
+// cannot leave it half written.
+func (j *Journal) writeLocked() error {
+	list := make([]JournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].StartedAt.Before(list[b].StartedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
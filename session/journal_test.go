@@ -0,0 +1,79 @@
+package session
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j, stale, err := OpenJournal(path)
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("OpenJournal = %v, %v", stale, err)
+	}
+	profile := filepath.Join(t.TempDir(), "a")
+	os.MkdirAll(profile, 0700)
+	expires := time.Now().Add(time.Hour).Round(0)
+	j.record(JournalEntry{ID: "a", Port: 9222, PID: 100, ProfileDir: profile, ExpiresAt: &expires})
+	j.record(JournalEntry{ID: "b", Port: 9223, ProfileDir: filepath.Join(t.TempDir(), "b")})
+	// A relaunched browser keeps its expiry.
+	j.record(JournalEntry{ID: "a", Port: 9222, PID: 101, ProfileDir: profile})
+	j.forget("b")
+
+	j, stale, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0].ID != "a" || stale[0].PID != 101 || stale[0].ExpiresAt == nil || !stale[0].ExpiresAt.Equal(expires) {
+		t.Fatalf("stale entries = %+v", stale)
+	}
+	// Entries stay until they are reaped, also if the server crashes
+	// first.
+	if _, again, _ := OpenJournal(path); len(again) != 1 {
+		t.Errorf("unreaped entries lost: %+v", again)
+	}
+	j.Reap(stale[0])
+	if _, err := os.Stat(profile); !os.IsNotExist(err) {
+		t.Error("profile not removed")
+	}
+	if _, stale, _ = OpenJournal(path); len(stale) != 0 {
+		t.Errorf("reaped entries kept: %+v", stale)
+	}
+}
+
+func TestReap(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc")
+	}
+	profile := filepath.Join(t.TempDir(), "profile")
+	os.MkdirAll(profile, 0700)
+	// The trailing command keeps sh from exec'ing sleep, so the flag stays
+	// on its command line.
+	cmd := exec.CommandContext(t.Context(), "sh", "-c", "sleep 60; true", "--user-data-dir="+profile)
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	done := make(chan struct{})
+	go func() { cmd.Wait(); close(done) }()
+
+	if reap(JournalEntry{ID: "other", PID: cmd.Process.Pid, ProfileDir: filepath.Join(t.TempDir(), "elsewhere")}) {
+		t.Error("killed a process using another profile")
+	}
+	if !reap(JournalEntry{ID: "a", PID: cmd.Process.Pid, ProfileDir: profile}) {
+		t.Error("browser not killed")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("browser still running")
+	}
+	if _, err := os.Stat(profile); !os.IsNotExist(err) {
+		t.Error("profile not removed")
+	}
+}
@@ -0,0 +1,189 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"browser-server/egress"
+)
+
+// launchFallbacks are the extra Chrome flags tried on each launch attempt.
+// Later attempts avoid the GPU and /dev/shm, the usual causes of crashes on
+// busy or constrained hosts.
+var launchFallbacks = [][]string{
+	nil,
+	{"--disable-gpu", "--disable-dev-shm-usage"},
+	{"--disable-gpu", "--disable-dev-shm-usage", "--disable-software-rasterizer", "--no-zygote"},
+}
+
+// launchBackoff is the delay before the first retry; it doubles after each.
+var launchBackoff = 500 * time.Millisecond
+
+// LaunchAttempt records one try at starting the browser.
+type LaunchAttempt struct {
+	Attempt    int      `json:"attempt"`
+	ExtraFlags []string `json:"extra_flags,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// LaunchError is returned when every launch attempt failed.
+type LaunchError struct {
+	Attempts []LaunchAttempt
+}
+
+func (e *LaunchError) Error() string {
+	last := e.Attempts[len(e.Attempts)-1]
+	return fmt.Sprintf("browser failed to start after %d attempts: %s", len(e.Attempts), last.Error)
+}
+
+// Launcher starts the browsers of sessions. Sessions run a local Chrome
+// unless Options.Launcher is set, e.g. to a DockerLauncher.
+type Launcher interface {
+	// Start makes one attempt at starting a browser and returns it with its
+	// DevTools URL, reachable from this host, once the browser reports it.
+	// The browser is killed when ctx ends.
+	Start(ctx context.Context, spec LaunchSpec) (Browser, string, error)
+}
+
+// LaunchSpec describes a browser to start.
+type LaunchSpec struct {
+	SessionID string
+	// Args are the browser's flags; Env is added to its environment.
+	Args []string
+	Env  []string
+	// Dirs are host directories the browser uses at the same paths, such
+	// as its profile.
+	Dirs []string
+	// CPUs, if set, is the list of CPUs the browser may run on, e.g.
+	// "0-3,8".
+	CPUs string
+	// Timeout is how long to wait for the browser to report its DevTools
+	// URL.
+	Timeout time.Duration
+	// Stderr, if not nil, receives a copy of the browser's stderr.
+	Stderr io.Writer
+}
+
+// Browser is a browser started by a Launcher.
+type Browser interface {
+	// Wait blocks until the browser has exited.
+	Wait() error
+	// PID returns the host process ID of the browser, whose process tree
+	// is counted as its memory, or 0 if it cannot be measured that way.
+	PID() int
+}
+
+// launchChecker is implemented by launchers that cannot run every kind of
+// session.
+type launchChecker interface {
+	Check(opts Options) error
+}
+
+// launchBrowser starts a browser, retrying with backoff and the fallback
+// flags when it fails to start or does not report its DevTools URL in
+// time. The profile directory is cleared between attempts so a stale
+// profile lock cannot fail the retry too, and before each attempt seeded
+// by seed, if set.
+func launchBrowser(ctx context.Context, launcher Launcher, spec LaunchSpec, profileDir string, seed func(dir string) error) (Browser, string, []LaunchAttempt, error) {
+	var attempts []LaunchAttempt
+	backoff := launchBackoff
+	args := spec.Args
+	for i, extra := range launchFallbacks {
+		if i > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, "", attempts, ctx.Err()
+			}
+			backoff *= 2
+			os.RemoveAll(profileDir)
+		}
+		if seed != nil {
+			if err := seed(profileDir); err != nil {
+				return nil, "", attempts, fmt.Errorf("failed to copy the snapshot's profile: %w", err)
+			}
+		}
+
+		start := time.Now()
+		spec.Args = append(append([]string{}, args...), extra...)
+		// Give slow hosts a little longer to print the DevTools URL each time.
+		spec.Timeout = time.Duration(i+1) * 5 * time.Second
+		b, wsURL, err := launcher.Start(ctx, spec)
+		attempt := LaunchAttempt{
+			Attempt:    i + 1,
+			ExtraFlags: extra,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err == nil {
+			attempts = append(attempts, attempt)
+			return b, wsURL, attempts, nil
+		}
+		attempt.Error = err.Error()
+		attempts = append(attempts, attempt)
+	}
+	return nil, "", attempts, &LaunchError{Attempts: attempts}
+}
+
+// localLauncher runs Chrome on this host, inside the session's network
+// namespace if it has one.
+type localLauncher struct {
+	path  string
+	netns *egress.Namespace
+}
+
+// localBrowser is a browser process on this host.
+type localBrowser struct{ cmd *exec.Cmd }
+
+func (b localBrowser) Wait() error { return b.cmd.Wait() }
+func (b localBrowser) PID() int    { return b.cmd.Process.Pid }
+
+// Start runs a single launch attempt.
+func (l *localLauncher) Start(ctx context.Context, spec LaunchSpec) (Browser, string, error) {
+	path, args := l.path, spec.Args
+	if spec.CPUs != "" {
+		// taskset pins the browser before it starts any of its processes,
+		// which inherit the affinity.
+		path, args = "taskset", append([]string{"--cpu-list", spec.CPUs, path}, args...)
+	}
+	if l.netns != nil {
+		path, args = l.netns.Command(path, args)
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	setProcessGroup(cmd)
+	if len(spec.Env) > 0 {
+		cmd.Env = append(os.Environ(), spec.Env...)
+	}
+
+	// Capture stderr to find the DevTools URL
+	pipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	var stderr io.Reader = pipe
+	if spec.Stderr != nil {
+		stderr = io.TeeReader(pipe, spec.Stderr)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, "", err
+	}
+
+	// Parse DevTools URL from stderr
+	wsURL, err := parseDevToolsURL(stderr, spec.Timeout)
+	if err != nil {
+		killProcessGroup(cmd)
+		cmd.Wait()
+		return nil, "", fmt.Errorf("failed to parse devtools url: %w", err)
+	}
+	raiseOOMScore(cmd.Process.Pid)
+	wsURL = loopbackURL(wsURL, remoteDebuggingAddress(spec.Args))
+	if l.netns != nil {
+		wsURL = l.netns.Expose(wsURL)
+	}
+	return localBrowser{cmd}, wsURL, nil
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBrowser writes a script that only starts when given --disable-gpu.
+func fakeBrowser(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "chrome")
+	script := `#!/bin/sh
+for arg in "$@"; do
+	if [ "$arg" = "--disable-gpu" ]; then
+		echo "DevTools listening on ws://127.0.0.1:9222/devtools/browser/x" >&2
+		exec sleep 5
+	fi
+done
+exit 1
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLaunchBrowserRetriesWithFallbackFlags(t *testing.T) {
+	defer func(d time.Duration) { launchBackoff = d }(launchBackoff)
+	launchBackoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancelling ctx kills the browser.
+	_, wsURL, attempts, err := launchBrowser(ctx, &localLauncher{path: fakeBrowser(t)}, LaunchSpec{}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wsURL != "ws://127.0.0.1:9222/devtools/browser/x" {
+		t.Errorf("wsURL = %q", wsURL)
+	}
+	if len(attempts) != 2 || attempts[0].Error == "" || attempts[1].Error != "" {
+		t.Errorf("unexpected attempts %+v", attempts)
+	}
+}
+
+func TestLaunchBrowserGivesUp(t *testing.T) {
+	defer func(d time.Duration) { launchBackoff = d }(launchBackoff)
+	launchBackoff = time.Millisecond
+
+	_, _, _, err := launchBrowser(context.Background(), &localLauncher{path: "/nonexistent/chrome"}, LaunchSpec{}, t.TempDir(), nil)
+	var launchErr *LaunchError
+	if !errors.As(err, &launchErr) || len(launchErr.Attempts) != len(launchFallbacks) {
+		t.Fatalf("err = %v, want LaunchError with %d attempts", err, len(launchFallbacks))
+	}
+}
+
+func TestLaunchBrowserKeepsStderrLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chrome")
+	script := `#!/bin/sh
+echo "DevTools listening on ws://127.0.0.1:9222/devtools/browser/x" >&2
+echo "[ERROR:gpu_init.cc] GPU initialization failed" >&2
+exec sleep 5
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := newBrowserLogs(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, _, err = launchBrowser(ctx, &localLauncher{path: path}, LaunchSpec{Stderr: logs}, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Output after the DevTools URL is still copied.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(logs.dir, "chrome.log"))
+		if strings.Contains(string(data), "GPU initialization failed") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("chrome.log = %q", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// HasLease reports whether the session must be kept alive by heartbeats.
+func (s *Session) HasLease() bool {
+	return s.opts.LeaseTimeout > 0
+}
+
+// Heartbeat renews the session's lease and returns when it now expires.
+// It returns the zero time for sessions without a lease.
+func (s *Session) Heartbeat() time.Time {
+	if !s.HasLease() {
+		return time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastHeartbeat = time.Now()
+	return s.lastHeartbeat.Add(s.opts.LeaseTimeout)
+}
+
+// LeaseExpiresAt is when the session is reclaimed unless a heartbeat
+// arrives first, or the zero time for sessions without a lease.
+func (s *Session) LeaseExpiresAt() time.Time {
+	if !s.HasLease() {
+		return time.Time{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastHeartbeat.Add(s.opts.LeaseTimeout)
+}
+
+// watchLease stops the session once a lease timeout passes without a
+// heartbeat, so sessions of clients that died without stopping them do
+// not linger until they expire.
+func (s *Session) watchLease(ctx context.Context) {
+	t := time.NewTimer(s.opts.LeaseTimeout)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if left := time.Until(s.LeaseExpiresAt()); left > 0 {
+				t.Reset(left)
+				continue
+			}
+			log.Printf("Session %s: no heartbeat for %s, reclaiming", s.ID, s.opts.LeaseTimeout)
+			s.addTimeline("lease_expired", "")
+			s.stop(StateStopped)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
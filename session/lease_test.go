@@ -0,0 +1,43 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Session{
+		ID:            "lease-test",
+		state:         StateReady,
+		ctx:           ctx,
+		cancel:        cancel,
+		opts:          Options{LeaseTimeout: 100 * time.Millisecond},
+		lastHeartbeat: time.Now(),
+	}
+	go s.watchLease(ctx)
+
+	for i := 0; i < 5; i++ {
+		time.Sleep(40 * time.Millisecond)
+		if exp := s.Heartbeat(); time.Until(exp) < 90*time.Millisecond {
+			t.Fatalf("lease renewed only until %v", exp)
+		}
+	}
+	if st := s.State(); st != StateReady {
+		t.Fatalf("heartbeating session is %s", st)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.State() != StateStopped {
+		if time.Now().After(deadline) {
+			t.Fatalf("session without heartbeats is still %s", s.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if (&Session{}).HasLease() || !(&Session{}).Heartbeat().IsZero() {
+		t.Error("session without a lease reports one")
+	}
+}
@@ -0,0 +1,234 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits cap the sessions the manager runs at once and how often it
+// creates them. Zero means no limit.
+type Limits struct {
+	MaxSessions       int `json:"max_sessions"`
+	SessionsPerMinute int `json:"sessions_per_minute"`
+}
+
+// Quota caps the sessions of one API key, on top of the manager's Limits.
+// Sessions with the same Key share it; zero means no limit.
+type Quota struct {
+	Key               string
+	MaxSessions       int
+	SessionsPerMinute int
+}
+
+// LimitError is returned by CreateSession when a session would exceed
+// the manager's limits or its key's quota.
+type LimitError struct {
+	// Limit is the limit that was hit: "max_sessions",
+	// "sessions_per_minute", "key_max_sessions" or
+	// "key_sessions_per_minute".
+	Limit string
+	// RetryAfter is when a new session may be allowed, at the earliest.
+	RetryAfter time.Duration
+	msg        string
+}
+
+func (e *LimitError) Error() string {
+	return e.msg
+}
+
+// LimitStats describes the manager's limits and how close sessions are
+// to them.
+type LimitStats struct {
+	Limits
+	Running int `json:"running"`
+	// Keys counts the running sessions of each key with a quota.
+	Keys map[string]int `json:"keys,omitempty"`
+}
+
+// rateBucket is a token bucket holding up to a minute's worth of
+// sessions.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// wait refills the bucket at perMinute and returns how long until it has
+// a session to give, zero if it has one now.
+func (b *rateBucket) wait(perMinute int, now time.Time) time.Duration {
+	capacity := float64(perMinute)
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else {
+		b.tokens = min(capacity, b.tokens+now.Sub(b.last).Minutes()*capacity)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / capacity * float64(time.Minute))
+}
+
+// reservation holds a place for a session being created, so that
+// sessions launched concurrently cannot together exceed a limit.
+type reservation struct {
+	key  string
+	done bool
+}
+
+// SetLimits changes the manager's limits. Sessions already running are
+// not stopped.
+func (m *Manager) SetLimits(l Limits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits = l
+}
+
+// LimitStats describes the manager's limits and the sessions counted
+// against them.
+func (m *Manager) LimitStats() LimitStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	st := LimitStats{Limits: m.limits, Running: len(m.sessions)}
+	for _, s := range m.sessions {
+		if key := s.quotaKey(); key != "" {
+			if st.Keys == nil {
+				st.Keys = make(map[string]int)
+			}
+			st.Keys[key]++
+		}
+	}
+	return st
+}
+
+// reserve checks a new session against the limits and q, reserving its
+// place and its share of the creation rate.
+func (m *Manager) reserve(q Quota, now time.Time) (*reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if max := m.limits.MaxSessions; max > 0 && len(m.sessions)+m.reserved >= max {
+		return nil, &LimitError{
+			Limit:      "max_sessions",
+			RetryAfter: m.nextExpiryLocked("", now),
+			msg:        fmt.Sprintf("server is running its maximum of %d sessions", max),
+		}
+	}
+	if q.Key != "" && q.MaxSessions > 0 {
+		running := m.reservedKeys[q.Key]
+		for _, s := range m.sessions {
+			if s.quotaKey() == q.Key {
+				running++
+			}
+		}
+		if running >= q.MaxSessions {
+			return nil, &LimitError{
+				Limit:      "key_max_sessions",
+				RetryAfter: m.nextExpiryLocked(q.Key, now),
+				msg:        fmt.Sprintf("API key %s is running its maximum of %d sessions", q.Key, q.MaxSessions),
+			}
+		}
+	}
+
+	// Tokens are only taken once both buckets have one, so that a refusal
+	// costs nothing.
+	var global, key *rateBucket
+	if perMinute := m.limits.SessionsPerMinute; perMinute > 0 {
+		global = &m.rate
+		if wait := global.wait(perMinute, now); wait > 0 {
+			return nil, &LimitError{
+				Limit:      "sessions_per_minute",
+				RetryAfter: wait,
+				msg:        fmt.Sprintf("server creates at most %d sessions a minute", perMinute),
+			}
+		}
+	}
+	if q.Key != "" && q.SessionsPerMinute > 0 {
+		if m.keyRates == nil {
+			m.keyRates = make(map[string]*rateBucket)
+		}
+		key = m.keyRates[q.Key]
+		if key == nil {
+			key = &rateBucket{}
+			m.keyRates[q.Key] = key
+		}
+		if wait := key.wait(q.SessionsPerMinute, now); wait > 0 {
+			return nil, &LimitError{
+				Limit:      "key_sessions_per_minute",
+				RetryAfter: wait,
+				msg:        fmt.Sprintf("API key %s may create at most %d sessions a minute", q.Key, q.SessionsPerMinute),
+			}
+		}
+	}
+	if global != nil {
+		global.tokens--
+	}
+	if key != nil {
+		key.tokens--
+	}
+
+	m.reserved++
+	if q.Key != "" {
+		if m.reservedKeys == nil {
+			m.reservedKeys = make(map[string]int)
+		}
+		m.reservedKeys[q.Key]++
+	}
+	return &reservation{key: q.Key}, nil
+}
+
+// releaseLocked gives up a reservation, whether or not its session was
+// created. Releasing it again does nothing.
+func (m *Manager) releaseLocked(r *reservation) {
+	if r.done {
+		return
+	}
+	r.done = true
+	m.reserved--
+	if r.key != "" {
+		if m.reservedKeys[r.key]--; m.reservedKeys[r.key] == 0 {
+			delete(m.reservedKeys, r.key)
+		}
+	}
+}
+
+func (m *Manager) release(r *reservation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.releaseLocked(r)
+}
+
+// admit registers a session created under a reservation, trading the
+// reservation for the session in one step.
+func (m *Manager) admit(s *Session, r *reservation) {
+	m.mu.Lock()
+	m.sessions[s.ID] = s
+	m.releaseLocked(r)
+	m.mu.Unlock()
+	m.register(s)
+}
+
+// nextExpiryLocked estimates when a session of key ("" for any) ends,
+// freeing a place: when the first of them expires, but at least a second
+// from now.
+func (m *Manager) nextExpiryLocked(key string, now time.Time) time.Duration {
+	var next time.Time
+	for _, s := range m.sessions {
+		if key != "" && s.quotaKey() != key {
+			continue
+		}
+		s.mu.Lock()
+		expires := s.ExpiresAt
+		s.mu.Unlock()
+		if next.IsZero() || expires.Before(next) {
+			next = expires
+		}
+	}
+	return max(time.Second, next.Sub(now))
+}
+
+// quotaKey is the key whose quota the session counts against.
+func (s *Session) quotaKey() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts.Quota.Key
+}
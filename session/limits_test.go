@@ -0,0 +1,98 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// limitOf returns the limit err hit, or "" if it is not a LimitError.
+func limitOf(err error) string {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.Limit
+	}
+	return ""
+}
+
+func TestReserveMaxSessions(t *testing.T) {
+	m := NewManager()
+	m.SetLimits(Limits{MaxSessions: 2})
+	now := time.Now()
+
+	r1, err := m.reserve(Quota{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := fakeWarmSession(1, Options{})
+	s.ExpiresAt = now.Add(time.Minute)
+	m.admit(s, r1)
+	m.release(r1) // after admit, releasing again changes nothing
+
+	// A session still launching holds its place.
+	r2, err := m.reserve(Quota{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.reserve(Quota{}, now)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "max_sessions" {
+		t.Fatalf("third session: %v", err)
+	}
+	if limitErr.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %s, want the first expiry (1m)", limitErr.RetryAfter)
+	}
+	m.release(r2)
+	if _, err := m.reserve(Quota{}, now); err != nil {
+		t.Errorf("after a failed launch: %v", err)
+	}
+}
+
+func TestReserveKeyQuota(t *testing.T) {
+	m := NewManager()
+	a := Quota{Key: "a", MaxSessions: 1}
+	r, err := m.reserve(a, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.admit(fakeWarmSession(1, Options{Quota: a}), r)
+
+	if _, err := m.reserve(a, time.Now()); limitOf(err) != "key_max_sessions" {
+		t.Errorf("second session of key a: %v", err)
+	}
+	if _, err := m.reserve(Quota{Key: "b", MaxSessions: 1}, time.Now()); err != nil {
+		t.Errorf("first session of key b: %v", err)
+	}
+	if st := m.LimitStats(); st.Running != 1 || st.Keys["a"] != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestReserveRate(t *testing.T) {
+	m := NewManager()
+	m.SetLimits(Limits{SessionsPerMinute: 2})
+	q := Quota{Key: "a", SessionsPerMinute: 1}
+	now := time.Now()
+
+	if _, err := m.reserve(q, now); err != nil {
+		t.Fatal(err)
+	}
+	// Refused by the key's rate, which must not cost the server's.
+	if _, err := m.reserve(q, now); limitOf(err) != "key_sessions_per_minute" {
+		t.Errorf("second session of key a: %v", err)
+	}
+	if _, err := m.reserve(Quota{}, now); err != nil {
+		t.Errorf("second session: %v", err)
+	}
+	_, err := m.reserve(Quota{}, now)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "sessions_per_minute" {
+		t.Fatalf("third session: %v", err)
+	}
+	if limitErr.RetryAfter <= 0 || limitErr.RetryAfter > 30*time.Second {
+		t.Errorf("RetryAfter = %s, want at most 30s at 2 a minute", limitErr.RetryAfter)
+	}
+	if _, err := m.reserve(Quota{}, now.Add(limitErr.RetryAfter)); err != nil {
+		t.Errorf("after RetryAfter: %v", err)
+	}
+}
@@ -1,13 +1,38 @@
 package session
 
 import (
+	"errors"
 	"sync"
 	"time"
 )
 
+// ErrDraining is returned by CreateSession while the manager is draining.
+var ErrDraining = errors.New("server is draining and not accepting new sessions")
+
 type Manager struct {
 	sessions map[string]*Session
 	mu       sync.RWMutex
+	draining bool
+	// lowMemory refuses new sessions while the host is short of memory.
+	lowMemory bool
+
+	observers []Observer
+	// pool keeps browsers warm for CreateSession, if enabled.
+	pool *pool
+	// journal records the browsers of sessions and the pool, if enabled.
+	journal *Journal
+	// proxies are rotated across sessions with Options.RotateProxy.
+	proxies *ProxyPool
+	// frames processes the screencast frames of all sessions.
+	frames *FrameScheduler
+
+	// limits cap the sessions of all keys, and the rate buckets and
+	// reservations of sessions being created count against them.
+	limits       Limits
+	rate         rateBucket
+	keyRates     map[string]*rateBucket
+	reserved     int
+	reservedKeys map[string]int
 }
 
 func NewManager() *Manager {
@@ -16,29 +41,153 @@ func NewManager() *Manager {
 	}
 }
 
-func (m *Manager) CreateSession(duration time.Duration) (*Session, error) {
-	s, err := NewSession(duration)
+func (m *Manager) CreateSession(opts Options) (*Session, error) {
+	if m.IsDraining() {
+		return nil, ErrDraining
+	}
+	r, err := m.reserve(opts.Quota, time.Now())
 	if err != nil {
 		return nil, err
 	}
+	defer m.release(r)
+	// Short of memory, a session is only created in place of one of a
+	// lower class.
+	if m.IsLowOnMemory() && !m.preemptFor(opts.Priority.orDefault()) {
+		return nil, ErrMemoryPressure
+	}
+	if p := m.warmPool(); p != nil {
+		if s := p.claim(opts); s != nil {
+			m.admit(s, r)
+			return s, nil
+		}
+	}
+	opts, err = m.launchOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSession(opts)
+	if err != nil {
+		return nil, err
+	}
+	m.admit(s, r)
+	return s, nil
+}
+
+// SetJournal records the browsers of the sessions and the warm pool
+// launched from now on in j.
+func (m *Manager) SetJournal(j *Journal) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.journal = j
+}
+
+// SetProxyPool sets the proxies sessions with Options.RotateProxy take
+// turns on.
+func (m *Manager) SetProxyPool(p *ProxyPool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.proxies = p
+}
+
+// ProxyPool returns the manager's proxy pool, or nil.
+func (m *Manager) ProxyPool() *ProxyPool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.proxies
+}
 
+// SetFrameScheduler makes f process the screencast frames of the sessions
+// and the warm pool launched from now on.
+func (m *Manager) SetFrameScheduler(f *FrameScheduler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frames = f
+}
+
+// FrameScheduler returns the manager's frame scheduler, or nil.
+func (m *Manager) FrameScheduler() *FrameScheduler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.frames
+}
+
+// launchOptions completes the options of a browser about to be launched
+// with what the manager provides.
+func (m *Manager) launchOptions(opts Options) (Options, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if opts.RotateProxy {
+		if m.proxies == nil {
+			return opts, ErrNoProxyPool
+		}
+		proxy := m.proxies.Next()
+		opts.Proxy = &proxy
+	}
+	opts.journal = m.journal
+	opts.frames = m.frames
+	return opts, nil
+}
+
+// register adds a new session and notifies observers of it.
+func (m *Manager) register(s *Session) {
 	m.mu.Lock()
 	m.sessions[s.ID] = s
 	m.mu.Unlock()
 
-	// Remove from map when stopped (this is a bit tricky with the current Stop implementation, 
-    // ideally Stop should callback to manager, but for now we can just let it be or add a callback)
-    // Let's add a cleanup routine or just check existence. 
-    // Better: wrap Stop to remove from manager.
-    
-    // For simplicity in this MVP, we'll just leave it in the map until we explicitly list/clean or 
-    // maybe we can have a background cleaner.
-    // Actually, let's just add a Remove method and call it from the HTTP handler or auto-cleanup.
-    
-    // Refined approach: The session handles its own process death, but the manager needs to know to remove it from the map.
-    // We can pass a callback to NewSession? Or just have a ticker in Manager that cleans up expired sessions.
-    
-	return s, nil
+	// Sessions stop themselves on expiry or when over their bandwidth cap,
+	// so the manager learns about every stop through this callback.
+	s.setOnWarning(m.sessionWarning)
+	s.setOnHealth(m.sessionHealth)
+	s.setOnDialog(m.sessionDialog)
+	s.setOnBlocked(m.sessionBlocked)
+	s.setOnState(m.sessionState)
+	m.notify(func(o Observer) { o.SessionCreated(s) })
+	if st := s.State(); st == StateReady || st == StateRunning {
+		m.notify(func(o Observer) { o.SessionReady(s) })
+	}
+	s.setOnStop(m.sessionStopped)
+}
+
+// EnablePool starts keeping browsers warm, so that CreateSession can hand
+// out one that is already running to sessions that match cfg.Options.
+func (m *Manager) EnablePool(cfg PoolConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	p := newPool(m, cfg)
+	m.mu.Lock()
+	if m.pool != nil {
+		m.mu.Unlock()
+		return errors.New("the warm pool is already enabled")
+	}
+	m.pool = p
+	m.mu.Unlock()
+
+	go p.run()
+	p.refill()
+	return nil
+}
+
+func (m *Manager) warmPool() *pool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pool
+}
+
+// PoolStats reports on the warm pool, if it is enabled.
+func (m *Manager) PoolStats() (PoolStats, bool) {
+	p := m.warmPool()
+	if p == nil {
+		return PoolStats{}, false
+	}
+	return p.statsNow(), true
+}
+
+// ClosePool stops the warm pool's idle browsers and launches no more.
+func (m *Manager) ClosePool() {
+	if p := m.warmPool(); p != nil {
+		p.close()
+	}
 }
 
 func (m *Manager) GetSession(id string) (*Session, bool) {
@@ -49,14 +198,64 @@ func (m *Manager) GetSession(id string) (*Session, bool) {
 }
 
 func (m *Manager) DeleteSession(id string) {
+	if s, ok := m.GetSession(id); ok {
+		s.Stop()
+	}
+}
+
+// Observe registers o to be notified of the lifecycle of every session.
+// Observers are called in registration order.
+func (m *Manager) Observe(o Observer) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if s, ok := m.sessions[id]; ok {
-		s.Stop()
-		delete(m.sessions, id)
+	m.observers = append(m.observers, o)
+}
+
+// notify calls fn for every observer.
+func (m *Manager) notify(fn func(Observer)) {
+	m.mu.RLock()
+	observers := m.observers
+	m.mu.RUnlock()
+
+	for _, o := range observers {
+		fn(o)
 	}
 }
 
+func (m *Manager) sessionWarning(s *Session, w Warning) {
+	m.notify(func(o Observer) { o.SessionWarning(s, w) })
+}
+
+func (m *Manager) sessionHealth(s *Session, h Health) {
+	m.notify(func(o Observer) { o.SessionHealth(s, h) })
+}
+
+func (m *Manager) sessionDialog(s *Session, d Dialog) {
+	m.notify(func(o Observer) { o.SessionDialog(s, d) })
+}
+
+func (m *Manager) sessionBlocked(s *Session, b Blocked) {
+	m.notify(func(o Observer) { o.SessionBlocked(s, b) })
+}
+
+func (m *Manager) sessionState(s *Session, st State) {
+	switch st {
+	case StateReady:
+		m.notify(func(o Observer) { o.SessionReady(s) })
+	case StateCrashed:
+		m.notify(func(o Observer) { o.SessionCrashed(s) })
+	}
+}
+
+// sessionStopped removes a stopped session and notifies observers.
+func (m *Manager) sessionStopped(s *Session) {
+	m.mu.Lock()
+	delete(m.sessions, s.ID)
+	m.mu.Unlock()
+
+	m.notify(func(o Observer) { o.SessionStopped(s) })
+}
+
 func (m *Manager) ListSessions() []*Session {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -66,3 +265,42 @@ func (m *Manager) ListSessions() []*Session {
 	}
 	return list
 }
+
+// SetDraining toggles whether new sessions are refused.
+func (m *Manager) SetDraining(draining bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.draining = draining
+}
+
+func (m *Manager) IsDraining() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.draining
+}
+
+// SetLowOnMemory toggles whether new sessions are refused for lack of
+// memory.
+func (m *Manager) SetLowOnMemory(low bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lowMemory = low
+}
+
+func (m *Manager) IsLowOnMemory() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lowMemory
+}
+
+// StopAll stops and removes every session at once, returning how many
+// were stopped.
+func (m *Manager) StopAll() int {
+	list := m.ListSessions()
+	var wg sync.WaitGroup
+	for _, s := range list {
+		wg.Go(s.Stop)
+	}
+	wg.Wait()
+	return len(list)
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrMemoryPressure is returned by CreateSession while host memory is low.
+var ErrMemoryPressure = errors.New("server is low on memory and not accepting new sessions")
+
+// WarningMemory is the kind of warning sent when a session uses too much
+// memory or is about to be stopped to relieve the host.
+const WarningMemory = "memory"
+
+// procRoot is where process information is read from.
+var procRoot = "/proc"
+
+// MemoryRSS returns the resident memory of the session's browser and all
+// of its child processes, in bytes, or 0 for a browser that does not run
+// as a process of this host.
+func (s *Session) MemoryRSS() int64 {
+	s.mu.Lock()
+	b := s.browser
+	s.mu.Unlock()
+	if b == nil || b.PID() == 0 {
+		return 0
+	}
+	return processTreeRSS(b.PID())
+}
+
+// processTreeRSS sums the RSS of root and its descendants.
+func processTreeRSS(root int) int64 {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return 0
+	}
+	children := make(map[int][]int)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if ppid, ok := parentPID(pid); ok {
+			children[ppid] = append(children[ppid], pid)
+		}
+	}
+
+	var total int64
+	pageSize := int64(os.Getpagesize())
+	for queue := []int{root}; len(queue) > 0; queue = queue[1:] {
+		pid := queue[0]
+		total += residentPages(pid) * pageSize
+		queue = append(queue, children[pid]...)
+	}
+	return total
+}
+
+// parentPID reads the parent of pid from /proc/<pid>/stat. The command
+// name may contain spaces and parentheses, so fields are counted from the
+// last ')'.
+func parentPID(pid int) (int, bool) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, false
+	}
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, false
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	return ppid, err == nil
+}
+
+// residentPages reads the resident set size of pid from /proc/<pid>/statm.
+func residentPages(pid int) int64 {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "statm"))
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	n, _ := strconv.ParseInt(fields[1], 10, 64)
+	return n
+}
+
+// WarnMemory sends a memory warning for the session.
+func (s *Session) WarnMemory(message string) {
+	s.warn(Warning{Kind: WarningMemory, Message: message})
+}
+
+// browserOOMScoreAdj makes the kernel OOM killer pick browsers, and the
+// renderers they fork, before the server.
+const browserOOMScoreAdj = "500"
+
+// raiseOOMScore marks a browser process as a preferred OOM victim. Raising
+// the score needs no privileges; failures are ignored.
+func raiseOOMScore(pid int) {
+	os.WriteFile(filepath.Join(procRoot, strconv.Itoa(pid), "oom_score_adj"), []byte(browserOOMScoreAdj), 0644)
+}
@@ -0,0 +1,38 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestProcessTreeRSS(t *testing.T) {
+	defer func(root string) { procRoot = root }(procRoot)
+	procRoot = t.TempDir()
+
+	// 100 is the browser, 101 and 102 its children, 103 a grandchild and
+	// 200 unrelated.
+	for pid, p := range map[int]struct {
+		ppid  int
+		pages int
+	}{
+		100: {1, 10},
+		101: {100, 20},
+		102: {100, 30},
+		103: {101, 40},
+		200: {1, 1000},
+	} {
+		dir := filepath.Join(procRoot, strconv.Itoa(pid))
+		os.MkdirAll(dir, 0755)
+		stat := strconv.Itoa(pid) + " (chrome (renderer)) S " + strconv.Itoa(p.ppid) + " 1 1 0"
+		os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)
+		os.WriteFile(filepath.Join(dir, "statm"), []byte("9999 "+strconv.Itoa(p.pages)+" 0 0 0 0 0"), 0644)
+	}
+	os.MkdirAll(filepath.Join(procRoot, "self"), 0755)
+
+	want := int64(100 * os.Getpagesize())
+	if got := processTreeRSS(100); got != want {
+		t.Errorf("processTreeRSS = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,223 @@
+package session
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"browser-server/internal/cdp"
+	"browser-server/internal/wildcard"
+)
+
+const (
+	// MaxMockRules caps the rules of a session's mocks.
+	MaxMockRules = 10000
+	// MaxMockBytes caps the total size of the bodies of a session's
+	// mocks.
+	MaxMockBytes = 64 << 20
+)
+
+// What happens to requests no mock rule answers.
+const (
+	MockUnmatchedNetwork = "network"
+	MockUnmatchedFail    = "fail"
+)
+
+// mockPattern pauses every request so the mocks can answer it.
+var mockPattern = cdp.RequestPattern{URLPattern: "*", RequestStage: "Request"}
+
+// Mocks answers a session's requests with recorded responses instead of
+// sending them, so that pages can be tested without the sites they
+// depend on.
+type Mocks struct {
+	Rules []MockRule `json:"rules"`
+	// Unmatched is MockUnmatchedNetwork (the default) to send requests
+	// no rule answers, or MockUnmatchedFail to fail them, so that the
+	// session runs offline.
+	Unmatched string `json:"unmatched,omitempty"`
+}
+
+// MockRule is the response to requests for a URL.
+type MockRule struct {
+	// Method is the request method the rule answers, any if empty.
+	Method string `json:"method,omitempty"`
+	// URL is the whole URL, or a pattern matching it with the wildcards *
+	// and ?.
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	// Headers are the response headers. A value with line breaks is sent
+	// as one header per line, as Set-Cookie needs.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is base64 in JSON.
+	Body []byte `json:"body,omitempty"`
+}
+
+// Validate checks the rules and their size.
+func (m *Mocks) Validate() error {
+	if m.Unmatched != "" && m.Unmatched != MockUnmatchedNetwork && m.Unmatched != MockUnmatchedFail {
+		return fmt.Errorf("mocks.unmatched must be %q or %q", MockUnmatchedNetwork, MockUnmatchedFail)
+	}
+	if len(m.Rules) > MaxMockRules {
+		return fmt.Errorf("at most %d mock rules are allowed", MaxMockRules)
+	}
+	size := 0
+	for _, r := range m.Rules {
+		if strings.TrimSpace(r.URL) == "" {
+			return fmt.Errorf("mock rule without url")
+		}
+		if r.Status < 100 || r.Status > 599 {
+			return fmt.Errorf("mock rule for %s has invalid status %d", r.URL, r.Status)
+		}
+		for name, value := range r.Headers {
+			if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+			if strings.Contains(value, "\r") {
+				return fmt.Errorf("invalid value for header %q", name)
+			}
+		}
+		size += len(r.Body)
+	}
+	if size > MaxMockBytes {
+		return fmt.Errorf("mock bodies may total at most %d MB", MaxMockBytes>>20)
+	}
+	return nil
+}
+
+// match returns the first rule answering a request.
+func (m *Mocks) match(method, url string) (MockRule, bool) {
+	for _, r := range m.Rules {
+		if r.Method != "" && !strings.EqualFold(r.Method, method) {
+			continue
+		}
+		if r.URL == url || wildcard.Match(r.URL, url) {
+			return r, true
+		}
+	}
+	return MockRule{}, false
+}
+
+// headers returns the rule's headers for Fetch.fulfillRequest.
+func (r MockRule) headers() []cdp.HeaderEntry {
+	out := make([]cdp.HeaderEntry, 0, len(r.Headers))
+	for name, values := range r.Headers {
+		for _, value := range strings.Split(values, "\n") {
+			out = append(out, cdp.HeaderEntry{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// answerFromMocks fulfils or fails a paused request as the session's mocks
+// say, reporting whether it did.
+func (m *monitor) answerFromMocks(page cdp.Fetch, e cdp.RequestPaused) bool {
+	mocks := m.s.opts.Mocks
+	if mocks == nil {
+		return false
+	}
+	if rule, ok := mocks.match(e.Request.Method, e.Request.URL); ok {
+		page.FulfillRequest(e.RequestID, rule.Status, rule.headers(), rule.Body)
+		return true
+	}
+	if mocks.Unmatched == MockUnmatchedFail {
+		page.FailRequest(e.RequestID, "InternetDisconnected")
+		return true
+	}
+	return false
+}
+
+// harLog is the part of a HAR 1.2 file that mocks are made from.
+type harLog struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				Content struct {
+					Size     int64   `json:"size"`
+					Text     *string `json:"text"`
+					Encoding string  `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// mockedHeaders are response headers that no longer describe a body
+// replayed from a HAR, which holds it decoded.
+var mockedHeaders = map[string]bool{
+	"content-encoding":  true,
+	"content-length":    true,
+	"transfer-encoding": true,
+}
+
+// MocksFromHAR turns the entries of a HAR 1.2 file into mock rules for
+// their exact method and URL, the first response winning. It also returns
+// how many entries it skipped: those without a response, repeated
+// requests, and responses whose body the HAR leaves out.
+func MocksFromHAR(data []byte) (*Mocks, int, error) {
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, 0, fmt.Errorf("invalid HAR: %w", err)
+	}
+	mocks := &Mocks{Rules: []MockRule{}}
+	seen := make(map[string]bool)
+	skipped := 0
+	for _, e := range har.Log.Entries {
+		res := e.Response
+		key := e.Request.Method + " " + e.Request.URL
+		if res.Status < 100 || res.Status > 599 || e.Request.URL == "" || seen[key] {
+			skipped++
+			continue
+		}
+		var body []byte
+		switch {
+		case res.Content.Text != nil && res.Content.Encoding == "base64":
+			b, err := base64.StdEncoding.DecodeString(*res.Content.Text)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid body of %s: %w", e.Request.URL, err)
+			}
+			body = b
+		case res.Content.Text != nil:
+			body = []byte(*res.Content.Text)
+		case res.Content.Size > 0:
+			// Replaying an empty body would break the page more than
+			// letting the request through.
+			skipped++
+			continue
+		}
+		seen[key] = true
+
+		headers := make(map[string]string, len(res.Headers))
+		for _, h := range res.Headers {
+			name := http.CanonicalHeaderKey(h.Name)
+			if mockedHeaders[strings.ToLower(name)] || strings.HasPrefix(name, ":") {
+				continue
+			}
+			if prev, ok := headers[name]; ok {
+				headers[name] = prev + "\n" + h.Value
+			} else {
+				headers[name] = h.Value
+			}
+		}
+		mocks.Rules = append(mocks.Rules, MockRule{
+			Method:  e.Request.Method,
+			URL:     e.Request.URL,
+			Status:  res.Status,
+			Headers: headers,
+			Body:    body,
+		})
+	}
+	return mocks, skipped, nil
+}
@@ -0,0 +1,85 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMocksFromRecordedHAR(t *testing.T) {
+	r := &recorder{requests: make(map[string]*harEntry)}
+	for _, ev := range []struct{ method, params string }{
+		{"Network.requestWillBeSent", `{"requestId":"1","request":{"url":"https://shop.example.com/","method":"GET"},"timestamp":1}`},
+		{"Network.responseReceived", `{"requestId":"1","response":{"status":200,"mimeType":"text/html","headers":{"Content-Type":"text/html","Content-Encoding":"gzip","Set-Cookie":"a=1\nb=2"}}}`},
+		{"Network.loadingFinished", `{"requestId":"1","timestamp":2,"encodedDataLength":40}`},
+		// No body was captured for the script.
+		{"Network.requestWillBeSent", `{"requestId":"2","request":{"url":"https://cdn.example.com/app.js","method":"GET"},"timestamp":3}`},
+		{"Network.responseReceived", `{"requestId":"2","response":{"status":200,"mimeType":"text/javascript"}}`},
+		{"Network.loadingFinished", `{"requestId":"2","timestamp":4,"encodedDataLength":900}`},
+		{"Network.requestWillBeSent", `{"requestId":"3","request":{"url":"https://ads.example.net/","method":"GET"},"timestamp":5}`},
+		{"Network.loadingFailed", `{"requestId":"3","timestamp":6,"errorText":"net::ERR_BLOCKED_BY_CLIENT"}`},
+	} {
+		r.handleEvent(ev.method, json.RawMessage(ev.params))
+	}
+	har, err := json.Marshal(r.har(func(id string) []byte {
+		if id == "1" {
+			return []byte("<h1>Shop</h1>")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mocks, skipped, err := MocksFromHAR(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 2 || len(mocks.Rules) != 1 {
+		t.Fatalf("%d rules, %d skipped; want 1 and 2", len(mocks.Rules), skipped)
+	}
+	if err := mocks.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	rule, ok := mocks.match("GET", "https://shop.example.com/")
+	if !ok || string(rule.Body) != "<h1>Shop</h1>" || rule.Status != 200 {
+		t.Fatalf("match = %+v, %v", rule, ok)
+	}
+	if _, ok := rule.Headers["Content-Encoding"]; ok {
+		t.Error("content encoding of a decoded body kept")
+	}
+	cookies := 0
+	for _, h := range rule.headers() {
+		if h.Name == "Set-Cookie" {
+			cookies++
+		}
+	}
+	if cookies != 2 {
+		t.Errorf("%d Set-Cookie headers, want 2", cookies)
+	}
+	if _, ok := mocks.match("POST", "https://shop.example.com/"); ok {
+		t.Error("rule answered another method")
+	}
+}
+
+func TestMocksMatchPatterns(t *testing.T) {
+	mocks := &Mocks{Rules: []MockRule{
+		{URL: "https://api.example.com/v1/*", Status: 503},
+		{URL: "https://api.example.com/*", Status: 200},
+	}}
+	if r, _ := mocks.match("GET", "https://api.example.com/v1/cart?x=1"); r.Status != 503 {
+		t.Errorf("first matching rule not used: %d", r.Status)
+	}
+	if r, _ := mocks.match("POST", "https://api.example.com/health"); r.Status != 200 {
+		t.Errorf("pattern did not match: %d", r.Status)
+	}
+	for _, m := range []Mocks{
+		{Unmatched: "offline"},
+		{Rules: []MockRule{{Status: 200}}},
+		{Rules: []MockRule{{URL: "https://example.com/", Status: 0}}},
+		{Rules: []MockRule{{URL: "https://example.com/", Status: 200, Headers: map[string]string{"Bad Name": "x"}}}},
+	} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("%+v accepted", m)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// monitor attaches to every page of a session over a dedicated browser-level
+// CDP connection. It counts the bytes the pages download, applies
+// throttling, and feeds the artifact recorder.
+type monitor struct {
+	s      *Session
+	client *cdp.Client
+
+	mu       sync.Mutex
+	sessions map[string]int      // attached CDP session IDs and attach order
+	frames   map[string]struct{} // CDP session IDs of out-of-process iframes
+	targets  map[string]string   // target ID of each attached CDP session
+	ready    map[string]struct{} // target IDs of pages enableTarget is done with
+	attached int
+	// addresses are recent checks of hosts against the allowed domains.
+	addresses map[string]addressCheck
+}
+
+// startMonitor connects to the browser and runs until ctx is cancelled or
+// the browser goes away.
+func startMonitor(ctx context.Context, s *Session, wsURL string) (*monitor, error) {
+	client, err := cdp.Dial(ctx, wsURL)
+	if err != nil {
+		return nil, err
+	}
+	m := &monitor{
+		s:        s,
+		client:   client,
+		sessions: make(map[string]int),
+		frames:   make(map[string]struct{}),
+		targets:  make(map[string]string),
+		ready:    make(map[string]struct{}),
+
+		addresses: make(map[string]addressCheck),
+	}
+
+	context.AfterFunc(ctx, func() { client.Close() })
+	go m.eventLoop(ctx, client.Events())
+
+	if s.recorder != nil {
+		if err := (cdp.Browser{Caller: client}).SetDownloadBehavior(ctx, s.recorder.downloadsDir()); err != nil {
+			log.Printf("Session %s: failed to enable downloads: %v", s.ID, err)
+		}
+	}
+	if err := (cdp.Target{Caller: client}).SetDiscoverTargets(ctx, true); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *monitor) eventLoop(ctx context.Context, events <-chan cdp.Message) {
+	for msg := range events {
+		switch msg.Method {
+		case "Target.targetCreated":
+			var e cdp.TargetCreated
+			if msg.Decode(&e) == nil && e.TargetInfo.Type == "page" {
+				go m.attach(ctx, e.TargetInfo.TargetID)
+			}
+
+		case "Target.targetCrashed":
+			var e cdp.TargetCrashed
+			if msg.Decode(&e) == nil {
+				log.Printf("Session %s: renderer crashed (%s, code %d)", m.s.ID, e.Status, e.ErrorCode)
+				m.s.browserCrashed("renderer_crashed", fmt.Sprintf("%s (code %d)", e.Status, e.ErrorCode))
+			}
+
+		case "Target.attachedToTarget":
+			var e cdp.AttachedToTarget
+			if msg.Decode(&e) == nil && msg.SessionID != "" {
+				go m.attachChild(ctx, e)
+			}
+
+		case "Target.detachedFromTarget":
+			var e cdp.DetachedFromTarget
+			if msg.Decode(&e) == nil {
+				m.mu.Lock()
+				delete(m.ready, m.targets[e.SessionID])
+				delete(m.sessions, e.SessionID)
+				delete(m.frames, e.SessionID)
+				delete(m.targets, e.SessionID)
+				m.mu.Unlock()
+				if m.s.redactor != nil {
+					m.s.redactor.forget(e.SessionID)
+				}
+			}
+
+		case "Network.responseReceived":
+			var e cdp.ResponseReceived
+			if msg.Decode(&e) == nil {
+				m.s.bodies.responseReceived(e)
+			}
+
+		case "Network.loadingFinished":
+			var e cdp.LoadingFinished
+			if msg.Decode(&e) == nil {
+				m.s.countNetworkBytes(int64(e.EncodedDataLength))
+				if b, ok := m.s.bodies.finished(e.RequestID); ok {
+					go m.captureBody(ctx, m.client.Session(msg.SessionID), b)
+				}
+			}
+
+		case "Network.loadingFailed":
+			var e cdp.LoadingFailed
+			if msg.Decode(&e) == nil {
+				m.s.bodies.finished(e.RequestID)
+			}
+
+		case "Page.screencastFrame":
+			m.s.cast.handleFrame(msg)
+			continue
+
+		case "Page.frameNavigated":
+			var e cdp.FrameNavigated
+			if msg.Decode(&e) == nil && e.Frame.ParentID == "" && m.isPage(msg.SessionID) {
+				if m.s.redactor != nil {
+					// Hide the new document until it reports what to redact.
+					m.s.redactor.forget(msg.SessionID)
+				}
+				m.s.addTimeline("navigated", e.Frame.URL)
+				if m.s.opts.RecordInteractions {
+					m.s.recordNavigation(e.Frame.URL)
+				}
+			}
+
+		case "Fetch.requestPaused":
+			m.continueRequest(ctx, msg)
+			continue
+
+		case "Page.javascriptDialogOpening":
+			m.handleDialog(msg)
+
+		case "Runtime.bindingCalled":
+			if m.s.opts.RecordInteractions {
+				m.s.handleBinding(msg)
+			}
+			m.s.handlePrintBinding(msg)
+			m.s.handleConsentBinding(msg)
+			m.s.handleRedactBinding(msg)
+		}
+
+		if m.s.recorder != nil {
+			m.s.recorder.handleEvent(msg.Method, msg.Params)
+		}
+		m.mu.Lock()
+		target := m.targets[msg.SessionID]
+		m.mu.Unlock()
+		m.s.feed.publish(CDPEvent{Method: msg.Method, TargetID: target, Params: msg.Params})
+	}
+}
+
+// attach attaches to a page and enables the domains the session needs,
+// in the page and in its out-of-process iframes.
+func (m *monitor) attach(ctx context.Context, targetID string) {
+	id, err := cdp.Target{Caller: m.client}.AttachToTarget(ctx, targetID)
+	if err != nil || id == "" {
+		return
+	}
+	page := m.client.Session(id)
+
+	m.mu.Lock()
+	m.attached++
+	m.sessions[id] = m.attached
+	m.targets[id] = targetID
+	m.mu.Unlock()
+
+	m.enableTarget(ctx, page)
+	if m.s.opts.RecordInteractions {
+		if err := enableInteractionRecording(ctx, page); err != nil {
+			log.Printf("Session %s: failed to enable interaction recording: %v", m.s.ID, err)
+		}
+	}
+	if err := (cdp.Target{Caller: page}).SetAutoAttach(ctx, true); err != nil {
+		log.Printf("Session %s: failed to attach to iframes: %v", m.s.ID, err)
+	}
+	m.mu.Lock()
+	m.ready[targetID] = struct{}{}
+	m.mu.Unlock()
+	m.s.cast.pageAttached()
+}
+
+// waitReady waits until the monitor has attached to a page and enabled
+// what the session needs in it, and returns its target ID. With targetID
+// "" it waits for any page, the oldest winning.
+func (m *monitor) waitReady(ctx context.Context, targetID string) (string, error) {
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		targets := []string{targetID}
+		if targetID == "" {
+			targets = m.pageTargets()
+		}
+		m.mu.Lock()
+		for _, t := range targets {
+			if _, ok := m.ready[t]; ok {
+				m.mu.Unlock()
+				return t, nil
+			}
+		}
+		m.mu.Unlock()
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// enableTarget enables what the session needs in a page or iframe.
+func (m *monitor) enableTarget(ctx context.Context, page *cdp.Session) {
+	if err := (cdp.Network{Caller: page}).Enable(ctx); err != nil {
+		log.Printf("Session %s: failed to enable network metering: %v", m.s.ID, err)
+	}
+	if m.s.bodies.active() {
+		enableBodyBuffers(ctx, page)
+	}
+	cdp.Page{Caller: page}.Enable(ctx)
+	if err := enableFetch(ctx, page, m.s.opts); err != nil {
+		log.Printf("Session %s: failed to enable request interception: %v", m.s.ID, err)
+	}
+	if f := m.s.opts.Fingerprint; f != nil {
+		if err := applyFingerprint(ctx, page, f); err != nil {
+			log.Printf("Session %s: failed to apply fingerprint: %v", m.s.ID, err)
+		}
+	}
+	if m.s.recorder != nil {
+		cdp.Runtime{Caller: page}.Enable(ctx)
+		cdp.Log{Caller: page}.Enable(ctx)
+	}
+	for _, d := range []string{"Runtime", "Log"} {
+		if m.s.feed.wants(d) {
+			enableFeedDomains(ctx, page, []string{d})
+		}
+	}
+	if p := m.s.opts.Dialogs; p != nil && p.Print != "" {
+		if err := enablePrintPolicy(ctx, page, p.Print); err != nil {
+			log.Printf("Session %s: failed to apply the print dialog policy: %v", m.s.ID, err)
+		}
+	}
+	if prefer := m.s.opts.DismissConsent; prefer != "" {
+		if err := enableConsentDismissal(ctx, page, prefer, m.s.opts.ConsentRules); err != nil {
+			log.Printf("Session %s: failed to enable consent banner dismissal: %v", m.s.ID, err)
+		}
+	}
+	if r := m.s.opts.Redaction; r != nil {
+		if err := enableRedaction(ctx, page, r); err != nil {
+			log.Printf("Session %s: failed to enable redaction: %v", m.s.ID, err)
+		}
+	}
+	if mode := m.s.opts.Countdown; mode != "" {
+		if err := enableCountdown(ctx, page, m.s.ExpiresAt, mode); err != nil {
+			log.Printf("Session %s: failed to enable the countdown: %v", m.s.ID, err)
+		}
+	}
+	if c := m.s.opts.Clock; c != nil {
+		if err := c.apply(ctx, page); err != nil {
+			log.Printf("Session %s: failed to set the clock: %v", m.s.ID, err)
+		}
+	}
+	if e := m.s.Emulation(); e != (Emulation{}) {
+		if err := e.apply(ctx, page); err != nil {
+			log.Printf("Session %s: failed to apply emulation: %v", m.s.ID, err)
+		}
+	}
+	if m.s.usage.throttled.Load() {
+		cdp.Network{Caller: page}.EmulateNetworkConditions(ctx, throttledConditions())
+	}
+}
+
+// installScript runs script in every document the page loads from now on
+// and in the one already loaded.
+func installScript(ctx context.Context, page *cdp.Session, script string) error {
+	if err := (cdp.Page{Caller: page}).AddScriptToEvaluateOnNewDocument(ctx, script); err != nil {
+		return err
+	}
+	_, err := (cdp.Runtime{Caller: page}).Evaluate(ctx, script)
+	return err
+}
+
+// pages returns the attached pages, oldest first.
+func (m *monitor) pages() []*cdp.Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0, len(m.sessions))
+	for id := range m.sessions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return m.sessions[ids[i]] < m.sessions[ids[j]] })
+
+	out := make([]*cdp.Session, len(ids))
+	for i, id := range ids {
+		out[i] = m.client.Session(id)
+	}
+	return out
+}
+
+// pageTargets returns the target IDs of the attached pages, oldest first.
+func (m *monitor) pageTargets() []string {
+	pages := m.pages()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, 0, len(pages))
+	for _, p := range pages {
+		if t, ok := m.targets[p.ID]; ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// throttleAll limits the network bandwidth of every attached page and
+// iframe.
+func (m *monitor) throttleAll() {
+	for _, page := range append(m.pages(), m.iframes()...) {
+		page.Send("Network.emulateNetworkConditions", throttledConditions())
+	}
+}
+
+func throttledConditions() cdp.NetworkConditions {
+	return cdp.NetworkConditions{
+		DownloadThroughput: throttledRate,
+		UploadThroughput:   throttledRate,
+	}
+}
+
+// evaluateAll runs a JavaScript expression in every attached page without
+// waiting for the results.
+func (m *monitor) evaluateAll(expression string) {
+	for _, page := range m.pages() {
+		page.Send("Runtime.evaluate", map[string]interface{}{"expression": expression})
+	}
+}
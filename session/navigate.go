@@ -0,0 +1,114 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// navigateTimeout bounds how long Navigate waits for the page to commit.
+const navigateTimeout = 30 * time.Second
+
+// Navigate loads url in the session's first page and returns once the
+// navigation has committed.
+func (s *Session) Navigate(url string) error {
+	s.MarkRunning()
+	page, err := s.firstPage()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, navigateTimeout)
+	defer cancel()
+	res, err := cdp.Page{Caller: page}.Navigate(ctx, url)
+	if err != nil {
+		return err
+	}
+	if res.ErrorText != "" {
+		return fmt.Errorf("navigation failed: %s", res.ErrorText)
+	}
+	return nil
+}
+
+// LoadResult is the document a page ended up on after Load.
+type LoadResult struct {
+	// URL is the document's URL after redirects.
+	URL string
+	// Status is the document's HTTP status, 0 for documents that did not
+	// come from the network.
+	Status int
+}
+
+// Load navigates the session's first page to url and waits until it has
+// loaded. If ctx ends after the document arrived but before the page
+// finished loading, the result is returned without an error.
+func (s *Session) Load(ctx context.Context, url string) (LoadResult, error) {
+	s.MarkRunning()
+	m := s.mon.Load()
+	if m == nil {
+		return LoadResult{}, errors.New("page control unavailable")
+	}
+	pages, targets := m.pages(), m.pageTargets()
+	if len(pages) == 0 || len(targets) == 0 {
+		return LoadResult{}, ErrNoPage
+	}
+	sub, err := s.SubscribeCDP([]string{"Network", "Page"})
+	if err != nil {
+		return LoadResult{}, err
+	}
+	defer sub.Close()
+
+	nav, err := cdp.Page{Caller: pages[0]}.Navigate(ctx, url)
+	if err != nil {
+		return LoadResult{}, err
+	}
+	if nav.ErrorText != "" {
+		return LoadResult{}, fmt.Errorf("navigation failed: %s", nav.ErrorText)
+	}
+
+	res := LoadResult{URL: url}
+	arrived := false
+	for {
+		select {
+		case e := <-sub.C:
+			if e.TargetID != targets[0] {
+				continue
+			}
+			switch e.Method {
+			case "Network.responseReceived":
+				var r cdp.ResponseReceived
+				if json.Unmarshal(e.Params, &r) == nil && r.RequestID == nav.LoaderID {
+					res.URL, res.Status = r.Response.URL, r.Response.Status
+					arrived = true
+				}
+			case "Page.loadEventFired":
+				return res, nil
+			}
+		case <-ctx.Done():
+			if arrived {
+				return res, nil
+			}
+			return res, ctx.Err()
+		}
+	}
+}
+
+// BringToFront raises the session's first page so it keeps painting.
+func (s *Session) BringToFront() error {
+	m := s.mon.Load()
+	if m == nil {
+		return errors.New("page control unavailable")
+	}
+	pages := m.pages()
+	if len(pages) == 0 {
+		return ErrNoPage
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	defer cancel()
+	return cdp.Page{Caller: pages[0]}.BringToFront(ctx)
+}
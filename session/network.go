@@ -0,0 +1,72 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// IPFamily selects the address family the server uses for its own
+// connections: the browser's DevTools endpoint and WebRTC candidates.
+type IPFamily string
+
+const (
+	// DualStack uses both families, with IPv4 loopback for DevTools.
+	DualStack IPFamily = ""
+	IPv4      IPFamily = "ipv4"
+	IPv6      IPFamily = "ipv6"
+)
+
+// ParseIPFamily parses "ipv4", "ipv6" or "dual" (or "").
+func ParseIPFamily(s string) (IPFamily, error) {
+	switch f := IPFamily(strings.ToLower(strings.TrimSpace(s))); f {
+	case IPv4, IPv6:
+		return f, nil
+	case DualStack, "dual":
+		return DualStack, nil
+	}
+	return "", fmt.Errorf("invalid IP family %q: want ipv4, ipv6 or dual", s)
+}
+
+// Loopback is the loopback address of the family.
+func (f IPFamily) Loopback() string {
+	if f == IPv6 {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
+
+// remoteDebuggingAddress returns the --remote-debugging-address flag
+// value in args, or "".
+func remoteDebuggingAddress(args []string) string {
+	for _, a := range args {
+		if v, ok := strings.CutPrefix(a, "--remote-debugging-address="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// loopbackURL rewrites a DevTools URL whose host is "localhost" or an
+// unspecified address to the loopback address Chrome was told to bind,
+// so the server dials the address actually listening rather than
+// whichever one the resolver returns first.
+func loopbackURL(wsURL, bound string) string {
+	u, err := url.Parse(strings.TrimSpace(wsURL))
+	if err != nil {
+		return wsURL
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsUnspecified()) {
+		return u.String()
+	}
+	if bound == "" || net.ParseIP(bound).IsUnspecified() {
+		bound = "127.0.0.1"
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			bound = "::1"
+		}
+	}
+	u.Host = net.JoinHostPort(bound, u.Port())
+	return u.String()
+}
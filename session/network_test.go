@@ -0,0 +1,32 @@
+package session
+
+import "testing"
+
+func TestLoopbackURL(t *testing.T) {
+	for _, tc := range []struct{ url, bound, want string }{
+		{"ws://127.0.0.1:9222/devtools/browser/a", "127.0.0.1", "ws://127.0.0.1:9222/devtools/browser/a"},
+		{"ws://[::1]:9222/devtools/browser/a", "::1", "ws://[::1]:9222/devtools/browser/a"},
+		{"ws://localhost:9222/devtools/browser/a", "::1", "ws://[::1]:9222/devtools/browser/a"},
+		{"ws://localhost:9222/devtools/browser/a\r", "", "ws://127.0.0.1:9222/devtools/browser/a"},
+		{"ws://0.0.0.0:9222/devtools/browser/a", "0.0.0.0", "ws://127.0.0.1:9222/devtools/browser/a"},
+		{"ws://[::]:9222/devtools/browser/a", "::", "ws://[::1]:9222/devtools/browser/a"},
+	} {
+		if got := loopbackURL(tc.url, tc.bound); got != tc.want {
+			t.Errorf("loopbackURL(%q, %q) = %q, want %q", tc.url, tc.bound, got, tc.want)
+		}
+	}
+}
+
+func TestParseIPFamily(t *testing.T) {
+	for in, want := range map[string]IPFamily{"": DualStack, "dual": DualStack, "IPv6": IPv6, "ipv4": IPv4} {
+		if got, err := ParseIPFamily(in); err != nil || got != want {
+			t.Errorf("ParseIPFamily(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseIPFamily("ipv5"); err == nil {
+		t.Error("ParseIPFamily accepted ipv5")
+	}
+	if IPv6.Loopback() != "::1" || DualStack.Loopback() != "127.0.0.1" {
+		t.Error("unexpected loopback addresses")
+	}
+}
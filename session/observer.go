@@ -0,0 +1,46 @@
+package session
+
+// Observer is notified of session lifecycle changes. Subsystems such as
+// events, billing and artifacts register one with Manager.Observe instead
+// of hooking into the lifecycle code. Embed NopObserver to implement only
+// the methods you need.
+type Observer interface {
+	// SessionCreated is called once a new session is registered.
+	SessionCreated(*Session)
+	// SessionReady is called when the browser is up: after creation and
+	// after every restart.
+	SessionReady(*Session)
+	// SessionCrashed is called when the browser exits unexpectedly.
+	SessionCrashed(*Session)
+	// SessionStopped is called after a session stopped and was removed.
+	SessionStopped(*Session)
+	// SessionWarning is called when a session is about to be cut off or
+	// uses too much of something.
+	SessionWarning(*Session, Warning)
+	// SessionHealth is called when a session's health status changes.
+	SessionHealth(*Session, Health)
+	// SessionDialog is called when a page opens a dialog.
+	SessionDialog(*Session, Dialog)
+	// SessionBlocked is called when the deny list stops a navigation.
+	SessionBlocked(*Session, Blocked)
+}
+
+// NopObserver implements Observer with methods that do nothing.
+type NopObserver struct{}
+
+func (NopObserver) SessionCreated(*Session)          {}
+func (NopObserver) SessionReady(*Session)            {}
+func (NopObserver) SessionCrashed(*Session)          {}
+func (NopObserver) SessionStopped(*Session)          {}
+func (NopObserver) SessionWarning(*Session, Warning) {}
+func (NopObserver) SessionHealth(*Session, Health)   {}
+func (NopObserver) SessionDialog(*Session, Dialog)   {}
+func (NopObserver) SessionBlocked(*Session, Blocked) {}
+
+// setOnState registers the callback run after the session changes state,
+// other than into terminating and its final state.
+func (s *Session) setOnState(fn func(*Session, State)) {
+	s.mu.Lock()
+	s.onState = fn
+	s.mu.Unlock()
+}
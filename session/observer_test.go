@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type recordingObserver struct {
+	NopObserver
+	calls []string
+}
+
+func (o *recordingObserver) SessionReady(s *Session)   { o.calls = append(o.calls, "ready") }
+func (o *recordingObserver) SessionCrashed(s *Session) { o.calls = append(o.calls, "crashed") }
+func (o *recordingObserver) SessionStopped(s *Session) { o.calls = append(o.calls, "stopped") }
+
+func TestManagerNotifiesObservers(t *testing.T) {
+	m := NewManager()
+	o := &recordingObserver{}
+	m.Observe(o)
+
+	s := &Session{ID: "s1", state: StateReady}
+	m.sessions[s.ID] = s
+	s.setOnState(m.sessionState)
+
+	s.setState(StateRunning)
+	s.setState(StateCrashed)
+	s.setState(StateRunning) // refused, not reported
+	s.setState(StateReady)
+	s.setState(StateTerminating)
+	m.sessionStopped(s)
+
+	want := []string{"crashed", "ready", "stopped"}
+	if !reflect.DeepEqual(o.calls, want) {
+		t.Errorf("calls = %v, want %v", o.calls, want)
+	}
+	if _, ok := m.GetSession(s.ID); ok {
+		t.Error("stopped session still registered")
+	}
+}
+
+// stopCounter counts SessionStopped calls, which may come from any
+// goroutine.
+type stopCounter struct {
+	NopObserver
+	stopped atomic.Int32
+}
+
+func (o *stopCounter) SessionStopped(s *Session) { o.stopped.Add(1) }
+
+func TestSessionStoppedOnceWhenRegisteredWhileTerminating(t *testing.T) {
+	m := NewManager()
+	o := &stopCounter{}
+	m.Observe(o)
+	m.register(&Session{ID: "s0", state: StateTerminating})
+	if n := o.stopped.Load(); n != 0 {
+		t.Errorf("SessionStopped called %d times for a session still terminating", n)
+	}
+
+	for range 100 {
+		m = NewManager()
+		o = &stopCounter{}
+		m.Observe(o)
+		ctx, cancel := context.WithCancel(context.Background())
+		s := &Session{ID: "s1", ctx: ctx, cancel: cancel, state: StateReady}
+
+		var wg sync.WaitGroup
+		wg.Go(s.Stop)
+		wg.Go(func() { m.register(s) })
+		wg.Wait()
+		if n := o.stopped.Load(); n != 1 {
+			t.Fatalf("SessionStopped called %d times", n)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package session
+
+import (
+	"errors"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// poolRetryDelay is how long the pool waits before launching again after
+// a warm browser failed to start.
+const poolRetryDelay = 10 * time.Second
+
+// PoolConfig configures a Manager's pool of pre-warmed browsers, which
+// CreateSession hands out instead of cold-starting Chrome.
+type PoolConfig struct {
+	// Options are what warm browsers are launched with. Only sessions
+	// asking for the same options are served from the pool, apart from
+	// those set when a warm session is claimed: Owner, Duration, Labels,
+	// WarnBefore, LeaseTimeout and Watermark.
+	Options Options
+	// Min is how many idle browsers are kept warm. When the pool runs dry
+	// it keeps one more warm for each session that had to be
+	// cold-started, up to Max.
+	Min, Max int
+	// IdleTimeout is how long a browser may sit idle before the pool
+	// shrinks back towards Min.
+	IdleTimeout time.Duration
+	// Concurrency is how many browsers the pool launches at once while
+	// refilling, 1 if zero.
+	Concurrency int
+}
+
+// Validate checks a pool configuration.
+func (c *PoolConfig) Validate() error {
+	if c.Min < 1 || c.Max < c.Min {
+		return errors.New("the warm pool needs 1 <= min <= max")
+	}
+	if c.IdleTimeout <= 0 {
+		return errors.New("the warm pool needs a positive idle timeout")
+	}
+	if c.Concurrency < 0 {
+		return errors.New("the warm pool's concurrency cannot be negative")
+	}
+	// Both are fixed when the first page loads.
+	if c.Options.Countdown != "" {
+		return errors.New("sessions with a countdown cannot be pre-warmed")
+	}
+	if c.Options.Clock != nil {
+		return errors.New("sessions with an overridden clock cannot be pre-warmed")
+	}
+	return nil
+}
+
+// PoolStats reports how a warm pool is doing.
+type PoolStats struct {
+	Idle      int `json:"idle"`
+	Launching int `json:"launching"`
+	// Target is how many idle browsers the pool is keeping warm.
+	Target int `json:"target"`
+	// Hits and Misses count the sessions served from the pool and those
+	// that matched it but found it empty.
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// pool keeps browsers launched ahead of the sessions that will use them.
+type pool struct {
+	cfg PoolConfig
+	m   *Manager
+	// launch starts a warm session; tests replace it.
+	launch func(Options) (*Session, error)
+
+	mu         sync.Mutex
+	idle       []*Session // oldest first
+	idleSince  map[*Session]time.Time
+	launching  int
+	target     int
+	retryAfter time.Time
+	closed     bool
+	stats      PoolStats
+}
+
+func newPool(m *Manager, cfg PoolConfig) *pool {
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 1
+	}
+	return &pool{
+		cfg: cfg,
+		m:   m,
+		launch: func(opts Options) (*Session, error) {
+			opts, err := m.launchOptions(opts)
+			if err != nil {
+				return nil, err
+			}
+			return newSession(opts, true)
+		},
+		idleSince: make(map[*Session]time.Time),
+		target:    cfg.Min,
+	}
+}
+
+// claimFields are the options a warm session takes on when it is claimed.
+func claimFields(opts Options) Options {
+	opts.Owner = ""
+	opts.Priority = ""
+	opts.Quota = Quota{}
+	opts.Duration = 0
+	opts.Labels = nil
+	opts.WarnBefore = 0
+	opts.LeaseTimeout = 0
+	opts.Watermark = ""
+	return opts
+}
+
+// matches reports whether a session asking for opts can be served from
+// the pool.
+func (p *pool) matches(opts Options) bool {
+	return reflect.DeepEqual(claimFields(opts), claimFields(p.cfg.Options))
+}
+
+// claim hands out an idle browser for a session asking for opts, or nil
+// if there is none or the options do not match.
+func (p *pool) claim(opts Options) *Session {
+	if !p.matches(opts) {
+		return nil
+	}
+	p.mu.Lock()
+	var s *Session
+	for len(p.idle) > 0 && s == nil {
+		s = p.idle[0]
+		p.idle = p.idle[1:]
+		delete(p.idleSince, s)
+		// A browser that crashed or went unhealthy while idle is no use.
+		if s.State() != StateReady {
+			go s.Stop()
+			s = nil
+		}
+	}
+	if s == nil {
+		p.stats.Misses++
+		// Demand outran the pool, so keep more warm.
+		p.target = min(p.target+1, p.cfg.Max)
+	} else {
+		p.stats.Hits++
+	}
+	p.mu.Unlock()
+
+	p.refill()
+	if s != nil {
+		s.claim(opts)
+	}
+	return s
+}
+
+// refill launches browsers in the background until the pool is back at
+// its target. Nothing is launched while the manager refuses sessions.
+func (p *pool) refill() {
+	if p.m.IsDraining() || p.m.IsLowOnMemory() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || time.Now().Before(p.retryAfter) {
+		return
+	}
+	for len(p.idle)+p.launching < p.target && p.launching < p.cfg.Concurrency {
+		p.launching++
+		go p.launchOne()
+	}
+}
+
+func (p *pool) launchOne() {
+	s, err := p.launch(p.cfg.Options)
+
+	if err == nil {
+		// A browser that stops while idle leaves the pool.
+		s.setOnStop(p.idleStopped)
+	}
+
+	p.mu.Lock()
+	p.launching--
+	if err != nil {
+		log.Printf("Warm pool: failed to launch a browser: %v", err)
+		p.retryAfter = time.Now().Add(poolRetryDelay)
+		time.AfterFunc(poolRetryDelay, p.refill)
+		p.mu.Unlock()
+		return
+	}
+	if p.closed {
+		p.mu.Unlock()
+		s.Stop()
+		return
+	}
+	p.idle = append(p.idle, s)
+	p.idleSince[s] = time.Now()
+	p.mu.Unlock()
+	p.refill()
+}
+
+// idleStopped drops a warm session that stopped before it was claimed.
+func (p *pool) idleStopped(s *Session) {
+	p.mu.Lock()
+	for i, idle := range p.idle {
+		if idle == s {
+			p.idle = append(p.idle[:i:i], p.idle[i+1:]...)
+			delete(p.idleSince, s)
+			break
+		}
+	}
+	p.mu.Unlock()
+	p.refill()
+}
+
+// shrink stops browsers idle for longer than IdleTimeout, one per call,
+// lowering the target towards Min.
+func (p *pool) shrink() {
+	p.mu.Lock()
+	if len(p.idle) == 0 || p.target <= p.cfg.Min || time.Since(p.idleSince[p.idle[0]]) < p.cfg.IdleTimeout {
+		p.mu.Unlock()
+		return
+	}
+	s := p.idle[0]
+	p.idle = p.idle[1:]
+	delete(p.idleSince, s)
+	p.target--
+	p.mu.Unlock()
+	s.Stop()
+}
+
+// run shrinks and refills the pool until it is closed.
+func (p *pool) run() {
+	t := time.NewTicker(p.cfg.IdleTimeout / 4)
+	defer t.Stop()
+	for range t.C {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return
+		}
+		p.shrink()
+		p.refill()
+	}
+}
+
+// close stops the idle browsers; browsers still launching are stopped
+// when they are up.
+func (p *pool) close() {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.idleSince = make(map[*Session]time.Time)
+	p.mu.Unlock()
+	for _, s := range idle {
+		s.Stop()
+	}
+}
+
+func (p *pool) statsNow() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.stats
+	st.Idle = len(p.idle)
+	st.Launching = p.launching
+	st.Target = p.target
+	return st
+}
+
+// claim turns a warm session into one created now with opts' owner,
+// duration, labels, warning, lease and watermark, and starts its clock.
+func (s *Session) claim(opts Options) {
+	now := time.Now()
+	s.mu.Lock()
+	s.opts.Owner = opts.Owner
+	s.opts.Priority = opts.Priority
+	s.opts.Quota = opts.Quota
+	s.opts.Duration = opts.Duration
+	s.opts.Labels = opts.Labels
+	s.opts.WarnBefore = opts.WarnBefore
+	s.opts.LeaseTimeout = opts.LeaseTimeout
+	s.opts.Watermark = opts.Watermark
+	s.Owner = opts.Owner
+	s.Priority = opts.Priority.orDefault()
+	s.Labels = opts.Labels
+	s.CreatedAt = now
+	s.ExpiresAt = now.Add(opts.Duration)
+	s.lastHeartbeat = now
+	s.watermark = newWatermark(opts.Watermark, opts.Owner, s.ID)
+	s.onStop = nil
+	s.mu.Unlock()
+
+	s.addTimeline("claimed", "from the warm pool")
+	s.start()
+}
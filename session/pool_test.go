@@ -0,0 +1,124 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeWarmSession stands in for a warm browser.
+func fakeWarmSession(n int64, opts Options) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Session{
+		ID:     fmt.Sprintf("warm-%d", n),
+		state:  StateReady,
+		ctx:    ctx,
+		cancel: cancel,
+		opts:   opts,
+	}
+}
+
+func waitForPool(t *testing.T, p *pool, cond func(PoolStats) bool) PoolStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st := p.statsNow()
+		if cond(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool stuck at %+v", st)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolClaim(t *testing.T) {
+	m := NewManager()
+	p := newPool(m, PoolConfig{Options: Options{Stealth: true}, Min: 2, Max: 3, IdleTimeout: time.Minute})
+	var launched atomic.Int64
+	p.launch = func(opts Options) (*Session, error) {
+		return fakeWarmSession(launched.Add(1), opts), nil
+	}
+	defer p.close()
+	p.refill()
+	waitForPool(t, p, func(st PoolStats) bool { return st.Idle == 2 })
+
+	if s := p.claim(Options{}); s != nil {
+		t.Error("session with other options served from the pool")
+	}
+	s := p.claim(Options{Stealth: true, Owner: "alice", Duration: time.Hour, Labels: map[string]string{"job": "1"}})
+	if s == nil {
+		t.Fatal("matching session not served from the pool")
+	}
+	defer s.Stop()
+	if s.Owner != "alice" || s.Labels["job"] != "1" || time.Until(s.ExpiresAt) < 59*time.Minute {
+		t.Errorf("claimed session not set up for its request: owner %q, labels %v, expires %v", s.Owner, s.Labels, s.ExpiresAt)
+	}
+	st := waitForPool(t, p, func(st PoolStats) bool { return st.Idle == 2 })
+	if st.Hits != 1 || st.Misses != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	// Running dry grows the pool up to its maximum.
+	p.claim(Options{Stealth: true})
+	p.claim(Options{Stealth: true})
+	p.claim(Options{Stealth: true})
+	st = waitForPool(t, p, func(st PoolStats) bool { return st.Idle == st.Target })
+	if st.Misses != 1 || st.Target != 3 {
+		t.Errorf("after running dry: %+v", st)
+	}
+}
+
+func TestPoolDropsStoppedBrowsers(t *testing.T) {
+	p := newPool(NewManager(), PoolConfig{Min: 1, Max: 1, IdleTimeout: time.Minute})
+	var launched atomic.Int64
+	p.launch = func(opts Options) (*Session, error) {
+		return fakeWarmSession(launched.Add(1), opts), nil
+	}
+	defer p.close()
+	p.refill()
+	waitForPool(t, p, func(st PoolStats) bool { return st.Idle == 1 })
+
+	p.mu.Lock()
+	idle := p.idle[0]
+	p.mu.Unlock()
+	idle.Stop()
+	waitForPool(t, p, func(st PoolStats) bool { return st.Idle == 1 && launched.Load() == 2 })
+	if s := p.claim(Options{}); s == nil || s == idle {
+		t.Errorf("claimed %v, want the replacement browser", s)
+	}
+}
+
+func TestPoolBacksOffFailedLaunches(t *testing.T) {
+	p := newPool(NewManager(), PoolConfig{Min: 1, Max: 1, IdleTimeout: time.Minute})
+	var launched atomic.Int64
+	p.launch = func(Options) (*Session, error) {
+		launched.Add(1)
+		return nil, errors.New("no browser")
+	}
+	defer p.close()
+	p.refill()
+	waitForPool(t, p, func(st PoolStats) bool { return launched.Load() == 1 && st.Launching == 0 })
+	p.refill()
+	time.Sleep(20 * time.Millisecond)
+	if n := launched.Load(); n != 1 {
+		t.Errorf("%d launches right after a failure", n)
+	}
+}
+
+func TestPoolConfigValidate(t *testing.T) {
+	for _, cfg := range []PoolConfig{
+		{Min: 0, Max: 1, IdleTimeout: time.Minute},
+		{Min: 2, Max: 1, IdleTimeout: time.Minute},
+		{Min: 1, Max: 1},
+		{Min: 1, Max: 1, IdleTimeout: time.Minute, Options: Options{Countdown: CountdownOverlay}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Priority is a session's class when the server runs short of resources:
+// interactive sessions come before CI sessions, which come before batch
+// sessions.
+type Priority string
+
+// Priority classes, highest first.
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityCI          Priority = "ci"
+	PriorityBatch       Priority = "batch"
+)
+
+// WarningPreempted is the kind of warning sent to a session stopped to
+// make room for a session of a higher class.
+const WarningPreempted = "preempted"
+
+// ParsePriority reads a priority class; "" is PriorityCI.
+func ParsePriority(s string) (Priority, error) {
+	switch p := Priority(s); p {
+	case "":
+		return PriorityCI, nil
+	case PriorityInteractive, PriorityCI, PriorityBatch:
+		return p, nil
+	}
+	return "", fmt.Errorf("priority must be interactive, ci or batch, not %q", s)
+}
+
+func (p Priority) orDefault() Priority {
+	if p == "" {
+		return PriorityCI
+	}
+	return p
+}
+
+// Rank orders classes: higher ranks come first.
+func (p Priority) Rank() int {
+	switch p {
+	case PriorityInteractive:
+		return 2
+	case PriorityBatch:
+		return 0
+	}
+	return 1
+}
+
+// preemptFor stops the session of the lowest class below p, the youngest
+// of them so that the least work is lost, and reports whether there was
+// one.
+func (m *Manager) preemptFor(p Priority) bool {
+	var lower []*Session
+	for _, s := range m.ListSessions() {
+		if s.Priority.Rank() < p.Rank() && !s.State().closed() {
+			lower = append(lower, s)
+		}
+	}
+	if len(lower) == 0 {
+		return false
+	}
+	sort.Slice(lower, func(i, j int) bool {
+		a, b := lower[i], lower[j]
+		if a.Priority.Rank() != b.Priority.Rank() {
+			return a.Priority.Rank() < b.Priority.Rank()
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	victim := lower[0]
+	victim.warn(Warning{
+		Kind:    WarningPreempted,
+		Message: fmt.Sprintf("Server is low on memory; stopping this %s session to make room for a %s session", victim.Priority, p),
+	})
+	victim.Stop()
+	return true
+}
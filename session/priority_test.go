@@ -0,0 +1,52 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPreemptFor(t *testing.T) {
+	m := NewManager()
+	var warnings []string
+	m.Observe(warningRecorder{fn: func(s *Session, w Warning) {
+		if w.Kind == WarningPreempted {
+			warnings = append(warnings, s.ID)
+		}
+	}})
+	now := time.Now()
+	add := func(n int64, p Priority, created time.Time) *Session {
+		s := fakeWarmSession(n, Options{})
+		s.Priority, s.CreatedAt = p, created
+		m.register(s)
+		return s
+	}
+	oldBatch := add(1, PriorityBatch, now.Add(-time.Hour))
+	newBatch := add(2, PriorityBatch, now)
+	ci := add(3, PriorityCI, now)
+
+	if m.preemptFor(PriorityBatch) {
+		t.Error("batch session preempted another batch session")
+	}
+	if !m.preemptFor(PriorityCI) || newBatch.State() != StateStopped || oldBatch.State() != StateReady {
+		t.Errorf("preempting for ci stopped the wrong session: %s, %s", oldBatch.State(), newBatch.State())
+	}
+	if !m.preemptFor(PriorityInteractive) || oldBatch.State() != StateStopped || ci.State() != StateReady {
+		t.Error("preempting for interactive did not stop the remaining batch session first")
+	}
+	if len(warnings) != 2 || warnings[0] != newBatch.ID {
+		t.Errorf("preempted warnings = %v", warnings)
+	}
+
+	m.SetLowOnMemory(true)
+	if _, err := m.CreateSession(Options{Priority: PriorityBatch}); err != ErrMemoryPressure {
+		t.Errorf("batch session created short of memory: %v", err)
+	}
+}
+
+// warningRecorder is an Observer calling fn for each warning.
+type warningRecorder struct {
+	NopObserver
+	fn func(*Session, Warning)
+}
+
+func (r warningRecorder) SessionWarning(s *Session, w Warning) { r.fn(s, w) }
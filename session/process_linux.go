@@ -0,0 +1,42 @@
+//go:build linux
+
+package session
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts the browser in a process group of its own, so
+// that killing it also kills its zygote, renderers and crash handler
+// instead of leaving them orphaned.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+}
+
+// killProcessGroup kills a process started with setProcessGroup and all
+// of its descendants.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// killStaleBrowser kills the browser with a PID recorded by an earlier run
+// of the server, with its process group, if the process still is a browser
+// using profileDir rather than an unrelated process that got the PID.
+func killStaleBrowser(pid int, profileDir string) bool {
+	cmdline, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil || !bytes.Contains(cmdline, []byte("--user-data-dir="+profileDir+"\x00")) {
+		return false
+	}
+	// Browsers started before process groups were used are not leaders
+	// of one.
+	if syscall.Kill(-pid, syscall.SIGKILL) != nil {
+		return syscall.Kill(pid, syscall.SIGKILL) == nil
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package session
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error { return cmd.Process.Kill() }
+
+func killStaleBrowser(pid int, profileDir string) bool { return false }
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"errors"
+	"sync"
+
+	"browser-server/tunnel"
+)
+
+// ErrNoProxyPool is returned by CreateSession for sessions asking for a
+// rotated proxy when the manager has no proxy pool.
+var ErrNoProxyPool = errors.New("no proxy pool is configured")
+
+// ProxyPool hands out upstream proxies to sessions in turn, spreading them
+// across the proxies.
+type ProxyPool struct {
+	mu      sync.Mutex
+	proxies []tunnel.Upstream
+	next    int
+	// uses counts the sessions each proxy was handed to.
+	uses []int64
+}
+
+// ProxyStats reports how often a pool's proxy was handed out.
+type ProxyStats struct {
+	// Proxy is the proxy's URL without its password.
+	Proxy    string `json:"proxy"`
+	Sessions int64  `json:"sessions"`
+}
+
+// NewProxyPool returns a pool rotating through proxies.
+func NewProxyPool(proxies []tunnel.Upstream) (*ProxyPool, error) {
+	if len(proxies) == 0 {
+		return nil, errors.New("the proxy pool needs at least one proxy")
+	}
+	return &ProxyPool{proxies: proxies, uses: make([]int64, len(proxies))}, nil
+}
+
+// Next returns the proxy whose turn it is.
+func (p *ProxyPool) Next() tunnel.Upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.next
+	p.next = (p.next + 1) % len(p.proxies)
+	p.uses[i]++
+	return p.proxies[i]
+}
+
+// Stats lists the pool's proxies in order with their use counts.
+func (p *ProxyPool) Stats() []ProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]ProxyStats, len(p.proxies))
+	for i, u := range p.proxies {
+		out[i] = ProxyStats{Proxy: u.String(), Sessions: p.uses[i]}
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+package session
+
+import (
+	"testing"
+
+	"browser-server/tunnel"
+)
+
+func TestProxyPool(t *testing.T) {
+	m := NewManager()
+	if _, err := m.launchOptions(Options{RotateProxy: true}); err != ErrNoProxyPool {
+		t.Errorf("launchOptions without a pool = %v", err)
+	}
+
+	a, _ := tunnel.ParseUpstream("http://user:secret@a:8080")
+	b, _ := tunnel.ParseUpstream("socks5://b:1080")
+	pool, err := NewProxyPool([]tunnel.Upstream{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetProxyPool(pool)
+	var got []string
+	for range 3 {
+		opts, err := m.launchOptions(Options{RotateProxy: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, proxyName(opts.Proxy))
+	}
+	if got[0] != "http://user@a:8080" || got[1] != "socks5://b:1080" || got[2] != got[0] {
+		t.Errorf("proxies handed out = %q", got)
+	}
+	if opts, _ := m.launchOptions(Options{}); opts.Proxy != nil {
+		t.Error("proxy set for a session not asking for one")
+	}
+	if st := pool.Stats(); st[0].Sessions != 2 || st[1].Sessions != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
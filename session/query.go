@@ -0,0 +1,158 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+)
+
+// MaxQueryMatches is how many matches Query describes; the rest are only
+// counted.
+const MaxQueryMatches = 20
+
+// Query is what to look for with Session.Query: either a CSS selector or
+// an XPath expression.
+type Query struct {
+	Selector string `json:"selector,omitempty"`
+	XPath    string `json:"xpath,omitempty"`
+	// Screenshots asks for a PNG of each match in the viewport.
+	Screenshots bool `json:"-"`
+}
+
+// QueryMatch is a node matched by a query.
+type QueryMatch struct {
+	// Tag is the element's tag name, or the node name of other nodes an
+	// XPath matches, such as "#text".
+	Tag        string            `json:"tag"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Text is the start of the node's rendered text.
+	Text string `json:"text,omitempty"`
+	// X, Y, Width and Height are the element's border box in CSS pixels
+	// of the viewport, zero for nodes that are not rendered.
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	// Screenshot is a PNG of the part of the element in the viewport,
+	// redacted and watermarked like any other screenshot of the session.
+	Screenshot []byte `json:"screenshot,omitempty"`
+}
+
+// QueryResult is what a query matched.
+type QueryResult struct {
+	// Count is how many nodes match; Matches describes the first
+	// MaxQueryMatches of them in document order.
+	Count   int          `json:"count"`
+	Matches []QueryMatch `json:"matches"`
+}
+
+// queryScript finds the nodes matching a selector or XPath and describes
+// the first max of them. Errors parsing either are returned, not thrown.
+const queryScript = `(() => {
+	const selector = %s, xpath = %s, max = %d;
+	let nodes = [];
+	try {
+		if (xpath) {
+			const r = document.evaluate(xpath, document, null, XPathResult.ORDERED_NODE_SNAPSHOT_TYPE, null);
+			for (let i = 0; i < r.snapshotLength; i++) nodes.push(r.snapshotItem(i));
+		} else {
+			nodes = Array.from(document.querySelectorAll(selector));
+		}
+	} catch (e) {
+		return {error: e.message};
+	}
+	return {
+		count: nodes.length,
+		viewportWidth: innerWidth,
+		matches: nodes.slice(0, max).map(n => {
+			if (n.nodeType !== Node.ELEMENT_NODE) {
+				return {tag: n.nodeName.toLowerCase(), text: (n.textContent || '').trim().slice(0, 200)};
+			}
+			const attributes = {};
+			for (const a of n.attributes) attributes[a.name] = a.value;
+			const r = n.getBoundingClientRect();
+			return {
+				tag: n.localName, attributes,
+				text: (n.innerText ?? n.textContent ?? '').trim().slice(0, 200),
+				x: r.x, y: r.y, width: r.width, height: r.height,
+			};
+		}),
+	};
+})()`
+
+// Query finds the nodes in the session's first page matching q's CSS
+// selector or XPath, with their attributes, boxes and, if asked, a
+// screenshot of each, so that selectors can be tried out without DevTools.
+// The page is not changed or scrolled: matches outside the viewport have
+// no screenshot.
+func (s *Session) Query(ctx context.Context, q Query) (QueryResult, error) {
+	if (q.Selector == "") == (q.XPath == "") {
+		return QueryResult{}, fmt.Errorf("one of selector or xpath is required")
+	}
+	selector, _ := json.Marshal(q.Selector)
+	xpath, _ := json.Marshal(q.XPath)
+	v, err := s.Evaluate(ctx, fmt.Sprintf(queryScript, selector, xpath, MaxQueryMatches))
+	if err != nil {
+		return QueryResult{}, err
+	}
+	var r struct {
+		QueryResult
+		ViewportWidth float64 `json:"viewportWidth"`
+		Error         string  `json:"error"`
+	}
+	if err := json.Unmarshal(v, &r); err != nil {
+		return QueryResult{}, err
+	}
+	if r.Error != "" {
+		return QueryResult{}, fmt.Errorf("%w: %s", ErrInvalidSelector, r.Error)
+	}
+	if r.Matches == nil {
+		r.Matches = []QueryMatch{}
+	}
+	if !q.Screenshots || r.Count == 0 {
+		return r.QueryResult, nil
+	}
+	shot, err := s.Screenshot(ctx)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	if err := cropMatches(shot, r.ViewportWidth, r.Matches); err != nil {
+		return QueryResult{}, err
+	}
+	return r.QueryResult, nil
+}
+
+// cropMatches cuts the screenshot of each match out of a PNG of a
+// viewport cssWidth CSS pixels wide.
+func cropMatches(data []byte, cssWidth float64, matches []QueryMatch) error {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok || cssWidth <= 0 {
+		return fmt.Errorf("cannot crop a %T screenshot", img)
+	}
+	scale := float64(img.Bounds().Dx()) / cssWidth
+	for i := range matches {
+		m := &matches[i]
+		rect := image.Rect(
+			int(m.X*scale), int(m.Y*scale),
+			int((m.X+m.Width)*scale+0.5), int((m.Y+m.Height)*scale+0.5),
+		).Intersect(img.Bounds())
+		if rect.Empty() {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, sub.SubImage(rect)); err != nil {
+			return err
+		}
+		m.Screenshot = buf.Bytes()
+	}
+	return nil
+}
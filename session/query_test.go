@@ -0,0 +1,42 @@
+package session
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestCropMatches(t *testing.T) {
+	// A 400x300 screenshot of a viewport 200 CSS pixels wide.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 300))); err != nil {
+		t.Fatal(err)
+	}
+	matches := []QueryMatch{
+		{Tag: "a", X: 10, Y: 20, Width: 50, Height: 25},
+		// Partly off the right edge.
+		{Tag: "div", X: 180, Y: 0, Width: 100, Height: 10},
+		// Below the viewport.
+		{Tag: "footer", X: 0, Y: 500, Width: 200, Height: 40},
+		{Tag: "#text"},
+	}
+	if err := cropMatches(buf.Bytes(), 200, matches); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []image.Point{{100, 50}, {40, 20}, {}, {}} {
+		if want == (image.Point{}) {
+			if matches[i].Screenshot != nil {
+				t.Errorf("%s: screenshot of a match outside the viewport", matches[i].Tag)
+			}
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(matches[i].Screenshot))
+		if err != nil {
+			t.Fatalf("%s: %v", matches[i].Tag, err)
+		}
+		if got := img.Bounds().Size(); got != want {
+			t.Errorf("%s: screenshot is %v, want %v", matches[i].Tag, got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/recording"
+)
+
+// TimelineEntry is a notable moment in a session's life.
+type TimelineEntry struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// addTimeline appends an entry to the session timeline.
+func (s *Session) addTimeline(kind, detail string) {
+	s.timelineMu.Lock()
+	defer s.timelineMu.Unlock()
+	s.timeline = append(s.timeline, TimelineEntry{Time: time.Now(), Kind: kind, Detail: detail})
+}
+
+// Timeline returns a copy of the session timeline.
+func (s *Session) Timeline() []TimelineEntry {
+	s.timelineMu.Lock()
+	defer s.timelineMu.Unlock()
+	return append([]TimelineEntry(nil), s.timeline...)
+}
+
+// ArtifactDir returns the directory holding the session's collected
+// artifacts, or "" if there are none. Sessions that did not collect
+// artifacts still have the browser logs of a crash.
+func (s *Session) ArtifactDir() string {
+	if s.recorder == nil {
+		return s.crashArtifactDir
+	}
+	return s.recorder.dir
+}
+
+// recorder writes a session's console log, network HAR and downloads into
+// an artifact directory.
+type recorder struct {
+	dir string
+
+	mu       sync.Mutex
+	console  *os.File
+	requests map[string]*harEntry
+	order    []*harEntry
+}
+
+func newRecorder(dir string) (*recorder, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "downloads"), 0755); err != nil {
+		return nil, err
+	}
+	console, err := os.Create(filepath.Join(dir, "console.log"))
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{dir: dir, console: console, requests: make(map[string]*harEntry)}, nil
+}
+
+func (r *recorder) downloadsDir() string {
+	return filepath.Join(r.dir, "downloads")
+}
+
+// handleEvent records the CDP events relevant to the artifacts.
+func (r *recorder) handleEvent(method string, params json.RawMessage) {
+	switch method {
+	case "Runtime.consoleAPICalled":
+		var p struct {
+			Type string `json:"type"`
+			Args []struct {
+				Value       interface{} `json:"value"`
+				Description string      `json:"description"`
+			} `json:"args"`
+		}
+		if json.Unmarshal(params, &p) != nil {
+			return
+		}
+		parts := make([]string, 0, len(p.Args))
+		for _, a := range p.Args {
+			if a.Value != nil {
+				parts = append(parts, fmt.Sprint(a.Value))
+			} else {
+				parts = append(parts, a.Description)
+			}
+		}
+		r.logConsole(p.Type, strings.Join(parts, " "))
+
+	case "Log.entryAdded":
+		var p struct {
+			Entry struct {
+				Level string `json:"level"`
+				Text  string `json:"text"`
+				URL   string `json:"url"`
+			} `json:"entry"`
+		}
+		if json.Unmarshal(params, &p) == nil {
+			r.logConsole(p.Entry.Level, strings.TrimSpace(p.Entry.Text+" "+p.Entry.URL))
+		}
+
+	case "Network.requestWillBeSent", "Network.responseReceived", "Network.loadingFinished", "Network.loadingFailed":
+		r.handleNetwork(method, params)
+	}
+}
+
+func (r *recorder) logConsole(level, text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.console != nil {
+		fmt.Fprintf(r.console, "%s [%s] %s\n", time.Now().UTC().Format(time.RFC3339Nano), level, text)
+	}
+}
+
+// finish writes the HAR, with the response bodies body returns,
+// timeline, recorded interactions and screenshot and closes the console
+// log.
+func (r *recorder) finish(timeline []TimelineEntry, steps []recording.Step, screenshot []byte, body func(requestID string) []byte) error {
+	r.mu.Lock()
+	if r.console != nil {
+		r.console.Close()
+		r.console = nil
+	}
+	har := r.har(body)
+	r.mu.Unlock()
+
+	if err := writeJSONFile(filepath.Join(r.dir, "network.har"), har); err != nil {
+		return err
+	}
+	if err := writeJSONFile(filepath.Join(r.dir, "timeline.json"), timeline); err != nil {
+		return err
+	}
+	if len(steps) > 0 {
+		if err := writeJSONFile(filepath.Join(r.dir, "recording.json"), recording.Job{Version: 1, Steps: steps}); err != nil {
+			return err
+		}
+	}
+	if len(screenshot) > 0 {
+		if err := os.MkdirAll(filepath.Join(r.dir, "screenshots"), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(r.dir, "screenshots", "final.png"), screenshot, 0644)
+	}
+	return nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,242 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"browser-server/internal/cdp"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Redaction modes: how redacted areas are hidden.
+const (
+	// RedactBlur pixelates redacted areas beyond legibility.
+	RedactBlur = "blur"
+	// RedactBlack fills redacted areas with black.
+	RedactBlack = "black"
+)
+
+const (
+	redactBinding   = "__browserLabRedact"
+	maxRedactRules  = 100
+	maxSelectorSize = 500
+	// redactBlock is the size in pixels of the blocks blurred areas are
+	// reduced to.
+	redactBlock = 16
+)
+
+// RedactRegion is an area of the viewport, in CSS pixels.
+type RedactRegion struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Redaction hides parts of a session's pages from its screencast and
+// screenshots, e.g. fields with customer data while support staff watch.
+type Redaction struct {
+	// Selectors are CSS selectors of elements to hide in the top-level
+	// document.
+	Selectors []string `json:"selectors,omitempty"`
+	// Regions are fixed areas of the viewport to hide.
+	Regions []RedactRegion `json:"regions,omitempty"`
+	// Mode is RedactBlur (the default) or RedactBlack.
+	Mode string `json:"mode,omitempty"`
+}
+
+// Validate checks a redaction.
+func (r *Redaction) Validate() error {
+	if len(r.Selectors)+len(r.Regions) == 0 {
+		return errors.New("redaction needs selectors or regions")
+	}
+	if len(r.Selectors)+len(r.Regions) > maxRedactRules {
+		return fmt.Errorf("more than %d redaction rules", maxRedactRules)
+	}
+	for _, sel := range r.Selectors {
+		if sel == "" || len(sel) > maxSelectorSize {
+			return fmt.Errorf("redaction selectors must be 1 to %d bytes", maxSelectorSize)
+		}
+	}
+	for _, reg := range r.Regions {
+		if reg.X < 0 || reg.Y < 0 || reg.Width <= 0 || reg.Height <= 0 {
+			return fmt.Errorf("invalid redaction region %+v", reg)
+		}
+	}
+	switch r.Mode {
+	case "", RedactBlur, RedactBlack:
+		return nil
+	}
+	return fmt.Errorf("invalid redaction mode %q, use %q or %q", r.Mode, RedactBlur, RedactBlack)
+}
+
+// Merge returns the rules of r and other together, hiding areas the
+// stricter way if their modes differ. Either may be nil.
+func (r *Redaction) Merge(other *Redaction) *Redaction {
+	if r == nil {
+		return other
+	}
+	if other == nil {
+		return r
+	}
+	m := &Redaction{
+		Selectors: append(append([]string{}, r.Selectors...), other.Selectors...),
+		Regions:   append(append([]RedactRegion{}, r.Regions...), other.Regions...),
+		Mode:      r.Mode,
+	}
+	if other.Mode == RedactBlack {
+		m.Mode = RedactBlack
+	}
+	return m
+}
+
+// redactReport is what the redaction script reports: the viewport size
+// and the areas matching the selectors, in CSS pixels.
+type redactReport struct {
+	Width  float64      `json:"width"`
+	Height float64      `json:"height"`
+	Rects  [][4]float64 `json:"rects"`
+}
+
+// redactor tracks where each page's redacted areas are. A page that has
+// not reported them since it last navigated is hidden entirely, so that
+// nothing shows before its script has run.
+type redactor struct {
+	rules *Redaction
+
+	mu      sync.Mutex
+	reports map[string]redactReport // by CDP session ID of the page
+}
+
+func newRedactor(rules *Redaction) *redactor {
+	if rules == nil {
+		return nil
+	}
+	return &redactor{rules: rules, reports: make(map[string]redactReport)}
+}
+
+// redactScript reports the viewport and the areas of the elements matching
+// selectors whenever the page changes, scrolls or resizes, and at least
+// every 250ms for animations.
+func redactScript(selectors []string) string {
+	encoded, _ := json.Marshal(selectors)
+	return fmt.Sprintf(`(() => {
+	if (window !== window.top || window.__browserLabRedacting) return;
+	window.__browserLabRedacting = true;
+	const selectors = %s, send = window[%q];
+	let last = "";
+	const report = () => {
+		const rects = [];
+		for (const sel of selectors) {
+			let els = [];
+			try { els = document.querySelectorAll(sel); } catch (e) {}
+			for (const el of els) {
+				for (const r of el.getClientRects()) {
+					if (r.width > 0 && r.height > 0) rects.push([r.left, r.top, r.width, r.height]);
+				}
+			}
+		}
+		const msg = JSON.stringify({width: innerWidth, height: innerHeight, rects});
+		if (msg !== last && typeof send === "function") {
+			last = msg;
+			send(msg);
+		}
+	};
+	let pending = false;
+	const schedule = () => {
+		if (pending) return;
+		pending = true;
+		requestAnimationFrame(() => { pending = false; report(); });
+	};
+	new MutationObserver(schedule).observe(document, {childList: true, subtree: true, attributes: true, characterData: true});
+	addEventListener("scroll", schedule, true);
+	addEventListener("resize", schedule);
+	setInterval(report, 250);
+	report();
+})()`, encoded, redactBinding)
+}
+
+// enableRedaction installs the redaction script in a page.
+func enableRedaction(ctx context.Context, page *cdp.Session, rules *Redaction) error {
+	if err := (cdp.Runtime{Caller: page}).Enable(ctx); err != nil {
+		return err
+	}
+	if err := (cdp.Runtime{Caller: page}).AddBinding(ctx, redactBinding); err != nil {
+		return err
+	}
+	script := redactScript(rules.Selectors)
+	return installScript(ctx, page, script)
+}
+
+// handleRedactBinding records where a page's redacted areas are.
+func (s *Session) handleRedactBinding(msg cdp.Message) {
+	var e cdp.BindingCalled
+	if s.redactor == nil || msg.Decode(&e) != nil || e.Name != redactBinding {
+		return
+	}
+	var report redactReport
+	if json.Unmarshal([]byte(e.Payload), &report) != nil {
+		return
+	}
+	s.redactor.mu.Lock()
+	defer s.redactor.mu.Unlock()
+	s.redactor.reports[msg.SessionID] = report
+}
+
+// forget drops what a page reported, when its document is replaced or
+// it goes away.
+func (r *redactor) forget(pageID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.reports, pageID)
+}
+
+// draw hides the redacted areas of an image of a page, or all of it if the
+// page has not reported its areas yet.
+func (r *redactor) draw(img draw.Image, pageID string) {
+	r.mu.Lock()
+	report, ok := r.reports[pageID]
+	r.mu.Unlock()
+
+	b := img.Bounds()
+	if !ok || report.Width <= 0 || report.Height <= 0 {
+		draw.Draw(img, b, image.Black, image.Point{}, draw.Src)
+		return
+	}
+	sx := float64(b.Dx()) / report.Width
+	sy := float64(b.Dy()) / report.Height
+	area := func(x, y, w, h float64) image.Rectangle {
+		return image.Rect(
+			b.Min.X+int(x*sx), b.Min.Y+int(y*sy),
+			b.Min.X+int((x+w)*sx+1), b.Min.Y+int((y+h)*sy+1),
+		).Intersect(b)
+	}
+	for _, reg := range r.rules.Regions {
+		r.hide(img, area(reg.X, reg.Y, reg.Width, reg.Height))
+	}
+	for _, rect := range report.Rects {
+		r.hide(img, area(rect[0], rect[1], rect[2], rect[3]))
+	}
+}
+
+// hide blacks out or blurs one area of an image.
+func (r *redactor) hide(img draw.Image, area image.Rectangle) {
+	if area.Empty() {
+		return
+	}
+	if r.rules.Mode == RedactBlack {
+		draw.Draw(img, area, image.NewUniform(color.Black), image.Point{}, draw.Src)
+		return
+	}
+	// Reduce the area to a few blocks and scale them back up.
+	small := image.NewRGBA(image.Rect(0, 0, max(1, area.Dx()/redactBlock), max(1, area.Dy()/redactBlock)))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, area, draw.Src, nil)
+	xdraw.ApproxBiLinear.Scale(img, area, small, small.Bounds(), draw.Src, nil)
+}
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestRedactionValidate(t *testing.T) {
+	for _, r := range []Redaction{
+		{},
+		{Selectors: []string{""}},
+		{Regions: []RedactRegion{{Width: 10}}},
+		{Selectors: []string{"#card"}, Mode: "smudge"},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("%+v accepted", r)
+		}
+	}
+	r := &Redaction{Selectors: []string{"#card"}, Regions: []RedactRegion{{X: 0, Y: 0, Width: 100, Height: 20}}}
+	if err := r.Validate(); err != nil {
+		t.Error(err)
+	}
+	m := r.Merge(&Redaction{Selectors: []string{".ssn"}, Mode: RedactBlack})
+	if len(m.Selectors) != 2 || len(m.Regions) != 1 || m.Mode != RedactBlack {
+		t.Errorf("merged = %+v", m)
+	}
+	if (*Redaction)(nil).Merge(r) != r {
+		t.Error("merge with nil changed the rules")
+	}
+
+	script := redactScript([]string{`input[name="card"]`})
+	if !strings.Contains(script, `["input[name=\"card\"]"]`) || strings.Contains(script, "%!") {
+		t.Errorf("bad redaction script: %s", script)
+	}
+}
+
+func TestRedactorDraw(t *testing.T) {
+	white := func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		return img
+	}
+	dark := func(img *image.RGBA, x, y int) bool {
+		r, _, _, _ := img.At(x, y).RGBA()
+		return r < 0x8000
+	}
+
+	r := newRedactor(&Redaction{Selectors: []string{"#card"}, Regions: []RedactRegion{{X: 0, Y: 0, Width: 10, Height: 10}}, Mode: RedactBlack})
+	img := white()
+	r.draw(img, "page")
+	if !dark(img, 150, 80) {
+		t.Error("page that has not reported was not hidden")
+	}
+
+	// The viewport is half the image's size.
+	r.reports["page"] = redactReport{Width: 100, Height: 50, Rects: [][4]float64{{50, 20, 10, 5}}}
+	img = white()
+	r.draw(img, "page")
+	for _, p := range []image.Point{{5, 5}, {15, 15}, {105, 45}, {115, 45}} {
+		if !dark(img, p.X, p.Y) {
+			t.Errorf("%v not hidden", p)
+		}
+	}
+	for _, p := range []image.Point{{30, 30}, {150, 80}, {125, 45}} {
+		if dark(img, p.X, p.Y) {
+			t.Errorf("%v hidden", p)
+		}
+	}
+
+	r.forget("page")
+	img = white()
+	r.draw(img, "page")
+	if !dark(img, 150, 80) {
+		t.Error("page that navigated was not hidden")
+	}
+
+	// Blurring stripes leaves neither pure black nor pure white.
+	r = newRedactor(&Redaction{Regions: []RedactRegion{{X: 0, Y: 0, Width: 100, Height: 50}}})
+	r.reports["page"] = redactReport{Width: 200, Height: 100}
+	img = white()
+	for x := 0; x < 200; x += 2 {
+		draw.Draw(img, image.Rect(x, 0, x+1, 100), image.Black, image.Point{}, draw.Src)
+	}
+	r.draw(img, "page")
+	if g, _, _, _ := img.At(40, 20).RGBA(); g < 0x2000 || g > 0xe000 {
+		t.Errorf("blurred pixel is %#x", g)
+	}
+}
@@ -0,0 +1,156 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"browser-server/internal/cdp"
+	"browser-server/recording"
+)
+
+// stepPollInterval is how often a replayed step checks for its element or
+// assertion.
+const stepPollInterval = 100 * time.Millisecond
+
+// replayKeys describes the keys a press step may send.
+var replayKeys = map[string]cdp.KeyEvent{
+	"Enter":  {Key: "Enter", Code: "Enter", Text: "\r", WindowsVirtualKeyCode: 13},
+	"Tab":    {Key: "Tab", Code: "Tab", WindowsVirtualKeyCode: 9},
+	"Escape": {Key: "Escape", Code: "Escape", WindowsVirtualKeyCode: 27},
+}
+
+// RunStep performs a recorded step in the session's first page. Steps
+// that need an element wait for it until ctx is done. A page that does
+// not match the step yields a *recording.Divergence.
+func (s *Session) RunStep(ctx context.Context, step recording.Step) error {
+	s.MarkRunning()
+	if step.Action == recording.ActionNavigate {
+		err := s.Navigate(step.URL)
+		if err != nil && strings.HasPrefix(err.Error(), "navigation failed") {
+			return &recording.Divergence{Reason: err.Error()}
+		}
+		return err
+	}
+
+	page, err := s.firstPage()
+	if err != nil {
+		return err
+	}
+
+	sel, _ := json.Marshal(step.Selector)
+	var expr string
+	switch step.Action {
+	case recording.ActionClick:
+		expr = fmt.Sprintf(`(() => {
+			const el = document.querySelector(%s);
+			if (!el) return false;
+			el.scrollIntoView({block: "center"});
+			el.click();
+			return true;
+		})()`, sel)
+	case recording.ActionFill:
+		value, _ := json.Marshal(step.Value)
+		expr = fmt.Sprintf(`(() => {
+			const el = document.querySelector(%s);
+			if (!el) return false;
+			el.focus();
+			el.value = %s;
+			el.dispatchEvent(new Event("input", {bubbles: true}));
+			el.dispatchEvent(new Event("change", {bubbles: true}));
+			return true;
+		})()`, sel, value)
+	case recording.ActionPress:
+		if _, ok := replayKeys[step.Key]; !ok {
+			return fmt.Errorf("unsupported key %q", step.Key)
+		}
+		expr = fmt.Sprintf(`(() => {
+			const el = document.querySelector(%s);
+			if (!el) return false;
+			el.focus();
+			return true;
+		})()`, sel)
+	case recording.ActionAssert:
+		expr = recording.AssertExpression(step)
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+
+	if err := pollTrue(ctx, page, expr); err != nil {
+		if ctx.Err() != nil {
+			return &recording.Divergence{Reason: divergenceReason(page, step)}
+		}
+		return err
+	}
+
+	if step.Action == recording.ActionPress {
+		input := cdp.Input{Caller: page}
+		key := replayKeys[step.Key]
+		for _, typ := range []string{"keyDown", "keyUp"} {
+			e := key
+			e.Type = typ
+			if typ == "keyUp" {
+				e.Text = ""
+			}
+			if err := input.DispatchKeyEvent(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pollTrue evaluates expr until it returns true or ctx is done. Errors
+// from a page that is navigating away are retried.
+func pollTrue(ctx context.Context, page *cdp.Session, expr string) error {
+	rt := cdp.Runtime{Caller: page}
+	for {
+		res, err := rt.Evaluate(ctx, expr)
+		if err == nil {
+			var v struct {
+				Value bool `json:"value"`
+			}
+			if json.Unmarshal(res, &v) == nil && v.Value {
+				return nil
+			}
+		} else if errors.Is(err, cdp.ErrClosed) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(stepPollInterval):
+		}
+	}
+}
+
+// divergenceReason describes how the page differs from what a step
+// expected.
+func divergenceReason(page *cdp.Session, step recording.Step) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if step.Action == recording.ActionAssert && step.Selector == "" {
+		res, err := cdp.Runtime{Caller: page}.Evaluate(ctx, "location.href")
+		var v struct {
+			Value string `json:"value"`
+		}
+		if err == nil && json.Unmarshal(res, &v) == nil {
+			return fmt.Sprintf("page is at %s, expected %s", v.Value, step.URL)
+		}
+		return "page URL does not start with " + step.URL
+	}
+	if step.Action == recording.ActionAssert {
+		sel, _ := json.Marshal(step.Selector)
+		res, err := cdp.Runtime{Caller: page}.Evaluate(ctx, fmt.Sprintf("document.querySelector(%s)?.textContent ?? null", sel))
+		var v struct {
+			Value *string `json:"value"`
+		}
+		if err == nil && json.Unmarshal(res, &v) == nil && v.Value != nil {
+			return fmt.Sprintf("%s does not contain %q", step.Selector, step.Text)
+		}
+	}
+	return "no element matches " + step.Selector
+}
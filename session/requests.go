@@ -0,0 +1,132 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"browser-server/internal/cdp"
+	"browser-server/internal/wildcard"
+)
+
+// ErrNoBody is returned when neither the session nor the browser has the
+// body of a response any more.
+var ErrNoBody = errors.New("response body is not available")
+
+// NetworkRequest is a request made by a session's pages, as recorded for
+// its HAR. Each hop of a redirect is a request of its own, sharing the
+// request ID.
+type NetworkRequest struct {
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS float64   `json:"duration_ms"`
+	// Status is zero until a response is received, and for requests that
+	// failed with Error.
+	Status     int    `json:"status"`
+	StatusText string `json:"status_text,omitempty"`
+	MimeType   string `json:"mime_type,omitempty"`
+	// Size is the number of bytes received, encoded.
+	Size            int64             `json:"size"`
+	Error           string            `json:"error,omitempty"`
+	Pending         bool              `json:"pending,omitempty"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+}
+
+// RequestFilter selects requests; zero fields match everything.
+type RequestFilter struct {
+	// URL is a substring of the URL, or a pattern matching all of it with
+	// the wildcards * and ?.
+	URL    string
+	Method string
+	// Status is an exact status code, StatusClass the hundreds of one (4
+	// for 4xx), and Failed selects requests that got no response.
+	Status      int
+	StatusClass int
+	Failed      bool
+	// MimeType is a prefix of the MIME type, such as "image/".
+	MimeType string
+}
+
+// Match reports whether a request passes the filter.
+func (f RequestFilter) Match(r NetworkRequest) bool {
+	if f.URL != "" {
+		if strings.ContainsAny(f.URL, "*?") {
+			if !wildcard.Match(f.URL, r.URL) {
+				return false
+			}
+		} else if !strings.Contains(r.URL, f.URL) {
+			return false
+		}
+	}
+	if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+		return false
+	}
+	if f.Status != 0 && r.Status != f.Status {
+		return false
+	}
+	if f.StatusClass != 0 && r.Status/100 != f.StatusClass {
+		return false
+	}
+	if f.Failed && r.Error == "" {
+		return false
+	}
+	return f.MimeType == "" || strings.HasPrefix(strings.ToLower(r.MimeType), strings.ToLower(f.MimeType))
+}
+
+// NetworkRequests returns the requests the session's pages made, oldest
+// first, or false if the session does not record them because it collects
+// no artifacts.
+func (s *Session) NetworkRequests() ([]NetworkRequest, bool) {
+	r := s.recorder
+	if r == nil {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]NetworkRequest, len(r.order))
+	for i, e := range r.order {
+		out[i] = NetworkRequest{
+			RequestID:       e.requestID,
+			Method:          e.method,
+			URL:             e.url,
+			StartedAt:       e.started,
+			Status:          e.status,
+			StatusText:      e.statusText,
+			MimeType:        e.mimeType,
+			Size:            e.size,
+			Error:           e.failed,
+			Pending:         e.monoEnd == 0,
+			RequestHeaders:  e.reqHeaders,
+			ResponseHeaders: e.resHeaders,
+		}
+		if e.monoEnd > e.monoStart {
+			out[i].DurationMS = (e.monoEnd - e.monoStart) * 1000
+		}
+	}
+	return out, true
+}
+
+// ResponseBody returns the body of a request's response: the captured one
+// if its URL matched the response body patterns, otherwise whatever the
+// browser still holds, which may be nothing once the page has navigated
+// away or evicted it.
+func (s *Session) ResponseBody(ctx context.Context, requestID string) ([]byte, error) {
+	if _, data, ok := s.CapturedBody(requestID); ok {
+		return data, nil
+	}
+	m := s.mon.Load()
+	if m == nil {
+		return nil, ErrNoBody
+	}
+	// Events do not say which page made a request, so ask them all.
+	for _, page := range append(m.pages(), m.iframes()...) {
+		if data, err := (cdp.Network{Caller: page}).GetResponseBody(ctx, requestID); err == nil {
+			return data, nil
+		}
+	}
+	return nil, ErrNoBody
+}
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNetworkRequests(t *testing.T) {
+	s := &Session{}
+	if _, ok := s.NetworkRequests(); ok {
+		t.Fatal("session without artifacts lists requests")
+	}
+	s.recorder = &recorder{requests: make(map[string]*harEntry)}
+	for _, ev := range []struct{ method, params string }{
+		{"Network.requestWillBeSent", `{"requestId":"1","request":{"url":"https://shop.example.com/api/cart","method":"POST"},"wallTime":1700000000,"timestamp":10}`},
+		{"Network.responseReceived", `{"requestId":"1","response":{"status":409,"mimeType":"application/json"}}`},
+		{"Network.loadingFinished", `{"requestId":"1","timestamp":10.25,"encodedDataLength":311}`},
+		{"Network.requestWillBeSent", `{"requestId":"2","request":{"url":"https://cdn.example.com/logo.png","method":"GET"},"wallTime":1700000001,"timestamp":11}`},
+		{"Network.loadingFailed", `{"requestId":"2","timestamp":11.5,"errorText":"net::ERR_BLOCKED_BY_CLIENT"}`},
+		{"Network.requestWillBeSent", `{"requestId":"3","request":{"url":"https://shop.example.com/","method":"GET"},"wallTime":1700000002,"timestamp":12}`},
+	} {
+		s.recorder.handleEvent(ev.method, json.RawMessage(ev.params))
+	}
+
+	requests, ok := s.NetworkRequests()
+	if !ok || len(requests) != 3 {
+		t.Fatalf("NetworkRequests = %d requests, %v", len(requests), ok)
+	}
+	if r := requests[0]; r.RequestID != "1" || r.Status != 409 || r.Size != 311 || r.DurationMS != 250 || r.Pending {
+		t.Errorf("first request = %+v", r)
+	}
+	if !requests[2].Pending {
+		t.Error("request in flight is not pending")
+	}
+
+	for _, tc := range []struct {
+		filter RequestFilter
+		want   []string
+	}{
+		{RequestFilter{}, []string{"1", "2", "3"}},
+		{RequestFilter{URL: "/api/"}, []string{"1"}},
+		{RequestFilter{URL: "https://*.example.com/*.png"}, []string{"2"}},
+		{RequestFilter{StatusClass: 4}, []string{"1"}},
+		{RequestFilter{Status: 200}, nil},
+		{RequestFilter{Failed: true}, []string{"2"}},
+		{RequestFilter{MimeType: "Application/"}, []string{"1"}},
+		{RequestFilter{Method: "get", URL: "shop"}, []string{"3"}},
+	} {
+		var got []string
+		for _, r := range requests {
+			if tc.filter.Match(r) {
+				got = append(got, r.RequestID)
+			}
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Errorf("%+v matched %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
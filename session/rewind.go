@@ -0,0 +1,89 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rewindBuffer keeps the screencast frames of the last window.
+type rewindBuffer struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	frames []Frame
+}
+
+func (b *rewindBuffer) add(f Frame) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.frames = append(b.frames, f)
+	cutoff := f.Time.Add(-b.window)
+	i := 0
+	for i < len(b.frames) && b.frames[i].Time.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		// Copy down so the backing array does not grow forever.
+		b.frames = append(b.frames[:0], b.frames[i:]...)
+	}
+}
+
+// since returns the frames taken at or after t, oldest first.
+func (b *rewindBuffer) since(t time.Time) []Frame {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := len(b.frames)
+	for i > 0 && !b.frames[i-1].Time.Before(t) {
+		i--
+	}
+	return append([]Frame(nil), b.frames[i:]...)
+}
+
+// RewindWindow returns how much screencast history the session keeps, or
+// zero if it keeps none.
+func (s *Session) RewindWindow() time.Duration {
+	if s.rewind == nil {
+		return 0
+	}
+	return s.rewind.window
+}
+
+// Rewind returns the frames of the last d, oldest first.
+func (s *Session) Rewind(d time.Duration) []Frame {
+	if s.rewind == nil {
+		return nil
+	}
+	return s.rewind.since(time.Now().Add(-d))
+}
+
+// recordRewind watches the session's screencast into the rewind buffer
+// until ctx is done. The page may not be attached yet, so watching is
+// retried.
+func (s *Session) recordRewind(ctx context.Context) {
+	var v *Viewer
+	for v == nil {
+		var err error
+		if v, err = s.Watch(s.opts.RewindFPS); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	defer v.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f, ok := <-v.C:
+			if !ok {
+				return
+			}
+			s.rewind.add(f)
+		}
+	}
+}
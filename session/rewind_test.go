@@ -0,0 +1,27 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRewindBuffer(t *testing.T) {
+	b := &rewindBuffer{window: 10 * time.Second}
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		b.add(Frame{Seq: uint64(i), Time: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	// Only the last 10 seconds (frames 19 to 29) are kept.
+	if len(b.frames) != 11 || b.frames[0].Seq != 19 {
+		t.Fatalf("kept %d frames starting at %d", len(b.frames), b.frames[0].Seq)
+	}
+
+	clip := b.since(start.Add(27 * time.Second))
+	if len(clip) != 3 || clip[0].Seq != 27 || clip[2].Seq != 29 {
+		t.Errorf("since(27s) = %d frames starting at %d", len(clip), clip[0].Seq)
+	}
+	if clip := b.since(start.Add(time.Minute)); len(clip) != 0 {
+		t.Errorf("since(future) = %d frames", len(clip))
+	}
+}
@@ -0,0 +1,371 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// Frame is one JPEG frame of a session's screencast.
+type Frame struct {
+	Seq      uint64
+	Data     []byte
+	Time     time.Time
+	Viewport Viewport
+}
+
+// Viewport describes the page area a frame shows.
+type Viewport struct {
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+	ScrollX   float64 `json:"scroll_x"`
+	ScrollY   float64 `json:"scroll_y"`
+	PageScale float64 `json:"page_scale"`
+}
+
+// screencastFrame is the Page.screencastFrame event with its metadata.
+type screencastFrame struct {
+	Data      []byte `json:"data"`
+	SessionID int    `json:"sessionId"`
+	Metadata  struct {
+		DeviceWidth     float64 `json:"deviceWidth"`
+		DeviceHeight    float64 `json:"deviceHeight"`
+		PageScaleFactor float64 `json:"pageScaleFactor"`
+		ScrollOffsetX   float64 `json:"scrollOffsetX"`
+		ScrollOffsetY   float64 `json:"scrollOffsetY"`
+		Timestamp       float64 `json:"timestamp"`
+	} `json:"metadata"`
+}
+
+// ScreencastQuality is the JPEG quality of the shared screencast.
+const ScreencastQuality = 80
+
+// screencastOptions are used for the shared screencast. Viewers that want
+// less scale the frames down themselves.
+var screencastOptions = cdp.ScreencastOptions{
+	Format:        "jpeg",
+	Quality:       ScreencastQuality,
+	MaxWidth:      1280,
+	MaxHeight:     720,
+	EveryNthFrame: 1,
+}
+
+// ErrNoPage is returned when a session has no page to show.
+var ErrNoPage = errors.New("session has no open page")
+
+// screencast runs one CDP screencast per session while anyone is watching
+// and fans its frames out to every viewer.
+type screencast struct {
+	s *Session
+
+	mu      sync.Mutex
+	viewers map[*Viewer]struct{}
+	page    *cdp.Session // page being cast, nil when stopped
+	seq     uint64
+	// dropped counts the frames skipped by viewers that have closed, and
+	// skipped those replaced while waiting for the frame scheduler.
+	dropped int
+	skipped int
+
+	// publishMu keeps frames in order between handleFrame and refresh.
+	// last is the newest frame from Chrome, before compositing, which
+	// refresh composites again. Both are guarded by publishMu.
+	publishMu sync.Mutex
+	last      *rawFrame
+}
+
+// rawFrame is a frame as Chrome sent it.
+type rawFrame struct {
+	data     []byte
+	pageID   string
+	viewport Viewport
+}
+
+// Viewer receives frames from a session's shared screencast. A viewer that
+// falls behind skips to the newest frame instead of holding others back.
+type Viewer struct {
+	// C delivers frames. It is closed when the viewer is closed.
+	C <-chan Frame
+
+	c           chan Frame
+	cast        *screencast
+	minInterval time.Duration
+	last        time.Time
+	dropped     int
+}
+
+// Watch subscribes to the session's screencast, starting it if this is the
+// first viewer. maxFPS limits how often frames are delivered; zero means
+// every frame.
+func (s *Session) Watch(maxFPS float64) (*Viewer, error) {
+	c := &s.cast
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.page == nil {
+		if err := c.startLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return c.addViewerLocked(maxFPS), nil
+}
+
+func (c *screencast) addViewerLocked(maxFPS float64) *Viewer {
+	v := &Viewer{c: make(chan Frame, 1), cast: c}
+	v.C = v.c
+	v.setMaxFPSLocked(maxFPS)
+	if c.viewers == nil {
+		c.viewers = make(map[*Viewer]struct{})
+	}
+	c.viewers[v] = struct{}{}
+	return v
+}
+
+// SetMaxFPS changes how often frames are delivered; zero means every frame.
+func (v *Viewer) SetMaxFPS(maxFPS float64) {
+	v.cast.mu.Lock()
+	defer v.cast.mu.Unlock()
+	v.setMaxFPSLocked(maxFPS)
+}
+
+func (v *Viewer) setMaxFPSLocked(maxFPS float64) {
+	v.minInterval = 0
+	if maxFPS > 0 {
+		v.minInterval = time.Duration(float64(time.Second) / maxFPS)
+	}
+}
+
+// Dropped returns how many frames the viewer skipped because it was slow.
+func (v *Viewer) Dropped() int {
+	v.cast.mu.Lock()
+	defer v.cast.mu.Unlock()
+	return v.dropped
+}
+
+// Viewers returns how many viewers are watching the session's screencast.
+func (s *Session) Viewers() int {
+	s.cast.mu.Lock()
+	defer s.cast.mu.Unlock()
+	return len(s.cast.viewers)
+}
+
+// ScreencastStats describes a session's shared screencast.
+type ScreencastStats struct {
+	// Active is whether Chrome is casting a page.
+	Active  bool `json:"active"`
+	Viewers int  `json:"viewers"`
+	// Frames counts the frames sent to viewers since the session started,
+	// and Dropped those viewers skipped because they were slow. Skipped
+	// counts the frames from Chrome replaced by a newer one before the
+	// frame scheduler got to them.
+	Frames  uint64 `json:"frames"`
+	Dropped int    `json:"dropped"`
+	Skipped int    `json:"skipped"`
+}
+
+// ScreencastStats describes the session's shared screencast and how its
+// viewers keep up with it.
+func (s *Session) ScreencastStats() ScreencastStats {
+	c := &s.cast
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := ScreencastStats{Active: c.page != nil, Viewers: len(c.viewers), Frames: c.seq, Dropped: c.dropped, Skipped: c.skipped}
+	for v := range c.viewers {
+		st.Dropped += v.dropped
+	}
+	return st
+}
+
+// Close unsubscribes the viewer, stopping the screencast if it was the last.
+func (v *Viewer) Close() {
+	c := v.cast
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.viewers[v]; !ok {
+		return
+	}
+	delete(c.viewers, v)
+	c.dropped += v.dropped
+	close(v.c)
+	if len(c.viewers) == 0 && c.page != nil {
+		c.page.Send("Page.stopScreencast", nil)
+		c.page = nil
+	}
+}
+
+// startLocked starts casting the session's first page.
+func (c *screencast) startLocked() error {
+	m := c.s.mon.Load()
+	if m == nil {
+		return errors.New("page control unavailable")
+	}
+	pages := m.pages()
+	if len(pages) == 0 {
+		return ErrNoPage
+	}
+	ctx, cancel := context.WithTimeout(c.s.ctx, 5*time.Second)
+	defer cancel()
+	if err := (cdp.Page{Caller: pages[0]}).StartScreencast(ctx, screencastOptions); err != nil {
+		return err
+	}
+	c.page = pages[0]
+	return nil
+}
+
+// restart drops the screencast of a browser that was relaunched. It is
+// resumed by pageAttached once the new browser's page is attached.
+func (c *screencast) restart() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.page = nil
+	if len(c.viewers) > 0 {
+		c.resumeLocked()
+	}
+}
+
+// pageAttached resumes a screencast that has viewers but no page.
+func (c *screencast) pageAttached() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.page == nil && len(c.viewers) > 0 {
+		c.resumeLocked()
+	}
+}
+
+func (c *screencast) resumeLocked() {
+	if err := c.startLocked(); err != nil && err != ErrNoPage {
+		log.Printf("Session %s: failed to resume screencast: %v", c.s.ID, err)
+	}
+}
+
+// handleFrame acknowledges a screencast frame and broadcasts it, redacting,
+// watermarking and annotating it first if the session asks for that. With
+// a frame scheduler, that is left to its workers.
+func (c *screencast) handleFrame(msg cdp.Message) {
+	f, viewport, err := decodeScreencastFrame(msg)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.page == nil || msg.SessionID != c.page.ID {
+		c.mu.Unlock()
+		return
+	}
+	// Acknowledge at once so Chrome keeps producing frames for the
+	// fastest viewer.
+	(cdp.Page{Caller: c.page}).ScreencastFrameAck(f.SessionID)
+	c.mu.Unlock()
+
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	c.last = &rawFrame{data: f.Data, pageID: msg.SessionID, viewport: viewport}
+	if sched := c.s.opts.frames; sched != nil {
+		if !sched.submit(c) {
+			sched.skip()
+			c.mu.Lock()
+			c.skipped++
+			c.mu.Unlock()
+		}
+		return
+	}
+	c.publishLocked(time.Now())
+}
+
+// decodeScreencastFrame decodes a Page.screencastFrame event and the
+// viewport it shows. The viewport comes from the browser and scales
+// annotations, so sizes under a pixel and negative offsets or scales are
+// taken as unknown rather than trusted.
+func decodeScreencastFrame(msg cdp.Message) (screencastFrame, Viewport, error) {
+	var f screencastFrame
+	if err := msg.Decode(&f); err != nil {
+		return f, Viewport{}, err
+	}
+	atLeast := func(v, least float64) float64 {
+		if v < least {
+			return 0
+		}
+		return v
+	}
+	m := f.Metadata
+	return f, Viewport{
+		Width:     atLeast(m.DeviceWidth, 1),
+		Height:    atLeast(m.DeviceHeight, 1),
+		ScrollX:   atLeast(m.ScrollOffsetX, 0),
+		ScrollY:   atLeast(m.ScrollOffsetY, 0),
+		PageScale: atLeast(m.PageScaleFactor, 0),
+	}, nil
+}
+
+// refresh broadcasts the newest frame again, composited as of now, so
+// that annotations come and go on pages that do not change.
+func (c *screencast) refresh() {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	if c.last == nil || c.s.Viewers() == 0 {
+		return
+	}
+	if sched := c.s.opts.frames; sched != nil {
+		sched.submit(c)
+		return
+	}
+	c.publishLocked(time.Now())
+}
+
+// publish broadcasts the newest frame for the frame scheduler.
+func (c *screencast) publish() {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	if c.last == nil {
+		return
+	}
+	c.publishLocked(time.Now())
+}
+
+// publishLocked composites the newest frame as of now and broadcasts it.
+// publishMu must be held.
+func (c *screencast) publishLocked(now time.Time) {
+	f := c.last
+	data := f.data
+	annotations := c.s.annotations.live(now)
+	if c.s.composites() || len(annotations) > 0 {
+		// A frame that cannot be redacted or watermarked is not shown.
+		var err error
+		if data, err = c.s.compositeFrame(data, f.pageID, now, annotations, f.viewport.Width); err != nil {
+			log.Printf("Session %s: failed to composite frame: %v", c.s.ID, err)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.broadcastLocked(Frame{Data: data, Time: now, Viewport: f.viewport})
+}
+
+// broadcastLocked numbers a frame and hands it to every viewer that is due
+// one, replacing any frame a viewer has not taken yet.
+func (c *screencast) broadcastLocked(frame Frame) {
+	c.seq++
+	frame.Seq = c.seq
+	for v := range c.viewers {
+		if v.minInterval > 0 && frame.Time.Sub(v.last) < v.minInterval {
+			continue
+		}
+		select {
+		case v.c <- frame:
+		default:
+			// The viewer has not taken the previous frame yet.
+			select {
+			case <-v.c:
+				v.dropped++
+			default:
+			}
+			v.c <- frame
+		}
+		v.last = frame.Time
+	}
+}
@@ -0,0 +1,234 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"browser-server/internal/cdp"
+	"browser-server/internal/cdptest"
+)
+
+func TestBroadcastDropsForSlowViewer(t *testing.T) {
+	c := &screencast{}
+	fast := c.addViewerLocked(0)
+	slow := c.addViewerLocked(0)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		c.broadcastLocked(Frame{Time: start.Add(time.Duration(i) * time.Millisecond)})
+		if f := <-fast.C; f.Seq != uint64(i+1) {
+			t.Fatalf("fast viewer got frame %d, want %d", f.Seq, i+1)
+		}
+	}
+
+	if f := <-slow.C; f.Seq != 3 {
+		t.Errorf("slow viewer got frame %d, want the newest (3)", f.Seq)
+	}
+	if slow.dropped != 2 || fast.dropped != 0 {
+		t.Errorf("dropped = %d (slow), %d (fast); want 2, 0", slow.dropped, fast.dropped)
+	}
+}
+
+func TestBroadcastRateLimit(t *testing.T) {
+	c := &screencast{}
+	v := c.addViewerLocked(10) // one frame per 100ms
+
+	start := time.Now()
+	got := 0
+	for i := 0; i < 10; i++ {
+		c.broadcastLocked(Frame{Time: start.Add(time.Duration(i) * 25 * time.Millisecond)})
+		select {
+		case <-v.C:
+			got++
+		default:
+		}
+	}
+	if got != 3 {
+		t.Errorf("viewer got %d frames in 250ms at 10fps, want 3", got)
+	}
+	if v.dropped != 0 {
+		t.Errorf("rate-limited frames counted as dropped: %d", v.dropped)
+	}
+}
+
+func TestViewerCloseStopsDelivery(t *testing.T) {
+	c := &screencast{}
+	v := c.addViewerLocked(0)
+	v.Close()
+	v.Close()
+
+	c.broadcastLocked(Frame{Time: time.Now()})
+	if _, ok := <-v.C; ok {
+		t.Error("closed viewer received a frame")
+	}
+}
+
+func TestScreencastStats(t *testing.T) {
+	s := &Session{}
+	s.cast.s = s
+	c := &s.cast
+	slow := c.addViewerLocked(0)
+	c.addViewerLocked(0)
+	c.broadcastLocked(Frame{Time: time.Now()})
+	c.broadcastLocked(Frame{Time: time.Now()})
+	slow.Close()
+
+	st := s.ScreencastStats()
+	if st.Active || st.Viewers != 1 || st.Frames != 2 || st.Dropped != 2 {
+		t.Errorf("stats = %+v, want 1 viewer, 2 frames and 2 dropped", st)
+	}
+}
+
+// BenchmarkBroadcast measures how long a frame takes to reach every viewer.
+func BenchmarkBroadcast(b *testing.B) {
+	for _, viewers := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("viewers=%d", viewers), func(b *testing.B) {
+			c := &screencast{}
+			received := make(chan time.Duration, viewers)
+			for range viewers {
+				v := c.addViewerLocked(0)
+				go func() {
+					for f := range v.C {
+						received <- time.Since(f.Time)
+					}
+				}()
+			}
+			b.Cleanup(func() {
+				for v := range c.viewers {
+					v.Close()
+				}
+			})
+			var latency time.Duration
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				c.mu.Lock()
+				c.broadcastLocked(Frame{Time: time.Now()})
+				c.mu.Unlock()
+				for range viewers {
+					latency += <-received
+				}
+			}
+			b.ReportMetric(float64(latency.Nanoseconds())/float64(b.N*viewers), "latency-ns/viewer")
+		})
+	}
+}
+
+// benchmarkScreencast streams frames from a synthetic browser to viewers
+// of sessions, one operation being one frame published by any of them.
+func benchmarkScreencast(b *testing.B, sessions, viewers int, watermarked bool, frames *FrameScheduler) {
+	browser := cdptest.NewServer(cdptest.Options{})
+	b.Cleanup(browser.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Cleanup(cancel)
+
+	var casts []*Session
+	for i := range sessions {
+		s := &Session{ID: fmt.Sprintf("bench-%d", i), ctx: ctx, opts: Options{frames: frames}}
+		s.cast.s = s
+		if watermarked {
+			s.watermark = newWatermark("{session} {time}", "bench", s.ID)
+		}
+		client, err := cdp.Dial(ctx, browser.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { client.Close() })
+		events := client.Events()
+		go func() {
+			for msg := range events {
+				if msg.Method == "Page.screencastFrame" {
+					s.cast.handleFrame(msg)
+				}
+			}
+		}()
+		for range viewers {
+			v := s.cast.addViewerLocked(0)
+			go func() {
+				for range v.C {
+				}
+			}()
+		}
+		page := client.Session("page-1")
+		s.cast.page = page
+		if err := (cdp.Page{Caller: page}).StartScreencast(ctx, screencastOptions); err != nil {
+			b.Fatal(err)
+		}
+		casts = append(casts, s)
+	}
+	published := func() (n uint64, dropped int) {
+		for _, s := range casts {
+			st := s.ScreencastStats()
+			n += st.Frames
+			dropped += st.Dropped
+		}
+		return n, dropped
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start, startDropped := published()
+	for {
+		n, _ := published()
+		if n-start >= uint64(b.N) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.StopTimer()
+	_, dropped := published()
+	b.ReportMetric(float64(dropped-startDropped)/float64(b.N), "dropped/op")
+}
+
+func BenchmarkScreencast(b *testing.B) {
+	b.Run("sessions=1/viewers=1", func(b *testing.B) { benchmarkScreencast(b, 1, 1, false, nil) })
+	b.Run("sessions=1/viewers=10", func(b *testing.B) { benchmarkScreencast(b, 1, 10, false, nil) })
+	b.Run("sessions=10/viewers=1", func(b *testing.B) { benchmarkScreencast(b, 10, 1, false, nil) })
+	b.Run("sessions=10/viewers=1/watermark", func(b *testing.B) { benchmarkScreencast(b, 10, 1, true, nil) })
+	b.Run("sessions=10/viewers=1/watermark/scheduled", func(b *testing.B) {
+		f := NewFrameScheduler(runtime.GOMAXPROCS(0), 0)
+		defer f.Close()
+		benchmarkScreencast(b, 10, 1, true, f)
+	})
+}
+
+// FuzzScreencastFrame feeds Page.screencastFrame events, as a compromised
+// browser might send them, through decoding and compositing.
+func FuzzScreencastFrame(f *testing.F) {
+	jpeg := base64.StdEncoding.EncodeToString(cdptest.Frame(32, 24, 80))
+	f.Add([]byte(`{"data":"` + jpeg + `","sessionId":1,"metadata":{"deviceWidth":320,"deviceHeight":240,"pageScaleFactor":1,"scrollOffsetX":0,"scrollOffsetY":12,"timestamp":1}}`))
+	f.Add([]byte(`{"data":"` + jpeg + `","sessionId":2,"metadata":{"deviceWidth":1e-300,"deviceHeight":-5,"pageScaleFactor":-1}}`))
+	f.Add([]byte(`{"data":"` + jpeg[:len(jpeg)/2] + `","sessionId":3}`))
+	f.Add([]byte(`{"data":"/9j/","sessionId":4}`))
+	f.Add([]byte(`{"data":"not base64","sessionId":5}`))
+	f.Add([]byte(`{"sessionId":"6","metadata":[]}`))
+	f.Add([]byte(`null`))
+
+	s := &Session{ID: "fuzz"}
+	s.watermark = newWatermark("{session} {time}", "fuzz", s.ID)
+	annotations := []Annotation{
+		{Type: AnnotateBox, X: 4, Y: 4, Width: 100, Height: 60, Text: "box"},
+		{Type: AnnotateArrow, X: 10, Y: 10, ToX: 300, ToY: 200},
+		{Type: AnnotateLabel, X: 20, Y: 100, Text: "label"},
+	}
+	f.Fuzz(func(t *testing.T, params []byte) {
+		msg := cdp.Message{Method: "Page.screencastFrame", SessionID: "page-1", Params: params}
+		frame, viewport, err := decodeScreencastFrame(msg)
+		if err != nil {
+			return
+		}
+		for _, v := range []float64{viewport.Width, viewport.Height, viewport.ScrollX, viewport.ScrollY, viewport.PageScale} {
+			if v < 0 {
+				t.Fatalf("viewport %+v has a negative value", viewport)
+			}
+		}
+		if (viewport.Width > 0 && viewport.Width < 1) || (viewport.Height > 0 && viewport.Height < 1) {
+			t.Fatalf("viewport %+v is under a pixel", viewport)
+		}
+		s.compositeFrame(frame.Data, msg.SessionID, time.Now(), annotations, viewport.Width)
+	})
+}
@@ -5,128 +5,747 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"browser-server/egress"
+	"browser-server/internal/cdp"
+	"browser-server/recording"
+	"browser-server/tunnel"
+
 	"github.com/google/uuid"
 )
 
+// browserExitTimeout bounds how long stopping a session waits for its
+// browser to exit before removing the profile.
+const browserExitTimeout = 5 * time.Second
+
 type Session struct {
 	ID        string    `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CDPURL    string    `json:"cdp_url"`
 	Port      int       `json:"port"`
+	Owner     string    `json:"owner,omitempty"`
+	// Priority is the session's class when the server is short of memory.
+	Priority Priority `json:"priority"`
+
+	Stealth        bool     `json:"stealth"`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	// Tunnel is the user@host of the SSH server the session's traffic goes
+	// through, if any.
+	Tunnel string `json:"ssh_tunnel,omitempty"`
+	// Tor reports whether the session's traffic goes through Tor.
+	Tor bool `json:"tor,omitempty"`
+	// Proxy is the upstream proxy the session's traffic goes through,
+	// without its password.
+	Proxy string `json:"proxy,omitempty"`
+	// Egress is the egress profile the session's traffic leaves through.
+	Egress string `json:"egress,omitempty"`
+	// CPUSet is the set of CPUs the browser is pinned to, if any.
+	CPUSet string `json:"cpu_set,omitempty"`
+	// HostOverrides are the session's DNS overrides.
+	HostOverrides map[string]string `json:"dns_overrides,omitempty"`
+	// Labels tag the session, e.g. with the CI job that created it.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Fingerprint is the randomized identity the session presents, if any.
+	Fingerprint *Fingerprint `json:"fingerprint,omitempty"`
+	// Fonts names the font packs installed for the session.
+	Fonts []string `json:"fonts,omitempty"`
+	// Locale is the language the browser runs in, if not the host's.
+	Locale string `json:"locale,omitempty"`
+	// Clock is the time the session's pages see, if overridden.
+	Clock *Clock `json:"clock,omitempty"`
+	// LaunchAttempts lists the tries it took to start the browser.
+	LaunchAttempts []LaunchAttempt `json:"launch_attempts,omitempty"`
+
+	browser Browser
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wsURL   string
+	mu      sync.Mutex
+	state   State
+
+	// The browser can be relaunched within the session's lifetime, so it
+	// has its own context and remembers how it was started.
+	browserCancel context.CancelFunc
+	browserDone   <-chan struct{}
+	launcher      Launcher
+	spec          LaunchSpec
+	profileDir    string
+	netns         *egress.Namespace
+
+	opts     Options
+	usage    usage
+	mon      atomic.Pointer[monitor]
+	recorder *recorder
+	health   Health
+	cast     screencast
+	feed     cdpFeed
+	bodies   bodyCapture
+	// downloads hands streamed downloads to NextDownload. It is nil
+	// unless Options.StreamDownloads is set.
+	downloads chan *Download
+	rewind    *rewindBuffer
+	logs      *browserLogs
+	// watermark is drawn onto frames and screenshots, and redactor hides
+	// parts of them. They are nil unless Options.Watermark and
+	// Options.Redaction are set.
+	watermark *watermark
+	redactor  *redactor
+	// annotations are drawn onto frames only.
+	annotations annotations
+	highlight   highlighter
+	crashed     bool
+	// crashArtifactDir holds the browser logs of a crashed session that
+	// did not collect artifacts.
+	crashArtifactDir string
+
+	timelineMu sync.Mutex
+	timeline   []TimelineEntry
+
+	stepsMu   sync.Mutex
+	steps     []recording.Step
+	lastInput time.Time
+
+	// lastHeartbeat is when the lease was last renewed. Guarded by mu.
+	lastHeartbeat time.Time
+	// emulation is applied to every page. Guarded by mu.
+	emulation Emulation
 
-	cmd      *exec.Cmd
-	cancel   context.CancelFunc
-	wsURL    string
-	mu       sync.Mutex
-	isClosed bool
+	onStop       func(*Session)
+	onWarning    func(*Session, Warning)
+	onDialog     func(*Session, Dialog)
+	onBlocked    func(*Session, Blocked)
+	onHealth     func(*Session, Health)
+	onState      func(*Session, State)
+	stoppedAt    time.Time
+	storageBytes int64
+	// stopNotified is set once onStop has run, so that stop and setOnStop
+	// cannot both run it. Guarded by mu.
+	stopNotified bool
 }
 
-func NewSession(duration time.Duration) (*Session, error) {
+// Options controls how a session's browser is launched.
+type Options struct {
+	// Owner is the name of the identity that created the session.
+	Owner string
+	// Priority decides which sessions are refused or stopped first when
+	// the server is short of memory; PriorityCI if empty.
+	Priority Priority
+	// Quota caps the sessions of the API key the session is created with.
+	Quota    Quota
+	Duration time.Duration
+	// Labels are free-form key/value tags used to find sessions again.
+	Labels map[string]string
+	// Stealth hides the most obvious automation markers from pages.
+	Stealth bool
+	// SSHTunnel routes the browser's traffic through an SSH server, for
+	// sites only reachable from a bastion host.
+	SSHTunnel *tunnel.Config
+	// Tor routes the browser's traffic through Tor on circuits of the
+	// session's own.
+	Tor *tunnel.Tor
+	// Proxy sends the browser's traffic through an upstream HTTP(S) or
+	// SOCKS5 proxy.
+	Proxy *tunnel.Upstream
+	// RotateProxy has the Manager set Proxy to the next proxy of its
+	// pool.
+	RotateProxy bool
+	// Egress runs the browser in its own network namespace whose traffic
+	// leaves through the profile's WireGuard tunnel.
+	Egress *egress.Profile
+	// CPUSet, if set, pins the browser and all of its processes to its
+	// CPUs.
+	CPUSet *CPUSet
+	// HostOverrides maps host names (or *.domain patterns) to the IP
+	// addresses the session connects to instead of resolving them.
+	HostOverrides map[string]string
+	// ExtraHeaders are added to requests for the origins they name.
+	ExtraHeaders []HeaderRule
+	// Fingerprint, if set, replaces the browser's user agent, languages,
+	// screen, hardware and font hints (see NewFingerprint).
+	Fingerprint *Fingerprint
+	// AllowedDomains restricts name resolution to the listed domains
+	// (and their subdomains). Empty means unrestricted.
+	AllowedDomains []string
+	// BandwidthCapBytes caps the bytes a session may transfer across CDP,
+	// streams and page network traffic. Zero means unlimited.
+	BandwidthCapBytes int64
+	// BandwidthCapAction is CapActionTerminate (default) or CapActionThrottle.
+	BandwidthCapAction string
+	// WarnBefore is how long before expiry a warning is emitted. Zero
+	// disables the warning.
+	WarnBefore time.Duration
+	// CollectArtifacts records the console log, network HAR, downloads and
+	// a final screenshot into ArtifactDir.
+	CollectArtifacts bool
+	// HealthCheckInterval is how often the browser and its pages are
+	// probed. Zero disables health checks.
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout bounds each probe.
+	HealthCheckTimeout time.Duration
+	// AutoRestart relaunches the browser when the session turns unhealthy.
+	AutoRestart bool
+	// RecordInteractions records clicks, form input, key presses and
+	// navigations so they can be exported as a script.
+	RecordInteractions bool
+	// RewindWindow keeps that much screencast history for Rewind. Zero
+	// disables it.
+	RewindWindow time.Duration
+	// RewindFPS limits the frame rate of the rewind history.
+	RewindFPS float64
+	// IPFamily picks the loopback address the DevTools endpoint binds to.
+	IPFamily IPFamily
+	// LeaseTimeout, if set, stops the session when no Heartbeat arrives
+	// for that long.
+	LeaseTimeout time.Duration
+	// ResponseBodyPatterns are URL patterns whose response bodies are
+	// captured from the start (see SetResponseBodyPatterns).
+	ResponseBodyPatterns []string
+	// StreamDownloads hands files the pages download to NextDownload
+	// instead of letting the browser save them.
+	StreamDownloads bool
+	// Dialogs, if set, answers the dialogs pages open.
+	Dialogs *DialogPolicy
+	// Fonts are font packs made available to the browser on top of the
+	// host's fonts.
+	Fonts []FontPack
+	// Locale is a language tag such as ja-JP the browser's UI,
+	// Accept-Language and default fonts follow. It cannot be combined
+	// with Fingerprint, which picks its own languages.
+	Locale string
+	// Clock, if set, overrides the time and time zone pages see.
+	Clock *Clock
+	// DismissConsent, if set, clicks away cookie banners, preferring
+	// ConsentReject or ConsentAccept.
+	DismissConsent string
+	// ConsentRules are used on top of the built-in consent rules.
+	ConsentRules []ConsentRule
+	// Mocks, if set, answers the pages' requests with recorded responses.
+	Mocks *Mocks
+	// DenyHosts stops pages and frames from navigating to these domains
+	// and their subdomains (or to hosts matching patterns with * and ?).
+	DenyHosts []string
+	// Countdown, if set, tells pages how long the session has left:
+	// CountdownOverlay or CountdownConsole.
+	Countdown string
+	// Watermark, if set, is drawn onto every screencast frame and
+	// screenshot. WatermarkOwner, WatermarkSession and WatermarkTime in
+	// it are replaced with the owner, the session ID and the frame's time.
+	Watermark string
+	// Redaction, if set, hides parts of pages from the screencast and
+	// screenshots.
+	Redaction *Redaction
+	// Snapshot, if set, is the saved state the session starts from: its
+	// profile, cookies, and tabs with their storage.
+	Snapshot *Snapshot
+	// Launcher starts the session's browser. A local Chrome is run if it
+	// is nil.
+	Launcher Launcher
+
+	// journal records the session's browser; the Manager sets it.
+	journal *Journal
+	// frames processes the session's screencast frames; the Manager sets
+	// it. Without it, frames are processed as Chrome sends them.
+	frames *FrameScheduler
+}
+
+func NewSession(opts Options) (*Session, error) {
+	return newSession(opts, false)
+}
+
+// newSession launches a session's browser. A warm session waits in a pool
+// without a clock until it is claimed.
+func newSession(opts Options, warm bool) (*Session, error) {
+	duration := opts.Duration
 	id := uuid.New().String()
+	if opts.Clock != nil {
+		// The clock starts with the session, and runs on from there in
+		// every page.
+		c := *opts.Clock
+		c.startedAt = time.Now()
+		opts.Clock = &c
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 
-	chromePath, err := findBrowserExecutable()
-	if err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to find browser executable: %w", err)
+	var chromePath string
+	var err error
+	if opts.Launcher == nil {
+		chromePath, err = findBrowserExecutable()
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to find browser executable: %w", err)
+		}
+	} else if c, ok := opts.Launcher.(launchChecker); ok {
+		if err := c.Check(opts); err != nil {
+			cancel()
+			return nil, err
+		}
 	}
 
-	cmd := exec.CommandContext(ctx, chromePath,
+	args := []string{
 		"--headless=new",
 		"--no-sandbox",
 		// "--disable-gpu",
 		// "--use-gl=swiftshader",
 		// "--mute-audio",
 		"--remote-debugging-port=0",
-		"--user-data-dir=/tmp/chrome-profile-"+id,
+		"--remote-debugging-address=" + opts.IPFamily.Loopback(),
+		"--user-data-dir=/tmp/chrome-profile-" + id,
 		"--window-size=1920,1080", // Set a default window size
-	)
+	}
+	if opts.Stealth {
+		args = append(args, "--disable-blink-features=AutomationControlled")
+	}
+	if opts.Fingerprint != nil {
+		args = append(args, opts.Fingerprint.flags()...)
+	}
+	if opts.Locale != "" {
+		args = append(args, "--lang="+opts.Locale, "--accept-lang="+opts.Locale)
+	}
+	if rules := hostResolverRules(opts.AllowedDomains, opts.HostOverrides); rules != "" {
+		args = append(args, "--host-resolver-rules="+rules)
+	}
+	if rules := hostRules(opts.HostOverrides); rules != "" {
+		args = append(args, "--host-rules="+rules)
+	}
+	if opts.SSHTunnel != nil {
+		t, err := tunnel.Open(ctx, *opts.SSHTunnel, tunnelAllow(opts))
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		// The tunnel lives as long as the session, across browser restarts.
+		context.AfterFunc(ctx, func() { t.Close() })
+		args = append(args, "--proxy-server="+t.ProxyURL())
+	}
+	if opts.Tor != nil {
+		p, err := opts.Tor.Open(id, tunnelAllow(opts))
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		context.AfterFunc(ctx, func() { p.Close() })
+		// WebRTC would otherwise send UDP around the proxy and reveal the
+		// host's address.
+		args = append(args, "--proxy-server="+p.ProxyURL(), "--force-webrtc-ip-handling-policy=disable_non_proxied_udp")
+	}
+	if opts.Proxy != nil {
+		p, err := opts.Proxy.Open(tunnelAllow(opts))
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		context.AfterFunc(ctx, func() { p.Close() })
+		args = append(args, "--proxy-server="+p.ProxyURL(), "--force-webrtc-ip-handling-policy=disable_non_proxied_udp")
+	}
+	var netns *egress.Namespace
+	if opts.Egress != nil {
+		netns, err = egress.Create(ctx, id, *opts.Egress)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		context.AfterFunc(ctx, func() { netns.Close() })
+	}
 
-	// Capture stderr to find the DevTools URL
-	stderr, err := cmd.StderrPipe()
+	// Chrome's own log and crash dumps are kept so crashes can be
+	// diagnosed.
+	logs, err := newBrowserLogs("/tmp/browser-lab-logs-" + id)
 	if err != nil {
-		cancel()
-		return nil, err
+		log.Printf("Session %s: browser logs unavailable: %v", id, err)
+		logs = nil
+	} else {
+		args = append(args, logs.flags()...)
 	}
 
-	if err := cmd.Start(); err != nil {
+	fontDir := "/tmp/browser-lab-fonts-" + id
+	env, err := browserEnv(fontDir, opts)
+	if err != nil {
 		cancel()
-		return nil, err
+		return nil, fmt.Errorf("failed to configure fonts: %w", err)
 	}
+	context.AfterFunc(ctx, func() { os.RemoveAll(fontDir) })
 
-	// Parse DevTools URL from stderr
-	wsURL, err := parseDevToolsURL(stderr)
+	launcher := opts.Launcher
+	if launcher == nil {
+		launcher = &localLauncher{path: chromePath, netns: netns}
+	}
+	profileDir := "/tmp/chrome-profile-" + id
+	spec := LaunchSpec{SessionID: id, Args: args, Env: env, Dirs: []string{profileDir}, CPUs: cpuList(opts.CPUSet), Stderr: stderrLog(logs)}
+	if len(opts.Fonts) > 0 {
+		spec.Dirs = append(spec.Dirs, fontDir)
+	}
+	if logs != nil {
+		spec.Dirs = append(spec.Dirs, logs.dir)
+	}
+	artifactDir := "/tmp/browser-lab-artifacts-" + id
+	if opts.CollectArtifacts {
+		// Downloads are saved there.
+		spec.Dirs = append(spec.Dirs, artifactDir)
+	}
+	browserCtx, browserCancel := context.WithCancel(ctx)
+	var seed func(string) error
+	if opts.Snapshot != nil {
+		seed = opts.Snapshot.RestoreProfile
+	}
+	browser, wsURL, attempts, err := launchBrowser(browserCtx, launcher, spec, profileDir, seed)
 	if err != nil {
+		browserCancel()
 		cancel()
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("failed to parse devtools url: %w", err)
+		os.RemoveAll(profileDir)
+		os.RemoveAll(artifactDir)
+		if logs != nil {
+			logs.close()
+			os.RemoveAll(logs.dir)
+		}
+		return nil, err
+	}
+	if len(attempts) > 1 {
+		log.Printf("Session %s: browser started on attempt %d", id, len(attempts))
 	}
 
 	s := &Session{
 		ID:        id,
 		CreatedAt: time.Now(),
 		ExpiresAt: time.Now().Add(duration),
-		cmd:       cmd,
+		browser:   browser,
+		ctx:       ctx,
 		cancel:    cancel,
 		wsURL:     wsURL,
+		Owner:     opts.Owner,
+		Priority:  opts.Priority.orDefault(),
+		watermark: newWatermark(opts.Watermark, opts.Owner, id),
+		redactor:  newRedactor(opts.Redaction),
+
+		browserCancel: browserCancel,
+		launcher:      launcher,
+		spec:          spec,
+		profileDir:    profileDir,
+		netns:         netns,
+
+		Stealth:        opts.Stealth,
+		AllowedDomains: opts.AllowedDomains,
+		HostOverrides:  opts.HostOverrides,
+		Tunnel:         tunnelName(opts.SSHTunnel),
+		Proxy:          proxyName(opts.Proxy),
+		Egress:         egressName(opts.Egress),
+		CPUSet:         cpuSetName(opts.CPUSet),
+		Tor:            opts.Tor != nil,
+		Labels:         opts.Labels,
+		Fingerprint:    opts.Fingerprint,
+		Fonts:          fontPackNames(opts.Fonts),
+		Locale:         opts.Locale,
+		Clock:          opts.Clock,
+		LaunchAttempts: attempts,
+		opts:           opts,
+		logs:           logs,
+		state:          StateStarting,
+		health:         Health{Status: HealthHealthy, Since: time.Now()},
+		lastHeartbeat:  time.Now(),
+	}
+	s.bodies.setPatterns(opts.ResponseBodyPatterns)
+	if opts.StreamDownloads {
+		s.downloads = make(chan *Download)
+	}
+	s.cast.s = s
+	s.browserDone = s.watchBrowser(browserCtx, browser)
+	s.recordJournal(false)
+
+	for _, a := range attempts {
+		if a.Error != "" {
+			s.addTimeline("launch_failed", a.Error)
+		}
+	}
+	s.addTimeline("created", "")
+
+	if opts.CollectArtifacts {
+		if rec, err := newRecorder(artifactDir); err != nil {
+			log.Printf("Session %s: artifact collection unavailable: %v", id, err)
+		} else {
+			s.recorder = rec
+		}
+	}
+
+	// Page network usage is metered over a separate CDP connection.
+	if m, err := startMonitor(browserCtx, s, wsURL); err != nil {
+		log.Printf("Session %s: page monitoring unavailable: %v", id, err)
+	} else {
+		s.mon.Store(m)
+	}
+	if opts.Snapshot != nil {
+		s.restoreSnapshot(opts.Snapshot)
+	}
+
+	s.setState(StateReady)
+
+	if opts.HealthCheckInterval > 0 {
+		go s.watchdog(ctx)
+	}
+	if opts.RewindWindow > 0 {
+		s.rewind = &rewindBuffer{window: opts.RewindWindow}
+		go s.recordRewind(ctx)
+	}
+	if !warm {
+		s.start()
+	}
+
+	return s, nil
+}
+
+// start runs the session's clock: its expiry, the warning ahead of it and
+// its lease. Warm sessions start theirs when they are claimed.
+func (s *Session) start() {
+	opts := s.opts
+	duration := opts.Duration
+	if opts.LeaseTimeout > 0 {
+		go s.watchLease(s.ctx)
 	}
 
-	// Auto-cleanup
+	s.recordJournal(true)
+
+	// Auto-cleanup, warning ahead of expiry if requested
 	go func() {
-		select {
-		case <-time.After(duration):
-			s.Stop()
-		case <-ctx.Done():
-			// Already stopped
+		expire := time.NewTimer(duration)
+		defer expire.Stop()
+		var warn <-chan time.Time
+		if opts.WarnBefore > 0 && opts.WarnBefore < duration {
+			t := time.NewTimer(duration - opts.WarnBefore)
+			defer t.Stop()
+			warn = t.C
+		}
+		for {
+			select {
+			case <-warn:
+				warn = nil
+				s.warn(Warning{
+					Kind:    WarningExpiring,
+					Message: fmt.Sprintf("Session expires in %s", opts.WarnBefore),
+				})
+			case <-expire.C:
+				s.stop(StateExpired)
+				return
+			case <-s.ctx.Done():
+				// Already stopped
+				return
+			}
 		}
 	}()
+}
 
-	return s, nil
+// recordJournal records the session's browser in the journal, with its
+// expiry once its clock has started. A relaunched browser keeps the
+// expiry recorded before.
+func (s *Session) recordJournal(started bool) {
+	s.mu.Lock()
+	e := JournalEntry{ID: s.ID, Port: s.Port, ProfileDir: s.profileDir, StartedAt: s.CreatedAt}
+	if s.browser != nil {
+		e.PID = s.browser.PID()
+	}
+	if started {
+		expires := s.ExpiresAt
+		e.ExpiresAt = &expires
+	}
+	journal := s.opts.journal
+	s.mu.Unlock()
+	journal.record(e)
 }
 
+// Stop stops the session before it expires.
 func (s *Session) Stop() {
+	s.stop(StateStopped)
+}
+
+// stop tears the session down and leaves it in final, StateExpired or
+// StateStopped.
+func (s *Session) stop(final State) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.isClosed {
+	if !s.setStateLocked(StateTerminating) {
+		s.mu.Unlock()
 		return
 	}
-	s.isClosed = true
+	s.stoppedAt = time.Now()
+	s.mu.Unlock()
+
+	s.addTimeline(string(final), "")
+	// Artifacts need the browser, so collect them before it is killed.
+	if s.recorder != nil {
+		if err := s.recorder.finish(s.Timeline(), s.Interactions(), s.finalScreenshot(), s.capturedBodyData); err != nil {
+			log.Printf("Session %s: failed to write artifacts: %v", s.ID, err)
+		}
+	}
+
+	s.mu.Lock()
 	s.cancel()
-	// Cleanup user data dir
-	os.RemoveAll("/tmp/chrome-profile-" + s.ID)
+	browserDone := s.browserDone
+	s.mu.Unlock()
+	// Chrome may still be writing to its profile until it has exited.
+	if browserDone != nil {
+		select {
+		case <-browserDone:
+		case <-time.After(browserExitTimeout):
+			log.Printf("Session %s: browser did not exit within %s", s.ID, browserExitTimeout)
+		}
+	}
+
+	s.mu.Lock()
+	// Cleanup user data dir, remembering how much disk it used
+	profileDir := "/tmp/chrome-profile-" + s.ID
+	s.storageBytes = dirSize(profileDir)
+	os.RemoveAll(profileDir)
+	journal := s.opts.journal
+	onStop := s.onStop
+	if onStop != nil {
+		s.stopNotified = true
+	}
+	s.setStateLocked(final)
+	s.mu.Unlock()
+	journal.forget(s.ID)
+
+	s.finishBrowserLogs()
+	if onStop != nil {
+		onStop(s)
+	}
+}
+
+// finalScreenshot captures the first attached page, or returns nil.
+func (s *Session) finalScreenshot() []byte {
+	m := s.mon.Load()
+	if m == nil {
+		return nil
+	}
+	for _, page := range m.pages() {
+		ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+		data, err := cdp.Page{Caller: page}.CaptureScreenshot(ctx)
+		cancel()
+		if err == nil && len(data) > 0 && s.composites() {
+			data, err = s.compositePNG(data, page.ID, time.Now())
+		}
+		if err == nil && len(data) > 0 {
+			return data
+		}
+	}
+	return nil
+}
+
+// setOnStop registers the callback run after the session stops. If the
+// session already stopped, fn runs immediately; a session still
+// terminating runs it when it is done, once usage such as its storage is
+// final.
+func (s *Session) setOnStop(fn func(*Session)) {
+	s.mu.Lock()
+	stopped := (s.state == StateStopped || s.state == StateExpired) && !s.stopNotified
+	if stopped {
+		s.stopNotified = true
+	}
+	s.onStop = fn
+	s.mu.Unlock()
+
+	if stopped {
+		fn(s)
+	}
+}
+
+// StoppedAt returns when the session stopped, or the zero time if it is
+// still running.
+func (s *Session) StoppedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stoppedAt
+}
+
+// StorageBytes returns the disk space used by the browser profile when the
+// session stopped.
+func (s *Session) StorageBytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.storageBytes
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// Context returns a context that is cancelled when the session stops.
+func (s *Session) Context() context.Context {
+	return s.ctx
 }
 
 func (s *Session) GetWSURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.wsURL
 }
 
-func parseDevToolsURL(r io.Reader) (string, error) {
+// hostResolverRules builds a Chrome --host-resolver-rules value that makes
+// every host except the allowed domains fail to resolve.
+func hostResolverRules(allowed []string, overrides map[string]string) string {
+	if len(allowed) == 0 {
+		return ""
+	}
+	rules := []string{"MAP * ~NOTFOUND"}
+	for _, d := range allowed {
+		d = strings.TrimPrefix(strings.ToLower(d), "*.")
+		rules = append(rules, "EXCLUDE "+d, "EXCLUDE *."+d)
+	}
+	// Overridden hosts reach the resolver as their addresses.
+	for _, ip := range overrides {
+		rules = append(rules, "EXCLUDE "+hostRuleAddress(ip))
+	}
+	// Keep the loopback interface reachable for DevTools.
+	rules = append(rules, "EXCLUDE localhost", "EXCLUDE 127.0.0.1", "EXCLUDE [::1]")
+	return strings.Join(rules, ", ")
+}
+
+func parseDevToolsURL(r io.Reader, wait time.Duration) (string, error) {
 	scanner := bufio.NewScanner(r)
 	// Chrome prints: DevTools listening on ws://127.0.0.1:33693/devtools/browser/uuid
 	re := regexp.MustCompile(`DevTools listening on (ws://.+)\n?`)
 
 	// Read for a few seconds max
-	timeout := time.After(5 * time.Second)
-	ch := make(chan string)
+	timeout := time.After(wait)
+	ch := make(chan string, 1)
 
+	// Keep reading after the URL so Chrome never blocks writing its log
+	// to a full stderr pipe.
 	go func() {
+		found := false
 		for scanner.Scan() {
-			line := scanner.Text()
-			// log.Println("Chrome stderr:", line) // Debugging
-			matches := re.FindStringSubmatch(line)
+			if found {
+				continue
+			}
+			matches := re.FindStringSubmatch(scanner.Text())
 			if len(matches) > 1 {
 				ch <- matches[1]
-				return
+				found = true
 			}
 		}
-		close(ch)
+		io.Copy(io.Discard, r)
+		if !found {
+			close(ch)
+		}
 	}()
 
 	select {
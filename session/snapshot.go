@@ -0,0 +1,282 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"browser-server/internal/cdp"
+)
+
+// snapshotTabTimeout bounds how long restoring a snapshot waits for each
+// of its tabs to load.
+const snapshotTabTimeout = 30 * time.Second
+
+// Snapshot is a session's state saved by SaveSnapshot, which new sessions
+// can start from (see Options.Snapshot): a copy of the browser profile,
+// and what the copy may miss because the browser had not written it yet.
+type Snapshot struct {
+	// RestoreProfile writes the copy of the profile into a directory.
+	RestoreProfile func(dir string) error `json:"-"`
+	// Tabs are the http(s) pages that were open, oldest first.
+	Tabs []SnapshotTab `json:"tabs"`
+	// Cookies are all of the browser's cookies, including the session
+	// cookies a profile does not keep.
+	Cookies []cdp.Cookie `json:"cookies"`
+	// LocalStorage is the localStorage of each tab's origin.
+	LocalStorage map[string]map[string]string `json:"local_storage,omitempty"`
+	// SizeBytes is the size of the profile copy.
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+// SnapshotTab is a page that was open when a snapshot was taken.
+type SnapshotTab struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// SessionStorage is the page's sessionStorage, which belongs to the
+	// tab.
+	SessionStorage map[string]string `json:"session_storage,omitempty"`
+}
+
+// profileSkip are the parts of a profile not worth copying: caches the
+// browser rebuilds, and the locks of the running browser.
+var profileSkip = map[string]bool{
+	"Cache":               true,
+	"Code Cache":          true,
+	"GPUCache":            true,
+	"GrShaderCache":       true,
+	"GraphiteDawnCache":   true,
+	"ShaderCache":         true,
+	"DawnGraphiteCache":   true,
+	"DawnWebGPUCache":     true,
+	"Crashpad":            true,
+	"SingletonCookie":     true,
+	"SingletonLock":       true,
+	"SingletonSocket":     true,
+	"BrowserMetrics":      true,
+	"Safe Browsing":       true,
+	"component_crx_cache": true,
+}
+
+// snapshotScript describes a page and its storage. Storage may be denied,
+// e.g. to sandboxed documents.
+const snapshotScript = `(() => {
+	const dump = (s) => {
+		const o = {};
+		for (let i = 0; i < s.length; i++) o[s.key(i)] = s.getItem(s.key(i));
+		return o;
+	};
+	const r = {url: location.href, title: document.title, origin: location.origin};
+	try {
+		r.local = dump(localStorage);
+		r.session = dump(sessionStorage);
+	} catch (e) {}
+	return r;
+})()`
+
+// restoreStorageScript fills in the storage of a snapshot tab's first
+// document, before the document's own scripts run.
+const restoreStorageScript = `(() => {
+	const local = %s, session = %s, origin = %s;
+	try {
+		for (const [k, v] of Object.entries(local[location.origin] || {})) localStorage.setItem(k, v);
+		if (location.origin === origin) {
+			for (const [k, v] of Object.entries(session)) sessionStorage.setItem(k, v);
+		}
+	} catch (e) {}
+})()`
+
+// SaveSnapshot copies the session's profile into profileDir and records
+// its open tabs, cookies and storage, so that new sessions can start
+// where this one is, e.g. signed in. The profile is copied while the
+// browser runs, so what it was writing at the time may be missing or
+// torn; cookies and the tabs' storage are restored from the snapshot
+// itself.
+func (s *Session) SaveSnapshot(ctx context.Context, profileDir string) (*Snapshot, error) {
+	m := s.mon.Load()
+	if m == nil {
+		return nil, errors.New("page control unavailable")
+	}
+	snap := &Snapshot{
+		RestoreProfile: func(dir string) error { return copyProfile(profileDir, dir) },
+		Tabs:           []SnapshotTab{},
+		LocalStorage:   map[string]map[string]string{},
+	}
+	for _, page := range m.pages() {
+		v, err := cdp.Runtime{Caller: page}.Evaluate(ctx, snapshotScript)
+		if err != nil {
+			return nil, err
+		}
+		var tab struct {
+			URL     string            `json:"url"`
+			Title   string            `json:"title"`
+			Origin  string            `json:"origin"`
+			Local   map[string]string `json:"local"`
+			Session map[string]string `json:"session"`
+		}
+		if err := json.Unmarshal(v, &tab); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(tab.URL, "http://") && !strings.HasPrefix(tab.URL, "https://") {
+			continue
+		}
+		snap.Tabs = append(snap.Tabs, SnapshotTab{URL: tab.URL, Title: tab.Title, SessionStorage: tab.Session})
+		if len(tab.Local) > 0 {
+			snap.LocalStorage[tab.Origin] = tab.Local
+		}
+	}
+	cookies, err := cdp.Storage{Caller: m.client}.GetCookies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snap.Cookies = cookies
+	if err := copyProfile(s.profileDir, profileDir); err != nil {
+		return nil, fmt.Errorf("failed to copy the profile: %w", err)
+	}
+	snap.SizeBytes = dirSize(profileDir)
+	return snap, nil
+}
+
+// copyProfile copies a browser profile, leaving out profileSkip. Files the
+// browser removes during the copy are skipped.
+func copyProfile(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if profileSkip[d.Name()] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if err := copyFile(path, target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
+
+// restoreSnapshot sets a snapshot's cookies and reopens its tabs, the
+// first in the page the browser started with. Tabs that fail to load are
+// logged and left as they are.
+func (s *Session) restoreSnapshot(snap *Snapshot) {
+	m := s.mon.Load()
+	if m == nil {
+		return
+	}
+	client := cdp.Target{Caller: m.client}
+	if len(snap.Cookies) > 0 {
+		ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+		err := cdp.Storage{Caller: m.client}.SetCookies(ctx, snap.Cookies)
+		cancel()
+		if err != nil {
+			log.Printf("Session %s: failed to restore cookies: %v", s.ID, err)
+		}
+	}
+	for i, tab := range snap.Tabs {
+		ctx, cancel := context.WithTimeout(s.ctx, snapshotTabTimeout)
+		target := ""
+		if i == 0 {
+			first, cancelFirst := context.WithTimeout(ctx, 5*time.Second)
+			target, _ = m.waitReady(first, "")
+			cancelFirst()
+		}
+		var err error
+		if target == "" {
+			target, err = client.CreateTarget(ctx, "about:blank")
+		}
+		if err == nil {
+			err = s.openSnapshotTab(ctx, m, target, tab, snap.LocalStorage)
+		}
+		cancel()
+		if err != nil {
+			log.Printf("Session %s: failed to restore tab %s: %v", s.ID, tab.URL, err)
+		}
+	}
+}
+
+// openSnapshotTab loads a snapshot tab's URL in a page, with its storage
+// in place before the page's scripts run.
+func (s *Session) openSnapshotTab(ctx context.Context, m *monitor, targetID string, tab SnapshotTab, local map[string]map[string]string) error {
+	// Loading before the monitor has enabled the page would bypass mocks,
+	// header rules and the like.
+	if _, err := m.waitReady(ctx, targetID); err != nil {
+		return err
+	}
+	sub, err := s.SubscribeCDP([]string{"Page"})
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	// The storage script is added over a session of its own, and dropped
+	// with it once the first document has loaded.
+	client := cdp.Target{Caller: m.client}
+	id, err := client.AttachToTarget(ctx, targetID)
+	if err != nil {
+		return err
+	}
+	defer client.DetachFromTarget(context.WithoutCancel(ctx), id)
+	page := m.client.Session(id)
+
+	localJSON, _ := json.Marshal(local)
+	sessionJSON, _ := json.Marshal(tab.SessionStorage)
+	originJSON, _ := json.Marshal(origin(tab.URL))
+	script := fmt.Sprintf(restoreStorageScript, localJSON, sessionJSON, originJSON)
+	if err := (cdp.Page{Caller: page}).AddScriptToEvaluateOnNewDocument(ctx, script); err != nil {
+		return err
+	}
+	nav, err := cdp.Page{Caller: page}.Navigate(ctx, tab.URL)
+	if err != nil {
+		return err
+	}
+	if nav.ErrorText != "" {
+		return fmt.Errorf("navigation failed: %s", nav.ErrorText)
+	}
+	for {
+		select {
+		case e := <-sub.C:
+			if e.TargetID == targetID && e.Method == "Page.domContentEventFired" {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// origin returns the origin of an http(s) URL as pages see it.
+func origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host := u.Hostname()
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if p := u.Port(); p != "" && !(u.Scheme == "http" && p == "80") && !(u.Scheme == "https" && p == "443") {
+		host += ":" + p
+	}
+	return u.Scheme + "://" + strings.ToLower(host)
+}
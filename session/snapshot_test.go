@@ -0,0 +1,48 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyProfile(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "profile")
+	for _, name := range []string{"Default/Cookies", "Default/Local Storage/leveldb/000003.log", "Default/Cache/Cache_Data/data_0", "Local State"} {
+		path := filepath.Join(src, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink("host-1234", filepath.Join(src, "SingletonLock"))
+
+	if err := copyProfile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"Default/Cookies":                          true,
+		"Default/Local Storage/leveldb/000003.log": true,
+		"Local State":                              true,
+		"Default/Cache":                            false,
+		"SingletonLock":                            false,
+	} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); (err == nil) != want {
+			t.Errorf("%s copied: %v, want %v", name, err == nil, want)
+		}
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://Example.com/a?b":      "https://example.com",
+		"https://example.com:443/":     "https://example.com",
+		"http://localhost:8080/x":      "http://localhost:8080",
+		"http://[::1]:3000/":           "http://[::1]:3000",
+		"https://app.example.com:8443": "https://app.example.com:8443",
+	} {
+		if got := origin(url); got != want {
+			t.Errorf("origin(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
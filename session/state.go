@@ -0,0 +1,76 @@
+package session
+
+// State is where a session is in its lifecycle.
+type State string
+
+const (
+	// StateStarting: the browser is being launched.
+	StateStarting State = "starting"
+	// StateReady: the browser is up and nobody has used it yet, or it
+	// was just restarted.
+	StateReady State = "ready"
+	// StateRunning: a client has connected to or driven the session.
+	StateRunning State = "running"
+	// StateCrashed: the browser exited unexpectedly. A restart returns
+	// the session to StateReady.
+	StateCrashed State = "crashed"
+	// StateTerminating: the session is being stopped.
+	StateTerminating State = "terminating"
+	// StateExpired: the session reached the end of its duration.
+	StateExpired State = "expired"
+	// StateStopped: the session was stopped before it expired, by a
+	// client, a cap or the server.
+	StateStopped State = "stopped"
+)
+
+// stateTransitions lists the states each state may move to.
+var stateTransitions = map[State][]State{
+	StateStarting:    {StateReady, StateTerminating},
+	StateReady:       {StateRunning, StateCrashed, StateTerminating},
+	StateRunning:     {StateReady, StateCrashed, StateTerminating},
+	StateCrashed:     {StateReady, StateTerminating},
+	StateTerminating: {StateExpired, StateStopped},
+}
+
+// closed reports whether the session is stopping or stopped.
+func (st State) closed() bool {
+	return st == StateTerminating || st == StateExpired || st == StateStopped
+}
+
+// State returns the session's current state.
+func (s *Session) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// setStateLocked moves the session to a new state if the transition is
+// allowed and reports whether it did. s.mu must be held.
+func (s *Session) setStateLocked(to State) bool {
+	for _, next := range stateTransitions[s.state] {
+		if next == to {
+			s.state = to
+			return true
+		}
+	}
+	return false
+}
+
+// setState is setStateLocked for callers not holding s.mu. It notifies
+// the state callback of the change.
+func (s *Session) setState(to State) bool {
+	s.mu.Lock()
+	ok := s.setStateLocked(to)
+	onState := s.onState
+	s.mu.Unlock()
+
+	if ok && onState != nil {
+		onState(s, to)
+	}
+	return ok
+}
+
+// MarkRunning records that a client is using the session.
+func (s *Session) MarkRunning() {
+	s.setState(StateRunning)
+}
@@ -0,0 +1,32 @@
+package session
+
+import "testing"
+
+func TestStateTransitions(t *testing.T) {
+	s := &Session{state: StateStarting}
+
+	steps := []struct {
+		to State
+		ok bool
+	}{
+		{StateRunning, false}, // not launched yet
+		{StateReady, true},
+		{StateRunning, true},
+		{StateCrashed, true},
+		{StateRunning, false}, // a crashed browser must restart first
+		{StateReady, true},
+		{StateTerminating, true},
+		{StateReady, false}, // no way back once stopping
+		{StateExpired, true},
+		{StateTerminating, false},
+	}
+	for _, step := range steps {
+		from := s.State()
+		if ok := s.setState(step.to); ok != step.ok {
+			t.Fatalf("%s -> %s allowed = %v, want %v", from, step.to, ok, step.ok)
+		}
+	}
+	if s.State() != StateExpired || !s.State().closed() {
+		t.Errorf("final state = %s", s.State())
+	}
+}
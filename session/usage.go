@@ -0,0 +1,133 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Bandwidth cap actions.
+const (
+	CapActionTerminate = "terminate"
+	CapActionThrottle  = "throttle"
+)
+
+// capWarningRatio is the fraction of the bandwidth cap at which a warning
+// is emitted.
+const capWarningRatio = 0.9
+
+// throttledRate is the bandwidth, in bytes per second, a throttled session
+// is limited to.
+const throttledRate = 256 * 1024
+
+// usage holds the byte counters of a session.
+type usage struct {
+	cdp       atomic.Int64
+	stream    atomic.Int64
+	network   atomic.Int64
+	throttled atomic.Bool
+	warned    atomic.Bool
+}
+
+// Usage is a point-in-time view of a session's bandwidth usage.
+type Usage struct {
+	CDPBytes     int64  `json:"cdp_bytes"`
+	StreamBytes  int64  `json:"stream_bytes"`
+	NetworkBytes int64  `json:"network_bytes"`
+	TotalBytes   int64  `json:"total_bytes"`
+	CapBytes     int64  `json:"cap_bytes,omitempty"`
+	CapAction    string `json:"cap_action,omitempty"`
+	Throttled    bool   `json:"throttled"`
+}
+
+// Usage returns the session's current bandwidth usage.
+func (s *Session) Usage() Usage {
+	u := Usage{
+		CDPBytes:     s.usage.cdp.Load(),
+		StreamBytes:  s.usage.stream.Load(),
+		NetworkBytes: s.usage.network.Load(),
+		CapBytes:     s.opts.BandwidthCapBytes,
+		Throttled:    s.usage.throttled.Load(),
+	}
+	u.TotalBytes = u.CDPBytes + u.StreamBytes + u.NetworkBytes
+	if u.CapBytes > 0 {
+		u.CapAction = s.capAction()
+	}
+	return u
+}
+
+// CountCDPBytes records bytes relayed through the CDP proxy. It blocks to
+// slow the caller down while the session is throttled.
+func (s *Session) CountCDPBytes(n int) {
+	s.usage.cdp.Add(int64(n))
+	s.checkCap()
+	s.throttle(n)
+}
+
+// CountStreamBytes records bytes sent to preview and WebRTC viewers. It
+// blocks to slow the caller down while the session is throttled.
+func (s *Session) CountStreamBytes(n int) {
+	s.usage.stream.Add(int64(n))
+	s.checkCap()
+	s.throttle(n)
+}
+
+// countNetworkBytes records bytes the page downloaded, as reported by CDP.
+func (s *Session) countNetworkBytes(n int64) {
+	s.usage.network.Add(n)
+	s.checkCap()
+}
+
+func (s *Session) capAction() string {
+	if s.opts.BandwidthCapAction == CapActionThrottle {
+		return CapActionThrottle
+	}
+	return CapActionTerminate
+}
+
+// checkCap enforces the bandwidth cap once usage exceeds it.
+func (s *Session) checkCap() {
+	limit := s.opts.BandwidthCapBytes
+	if limit <= 0 || s.usage.throttled.Load() {
+		return
+	}
+	total := s.Usage().TotalBytes
+	if total > int64(float64(limit)*capWarningRatio) && s.usage.warned.CompareAndSwap(false, true) {
+		go s.warn(Warning{
+			Kind:    WarningQuota,
+			Message: fmt.Sprintf("Session has used %d of %d bandwidth bytes and will be %s at the cap", total, limit, pastTense(s.capAction())),
+		})
+	}
+	if total <= limit {
+		return
+	}
+
+	if s.capAction() == CapActionThrottle {
+		if s.usage.throttled.CompareAndSwap(false, true) {
+			log.Printf("Session %s exceeded its bandwidth cap of %d bytes, throttling", s.ID, limit)
+			s.addTimeline("throttled", "")
+			if m := s.mon.Load(); m != nil {
+				m.throttleAll()
+			}
+		}
+		return
+	}
+	log.Printf("Session %s exceeded its bandwidth cap of %d bytes, terminating", s.ID, limit)
+	go s.Stop()
+}
+
+// throttle sleeps long enough to keep a throttled session at throttledRate.
+func (s *Session) throttle(n int) {
+	if !s.usage.throttled.Load() {
+		return
+	}
+	time.Sleep(time.Duration(n) * time.Second / throttledRate)
+}
+
+func pastTense(action string) string {
+	if action == CapActionThrottle {
+		return "throttled"
+	}
+	return "terminated"
+}
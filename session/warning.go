@@ -0,0 +1,45 @@
+package session
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Warning kinds.
+const (
+	WarningExpiring = "expiring"
+	WarningQuota    = "quota"
+)
+
+// Warning tells clients that a session is about to be cut off so they can
+// checkpoint their work.
+type Warning struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// warn logs the warning, prints it to the console of every page so
+// in-page automation can see it, and notifies the manager.
+func (s *Session) warn(w Warning) {
+	log.Printf("Session %s: %s", s.ID, w.Message)
+	s.addTimeline("warning", w.Message)
+
+	if m := s.mon.Load(); m != nil {
+		msg, _ := json.Marshal("[browser-lab] " + w.Message)
+		m.evaluateAll("console.warn(" + string(msg) + ")")
+	}
+
+	s.mu.Lock()
+	onWarning := s.onWarning
+	s.mu.Unlock()
+	if onWarning != nil {
+		onWarning(s, w)
+	}
+}
+
+// setOnWarning registers the callback run when the session emits a warning.
+func (s *Session) setOnWarning(fn func(*Session, Warning)) {
+	s.mu.Lock()
+	s.onWarning = fn
+	s.mu.Unlock()
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Watermark placeholders, filled in per session and, for {time}, per frame.
+const (
+	WatermarkOwner   = "{owner}"
+	WatermarkSession = "{session}"
+	WatermarkTime    = "{time}"
+)
+
+var (
+	watermarkBackground = image.NewUniform(color.RGBA{0, 0, 0, 112})
+	watermarkText       = image.NewUniform(color.RGBA{220, 220, 220, 220})
+)
+
+// watermark is the text composited onto a session's frames and
+// screenshots so leaked images can be traced back to where they came from.
+type watermark struct {
+	text string // with {owner} and {session} filled in
+}
+
+// newWatermark fills in a watermark template for a session. It returns nil
+// for an empty template.
+func newWatermark(template, owner, sessionID string) *watermark {
+	if template == "" {
+		return nil
+	}
+	if owner == "" {
+		owner = "anonymous"
+	}
+	text := strings.NewReplacer(WatermarkOwner, owner, WatermarkSession, sessionID).Replace(template)
+	return &watermark{text: text}
+}
+
+// label returns the watermark's text at t. basicfont only has ASCII, so
+// anything else is replaced.
+func (w *watermark) label(t time.Time) string {
+	text := strings.ReplaceAll(w.text, WatermarkTime, t.UTC().Format("2006-01-02 15:04:05Z"))
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, text)
+}
+
+// draw writes the watermark in the bottom-right corner of img, and again,
+// fainter, across the middle so that cropping the corner does not remove
+// it. Text is doubled in size on frames wider than 800 pixels.
+func (w *watermark) draw(img draw.Image, t time.Time) {
+	face := basicfont.Face7x13
+	text := w.label(t)
+	width := font.MeasureString(face, text).Ceil() + 8
+	label := image.NewRGBA(image.Rect(0, 0, width, face.Height+4))
+	draw.Draw(label, label.Bounds(), watermarkBackground, image.Point{}, draw.Src)
+	d := font.Drawer{Dst: label, Src: watermarkText, Face: face, Dot: fixed.P(4, face.Ascent+2)}
+	d.DrawString(text)
+
+	b := img.Bounds()
+	scale := 1
+	if b.Dx() > 800 {
+		scale = 2
+	}
+	size := label.Bounds().Size().Mul(scale)
+	corner := image.Rectangle{Min: b.Max.Sub(size).Sub(image.Pt(8, 8)), Max: b.Max.Sub(image.Pt(8, 8))}
+	xdraw.NearestNeighbor.Scale(img, corner, label, label.Bounds(), draw.Over, nil)
+
+	middle := image.Rectangle{Min: image.Pt(b.Min.X+(b.Dx()-size.X)/2, b.Min.Y+(b.Dy()-size.Y)/2)}
+	middle.Max = middle.Min.Add(size)
+	faint := &xdraw.Options{SrcMask: image.NewUniform(color.Alpha{96})}
+	xdraw.NearestNeighbor.Scale(img, middle, label, label.Bounds(), draw.Over, faint)
+}
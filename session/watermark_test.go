@@ -0,0 +1,49 @@
+package session
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+func TestWatermark(t *testing.T) {
+	if newWatermark("", "alice", "s1") != nil {
+		t.Error("empty template gave a watermark")
+	}
+	w := newWatermark("{owner} {session} {time} ü", "", "s1")
+	at := time.Date(2030, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	if got, want := w.label(at), "anonymous s1 2030-01-01 11:00:00Z ?"; got != want {
+		t.Errorf("label = %q, want %q", got, want)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 1280, 720))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := &Session{watermark: w}
+	data, err := s.compositeJPEG(buf.Bytes(), "page", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bounds() != img.Bounds() {
+		t.Errorf("bounds = %v, want %v", out.Bounds(), img.Bounds())
+	}
+	for _, p := range []image.Point{{1270, 710}, {389, 345}} {
+		if r, _, _, _ := out.At(p.X, p.Y).RGBA(); r > 0xf000 {
+			t.Errorf("no watermark at %v", p)
+		}
+	}
+	if r, _, _, _ := out.At(10, 10).RGBA(); r < 0xf000 {
+		t.Error("watermark drawn outside its areas")
+	}
+}
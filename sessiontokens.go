@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"browser-server/auth"
+	"browser-server/session"
+)
+
+// Session token scopes: what a session's token opens.
+const (
+	tokenScopeCDP     = "cdp"
+	tokenScopePreview = "preview"
+)
+
+// sessionTokenRoutes are the routes that accept a session token, by path,
+// with the scope the token must have.
+var sessionTokenRoutes = map[string]string{
+	"/sessions/{id}/cdp":      tokenScopeCDP,
+	"/sessions/{id}/cdp/page": tokenScopeCDP,
+	"/sessions/{id}/preview":  tokenScopePreview,
+}
+
+// sessionTokensRequired makes the routes in sessionTokenRoutes refuse
+// requests without their session's token, even from holders of API keys
+// and when no authentication is configured, so that knowing a session's
+// ID is never enough to drive or watch it. SESSION_TOKENS_REQUIRED=false
+// turns it off.
+var sessionTokensRequired = true
+
+// setupSessionTokens reads SESSION_TOKENS_REQUIRED.
+func setupSessionTokens() error {
+	v := os.Getenv("SESSION_TOKENS_REQUIRED")
+	if v == "" {
+		return nil
+	}
+	required, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid SESSION_TOKENS_REQUIRED %q: %w", v, err)
+	}
+	sessionTokensRequired = required
+	return nil
+}
+
+// sessionToken returns the token that opens a session's routes of scope.
+// It is derived from the URL signing key, so it needs no storage and lasts
+// as long as the session.
+func sessionToken(id, scope string) string {
+	mac := hmac.New(sha256.New, urlSigningKey)
+	mac.Write([]byte("session\n" + scope + "\n" + id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSessionToken reports whether token opens a session's routes of
+// scope.
+func validSessionToken(id, scope, token string) bool {
+	return token != "" && len(urlSigningKey) > 0 && hmac.Equal([]byte(token), []byte(sessionToken(id, scope)))
+}
+
+// sessionTokenIdentity is who a session's token acts as: its owner, with
+// the least role the token's routes need, so it opens nothing of theirs
+// beyond them.
+func sessionTokenIdentity(sess *session.Session, scope string) *auth.Identity {
+	role := auth.RoleViewer
+	if scope == tokenScopeCDP {
+		role = auth.RoleOperator
+	}
+	return &auth.Identity{Name: sess.Owner, Role: role}
+}
+
+// sessionTokenAuth lets a request for a route of scope in with a valid
+// token for its session in the "token" query parameter, in place of other
+// credentials. When tokens are required, requests without one are
+// refused unless they carry a signed URL.
+func sessionTokenAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if validSessionToken(id, scope, r.URL.Query().Get("token")) {
+			sess, ok := requestSessions(r).GetSession(id)
+			if !ok {
+				http.Error(w, "Session not found", http.StatusNotFound)
+				return
+			}
+			next(w, r.WithContext(auth.WithIdentity(r.Context(), sessionTokenIdentity(sess, scope))))
+			return
+		}
+		if sessionTokensRequired {
+			if _, ok := signedIdentity(r); !ok {
+				http.Error(w, "Invalid or missing session token", http.StatusUnauthorized)
+				return
+			}
+		}
+		authenticate(next)(w, r)
+	}
+}
+
+// withSessionToken adds a session's token of scope to rawURL's query.
+// rawURL must not have a query yet.
+func withSessionToken(rawURL, id, scope string) string {
+	return rawURL + "?token=" + sessionToken(id, scope)
+}
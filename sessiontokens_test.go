@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"browser-server/auth"
+	"browser-server/session"
+)
+
+func TestSessionTokens(t *testing.T) {
+	urlSigningKey = []byte("test-key")
+	defer func() { urlSigningKey = nil }()
+
+	token := sessionToken("s1", tokenScopeCDP)
+	if !validSessionToken("s1", tokenScopeCDP, token) {
+		t.Error("token rejected")
+	}
+	for name, ok := range map[string]bool{
+		"other session": validSessionToken("s2", tokenScopeCDP, token),
+		"other scope":   validSessionToken("s1", tokenScopePreview, token),
+		"empty":         validSessionToken("s1", tokenScopeCDP, ""),
+	} {
+		if ok {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestSessionTokenAuth(t *testing.T) {
+	defer func(keys *auth.Store, required bool) {
+		keyStore, sessionTokensRequired = keys, required
+		urlSigningKey = nil
+	}(keyStore, sessionTokensRequired)
+	urlSigningKey = []byte("test-key")
+	r := newRouter(newServices(session.NewManager(), nil), []routeGroup{groupWHIP})
+
+	get := func(target string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w.Code
+	}
+	preview := "/v1/sessions/abc/preview"
+	withToken := withSessionToken(preview, "abc", tokenScopePreview)
+
+	keyStore = &auth.Store{}
+	if code := get(preview); code != 401 {
+		t.Errorf("preview without credentials: %d", code)
+	}
+	// The token gets past authentication, to find the session gone.
+	if code := get(withToken); code != 404 {
+		t.Errorf("preview with token: %d", code)
+	}
+	if code := get(withSessionToken(preview, "abc", tokenScopeCDP)); code != 401 {
+		t.Errorf("preview with a CDP token: %d", code)
+	}
+
+	// Tokens are required by default, which closes the route even without
+	// authentication.
+	keyStore = nil
+	if code := get(preview); code != 401 {
+		t.Errorf("preview without a required token: %d", code)
+	}
+	if code := get(withToken); code != 404 {
+		t.Errorf("preview with a required token: %d", code)
+	}
+
+	t.Setenv("SESSION_TOKENS_REQUIRED", "false")
+	if err := setupSessionTokens(); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(preview); code != 404 {
+		t.Errorf("preview without a token once not required: %d", code)
+	}
+}
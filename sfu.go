@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+// sfuSessionPlaceholder is replaced with the session ID in SFU URLs, so
+// each session gets a room or stream of its own.
+const sfuSessionPlaceholder = "{session}"
+
+// sfuConfig is where sessions are republished for large audiences. A
+// session is republished once it has Threshold viewers, as a VP8 track
+// published to the SFU's WHIP endpoint, and viewers beyond that which can
+// play video are sent to the SFU instead of costing this server a peer
+// connection each.
+type sfuConfig struct {
+	// WHIPURL is the SFU's WHIP ingest endpoint (SFU_WHIP_URL).
+	WHIPURL string
+	// Token is sent as a bearer token to WHIPURL (SFU_WHIP_TOKEN).
+	Token string
+	// ViewerURL is the SFU's WHEP endpoint viewers are redirected to
+	// (SFU_VIEWER_URL). Without it nobody is redirected, and the SFU's
+	// own player pages have to be shared some other way.
+	ViewerURL string
+	// Threshold is the number of viewers at which a session is
+	// republished (SFU_VIEWER_THRESHOLD, default 10).
+	Threshold int
+	// Bitrate is the VP8 encoder's target bitrate (SFU_BITRATE, default
+	// "1500k").
+	Bitrate string
+}
+
+// sfu is nil unless SFU_WHIP_URL is set.
+var sfu *sfuConfig
+
+// setupSFU reads the SFU settings.
+func setupSFU() error {
+	endpoint := os.Getenv("SFU_WHIP_URL")
+	if endpoint == "" {
+		return nil
+	}
+	if whipRequireE2EE {
+		return errors.New("SFU broadcasts cannot be end-to-end encrypted; unset WHIP_REQUIRE_E2EE to use an SFU")
+	}
+	cfg := &sfuConfig{
+		WHIPURL:   endpoint,
+		Token:     os.Getenv("SFU_WHIP_TOKEN"),
+		ViewerURL: os.Getenv("SFU_VIEWER_URL"),
+		Threshold: 10,
+		Bitrate:   "1500k",
+	}
+	for _, u := range []string{cfg.WHIPURL, cfg.ViewerURL} {
+		if u == "" {
+			continue
+		}
+		if p, err := url.Parse(u); err != nil || (p.Scheme != "http" && p.Scheme != "https") {
+			return fmt.Errorf("SFU URLs must be http(s) URLs, not %q", u)
+		}
+	}
+	if v := os.Getenv("SFU_VIEWER_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid SFU_VIEWER_THRESHOLD %q", v)
+		}
+		cfg.Threshold = n
+	}
+	if v := os.Getenv("SFU_BITRATE"); v != "" {
+		cfg.Bitrate = v
+	}
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		return fmt.Errorf("SFU broadcasts need ffmpeg: %w", err)
+	}
+	sfu = cfg
+	return nil
+}
+
+// sfuURL fills in a session's ID in an SFU URL.
+func sfuURL(template, sessionID string) string {
+	return strings.ReplaceAll(template, sfuSessionPlaceholder, url.PathEscape(sessionID))
+}
+
+// BroadcastStatus describes a session being republished to the SFU.
+type BroadcastStatus struct {
+	StartedAt time.Time `json:"started_at"`
+	// Live is set once the SFU has accepted the stream.
+	Live bool `json:"live"`
+	// ViewerURL is where the SFU plays the session, if configured.
+	ViewerURL string `json:"viewer_url,omitempty"`
+}
+
+// broadcast is a session being republished to the SFU.
+type broadcast struct {
+	startedAt time.Time
+	viewerURL string
+	live      atomic.Bool
+	cancel    context.CancelFunc
+}
+
+var (
+	broadcasts   = make(map[string]*broadcast)
+	broadcastsMu sync.Mutex
+)
+
+// sessionBroadcast describes a session's broadcast, if it has one.
+func sessionBroadcast(id string) (*BroadcastStatus, bool) {
+	broadcastsMu.Lock()
+	defer broadcastsMu.Unlock()
+	b, ok := broadcasts[id]
+	if !ok {
+		return nil, false
+	}
+	return &BroadcastStatus{StartedAt: b.startedAt, Live: b.live.Load(), ViewerURL: b.viewerURL}, true
+}
+
+// startBroadcast republishes a session to the SFU until it ends or the
+// broadcast is stopped. It returns at once; a session already being
+// republished is left alone.
+func startBroadcast(sess *session.Session) {
+	broadcastsMu.Lock()
+	defer broadcastsMu.Unlock()
+	if _, ok := broadcasts[sess.ID]; ok {
+		return
+	}
+	ctx, cancel := sessionContext(serverCtx, sess)
+	b := &broadcast{startedAt: time.Now(), cancel: cancel}
+	if sfu.ViewerURL != "" {
+		b.viewerURL = sfuURL(sfu.ViewerURL, sess.ID)
+	}
+	broadcasts[sess.ID] = b
+	go func() {
+		defer cancel()
+		log.Printf("SFU: Republishing session %s", sess.ID)
+		if err := b.run(ctx, sess); err != nil && ctx.Err() == nil {
+			log.Printf("SFU: Broadcast of session %s failed: %v", sess.ID, err)
+		}
+		log.Printf("SFU: Stopped republishing session %s", sess.ID)
+		broadcastsMu.Lock()
+		delete(broadcasts, sess.ID)
+		broadcastsMu.Unlock()
+	}()
+}
+
+// stopBroadcast ends a session's broadcast, reporting whether it had one.
+func stopBroadcast(id string) bool {
+	broadcastsMu.Lock()
+	defer broadcastsMu.Unlock()
+	b, ok := broadcasts[id]
+	if ok {
+		b.cancel()
+	}
+	return ok
+}
+
+// maybeBroadcast republishes a session once it has reached the SFU
+// threshold of viewers.
+func maybeBroadcast(sess *session.Session) {
+	if sfu != nil && sessionAudience(sess) >= sfu.Threshold {
+		startBroadcast(sess)
+	}
+}
+
+// sfuRedirect returns where to send a new viewer of a session instead of
+// serving it here: the SFU, once the session is live there and has
+// reached the threshold, for viewers whose offer can receive video.
+func sfuRedirect(sess *session.Session, offer string) (string, bool) {
+	if sfu == nil || !strings.Contains(offer, "m=video") || sessionAudience(sess) < sfu.Threshold {
+		return "", false
+	}
+	b, ok := sessionBroadcast(sess.ID)
+	if !ok || !b.Live || b.ViewerURL == "" {
+		return "", false
+	}
+	return b.ViewerURL, true
+}
+
+// run publishes the session's screencast to the SFU and feeds it until ctx
+// ends or the encoder or connection fails.
+func (b *broadcast) run(ctx context.Context, sess *session.Session) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pc, err := whipAPI.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			cancel()
+		}
+	})
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "screen", "browser-lab-"+sess.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly}); err != nil {
+		return err
+	}
+
+	resource, err := publishWHIP(ctx, pc, sfuURL(sfu.WHIPURL, sess.ID), sfu.Token)
+	if err != nil {
+		return err
+	}
+	defer deleteWHIPResource(resource, sfu.Token)
+	b.live.Store(true)
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, videoEncoderArgs(webrtc.MimeTypeVP8, sfu.Bitrate)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start encoder: %w", err)
+	}
+	defer cmd.Wait()
+
+	if err := feedScreencast(ctx, sess, stdin); err != nil {
+		return err
+	}
+
+	if err := writeIVF(stdout, track); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("encoder: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// writeIVF sends the frames of an IVF stream to track as they arrive,
+// each lasting until the next.
+func writeIVF(r io.Reader, track sampleWriter) error {
+	ivf, _, err := ivfreader.NewWith(r)
+	if err != nil {
+		return err
+	}
+	last := time.Now()
+	for {
+		frame, _, err := ivf.ParseNextFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		now := time.Now()
+		if err := track.WriteSample(media.Sample{Data: frame, Duration: now.Sub(last)}); err != nil {
+			return err
+		}
+		last = now
+	}
+}
+
+// publishWHIP offers pc's tracks to a WHIP endpoint and applies its answer,
+// returning the URL of the resource the endpoint created.
+func publishWHIP(ctx context.Context, pc *webrtc.PeerConnection, endpoint, token string) (string, error) {
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return "", err
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return "", err
+	}
+	// The answer is sent in one go, without trickle ICE.
+	select {
+	case <-gathered:
+	case <-time.After(10 * time.Second):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, endpoint, strings.NewReader(pc.LocalDescription().SDP))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/sdp")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("WHIP endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(answer)))
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("WHIP endpoint returned no resource: %w", err)
+	}
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: string(answer)}); err != nil {
+		return "", err
+	}
+	return location.String(), nil
+}
+
+// deleteWHIPResource ends a stream published with publishWHIP.
+func deleteWHIPResource(resource, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, resource, nil)
+	if err != nil {
+		return
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// startBroadcastHandler republishes a session to the SFU regardless of its
+// number of viewers.
+// POST /sessions/{id}/broadcast
+func startBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if sfu == nil {
+		http.Error(w, "No SFU is configured", http.StatusServiceUnavailable)
+		return
+	}
+	startBroadcast(sess)
+	b, _ := sessionBroadcast(sess.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(b)
+}
+
+// stopBroadcastHandler stops republishing a session to the SFU. It starts
+// again when the session next reaches the threshold of viewers.
+// DELETE /sessions/{id}/broadcast
+func stopBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !stopBroadcast(sess.ID) {
+		http.Error(w, "Session is not being broadcast", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
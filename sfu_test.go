@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSFUURL(t *testing.T) {
+	if got := sfuURL("https://sfu.example.com/whip/{session}", "a b"); got != "https://sfu.example.com/whip/a%20b" {
+		t.Errorf("sfuURL = %q", got)
+	}
+}
+
+func TestPublishWHIP(t *testing.T) {
+	api, err := newWHIPAPI(session.IPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var answerer *webrtc.PeerConnection
+	deleted := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			deleted <- r.URL.Path
+			return
+		}
+		offer, _ := io.ReadAll(r.Body)
+		var err error
+		if answerer, err = api.NewPeerConnection(webrtc.Configuration{}); err != nil {
+			t.Error(err)
+			return
+		}
+		answerer.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(offer)})
+		answer, _ := answerer.CreateAnswer(nil)
+		gathered := webrtc.GatheringCompletePromise(answerer)
+		answerer.SetLocalDescription(answer)
+		<-gathered
+		w.Header().Set("Location", "/whip/resource-1")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, answerer.LocalDescription().SDP)
+	}))
+	defer srv.Close()
+	defer func() {
+		if answerer != nil {
+			answerer.Close()
+		}
+	}()
+
+	publisher := func() *webrtc.PeerConnection {
+		pc, err := api.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		track, _ := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "screen", "test")
+		pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly})
+		return pc
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	rejected := publisher()
+	defer rejected.Close()
+	if _, err := publishWHIP(ctx, rejected, srv.URL+"/whip/s1", "wrong"); err == nil {
+		t.Error("publish accepted with a wrong token")
+	}
+	pc := publisher()
+	defer pc.Close()
+	resource, err := publishWHIP(ctx, pc, srv.URL+"/whip/s1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resource != srv.URL+"/whip/resource-1" {
+		t.Errorf("resource = %q", resource)
+	}
+	if pc.RemoteDescription() == nil {
+		t.Error("answer not applied")
+	}
+	deleteWHIPResource(resource, "secret")
+	if path := <-deleted; path != "/whip/resource-1" {
+		t.Errorf("deleted %q", path)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"browser-server/session"
+)
+
+// shutdownDrainTimeout is how long shutdown waits for running sessions to
+// end on their own before stopping them (SHUTDOWN_DRAIN_TIMEOUT, 0 stops
+// them right away).
+var shutdownDrainTimeout time.Duration
+
+// setupShutdown reads SHUTDOWN_DRAIN_TIMEOUT.
+func setupShutdown() error {
+	if v := os.Getenv("SHUTDOWN_DRAIN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		shutdownDrainTimeout = d
+	}
+	return nil
+}
+
+// drainSessions refuses new sessions and waits up to timeout for the
+// running ones to end, or until another signal arrives on signals.
+func drainSessions(sessions *session.Manager, timeout time.Duration, signals <-chan os.Signal) {
+	sessions.SetDraining(true)
+	running := len(sessions.ListSessions())
+	if running == 0 || timeout <= 0 {
+		return
+	}
+	log.Printf("Waiting up to %s for %d sessions to end; signal again to stop them now", timeout, running)
+	deadline := time.After(timeout)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if len(sessions.ListSessions()) == 0 {
+				return
+			}
+		case <-deadline:
+			log.Printf("Stopping %d sessions still running", len(sessions.ListSessions()))
+			return
+		case <-signals:
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"browser-server/auth"
+)
+
+// urlSigningKey signs the expiring links job webhooks and embeds carry
+// (URL_SIGNING_SECRET). Without a configured secret a random key is used,
+// so links stop working when the server restarts.
+var urlSigningKey []byte
+
+// setupSignedURLs loads or generates the URL signing key.
+func setupSignedURLs() error {
+	if v := os.Getenv("URL_SIGNING_SECRET"); v != "" {
+		urlSigningKey = []byte(v)
+		return nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	urlSigningKey = key
+	return nil
+}
+
+// signPath returns path with a signature that lets anyone GET it until
+// expires, without credentials. The signature also covers the query path
+// may carry, so its parameters cannot be changed either.
+func signPath(path string, expires time.Time) string {
+	p, query, _ := strings.Cut(path, "?")
+	q, _ := url.ParseQuery(query)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	sig := pathSignature(p, q.Encode(), exp)
+	q.Set("expires", exp)
+	q.Set("signature", sig)
+	return p + "?" + q.Encode()
+}
+
+func pathSignature(path, query, expires string) string {
+	msg := "GET\n" + path
+	if query != "" {
+		msg += "?" + query
+	}
+	mac := hmac.New(sha256.New, urlSigningKey)
+	mac.Write([]byte(msg + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedIdentity accepts a GET of a path signed with signPath that has
+// not expired. The identity is a viewer bound to that path: only
+// handlers the path was signed for accept it in place of more, see
+// signedFor.
+func signedIdentity(r *http.Request) (*auth.Identity, bool) {
+	q := r.URL.Query()
+	exp, sig := q.Get("expires"), q.Get("signature")
+	q.Del("expires")
+	q.Del("signature")
+	if r.Method != http.MethodGet || sig == "" || len(urlSigningKey) == 0 {
+		return nil, false
+	}
+	n, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > n {
+		return nil, false
+	}
+	if !hmac.Equal([]byte(sig), []byte(pathSignature(r.URL.Path, q.Encode(), exp))) {
+		return nil, false
+	}
+	return &auth.Identity{Name: "signed-url", Role: auth.RoleViewer, SignedPath: r.URL.Path}, true
+}
+
+// signedFor reports whether the caller holds a signed URL for this very
+// request. The server only signs requests their signer was allowed to
+// make, so the request's own route and handler accept the signature in
+// place of the role or ownership they need; nothing else does.
+func signedFor(r *http.Request) bool {
+	id, ok := auth.IdentityFromContext(r.Context())
+	return ok && id.SignedPath != "" && id.SignedPath == r.URL.Path && r.Method == http.MethodGet
+}
+
+// externalURL is the scheme, host and forwarded prefix clients reach the
+// server at.
+func externalURL(r *http.Request) string {
+	return resolveScheme(r) + "://" + resolveHost(r) + forwardedPrefix(r)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedURLs(t *testing.T) {
+	urlSigningKey = []byte("test-key")
+	defer func() { urlSigningKey = nil }()
+
+	signed := signPath("/v1/crawls/c1", time.Now().Add(time.Hour))
+	if _, ok := signedIdentity(httptest.NewRequest("GET", signed, nil)); !ok {
+		t.Errorf("signed URL %s rejected", signed)
+	}
+	for name, target := range map[string]string{
+		"other path":  strings.Replace(signed, "c1", "c2", 1),
+		"unsigned":    "/v1/crawls/c1",
+		"expired":     signPath("/v1/crawls/c1", time.Now().Add(-time.Minute)),
+		"added query": signed + "&control=1",
+	} {
+		if _, ok := signedIdentity(httptest.NewRequest("GET", target, nil)); ok {
+			t.Errorf("%s: %s accepted", name, target)
+		}
+	}
+	withQuery := signPath("/v1/sessions/s1/embed?control=1", time.Now().Add(time.Hour))
+	if _, ok := signedIdentity(httptest.NewRequest("GET", withQuery, nil)); !ok {
+		t.Errorf("signed URL %s rejected", withQuery)
+	}
+	if _, ok := signedIdentity(httptest.NewRequest("GET", strings.Replace(withQuery, "control=1", "control=0", 1), nil)); ok {
+		t.Error("signed query parameter changed without detection")
+	}
+	if _, ok := signedIdentity(httptest.NewRequest("DELETE", signed, nil)); ok {
+		t.Error("signed URL accepted for DELETE")
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"browser-server/chunkstore"
+	"browser-server/session"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// snapshotTimeout bounds how long saving a snapshot may take.
+const snapshotTimeout = 2 * time.Minute
+
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+var (
+	// snapshotsDir holds a directory per snapshot with its snapshot.json,
+	// and the chunks of their profiles in chunks (SNAPSHOTS_DIR).
+	snapshotsDir   = filepath.Join(os.TempDir(), "browser-lab-snapshots")
+	snapshotChunks *chunkstore.Store
+
+	snapshotsMu sync.Mutex
+	snapshots   = map[snapshotKey]*storedSnapshot{}
+)
+
+// snapshotKey identifies a snapshot: names are only unique per owner, so
+// that they reveal nothing about other owners' snapshots.
+type snapshotKey struct {
+	owner, name string
+}
+
+// storedSnapshot is a named snapshot as it is kept in its directory's
+// snapshot.json.
+type storedSnapshot struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+	session.Snapshot
+	// Profile lists the chunks of the profile copy, and AddedBytes is how
+	// much the chunks it added to the store take.
+	Profile    *chunkstore.Manifest `json:"profile"`
+	AddedBytes int64                `json:"added_bytes"`
+
+	dir string
+}
+
+// setupSnapshots reads SNAPSHOTS_DIR and the snapshots saved in it, which
+// outlive restarts of the server, and removes the chunks none of them
+// uses.
+func setupSnapshots() error {
+	if v := os.Getenv("SNAPSHOTS_DIR"); v != "" {
+		snapshotsDir = v
+	}
+	store, err := chunkstore.Open(filepath.Join(snapshotsDir, "chunks"))
+	if err != nil {
+		return err
+	}
+	snapshotChunks = store
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == "chunks" {
+			continue
+		}
+		dir := filepath.Join(snapshotsDir, e.Name())
+		data, err := os.ReadFile(filepath.Join(dir, "snapshot.json"))
+		if err != nil {
+			// Left over from a snapshot that failed half way.
+			os.RemoveAll(dir)
+			continue
+		}
+		var s storedSnapshot
+		if err := json.Unmarshal(data, &s); err != nil {
+			log.Printf("Snapshot: ignoring %s: %v", dir, err)
+			continue
+		}
+		s.dir = dir
+		if s.Profile == nil {
+			// Saved before profiles were chunked.
+			if err := chunkProfile(&s); err != nil {
+				log.Printf("Snapshot: ignoring %s: %v", dir, err)
+				continue
+			}
+		} else if err := snapshotChunks.Retain(s.Profile); err != nil {
+			log.Printf("Snapshot: ignoring %s: %v", dir, err)
+			continue
+		}
+		snapshots[snapshotKey{s.Owner, s.Name}] = &s
+	}
+	if n := snapshotChunks.Prune(); n > 0 {
+		log.Printf("Snapshot: removed %d unused chunks", n)
+	}
+	if len(snapshots) > 0 {
+		st := snapshotChunks.Stats()
+		log.Printf("Snapshot: %d snapshots in %d chunks (%d MB)", len(snapshots), st.Chunks, st.Bytes>>20)
+	}
+	return nil
+}
+
+// chunkProfile moves the profile copy in a snapshot's directory into the
+// chunk store and saves the snapshot with its manifest.
+func chunkProfile(s *storedSnapshot) error {
+	profile := filepath.Join(s.dir, "profile")
+	m, added, err := snapshotChunks.Put(profile)
+	if err != nil {
+		return err
+	}
+	s.Profile, s.AddedBytes = m, added
+	if err := writeSnapshot(s); err != nil {
+		snapshotChunks.Release(m)
+		return err
+	}
+	return os.RemoveAll(profile)
+}
+
+// findSnapshot returns the snapshot of owner with a name.
+func findSnapshot(owner, name string) (*storedSnapshot, bool) {
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+	s, ok := snapshots[snapshotKey{owner, name}]
+	return s, ok
+}
+
+// SnapshotRequest is the body of POST /sessions/{id}/snapshot.
+type SnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+// SnapshotResponse describes a snapshot without its cookies and storage,
+// which hold credentials.
+type SnapshotResponse struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Tabs are the URLs the snapshot reopens.
+	Tabs    []string `json:"tabs"`
+	Cookies int      `json:"cookies"`
+	// SizeBytes is the size of the profile copy, and AddedBytes the disk
+	// space it took beside the chunks it shares with other snapshots.
+	SizeBytes  int64 `json:"size_bytes"`
+	AddedBytes int64 `json:"added_bytes"`
+}
+
+func newSnapshotResponse(s *storedSnapshot) SnapshotResponse {
+	tabs := make([]string, len(s.Tabs))
+	for i, t := range s.Tabs {
+		tabs[i] = t.URL
+	}
+	return SnapshotResponse{
+		Name:       s.Name,
+		Owner:      s.Owner,
+		SessionID:  s.SessionID,
+		CreatedAt:  s.CreatedAt,
+		Tabs:       tabs,
+		Cookies:    len(s.Cookies),
+		SizeBytes:  s.SizeBytes,
+		AddedBytes: s.AddedBytes,
+	}
+}
+
+// createSnapshotHandler saves a session's profile, open tabs, cookies and
+// storage under a name, replacing a snapshot of the caller's with that
+// name. Sessions created with "from_snapshot" start from it.
+// POST /sessions/{id}/snapshot {"name": "signed-in"}
+func createSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req SnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !snapshotName.MatchString(req.Name) {
+		http.Error(w, "name must be 1 to 64 letters, digits, dots, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+	dir := filepath.Join(snapshotsDir, uuid.New().String())
+	ctx, cancel := sessionContext(r.Context(), sess)
+	defer cancel()
+	ctx, cancelSave := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancelSave()
+	snap, err := sess.SaveSnapshot(ctx, filepath.Join(dir, "profile"))
+	if err != nil {
+		os.RemoveAll(dir)
+		http.Error(w, "Failed to save snapshot: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	s := &storedSnapshot{
+		Name:      req.Name,
+		Owner:     ownerName(r),
+		SessionID: sess.ID,
+		CreatedAt: time.Now(),
+		Snapshot:  *snap,
+		dir:       dir,
+	}
+	if err := chunkProfile(s); err != nil {
+		os.RemoveAll(dir)
+		http.Error(w, "Failed to save snapshot: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	key := snapshotKey{s.Owner, s.Name}
+	snapshotsMu.Lock()
+	old := snapshots[key]
+	snapshots[key] = s
+	snapshotsMu.Unlock()
+	if old != nil {
+		removeSnapshot(old)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newSnapshotResponse(s))
+}
+
+// writeSnapshot writes snapshot.json, readable only by the server since
+// it holds the cookies.
+func writeSnapshot(s *storedSnapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, "snapshot.json"), data, 0600)
+}
+
+// listSnapshotsHandler lists the snapshots the caller may start sessions
+// from, newest first.
+// GET /snapshots?limit=50&offset=0
+func listSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseListParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	snapshotsMu.Lock()
+	list := make([]SnapshotResponse, 0, len(snapshots))
+	for _, s := range snapshots {
+		if canControlOwner(r, s.Owner) {
+			list = append(list, newSnapshotResponse(s))
+		}
+	}
+	snapshotsMu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].Name < list[j].Name
+	})
+	start, end := params.page(w, r, len(list))
+	out, err := params.selectFields(list[start:end])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONWithETag(w, r, out)
+}
+
+// snapshotHandler describes a snapshot of the caller's, or of the owner
+// an admin names with ?owner=, or deletes it for DELETE.
+// GET, DELETE /snapshots/{name}?owner=
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	owner := ownerName(r)
+	if o, ok := r.URL.Query()["owner"]; ok {
+		owner = o[0]
+	}
+	key := snapshotKey{owner, mux.Vars(r)["name"]}
+	s, ok := findSnapshot(key.owner, key.name)
+	// Other owners' snapshots are not found rather than forbidden, so
+	// their names stay private.
+	if !ok || !canControlOwner(r, s.Owner) {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		snapshotsMu.Lock()
+		listed := snapshots[key] == s
+		if listed {
+			delete(snapshots, key)
+		}
+		snapshotsMu.Unlock()
+		// Only one of concurrent deletes releases the snapshot's chunks.
+		if listed {
+			removeSnapshot(s)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSONWithETag(w, r, newSnapshotResponse(s))
+}
+
+// removeSnapshot deletes a snapshot that is no longer listed, and the
+// chunks nothing else retains. Sessions being started from it retain
+// its chunks until they have launched.
+func removeSnapshot(s *storedSnapshot) {
+	os.RemoveAll(s.dir)
+	snapshotChunks.Release(s.Profile)
+}
+
+// snapshotOptions resolves the from_snapshot of a create request, one of
+// the caller's own snapshots. The chunks of its profile are retained
+// until release is called, once the sessions started from it have
+// launched, so deleting or replacing the snapshot meanwhile cannot take
+// them from under a restore.
+func snapshotOptions(r *http.Request, name string) (snap *session.Snapshot, release func(), err error) {
+	snapshotsMu.Lock()
+	s, ok := snapshots[snapshotKey{ownerName(r), name}]
+	if ok {
+		// Removal releases the snapshot's own reference only once it is
+		// unlisted, so the chunks are all there.
+		err = snapshotChunks.Retain(s.Profile)
+	}
+	snapshotsMu.Unlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown snapshot %q", name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	copied := s.Snapshot
+	copied.RestoreProfile = func(dir string) error { return snapshotChunks.Restore(s.Profile, dir) }
+	var once sync.Once
+	release = func() {
+		once.Do(func() { snapshotChunks.Release(s.Profile) })
+	}
+	return &copied, release, nil
+}
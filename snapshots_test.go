@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"browser-server/auth"
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSetupSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SNAPSHOTS_DIR", dir)
+	defer func(d string, s map[snapshotKey]*storedSnapshot) { snapshotsDir, snapshots = d, s }(snapshotsDir, snapshots)
+	snapshots = map[snapshotKey]*storedSnapshot{}
+
+	saved := &storedSnapshot{
+		Name:     "signed-in",
+		Snapshot: session.Snapshot{Tabs: []session.SnapshotTab{{URL: "https://example.com/"}}},
+		dir:      filepath.Join(dir, "a"),
+	}
+	// Saved with the profile copy in its directory, as before the chunk
+	// store.
+	os.MkdirAll(filepath.Join(saved.dir, "profile", "Default"), 0700)
+	os.WriteFile(filepath.Join(saved.dir, "profile", "Default", "Preferences"), []byte("{}"), 0600)
+	if err := writeSnapshot(saved); err != nil {
+		t.Fatal(err)
+	}
+	// A snapshot that failed before it was written.
+	os.MkdirAll(filepath.Join(dir, "b", "profile"), 0700)
+
+	if err := setupSnapshots(); err != nil {
+		t.Fatal(err)
+	}
+	s, ok := findSnapshot("", "signed-in")
+	if !ok || s.Profile == nil || len(s.Profile.Files) != 2 || len(s.Tabs) != 1 {
+		t.Fatalf("loaded snapshot = %+v, %v", s, ok)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "profile")); !os.IsNotExist(err) {
+		t.Error("profile copy not moved to the chunk store")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Error("unfinished snapshot not removed")
+	}
+
+	snap, release, err := snapshotOptions(httptest.NewRequest("POST", "/sessions", nil), "signed-in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	restored := t.TempDir()
+	if err := snap.RestoreProfile(restored); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(restored, "Default", "Preferences")); string(data) != "{}" {
+		t.Errorf("restored Preferences = %q", data)
+	}
+
+	data, _ := json.Marshal(newSnapshotResponse(s))
+	if string(data) != `{"name":"signed-in","session_id":"","created_at":"0001-01-01T00:00:00Z","tabs":["https://example.com/"],"cookies":0,"size_bytes":0,"added_bytes":2}` {
+		t.Errorf("response = %s", data)
+	}
+}
+
+func TestSnapshotRemovedWhileLaunching(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SNAPSHOTS_DIR", dir)
+	defer func(d string, s map[snapshotKey]*storedSnapshot) { snapshotsDir, snapshots = d, s }(snapshotsDir, snapshots)
+	snapshots = map[snapshotKey]*storedSnapshot{}
+	if err := setupSnapshots(); err != nil {
+		t.Fatal(err)
+	}
+	s := &storedSnapshot{Name: "signed-in", Owner: "alice", dir: filepath.Join(dir, "a")}
+	os.MkdirAll(filepath.Join(s.dir, "profile", "Default"), 0700)
+	os.WriteFile(filepath.Join(s.dir, "profile", "Default", "Preferences"), []byte("{}"), 0600)
+	if err := chunkProfile(s); err != nil {
+		t.Fatal(err)
+	}
+	snapshots[snapshotKey{"alice", "signed-in"}] = s
+
+	as := func(name string) *http.Request {
+		r := httptest.NewRequest("POST", "/sessions", nil)
+		return r.WithContext(auth.WithIdentity(r.Context(), &auth.Identity{Name: name, Role: auth.RoleOperator}))
+	}
+	if _, _, err := snapshotOptions(as("bob"), "signed-in"); err == nil {
+		t.Error("bob started from alice's snapshot")
+	}
+	snap, release, err := snapshotOptions(as("alice"), "signed-in")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted while a session is being started from it, the snapshot's
+	// chunks stay until the launch is done with them.
+	delete(snapshots, snapshotKey{"alice", "signed-in"})
+	removeSnapshot(s)
+	if err := snap.RestoreProfile(t.TempDir()); err != nil {
+		t.Errorf("restore after delete: %v", err)
+	}
+	release()
+	release()
+	if st := snapshotChunks.Stats(); st.Chunks != 0 {
+		t.Errorf("%d chunks left after the launch", st.Chunks)
+	}
+	if _, err := os.Stat(s.dir); !os.IsNotExist(err) {
+		t.Error("snapshot directory left after the launch")
+	}
+}
+
+func TestSnapshotNamesPerOwner(t *testing.T) {
+	defer func(s map[snapshotKey]*storedSnapshot) { snapshots = s }(snapshots)
+	snapshots = map[snapshotKey]*storedSnapshot{
+		{"alice", "signed-in"}: {Name: "signed-in", Owner: "alice"},
+	}
+
+	get := func(target string, id *auth.Identity) int {
+		r := httptest.NewRequest("GET", target, nil)
+		r = mux.SetURLVars(r.WithContext(auth.WithIdentity(r.Context(), id)), map[string]string{"name": "signed-in"})
+		w := httptest.NewRecorder()
+		snapshotHandler(w, r)
+		return w.Code
+	}
+	alice := &auth.Identity{Name: "alice", Role: auth.RoleOperator}
+	bob := &auth.Identity{Name: "bob", Role: auth.RoleOperator}
+	admin := &auth.Identity{Name: "root", Role: auth.RoleAdmin}
+	for _, c := range []struct {
+		target string
+		id     *auth.Identity
+		want   int
+	}{
+		{"/v1/snapshots/signed-in", alice, http.StatusOK},
+		// Bob's own namespace has no such snapshot, and alice's is not
+		// his to look into.
+		{"/v1/snapshots/signed-in", bob, http.StatusNotFound},
+		{"/v1/snapshots/signed-in?owner=alice", bob, http.StatusNotFound},
+		{"/v1/snapshots/signed-in", admin, http.StatusNotFound},
+		{"/v1/snapshots/signed-in?owner=alice", admin, http.StatusOK},
+	} {
+		if code := get(c.target, c.id); code != c.want {
+			t.Errorf("%s as %s: %d, want %d", c.target, c.id.Name, code, c.want)
+		}
+	}
+}
@@ -5,12 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 	"testing"
 	"time"
 
@@ -30,34 +28,6 @@ type SessionResponse struct {
 	PreviewURL string    `json:"preview_url"`
 }
 
-type mockTransport struct {
-	wsURL string
-	rt    http.RoundTripper
-}
-
-func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	if strings.HasSuffix(req.URL.Path, "/json/version") {
-		body := fmt.Sprintf(`{
-			"Browser": "Chrome/Headless",
-			"Protocol-Version": "1.3",
-			"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
-			"V8-Version": "12.0.0",
-			"WebKit-Version": "537.36 (@0)",
-			"webSocketDebuggerUrl": "%s"
-		}`, t.wsURL)
-		
-		return &http.Response{
-			StatusCode: 200,
-			Body:       io.NopCloser(strings.NewReader(body)),
-			Header:     make(http.Header),
-		}, nil
-	}
-	if t.rt == nil {
-		return http.DefaultTransport.RoundTrip(req)
-	}
-	return t.rt.RoundTrip(req)
-}
-
 func TestIntegration(t *testing.T) {
 	// 1. Build the server
 	t.Log("Building server...")
@@ -101,18 +71,9 @@ func TestIntegration(t *testing.T) {
 	// 5. Connect CDP and perform actions
 	t.Log("Connecting to CDP...")
 
-	// Intercept http.DefaultTransport to mock the version check
-	originalTransport := http.DefaultTransport
-	mock := &mockTransport{
-		wsURL: sessResp.CDPURL,
-		rt:    originalTransport,
-	}
-	http.DefaultTransport = mock
-	defer func() { http.DefaultTransport = originalTransport }()
-
-	// Create a new allocator context using the remote WebSocket URL
-	// chromedp uses http.DefaultClient to check /json/version
-	allocatorContext, cancelAllocator := chromedp.NewRemoteAllocator(context.Background(), sessResp.CDPURL)
+	// Connect to the session's CDP URL as it is, rather than have chromedp
+	// look the browser's URL up at /json/version
+	allocatorContext, cancelAllocator := chromedp.NewRemoteAllocator(context.Background(), sessResp.CDPURL, chromedp.NoModifyURL)
 	defer cancelAllocator()
 
 	// Create a CDP context
@@ -0,0 +1,264 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DialFunc opens a connection to addr.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// SOCKS5 constants (RFC 1928).
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksUserPass     = 2
+	socksNoAcceptable = 0xff
+	socksConnect      = 1
+	socksIPv4         = 1
+	socksDomain       = 3
+	socksIPv6         = 4
+
+	socksSucceeded           = 0
+	socksGeneralFailure      = 1
+	socksCommandNotSupported = 7
+	socksAddressNotSupported = 8
+)
+
+// handshakeTimeout bounds the SOCKS negotiation of a client.
+const handshakeTimeout = 10 * time.Second
+
+// ServeSOCKS accepts SOCKS5 CONNECT requests on ln and opens them with
+// dial, until ln is closed. Only unauthenticated clients are accepted, so
+// ln must not be reachable by others.
+func ServeSOCKS(ln net.Listener, dial DialFunc) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go serveSOCKSConn(conn, dial)
+	}
+}
+
+func serveSOCKSConn(conn net.Conn, dial DialFunc) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	addr, err := socksHandshake(conn)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	upstream, err := dial(ctx, "tcp", addr)
+	cancel()
+	if err != nil {
+		socksReply(conn, socksGeneralFailure)
+		return
+	}
+	defer upstream.Close()
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// socksHandshake negotiates the method and reads a CONNECT request,
+// returning its host:port.
+func socksHandshake(conn net.Conn) (string, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+		return "", err
+	}
+	if hdr[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksNoAcceptable {
+		return "", errors.New("client requires authentication")
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return "", err
+	}
+	if req[1] != socksConnect {
+		socksReply(conn, socksCommandNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, 4)
+		if req[3] == socksIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAddressNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// socksReply answers a request. The bound address is not meaningful for
+// a tunnel and is reported as 0.0.0.0:0.
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// DialSOCKS opens addr through the SOCKS5 proxy at proxy, authenticating
+// with user and password (RFC 1929), or not at all if user is empty. The
+// host name is passed to the proxy unresolved.
+func DialSOCKS(ctx context.Context, proxy, user, password, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || len(host) > 255 || len(user) > 255 || len(password) > 255 {
+		return nil, fmt.Errorf("invalid SOCKS request for %s", addr)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxy)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	}
+	if err := socksClientHandshake(conn, user, password, host, port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func socksClientHandshake(conn net.Conn, user, password, host string, port int) error {
+	want := byte(socksUserPass)
+	if user == "" {
+		want = socksNoAuth
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, want}); err != nil {
+		return err
+	}
+	var method [2]byte
+	if _, err := io.ReadFull(conn, method[:]); err != nil {
+		return err
+	}
+	if method[1] != want {
+		if want == socksNoAuth {
+			return errors.New("SOCKS proxy requires authentication")
+		}
+		return errors.New("SOCKS proxy refused password authentication")
+	}
+	if want == socksUserPass {
+		auth := []byte{1, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		var status [2]byte
+		if _, err := io.ReadFull(conn, status[:]); err != nil {
+			return err
+		}
+		if status[1] != 0 {
+			return errors.New("SOCKS proxy rejected the credentials")
+		}
+	}
+
+	req := []byte{socksVersion, socksConnect, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, socksIPv4), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, socksIPv6), ip.To16()...)
+	} else {
+		req = append(append(req, socksDomain, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != socksSucceeded {
+		return fmt.Errorf("SOCKS proxy could not connect to %s:%d (code %d)", host, port, reply[1])
+	}
+	// Skip the bound address.
+	var skip int
+	switch reply[3] {
+	case socksIPv4:
+		skip = 4
+	case socksIPv6:
+		skip = 16
+	case socksDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("unsupported SOCKS address type %d", reply[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
@@ -0,0 +1,215 @@
+// Package tunnel routes browser traffic through an SSH bastion, Tor or an
+// upstream proxy by serving a local SOCKS5 proxy whose connections are
+// opened elsewhere.
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Config describes the SSH server to tunnel through.
+type Config struct {
+	// Host is host or host:port (port 22 by default).
+	Host string `json:"host"`
+	User string `json:"user"`
+	// PrivateKey is a PEM-encoded private key, optionally encrypted with
+	// Passphrase.
+	PrivateKey string `json:"private_key"`
+	Passphrase string `json:"passphrase,omitempty"`
+	// HostKey is the server's public key in authorized_keys format, e.g.
+	// "ssh-ed25519 AAAA...".
+	HostKey string `json:"host_key"`
+	// InsecureIgnoreHostKey skips host key verification.
+	InsecureIgnoreHostKey bool `json:"insecure_ignore_host_key"`
+}
+
+// Validate checks the configuration without connecting.
+func (c Config) Validate() error {
+	_, err := c.clientConfig()
+	return err
+}
+
+func (c Config) addr() string {
+	if _, _, err := net.SplitHostPort(c.Host); err == nil {
+		return c.Host
+	}
+	return net.JoinHostPort(c.Host, "22")
+}
+
+func (c Config) clientConfig() (*ssh.ClientConfig, error) {
+	if c.Host == "" || c.User == "" {
+		return nil, errors.New("ssh tunnel needs a host and a user")
+	}
+	if c.PrivateKey == "" {
+		return nil, errors.New("ssh tunnel needs a private key")
+	}
+	var signer ssh.Signer
+	var err error
+	if c.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(c.PrivateKey), []byte(c.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey([]byte(c.PrivateKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh private key: %w", err)
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case c.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh host key: %w", err)
+		}
+		hostKey = ssh.FixedHostKey(key)
+	case c.InsecureIgnoreHostKey:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, errors.New("ssh tunnel needs the server's host_key (or insecure_ignore_host_key)")
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKey,
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// Tunnel is a local SOCKS5 proxy whose connections are opened by an SSH
+// server. If the SSH connection drops, the next proxied connection
+// reconnects.
+type Tunnel struct {
+	addr   string
+	config *ssh.ClientConfig
+	allow  func(host string) bool
+	ln     net.Listener
+
+	mu     sync.Mutex
+	client *sshConn
+	closed bool
+}
+
+// sshConn is an SSH connection that knows when it has gone away.
+type sshConn struct {
+	*ssh.Client
+	done chan struct{}
+}
+
+// Open connects to the SSH server and starts the local proxy on a random
+// loopback port. If allow is not nil, only hosts it allows are proxied;
+// the browser does not resolve names itself when using a SOCKS5 proxy,
+// so this is where a domain allowlist has to be enforced.
+func Open(ctx context.Context, c Config, allow func(host string) bool) (*Tunnel, error) {
+	config, err := c.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	t := &Tunnel{addr: c.addr(), config: config, allow: allow}
+	if t.client, err = t.connect(ctx); err != nil {
+		return nil, err
+	}
+	t.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.client.Close()
+		return nil, err
+	}
+	go ServeSOCKS(t.ln, t.dial)
+	return t, nil
+}
+
+func (t *Tunnel) connect(ctx context.Context) (*sshConn, error) {
+	conn, err := (&net.Dialer{Timeout: t.config.Timeout}).DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("ssh tunnel: %w", err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.addr, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh tunnel: %w", err)
+	}
+	client := &sshConn{Client: ssh.NewClient(c, chans, reqs), done: make(chan struct{})}
+	go func() {
+		client.Wait()
+		close(client.done)
+	}()
+	return client, nil
+}
+
+// dial opens addr through the SSH server, reconnecting once if the SSH
+// connection has gone away.
+func (t *Tunnel) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if host, _, err := net.SplitHostPort(addr); err != nil || (t.allow != nil && !t.allow(host)) {
+		return nil, fmt.Errorf("ssh tunnel: %s is not allowed", addr)
+	}
+
+	t.mu.Lock()
+	client := t.client
+	t.mu.Unlock()
+
+	conn, err := client.DialContext(ctx, network, addr)
+	if err == nil {
+		return conn, nil
+	}
+	if !t.reconnect(ctx, client) {
+		return nil, err
+	}
+	t.mu.Lock()
+	client = t.client
+	t.mu.Unlock()
+	return client.DialContext(ctx, network, addr)
+}
+
+// reconnect replaces failed with a new SSH connection unless it was
+// already replaced or the tunnel is closed, reporting whether a usable
+// connection is in place.
+func (t *Tunnel) reconnect(ctx context.Context, failed *sshConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	if t.client != failed {
+		return true
+	}
+	select {
+	case <-failed.done:
+	default:
+		// The connection is fine; the target refused.
+		return false
+	}
+	client, err := t.connect(ctx)
+	if err != nil {
+		log.Printf("Tunnel: reconnecting to %s failed: %v", t.addr, err)
+		return false
+	}
+	failed.Close()
+	t.client = client
+	log.Printf("Tunnel: reconnected to %s", t.addr)
+	return true
+}
+
+// ProxyURL is the proxy to pass to the browser.
+func (t *Tunnel) ProxyURL() string {
+	return "socks5://" + t.ln.Addr().String()
+}
+
+// Close stops the proxy and disconnects from the SSH server.
+func (t *Tunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.ln.Close()
+	return t.client.Close()
+}
@@ -0,0 +1,132 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Tor is a Tor client's SOCKS5 endpoint, either one the server started or
+// one configured by the operator.
+type Tor struct {
+	addr    string
+	dataDir string
+}
+
+// ConnectTor uses the Tor SOCKS5 endpoint at addr (host:port). Circuit
+// isolation needs its SocksPort to have IsolateSOCKSAuth, which Tor
+// enables by default.
+func ConnectTor(addr string) (*Tor, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid tor SOCKS address %q: %w", addr, err)
+	}
+	return &Tor{addr: addr}, nil
+}
+
+// StartTor runs the tor binary at path until ctx is done, with a SOCKS
+// port on loopback. It returns once the port accepts connections; Tor
+// may still be building its first circuits, which it logs.
+func StartTor(ctx context.Context, path string) (*Tor, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dataDir, err := os.MkdirTemp("", "browser-lab-tor-")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, path,
+		"--SocksPort", addr+" IsolateSOCKSAuth",
+		"--ControlPort", "0",
+		"--DataDirectory", dataDir,
+		"--Log", "notice stdout",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dataDir)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dataDir)
+		return nil, fmt.Errorf("start tor: %w", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.Contains(line, "Bootstrapped") || strings.Contains(line, "[err]") || strings.Contains(line, "[warn]") {
+				log.Printf("Tor: %s", line)
+			}
+		}
+		cmd.Wait()
+		os.RemoveAll(dataDir)
+		close(exited)
+	}()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return &Tor{addr: addr, dataDir: dataDir}, nil
+		}
+		select {
+		case <-exited:
+			return nil, errors.New("tor exited during startup")
+		case <-time.After(200 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			return nil, fmt.Errorf("tor did not open its SOCKS port %s", addr)
+		}
+	}
+}
+
+// Addr is the Tor SOCKS5 endpoint.
+func (t *Tor) Addr() string {
+	return t.addr
+}
+
+// Proxy is a local SOCKS5 proxy in front of another connection method.
+type Proxy struct {
+	ln net.Listener
+}
+
+// Open starts a local proxy that sends connections through Tor on circuits
+// of their own: Tor only shares circuits between connections that
+// authenticate with the same credentials, so each isolation key gets its
+// own. The browser cannot authenticate to a SOCKS proxy itself. If allow
+// is not nil, only hosts it allows are proxied.
+func (t *Tor) Open(isolation string, allow func(host string) bool) (*Proxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go ServeSOCKS(ln, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err != nil || (allow != nil && !allow(host)) {
+			return nil, fmt.Errorf("tor: %s is not allowed", addr)
+		}
+		return DialSOCKS(ctx, t.addr, isolation, "browser-lab", addr)
+	})
+	return &Proxy{ln: ln}, nil
+}
+
+// ProxyURL is the proxy to pass to the browser.
+func (p *Proxy) ProxyURL() string {
+	return "socks5://" + p.ln.Addr().String()
+}
+
+// Close stops the proxy. Open connections are left to finish.
+func (p *Proxy) Close() error {
+	return p.ln.Close()
+}
@@ -0,0 +1,394 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// echoServer answers each line with the same line.
+func echoServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// dialSOCKS opens addr through the SOCKS5 proxy at proxy, returning
+// the reply code.
+func dialSOCKS(t *testing.T, proxy, addr string) (net.Conn, byte) {
+	conn, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	host, portStr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portStr)
+
+	conn.Write([]byte{5, 1, 0})
+	var method [2]byte
+	if _, err := io.ReadFull(conn, method[:]); err != nil || method[1] != 0 {
+		t.Fatalf("method negotiation: %v %v", method, err)
+	}
+	req := []byte{5, 1, 0, 3, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	conn.Write(req)
+	var reply [10]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	return conn, reply[1]
+}
+
+func assertEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.Write([]byte("hello\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Errorf("echo = %q, %v", line, err)
+	}
+}
+
+func TestServeSOCKS(t *testing.T) {
+	target := echoServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var d net.Dialer
+	go ServeSOCKS(ln, d.DialContext)
+
+	conn, code := dialSOCKS(t, ln.Addr().String(), target)
+	defer conn.Close()
+	if code != socksSucceeded {
+		t.Fatalf("reply code = %d", code)
+	}
+	assertEcho(t, conn)
+}
+
+// sshServer accepts the given client key and forwards direct-tcpip
+// channels.
+func sshServer(t *testing.T, clientKey ssh.PublicKey) (addr string, hostKey ssh.PublicKey) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					var p struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &p) != nil {
+						nc.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					upstream, err := net.Dial("tcp", net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port))))
+					if err != nil {
+						nc.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, chReqs, _ := nc.Accept()
+					go ssh.DiscardRequests(chReqs)
+					go func() {
+						defer ch.Close()
+						defer upstream.Close()
+						go io.Copy(upstream, ch)
+						io.Copy(ch, upstream)
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), signer.PublicKey()
+}
+
+func TestTunnel(t *testing.T) {
+	_, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSigner, _ := ssh.NewSignerFromKey(clientPriv)
+	addr, hostKey := sshServer(t, clientSigner.PublicKey())
+
+	cfg := Config{
+		Host:       addr,
+		User:       "tester",
+		PrivateKey: string(pem.EncodeToMemory(block)),
+		HostKey:    string(ssh.MarshalAuthorizedKey(hostKey)),
+	}
+	target := echoServer(t)
+	tun, err := Open(context.Background(), cfg, func(host string) bool { return host == "127.0.0.1" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.Close()
+	proxy := tun.ProxyURL()[len("socks5://"):]
+
+	conn, code := dialSOCKS(t, proxy, target)
+	defer conn.Close()
+	if code != socksSucceeded {
+		t.Fatalf("reply code = %d", code)
+	}
+	assertEcho(t, conn)
+
+	_, port, _ := net.SplitHostPort(target)
+	if _, code := dialSOCKS(t, proxy, "localhost:"+port); code == socksSucceeded {
+		t.Error("host outside the allowlist was proxied")
+	}
+
+	// A wrong host key must be refused.
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ssh.NewPublicKey(other)
+	cfg.HostKey = string(ssh.MarshalAuthorizedKey(otherKey))
+	if tun, err := Open(context.Background(), cfg, nil); err == nil {
+		tun.Close()
+		t.Error("connected despite a host key mismatch")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{Host: "bastion", User: "u", PrivateKey: "junk", InsecureIgnoreHostKey: true}).Validate(); err == nil {
+		t.Error("invalid private key accepted")
+	}
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	block, _ := ssh.MarshalPrivateKey(priv, "")
+	key := string(pem.EncodeToMemory(block))
+	if err := (Config{Host: "bastion", User: "u", PrivateKey: key}).Validate(); err == nil {
+		t.Error("config without host key accepted")
+	}
+	if err := (Config{Host: "bastion", User: "u", PrivateKey: key, InsecureIgnoreHostKey: true}).Validate(); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+}
+
+// fakeTor is a SOCKS5 server requiring password authentication that
+// reports the user name of each connection.
+func fakeTor(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	users := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var hdr [3]byte
+				io.ReadFull(conn, hdr[:])
+				conn.Write([]byte{5, socksUserPass})
+				var n [2]byte
+				io.ReadFull(conn, n[:])
+				user := make([]byte, n[1])
+				io.ReadFull(conn, user)
+				io.ReadFull(conn, n[:1])
+				io.ReadFull(conn, make([]byte, n[0]))
+				conn.Write([]byte{1, 0})
+				users <- string(user)
+
+				var req [5]byte
+				io.ReadFull(conn, req[:])
+				name := make([]byte, req[4])
+				io.ReadFull(conn, name)
+				var port [2]byte
+				io.ReadFull(conn, port[:])
+				upstream, err := net.Dial("tcp", net.JoinHostPort(string(name), strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))))
+				if err != nil {
+					socksReply(conn, socksGeneralFailure)
+					return
+				}
+				defer upstream.Close()
+				socksReply(conn, socksSucceeded)
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String(), users
+}
+
+func TestTorIsolation(t *testing.T) {
+	addr, users := fakeTor(t)
+	tor, err := ConnectTor(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(echoServer(t))
+
+	for _, id := range []string{"session-a", "session-b"} {
+		p, err := tor.Open(id, func(host string) bool { return host == "localhost" })
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+		proxy := p.ProxyURL()[len("socks5://"):]
+
+		conn, code := dialSOCKS(t, proxy, "localhost:"+port)
+		if code != socksSucceeded {
+			t.Fatalf("reply code = %d", code)
+		}
+		assertEcho(t, conn)
+		conn.Close()
+		if user := <-users; user != id {
+			t.Errorf("isolation user = %q, want %q", user, id)
+		}
+
+		if _, code := dialSOCKS(t, proxy, "127.0.0.1:"+port); code == socksSucceeded {
+			t.Error("host outside the allowlist was proxied")
+		}
+	}
+}
+
+// connectProxy is an HTTP proxy answering CONNECT for user:secret.
+func connectProxy(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestUpstream(t *testing.T) {
+	target := echoServer(t)
+	proxy := connectProxy(t)
+
+	up, err := ParseUpstream("http://user:secret@" + proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up.String() != "http://user@"+proxy {
+		t.Errorf("String() = %q", up.String())
+	}
+	local, err := up.Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	conn, code := dialSOCKS(t, strings.TrimPrefix(local.ProxyURL(), "socks5://"), target)
+	if code != socksSucceeded {
+		t.Fatalf("reply code = %d", code)
+	}
+	assertEcho(t, conn)
+	conn.Close()
+
+	wrong, _ := ParseUpstream("http://user:wrong@" + proxy)
+	if _, err := wrong.Dial(context.Background(), "tcp", target); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("Dial with wrong credentials = %v", err)
+	}
+
+	// A SOCKS5 proxy without authentication.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var d net.Dialer
+	go ServeSOCKS(ln, d.DialContext)
+	socks, _ := ParseUpstream("socks5h://" + ln.Addr().String())
+	conn, err = socks.Dial(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEcho(t, conn)
+	conn.Close()
+}
+
+func TestParseUpstream(t *testing.T) {
+	for _, bad := range []string{"ftp://host:21", "http://host", "http://:8080", "host:8080", "http://host:8080/path"} {
+		if _, err := ParseUpstream(bad); err == nil {
+			t.Errorf("ParseUpstream(%q) succeeded", bad)
+		}
+	}
+}
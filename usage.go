@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"browser-server/auth"
+	"browser-server/billing"
+	"browser-server/session"
+)
+
+// usageLedger records the usage of finished sessions for billing.
+var usageLedger *billing.Ledger
+
+// setupBilling opens the usage ledger (USAGE_LEDGER_FILE) and starts the
+// periodic exporter when USAGE_EXPORT_DIR is set.
+func setupBilling(sessions *session.Manager) error {
+	l, err := billing.OpenLedger(os.Getenv("USAGE_LEDGER_FILE"))
+	if err != nil {
+		return err
+	}
+	usageLedger = l
+	sessions.Observe(billingObserver{})
+
+	if dir := os.Getenv("USAGE_EXPORT_DIR"); dir != "" {
+		interval := 24 * time.Hour
+		if v := os.Getenv("USAGE_EXPORT_INTERVAL"); v != "" {
+			if interval, err = time.ParseDuration(v); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		go billing.RunExporter(usageLedger, dir, interval, nil)
+		log.Printf("Billing: exporting usage to %s every %s", dir, interval)
+	}
+	return nil
+}
+
+// billingObserver records the usage of every stopped session.
+type billingObserver struct{ session.NopObserver }
+
+func (billingObserver) SessionStopped(s *session.Session) {
+	if err := usageLedger.Add(usageRecord(s, s.StoppedAt())); err != nil {
+		log.Printf("Billing: failed to record usage of session %s: %v", s.ID, err)
+	}
+}
+
+func usageRecord(s *session.Session, end time.Time) billing.Record {
+	tenant := s.Owner
+	if tenant == "" {
+		tenant = "anonymous"
+	}
+	return billing.Record{
+		Tenant:         tenant,
+		SessionID:      s.ID,
+		Start:          s.CreatedAt,
+		End:            end,
+		BandwidthBytes: s.Usage().TotalBytes,
+		StorageBytes:   s.StorageBytes(),
+	}
+}
+
+// usageHandler reports aggregated usage per tenant for a date range,
+// including sessions that are still running. Non-admins only see their own
+// usage.
+// GET /usage?from=2026-01-01&to=2026-02-01&tenant=team-a&format=csv
+//
+// Tenants are listed by name and accept limit, offset and
+// sort=[-]tenant|browser_minutes|bandwidth_bytes.
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	params, err := parseListParams(q, "tenant", "browser_minutes", "bandwidth_bytes")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	from, err := parseTimeParam(q.Get("from"), now.AddDate(0, 0, -30))
+	if err != nil {
+		http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"), now)
+	if err != nil {
+		http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenant := q.Get("tenant")
+	if id, ok := auth.IdentityFromContext(r.Context()); ok && id.Role < auth.RoleAdmin {
+		tenant = id.Name
+	}
+
+	records := usageLedger.Query(from, to, tenant)
+	for _, s := range requestSessions(r).ListSessions() {
+		rec := usageRecord(s, now)
+		if tenant != "" && rec.Tenant != tenant {
+			continue
+		}
+		if clipped, ok := billing.Clip(rec, from, to); ok {
+			records = append(records, clipped)
+		}
+	}
+	usage := billing.Aggregate(records)
+	if params.Sort != "" && params.Sort != "tenant" {
+		sort.SliceStable(usage, func(i, j int) bool {
+			if params.Sort == "browser_minutes" {
+				return usage[i].BrowserMinutes < usage[j].BrowserMinutes
+			}
+			return usage[i].BandwidthBytes < usage[j].BandwidthBytes
+		})
+	}
+	if params.Desc {
+		slices.Reverse(usage)
+	}
+	start, end := params.page(w, r, len(usage))
+	usage = usage[start:end]
+
+	if q.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+		billing.WriteCSV(w, from, to, usage)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	billing.WriteJSON(w, from, to, usage)
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date.
+func parseTimeParam(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/h264reader"
+)
+
+// videoKeyFrames makes encoders start a key frame every two seconds, so a
+// viewer joining a shared encoder sees the page soon.
+const videoKeyFrames = "expr:gte(t,n_forced*2)"
+
+// whipVideo makes WHIP viewers whose offer receives video get the
+// screencast as a VP8 or H.264 track (WHIP_VIDEO, on by default when
+// ffmpeg is found).
+var whipVideo bool
+
+// whipVideoBitrate is the video tracks' target bitrate (WHIP_VIDEO_BITRATE,
+// default "1500k").
+var whipVideoBitrate = "1500k"
+
+// setupWHIPVideo reads WHIP_VIDEO and WHIP_VIDEO_BITRATE.
+func setupWHIPVideo() error {
+	_, lookErr := exec.LookPath(ffmpegPath)
+	whipVideo = lookErr == nil
+	if v := os.Getenv("WHIP_VIDEO"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid WHIP_VIDEO %q: %w", v, err)
+		}
+		if b && lookErr != nil {
+			return fmt.Errorf("WHIP video tracks need ffmpeg: %w", lookErr)
+		}
+		whipVideo = b
+	}
+	if v := os.Getenv("WHIP_VIDEO_BITRATE"); v != "" {
+		whipVideoBitrate = v
+	}
+	return nil
+}
+
+// offerVideoCodec picks the codec to send a viewer's video in from its
+// offer: VP8 if it can play it, else H.264, else none.
+func offerVideoCodec(offer string) (webrtc.RTPCodecCapability, bool) {
+	if !strings.Contains(offer, "m=video") {
+		return webrtc.RTPCodecCapability{}, false
+	}
+	switch {
+	case strings.Contains(offer, "VP8/90000"):
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}, true
+	case strings.Contains(offer, "H264/90000"):
+		// Constrained baseline, which every browser plays.
+		return webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeH264,
+			ClockRate:   90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		}, true
+	}
+	return webrtc.RTPCodecCapability{}, false
+}
+
+// videoEncoderArgs makes ffmpeg encode the screencast at bitrate to VP8 in
+// an IVF stream, or to H.264 in an Annex B stream with access unit
+// delimiters, on stdout.
+func videoEncoderArgs(mimeType, bitrate string) []string {
+	args := append([]string{}, mjpegInput...)
+	if mimeType == webrtc.MimeTypeH264 {
+		return append(args,
+			"-an", "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency",
+			"-profile:v", "baseline", "-pix_fmt", "yuv420p",
+			// One slice per frame, each frame behind a delimiter.
+			"-x264-params", "sliced-threads=0:aud=1",
+			"-b:v", bitrate, "-force_key_frames", videoKeyFrames, "-vf", evenSize,
+			"-f", "h264", "pipe:1",
+		)
+	}
+	return append(args,
+		"-an", "-c:v", "libvpx", "-deadline", "realtime", "-cpu-used", "8",
+		"-b:v", bitrate, "-force_key_frames", videoKeyFrames, "-vf", evenSize,
+		"-f", "ivf", "pipe:1",
+	)
+}
+
+// videoEncoder encodes a session's screencast once for all the WHIP
+// viewers that take it in one codec, while any do.
+type videoEncoder struct {
+	track   *webrtc.TrackLocalStaticSample
+	viewers int
+	cancel  context.CancelFunc
+}
+
+type videoEncoderKey struct {
+	sessionID string
+	mimeType  string
+}
+
+var (
+	videoEncoders   = make(map[videoEncoderKey]*videoEncoder)
+	videoEncodersMu sync.Mutex
+)
+
+// joinVideo returns the track carrying a session's screencast in codec,
+// starting its encoder for the first viewer. The viewer calls release
+// when it leaves; the encoder stops with the last.
+func joinVideo(sess *session.Session, codec webrtc.RTPCodecCapability) (*webrtc.TrackLocalStaticSample, func(), error) {
+	key := videoEncoderKey{sess.ID, codec.MimeType}
+	videoEncodersMu.Lock()
+	defer videoEncodersMu.Unlock()
+	enc, ok := videoEncoders[key]
+	if !ok {
+		track, err := webrtc.NewTrackLocalStaticSample(codec, "screen", "browser-lab-"+sess.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		ctx, cancel := sessionContext(serverCtx, sess)
+		enc = &videoEncoder{track: track, cancel: cancel}
+		videoEncoders[key] = enc
+		go func() {
+			defer cancel()
+			log.Printf("Video: Encoding session %s to %s", sess.ID, codec.MimeType)
+			if err := enc.run(ctx, sess, codec.MimeType); err != nil && ctx.Err() == nil {
+				log.Printf("Video: Encoding session %s failed: %v", sess.ID, err)
+			}
+			videoEncodersMu.Lock()
+			if videoEncoders[key] == enc {
+				delete(videoEncoders, key)
+			}
+			videoEncodersMu.Unlock()
+		}()
+	}
+	enc.viewers++
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			videoEncodersMu.Lock()
+			defer videoEncodersMu.Unlock()
+			if enc.viewers--; enc.viewers == 0 {
+				enc.cancel()
+				if videoEncoders[key] == enc {
+					delete(videoEncoders, key)
+				}
+			}
+		})
+	}
+	return enc.track, release, nil
+}
+
+// run encodes the screencast to the track until ctx ends or the encoder
+// fails. The bytes sent count once per viewer towards the session's usage.
+func (enc *videoEncoder) run(ctx context.Context, sess *session.Session, mimeType string) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath, videoEncoderArgs(mimeType, whipVideoBitrate)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start encoder: %w", err)
+	}
+	defer cmd.Wait()
+
+	if err := feedScreencast(ctx, sess, stdin); err != nil {
+		return err
+	}
+
+	w := &countingTrack{TrackLocalStaticSample: enc.track, count: func(n int) {
+		videoEncodersMu.Lock()
+		viewers := enc.viewers
+		videoEncodersMu.Unlock()
+		sess.CountStreamBytes(n * viewers)
+	}}
+	if mimeType == webrtc.MimeTypeH264 {
+		err = writeH264(stdout, w)
+	} else {
+		err = writeIVF(stdout, w)
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("encoder: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// sampleWriter is where writeIVF and writeH264 send frames.
+type sampleWriter interface {
+	WriteSample(media.Sample) error
+}
+
+// countingTrack reports the size of every sample written to its track.
+type countingTrack struct {
+	*webrtc.TrackLocalStaticSample
+	count func(int)
+}
+
+func (t *countingTrack) WriteSample(s media.Sample) error {
+	t.count(len(s.Data))
+	return t.TrackLocalStaticSample.WriteSample(s)
+}
+
+// annexBStartCode prefixes every NAL unit of a sample, as the H.264
+// payloader expects.
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// writeH264 sends the access units of an Annex B stream with access unit
+// delimiters to track as they arrive, each lasting until the next. An
+// access unit is sent once the next one begins.
+func writeH264(r io.Reader, track sampleWriter) error {
+	h264, err := h264reader.NewReader(r)
+	if err != nil {
+		return err
+	}
+	last := time.Now()
+	var unit []byte
+	for {
+		nal, err := h264.NextNAL()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if nal.UnitType == h264reader.NalUnitTypeAUD {
+			if len(unit) > 0 {
+				now := time.Now()
+				if err := track.WriteSample(media.Sample{Data: unit, Duration: now.Sub(last)}); err != nil {
+					return err
+				}
+				last = now
+			}
+			unit = nil
+			continue
+		}
+		unit = append(append(unit, annexBStartCode...), nal.Data...)
+	}
+}
+
+// addVideoTrack sends a session's screencast to a WHIP viewer as a track
+// in codec, for as long as the resource lasts. It must be called between
+// applying the viewer's offer and answering it, so the track takes the
+// offer's video section.
+func addVideoTrack(resource *WHIPResource, sess *session.Session, codec webrtc.RTPCodecCapability) error {
+	track, release, err := joinVideo(sess, codec)
+	if err != nil {
+		return err
+	}
+	sender, err := resource.PeerConnection.AddTrack(track)
+	if err != nil {
+		release()
+		return err
+	}
+	context.AfterFunc(resource.ctx, release)
+	// RTCP has to be read for the interceptors, NACKs included, to work.
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// sessionAudience returns how many viewers are watching a session: those
+// of its shared screencast, where each video encoder stands for all the
+// WHIP viewers taking its track.
+func sessionAudience(sess *session.Session) int {
+	n := sess.Viewers()
+	videoEncodersMu.Lock()
+	defer videoEncodersMu.Unlock()
+	for key, enc := range videoEncoders {
+		if key.sessionID == sess.ID {
+			n += enc.viewers - 1
+		}
+	}
+	return n
+}
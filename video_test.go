@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+func TestOfferVideoCodec(t *testing.T) {
+	for offer, want := range map[string]string{
+		"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n":                                       "",
+		"m=video 9 UDP/TLS/RTP/SAVPF 96 102\r\na=rtpmap:96 VP8/90000\r\na=rtpmap:102 H264/90000\r\n": webrtc.MimeTypeVP8,
+		"m=video 9 UDP/TLS/RTP/SAVPF 102\r\na=rtpmap:102 H264/90000\r\n":                             webrtc.MimeTypeH264,
+		"m=video 9 UDP/TLS/RTP/SAVPF 45\r\na=rtpmap:45 AV1/90000\r\n":                                "",
+	} {
+		codec, ok := offerVideoCodec(offer)
+		if ok != (want != "") || codec.MimeType != want {
+			t.Errorf("offerVideoCodec(%q) = %q, %v, want %q", offer, codec.MimeType, ok, want)
+		}
+	}
+}
+
+type sampleRecorder []media.Sample
+
+func (r *sampleRecorder) WriteSample(s media.Sample) error {
+	*r = append(*r, s)
+	return nil
+}
+
+func TestWriteH264(t *testing.T) {
+	aud := []byte{0, 0, 0, 1, 0x09, 0xf0}
+	sps := []byte{0, 0, 0, 1, 0x67, 0x42, 0xe0, 0x1f}
+	pps := []byte{0, 0, 0, 1, 0x68, 0xce, 0x3c, 0x80}
+	idr := []byte{0, 0, 0, 1, 0x65, 0x88, 0x84}
+	slice := []byte{0, 0, 0, 1, 0x41, 0x9a, 0x02}
+	var stream []byte
+	for _, nal := range [][]byte{aud, sps, pps, idr, aud, slice, aud} {
+		stream = append(stream, nal...)
+	}
+
+	var samples sampleRecorder
+	if err := writeH264(bytes.NewReader(stream), &samples); err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	if want := append(append(append([]byte{}, sps...), pps...), idr...); !bytes.Equal(samples[0].Data, want) {
+		t.Errorf("first access unit = %x, want %x", samples[0].Data, want)
+	}
+	if !bytes.Equal(samples[1].Data, slice) {
+		t.Errorf("second access unit = %x, want %x", samples[1].Data, slice)
+	}
+}
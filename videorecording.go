@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/gorilla/mux"
+)
+
+// Video recording formats, beside the interaction export formats of
+// GET /sessions/{id}/recording.
+const (
+	videoFormatWebM = "webm"
+	videoFormatMP4  = "mp4"
+)
+
+// videoRecordingStopTimeout is how long stopping a recording waits for
+// ffmpeg to finish the file.
+const videoRecordingStopTimeout = 10 * time.Second
+
+var (
+	// videoRecordingsDir holds the recordings (RECORDINGS_DIR).
+	videoRecordingsDir = filepath.Join(os.TempDir(), "browser-lab-recordings")
+	// videoRecordingRetention is how long a recording is kept after it
+	// stops, even once its session is gone (RECORDING_RETENTION).
+	videoRecordingRetention = 24 * time.Hour
+)
+
+// setupVideoRecordings reads RECORDINGS_DIR and RECORDING_RETENTION and
+// removes expired recordings every minute.
+func setupVideoRecordings() error {
+	if v := os.Getenv("RECORDINGS_DIR"); v != "" {
+		videoRecordingsDir = v
+	}
+	if v := os.Getenv("RECORDING_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid RECORDING_RETENTION %q: %w", v, err)
+		}
+		videoRecordingRetention = d
+	}
+	if err := os.MkdirAll(videoRecordingsDir, 0755); err != nil {
+		return err
+	}
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			if n := sweepVideoRecordings(now); n > 0 {
+				log.Printf("Recording: removed %d expired recordings", n)
+			}
+		}
+	}()
+	return nil
+}
+
+// VideoRecordingRequest asks for a session's screencast to be recorded.
+type VideoRecordingRequest struct {
+	// Format is "webm" (VP8, the default) or "mp4" (H.264).
+	Format string `json:"format,omitempty"`
+}
+
+// VideoRecordingStatus describes a session's video recording.
+type VideoRecordingStatus struct {
+	Format    string     `json:"format"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+	Recording bool       `json:"recording"`
+	// Size is the size of the file so far, in bytes.
+	Size int64 `json:"size"`
+	// ExpiresAt is when a stopped recording is deleted.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Error is why a recording stopped on its own.
+	Error string `json:"error,omitempty"`
+}
+
+// videoRecording is a session's screencast being, or having been, written
+// to a file by ffmpeg. It is kept until it expires or the session records
+// again.
+type videoRecording struct {
+	status VideoRecordingStatus
+	owner  string
+	path   string
+	stop   context.CancelFunc
+	done   chan struct{}
+}
+
+var (
+	videoRecordings   = make(map[string]*videoRecording)
+	videoRecordingsMu sync.Mutex
+)
+
+// videoRecordingArgs makes ffmpeg write the screencast to path: VP8 in
+// WebM, or H.264 in a fragmented MP4, which stays playable if ffmpeg is
+// killed before it finishes.
+func videoRecordingArgs(format, path string) []string {
+	args := append([]string{}, mjpegInput...)
+	if format == videoFormatMP4 {
+		args = append(args,
+			"-c:v", "libx264", "-preset", "veryfast", "-pix_fmt", "yuv420p", "-crf", "28",
+			"-movflags", "+frag_keyframe+empty_moov+default_base_moof", "-f", "mp4",
+		)
+	} else {
+		args = append(args,
+			"-c:v", "libvpx", "-deadline", "realtime", "-cpu-used", "8", "-b:v", "1M", "-f", "webm",
+		)
+	}
+	return append(args, "-an", "-vf", evenSize, "-y", path)
+}
+
+// sessionVideoRecording describes a session's video recording, if it has
+// one.
+func sessionVideoRecording(id string) (*VideoRecordingStatus, bool) {
+	videoRecordingsMu.Lock()
+	rec, ok := videoRecordings[id]
+	videoRecordingsMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return rec.statusNow(), true
+}
+
+func (rec *videoRecording) statusNow() *VideoRecordingStatus {
+	videoRecordingsMu.Lock()
+	status := rec.status
+	videoRecordingsMu.Unlock()
+	if info, err := os.Stat(rec.path); err == nil {
+		status.Size = info.Size()
+	}
+	return &status
+}
+
+// startVideoRecording records a session's screencast in format until it is
+// stopped, the session ends or ffmpeg fails. It returns false if the
+// session is already being recorded.
+func startVideoRecording(sess *session.Session, format string) (*videoRecording, bool) {
+	videoRecordingsMu.Lock()
+	defer videoRecordingsMu.Unlock()
+	if old, ok := videoRecordings[sess.ID]; ok {
+		if old.status.Recording {
+			return old, false
+		}
+		os.Remove(old.path)
+	}
+	ctx, stop := sessionContext(serverCtx, sess)
+	rec := &videoRecording{
+		status: VideoRecordingStatus{Format: format, StartedAt: time.Now(), Recording: true},
+		owner:  sess.Owner,
+		path:   filepath.Join(videoRecordingsDir, filepath.Base(sess.ID)+"."+format),
+		stop:   stop,
+		done:   make(chan struct{}),
+	}
+	videoRecordings[sess.ID] = rec
+	go func() {
+		defer close(rec.done)
+		defer stop()
+		log.Printf("Recording: Recording session %s to %s", sess.ID, rec.path)
+		err := runVideoRecording(ctx, sess, rec.path, format)
+		now := time.Now()
+		expires := now.Add(videoRecordingRetention)
+		videoRecordingsMu.Lock()
+		rec.status.Recording = false
+		rec.status.StoppedAt = &now
+		rec.status.ExpiresAt = &expires
+		if err != nil {
+			log.Printf("Recording: Recording session %s failed: %v", sess.ID, err)
+			rec.status.Error = err.Error()
+		}
+		videoRecordingsMu.Unlock()
+		log.Printf("Recording: Stopped recording session %s", sess.ID)
+	}()
+	return rec, true
+}
+
+// runVideoRecording feeds the session's screencast to ffmpeg until ctx
+// ends, then lets ffmpeg finish the file.
+func runVideoRecording(ctx context.Context, sess *session.Session, path, format string) error {
+	// Not tied to ctx: ffmpeg has to see the end of its input to finish
+	// the file.
+	cmd := exec.Command(ffmpegPath, videoRecordingArgs(format, path)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start ffmpeg: %w", err)
+	}
+	if err := feedScreencast(ctx, sess, stdin); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+		// ffmpeg gave up before the recording was stopped.
+		if ctx.Err() == nil && err == nil {
+			err = fmt.Errorf("ffmpeg exited")
+		}
+	case <-ctx.Done():
+		select {
+		case err = <-done:
+		case <-time.After(videoRecordingStopTimeout):
+			cmd.Process.Kill()
+			err = <-done
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// sweepVideoRecordings removes recordings that expired before now, and
+// files in the directory older than the retention that no recording owns,
+// such as those left by an earlier run of the server.
+func sweepVideoRecordings(now time.Time) int {
+	videoRecordingsMu.Lock()
+	owned := make(map[string]bool)
+	n := 0
+	for id, rec := range videoRecordings {
+		if rec.status.ExpiresAt != nil && now.After(*rec.status.ExpiresAt) {
+			delete(videoRecordings, id)
+			os.Remove(rec.path)
+			n++
+			continue
+		}
+		owned[rec.path] = true
+	}
+	videoRecordingsMu.Unlock()
+
+	entries, _ := os.ReadDir(videoRecordingsDir)
+	for _, e := range entries {
+		path := filepath.Join(videoRecordingsDir, e.Name())
+		info, err := e.Info()
+		if err != nil || owned[path] || !info.Mode().IsRegular() || now.Sub(info.ModTime()) < videoRecordingRetention {
+			continue
+		}
+		if os.Remove(path) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// startVideoRecordingHandler starts recording a session's screencast to
+// WebM or MP4, replacing its previous recording.
+// POST /sessions/{id}/recording/start
+func startVideoRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var req VideoRecordingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Format == "" {
+		req.Format = videoFormatWebM
+	}
+	if req.Format != videoFormatWebM && req.Format != videoFormatMP4 {
+		http.Error(w, "format must be webm or mp4", http.StatusBadRequest)
+		return
+	}
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		http.Error(w, "Recording video needs ffmpeg, which is not installed", http.StatusServiceUnavailable)
+		return
+	}
+	rec, ok := startVideoRecording(sess, req.Format)
+	if !ok {
+		http.Error(w, "Session is already being recorded", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rec.statusNow())
+}
+
+// stopVideoRecordingHandler stops recording a session's screencast once
+// ffmpeg has finished the file, which can then be downloaded.
+// POST /sessions/{id}/recording/stop
+func stopVideoRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	sess, ok := requestSessions(r).GetSession(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !canControl(r, sess) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	videoRecordingsMu.Lock()
+	rec, ok := videoRecordings[sess.ID]
+	recording := ok && rec.status.Recording
+	videoRecordingsMu.Unlock()
+	if !recording {
+		http.Error(w, "Session is not being recorded", http.StatusConflict)
+		return
+	}
+	rec.stop()
+	<-rec.done
+	writeJSONWithETag(w, r, rec.statusNow())
+}
+
+// serveVideoRecording downloads a session's video recording in format. It
+// is kept after the session ends, until it expires.
+func serveVideoRecording(w http.ResponseWriter, r *http.Request, id, format string) {
+	videoRecordingsMu.Lock()
+	rec, ok := videoRecordings[id]
+	videoRecordingsMu.Unlock()
+	if !ok || rec.status.Format != format {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	if !canControlOwner(r, rec.owner) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if status := rec.statusNow(); status.Recording {
+		http.Error(w, "Session is still being recorded; stop the recording first", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "video/"+format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, id, format))
+	http.ServeFile(w, r, rec.path)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVideoRecordingArgs(t *testing.T) {
+	for format, muxer := range map[string]string{videoFormatWebM: "webm", videoFormatMP4: "mp4"} {
+		args := videoRecordingArgs(format, "/tmp/s1."+format)
+		if args[len(args)-1] != "/tmp/s1."+format {
+			t.Errorf("%s: args end with %q", format, args[len(args)-1])
+		}
+		found := false
+		for i, a := range args {
+			if a == "-f" && args[i+1] == muxer {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: no -f %s in %q", format, muxer, args)
+		}
+	}
+}
+
+func TestVideoRecordingDownloadAndSweep(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := videoRecordingsDir
+	videoRecordingsDir = dir
+	t.Cleanup(func() { videoRecordingsDir = oldDir })
+
+	path := filepath.Join(dir, "s1.webm")
+	if err := os.WriteFile(path, []byte("webm data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stray := filepath.Join(dir, "old.mp4")
+	if err := os.WriteFile(stray, []byte("mp4 data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * videoRecordingRetention)
+	os.Chtimes(stray, old, old)
+
+	stopped := time.Now()
+	expires := stopped.Add(time.Hour)
+	videoRecordingsMu.Lock()
+	videoRecordings["s1"] = &videoRecording{
+		status: VideoRecordingStatus{Format: videoFormatWebM, StartedAt: stopped.Add(-time.Minute), StoppedAt: &stopped, ExpiresAt: &expires},
+		path:   path,
+		done:   make(chan struct{}),
+	}
+	videoRecordingsMu.Unlock()
+	t.Cleanup(func() {
+		videoRecordingsMu.Lock()
+		delete(videoRecordings, "s1")
+		videoRecordingsMu.Unlock()
+	})
+
+	rec := httptest.NewRecorder()
+	serveVideoRecording(rec, httptest.NewRequest("GET", "/sessions/s1/recording?format=webm", nil), "s1", videoFormatWebM)
+	if rec.Code != http.StatusOK || rec.Body.String() != "webm data" || rec.Header().Get("Content-Type") != "video/webm" {
+		t.Errorf("download: %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	serveVideoRecording(rec, httptest.NewRequest("GET", "/sessions/s1/recording?format=mp4", nil), "s1", videoFormatMP4)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("download in another format: %d, want 404", rec.Code)
+	}
+
+	if n := sweepVideoRecordings(time.Now()); n != 1 {
+		t.Errorf("first sweep removed %d, want the stray file", n)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("unexpired recording removed: %v", err)
+	}
+	if n := sweepVideoRecordings(expires.Add(time.Second)); n != 1 {
+		t.Errorf("sweep after expiry removed %d, want 1", n)
+	}
+	if _, ok := sessionVideoRecording("s1"); ok {
+		t.Error("expired recording still listed")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"browser-server/session"
+)
+
+// setupWarmPool keeps browsers running ahead of POST /sessions
+// (WARM_POOL_MIN, WARM_POOL_MAX, WARM_POOL_IDLE_TIMEOUT and
+// WARM_POOL_CONCURRENCY). Warm browsers are launched with the options a
+// request without a body gets, so it must run after every other setting
+// those depend on has been read.
+func setupWarmPool(svc *services) error {
+	v := os.Getenv("WARM_POOL_MIN")
+	if v == "" {
+		return nil
+	}
+	cfg := session.PoolConfig{IdleTimeout: 10 * time.Minute}
+	var err error
+	if cfg.Min, err = strconv.Atoi(v); err != nil {
+		return fmt.Errorf("invalid WARM_POOL_MIN %q", v)
+	}
+	if cfg.Min == 0 {
+		return nil
+	}
+	cfg.Max = cfg.Min
+	if v := os.Getenv("WARM_POOL_MAX"); v != "" {
+		if cfg.Max, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid WARM_POOL_MAX %q", v)
+		}
+	}
+	if v := os.Getenv("WARM_POOL_IDLE_TIMEOUT"); v != "" {
+		if cfg.IdleTimeout, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid WARM_POOL_IDLE_TIMEOUT %q", v)
+		}
+	}
+	if v := os.Getenv("WARM_POOL_CONCURRENCY"); v != "" {
+		if cfg.Concurrency, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid WARM_POOL_CONCURRENCY %q", v)
+		}
+	}
+	ctx := context.WithValue(context.Background(), servicesKey{}, svc)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, apiPrefix+"/sessions", nil)
+	if err != nil {
+		return err
+	}
+	// Pooled sessions never start from a snapshot, so there is nothing to
+	// release.
+	if cfg.Options, _, err = sessionOptions(r, CreateSessionRequest{}); err != nil {
+		return err
+	}
+	if err := svc.sessions.EnablePool(cfg); err != nil {
+		return err
+	}
+	log.Printf("Warm pool: keeping %d to %d browsers ready", cfg.Min, cfg.Max)
+	return nil
+}
+
+// poolStatsHandler reports on the warm pool.
+// GET /admin/pool
+func poolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, ok := requestSessions(r).PoolStats()
+	if !ok {
+		http.Error(w, "The warm pool is not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"browser-server/session"
+)
+
+const (
+	// defaultWatermark is the watermark of sessions that ask for one when
+	// WATERMARK is unset.
+	defaultWatermark = session.WatermarkOwner + " " + session.WatermarkSession + " " + session.WatermarkTime
+	maxWatermark     = 200
+)
+
+var (
+	// watermarkTemplate is drawn onto the frames and screenshots of
+	// sessions with a watermark.
+	watermarkTemplate = defaultWatermark
+	// watermarkRequired watermarks every session (WATERMARK is set).
+	watermarkRequired bool
+)
+
+// setupWatermark reads WATERMARK, a template such as "{owner} {time}" that
+// every session's frames and screenshots are then watermarked with.
+func setupWatermark() error {
+	v := os.Getenv("WATERMARK")
+	if v == "" {
+		return nil
+	}
+	if len(v) > maxWatermark {
+		return fmt.Errorf("longer than %d bytes", maxWatermark)
+	}
+	watermarkTemplate = v
+	watermarkRequired = true
+	log.Printf("Watermark: every session is watermarked with %q", v)
+	return nil
+}
+
+// sessionWatermark returns the watermark template for a session, or "" if
+// it has none.
+func sessionWatermark(requested *bool) string {
+	if watermarkRequired || (requested != nil && *requested) {
+		return watermarkTemplate
+	}
+	return ""
+}
@@ -1,18 +1,20 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"sync"
 	"time"
 
+	"browser-server/session"
+
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -23,25 +25,70 @@ type WHIPResource struct {
 	SessionID      string
 	DataChannel    *webrtc.DataChannel
 	mu             sync.Mutex
+
+	// ctx ends the resource's screencast when the resource is deleted,
+	// the peer disconnects, the session stops or the server shuts down.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-var (
-	whipResources   = make(map[string]*WHIPResource)
-	whipResourcesMu sync.RWMutex
-)
+// whipResources are the WHIP resources being served, by ID.
+type whipResources struct {
+	mu   sync.Mutex
+	byID map[string]*WHIPResource
+}
+
+func newWHIPResources() *whipResources {
+	return &whipResources{byID: make(map[string]*WHIPResource)}
+}
+
+// add stores res unless it has already ended, as it does when its peer
+// disconnects before the answer is sent, reporting whether it did.
+func (rs *whipResources) add(res *WHIPResource) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if res.ctx.Err() != nil {
+		return false
+	}
+	rs.byID[res.ID] = res
+	return true
+}
+
+func (rs *whipResources) get(id string) (*WHIPResource, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	res, ok := rs.byID[id]
+	return res, ok
+}
+
+// remove ends res and forgets it. Only the first of a DELETE and the peer
+// disconnecting removes a resource; remove reports whether it was that
+// one.
+func (rs *whipResources) remove(res *WHIPResource) bool {
+	rs.mu.Lock()
+	removed := rs.byID[res.ID] == res
+	if removed {
+		delete(rs.byID, res.ID)
+	}
+	rs.mu.Unlock()
+	res.cancel()
+	return removed
+}
 
 // whipHandler implements the WHIP (WebRTC-HTTP Ingestion Protocol) endpoint
-// POST /sessions/{id}/whip - Creates a new WHIP resource
+// POST /sessions/{id}/whip?bring_to_front=true - Creates a new WHIP resource
 func whipHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	bringToFront := r.URL.Query().Get("bring_to_front") == "true"
 
 	vars := mux.Vars(r)
 	sessionID := vars["id"]
 
-	sess, ok := sessionManager.GetSession(sessionID)
+	svc := requestServices(r)
+	sess, ok := svc.sessions.GetSession(sessionID)
 	if !ok {
 		http.Error(w, "Session not found", http.StatusNotFound)
 		return
@@ -54,36 +101,58 @@ func whipHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Frames are sealed with the viewer's key if it sent one.
+	var sealer *frameSealer
+	if key := r.Header.Get(e2eeKeyHeader); key != "" {
+		var err error
+		if sealer, err = newFrameSealer(key); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if whipRequireE2EE {
+		http.Error(w, "End-to-end encryption is required: send a frame key in "+e2eeKeyHeader, http.StatusBadRequest)
+		return
+	}
+
+	// Viewers who may drive the session, and could reach the input
+	// socket, may also send input over an "input" data channel.
+	control := canControl(r, sess) && reachesGroup(r, groupCDP)
+
 	// Read the SDP offer from request body
-	var offerSDP []byte
-	offerSDP = make([]byte, r.ContentLength)
-	_, err := r.Body.Read(offerSDP)
-	if err != nil && err.Error() != "EOF" {
+	offerSDP, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSDPOfferBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "SDP offer is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
 		http.Error(w, "Failed to read SDP offer: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Parse the SDP offer
-	offer := webrtc.SessionDescription{
-		Type: webrtc.SDPTypeOffer,
-		SDP:  string(offerSDP),
+	offer, err := parseSDPOffer(offerSDP)
+	if err != nil {
+		http.Error(w, "Invalid SDP offer: "+err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	log.Printf("WHIP: Received offer for session %s", sessionID)
 
-	// Create PeerConnection
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-			{
-				URLs: []string{"stun:stun.cloudflare.com:3478"},
-			},
-		},
+	// Past the SFU threshold, viewers that can play video watch through
+	// the SFU. Encrypted viewers stay here, since the SFU would see their
+	// frames.
+	if target, ok := sfuRedirect(sess, offer.SDP); ok && sealer == nil {
+		log.Printf("WHIP: Redirecting viewer of session %s to the SFU", sessionID)
+		http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+		return
 	}
 
-	peerConnection, err := webrtc.NewPeerConnection(config)
+	// Create PeerConnection, with TURN credentials for this session
+	iceServers := whipICEServers(sessionID, time.Now())
+	config := webrtc.Configuration{ICEServers: iceServers}
+
+	peerConnection, err := whipAPI.NewPeerConnection(config)
 	if err != nil {
 		http.Error(w, "Failed to create peer connection: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -91,11 +160,16 @@ func whipHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Create WHIP resource
 	resourceID := uuid.New().String()
+	ctx, cancel := sessionContext(serverCtx, sess)
 	resource := &WHIPResource{
 		ID:             resourceID,
 		PeerConnection: peerConnection,
 		SessionID:      sessionID,
+		ctx:            ctx,
+		cancel:         cancel,
 	}
+	// Tear the peer connection down with the session or server.
+	context.AfterFunc(ctx, func() { peerConnection.Close() })
 
 	// Handle incoming Data Channel from client
 	peerConnection.OnDataChannel(func(d *webrtc.DataChannel) {
@@ -107,36 +181,58 @@ func whipHandler(w http.ResponseWriter, r *http.Request) {
 
 			d.OnOpen(func() {
 				log.Printf("WHIP: Data channel 'screencast' opened for resource %s", resourceID)
-				go streamScreencastToDataChannel(sess, d)
+				go streamScreencastToDataChannel(resource.ctx, sess, d, bringToFront, sealer)
 			})
 
 			d.OnClose(func() {
 				log.Printf("WHIP: Data channel 'screencast' closed for resource %s", resourceID)
+				resource.cancel()
 			})
 		}
+		if d.Label() == "input" {
+			handleInputChannel(resource.ctx, sess, d, control)
+		}
 	})
 
 	// Handle connection state changes
 	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		log.Printf("WHIP: Connection state changed to %s for resource %s", state.String(), resourceID)
 		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
-			// Clean up the resource
-			whipResourcesMu.Lock()
-			delete(whipResources, resourceID)
-			whipResourcesMu.Unlock()
+			// Clean up the resource, which may not be stored yet
+			resource.cancel()
+			if svc.whip.remove(resource) {
+				log.Printf("WHIP: Removed resource %s", resourceID)
+			}
 		}
 	})
 
 	// Set the remote SessionDescription (the offer)
 	if err = peerConnection.SetRemoteDescription(offer); err != nil {
+		resource.cancel()
 		log.Printf("WHIP: Failed to set remote description: %v", err)
 		http.Error(w, "Failed to set remote description: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Viewers that can play video, such as WHEP players, get the
+	// screencast as a video track. Encrypted viewers only get the data
+	// channel, whose frames are sealed.
+	if codec, ok := offerVideoCodec(offer.SDP); ok && whipVideo && sealer == nil {
+		if err := addVideoTrack(resource, sess, codec); err != nil {
+			log.Printf("WHIP: Failed to add video track for resource %s: %v", resourceID, err)
+		} else {
+			log.Printf("WHIP: Sending %s video to resource %s", codec.MimeType, resourceID)
+			if bringToFront {
+				go bringPageToFront(sess)
+			}
+			maybeBroadcast(sess)
+		}
+	}
+
 	// Create an answer
 	answer, err := peerConnection.CreateAnswer(nil)
 	if err != nil {
+		resource.cancel()
 		log.Printf("WHIP: Failed to create answer: %v", err)
 		http.Error(w, "Failed to create answer: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -144,73 +240,84 @@ func whipHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Set the LocalDescription
 	if err = peerConnection.SetLocalDescription(answer); err != nil {
+		resource.cancel()
 		log.Printf("WHIP: Failed to set local description: %v", err)
 		http.Error(w, "Failed to set local description: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Wait for ICE gathering to complete
-	log.Printf("WHIP: Waiting for ICE gathering for resource %s", resourceID)
-	select {
-	case <-webrtc.GatheringCompletePromise(peerConnection):
-		log.Printf("WHIP: ICE gathering complete for resource %s", resourceID)
-	case <-time.After(10 * time.Second):
-		log.Printf("WHIP: ICE gathering timed out for resource %s, proceeding", resourceID)
+	// The answer goes back at once with the candidates gathered so far;
+	// the rest are sent in reply to the client's trickled candidates.
+	// Store the resource, unless the peer has already gone
+	if !svc.whip.add(resource) {
+		http.Error(w, "WHIP resource ended before it was created", http.StatusServiceUnavailable)
+		return
 	}
 
-	// Store the resource
-	whipResourcesMu.Lock()
-	whipResources[resourceID] = resource
-	whipResourcesMu.Unlock()
-
 	// Respond with the answer SDP
 	// WHIP requires:
 	// - Status: 201 Created
 	// - Content-Type: application/sdp
 	// - Location header with the resource URL for PATCH/DELETE operations
+	// The ETag names the ICE session that trickled candidates belong to.
 	w.Header().Set("Content-Type", "application/sdp")
-	w.Header().Set("Location", fmt.Sprintf("/sessions/%s/whip/%s", sessionID, resourceID))
+	w.Header().Set("ETag", iceETag(peerConnection))
+	w.Header().Set("Accept-Patch", trickleICEContentType)
+	// The viewer is told which STUN and TURN servers to use.
+	addICEServerLinks(w.Header(), iceServers)
+	w.Header().Set("Location", fmt.Sprintf(apiPrefix+"/sessions/%s/whip/%s", sessionID, resourceID))
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte(peerConnection.LocalDescription().SDP))
 
 	log.Printf("WHIP: Created resource %s for session %s", resourceID, sessionID)
 }
 
+// maxSDPOfferBytes caps the offers WHIP clients send. A browser's offer is
+// a few kilobytes.
+const maxSDPOfferBytes = 64 << 10
+
+// parseSDPOffer checks that a WHIP client's offer is an SDP with at least
+// one media section before it goes anywhere near a peer connection.
+func parseSDPOffer(data []byte) (webrtc.SessionDescription, error) {
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(data)}
+	parsed, err := offer.Unmarshal()
+	if err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	if len(parsed.MediaDescriptions) == 0 {
+		return webrtc.SessionDescription{}, errors.New("offer has no media")
+	}
+	return offer, nil
+}
+
 // whipResourceHandler handles PATCH and DELETE operations on a WHIP resource
-// PATCH /sessions/{id}/whip/{resourceId} - Updates ICE candidates (trickle ICE)
+// PATCH /sessions/{id}/whip/{resourceId} - Adds ICE candidates or restarts ICE (trickle ICE)
 // DELETE /sessions/{id}/whip/{resourceId} - Terminates the WHIP session
 func whipResourceHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	resourceID := vars["resourceId"]
 
-	whipResourcesMu.RLock()
-	resource, ok := whipResources[resourceID]
-	whipResourcesMu.RUnlock()
-
-	if !ok {
+	// A resource is only reached through its own session, which is what
+	// access to the route was checked against.
+	whip := requestServices(r).whip
+	resource, ok := whip.get(resourceID)
+	if !ok || resource.SessionID != vars["id"] {
 		http.Error(w, "WHIP resource not found", http.StatusNotFound)
 		return
 	}
 
 	switch r.Method {
 	case http.MethodPatch:
-		// PATCH is used for trickle ICE (optional in this implementation)
-		// For now, we'll return 204 No Content to indicate we don't need additional ICE candidates
-		w.WriteHeader(http.StatusNoContent)
-		log.Printf("WHIP: PATCH request received for resource %s (trickle ICE not implemented)", resourceID)
+		// PATCH trickles ICE candidates or restarts ICE
+		patchWHIPResource(w, r, resource)
 
 	case http.MethodDelete:
-		// DELETE terminates the WHIP session
-		resource.mu.Lock()
-		if resource.PeerConnection != nil {
-			resource.PeerConnection.Close()
+		// DELETE terminates the WHIP session and its screencast, unless
+		// its peer disconnected in the meantime
+		if !whip.remove(resource) {
+			http.Error(w, "WHIP resource not found", http.StatusNotFound)
+			return
 		}
-		resource.mu.Unlock()
-
-		whipResourcesMu.Lock()
-		delete(whipResources, resourceID)
-		whipResourcesMu.Unlock()
-
 		w.WriteHeader(http.StatusOK)
 		log.Printf("WHIP: Deleted resource %s", resourceID)
 
@@ -219,222 +326,83 @@ func whipResourceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// streamScreencastToDataChannel streams browser screencast frames via WebRTC data channel
-func streamScreencastToDataChannel(sess interface{ GetWSURL() string }, dc *webrtc.DataChannel) {
-	// Connect to CDP (Page Target logic)
-	u, _ := url.Parse(sess.GetWSURL())
-	port := u.Port()
-
-	// Find Page Target
-	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%s/json", port))
-	if err != nil {
-		log.Println("WHIP: Failed to query browser targets:", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	var targets []struct {
-		Type                 string `json:"type"`
-		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
-		log.Println("WHIP: Failed to decode browser targets:", err)
-		return
-	}
-
-	var pageWSURL string
-	for _, t := range targets {
-		if t.Type == "page" && t.WebSocketDebuggerURL != "" {
-			pageWSURL = t.WebSocketDebuggerURL
-			break
-		}
-	}
-
-	if pageWSURL == "" {
-		log.Println("WHIP: No page target found")
-		return
+// streamScreencastToDataChannel streams browser screencast frames via WebRTC
+// data channel until ctx is cancelled or either side goes away. It does not
+// change the page; bringToFront raises it first. Frames are encrypted with
+// sealer unless it is nil.
+func streamScreencastToDataChannel(ctx context.Context, sess *session.Session, dc *webrtc.DataChannel, bringToFront bool, sealer *frameSealer) {
+	// The preview is passive: it never navigates or scrolls the page, and
+	// only raises it when the viewer asked to.
+	if bringToFront {
+		bringPageToFront(sess)
 	}
-	log.Println("WHIP: Connecting to Page CDP:", pageWSURL)
 
-	conn, _, err := websocket.DefaultDialer.Dial(pageWSURL, nil)
+	// Frames come from the session's shared screencast, so any number of
+	// viewers cost the browser a single screencast.
+	viewer, err := sess.Watch(0)
 	if err != nil {
-		log.Println("WHIP: Failed to connect to page:", err)
+		log.Println("WHIP: Failed to start screencast:", err)
 		return
 	}
-	defer conn.Close()
-
-	// Enable Page domain
-	log.Println("WHIP: Enabling Page domain...")
-	conn.WriteJSON(map[string]interface{}{"id": 1, "method": "Page.enable"})
-
-	// Bring to front
-	log.Println("WHIP: Bringing page to front...")
-	conn.WriteJSON(map[string]interface{}{"id": 10, "method": "Page.bringToFront"})
-
-	// Navigate to google.com FIRST before starting screencast
-	log.Println("WHIP: Navigating to google.com...")
-	navMsg := map[string]interface{}{
-		"id":     3,
-		"method": "Page.navigate",
-		"params": map[string]interface{}{
-			"url": "https://www.google.com",
-		},
-	}
-	conn.WriteJSON(navMsg)
-
-	// Wait for page to start loading
-	time.Sleep(2 * time.Second)
-
-	// Start Screencast AFTER navigation
-	log.Println("WHIP: Starting screencast...")
-	startMsg := map[string]interface{}{
-		"id":     2,
-		"method": "Page.startScreencast",
-		"params": map[string]interface{}{
-			"format":        "jpeg",
-			"quality":       80,
-			"maxWidth":      1280,
-			"maxHeight":     720,
-			"everyNthFrame": 1, // Send every frame
-		},
-	}
-	if err := conn.WriteJSON(startMsg); err != nil {
-		log.Println("WHIP: Failed to send startScreencast:", err)
-		return
-	}
-
-	var writeMu sync.Mutex
-
-	// Automated scrolling to demonstrate liveness
-	go func() {
-		time.Sleep(3 * time.Second) // Wait for page load
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-
-		scrollDown := true
-		for range ticker.C {
-			y := 100
-			if !scrollDown {
-				y = -100
-			}
-			scrollDown = !scrollDown
-
-			expr := fmt.Sprintf("window.scrollBy(0, %d);", y)
-			cmd := map[string]interface{}{
-				"id":     time.Now().UnixNano(),
-				"method": "Runtime.evaluate",
-				"params": map[string]interface{}{
-					"expression": expr,
-				},
-			}
+	defer viewer.Close()
+	maybeBroadcast(sess)
 
-			writeMu.Lock()
-			err := conn.WriteJSON(cmd)
-			writeMu.Unlock()
-
-			if err != nil {
-				log.Println("WHIP: Automation write error:", err)
+	frameCount := 0
+	for {
+		var frame session.Frame
+		select {
+		case <-ctx.Done():
+			return
+		case f, ok := <-viewer.C:
+			if !ok {
 				return
 			}
+			frame = f
 		}
-	}()
 
-	var idCounter int64 = 100
-	frameCount := 0
-
-	// Read loop for screencast frames
-	log.Println("WHIP: Starting CDP message read loop...")
-	for {
-		var msg CDPMessage
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Println("WHIP: Error reading from CDP:", err)
-			break
+		frameCount++
+		if frameCount == 1 || frameCount%30 == 0 {
+			log.Printf("WHIP: Sending screencast frame #%d (%d dropped)", frameCount, viewer.Dropped())
 		}
-
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Println("WHIP: Error unmarshalling CDP message:", err)
-			continue
+		data := frame.Data
+		if sealer != nil {
+			data = sealer.seal(data)
 		}
 
-		// Log non-frame CDP messages for debugging
-		if msg.Method != "" && msg.Method != "Page.screencastFrame" {
-			log.Printf("WHIP: Received CDP message: %s", msg.Method)
+		// Send metadata first
+		metaMsg := map[string]interface{}{
+			"type":      "frame-start",
+			"size":      len(data),
+			"encrypted": sealer != nil,
+			"viewport":  frame.Viewport,
+		}
+		metaJSON, _ := json.Marshal(metaMsg)
+		if err := dc.SendText(string(metaJSON)); err != nil {
+			log.Println("WHIP: Failed to send metadata:", err)
+			return
 		}
 
-		if msg.Method == "Page.screencastFrame" {
-			frameCount++
-			if frameCount == 1 || frameCount%30 == 0 {
-				log.Printf("WHIP: Received screencast frame #%d", frameCount)
-			}
-
-			var params WebRTCScreencastFrameParams
-			if err := json.Unmarshal(msg.Params, &params); err != nil {
-				log.Println("WHIP: Failed to unmarshal screencast params:", err)
-				continue
-			}
-
-			data, err := base64.StdEncoding.DecodeString(params.Data)
-			if err != nil {
-				log.Println("WHIP: Failed to decode base64 data:", err)
-				continue
-			}
+		sess.CountStreamBytes(len(metaJSON) + len(data))
 
-			// Send metadata first
-			metaMsg := map[string]interface{}{
-				"type": "frame-start",
-				"size": len(data),
+		// Chunk and send binary data
+		const chunkSize = 16384 // Safe chunk size (16KB)
+		for i := 0; i < len(data); i += chunkSize {
+			end := i + chunkSize
+			if end > len(data) {
+				end = len(data)
 			}
-			metaJSON, _ := json.Marshal(metaMsg)
-			if err := dc.SendText(string(metaJSON)); err != nil {
-				log.Println("WHIP: Failed to send metadata:", err)
+			if err := dc.Send(data[i:end]); err != nil {
+				log.Println("WHIP: Failed to send chunk:", err)
 				break
 			}
-
-			// Chunk and send binary data
-			const chunkSize = 16384 // Safe chunk size (16KB)
-			for i := 0; i < len(data); i += chunkSize {
-				end := i + chunkSize
-				if end > len(data) {
-					end = len(data)
-				}
-				if err := dc.Send(data[i:end]); err != nil {
-					log.Println("WHIP: Failed to send chunk:", err)
-					break
-				}
-			}
-
-			// Acknowledge the frame
-			idCounter++
-			ackCmd := map[string]interface{}{
-				"id":     idCounter,
-				"method": "Page.screencastFrameAck",
-				"params": map[string]interface{}{
-					"sessionId": params.SessionID,
-				},
-			}
-			writeMu.Lock()
-			writeErr := conn.WriteJSON(ackCmd)
-			writeMu.Unlock()
-			if writeErr != nil {
-				log.Println("WHIP: Failed to send Ack:", writeErr)
-			}
 		}
 	}
 }
 
-// CDPMessage represents a Chrome DevTools Protocol message
-type CDPMessage struct {
-	ID     int             `json:"id,omitempty"`
-	Method string          `json:"method,omitempty"`
-	Params json.RawMessage `json:"params,omitempty"`
-}
-
-// WebRTCScreencastFrameParams represents the parameters of a screencast frame
-type WebRTCScreencastFrameParams struct {
-	Data      string `json:"data"`
-	SessionID int    `json:"sessionId"`
-	Metadata  struct {
-		Timestamp float64 `json:"timestamp"`
-	} `json:"metadata"`
+// bringPageToFront raises a session's page for a viewer that asked to.
+func bringPageToFront(sess *session.Session) {
+	log.Println("WHIP: Bringing page to front...")
+	if err := sess.BringToFront(); err != nil {
+		log.Println("WHIP: Failed to bring page to front:", err)
+	}
 }
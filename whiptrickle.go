@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// trickleICEContentType is the media type of the SDP fragments WHIP
+// clients PATCH their candidates and ICE restarts with (RFC 8840).
+const trickleICEContentType = "application/trickle-ice-sdpfrag"
+
+// sdpFrag is an SDP fragment carrying ICE credentials and candidates.
+type sdpFrag struct {
+	ufrag, pwd string
+	candidates []webrtc.ICECandidateInit
+}
+
+// parseSDPFrag reads an application/trickle-ice-sdpfrag body.
+func parseSDPFrag(r io.Reader) (*sdpFrag, error) {
+	f := &sdpFrag{}
+	mid := ""
+	index := -1
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "m="):
+			index++
+			mid = ""
+		case strings.HasPrefix(line, "a=mid:"):
+			mid = strings.TrimPrefix(line, "a=mid:")
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			f.ufrag = strings.TrimPrefix(line, "a=ice-ufrag:")
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			f.pwd = strings.TrimPrefix(line, "a=ice-pwd:")
+		case strings.HasPrefix(line, "a=candidate:"):
+			c := webrtc.ICECandidateInit{Candidate: strings.TrimPrefix(line, "a=")}
+			if mid != "" {
+				c.SDPMid = &mid
+			}
+			if index >= 0 {
+				i := uint16(index)
+				c.SDPMLineIndex = &i
+			}
+			f.candidates = append(f.candidates, c)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if (f.ufrag == "") != (f.pwd == "") {
+		return nil, fmt.Errorf("SDP fragment must have both ice-ufrag and ice-pwd")
+	}
+	// The credentials are copied into the offer of an ICE restart, so
+	// only what RFC 8839 allows gets through.
+	if f.ufrag != "" && (!iceChars(f.ufrag, 4) || !iceChars(f.pwd, 22)) {
+		return nil, fmt.Errorf("ice-ufrag and ice-pwd must be 4 and 22 to 256 letters, digits, + or /")
+	}
+	return f, nil
+}
+
+// iceChars reports whether s is from least to 256 ice-chars long.
+func iceChars(s string, least int) bool {
+	if len(s) < least || len(s) > 256 {
+		return false
+	}
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '+' || r == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// sdpAttribute returns the first value of an attribute in an SDP.
+func sdpAttribute(sdp, name string) string {
+	for _, line := range strings.Split(sdp, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "a="+name+":"); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// restartOffer is the remote offer sdp with new ICE credentials and
+// without the candidates of the old ones.
+func restartOffer(sdp, ufrag, pwd string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(sdp, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "a=ice-ufrag:"):
+			b.WriteString("a=ice-ufrag:" + ufrag + "\r\n")
+		case strings.HasPrefix(trimmed, "a=ice-pwd:"):
+			b.WriteString("a=ice-pwd:" + pwd + "\r\n")
+		case strings.HasPrefix(trimmed, "a=candidate:"), trimmed == "a=end-of-candidates":
+		default:
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// localSDPFrag is the fragment of the server's ICE credentials and the
+// candidates it has gathered so far. Media is bundled, so they are given
+// for the first media section only. It reports false if there are no
+// candidates yet.
+func localSDPFrag(pc *webrtc.PeerConnection) (string, bool) {
+	desc := pc.LocalDescription()
+	if desc == nil {
+		return "", false
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "a=ice-ufrag:%s\r\na=ice-pwd:%s\r\n", sdpAttribute(desc.SDP, "ice-ufrag"), sdpAttribute(desc.SDP, "ice-pwd"))
+	media, candidates := false, 0
+	for _, line := range strings.Split(desc.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "m=") {
+			if media {
+				break
+			}
+			media = true
+			b.WriteString(line + "\r\n")
+			continue
+		}
+		if !media {
+			continue
+		}
+		if strings.HasPrefix(line, "a=mid:") || strings.HasPrefix(line, "a=candidate:") {
+			b.WriteString(line + "\r\n")
+			if strings.HasPrefix(line, "a=candidate:") {
+				candidates++
+			}
+		}
+	}
+	if pc.ICEGatheringState() == webrtc.ICEGatheringStateComplete {
+		b.WriteString("a=end-of-candidates\r\n")
+	}
+	return b.String(), candidates > 0
+}
+
+// iceETag identifies the ICE session of a peer connection, changing with
+// every ICE restart.
+func iceETag(pc *webrtc.PeerConnection) string {
+	if desc := pc.LocalDescription(); desc != nil {
+		return `"` + sdpAttribute(desc.SDP, "ice-ufrag") + `"`
+	}
+	return ""
+}
+
+// patchWHIPResource adds the candidates a WHIP client trickles to its peer
+// connection, or restarts ICE if the client sent new credentials. The
+// response carries the server's own credentials and the candidates it has
+// gathered, since the answer was sent before gathering finished.
+func patchWHIPResource(w http.ResponseWriter, r *http.Request, resource *WHIPResource) {
+	if r.Header.Get("Content-Type") != trickleICEContentType {
+		http.Error(w, "Content-Type must be "+trickleICEContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	frag, err := parseSDPFrag(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resource.mu.Lock()
+	defer resource.mu.Unlock()
+	pc := resource.PeerConnection
+	remote := pc.RemoteDescription()
+	if remote == nil {
+		http.Error(w, "WHIP resource has no remote description", http.StatusConflict)
+		return
+	}
+	restart := frag.ufrag != "" && (frag.ufrag != sdpAttribute(remote.SDP, "ice-ufrag") || frag.pwd != sdpAttribute(remote.SDP, "ice-pwd"))
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" && match != iceETag(pc) {
+		http.Error(w, "ICE session has changed", http.StatusPreconditionFailed)
+		return
+	}
+
+	if restart {
+		offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: restartOffer(remote.SDP, frag.ufrag, frag.pwd)}
+		if err := pc.SetRemoteDescription(offer); err != nil {
+			http.Error(w, "Failed to restart ICE: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		answer, err := pc.CreateAnswer(nil)
+		if err == nil {
+			err = pc.SetLocalDescription(answer)
+		}
+		if err != nil {
+			http.Error(w, "Failed to restart ICE: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("WHIP: Restarted ICE for resource %s", resource.ID)
+	}
+	for _, c := range frag.candidates {
+		if err := pc.AddICECandidate(c); err != nil {
+			http.Error(w, "Invalid ICE candidate: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", iceETag(pc))
+	body, ok := localSDPFrag(pc)
+	if !ok && !restart {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", trickleICEContentType)
+	io.WriteString(w, body)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"browser-server/session"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestParseSDPFrag(t *testing.T) {
+	frag, err := parseSDPFrag(strings.NewReader("a=ice-ufrag:EsAw\r\na=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\na=mid:0\r\n" +
+		"a=candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0\r\na=end-of-candidates\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frag.ufrag != "EsAw" || frag.pwd != "P2uYro0UCOQ4zxjKXaWCBui1" || len(frag.candidates) != 1 {
+		t.Fatalf("frag = %+v", frag)
+	}
+	c := frag.candidates[0]
+	if !strings.HasPrefix(c.Candidate, "candidate:1387637174 ") || c.SDPMid == nil || *c.SDPMid != "0" || c.SDPMLineIndex == nil || *c.SDPMLineIndex != 0 {
+		t.Errorf("candidate = %+v", c)
+	}
+	if _, err := parseSDPFrag(strings.NewReader("a=ice-ufrag:EsAw\r\n")); err == nil {
+		t.Error("fragment with a ufrag but no password accepted")
+	}
+}
+
+func TestRestartOffer(t *testing.T) {
+	sdp := "v=0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\na=ice-ufrag:old\r\na=ice-pwd:oldpwd\r\na=candidate:1 1 udp 1 192.0.2.1 1 typ host\r\na=end-of-candidates\r\na=mid:0\r\n"
+	want := "v=0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\na=ice-ufrag:new\r\na=ice-pwd:newpwd\r\na=mid:0\r\n"
+	if got := restartOffer(sdp, "new", "newpwd"); got != want {
+		t.Errorf("restartOffer = %q", got)
+	}
+}
+
+// patchCandidates trickles SDP fragment lines to a WHIP resource.
+func patchCandidates(resource *WHIPResource, ifMatch string, lines ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(strings.Join(lines, "\r\n")+"\r\n"))
+	r.Header.Set("Content-Type", trickleICEContentType)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	patchWHIPResource(w, r, resource)
+	return w
+}
+
+func TestPatchWHIPResource(t *testing.T) {
+	api, err := newWHIPAPI(session.IPv4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	resource := &WHIPResource{ID: "r1", PeerConnection: server}
+
+	connected := make(chan struct{}, 1)
+	server.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		if s == webrtc.PeerConnectionStateConnected {
+			select {
+			case connected <- struct{}{}:
+			default:
+			}
+		}
+	})
+	candidates := make(chan string, 16)
+	client.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c != nil {
+			candidates <- "a=" + c.ToJSON().Candidate
+		}
+	})
+
+	// Neither side waits for gathering: the client trickles its candidates.
+	client.CreateDataChannel("screencast", nil)
+	offer, _ := client.CreateOffer(nil)
+	client.SetLocalDescription(offer)
+	if err := server.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer.SDP}); err != nil {
+		t.Fatal(err)
+	}
+	answer, _ := server.CreateAnswer(nil)
+	server.SetLocalDescription(answer)
+	etag := iceETag(server)
+	if err := client.SetRemoteDescription(*server.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := patchCandidates(resource, `"stale"`, "a=end-of-candidates"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with a stale ETag: %d", w.Code)
+	}
+	timeout := time.After(10 * time.Second)
+	for done := false; !done; {
+		select {
+		case c := <-candidates:
+			w := patchCandidates(resource, etag, "m=application 9 UDP/DTLS/SCTP webrtc-datachannel", "a=mid:0", c)
+			if w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+				t.Fatalf("PATCH: %d %s", w.Code, w.Body)
+			}
+			if frag := w.Body.String(); frag != "" {
+				// The server's candidates, gathered after the answer.
+				parsed, _ := parseSDPFrag(strings.NewReader(frag))
+				for _, c := range parsed.candidates {
+					client.AddICECandidate(c)
+				}
+			}
+		case <-connected:
+			done = true
+		case <-timeout:
+			t.Fatal("not connected with trickled candidates")
+		}
+	}
+
+	// An ICE restart gets new server credentials and a new ETag.
+	restart, _ := client.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	client.SetLocalDescription(restart)
+	w := patchCandidates(resource, "*", "a=ice-ufrag:"+sdpAttribute(restart.SDP, "ice-ufrag"), "a=ice-pwd:"+sdpAttribute(restart.SDP, "ice-pwd"))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != trickleICEContentType {
+		t.Fatalf("ICE restart: %d %s", w.Code, w.Body)
+	}
+	frag, err := parseSDPFrag(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frag.ufrag == "" || `"`+frag.ufrag+`"` == etag || w.Header().Get("ETag") != `"`+frag.ufrag+`"` {
+		t.Errorf("restart kept the ICE session: ufrag %q, ETag %q (was %s)", frag.ufrag, w.Header().Get("ETag"), etag)
+	}
+	if got := sdpAttribute(server.RemoteDescription().SDP, "ice-ufrag"); got != sdpAttribute(restart.SDP, "ice-ufrag") {
+		t.Errorf("server's remote ufrag = %q after restart", got)
+	}
+}
+
+// FuzzParseSDPFrag checks that fragments clients PATCH either fail to
+// parse or restart ICE with an offer free of the old candidates.
+func FuzzParseSDPFrag(f *testing.F) {
+	f.Add("a=ice-ufrag:EsAw\r\na=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\na=mid:0\r\n" +
+		"a=candidate:1387637174 1 udp 2122260223 192.0.2.1 61764 typ host generation 0\r\na=end-of-candidates\r\n")
+	f.Add("a=ice-ufrag:a\na=ice-pwd:b\n")
+	f.Add("m=\nm=\na=mid:\na=candidate:\n")
+	f.Add("a=ice-ufrag:\r\r\na=ice-pwd: \x00\n")
+	offer := "v=0\r\nm=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\na=ice-ufrag:old\r\na=ice-pwd:oldpwd\r\na=candidate:1 1 udp 1 192.0.2.1 1 typ host\r\na=end-of-candidates\r\na=mid:0\r\n"
+	f.Fuzz(func(t *testing.T, body string) {
+		frag, err := parseSDPFrag(strings.NewReader(body))
+		if err != nil {
+			return
+		}
+		if (frag.ufrag == "") != (frag.pwd == "") {
+			t.Fatalf("fragment %q parsed with ufrag %q and pwd %q", body, frag.ufrag, frag.pwd)
+		}
+		for _, c := range frag.candidates {
+			if !strings.HasPrefix(c.Candidate, "candidate:") {
+				t.Errorf("candidate %q", c.Candidate)
+			}
+		}
+		if frag.ufrag == "" {
+			return
+		}
+		restarted := restartOffer(offer, frag.ufrag, frag.pwd)
+		if strings.Contains(restarted, "a=candidate:") || sdpAttribute(restarted, "ice-ufrag") != frag.ufrag || sdpAttribute(restarted, "ice-pwd") != frag.pwd {
+			t.Errorf("restartOffer(%q, %q) = %q", frag.ufrag, frag.pwd, restarted)
+		}
+	})
+}
+
+// FuzzSDPOffer feeds WHIP offers through the checks whipHandler makes
+// and into a peer connection, as far as an answer.
+func FuzzSDPOffer(f *testing.F) {
+	api, err := newWHIPAPI(session.IPv4)
+	if err != nil {
+		f.Fatal(err)
+	}
+	client, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		f.Fatal(err)
+	}
+	client.CreateDataChannel("screencast", nil)
+	client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	offer, err := client.CreateOffer(nil)
+	client.Close()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add([]byte(offer.SDP))
+	f.Add([]byte("v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\n"))
+	f.Add([]byte("v=0\r\no=- 0 0 IN IP4 0.0.0.0\r\ns=-\r\nt=0 0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=rtpmap:96 VP8/90000\r\n"))
+	f.Add([]byte("m=video"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		offer, err := parseSDPOffer(data)
+		if err != nil {
+			return
+		}
+		offerVideoCodec(offer.SDP)
+		pc, err := api.NewPeerConnection(webrtc.Configuration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		if pc.SetRemoteDescription(offer) == nil {
+			pc.CreateAnswer(nil)
+		}
+	})
+}